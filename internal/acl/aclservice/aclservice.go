@@ -182,3 +182,9 @@ func GetAccessByContextScopeSubject(ctx context.Context, scope aclmodels.Acl2Sco
 	}
 	return ret
 }
+
+// GetGroupsByAccess returns the groups with the access to the subject in the
+// scope.
+func GetGroupsByAccess(ctx context.Context, scope aclmodels.Acl2Scope, subject aclmodels.Acl2Subject, access aclmodels.AccessType) ([]string, error) {
+	return aclrepository.GetGroupsByAccess(ctx, scope, subject, access)
+}
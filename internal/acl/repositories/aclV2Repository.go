@@ -608,3 +608,44 @@ func GetGroupsInUse(ctx context.Context, groups []string) ([]string, error) {
 
 	return result, nil
 }
+
+// GetGroupsByAccess returns the groups given the access to the subject in the
+// scope, either by an acl on the subject or by an acl on the whole ror scope.
+func GetGroupsByAccess(ctx context.Context, scope aclmodels.Acl2Scope, subject aclmodels.Acl2Subject, access aclmodels.AccessType) ([]string, error) {
+	scope = scope.ToKind()
+	subject = subject.ToKind()
+
+	var acls []aclmodels.AclV2ListItem
+	var aggregationPipeline []bson.M
+	aggregationPipeline = append(aggregationPipeline, bson.M{
+		"$match": bson.M{
+			"$or": bson.A{
+				bson.M{
+					"scope":   scope,
+					"subject": subject,
+				},
+				bson.M{
+					"scope": aclmodels.Acl2ScopeRor,
+					"subject": bson.M{
+						"$in": []string{string(scope), string(aclmodels.Acl2RorSubjectGlobal)},
+					},
+				},
+			},
+		},
+	})
+
+	err := mongoAggregate(ctx, AclCollectionName, aggregationPipeline, &acls)
+	if err != nil {
+		rlog.Error("could not query mongodb", err)
+		return nil, err
+	}
+
+	groups := make([]string, 0)
+	for _, acl := range acls {
+		if checkAccess(acl, access) && !slices.Contains(groups, acl.Group) {
+			groups = append(groups, acl.Group)
+		}
+	}
+	slices.Sort(groups)
+	return groups, nil
+}
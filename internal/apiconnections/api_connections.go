@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/NorskHelsenett/ror-api/internal/acl/aclservice/v2"
+	mongodbmigrations "github.com/NorskHelsenett/ror-api/internal/databases/mongodb/migrations"
 	mongodbseeding "github.com/NorskHelsenett/ror-api/internal/databases/mongodb/seeding"
 	"github.com/NorskHelsenett/ror-api/internal/rabbitmq/apirabbitmqdefinitions"
 	"github.com/NorskHelsenett/ror-api/internal/rabbitmq/apirabbitmqhandler"
@@ -33,8 +34,11 @@ import (
 var (
 	VaultClient        *vaultclient.VaultClient
 	RabbitMQConnection rabbitmqclient.RabbitMQConnection
-	RedisDB            redisdb.RedisDB
-	DomainResolvers    *userauth.DomainResolvers
+	// OutboxRabbitMQConnection is used only by the outbox relay, which puts
+	// its channel in confirm mode.
+	OutboxRabbitMQConnection rabbitmqclient.RabbitMQConnection
+	RedisDB                  redisdb.RedisDB
+	DomainResolvers          *userauth.DomainResolvers
 
 	clusterIdToUidCache sync.Map // map[string]string: clusterID -> uid
 )
@@ -55,11 +59,16 @@ func InitConnections(ctx context.Context) {
 	mongodb.MustInitWithContext(ctx, mongocredshelper, rorconfig.GetString(rorconfig.MONGODB_HOST), rorconfig.GetString(rorconfig.MONGODB_PORT), rorconfig.GetString(rorconfig.MONGO_DATABASE))
 
 	mongodbseeding.CheckAndSeed(ctx)
+	// Migrations can take longer than the startup timeout, they run in the
+	// background and report their status on /v2/admin/migrations.
+	go mongodbmigrations.RunAtStartup(context.WithoutCancel(ctx))
 
 	// RabbitMQ
 	rmqcredhelper := rabbitmqcredhelper.NewVaultRMQCredentials(VaultClient, rorconfig.GetString(rorconfig.ROLE))
 	RabbitMQConnection = rabbitmqclient.MustNewRabbitMQConnectionWithContext(ctx, rmqcredhelper, rorconfig.GetString(rorconfig.RABBITMQ_HOST), rorconfig.GetString(rorconfig.RABBITMQ_PORT), rorconfig.GetString(rorconfig.RABBITMQ_BROADCAST_NAME))
 
+	OutboxRabbitMQConnection = rabbitmqclient.MustNewRabbitMQConnectionWithContext(ctx, rmqcredhelper, rorconfig.GetString(rorconfig.RABBITMQ_HOST), rorconfig.GetString(rorconfig.RABBITMQ_PORT), rorconfig.GetString(rorconfig.RABBITMQ_BROADCAST_NAME))
+
 	apirabbitmqdefinitions.InitOrDie(RabbitMQConnection)
 	apirabbitmqhandler.StartListening(RabbitMQConnection)
 
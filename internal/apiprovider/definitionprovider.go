@@ -0,0 +1,68 @@
+package provider
+
+import (
+	"slices"
+
+	providertypes "github.com/NorskHelsenett/ror-api/internal/apiprovider/types"
+)
+
+// definitionProvider is a provider declared by a provider definition.
+type definitionProvider struct {
+	definition providertypes.ProviderDefinition
+}
+
+func NewDefinitionProvider(definition providertypes.ProviderDefinition) *definitionProvider {
+	return &definitionProvider{definition: definition}
+}
+
+func (p *definitionProvider) GetName() string {
+	return p.definition.Name
+}
+
+// GetConfigurations returns the configurations of the wizard page keyed by
+// configuration key, or nil if the provider has no such page.
+func (p *definitionProvider) GetConfigurations(page string) map[string]providertypes.ProviderConfig {
+	for _, providerPage := range p.definition.Pages {
+		if providerPage.Id != page {
+			continue
+		}
+		configurations := make(map[string]providertypes.ProviderConfig, len(providerPage.Configs))
+		for _, config := range providerPage.Configs {
+			configurations[config.Key] = providertypes.ProviderConfig{
+				Name:     config.Name,
+				Page:     []string{page},
+				Order:    config.Order,
+				Query:    config.Query,
+				Disabled: config.Disabled,
+			}
+		}
+		return configurations
+	}
+	return nil
+}
+
+// GetConfigOptions returns the options of the configuration. When the
+// configuration queries another configuration, the selected values of it are
+// passed as options and only the options belonging to them are returned.
+func (p *definitionProvider) GetConfigOptions(configname string, options ...string) []providertypes.ProviderConfigOptions {
+	for _, page := range p.definition.Pages {
+		for _, config := range page.Configs {
+			if config.Key != configname {
+				continue
+			}
+			var filtered []providertypes.ProviderConfigOptions
+			for _, option := range config.Options {
+				if len(options) == 0 || option.Parent == "" || slices.Contains(options, option.Parent) {
+					filtered = append(filtered, providertypes.ProviderConfigOptions{
+						Name:     option.Name,
+						Value:    option.Value,
+						Default:  option.Default,
+						Disabled: option.Disabled,
+					})
+				}
+			}
+			return filtered
+		}
+	}
+	return nil
+}
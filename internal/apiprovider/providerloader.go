@@ -1,9 +1,9 @@
 package provider
 
 import (
+	"context"
 	"slices"
 
-	"github.com/NorskHelsenett/ror-api/internal/apiprovider/tanzu"
 	providertypes "github.com/NorskHelsenett/ror-api/internal/apiprovider/types"
 
 	"github.com/NorskHelsenett/ror/pkg/kubernetes/providers/providermodels"
@@ -19,9 +19,10 @@ type providerLoader struct {
 	Provider map[providermodels.ProviderType]providertypes.Provider
 }
 
-func NewProviderloader(modules []providermodels.ProviderType) *providerLoader {
+// NewProviderloader loads the providers of the modules from the provider
+// registry. Modules without a definition are not loaded.
+func NewProviderloader(ctx context.Context, modules []providermodels.ProviderType) *providerLoader {
 	providerloader := &providerLoader{
-		modules:  modules,
 		Provider: make(map[providermodels.ProviderType]providertypes.Provider),
 	}
 
@@ -30,9 +31,15 @@ func NewProviderloader(modules []providermodels.ProviderType) *providerLoader {
 		return providerloader
 	}
 
-	if slices.Contains(modules, providermodels.ProviderTypeTanzu) {
-		providerloader.Provider[providermodels.ProviderTypeTanzu] = tanzu.NewTanzuProvider()
-		rlog.Info("loading provider", rlog.Any("provider", providerloader.Provider[providermodels.ProviderTypeTanzu].GetName()), rlog.Any("providerId", providermodels.ProviderTypeTanzu))
+	for _, module := range modules {
+		definition, ok := GetDefinition(ctx, module)
+		if !ok {
+			rlog.Warnc(ctx, "no definition for provider", rlog.Any("providerId", module))
+			continue
+		}
+		providerloader.modules = append(providerloader.modules, module)
+		providerloader.Provider[module] = NewDefinitionProvider(definition)
+		rlog.Debugc(ctx, "loading provider", rlog.Any("provider", definition.Name), rlog.Any("providerId", module))
 	}
 
 	return providerloader
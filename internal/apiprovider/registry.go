@@ -0,0 +1,257 @@
+package provider
+
+import (
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	providertypes "github.com/NorskHelsenett/ror-api/internal/apiprovider/types"
+
+	"github.com/NorskHelsenett/ror/pkg/clients/mongodb"
+	"github.com/NorskHelsenett/ror/pkg/config/rorconfig"
+	"github.com/NorskHelsenett/ror/pkg/kubernetes/providers/providermodels"
+	"github.com/NorskHelsenett/ror/pkg/rlog"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// PROVIDERCOLLECTION holds provider definitions added at runtime.
+	PROVIDERCOLLECTION = "providers"
+
+	registryRefreshInterval = time.Minute
+)
+
+// builtinDefinitions are the definitions of the providers shipped with the
+// api. Definitions from the config path or the database replace them by type.
+//
+//go:embed definitions/*.yaml
+var builtinDefinitions embed.FS
+
+var registry = &providerRegistry{}
+
+// providerRegistry holds the provider definitions, loaded from the built in
+// definitions, the files in API_PROVIDERS_PATH and the providers collection,
+// in that order. A later source replaces the definition of a provider type
+// from an earlier one.
+type providerRegistry struct {
+	lock        sync.RWMutex
+	definitions map[providermodels.ProviderType]providertypes.ProviderDefinition
+	loadedAt    time.Time
+}
+
+// GetDefinitions returns the provider definitions ordered by name. The
+// definitions are reloaded when they are older than the refresh interval,
+// if reloading fails the previous definitions are kept.
+func GetDefinitions(ctx context.Context) []providertypes.ProviderDefinition {
+	definitions := registry.get(ctx)
+	list := make([]providertypes.ProviderDefinition, 0, len(definitions))
+	for _, definition := range definitions {
+		list = append(list, definition)
+	}
+	slices.SortFunc(list, func(a, b providertypes.ProviderDefinition) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	return list
+}
+
+// GetDefinition returns the definition of the provider type.
+func GetDefinition(ctx context.Context, providerType providermodels.ProviderType) (providertypes.ProviderDefinition, bool) {
+	definition, ok := registry.get(ctx)[providerType]
+	return definition, ok
+}
+
+// IsOffered returns true if the provider can be ordered, development
+// providers are only offered when running in development.
+func IsOffered(definition providertypes.ProviderDefinition) bool {
+	return !definition.Development || rorconfig.GetBool(rorconfig.DEVELOPMENT)
+}
+
+func (r *providerRegistry) get(ctx context.Context) map[providermodels.ProviderType]providertypes.ProviderDefinition {
+	r.lock.RLock()
+	definitions, loadedAt := r.definitions, r.loadedAt
+	r.lock.RUnlock()
+	if definitions != nil && time.Since(loadedAt) < registryRefreshInterval {
+		return definitions
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.definitions != nil && time.Since(r.loadedAt) < registryRefreshInterval {
+		return r.definitions
+	}
+
+	loaded, err := loadDefinitions(ctx)
+	if err != nil {
+		rlog.Errorc(ctx, "could not load provider definitions", err)
+		if r.definitions != nil {
+			r.loadedAt = time.Now()
+			return r.definitions
+		}
+	}
+	r.definitions = loaded
+	r.loadedAt = time.Now()
+	return r.definitions
+}
+
+// loadDefinitions loads the definitions from all sources. Invalid
+// definitions are skipped and reported in the returned error, so one bad
+// document does not hide the other providers.
+func loadDefinitions(ctx context.Context) (map[providermodels.ProviderType]providertypes.ProviderDefinition, error) {
+	definitions := make(map[providermodels.ProviderType]providertypes.ProviderDefinition)
+	var errs []error
+	add := func(source string, definition providertypes.ProviderDefinition) {
+		if err := ValidateDefinition(definition); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", source, err))
+			return
+		}
+		definitions[definition.Type] = definition
+	}
+
+	builtin, err := readDefinitionFiles(builtinDefinitions, "definitions")
+	if err != nil {
+		errs = append(errs, err)
+	}
+	for _, source := range slices.Sorted(maps.Keys(builtin)) {
+		add(source, builtin[source])
+	}
+
+	if definitionPath := rorconfig.GetString("API_PROVIDERS_PATH"); definitionPath != "" {
+		files, err := readDefinitionPath(definitionPath)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		for _, source := range slices.Sorted(maps.Keys(files)) {
+			add(source, files[source])
+		}
+	}
+
+	stored, err := getStoredDefinitions(ctx)
+	if err != nil {
+		errs = append(errs, err)
+	}
+	for _, definition := range stored {
+		add(PROVIDERCOLLECTION+"/"+string(definition.Type), definition)
+	}
+
+	return definitions, errors.Join(errs...)
+}
+
+// readDefinitionPath reads the definitions in a file, or in the yaml and json
+// files of a directory.
+func readDefinitionPath(definitionPath string) (map[string]providertypes.ProviderDefinition, error) {
+	info, err := os.Stat(definitionPath)
+	if err != nil {
+		return nil, fmt.Errorf("could not read provider definitions: %w", err)
+	}
+	if info.IsDir() {
+		return readDefinitionFiles(os.DirFS(definitionPath), ".")
+	}
+	return readDefinitionFiles(os.DirFS(filepath.Dir(definitionPath)), filepath.Base(definitionPath))
+}
+
+// readDefinitionFiles reads the named yaml or json file, or all yaml and json
+// files when the name is a directory. The definitions are keyed by file name.
+func readDefinitionFiles(fsys fs.FS, name string) (map[string]providertypes.ProviderDefinition, error) {
+	files := []string{name}
+	if entries, err := fs.ReadDir(fsys, name); err == nil {
+		files = files[:0]
+		for _, entry := range entries {
+			if !entry.IsDir() && isDefinitionFile(entry.Name()) {
+				files = append(files, path.Join(name, entry.Name()))
+			}
+		}
+	}
+
+	definitions := make(map[string]providertypes.ProviderDefinition, len(files))
+	var errs []error
+	for _, file := range files {
+		data, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("could not read provider definition %s: %w", file, err))
+			continue
+		}
+		definition, err := ParseDefinition(data)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("could not parse provider definition %s: %w", file, err))
+			continue
+		}
+		definitions[file] = definition
+	}
+	return definitions, errors.Join(errs...)
+}
+
+func isDefinitionFile(name string) bool {
+	switch path.Ext(name) {
+	case ".yaml", ".yml", ".json":
+		return true
+	}
+	return false
+}
+
+// ParseDefinition parses a provider definition written in yaml or json.
+func ParseDefinition(data []byte) (providertypes.ProviderDefinition, error) {
+	var definition providertypes.ProviderDefinition
+	err := yaml.UnmarshalStrict(data, &definition)
+	return definition, err
+}
+
+func getStoredDefinitions(ctx context.Context) ([]providertypes.ProviderDefinition, error) {
+	collection := mongodb.GetMongoDb().Collection(PROVIDERCOLLECTION)
+	cursor, err := collection.Find(ctx, bson.M{})
+	if err != nil {
+		return nil, fmt.Errorf("could not get provider definitions: %w", err)
+	}
+	var definitions []providertypes.ProviderDefinition
+	if err := cursor.All(ctx, &definitions); err != nil {
+		return nil, fmt.Errorf("could not decode provider definitions: %w", err)
+	}
+	return definitions, nil
+}
+
+// ValidateDefinition checks that the provider has a type and a name, and
+// that the configurations of each page are unique and only query
+// configurations on the same page.
+func ValidateDefinition(definition providertypes.ProviderDefinition) error {
+	if definition.Type == "" || definition.Name == "" {
+		return errors.New("provider definition must have a type and a name")
+	}
+	pages := make(map[string]bool, len(definition.Pages))
+	for _, page := range definition.Pages {
+		if page.Id == "" {
+			return fmt.Errorf("provider %s has a page without id", definition.Type)
+		}
+		if pages[page.Id] {
+			return fmt.Errorf("provider %s has duplicate page %s", definition.Type, page.Id)
+		}
+		pages[page.Id] = true
+
+		keys := make(map[string]bool, len(page.Configs))
+		for _, config := range page.Configs {
+			if config.Key == "" {
+				return fmt.Errorf("provider %s page %s has a configuration without key", definition.Type, page.Id)
+			}
+			if keys[config.Key] {
+				return fmt.Errorf("provider %s page %s has duplicate configuration %s", definition.Type, page.Id, config.Key)
+			}
+			keys[config.Key] = true
+		}
+		for _, config := range page.Configs {
+			if config.Query != "" && !keys[config.Query] {
+				return fmt.Errorf("provider %s configuration %s queries unknown configuration %s", definition.Type, config.Key, config.Query)
+			}
+		}
+	}
+	return nil
+}
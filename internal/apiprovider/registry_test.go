@@ -0,0 +1,87 @@
+package provider
+
+import (
+	"testing"
+
+	providertypes "github.com/NorskHelsenett/ror-api/internal/apiprovider/types"
+
+	"github.com/NorskHelsenett/ror/pkg/kubernetes/providers/providermodels"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuiltinDefinitions(t *testing.T) {
+	definitions, err := readDefinitionFiles(builtinDefinitions, "definitions")
+	require.NoError(t, err)
+
+	types := make(map[providermodels.ProviderType]bool)
+	for source, definition := range definitions {
+		assert.NoError(t, ValidateDefinition(definition), source)
+		types[definition.Type] = true
+	}
+	for _, providerType := range []providermodels.ProviderType{
+		providermodels.ProviderTypeTanzu,
+		providermodels.ProviderTypeTalos,
+		providermodels.ProviderTypeKind,
+		providermodels.ProviderTypeK3d,
+	} {
+		assert.True(t, types[providerType], "missing definition for %s", providerType)
+	}
+}
+
+func TestParseDefinitionJson(t *testing.T) {
+	definition, err := ParseDefinition([]byte(`{"type":"talos","name":"Talos DC2","pages":[{"id":"cluster.create.1","configs":[{"key":"datacenter","name":"Datacenter","order":1}]}]}`))
+	require.NoError(t, err)
+	assert.Equal(t, "Talos DC2", definition.Name)
+	assert.NoError(t, ValidateDefinition(definition))
+
+	_, err = ParseDefinition([]byte("type: talos\nname: Talos\nunknown: true\n"))
+	assert.Error(t, err)
+}
+
+func TestValidateDefinition(t *testing.T) {
+	definition := providertypes.ProviderDefinition{
+		Type: providermodels.ProviderTypeKind,
+		Name: "Kind",
+		Pages: []providertypes.ProviderPage{{
+			Id: "cluster.create.1",
+			Configs: []providertypes.ProviderPageConfig{
+				{Key: "machineClass", Query: "namespace"},
+			},
+		}},
+	}
+	assert.ErrorContains(t, ValidateDefinition(definition), "unknown configuration namespace")
+
+	definition.Pages[0].Configs = append(definition.Pages[0].Configs, providertypes.ProviderPageConfig{Key: "machineClass"})
+	assert.ErrorContains(t, ValidateDefinition(definition), "duplicate configuration machineClass")
+
+	assert.Error(t, ValidateDefinition(providertypes.ProviderDefinition{Name: "No type"}))
+}
+
+func TestDefinitionProvider(t *testing.T) {
+	provider := NewDefinitionProvider(providertypes.ProviderDefinition{
+		Type: providermodels.ProviderTypeTanzu,
+		Name: "Tanzu",
+		Pages: []providertypes.ProviderPage{{
+			Id: "cluster.create.1",
+			Configs: []providertypes.ProviderPageConfig{
+				{Key: "datacenter", Order: 1},
+				{Key: "Machine-class", Order: 2, Query: "datacenter", Options: []providertypes.ProviderPageOption{
+					{Name: "Medium", Value: "best-effort-medium"},
+					{Name: "GPU", Value: "gpu-large", Parent: "trd1"},
+				}},
+			},
+		}},
+	})
+
+	configurations := provider.GetConfigurations("cluster.create.1")
+	require.Len(t, configurations, 2)
+	assert.Equal(t, []string{"cluster.create.1"}, configurations["Machine-class"].Page)
+	assert.Nil(t, provider.GetConfigurations("cluster.create.2"))
+
+	assert.Len(t, provider.GetConfigOptions("Machine-class"), 2)
+	assert.Len(t, provider.GetConfigOptions("Machine-class", "trd1"), 2)
+	options := provider.GetConfigOptions("Machine-class", "osl1")
+	require.Len(t, options, 1)
+	assert.Equal(t, "best-effort-medium", options[0].Value)
+}
@@ -1,5 +1,9 @@
 package types
 
+import "github.com/NorskHelsenett/ror/pkg/kubernetes/providers/providermodels"
+
+// ProviderConfig is a configuration of a wizard page as returned by the v1
+// api, the fields are serialized by their names.
 type ProviderConfig struct {
 	Name     string
 	Page     []string
@@ -8,6 +12,8 @@ type ProviderConfig struct {
 	Disabled bool
 }
 
+// ProviderConfigOptions is an option of a configuration as returned by the
+// v1 api, the fields are serialized by their names.
 type ProviderConfigOptions struct {
 	Name     string
 	Value    string
@@ -15,6 +21,54 @@ type ProviderConfigOptions struct {
 	Disabled bool
 }
 
+// ProviderPageConfig declares a configuration of a wizard page in a provider
+// definition.
+type ProviderPageConfig struct {
+	Key      string               `json:"key" bson:"key"`
+	Name     string               `json:"name" bson:"name"`
+	Order    int                  `json:"order" bson:"order"`
+	Query    string               `json:"query,omitempty" bson:"query,omitempty"`
+	Disabled bool                 `json:"disabled" bson:"disabled"`
+	Options  []ProviderPageOption `json:"options,omitempty" bson:"options,omitempty"`
+}
+
+// ProviderPageOption declares an option of a configuration in a provider
+// definition.
+type ProviderPageOption struct {
+	Name     string `json:"name" bson:"name"`
+	Value    string `json:"value" bson:"value"`
+	Default  bool   `json:"default" bson:"default"`
+	Disabled bool   `json:"disabled" bson:"disabled"`
+	// Parent is the value of the queried configuration the option belongs
+	// to, an option without parent is offered for every value.
+	Parent string `json:"parent,omitempty" bson:"parent,omitempty"`
+}
+
+// ProviderPage is a page of the order wizard of a provider.
+type ProviderPage struct {
+	Id      string               `json:"id" bson:"id"`
+	Name    string               `json:"name,omitempty" bson:"name,omitempty"`
+	Configs []ProviderPageConfig `json:"configs" bson:"configs"`
+}
+
+type KubernetesVersion struct {
+	Name     string `json:"name" bson:"name"`
+	Version  string `json:"version" bson:"version"`
+	Disabled bool   `json:"disabled" bson:"disabled"`
+}
+
+// ProviderDefinition declares a provider, the kubernetes versions it offers
+// and the pages of its order wizard.
+type ProviderDefinition struct {
+	Type     providermodels.ProviderType `json:"type" bson:"type"`
+	Name     string                      `json:"name" bson:"name"`
+	Disabled bool                        `json:"disabled" bson:"disabled"`
+	// Development providers are only offered when running in development.
+	Development        bool                `json:"development,omitempty" bson:"development,omitempty"`
+	KubernetesVersions []KubernetesVersion `json:"kubernetesVersions,omitempty" bson:"kubernetesversions,omitempty"`
+	Pages              []ProviderPage      `json:"pages,omitempty" bson:"pages,omitempty"`
+}
+
 type Provider interface {
 	GetName() string
 	GetConfigurations(page string) map[string]ProviderConfig
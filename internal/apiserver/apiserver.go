@@ -9,6 +9,12 @@ import (
 
 	"github.com/NorskHelsenett/ror-api/internal/apiconnections"
 	"github.com/NorskHelsenett/ror-api/internal/apikeyauth"
+	"github.com/NorskHelsenett/ror-api/internal/apiservices/certificatesservice"
+	"github.com/NorskHelsenett/ror-api/internal/apiservices/clustersservice"
+	"github.com/NorskHelsenett/ror-api/internal/apiservices/outboxservice"
+	"github.com/NorskHelsenett/ror-api/internal/apiservices/webhooksservice"
+	"github.com/NorskHelsenett/ror-api/internal/mtlsauth"
+	"github.com/NorskHelsenett/ror-api/internal/serviceaccountauth"
 	"github.com/NorskHelsenett/ror-api/internal/utils/switchboard"
 	"github.com/NorskHelsenett/ror-api/internal/webserver"
 	"github.com/NorskHelsenett/ror-api/pkg/middelware/authmiddleware"
@@ -57,6 +63,15 @@ func Run() {
 	//TODO: Refactor the init functions called to respect context cancelations
 	apiconnections.InitConnections(ctx)
 
+	// Clusters pending purge are purged when their grace period has passed.
+	clustersservice.StartPurgeReaper(ctx)
+	// Resource events are published to the message bus from the outbox.
+	outboxservice.StartRelay(ctx, apiconnections.OutboxRabbitMQConnection)
+	// Resource events are matched against the rulesets and notified about.
+	switchboard.Start(ctx, apiconnections.RabbitMQConnection)
+	// v2 events are posted to the webhooks registered for them.
+	webhooksservice.Start(ctx, apiconnections.RabbitMQConnection)
+
 	err := rortracer.InitWithDefault(ctx, rortracer.WithTimeout(time.Second*5))
 	if err != nil {
 		rlog.Fatal("failed to initialize tracer with default values", err)
@@ -94,15 +109,25 @@ func Run() {
 	manager := oidchelper.NewManagerWithValidator(signerIssuer, tokenstoragehelper.GetSigningTokenKeyStorage(), oidcValidator)
 	tokenservice.SetManager(manager)
 
-	// Register authentication providers (shared OIDC validator + api keys) before
-	// the web server starts serving requests.
+	// The certificate authority signs the client certificates of the agents,
+	// and the web server verifies them against it.
+	if err := certificatesservice.Init(); err != nil {
+		rlog.Fatal("could not load the certificate authority", err)
+	}
+
+	// Register authentication providers (service account tokens, shared OIDC
+	// validator, api keys + client certificates) before the web server starts
+	// serving requests. The service account tokens are bearer tokens too, so
+	// their provider goes first, and the client certificate is used when the
+	// request has no token or api key.
+	authmiddleware.RegisterAuthProvider(serviceaccountauth.NewServiceAccountAuthProvider(ctx))
 	authmiddleware.RegisterAuthProvider(oauthmiddleware.NewOauthMiddleware(oidcValidator))
 	authmiddleware.RegisterAuthProvider(apikeyauth.NewApiKeyAuthProvider())
+	authmiddleware.RegisterAuthProvider(mtlsauth.NewCertificateAuthProvider(certificatesservice.Authority()))
 
 	webserver.StartListening(ctx, &wg)
 
 	if apiconnections.RabbitMQConnection.Ping() {
-		// Use of unimplemented code
 		switchboard.PublishStarted(ctx)
 	}
 
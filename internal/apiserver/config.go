@@ -52,6 +52,53 @@ func InitConfig() {
 	rorconfig.SetDefault("HELSEGITLAB_BASE_URL", "https://helsegitlab.nhn.no/api/v4/projects/")
 
 	rorconfig.SetDefault("TOKEN_STORE_VAULT_PATH", "secret/data/v1.0/ror/config/token")
+	rorconfig.SetDefault("RESOURCEV2_WATCH_RETENTION", "24h")
+	rorconfig.SetDefault("RESOURCEV2_HISTORY_KINDS", "")
+	rorconfig.SetDefault("RESOURCEV2_HISTORY_RETENTION", "720h")
+	rorconfig.SetDefault("SSE_REPLAY_BUFFER_SIZE", "1000")
+	rorconfig.SetDefault("MONGODB_MIGRATIONS", "dryrun")
+	rorconfig.SetDefault("KUBECONFIG_OIDC_EXEC_COMMAND", "ror")
+	rorconfig.SetDefault("KUBECONFIG_OIDC_EXEC_ARGS", "token,--cluster-id,{clusterId}")
+	rorconfig.SetDefault("KUBECONFIG_OIDC_STATIC_TOKEN", false)
+	rorconfig.SetDefault("RATELIMIT_V1_RESOURCE_BUDGETS", "")
+	rorconfig.SetDefault("RATELIMIT_V2_RESOURCE_BUDGETS", "")
+	rorconfig.SetDefault("API_PROVIDERS_PATH", "")
+	rorconfig.SetDefault("CLUSTERORDER_VALIDATION_TIMEOUT", "15m")
+	rorconfig.SetDefault("CLUSTERORDER_PROVISIONING_TIMEOUT", "2h")
+	rorconfig.SetDefault("CLUSTERORDER_APPROVAL_ALLOW_SELF", false)
+	rorconfig.SetDefault("PRICE_CURRENCY", "NOK")
+	rorconfig.SetDefault("METRICS_RETENTION_MINUTE", "168h")
+	rorconfig.SetDefault("METRICS_RETENTION_HOURLY", "2160h")
+	rorconfig.SetDefault("METRICS_RETENTION_DAILY", "17520h")
+	rorconfig.SetDefault("FLEET_METRICS_CACHE_TTL", "1m")
+	rorconfig.SetDefault("FLEET_METRICS_SERIES_LIMIT", "200")
+	rorconfig.SetDefault("CLUSTER_PURGE_GRACE_PERIOD", "168h")
+	rorconfig.SetDefault("CLUSTER_PURGE_REAPER_INTERVAL", "10m")
+	rorconfig.SetDefault("OUTBOX_RELAY_INTERVAL", "1s")
+	rorconfig.SetDefault("OUTBOX_RETENTION", "24h")
+	rorconfig.SetDefault("SWITCHBOARD_DISPATCH_INTERVAL", "10s")
+	rorconfig.SetDefault("SWITCHBOARD_MAX_ATTEMPTS", "8")
+	rorconfig.SetDefault("SWITCHBOARD_SLACK_WEBHOOK_URL", "")
+	rorconfig.SetDefault("SWITCHBOARD_DELIVERY_RETENTION", "720h")
+	rorconfig.SetDefault("SMTP_HOST", "")
+	rorconfig.SetDefault("SMTP_PORT", "587")
+	rorconfig.SetDefault("SMTP_USERNAME", "")
+	rorconfig.SetDefault("SMTP_PASSWORD", "")
+	rorconfig.SetDefault("SMTP_FROM", "")
+	rorconfig.SetDefault("WEBHOOK_DISPATCH_INTERVAL", "5s")
+	rorconfig.SetDefault("WEBHOOK_MAX_ATTEMPTS", "10")
+	rorconfig.SetDefault("WEBHOOK_DELIVERY_RETENTION", "720h")
+	rorconfig.SetDefault("AGENT_APIKEYS_ENABLED", true)
+	rorconfig.SetDefault("SERVICEACCOUNT_TOKEN_AUDIENCE", "ror-api")
+	rorconfig.SetDefault("SERVICEACCOUNT_ISSUER_HOSTS", "")
+	rorconfig.SetDefault("TLS_ENABLED", false)
+	rorconfig.SetDefault("TLS_CERT_FILE", "")
+	rorconfig.SetDefault("TLS_KEY_FILE", "")
+	rorconfig.SetDefault("TLS_CLIENT_CA_FILE", "")
+	rorconfig.SetDefault("TLS_CLIENT_SERVICES", "")
+	rorconfig.SetDefault("CA_CERT_FILE", "")
+	rorconfig.SetDefault("CA_KEY_FILE", "")
+	rorconfig.SetDefault("CA_CERT_TTL", "168h")
 
 	if rorconfig.GetBool(rorconfig.OIDC_SKIP_ISSUER_VERIFY) {
 		rlog.Error("skipping OIDC issuer verification. THIS IS UNSAFE IN PRODUCTION!!!", nil)
@@ -6,13 +6,19 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/NorskHelsenett/ror-api/internal/apiservices/certificatesservice"
 	"github.com/NorskHelsenett/ror-api/internal/apiservices/clustersservice"
 	"github.com/NorskHelsenett/ror-api/internal/apiservices/resourcesv2service"
+	"github.com/NorskHelsenett/ror-api/internal/databases/mongodb/mongotransaction"
 	apikeyrepo "github.com/NorskHelsenett/ror-api/internal/databases/mongodb/repositories/apikeys"
+	"github.com/NorskHelsenett/ror-api/internal/databases/mongodb/repositories/clustercertificates"
+	"github.com/NorskHelsenett/ror-api/internal/databases/mongodb/repositories/clusterissuers"
 	datacenterRepo "github.com/NorskHelsenett/ror-api/internal/databases/mongodb/repositories/datacenters"
 
 	"github.com/NorskHelsenett/ror-api/internal/auditlog"
 	"github.com/NorskHelsenett/ror-api/internal/models"
+	"github.com/NorskHelsenett/ror-api/internal/models/serviceaccountmodels"
+	"github.com/NorskHelsenett/ror-api/internal/serviceaccountauth"
 
 	"github.com/NorskHelsenett/ror/pkg/config/rorconfig"
 	"github.com/NorskHelsenett/ror/pkg/kubernetes/providers/providermodels"
@@ -23,7 +29,6 @@ import (
 	identitymodels "github.com/NorskHelsenett/ror/pkg/models/identity"
 
 	"github.com/NorskHelsenett/ror/pkg/apicontracts"
-	"github.com/NorskHelsenett/ror/pkg/apicontracts/apikeystypes/v2"
 	"github.com/NorskHelsenett/ror/pkg/apicontracts/v2/apicontractsv2self"
 
 	"github.com/NorskHelsenett/ror/pkg/rlog"
@@ -33,6 +38,12 @@ import (
 	"github.com/google/uuid"
 )
 
+var (
+	ErrIssuerExists      = clusterissuers.ErrExists
+	ErrNotCluster        = errors.New("the identity is not a cluster")
+	ErrClusterRegistered = errors.New("the cluster is already registered, its agent must authenticate to change its credentials")
+)
+
 const (
 	minApikeyTtlSeconds int64 = 60                 // 1 minute
 	maxApikeyTtlSeconds int64 = 365 * 24 * 60 * 60 // 1 year
@@ -321,12 +332,25 @@ func CreateForAgent(ctx context.Context, input *apicontracts.AgentApiKeyModel) (
 	return uniqueId.String(), nil
 }
 
-func CreateForAgentV2(ctx context.Context, req *apikeystypes.RegisterClusterRequest) (apikeystypes.RegisterClusterResponse, error) {
-	response := apikeystypes.RegisterClusterResponse{}
+// RegisterAgentV2 registers a cluster agent. The certificate signing request
+// of the agent is signed if it is set, and the issuer of the service account
+// tokens of the cluster is registered if it is set, for the agent to
+// authenticate with them. An api key is created for the agent unless
+// AgentApiKeysEnabled is false. Registration is not authenticated, so the
+// issuer and the certificate are only registered for a new cluster, and it
+// returns ErrClusterRegistered for a cluster with them, which only the
+// cluster can replace.
+func RegisterAgentV2(ctx context.Context, req *serviceaccountmodels.RegisterAgentRequest) (serviceaccountmodels.RegisterAgentResponse, error) {
+	response := serviceaccountmodels.RegisterAgentResponse{}
 	if req == nil {
 		return response, errors.New("input is nil")
 	}
 
+	createApikey := AgentApiKeysEnabled()
+	if !createApikey && req.ServiceAccountIssuer == nil && req.Csr == "" {
+		return response, fmt.Errorf("%w: agent api keys are disabled, a service account issuer or a certificate signing request is required", serviceaccountauth.ErrInvalidIssuer)
+	}
+
 	if req.ClusterId == "" && req.Uid == "" {
 		return response, errors.New("clusterid or uid is required")
 	}
@@ -373,19 +397,27 @@ func CreateForAgentV2(ctx context.Context, req *apikeystypes.RegisterClusterRequ
 		// cannot derive a clusterid for the apikey identifier.
 		return response, errors.New("could not determine clusterid: provided uid does not match an existing cluster")
 	}
+	// A cluster with a KubernetesCluster resource is already registered.
+	known := clusterUid != ""
 
-	apikeys, err := apikeyrepo.GetByIdentifier(mongoctx, clusterId)
-	if err != nil {
-		return response, fmt.Errorf("error when checking apikey for identifier: %w", err)
+	if req.ServiceAccountIssuer != nil || req.Csr != "" {
+		if err := requireNewCluster(mongoctx, clusterId, known); err != nil {
+			return response, err
+		}
 	}
 
-	if len(apikeys) > 0 {
-		return response, fmt.Errorf("already a key for identifier: %s", clusterId)
-	}
+	if createApikey {
+		apikeys, err := apikeyrepo.GetByIdentifier(mongoctx, clusterId)
+		if err != nil {
+			return response, fmt.Errorf("error when checking apikey for identifier: %w", err)
+		}
 
-	uniqueId, err := uuid.NewUUID()
-	if err != nil {
-		return response, err
+		if len(apikeys) > 0 {
+			return response, fmt.Errorf("already a key for identifier: %s", clusterId)
+		}
+		if err := requireNoCredentials(mongoctx, clusterId); err != nil {
+			return response, err
+		}
 	}
 
 	// Only mint a new uid when we positively confirmed no cluster resource exists.
@@ -393,27 +425,159 @@ func CreateForAgentV2(ctx context.Context, req *apikeystypes.RegisterClusterRequ
 		clusterUid = uuid.NewString()
 	}
 
-	apikey := apicontracts.ApiKey{}
-	hash := stringhelper.HashSHA512(uniqueId.String(), []byte(mustGetApikeySalt()))
+	response.ClusterId = clusterId
+	response.Uid = clusterUid
 
-	apikey.DisplayName = clusterId
-	apikey.Identifier = clusterId
-	apikey.Uid = clusterUid
+	var clusterIssuer *serviceaccountmodels.ClusterIssuer
+	if req.ServiceAccountIssuer != nil {
+		resolved, err := serviceaccountauth.ResolveIssuer(ctx, *req.ServiceAccountIssuer)
+		if err != nil {
+			return response, err
+		}
+		registered := newClusterIssuer(clusterId, clusterUid, resolved)
+		clusterIssuer = &registered
+	}
 
-	apikey.ReadOnly = false
-	apikey.Type = apicontracts.ApiKeyTypeCluster
-	apikey.Hash = hash
+	var apikey apicontracts.ApiKey
+	var secret string
+	if createApikey {
+		uniqueId, err := uuid.NewUUID()
+		if err != nil {
+			return response, err
+		}
+		secret = uniqueId.String()
 
-	err = apikeyrepo.Create(mongoctx, apikey)
+		apikey.DisplayName = clusterId
+		apikey.Identifier = clusterId
+		apikey.Uid = clusterUid
+
+		apikey.ReadOnly = false
+		apikey.Type = apicontracts.ApiKeyTypeCluster
+		apikey.Hash = stringhelper.HashSHA512(secret, []byte(mustGetApikeySalt()))
+	}
+
+	// The credentials are stored together, a certificate is only issued if
+	// the issuer and the api key are stored with it.
+	writectx, cancelWrite := context.WithTimeout(ctx, 5*time.Second)
+	defer cancelWrite()
+	err := mongotransaction.Run(writectx, func(ctx context.Context) error {
+		response.Certificate = nil
+		if req.Csr != "" {
+			certificate, err := certificatesservice.IssueForCluster(ctx, clusterId, clusterUid, req.Csr)
+			if err != nil {
+				return err
+			}
+			response.Certificate = &certificate
+		}
+		if clusterIssuer != nil {
+			if err := clusterissuers.Create(ctx, clusterIssuer); err != nil {
+				return err
+			}
+		}
+		if createApikey {
+			return apikeyrepo.Create(ctx, apikey)
+		}
+		return nil
+	})
+	if err != nil {
+		return serviceaccountmodels.RegisterAgentResponse{}, err
+	}
+
+	response.ApiKey = secret
+	return response, nil
+}
+
+// AgentApiKeysEnabled reports whether api keys are created for the agents
+// when they register. Agents authenticate with the service account tokens of
+// their cluster when it is false.
+func AgentApiKeysEnabled() bool {
+	return rorconfig.GetBool("AGENT_APIKEYS_ENABLED")
+}
+
+// UpdateServiceAccountIssuer replaces the issuer of the service account
+// tokens of the cluster of the identity of the context, e.g. when its keys
+// are rotated.
+func UpdateServiceAccountIssuer(ctx context.Context, issuer serviceaccountmodels.ServiceAccountIssuer) (serviceaccountmodels.ClusterIssuer, error) {
+	identity := rorcontext.MustGetIdentityFromRorContext(ctx)
+	if !identity.IsCluster() || identity.ClusterIdentity == nil {
+		return serviceaccountmodels.ClusterIssuer{}, ErrNotCluster
+	}
+
+	resolved, err := serviceaccountauth.ResolveIssuer(ctx, issuer)
+	if err != nil {
+		return serviceaccountmodels.ClusterIssuer{}, err
+	}
+
+	mongoctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	clusterIssuer, err := clusterissuers.GetByClusterId(mongoctx, identity.ClusterIdentity.Id)
+	if errors.Is(err, clusterissuers.ErrNotFound) {
+		clusterIssuer = newClusterIssuer(identity.ClusterIdentity.Id, identity.ClusterIdentity.Uid, resolved)
+		return clusterIssuer, clusterissuers.Create(mongoctx, &clusterIssuer)
+	}
+	if err != nil {
+		return clusterIssuer, err
+	}
+
+	clusterIssuer.Issuer = resolved.Issuer
+	clusterIssuer.JwksUri = resolved.JwksUri
+	clusterIssuer.Jwks = resolved.Jwks
+	clusterIssuer.Subjects = resolved.Subjects
+	clusterIssuer.UpdatedAt = time.Now()
+	return clusterIssuer, clusterissuers.Update(mongoctx, &clusterIssuer)
+}
+
+// requireNewCluster returns ErrClusterRegistered unless the cluster is new,
+// with no KubernetesCluster resource, api key, service account issuer or
+// certificate.
+func requireNewCluster(ctx context.Context, clusterId string, known bool) error {
+	if known {
+		return ErrClusterRegistered
+	}
+	apikeys, err := apikeyrepo.GetByIdentifier(ctx, clusterId)
 	if err != nil {
-		return response, err
+		return fmt.Errorf("error when checking apikey for identifier: %w", err)
+	}
+	if len(apikeys) > 0 {
+		return ErrClusterRegistered
 	}
+	return requireNoCredentials(ctx, clusterId)
+}
 
-	return apikeystypes.RegisterClusterResponse{
-		ClusterId: clusterId,
-		ApiKey:    uniqueId.String(),
-		Uid:       clusterUid,
-	}, nil
+// requireNoCredentials returns ErrClusterRegistered if the cluster has a
+// service account issuer or a certificate, so no api key is created for a
+// cluster authenticating with them.
+func requireNoCredentials(ctx context.Context, clusterId string) error {
+	_, err := clusterissuers.GetByClusterId(ctx, clusterId)
+	if err == nil {
+		return ErrClusterRegistered
+	}
+	if !errors.Is(err, clusterissuers.ErrNotFound) {
+		return err
+	}
+
+	_, err = clustercertificates.GetByClusterId(ctx, clusterId)
+	if err == nil {
+		return ErrClusterRegistered
+	}
+	if !errors.Is(err, clustercertificates.ErrNotFound) {
+		return err
+	}
+	return nil
+}
+
+func newClusterIssuer(clusterId string, clusterUid string, issuer serviceaccountmodels.ServiceAccountIssuer) serviceaccountmodels.ClusterIssuer {
+	now := time.Now()
+	return serviceaccountmodels.ClusterIssuer{
+		ClusterId:    clusterId,
+		Uid:          clusterUid,
+		Issuer:       issuer.Issuer,
+		JwksUri:      issuer.JwksUri,
+		Jwks:         issuer.Jwks,
+		Subjects:     issuer.Subjects,
+		RegisteredAt: now,
+		UpdatedAt:    now,
+	}
 }
 
 // ResolveClusterUid returns the authoritative uid for a cluster apikey. The uid
@@ -0,0 +1,155 @@
+package certificatesservice
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/NorskHelsenett/ror-api/internal/models/certificatemodels"
+	"github.com/NorskHelsenett/ror-api/internal/mtlsauth"
+)
+
+const (
+	// backdate is how long before they are signed the certificates are
+	// valid, for clocks that are behind.
+	backdate      = 5 * time.Minute
+	serialBits    = 128
+	minRsaKeyBits = 2048
+)
+
+// authority signs the certificate signing requests of the agents.
+type authority struct {
+	certificate    *x509.Certificate
+	certificatePem string
+	key            crypto.Signer
+}
+
+// loadAuthority reads the certificate and key of the authority from PEM
+// files.
+func loadAuthority(certificateFile string, keyFile string) (*authority, error) {
+	certificatePem, err := os.ReadFile(certificateFile)
+	if err != nil {
+		return nil, fmt.Errorf("could not read the ca certificate: %w", err)
+	}
+	keyPem, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("could not read the ca key: %w", err)
+	}
+	return newAuthority(certificatePem, keyPem)
+}
+
+func newAuthority(certificatePem []byte, keyPem []byte) (*authority, error) {
+	pair, err := tls.X509KeyPair(certificatePem, keyPem)
+	if err != nil {
+		return nil, fmt.Errorf("could not load the ca: %w", err)
+	}
+	certificate, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return nil, fmt.Errorf("could not parse the ca certificate: %w", err)
+	}
+	if !certificate.IsCA || certificate.KeyUsage&x509.KeyUsageCertSign == 0 {
+		return nil, errors.New("the ca certificate can not sign certificates")
+	}
+	key, ok := pair.PrivateKey.(crypto.Signer)
+	if !ok {
+		return nil, errors.New("the ca key can not sign certificates")
+	}
+
+	return &authority{
+		certificate:    certificate,
+		certificatePem: string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certificate.Raw})),
+		key:            key,
+	}, nil
+}
+
+// sign signs the certificate signing request as a client certificate of the
+// identity of the uri, valid for the ttl or until the authority expires. The
+// subject and names of the request are replaced, only its key is used.
+func (a *authority) sign(csrPem string, uri *url.URL, commonName string, organizationalUnit string, ttl time.Duration, now time.Time) (certificatemodels.Certificate, error) {
+	request, err := parseCsr(csrPem)
+	if err != nil {
+		return certificatemodels.Certificate{}, err
+	}
+
+	serialNumber, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), serialBits))
+	if err != nil {
+		return certificatemodels.Certificate{}, fmt.Errorf("could not generate serial number: %w", err)
+	}
+
+	notBefore := now.Add(-backdate)
+	notAfter := now.Add(ttl)
+	if notAfter.After(a.certificate.NotAfter) {
+		notAfter = a.certificate.NotAfter
+	}
+	template := &x509.Certificate{
+		SerialNumber: serialNumber,
+		Subject: pkix.Name{
+			CommonName:         commonName,
+			OrganizationalUnit: []string{organizationalUnit},
+		},
+		URIs:                  []*url.URL{uri},
+		NotBefore:             notBefore,
+		NotAfter:              notAfter,
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+	}
+
+	signed, err := x509.CreateCertificate(rand.Reader, template, a.certificate, request.PublicKey, a.key)
+	if err != nil {
+		return certificatemodels.Certificate{}, fmt.Errorf("could not sign certificate: %w", err)
+	}
+
+	return certificatemodels.Certificate{
+		Certificate:   string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: signed})),
+		CaCertificate: a.certificatePem,
+		SerialNumber:  serialNumber.Text(16),
+		NotBefore:     notBefore,
+		NotAfter:      notAfter,
+		RenewAfter:    mtlsauth.RenewAfter(notBefore, notAfter),
+	}, nil
+}
+
+// parseCsr parses the PEM encoded certificate signing request and checks its
+// signature and key.
+func parseCsr(csrPem string) (*x509.CertificateRequest, error) {
+	block, _ := pem.Decode([]byte(csrPem))
+	if block == nil || block.Type != "CERTIFICATE REQUEST" {
+		return nil, fmt.Errorf("%w: the csr must be a PEM encoded CERTIFICATE REQUEST", ErrInvalidCsr)
+	}
+	request, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidCsr, err)
+	}
+	if err := request.CheckSignature(); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidCsr, err)
+	}
+
+	switch key := request.PublicKey.(type) {
+	case *ecdsa.PublicKey:
+		if key.Curve != elliptic.P256() && key.Curve != elliptic.P384() {
+			return nil, fmt.Errorf("%w: ecdsa keys must use P-256 or P-384", ErrInvalidCsr)
+		}
+	case *rsa.PublicKey:
+		if key.N.BitLen() < minRsaKeyBits {
+			return nil, fmt.Errorf("%w: rsa keys must be at least %d bits", ErrInvalidCsr, minRsaKeyBits)
+		}
+	case ed25519.PublicKey:
+	default:
+		return nil, fmt.Errorf("%w: unsupported key type", ErrInvalidCsr)
+	}
+	return request, nil
+}
@@ -0,0 +1,104 @@
+package certificatesservice
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/NorskHelsenett/ror-api/internal/mtlsauth"
+
+	identitymodels "github.com/NorskHelsenett/ror/pkg/models/identity"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestAuthority(t *testing.T, notAfter time.Time) *authority {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "ror test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              notAfter,
+		KeyUsage:              x509.KeyUsageCertSign,
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	signed, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDer, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+
+	ca, err := newAuthority(
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: signed}),
+		pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDer}),
+	)
+	require.NoError(t, err)
+	return ca
+}
+
+func newTestCsr(t *testing.T, key any) string {
+	request, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject: pkix.Name{CommonName: "other-cluster", OrganizationalUnit: []string{"service"}},
+	}, key)
+	require.NoError(t, err)
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: request}))
+}
+
+func TestSign(t *testing.T) {
+	ca := newTestAuthority(t, time.Now().Add(365*24*time.Hour))
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	now := time.Now()
+	issued, err := ca.sign(newTestCsr(t, key), mtlsauth.ClusterUri("cluster-a", "uid-a"), "cluster-a", mtlsauth.KindCluster, 24*time.Hour, now)
+	require.NoError(t, err)
+	assert.Equal(t, ca.certificatePem, issued.CaCertificate)
+	assert.True(t, issued.RenewAfter.After(now) && issued.RenewAfter.Before(issued.NotAfter))
+
+	block, _ := pem.Decode([]byte(issued.Certificate))
+	require.NotNil(t, block)
+	certificate, err := x509.ParseCertificate(block.Bytes)
+	require.NoError(t, err)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.certificate)
+	_, err = certificate.Verify(x509.VerifyOptions{Roots: roots, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}})
+	require.NoError(t, err)
+
+	identity, err := mtlsauth.IdentityFromCertificate(certificate)
+	require.NoError(t, err)
+	assert.Equal(t, identitymodels.IdentityTypeCluster, identity.Type)
+	assert.Equal(t, "cluster-a", identity.ClusterIdentity.Id)
+	assert.Equal(t, "uid-a", identity.ClusterIdentity.Uid)
+}
+
+func TestSignCappedByAuthority(t *testing.T) {
+	notAfter := time.Now().Add(time.Hour).Truncate(time.Second)
+	ca := newTestAuthority(t, notAfter)
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	issued, err := ca.sign(newTestCsr(t, key), mtlsauth.ClusterUri("cluster-a", ""), "cluster-a", mtlsauth.KindCluster, 24*time.Hour, time.Now())
+	require.NoError(t, err)
+	assert.True(t, issued.NotAfter.Equal(notAfter))
+}
+
+func TestParseCsr(t *testing.T) {
+	weak, err := rsa.GenerateKey(rand.Reader, 1024)
+	require.NoError(t, err)
+
+	_, err = parseCsr(newTestCsr(t, weak))
+	assert.ErrorIs(t, err, ErrInvalidCsr)
+	_, err = parseCsr("not a csr")
+	assert.ErrorIs(t, err, ErrInvalidCsr)
+}
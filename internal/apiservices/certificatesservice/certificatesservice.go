@@ -0,0 +1,142 @@
+// Package certificatesservice is the certificate authority of ror-api. It
+// signs the client certificates the agents authenticate with over mutual
+// tls, when they register and when they renew them before they expire. The
+// certificate and key of the authority are read from CA_CERT_FILE and
+// CA_KEY_FILE, no certificates are issued when they are not set.
+package certificatesservice
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"time"
+
+	"github.com/NorskHelsenett/ror-api/internal/databases/mongodb/repositories/clustercertificates"
+	"github.com/NorskHelsenett/ror-api/internal/models/certificatemodels"
+	"github.com/NorskHelsenett/ror-api/internal/mtlsauth"
+
+	"github.com/NorskHelsenett/ror/pkg/config/rorconfig"
+	"github.com/NorskHelsenett/ror/pkg/context/rorcontext"
+	"github.com/NorskHelsenett/ror/pkg/rlog"
+)
+
+const defaultCertificateTtl = 7 * 24 * time.Hour
+
+var (
+	ErrNotConfigured = errors.New("the certificate authority is not configured")
+	ErrInvalidCsr    = errors.New("invalid certificate signing request")
+	ErrExists        = clustercertificates.ErrExists
+	ErrNotCluster    = errors.New("the identity is not a cluster")
+
+	ca *authority
+)
+
+// Init loads the certificate authority if CA_CERT_FILE and CA_KEY_FILE are
+// set.
+func Init() error {
+	certificateFile := rorconfig.GetString("CA_CERT_FILE")
+	keyFile := rorconfig.GetString("CA_KEY_FILE")
+	if certificateFile == "" || keyFile == "" {
+		rlog.Info("certificate authority not configured, agent certificates are not issued")
+		return nil
+	}
+
+	loaded, err := loadAuthority(certificateFile, keyFile)
+	if err != nil {
+		return err
+	}
+	ca = loaded
+	rlog.Info("certificate authority loaded", rlog.String("subject", ca.certificate.Subject.String()), rlog.Any("notAfter", ca.certificate.NotAfter))
+	return nil
+}
+
+// Enabled reports whether the certificate authority is configured.
+func Enabled() bool {
+	return ca != nil
+}
+
+// Authority returns the certificate of the certificate authority, or nil if
+// it is not configured.
+func Authority() *x509.Certificate {
+	if ca == nil {
+		return nil
+	}
+	return ca.certificate
+}
+
+// GetCaCertificate returns the PEM encoded certificate of the certificate
+// authority.
+func GetCaCertificate() (string, error) {
+	if ca == nil {
+		return "", ErrNotConfigured
+	}
+	return ca.certificatePem, nil
+}
+
+// IssueForCluster signs the certificate signing request of the agent of a
+// new cluster when it registers, or returns ErrExists if a certificate is
+// already issued to the cluster, which only the cluster can renew. The
+// certificate is recorded with the context, and must only be handed out when
+// the transaction storing the other credentials of the cluster commits.
+func IssueForCluster(ctx context.Context, clusterId string, clusterUid string, csr string) (certificatemodels.Certificate, error) {
+	certificate, err := signForCluster(clusterId, clusterUid, csr)
+	if err != nil {
+		return certificate, err
+	}
+
+	issued := clusterCertificate(clusterId, clusterUid, certificate)
+	if err := clustercertificates.Create(ctx, &issued); err != nil {
+		return certificatemodels.Certificate{}, err
+	}
+	return certificate, nil
+}
+
+// Renew signs the certificate signing request of the cluster of the identity
+// of the context, replacing the certificate issued to it before.
+func Renew(ctx context.Context, csr string) (certificatemodels.Certificate, error) {
+	identity := rorcontext.MustGetIdentityFromRorContext(ctx)
+	if !identity.IsCluster() || identity.ClusterIdentity == nil {
+		return certificatemodels.Certificate{}, ErrNotCluster
+	}
+
+	clusterId := identity.ClusterIdentity.Id
+	clusterUid := identity.ClusterIdentity.Uid
+	certificate, err := signForCluster(clusterId, clusterUid, csr)
+	if err != nil {
+		return certificate, err
+	}
+
+	issued := clusterCertificate(clusterId, clusterUid, certificate)
+	if err := clustercertificates.Upsert(ctx, &issued); err != nil {
+		return certificatemodels.Certificate{}, err
+	}
+	return certificate, nil
+}
+
+func signForCluster(clusterId string, clusterUid string, csr string) (certificatemodels.Certificate, error) {
+	if ca == nil {
+		return certificatemodels.Certificate{}, ErrNotConfigured
+	}
+	return ca.sign(csr, mtlsauth.ClusterUri(clusterId, clusterUid), clusterId, mtlsauth.KindCluster, certificateTtl(), time.Now())
+}
+
+func clusterCertificate(clusterId string, clusterUid string, certificate certificatemodels.Certificate) certificatemodels.ClusterCertificate {
+	now := time.Now()
+	return certificatemodels.ClusterCertificate{
+		ClusterId:    clusterId,
+		Uid:          clusterUid,
+		SerialNumber: certificate.SerialNumber,
+		NotAfter:     certificate.NotAfter,
+		IssuedAt:     now,
+		UpdatedAt:    now,
+	}
+}
+
+func certificateTtl() time.Duration {
+	ttl, err := time.ParseDuration(rorconfig.GetString("CA_CERT_TTL"))
+	if err != nil || ttl <= 0 {
+		rlog.Warn("invalid CA_CERT_TTL, using the default", rlog.String("default", defaultCertificateTtl.String()))
+		return defaultCertificateTtl
+	}
+	return ttl
+}
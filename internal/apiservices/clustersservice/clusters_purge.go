@@ -6,13 +6,20 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/NorskHelsenett/ror-api/internal/apiservices/resourcesv2service"
+	"github.com/NorskHelsenett/ror-api/internal/databases/mongodb/mongotransaction"
+	mongoclusters "github.com/NorskHelsenett/ror-api/internal/databases/mongodb/repositories/clusters"
+
 	"github.com/NorskHelsenett/ror/pkg/clients/mongodb"
+	"github.com/NorskHelsenett/ror/pkg/config/rorconfig"
+	"github.com/NorskHelsenett/ror/pkg/context/rorcontext"
 	aclmodels "github.com/NorskHelsenett/ror/pkg/models/aclmodels"
 	"github.com/NorskHelsenett/ror/pkg/rlog"
 	"github.com/NorskHelsenett/ror/pkg/telemetry/rortracer"
 
 	"go.mongodb.org/mongo-driver/v2/bson"
 	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
 )
 
 const (
@@ -24,6 +31,12 @@ const (
 	// clusterInactivityThreshold is how long a cluster must have been silent
 	// (no v1 heartbeat or v2 agent report) before it may be purged.
 	clusterInactivityThreshold = 10 * time.Minute
+
+	defaultPurgeGracePeriod    = 7 * 24 * time.Hour
+	defaultPurgeReaperInterval = 10 * time.Minute
+	// purgeReapLease is how long a reaper holds its claim on a cluster before
+	// another replica may purge it.
+	purgeReapLease = 30 * time.Minute
 )
 
 // ErrClusterNotFound is returned when no cluster document matches the given uid.
@@ -33,6 +46,27 @@ var ErrClusterNotFound = errors.New("cluster not found")
 // inactivity threshold and is therefore considered still active.
 var ErrClusterRecentlyActive = errors.New("cluster has reported recently")
 
+// ErrClusterPendingPurge is returned when purging a cluster that is already
+// pending purge.
+var ErrClusterPendingPurge = errors.New("cluster is pending purge")
+
+// ErrClusterNotPendingPurge is returned when restoring a cluster that is not
+// pending purge, or that is being purged.
+var ErrClusterNotPendingPurge = errors.New("cluster is not pending purge")
+
+// PendingPurge is a cluster marked for purge. The cluster and its resourcesv2
+// documents are hidden from reads until it is restored, or purged by the
+// reaper after PurgeAfter.
+type PendingPurge struct {
+	Uid         string    `json:"uid" bson:"uid"`
+	ClusterId   string    `json:"clusterId" bson:"clusterid"`
+	RequestedBy string    `json:"requestedBy" bson:"requestedby"`
+	RequestedAt time.Time `json:"requestedAt" bson:"requestedat"`
+	PurgeAfter  time.Time `json:"purgeAfter" bson:"purgeafter"`
+	// ResourcesV2 is the number of resourcesv2 documents marked or restored.
+	ResourcesV2 int64 `json:"resourcesV2" bson:"-"`
+}
+
 // PurgeResult reports how many documents were removed from each collection when
 // purging a cluster.
 type PurgeResult struct {
@@ -41,50 +75,53 @@ type PurgeResult struct {
 	Clusters    int64  `json:"clusters"`
 	Resources   int64  `json:"resources"`
 	ResourcesV2 int64  `json:"resourcesV2"`
-	Acl         int64  `json:"acl"`
+	// ResourcesV2History and ResourcesV2Watch are the revisions and watch
+	// events of the cluster's resourcesv2 documents.
+	ResourcesV2History int64 `json:"resourcesV2History"`
+	ResourcesV2Watch   int64 `json:"resourcesV2Watch"`
+	Acl                int64 `json:"acl"`
 }
 
-// PurgeClusterByUid removes a cluster and all of its related data, identified by
-// the cluster uid. It deletes:
-//   - the cluster document (clusters, by uid)
-//   - all v1 resources owned by the cluster (resources, by owner.subject = clusterid)
-//   - the KubernetesCluster doc and all child resources (resourcesv2, by uid or rormeta.ownerref.subject = uid)
-//   - all acl entries for the cluster (acl, by scope = KubernetesCluster, subject = uid)
-//
-// The clusterid required for the v1 resources collection is resolved from the
-// cluster document. ErrClusterNotFound is returned if no cluster matches uid.
+// PurgeClusterByUid marks a cluster and its resourcesv2 documents (by uid or
+// rormeta.ownerref.subject = uid) as pending purge, identified by the cluster
+// uid. They are hidden from reads, and purged by the reaper when
+// CLUSTER_PURGE_GRACE_PERIOD has passed unless the cluster is restored with
+// RestoreClusterByUid. ErrClusterNotFound is returned if no cluster matches
+// uid, ErrClusterPendingPurge if it is already pending purge.
 //
 // force skips the recent-activity safety check. Intended for controlled
 // decommissioning where the caller has already verified the cluster's agents
 // are stopped (e.g. pre-cluster-delete tooling); external reporters may keep
 // refreshing lastobserved long after the cluster itself is being torn down.
-func PurgeClusterByUid(ctx context.Context, uid string, force bool) (PurgeResult, error) {
+func PurgeClusterByUid(ctx context.Context, uid string, force bool) (PendingPurge, error) {
 	ctx, span := rortracer.StartSpan(ctx, "clustersservice.PurgeClusterByUid")
 	defer span.End()
 
-	result := PurgeResult{Uid: uid}
+	pending := PendingPurge{Uid: uid}
 
 	if uid == "" {
-		return result, errors.New("uid is required")
+		return pending, errors.New("uid is required")
 	}
 
 	db := mongodb.GetMongoDb()
 
-	// Resolve the cluster document to obtain the clusterid. The v1 resources
-	// collection keys ownership by clusterid, not uid.
 	var clusterDoc struct {
-		ClusterId    string    `bson:"clusterid"`
-		LastObserved time.Time `bson:"lastobserved"`
+		ClusterId    string        `bson:"clusterid"`
+		LastObserved time.Time     `bson:"lastobserved"`
+		PendingPurge *PendingPurge `bson:"pendingpurge"`
 	}
 	err := db.Collection(purgeClustersCollection).FindOne(ctx, bson.M{"uid": uid}).Decode(&clusterDoc)
 	if err != nil {
 		if errors.Is(err, mongo.ErrNoDocuments) {
-			return result, ErrClusterNotFound
+			return pending, ErrClusterNotFound
 		}
 		rortracer.SpanError(span, err, "failed to look up cluster by uid")
-		return result, fmt.Errorf("could not look up cluster by uid: %w", err)
+		return pending, fmt.Errorf("could not look up cluster by uid: %w", err)
+	}
+	if clusterDoc.PendingPurge != nil {
+		return *clusterDoc.PendingPurge, ErrClusterPendingPurge
 	}
-	result.ClusterId = clusterDoc.ClusterId
+	pending.ClusterId = clusterDoc.ClusterId
 
 	// Safety check: refuse to purge a cluster that has reported recently. Both
 	// the v1 cluster heartbeat (clusters.lastobserved) and the v2 agent report
@@ -93,7 +130,7 @@ func PurgeClusterByUid(ctx context.Context, uid string, force bool) (PurgeResult
 	lastSeenV2, err := getV2ClusterLastSeen(ctx, db, uid)
 	if err != nil {
 		rortracer.SpanError(span, err, "failed to look up v2 cluster last seen")
-		return result, err
+		return pending, err
 	}
 	lastReport := clusterDoc.LastObserved
 	if lastSeenV2.After(lastReport) {
@@ -101,7 +138,7 @@ func PurgeClusterByUid(ctx context.Context, uid string, force bool) (PurgeResult
 	}
 	if !lastReport.IsZero() && time.Since(lastReport) < clusterInactivityThreshold {
 		if !force {
-			return result, fmt.Errorf("%w: last reported %s ago (v1: %s, v2: %s)",
+			return pending, fmt.Errorf("%w: last reported %s ago (v1: %s, v2: %s)",
 				ErrClusterRecentlyActive,
 				time.Since(lastReport).Round(time.Second),
 				formatReportTime(clusterDoc.LastObserved),
@@ -116,6 +153,263 @@ func PurgeClusterByUid(ctx context.Context, uid string, force bool) (PurgeResult
 		)
 	}
 
+	pending.RequestedBy = rorcontext.MustGetIdentityFromRorContext(ctx).GetId()
+	pending.RequestedAt = time.Now()
+	pending.PurgeAfter = pending.RequestedAt.Add(purgeGracePeriod())
+
+	// The cluster document, its resourcesv2 documents and their watch events
+	// are marked in one transaction, so a failed purge leaves none marked and
+	// may be retried. Marking the cluster document first makes a concurrent
+	// purge of the same cluster match nothing.
+	err = mongotransaction.Run(ctx, func(ctx context.Context) error {
+		clusterRes, err := db.Collection(purgeClustersCollection).UpdateMany(ctx,
+			bson.M{"uid": uid, mongoclusters.PendingPurgeField: bson.M{"$exists": false}},
+			bson.M{"$set": bson.M{mongoclusters.PendingPurgeField: pending}},
+		)
+		if err != nil {
+			return fmt.Errorf("could not mark cluster for purge: %w", err)
+		}
+		if clusterRes.ModifiedCount == 0 {
+			return ErrClusterPendingPurge
+		}
+
+		resV2, err := db.Collection(purgeResourcesV2Collection).UpdateMany(ctx,
+			clusterResourcesV2Filter(uid),
+			bson.M{"$set": bson.M{resourcesv2service.PendingPurgeField: pending.PurgeAfter}},
+		)
+		if err != nil {
+			return fmt.Errorf("could not mark resourcesv2 for purge: %w", err)
+		}
+		pending.ResourcesV2 = resV2.ModifiedCount
+
+		// The watch events recorded before the mark are hidden from
+		// watchers like the resources are.
+		_, err = db.Collection(resourcesv2service.WATCHCOLLECTION).UpdateMany(ctx,
+			clusterResourcesV2Filter(uid),
+			bson.M{"$set": bson.M{resourcesv2service.PendingPurgeField: pending.PurgeAfter}},
+		)
+		if err != nil {
+			return fmt.Errorf("could not mark resourcesv2 watch events for purge: %w", err)
+		}
+		return nil
+	})
+	if errors.Is(err, ErrClusterPendingPurge) {
+		return pending, err
+	}
+	if err != nil {
+		rortracer.SpanError(span, err, "failed to mark cluster for purge")
+		return pending, err
+	}
+
+	rlog.Infoc(ctx, "marked cluster for purge",
+		rlog.String("uid", uid),
+		rlog.String("clusterid", pending.ClusterId),
+		rlog.String("requested by", pending.RequestedBy),
+		rlog.String("purge after", pending.PurgeAfter.UTC().Format(time.RFC3339)),
+		rlog.Int64("resourcesv2", pending.ResourcesV2),
+	)
+
+	rortracer.SpanOk(span)
+	return pending, nil
+}
+
+// RestoreClusterByUid removes the pending purge mark from a cluster and its
+// resourcesv2 documents, their history and watch events, so they are read
+// again. ErrClusterNotFound is
+// returned if no cluster matches uid, ErrClusterNotPendingPurge if it is not
+// pending purge or the reaper has started purging it.
+func RestoreClusterByUid(ctx context.Context, uid string) (PendingPurge, error) {
+	ctx, span := rortracer.StartSpan(ctx, "clustersservice.RestoreClusterByUid")
+	defer span.End()
+
+	db := mongodb.GetMongoDb()
+
+	// The marks are removed in one transaction, so a failed restore leaves
+	// the cluster pending purge and may be retried.
+	var restored PendingPurge
+	err := mongotransaction.Run(ctx, func(ctx context.Context) error {
+		var clusterDoc struct {
+			PendingPurge *PendingPurge `bson:"pendingpurge"`
+		}
+		err := db.Collection(purgeClustersCollection).FindOneAndUpdate(ctx,
+			bson.M{
+				"uid":                           uid,
+				mongoclusters.PendingPurgeField: bson.M{"$exists": true},
+				mongoclusters.PendingPurgeField + ".reapingat": bson.M{"$exists": false},
+			},
+			bson.M{"$unset": bson.M{mongoclusters.PendingPurgeField: ""}},
+		).Decode(&clusterDoc)
+		if err != nil {
+			return err
+		}
+		restored = *clusterDoc.PendingPurge
+
+		resV2, err := db.Collection(purgeResourcesV2Collection).UpdateMany(ctx,
+			clusterResourcesV2Filter(uid),
+			bson.M{"$unset": bson.M{resourcesv2service.PendingPurgeField: ""}},
+		)
+		if err != nil {
+			return fmt.Errorf("could not restore resourcesv2: %w", err)
+		}
+		restored.ResourcesV2 = resV2.ModifiedCount
+
+		// Revisions recorded while the cluster was pending purge carry the
+		// mark of the resource they were copied from.
+		_, err = db.Collection(resourcesv2service.HISTORYCOLLECTION).UpdateMany(ctx,
+			clusterResourcesV2Filter(uid),
+			bson.M{"$unset": bson.M{resourcesv2service.PendingPurgeField: ""}},
+		)
+		if err != nil {
+			return fmt.Errorf("could not restore resourcesv2 history: %w", err)
+		}
+
+		_, err = db.Collection(resourcesv2service.WATCHCOLLECTION).UpdateMany(ctx,
+			clusterResourcesV2Filter(uid),
+			bson.M{"$unset": bson.M{resourcesv2service.PendingPurgeField: ""}},
+		)
+		if err != nil {
+			return fmt.Errorf("could not restore resourcesv2 watch events: %w", err)
+		}
+		return nil
+	})
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		count, countErr := db.Collection(purgeClustersCollection).CountDocuments(ctx, bson.M{"uid": uid})
+		if countErr != nil {
+			return PendingPurge{Uid: uid}, fmt.Errorf("could not look up cluster by uid: %w", countErr)
+		}
+		if count == 0 {
+			return PendingPurge{Uid: uid}, ErrClusterNotFound
+		}
+		return PendingPurge{Uid: uid}, ErrClusterNotPendingPurge
+	}
+	if err != nil {
+		rortracer.SpanError(span, err, "failed to restore cluster")
+		return PendingPurge{Uid: uid}, fmt.Errorf("could not restore cluster: %w", err)
+	}
+
+	rlog.Infoc(ctx, "restored cluster pending purge",
+		rlog.String("uid", uid),
+		rlog.String("clusterid", restored.ClusterId),
+		rlog.String("restored by", rorcontext.MustGetIdentityFromRorContext(ctx).GetId()),
+		rlog.Int64("resourcesv2", restored.ResourcesV2),
+	)
+
+	rortracer.SpanOk(span)
+	return restored, nil
+}
+
+// GetPendingPurges returns the clusters pending purge, the first to be purged
+// first.
+func GetPendingPurges(ctx context.Context) ([]PendingPurge, error) {
+	db := mongodb.GetMongoDb()
+	cursor, err := db.Collection(purgeClustersCollection).Find(ctx,
+		bson.M{mongoclusters.PendingPurgeField: bson.M{"$exists": true}},
+		options.Find().
+			SetProjection(bson.M{mongoclusters.PendingPurgeField: 1}).
+			SetSort(bson.M{mongoclusters.PendingPurgeField + ".purgeafter": 1}),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("could not get clusters pending purge: %w", err)
+	}
+	var docs []struct {
+		PendingPurge PendingPurge `bson:"pendingpurge"`
+	}
+	if err := cursor.All(ctx, &docs); err != nil {
+		return nil, fmt.Errorf("could not decode clusters pending purge: %w", err)
+	}
+	pending := make([]PendingPurge, 0, len(docs))
+	for _, doc := range docs {
+		pending = append(pending, doc.PendingPurge)
+	}
+	return pending, nil
+}
+
+// StartPurgeReaper purges the clusters whose grace period has passed every
+// CLUSTER_PURGE_REAPER_INTERVAL until the context is done. Every replica may
+// run the reaper, a cluster is claimed before it is purged.
+func StartPurgeReaper(ctx context.Context) {
+	interval, err := time.ParseDuration(rorconfig.GetString("CLUSTER_PURGE_REAPER_INTERVAL"))
+	if err != nil || interval <= 0 {
+		rlog.Warn("invalid CLUSTER_PURGE_REAPER_INTERVAL, using the default", rlog.String("default", defaultPurgeReaperInterval.String()))
+		interval = defaultPurgeReaperInterval
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := ReapPendingPurges(ctx); err != nil {
+					rlog.Error("could not purge clusters pending purge", err)
+				}
+			}
+		}
+	}()
+}
+
+// ReapPendingPurges purges the clusters whose grace period has passed. A
+// cluster is claimed by setting pendingpurge.reapingat, a claim older than
+// purgeReapLease is taken over as the replica holding it has stopped.
+func ReapPendingPurges(ctx context.Context) error {
+	db := mongodb.GetMongoDb()
+	var errs []error
+	for {
+		now := time.Now()
+		var claimed struct {
+			PendingPurge PendingPurge `bson:"pendingpurge"`
+		}
+		err := db.Collection(purgeClustersCollection).FindOneAndUpdate(ctx,
+			bson.M{
+				mongoclusters.PendingPurgeField + ".purgeafter": bson.M{"$lte": now},
+				"$or": bson.A{
+					bson.M{mongoclusters.PendingPurgeField + ".reapingat": bson.M{"$exists": false}},
+					bson.M{mongoclusters.PendingPurgeField + ".reapingat": bson.M{"$lt": now.Add(-purgeReapLease)}},
+				},
+			},
+			bson.M{"$set": bson.M{mongoclusters.PendingPurgeField + ".reapingat": now}},
+		).Decode(&claimed)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return errors.Join(errs...)
+		}
+		if err != nil {
+			return errors.Join(append(errs, fmt.Errorf("could not claim cluster pending purge: %w", err))...)
+		}
+
+		pending := claimed.PendingPurge
+		result, err := purgeCluster(ctx, db, pending.Uid, pending.ClusterId)
+		if err != nil {
+			// The claim expires, the purge is retried after the lease.
+			errs = append(errs, fmt.Errorf("could not purge cluster %s: %w", pending.Uid, err))
+			continue
+		}
+		rlog.Infoc(ctx, "purged cluster",
+			rlog.String("uid", result.Uid),
+			rlog.String("clusterid", result.ClusterId),
+			rlog.String("requested by", pending.RequestedBy),
+			rlog.Int64("clusters", result.Clusters),
+			rlog.Int64("resources", result.Resources),
+			rlog.Int64("resourcesv2", result.ResourcesV2),
+			rlog.Int64("resourcesv2 history", result.ResourcesV2History),
+			rlog.Int64("resourcesv2 watch events", result.ResourcesV2Watch),
+			rlog.Int64("acl", result.Acl),
+		)
+	}
+}
+
+// purgeCluster removes a cluster and all of its related data. It deletes:
+//   - all v1 resources owned by the cluster (resources, by owner.subject = clusterid)
+//   - the KubernetesCluster doc and all child resources (resourcesv2, by uid or rormeta.ownerref.subject = uid)
+//   - their revisions (resourcesv2history) and watch events (resourcesv2watch, kept as skipped versions), by the same owner
+//   - all acl entries for the cluster (acl, by scope = KubernetesCluster, subject = uid)
+//   - the cluster document (clusters, by uid), last so a failed purge is retried
+func purgeCluster(ctx context.Context, db *mongo.Database, uid string, clusterId string) (PurgeResult, error) {
+	ctx, span := rortracer.StartSpan(ctx, "clustersservice.purgeCluster")
+	defer span.End()
+
+	result := PurgeResult{Uid: uid, ClusterId: clusterId}
 	kind := string(aclmodels.Acl2ScopeCluster.ToKind())
 
 	// Delete v1 resources owned by the cluster (keyed by clusterid).
@@ -129,18 +423,31 @@ func PurgeClusterByUid(ctx context.Context, uid string, force bool) (PurgeResult
 		result.Resources = res.DeletedCount
 	}
 
-	// Delete resourcesv2: the cluster's own doc and all child resources.
-	resV2Filter := bson.M{"$or": bson.A{
-		bson.M{"uid": uid},
-		bson.M{"rormeta.ownerref.subject": uid},
-	}}
-	resV2, delErr := db.Collection(purgeResourcesV2Collection).DeleteMany(ctx, resV2Filter)
+	// Delete resourcesv2: the cluster's own doc and all child resources,
+	// including those written again after the cluster was marked.
+	resV2, delErr := db.Collection(purgeResourcesV2Collection).DeleteMany(ctx, clusterResourcesV2Filter(uid))
 	if delErr != nil {
 		rortracer.SpanError(span, delErr, "failed to delete resourcesv2")
 		return result, fmt.Errorf("could not delete resourcesv2: %w", delErr)
 	}
 	result.ResourcesV2 = resV2.DeletedCount
 
+	// Delete the revisions and watch events of the resourcesv2 documents,
+	// matched by the same owner.
+	history, delErr := db.Collection(resourcesv2service.HISTORYCOLLECTION).DeleteMany(ctx, clusterResourcesV2Filter(uid))
+	if delErr != nil {
+		rortracer.SpanError(span, delErr, "failed to delete resourcesv2 history")
+		return result, fmt.Errorf("could not delete resourcesv2 history: %w", delErr)
+	}
+	result.ResourcesV2History = history.DeletedCount
+
+	watch, delErr := resourcesv2service.DeleteWatchEvents(ctx, clusterResourcesV2Filter(uid))
+	if delErr != nil {
+		rortracer.SpanError(span, delErr, "failed to delete resourcesv2 watch events")
+		return result, delErr
+	}
+	result.ResourcesV2Watch = watch
+
 	// Delete acl entries for the cluster (by uid).
 	aclFilter := bson.M{"scope": kind, "subject": uid}
 	aclRes, delErr := db.Collection(purgeAclCollection).DeleteMany(ctx, aclFilter)
@@ -158,19 +465,30 @@ func PurgeClusterByUid(ctx context.Context, uid string, force bool) (PurgeResult
 	}
 	result.Clusters = clusterRes.DeletedCount
 
-	rlog.Infoc(ctx, "purged cluster",
-		rlog.String("uid", uid),
-		rlog.String("clusterid", result.ClusterId),
-		rlog.Int64("clusters", result.Clusters),
-		rlog.Int64("resources", result.Resources),
-		rlog.Int64("resourcesv2", result.ResourcesV2),
-		rlog.Int64("acl", result.Acl),
-	)
-
 	rortracer.SpanOk(span)
 	return result, nil
 }
 
+// clusterResourcesV2Filter matches the KubernetesCluster doc of the cluster
+// and all of its child resources.
+func clusterResourcesV2Filter(uid string) bson.M {
+	return bson.M{"$or": bson.A{
+		bson.M{"uid": uid},
+		bson.M{"rormeta.ownerref.subject": uid},
+	}}
+}
+
+// purgeGracePeriod returns CLUSTER_PURGE_GRACE_PERIOD, how long a cluster is
+// pending purge before it is purged.
+func purgeGracePeriod() time.Duration {
+	grace, err := time.ParseDuration(rorconfig.GetString("CLUSTER_PURGE_GRACE_PERIOD"))
+	if err != nil || grace < 0 {
+		rlog.Warn("invalid CLUSTER_PURGE_GRACE_PERIOD, using the default", rlog.String("default", defaultPurgeGracePeriod.String()))
+		return defaultPurgeGracePeriod
+	}
+	return grace
+}
+
 // getV2ClusterLastSeen returns the agent last-seen time from the resourcesv2
 // KubernetesCluster document for the given uid. A zero time is returned if the
 // document or the field is missing.
@@ -14,8 +14,10 @@ import (
 	"github.com/NorskHelsenett/ror-api/internal/services/clusterservice"
 	"github.com/NorskHelsenett/ror-api/internal/services/kubeconfigservice"
 	"github.com/NorskHelsenett/ror-api/internal/webserver/sse"
+	"github.com/NorskHelsenett/ror-api/pkg/services/sseservice"
 
 	"github.com/NorskHelsenett/ror/pkg/helpers/idhelper"
+	"github.com/NorskHelsenett/ror/pkg/models/aclmodels"
 	"github.com/NorskHelsenett/ror/pkg/telemetry/rortracer"
 
 	"github.com/NorskHelsenett/ror/pkg/context/rorcontext"
@@ -146,6 +148,25 @@ func Create(ctx context.Context, input *apicontracts.Cluster) (string, error) {
 	}
 
 	sse.Server.BroadcastMessage(ssemodels.SseMessage{Event: ssemodels.SseType_Cluster_Created, Data: event})
+
+	// Deliver the cluster to v2 event clients and webhooks, on the topic of
+	// its uid.
+	clusterUid := input.Uid
+	if clusterUid == "" && aclmodels.ClusterIdToUidResolver != nil {
+		clusterUid = aclmodels.ClusterIdToUidResolver(clusterId)
+	}
+	clusterEvent, err := sseservice.NewClusterEvent(sseservice.SseEventClusterCreated, sseservice.ClusterEventData{
+		ClusterUid:    clusterUid,
+		ClusterId:     clusterId,
+		ClusterName:   input.ClusterName,
+		WorkspaceName: input.Workspace.Name,
+	})
+	if err == nil {
+		err = sseservice.PublishEvent(ctx, apiconnections.RabbitMQConnection, clusterEvent)
+	}
+	if err != nil {
+		rlog.Errorc(ctx, "could not publish cluster created event", err, rlog.String("clusterId", clusterId))
+	}
 	return clusterId, nil
 }
 
@@ -335,12 +356,6 @@ func GetKubeconfig(ctx context.Context, clusterId string, credentials apicontrac
 	ctx, span := rortracer.StartSpan(ctx, "clustersservice.GetKubeconfig")
 	defer span.End()
 
-	if credentials.Username == "" || credentials.Password == "" {
-		err := errors.New("username and password must be provided")
-		rlog.Errorc(ctx, "could not get kubeconfig", err, rlog.String("clusterId", clusterId))
-		return "", err
-	}
-
 	if clusterId == "" {
 		err := errors.New("clusterId must be provided")
 		rlog.Errorc(ctx, "could not get kubeconfig", err, rlog.String("clusterId", clusterId))
@@ -423,3 +438,15 @@ func PopulateDatacenter(ctx context.Context, input *apicontracts.Cluster) {
 	}
 
 }
+
+// GetProjectUsage returns the number of clusters in the project and the vCPU
+// and memory bytes of their nodes.
+func GetProjectUsage(ctx context.Context, projectId string) (mongoclusters.ClusterUsage, error) {
+	return mongoclusters.GetUsage(ctx, "metadata.projectid", projectId)
+}
+
+// GetWorkspaceUsage returns the number of clusters in the workspace and the
+// vCPU and memory bytes of their nodes.
+func GetWorkspaceUsage(ctx context.Context, workspaceId string) (mongoclusters.ClusterUsage, error) {
+	return mongoclusters.GetUsage(ctx, "workspaceid", workspaceId)
+}
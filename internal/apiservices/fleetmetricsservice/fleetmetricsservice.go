@@ -0,0 +1,256 @@
+// Package fleetmetricsservice publishes the inventory of the fleet, the
+// clusters per Kubernetes version and the nodes, cpu and memory per workspace
+// and datacenter, as Prometheus metrics. The metrics are gathered when
+// scraped and cached, and kept apart from the process metrics.
+package fleetmetricsservice
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/NorskHelsenett/ror-api/internal/apiservices/metricsservice"
+	"github.com/NorskHelsenett/ror-api/internal/apiservices/resourcesv2service"
+
+	"github.com/NorskHelsenett/ror/pkg/config/rorconfig"
+	"github.com/NorskHelsenett/ror/pkg/rorresources"
+	"github.com/NorskHelsenett/ror/pkg/rorresources/rortypes"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	namespace = "ror_fleet"
+	// otherLabel replaces the label values of the series beyond the series
+	// limit of a metric.
+	otherLabel   = "other"
+	unknownLabel = "unknown"
+	// clusterPageSize is how many clusters are read per page.
+	clusterPageSize = 1000
+	// defaultSeriesLimit bounds the series of each labelled metric.
+	defaultSeriesLimit = 200
+)
+
+var (
+	clustersDesc    = prometheus.NewDesc(namespace+"_clusters", "Clusters by provider, Kubernetes minor version and environment.", []string{"provider", "kubernetes_version", "environment"}, nil)
+	nodesDesc       = prometheus.NewDesc(namespace+"_nodes", "Nodes of the clusters by workspace and datacenter.", []string{"workspace", "datacenter"}, nil)
+	cpuDesc         = prometheus.NewDesc(namespace+"_cpu_cores", "vCPU of the nodes by workspace and datacenter.", []string{"workspace", "datacenter"}, nil)
+	cpuUsedDesc     = prometheus.NewDesc(namespace+"_cpu_used_cores", "vCPU used on the nodes by workspace and datacenter.", []string{"workspace", "datacenter"}, nil)
+	memoryDesc      = prometheus.NewDesc(namespace+"_memory_bytes", "Memory of the nodes by workspace and datacenter.", []string{"workspace", "datacenter"}, nil)
+	memoryUsedDesc  = prometheus.NewDesc(namespace+"_memory_used_bytes", "Memory used on the nodes by workspace and datacenter.", []string{"workspace", "datacenter"}, nil)
+	workspacesDesc  = prometheus.NewDesc(namespace+"_workspaces", "Workspaces.", nil, nil)
+	datacentersDesc = prometheus.NewDesc(namespace+"_datacenters", "Datacenters.", nil, nil)
+	nodePoolsDesc   = prometheus.NewDesc(namespace+"_nodepools", "Node pools of the clusters.", nil, nil)
+)
+
+// Cluster is the inventory of a cluster.
+type Cluster struct {
+	Provider          string
+	KubernetesVersion string
+	Environment       string
+	Workspace         string
+	Datacenter        string
+	Nodes             float64
+	CpuCores          float64
+	CpuUsedCores      float64
+	MemoryBytes       float64
+	MemoryUsedBytes   float64
+}
+
+// Snapshot is the fleet inventory at a time.
+type Snapshot struct {
+	Clusters    []Cluster
+	Workspaces  float64
+	Datacenters float64
+	NodePools   float64
+	SeriesLimit int
+}
+
+var snapshotCache struct {
+	lock     sync.Mutex
+	snapshot *Snapshot
+	loadedAt time.Time
+}
+
+// GetSnapshot returns the fleet inventory, gathered at most once per
+// FLEET_METRICS_CACHE_TTL. The identity must be able to read all clusters for
+// the snapshot to be the whole fleet.
+func GetSnapshot(ctx context.Context) (*Snapshot, error) {
+	ttl, err := time.ParseDuration(rorconfig.GetString("FLEET_METRICS_CACHE_TTL"))
+	if err != nil {
+		ttl = time.Minute
+	}
+
+	snapshotCache.lock.Lock()
+	defer snapshotCache.lock.Unlock()
+	if snapshotCache.snapshot != nil && time.Since(snapshotCache.loadedAt) < ttl {
+		return snapshotCache.snapshot, nil
+	}
+
+	snapshot, err := gather(ctx)
+	if err != nil {
+		return nil, err
+	}
+	snapshotCache.snapshot = snapshot
+	snapshotCache.loadedAt = time.Now()
+	return snapshot, nil
+}
+
+func gather(ctx context.Context) (*Snapshot, error) {
+	totals, err := metricsservice.GetTotal(ctx)
+	if err != nil {
+		return nil, err
+	}
+	seriesLimit, err := strconv.Atoi(rorconfig.GetString("FLEET_METRICS_SERIES_LIMIT"))
+	if err != nil {
+		seriesLimit = defaultSeriesLimit
+	}
+	snapshot := &Snapshot{
+		Workspaces:  float64(totals.WorkspaceCount),
+		Datacenters: float64(totals.DatacenterCount),
+		NodePools:   float64(totals.NodePoolCount),
+		SeriesLimit: seriesLimit,
+		Clusters:    make([]Cluster, 0),
+	}
+
+	query := &rorresources.ResourceQuery{
+		VersionKind: rortypes.ResourceKubernetesClusterGVK,
+		Limit:       clusterPageSize,
+	}
+	token := ""
+	for {
+		page, err := resourcesv2service.GetResourcePage(ctx, query, token)
+		if err != nil {
+			return nil, err
+		}
+		if page.Resources != nil {
+			snapshot.Clusters = appendClusters(snapshot.Clusters, page.Resources.Resources)
+		}
+		if page.Continue == "" {
+			return snapshot, nil
+		}
+		token = page.Continue
+	}
+}
+
+// appendClusters appends the inventory of the KubernetesCluster resources.
+func appendClusters(clusters []Cluster, resources []*rorresources.Resource) []Cluster {
+	for _, resource := range resources {
+		agent := resource.KubernetesClusterResource.Status.AgentStatus
+		clusters = append(clusters, Cluster{
+			Provider:          agent.KubernetesProvider.String(),
+			KubernetesVersion: agent.GetKubernetesVersion(),
+			Environment:       agent.Environment,
+			Workspace:         agent.Workspace,
+			Datacenter:        agent.Datacenter,
+			Nodes:             float64(agent.GetNodeCount()),
+			CpuCores:          float64(agent.GetTotalCpu().Value()),
+			CpuUsedCores:      float64(agent.GetTotalUsedCpu().MilliValue()) / 1000,
+			MemoryBytes:       float64(agent.GetTotalMemory().Value()),
+			MemoryUsedBytes:   float64(agent.GetTotalUsedMemory().Value()),
+		})
+	}
+	return clusters
+}
+
+// Describe implements prometheus.Collector.
+func (s *Snapshot) Describe(ch chan<- *prometheus.Desc) {
+	for _, desc := range []*prometheus.Desc{clustersDesc, nodesDesc, cpuDesc, cpuUsedDesc, memoryDesc, memoryUsedDesc, workspacesDesc, datacentersDesc, nodePoolsDesc} {
+		ch <- desc
+	}
+}
+
+// Collect implements prometheus.Collector.
+func (s *Snapshot) Collect(ch chan<- prometheus.Metric) {
+	ch <- prometheus.MustNewConstMetric(workspacesDesc, prometheus.GaugeValue, s.Workspaces)
+	ch <- prometheus.MustNewConstMetric(datacentersDesc, prometheus.GaugeValue, s.Datacenters)
+	ch <- prometheus.MustNewConstMetric(nodePoolsDesc, prometheus.GaugeValue, s.NodePools)
+
+	clusters := make(map[string]*series)
+	capacity := make(map[string]*series)
+	for _, cluster := range s.Clusters {
+		add(clusters, []string{label(cluster.Provider), minorVersion(cluster.KubernetesVersion), label(cluster.Environment)}, 1)
+		add(capacity, []string{label(cluster.Workspace), label(cluster.Datacenter)},
+			cluster.Nodes, cluster.CpuCores, cluster.CpuUsedCores, cluster.MemoryBytes, cluster.MemoryUsedBytes)
+	}
+
+	for _, series := range limit(clusters, s.SeriesLimit) {
+		ch <- prometheus.MustNewConstMetric(clustersDesc, prometheus.GaugeValue, series.values[0], series.labels...)
+	}
+	for _, series := range limit(capacity, s.SeriesLimit) {
+		for i, desc := range []*prometheus.Desc{nodesDesc, cpuDesc, cpuUsedDesc, memoryDesc, memoryUsedDesc} {
+			ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, series.values[i], series.labels...)
+		}
+	}
+}
+
+// series is the summed values of the clusters with the same labels.
+type series struct {
+	labels   []string
+	values   []float64
+	clusters int
+}
+
+func add(all map[string]*series, labels []string, values ...float64) {
+	key := strings.Join(labels, "\x00")
+	existing, ok := all[key]
+	if !ok {
+		existing = &series{labels: labels, values: make([]float64, len(values))}
+		all[key] = existing
+	}
+	for i, value := range values {
+		existing.values[i] += value
+	}
+	existing.clusters++
+}
+
+// limit returns at most maxSeries series, the series with the most clusters
+// and a series labelled other summing the rest. A limit of 0 or less is no
+// limit.
+func limit(all map[string]*series, maxSeries int) []*series {
+	sorted := make([]*series, 0, len(all))
+	for _, s := range all {
+		sorted = append(sorted, s)
+	}
+	slices.SortFunc(sorted, func(a, b *series) int {
+		return cmp.Or(cmp.Compare(b.clusters, a.clusters), slices.Compare(a.labels, b.labels))
+	})
+	if maxSeries <= 0 || len(sorted) <= maxSeries {
+		return sorted
+	}
+
+	kept := sorted[:maxSeries-1]
+	other := &series{labels: make([]string, len(sorted[0].labels)), values: make([]float64, len(sorted[0].values))}
+	for i := range other.labels {
+		other.labels[i] = otherLabel
+	}
+	for _, s := range sorted[maxSeries-1:] {
+		for i, value := range s.values {
+			other.values[i] += value
+		}
+		other.clusters += s.clusters
+	}
+	return append(kept, other)
+}
+
+// minorVersion returns the major and minor version of a Kubernetes version,
+// such as 1.31 for v1.31.4+rke2r1.
+func minorVersion(version string) string {
+	parts := strings.SplitN(strings.TrimPrefix(version, "v"), ".", 3)
+	if len(parts) < 2 || parts[0] == "" || parts[1] == "" {
+		return unknownLabel
+	}
+	return fmt.Sprintf("%s.%s", parts[0], parts[1])
+}
+
+func label(value string) string {
+	if value == "" {
+		return unknownLabel
+	}
+	return value
+}
@@ -0,0 +1,70 @@
+package fleetmetricsservice
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMinorVersion(t *testing.T) {
+	assert.Equal(t, "1.31", minorVersion("v1.31.4+rke2r1"))
+	assert.Equal(t, "1.30", minorVersion("1.30.2"))
+	assert.Equal(t, unknownLabel, minorVersion(""))
+	assert.Equal(t, unknownLabel, minorVersion("v1"))
+}
+
+func TestLimitFoldsSmallestSeriesIntoOther(t *testing.T) {
+	all := make(map[string]*series)
+	add(all, []string{"a"}, 1)
+	add(all, []string{"a"}, 1)
+	add(all, []string{"a"}, 1)
+	add(all, []string{"b"}, 1)
+	add(all, []string{"b"}, 1)
+	add(all, []string{"c"}, 1)
+	add(all, []string{"d"}, 1)
+
+	limited := limit(all, 3)
+
+	assert.Len(t, limited, 3)
+	assert.Equal(t, []string{"a"}, limited[0].labels)
+	assert.Equal(t, []string{"b"}, limited[1].labels)
+	assert.Equal(t, []string{otherLabel}, limited[2].labels)
+	assert.Equal(t, 2.0, limited[2].values[0])
+	assert.Len(t, limit(all, 0), 4)
+}
+
+func TestCollect(t *testing.T) {
+	snapshot := &Snapshot{
+		Workspaces:  2,
+		Datacenters: 1,
+		NodePools:   4,
+		Clusters: []Cluster{
+			{Provider: "tanzu", KubernetesVersion: "v1.31.4", Environment: "prod", Workspace: "ws1", Datacenter: "dc1", Nodes: 3, CpuCores: 12},
+			{Provider: "tanzu", KubernetesVersion: "v1.31.2", Environment: "prod", Workspace: "ws1", Datacenter: "dc1", Nodes: 2, CpuCores: 8},
+			{Provider: "aks", KubernetesVersion: "v1.30.1", Workspace: "ws2", Datacenter: "dc1", Nodes: 1, CpuCores: 4},
+		},
+	}
+
+	expected := `
+# HELP ror_fleet_clusters Clusters by provider, Kubernetes minor version and environment.
+# TYPE ror_fleet_clusters gauge
+ror_fleet_clusters{environment="prod",kubernetes_version="1.31",provider="tanzu"} 2
+ror_fleet_clusters{environment="unknown",kubernetes_version="1.30",provider="aks"} 1
+# HELP ror_fleet_cpu_cores vCPU of the nodes by workspace and datacenter.
+# TYPE ror_fleet_cpu_cores gauge
+ror_fleet_cpu_cores{datacenter="dc1",workspace="ws1"} 20
+ror_fleet_cpu_cores{datacenter="dc1",workspace="ws2"} 4
+# HELP ror_fleet_nodes Nodes of the clusters by workspace and datacenter.
+# TYPE ror_fleet_nodes gauge
+ror_fleet_nodes{datacenter="dc1",workspace="ws1"} 5
+ror_fleet_nodes{datacenter="dc1",workspace="ws2"} 1
+# HELP ror_fleet_workspaces Workspaces.
+# TYPE ror_fleet_workspaces gauge
+ror_fleet_workspaces 2
+`
+	err := testutil.CollectAndCompare(snapshot, strings.NewReader(expected),
+		"ror_fleet_clusters", "ror_fleet_cpu_cores", "ror_fleet_nodes", "ror_fleet_workspaces")
+	assert.NoError(t, err)
+}
@@ -0,0 +1,125 @@
+package metricsservice
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	mongometrics "github.com/NorskHelsenett/ror-api/internal/databases/mongodb/repositories/metrics"
+	"github.com/NorskHelsenett/ror-api/internal/models/metricsmodels"
+
+	"github.com/NorskHelsenett/ror/pkg/apicontracts"
+	"github.com/NorskHelsenett/ror/pkg/rlog"
+)
+
+const (
+	defaultHistoryRange  = 24 * time.Hour
+	defaultHistoryPoints = 300
+	maxHistoryPoints     = 5000
+)
+
+var ErrInvalidHistoryRange = errors.New("invalid history range")
+
+// HistoryRange is the period and the step of a metrics history.
+type HistoryRange struct {
+	From time.Time
+	To   time.Time
+	Step time.Duration
+}
+
+// NewHistoryRange returns the range of the from and to times, formatted as
+// RFC3339, and the step, formatted as a duration of whole minutes. To
+// defaults to now and from to a day before to. The step defaults to a step
+// giving about 300 points.
+func NewHistoryRange(from string, to string, step string, now time.Time) (HistoryRange, error) {
+	historyRange := HistoryRange{To: now.UTC()}
+	var err error
+	if to != "" {
+		if historyRange.To, err = time.Parse(time.RFC3339, to); err != nil {
+			return historyRange, fmt.Errorf("%w: to: %w", ErrInvalidHistoryRange, err)
+		}
+	}
+	historyRange.From = historyRange.To.Add(-defaultHistoryRange)
+	if from != "" {
+		if historyRange.From, err = time.Parse(time.RFC3339, from); err != nil {
+			return historyRange, fmt.Errorf("%w: from: %w", ErrInvalidHistoryRange, err)
+		}
+	}
+	if !historyRange.To.After(historyRange.From) {
+		return historyRange, fmt.Errorf("%w: to must be after from", ErrInvalidHistoryRange)
+	}
+
+	period := historyRange.To.Sub(historyRange.From)
+	if step == "" {
+		historyRange.Step = max(time.Minute, (period / defaultHistoryPoints).Truncate(time.Minute))
+	} else if historyRange.Step, err = time.ParseDuration(step); err != nil {
+		return historyRange, fmt.Errorf("%w: step: %w", ErrInvalidHistoryRange, err)
+	}
+	if historyRange.Step < time.Minute || historyRange.Step%time.Minute != 0 {
+		return historyRange, fmt.Errorf("%w: step must be whole minutes of at least 1m", ErrInvalidHistoryRange)
+	}
+	if period/historyRange.Step > maxHistoryPoints {
+		return historyRange, fmt.Errorf("%w: more than %d steps", ErrInvalidHistoryRange, maxHistoryPoints)
+	}
+	return historyRange, nil
+}
+
+func GetClusterHistory(ctx context.Context, clusterId string, historyRange HistoryRange) (*metricsmodels.History, error) {
+	return getHistory(ctx, mongometrics.HistoryFilterClusterId(clusterId), historyRange)
+}
+
+func GetWorkspaceHistory(ctx context.Context, workspaceId string, historyRange HistoryRange) (*metricsmodels.History, error) {
+	return getHistory(ctx, mongometrics.HistoryFilterWorkspaceId(workspaceId), historyRange)
+}
+
+func GetDatacenterHistory(ctx context.Context, datacenterId string, historyRange HistoryRange) (*metricsmodels.History, error) {
+	return getHistory(ctx, mongometrics.HistoryFilterDatacenterId(datacenterId), historyRange)
+}
+
+func getHistory(ctx context.Context, filter mongometrics.HistoryFilter, historyRange HistoryRange) (*metricsmodels.History, error) {
+	points, err := mongometrics.GetHistory(ctx, filter, historyRange.From, historyRange.To, historyRange.Step)
+	if err != nil {
+		return nil, err
+	}
+	return &metricsmodels.History{
+		From:   historyRange.From,
+		To:     historyRange.To,
+		Step:   historyRange.Step.String(),
+		Points: points,
+	}, nil
+}
+
+// recordClusterSample writes the sum of the nodes of the report as a sample
+// of the cluster and downsamples the completed hours and days of the cluster.
+func recordClusterSample(ctx context.Context, report *apicontracts.MetricsReport, clusterId string) {
+	metadata, err := mongometrics.GetSampleMetadata(ctx, clusterId)
+	if err != nil {
+		rlog.Errorc(ctx, "could not get cluster of metrics report", err, rlog.String("clusterId", clusterId))
+	}
+	now := time.Now()
+	if err := mongometrics.WriteSample(ctx, clusterSample(report, metadata, now)); err != nil {
+		rlog.Errorc(ctx, "could not write cluster metrics sample", err, rlog.String("clusterId", clusterId))
+		return
+	}
+	if err := mongometrics.Downsample(ctx, metadata, now); err != nil {
+		rlog.Errorc(ctx, "could not downsample cluster metrics", err, rlog.String("clusterId", clusterId))
+	}
+}
+
+// clusterSample returns the sum of the nodes of the report. Cpu usage is
+// reported in millicores.
+func clusterSample(report *apicontracts.MetricsReport, metadata metricsmodels.SampleMetadata, now time.Time) metricsmodels.ClusterSample {
+	sample := metricsmodels.ClusterSample{
+		Timestamp: now.UTC().Truncate(time.Minute),
+		Metadata:  metadata,
+		Nodes:     float64(len(report.Nodes)),
+	}
+	for _, node := range report.Nodes {
+		sample.CpuAllocatedCores += float64(node.CpuAllocated)
+		sample.CpuUsageCores += float64(node.CpuUsage) / 1000
+		sample.MemoryAllocatedBytes += float64(node.MemoryAllocated)
+		sample.MemoryUsageBytes += float64(node.MemoryUsage)
+	}
+	return sample
+}
@@ -0,0 +1,43 @@
+package metricsservice
+
+import (
+	"testing"
+	"time"
+
+	mongometrics "github.com/NorskHelsenett/ror-api/internal/databases/mongodb/repositories/metrics"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewHistoryRange(t *testing.T) {
+	now := time.Date(2025, time.March, 10, 12, 30, 0, 0, time.UTC)
+
+	historyRange, err := NewHistoryRange("", "", "", now)
+	assert.NoError(t, err)
+	assert.Equal(t, now.Add(-24*time.Hour), historyRange.From)
+	assert.Equal(t, now, historyRange.To)
+	assert.Equal(t, 4*time.Minute, historyRange.Step)
+
+	historyRange, err = NewHistoryRange("2025-01-01T00:00:00Z", "2025-03-01T00:00:00Z", "24h", now)
+	assert.NoError(t, err)
+	assert.Equal(t, 24*time.Hour, historyRange.Step)
+	assert.Equal(t, mongometrics.DailyCollectionName, mongometrics.HistoryCollection(historyRange.Step))
+
+	for _, invalid := range [][3]string{
+		{"yesterday", "", ""},
+		{"2025-03-01T00:00:00Z", "2025-01-01T00:00:00Z", ""},
+		{"", "", "90s"},
+		{"", "", "10s"},
+		{"2020-01-01T00:00:00Z", "", "1m"},
+	} {
+		_, err := NewHistoryRange(invalid[0], invalid[1], invalid[2], now)
+		assert.ErrorIs(t, err, ErrInvalidHistoryRange, invalid)
+	}
+}
+
+func TestHistoryCollection(t *testing.T) {
+	assert.Equal(t, mongometrics.MinuteCollectionName, mongometrics.HistoryCollection(5*time.Minute))
+	assert.Equal(t, mongometrics.HourlyCollectionName, mongometrics.HistoryCollection(time.Hour))
+	assert.Equal(t, mongometrics.HourlyCollectionName, mongometrics.HistoryCollection(6*time.Hour))
+	assert.Equal(t, mongometrics.DailyCollectionName, mongometrics.HistoryCollection(7*24*time.Hour))
+}
@@ -37,5 +37,6 @@ func ProcessMetricReport(ctx context.Context, resourceUpdate *apicontracts.Metri
 		}
 	}
 	mongometrics.WriteMetrics(resourceUpdate, string(resourceUpdate.Owner.Subject), ctx)
+	recordClusterSample(ctx, resourceUpdate, string(resourceUpdate.Owner.Subject))
 	return nil
 }
@@ -0,0 +1,290 @@
+// Package orderpolicyservice checks cluster orders against the quotas of
+// their project and workspace and the approval rules, and manages the quotas
+// and rules.
+package orderpolicyservice
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/NorskHelsenett/ror-api/internal/apiservices/clustersservice"
+	"github.com/NorskHelsenett/ror-api/internal/apiservices/pricesservice"
+	resourcesservice "github.com/NorskHelsenett/ror-api/internal/apiservices/resourcesService"
+	orderpoliciesrepo "github.com/NorskHelsenett/ror-api/internal/databases/mongodb/repositories/orderpolicies"
+	"github.com/NorskHelsenett/ror-api/internal/models/orderpolicymodels"
+	"github.com/NorskHelsenett/ror-api/internal/provider/clusterorder/orderlifecycle"
+
+	"github.com/NorskHelsenett/ror/pkg/apicontracts"
+	"github.com/NorskHelsenett/ror/pkg/apicontracts/apiresourcecontracts"
+	"github.com/NorskHelsenett/ror/pkg/kubernetes/providers/providermodels"
+	aclmodels "github.com/NorskHelsenett/ror/pkg/models/aclmodels"
+)
+
+const bytesPerGiB = 1 << 30
+
+// Evaluate checks the order with the uid against the quotas and approval
+// rules. The usage of a quota is the registered clusters and the other orders
+// being provisioned or waiting for approval in its scope.
+func Evaluate(ctx context.Context, uid string, order apiresourcecontracts.ResourceClusterOrderSpec) (*orderpolicymodels.OrderDecision, error) {
+	prices, err := pricesservice.GetAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if prices == nil {
+		prices = &[]apicontracts.Price{}
+	}
+
+	checks, err := getQuotaChecks(ctx, uid, order, *prices)
+	if err != nil {
+		return nil, err
+	}
+	rules, err := orderpoliciesrepo.GetApprovalRules(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	decision := evaluate(order, *prices, checks, rules)
+	return &decision, nil
+}
+
+// evaluate prices the order and decides if it must be approved. The checks
+// hold the quotas with their usage before the order.
+func evaluate(order apiresourcecontracts.ResourceClusterOrderSpec, prices []apicontracts.Price, checks []orderpolicymodels.QuotaCheck, rules []orderpolicymodels.ApprovalRule) orderpolicymodels.OrderDecision {
+	requested, unpriced := requestedResources(order, prices)
+	decision := orderpolicymodels.OrderDecision{
+		Reasons:   []string{},
+		Requested: requested,
+		Quotas:    checks,
+	}
+
+	for _, machineClass := range unpriced {
+		decision.Reasons = append(decision.Reasons, fmt.Sprintf("machine class %s has no price for provider %s", machineClass, order.Provider))
+	}
+	for i := range decision.Quotas {
+		check := &decision.Quotas[i]
+		check.Exceeded = exceededLimits(check.Quota, check.Usage.Add(requested))
+		for _, exceeded := range check.Exceeded {
+			decision.Reasons = append(decision.Reasons, fmt.Sprintf("%s %s quota exceeded: %s", check.Quota.Scope, check.Quota.SubjectId, exceeded))
+		}
+	}
+	for _, rule := range rules {
+		if rule.Matches(order) {
+			decision.Reasons = append(decision.Reasons, fmt.Sprintf("matches approval rule %s", rule.Name))
+		}
+	}
+
+	decision.RequiresApproval = len(decision.Reasons) > 0
+	return decision
+}
+
+// requestedResources returns the resources of the node pools of the order,
+// sized by the price of their machine class. Machine classes without a price
+// are returned as unpriced.
+func requestedResources(order apiresourcecontracts.ResourceClusterOrderSpec, prices []apicontracts.Price) (orderpolicymodels.Resources, []string) {
+	requested := orderpolicymodels.Resources{Clusters: 1}
+	var unpriced []string
+	for _, nodePool := range order.NodePools {
+		index := slices.IndexFunc(prices, func(price apicontracts.Price) bool {
+			return price.Provider == providermodels.ProviderType(order.Provider) && price.MachineClass == nodePool.MachineClass
+		})
+		if index < 0 {
+			if !slices.Contains(unpriced, nodePool.MachineClass) {
+				unpriced = append(unpriced, nodePool.MachineClass)
+			}
+			continue
+		}
+		count := int64(nodePool.Count)
+		requested.Cpu += int64(prices[index].Cpu) * count
+		requested.MemoryGiB += prices[index].Memory * count
+	}
+	return requested, unpriced
+}
+
+// exceededLimits returns the limits of the quota the usage is over.
+func exceededLimits(quota orderpolicymodels.Quota, usage orderpolicymodels.Resources) []string {
+	var exceeded []string
+	if quota.MaxClusters > 0 && usage.Clusters > quota.MaxClusters {
+		exceeded = append(exceeded, fmt.Sprintf("%d of %d clusters", usage.Clusters, quota.MaxClusters))
+	}
+	if quota.MaxCpu > 0 && usage.Cpu > quota.MaxCpu {
+		exceeded = append(exceeded, fmt.Sprintf("%d of %d vCPU", usage.Cpu, quota.MaxCpu))
+	}
+	if quota.MaxMemoryGiB > 0 && usage.MemoryGiB > quota.MaxMemoryGiB {
+		exceeded = append(exceeded, fmt.Sprintf("%d of %d GiB memory", usage.MemoryGiB, quota.MaxMemoryGiB))
+	}
+	return exceeded
+}
+
+// getQuotaChecks returns the quotas of the project and workspace of the order
+// with their usage, without the order itself.
+func getQuotaChecks(ctx context.Context, uid string, order apiresourcecontracts.ResourceClusterOrderSpec, prices []apicontracts.Price) ([]orderpolicymodels.QuotaCheck, error) {
+	var quotas []orderpolicymodels.Quota
+	subjects := map[orderpolicymodels.QuotaScope]string{
+		orderpolicymodels.QuotaScopeProject:   order.ProjectId,
+		orderpolicymodels.QuotaScopeWorkspace: WorkspaceId(order),
+	}
+	for _, scope := range []orderpolicymodels.QuotaScope{orderpolicymodels.QuotaScopeProject, orderpolicymodels.QuotaScopeWorkspace} {
+		if subjects[scope] == "" {
+			continue
+		}
+		quota, err := orderpoliciesrepo.GetQuota(ctx, scope, subjects[scope])
+		if err != nil {
+			return nil, err
+		}
+		if quota != nil {
+			quotas = append(quotas, *quota)
+		}
+	}
+
+	checks := make([]orderpolicymodels.QuotaCheck, 0, len(quotas))
+	if len(quotas) == 0 {
+		return checks, nil
+	}
+	pending, err := getPendingOrders(ctx, uid)
+	if err != nil {
+		return nil, err
+	}
+	for _, quota := range quotas {
+		usage, err := getClusterUsage(ctx, quota)
+		if err != nil {
+			return nil, err
+		}
+		for _, pendingOrder := range pending {
+			pendingSubjects := map[orderpolicymodels.QuotaScope]string{
+				orderpolicymodels.QuotaScopeProject:   pendingOrder.Spec.ProjectId,
+				orderpolicymodels.QuotaScopeWorkspace: WorkspaceId(pendingOrder.Spec),
+			}
+			if pendingSubjects[quota.Scope] != quota.SubjectId {
+				continue
+			}
+			requested, _ := requestedResources(pendingOrder.Spec, prices)
+			usage = usage.Add(requested)
+		}
+		checks = append(checks, orderpolicymodels.QuotaCheck{Quota: quota, Usage: usage})
+	}
+	return checks, nil
+}
+
+// getClusterUsage returns the resources of the registered clusters in the
+// scope of the quota.
+func getClusterUsage(ctx context.Context, quota orderpolicymodels.Quota) (orderpolicymodels.Resources, error) {
+	getUsage := clustersservice.GetProjectUsage
+	if quota.Scope == orderpolicymodels.QuotaScopeWorkspace {
+		getUsage = clustersservice.GetWorkspaceUsage
+	}
+	usage, err := getUsage(ctx, quota.SubjectId)
+	if err != nil {
+		return orderpolicymodels.Resources{}, err
+	}
+	return orderpolicymodels.Resources{
+		Clusters:  usage.Count,
+		Cpu:       usage.Cpu,
+		MemoryGiB: usage.Memory / bytesPerGiB,
+	}, nil
+}
+
+// getPendingOrders returns the create orders, other than the order with the
+// uid, that are being provisioned or wait for approval. Their clusters are
+// not registered yet but count against the quotas.
+func getPendingOrders(ctx context.Context, uid string) ([]apiresourcecontracts.ResourceClusterOrder, error) {
+	orders, err := resourcesservice.GetClusterorders(ctx, apiresourcecontracts.ResourceOwnerReference{
+		Scope:   aclmodels.Acl2ScopeRor,
+		Subject: string(aclmodels.Acl2RorSubjectGlobal),
+	})
+	if err != nil {
+		return nil, err
+	}
+	phases := []string{
+		orderlifecycle.Phase(orderlifecycle.StateProvisioning),
+		orderlifecycle.Phase(orderlifecycle.StateAwaitingApproval),
+	}
+	pending := make([]apiresourcecontracts.ResourceClusterOrder, 0)
+	for _, order := range orders.Clusterorders {
+		if order.Metadata.Uid == uid || order.Spec.OrderType != apiresourcecontracts.ResourceActionTypeCreate {
+			continue
+		}
+		if slices.Contains(phases, string(order.Status.Phase)) {
+			pending = append(pending, order)
+		}
+	}
+	return pending, nil
+}
+
+// WorkspaceId returns the workspace the order is placed in. Only tanzu orders
+// are placed in a workspace.
+func WorkspaceId(order apiresourcecontracts.ResourceClusterOrderSpec) string {
+	if providermodels.ProviderType(order.Provider) != providermodels.ProviderTypeTanzu {
+		return ""
+	}
+	var providerConfig apiresourcecontracts.ResourceProviderConfigTanzu
+	jsonString, err := json.Marshal(order.ProviderConfig)
+	if err != nil {
+		return ""
+	}
+	if err := json.Unmarshal(jsonString, &providerConfig); err != nil {
+		return ""
+	}
+	return providerConfig.NamespaceId
+}
+
+// ErrNotFound is returned when a deleted quota or approval rule does not
+// exist.
+var ErrNotFound = errors.New("not found")
+
+func GetQuotas(ctx context.Context) ([]orderpolicymodels.Quota, error) {
+	return orderpoliciesrepo.GetQuotas(ctx)
+}
+
+// SetQuota creates or replaces the quota and returns it with the quota it
+// replaced.
+func SetQuota(ctx context.Context, quota orderpolicymodels.Quota, by string) (*orderpolicymodels.Quota, *orderpolicymodels.Quota, error) {
+	quota.UpdatedBy = by
+	quota.Updated = time.Now()
+	original, err := orderpoliciesrepo.UpsertQuota(ctx, quota)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &quota, original, nil
+}
+
+func DeleteQuota(ctx context.Context, scope orderpolicymodels.QuotaScope, subjectId string) (*orderpolicymodels.Quota, error) {
+	original, err := orderpoliciesrepo.DeleteQuota(ctx, scope, subjectId)
+	if err != nil {
+		return nil, err
+	}
+	if original == nil {
+		return nil, ErrNotFound
+	}
+	return original, nil
+}
+
+func GetApprovalRules(ctx context.Context) ([]orderpolicymodels.ApprovalRule, error) {
+	return orderpoliciesrepo.GetApprovalRules(ctx)
+}
+
+// SetApprovalRule creates or replaces the approval rule and returns it with
+// the rule it replaced.
+func SetApprovalRule(ctx context.Context, rule orderpolicymodels.ApprovalRule, by string) (*orderpolicymodels.ApprovalRule, *orderpolicymodels.ApprovalRule, error) {
+	rule.UpdatedBy = by
+	rule.Updated = time.Now()
+	original, err := orderpoliciesrepo.UpsertApprovalRule(ctx, rule)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &rule, original, nil
+}
+
+func DeleteApprovalRule(ctx context.Context, name string) (*orderpolicymodels.ApprovalRule, error) {
+	original, err := orderpoliciesrepo.DeleteApprovalRule(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if original == nil {
+		return nil, ErrNotFound
+	}
+	return original, nil
+}
@@ -0,0 +1,64 @@
+package orderpolicyservice
+
+import (
+	"testing"
+
+	"github.com/NorskHelsenett/ror-api/internal/models/orderpolicymodels"
+
+	"github.com/NorskHelsenett/ror/pkg/apicontracts"
+	"github.com/NorskHelsenett/ror/pkg/apicontracts/apiresourcecontracts"
+	"github.com/NorskHelsenett/ror/pkg/kubernetes/providers/providermodels"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var prices = []apicontracts.Price{
+	{Provider: providermodels.ProviderTypeTanzu, MachineClass: "best-effort-medium", Cpu: 2, Memory: 8},
+	{Provider: providermodels.ProviderTypeTanzu, MachineClass: "best-effort-large", Cpu: 4, Memory: 16},
+}
+
+func testOrder() apiresourcecontracts.ResourceClusterOrderSpec {
+	return apiresourcecontracts.ResourceClusterOrderSpec{
+		Provider:    providermodels.ProviderTypeTanzu,
+		ProjectId:   "project",
+		Environment: apiresourcecontracts.EnvironmentDevelopment,
+		NodePools: []apiresourcecontracts.ResourceClusterOrderSpecNodePool{
+			{Name: "workers", MachineClass: "best-effort-large", Count: 3},
+			{Name: "system", MachineClass: "best-effort-medium", Count: 1},
+		},
+	}
+}
+
+func TestEvaluateWithinQuota(t *testing.T) {
+	checks := []orderpolicymodels.QuotaCheck{{
+		Quota: orderpolicymodels.Quota{Scope: orderpolicymodels.QuotaScopeProject, SubjectId: "project", MaxClusters: 2, MaxCpu: 20},
+		Usage: orderpolicymodels.Resources{Clusters: 1, Cpu: 6},
+	}}
+
+	decision := evaluate(testOrder(), prices, checks, nil)
+	assert.False(t, decision.RequiresApproval)
+	assert.Empty(t, decision.Reasons)
+	assert.Equal(t, orderpolicymodels.Resources{Clusters: 1, Cpu: 14, MemoryGiB: 56}, decision.Requested)
+}
+
+func TestEvaluateRequiresApproval(t *testing.T) {
+	checks := []orderpolicymodels.QuotaCheck{{
+		Quota: orderpolicymodels.Quota{Scope: orderpolicymodels.QuotaScopeWorkspace, SubjectId: "workspace", MaxClusters: 1, MaxMemoryGiB: 100},
+		Usage: orderpolicymodels.Resources{Clusters: 1, MemoryGiB: 32},
+	}}
+	rules := []orderpolicymodels.ApprovalRule{
+		{Name: "production", Environments: []apiresourcecontracts.EnvironmentType{apiresourcecontracts.EnvironmentProduction}},
+		{Name: "tanzu", Providers: []providermodels.ProviderType{providermodels.ProviderTypeTanzu}},
+	}
+	order := testOrder()
+	order.NodePools = append(order.NodePools, apiresourcecontracts.ResourceClusterOrderSpecNodePool{Name: "gpu", MachineClass: "gpu-large", Count: 1})
+
+	decision := evaluate(order, prices, checks, rules)
+	assert.True(t, decision.RequiresApproval)
+	assert.Equal(t, []string{
+		"machine class gpu-large has no price for provider tanzu",
+		"workspace workspace quota exceeded: 2 of 1 clusters",
+		"matches approval rule tanzu",
+	}, decision.Reasons)
+	assert.Equal(t, []string{"2 of 1 clusters"}, decision.Quotas[0].Exceeded)
+}
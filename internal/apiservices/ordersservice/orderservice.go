@@ -2,14 +2,38 @@ package ordersservice
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"strings"
 
+	"github.com/NorskHelsenett/ror-api/internal/acl/aclservice"
+	"github.com/NorskHelsenett/ror-api/internal/apiservices/orderpolicyservice"
 	"github.com/NorskHelsenett/ror-api/internal/provider/clusterorder"
+	"github.com/NorskHelsenett/ror-api/internal/provider/clusterorder/orderlifecycle"
 
 	"github.com/NorskHelsenett/ror/pkg/apicontracts/apiresourcecontracts"
+	"github.com/NorskHelsenett/ror/pkg/config/rorconfig"
+	"github.com/NorskHelsenett/ror/pkg/context/rorcontext"
+	aclmodels "github.com/NorskHelsenett/ror/pkg/models/aclmodels"
 
 	"github.com/NorskHelsenett/ror/pkg/rlog"
 )
 
+var (
+	// ErrValidationFailed is returned when a retried order fails validation,
+	// the order is failed again.
+	ErrValidationFailed = errors.New("cluster order validation failed")
+	// ErrNotApprover is returned when the identity may not approve or reject
+	// the order.
+	ErrNotApprover = errors.New("not an approver of the cluster order")
+	// ErrSelfApproval is returned when the identity that ordered the cluster
+	// approves it, unless CLUSTERORDER_APPROVAL_ALLOW_SELF is set.
+	ErrSelfApproval = errors.New("cluster orders can not be approved by the identity that ordered them")
+	// ErrReasonRequired is returned when an order is approved or rejected
+	// without a reason.
+	ErrReasonRequired = errors.New("a reason is required")
+)
+
 func OrderCluster(ctx context.Context, orderspec apiresourcecontracts.ResourceClusterOrderSpec) error {
 	order, err := clusterorder.NewClusterOrder(ctx, orderspec)
 	if err != nil {
@@ -21,10 +45,25 @@ func OrderCluster(ctx context.Context, orderspec apiresourcecontracts.ResourceCl
 		rlog.Errorc(ctx, "error validating cluster order", err)
 		return err
 	}
-	err = order.UpdateStatus(ctx, apiresourcecontracts.ResourceClusterOrderStatus{
+
+	approval, err := getApproval(ctx, order.GetUid(), orderspec)
+	if err != nil {
+		rlog.Errorc(ctx, "error evaluating cluster order policies", err)
+		return err
+	}
+	status := apiresourcecontracts.ResourceClusterOrderStatus{
 		Phase:  apiresourcecontracts.ResourceClusterOrderStatusPhaseCreating,
 		Status: "Accepted",
-	})
+	}
+	if approval != nil {
+		// The operator only provisions orders in the Creating phase, the
+		// order is handed over when it is approved.
+		status = apiresourcecontracts.ResourceClusterOrderStatus{
+			Phase:  apiresourcecontracts.ResourceClusterOrderStatusPhase(orderlifecycle.Phase(orderlifecycle.StateAwaitingApproval)),
+			Status: strings.Join(approval.Reasons, "; "),
+		}
+	}
+	err = order.UpdateStatus(ctx, status)
 	if err != nil {
 		rlog.Error("could not update status", err)
 	}
@@ -35,5 +74,153 @@ func OrderCluster(ctx context.Context, orderspec apiresourcecontracts.ResourceCl
 		return err
 	}
 
+	// The lifecycle is created from the phase of the order when it is read,
+	// so an order is not failed if recording it fails here.
+	_, err = orderlifecycle.Start(ctx, order.GetUid(), getIdentityId(ctx), approval)
+	if err != nil {
+		rlog.Errorc(ctx, "could not start cluster order lifecycle", err, rlog.String("uid", order.GetUid()))
+	}
+
 	return nil
 }
+
+// GetOrderLifecycle returns the state, conditions and transitions of the
+// order.
+func GetOrderLifecycle(ctx context.Context, uid string) (*orderlifecycle.Lifecycle, error) {
+	return orderlifecycle.Get(ctx, uid)
+}
+
+// CancelOrder cancels an order that is not ready, failed or cancelled.
+func CancelOrder(ctx context.Context, uid string, message string) (*orderlifecycle.Lifecycle, error) {
+	return orderlifecycle.TransitionTo(ctx, uid, orderlifecycle.StateCancelled, orderlifecycle.ReasonCancelRequested, message, getIdentityId(ctx))
+}
+
+// RetryOrder moves a failed order back to pending and validates it again. A
+// valid order is handed to provisioning or waits for approval, an invalid
+// order is failed with ErrValidationFailed.
+func RetryOrder(ctx context.Context, uid string) (*orderlifecycle.Lifecycle, error) {
+	by := getIdentityId(ctx)
+	lifecycle, err := orderlifecycle.TransitionTo(ctx, uid, orderlifecycle.StatePending, orderlifecycle.ReasonRetryRequested, "", by)
+	if err != nil {
+		return nil, err
+	}
+
+	resource, err := orderlifecycle.GetOrder(ctx, uid)
+	if err != nil {
+		return lifecycle, err
+	}
+	order, err := clusterorder.NewClusterOrderFromResource(ctx, resource)
+	if err != nil {
+		return orderlifecycle.TransitionTo(ctx, uid, orderlifecycle.StateFailed, orderlifecycle.ReasonValidationFailed, err.Error(), by)
+	}
+	if err := order.Validate(ctx); err != nil {
+		lifecycle, transitionErr := orderlifecycle.TransitionTo(ctx, uid, orderlifecycle.StateFailed, orderlifecycle.ReasonValidationFailed, err.Error(), by)
+		if transitionErr != nil {
+			return lifecycle, transitionErr
+		}
+		return lifecycle, fmt.Errorf("%w: %w", ErrValidationFailed, err)
+	}
+
+	approval, err := getApproval(ctx, uid, resource.Spec)
+	if err != nil {
+		return orderlifecycle.TransitionTo(ctx, uid, orderlifecycle.StateFailed, orderlifecycle.ReasonValidationFailed, err.Error(), by)
+	}
+
+	_, err = orderlifecycle.TransitionTo(ctx, uid, orderlifecycle.StateValidated, orderlifecycle.ReasonRetryRequested, "", by)
+	if err != nil {
+		return nil, err
+	}
+	if approval != nil {
+		return orderlifecycle.AwaitApproval(ctx, uid, *approval, by)
+	}
+	return orderlifecycle.TransitionTo(ctx, uid, orderlifecycle.StateProvisioning, orderlifecycle.ReasonRetryRequested, "", by)
+}
+
+// getApproval checks the order against the quotas and approval rules, and
+// returns the approval the order must wait for, or nil if it may be
+// provisioned.
+func getApproval(ctx context.Context, uid string, orderspec apiresourcecontracts.ResourceClusterOrderSpec) (*orderlifecycle.Approval, error) {
+	decision, err := orderpolicyservice.Evaluate(ctx, uid, orderspec)
+	if err != nil {
+		return nil, err
+	}
+	if !decision.RequiresApproval {
+		return nil, nil
+	}
+
+	groups, err := aclservice.GetGroupsByAccess(ctx, aclmodels.Acl2ScopeProject, aclmodels.Acl2Subject(orderspec.ProjectId), aclmodels.AccessTypeOwner)
+	if err != nil {
+		rlog.Errorc(ctx, "could not get approvers of cluster order", err, rlog.String("uid", uid))
+	}
+	// The order is approved on behalf of the identity submitting it, not the
+	// orderBy of the spec, which is set by the client.
+	return &orderlifecycle.Approval{
+		ProjectId:      orderspec.ProjectId,
+		OrderBy:        getIdentityId(ctx),
+		Reasons:        decision.Reasons,
+		ApproverGroups: groups,
+	}, nil
+}
+
+// GetOrdersAwaitingApproval returns the orders waiting for approval that the
+// identity may approve.
+func GetOrdersAwaitingApproval(ctx context.Context) ([]orderlifecycle.Lifecycle, error) {
+	lifecycles, err := orderlifecycle.ListAwaitingApproval(ctx)
+	if err != nil {
+		return nil, err
+	}
+	approvable := make([]orderlifecycle.Lifecycle, 0, len(lifecycles))
+	for _, lifecycle := range lifecycles {
+		if canApprove(ctx, lifecycle) {
+			approvable = append(approvable, lifecycle)
+		}
+	}
+	return approvable, nil
+}
+
+// ApproveOrder approves an order waiting for approval and hands it to
+// provisioning.
+func ApproveOrder(ctx context.Context, uid string, reason string) (*orderlifecycle.Lifecycle, error) {
+	return decideOrder(ctx, uid, true, reason)
+}
+
+// RejectOrder rejects an order waiting for approval.
+func RejectOrder(ctx context.Context, uid string, reason string) (*orderlifecycle.Lifecycle, error) {
+	return decideOrder(ctx, uid, false, reason)
+}
+
+func decideOrder(ctx context.Context, uid string, approved bool, reason string) (*orderlifecycle.Lifecycle, error) {
+	if strings.TrimSpace(reason) == "" {
+		return nil, ErrReasonRequired
+	}
+	lifecycle, err := orderlifecycle.Get(ctx, uid)
+	if err != nil {
+		return nil, err
+	}
+	if !canApprove(ctx, *lifecycle) {
+		return nil, ErrNotApprover
+	}
+	by := getIdentityId(ctx)
+	if approved && lifecycle.Approval != nil && lifecycle.Approval.OrderBy == by && !rorconfig.GetBool("CLUSTERORDER_APPROVAL_ALLOW_SELF") {
+		return nil, ErrSelfApproval
+	}
+	return orderlifecycle.Decide(ctx, uid, approved, reason, by)
+}
+
+// canApprove returns true if the identity has owner access to the project of
+// the order, directly or through the ror scope.
+func canApprove(ctx context.Context, lifecycle orderlifecycle.Lifecycle) bool {
+	if lifecycle.Approval == nil || lifecycle.Approval.ProjectId == "" {
+		return aclservice.CheckAccessByContextAclQuery(ctx, aclmodels.NewAclV2QueryAccessScopeSubject(aclmodels.Acl2ScopeRor, aclmodels.Acl2RorSubjectGlobal)).Owner
+	}
+	accessQuery := aclmodels.NewAclV2QueryAccessScopeSubject(aclmodels.Acl2ScopeProject, aclmodels.Acl2Subject(lifecycle.Approval.ProjectId))
+	return aclservice.CheckAccessByContextAclQuery(ctx, accessQuery).Owner
+}
+
+func getIdentityId(ctx context.Context) string {
+	identity, err := rorcontext.GetIdentityFromRorContext(ctx)
+	if err != nil {
+		return ""
+	}
+	return identity.GetId()
+}
@@ -0,0 +1,351 @@
+// Package outboxservice publishes events to the message bus through an outbox
+// collection. An event is stored in the outbox when the change it reports is
+// written, and a relay publishes it with publisher confirms, retrying with
+// backoff until the broker has confirmed it. Consumers may see an event more
+// than once, each event is published with its id as message id to
+// de-duplicate on.
+package outboxservice
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/NorskHelsenett/ror/pkg/clients/mongodb"
+	"github.com/NorskHelsenett/ror/pkg/clients/rabbitmqclient"
+	"github.com/NorskHelsenett/ror/pkg/config/rorconfig"
+	"github.com/NorskHelsenett/ror/pkg/messagebuscontracts"
+	"github.com/NorskHelsenett/ror/pkg/rlog"
+
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	amqp091 "github.com/rabbitmq/amqp091-go"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+const (
+	OUTBOXCOLLECTION = "outbox"
+
+	defaultRelayInterval = time.Second
+	// claimLease is how long a relay holds an event it is publishing before
+	// another replica may take it over.
+	claimLease     = time.Minute
+	confirmTimeout = 30 * time.Second
+	// relayBatchSize is the number of events published before waiting for
+	// their confirms.
+	relayBatchSize = 100
+	minBackoff     = time.Second
+	maxBackoff     = 5 * time.Minute
+)
+
+var (
+	outboxLag = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "ror_api_outbox_lag_seconds",
+		Help: "Age of the oldest event in the outbox not yet published to the message bus",
+	})
+	outboxPending = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "ror_api_outbox_pending_events",
+		Help: "Number of events in the outbox not yet published to the message bus",
+	})
+	outboxPublished = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "ror_api_outbox_published_events_total",
+		Help: "Number of outbox events published to and confirmed by the message bus",
+	})
+	outboxFailed = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "ror_api_outbox_failed_publishes_total",
+		Help: "Number of failed attempts to publish an outbox event, the event is retried",
+	})
+
+	relayNotifier = make(chan struct{}, 1)
+)
+
+// Event is a message in the outbox.
+type Event struct {
+	Id            string            `bson:"_id"`
+	Exchange      string            `bson:"exchange"`
+	RoutingKey    string            `bson:"routingkey"`
+	Headers       map[string]string `bson:"headers,omitempty"`
+	Body          []byte            `bson:"body"`
+	CreatedAt     time.Time         `bson:"createdat"`
+	Attempts      int               `bson:"attempts"`
+	NextAttemptAt time.Time         `bson:"nextattemptat"`
+	ClaimedUntil  time.Time         `bson:"claimeduntil"`
+	PublishedAt   *time.Time        `bson:"publishedat"`
+	LastError     string            `bson:"lasterror,omitempty"`
+}
+
+// Enqueue stores an event for the payload, published as JSON to the ror
+// exchange with the routing key and headers.
+func Enqueue(ctx context.Context, routingKey string, payload any, headers map[string]string) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("could not marshal outbox event: %w", err)
+	}
+
+	now := time.Now()
+	event := Event{
+		Id:            uuid.NewString(),
+		Exchange:      messagebuscontracts.ExchangeRor,
+		RoutingKey:    routingKey,
+		Headers:       headers,
+		Body:          body,
+		CreatedAt:     now,
+		NextAttemptAt: now,
+	}
+	if _, err := mongodb.GetMongoDb().Collection(OUTBOXCOLLECTION).InsertOne(ctx, event); err != nil {
+		return fmt.Errorf("could not store outbox event: %w", err)
+	}
+
+	select {
+	case relayNotifier <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// StartRelay publishes the outbox events until the context is done. The
+// relay runs when an event is enqueued on this replica and every
+// OUTBOX_RELAY_INTERVAL for the events of other replicas and retries. The
+// channel of the connection is put in confirm mode, so the connection must
+// not be shared with other publishers.
+func StartRelay(ctx context.Context, connection rabbitmqclient.RabbitMQConnection) {
+	interval, err := time.ParseDuration(rorconfig.GetString("OUTBOX_RELAY_INTERVAL"))
+	if err != nil || interval <= 0 {
+		rlog.Warn("invalid OUTBOX_RELAY_INTERVAL, using the default", rlog.String("default", defaultRelayInterval.String()))
+		interval = defaultRelayInterval
+	}
+
+	relay := &relay{connection: connection}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			case <-relayNotifier:
+			}
+			relay.publishPending(ctx)
+			updateLag(ctx)
+		}
+	}()
+}
+
+type relay struct {
+	connection rabbitmqclient.RabbitMQConnection
+	// confirming is the channel put in confirm mode, a new channel after a
+	// reconnect is put in confirm mode before publishing on it.
+	lock       sync.Mutex
+	confirming *amqp091.Channel
+}
+
+// publishPending publishes the events due, oldest first, in batches of
+// relayBatchSize until there are no more or publishing fails.
+func (r *relay) publishPending(ctx context.Context) {
+	for ctx.Err() == nil {
+		events, err := claimBatch(ctx, time.Now())
+		if err != nil {
+			rlog.Error("could not claim outbox event", err)
+		}
+		if len(events) == 0 {
+			return
+		}
+
+		published := r.publishBatch(ctx, events)
+		for i, event := range events {
+			if published[i] != nil {
+				outboxFailed.Inc()
+				rlog.Warn("could not publish outbox event, retrying", rlog.String("id", event.Id), rlog.String("routing key", event.RoutingKey), rlog.Int("attempts", event.Attempts+1), rlog.String("error", published[i].Error()))
+				if err := release(ctx, event, published[i], time.Now()); err != nil {
+					rlog.Error("could not release outbox event", err, rlog.String("id", event.Id))
+				}
+				continue
+			}
+			outboxPublished.Inc()
+			if err := markPublished(ctx, event, time.Now()); err != nil {
+				rlog.Error("could not mark outbox event published", err, rlog.String("id", event.Id))
+			}
+		}
+		if err != nil || slices.ContainsFunc(published, func(err error) bool { return err != nil }) {
+			// The broker is likely unavailable, the next run retries.
+			return
+		}
+	}
+}
+
+// publishBatch publishes the events in order without waiting for each
+// confirm, then waits for the broker to confirm them. It returns the error of
+// each event, nil when it was confirmed.
+func (r *relay) publishBatch(ctx context.Context, events []Event) []error {
+	errs := make([]error, len(events))
+	channel := r.connection.GetChannel()
+	if channel == nil || channel.IsClosed() {
+		return fillErrors(errs, 0, errors.New("the message bus channel is closed"))
+	}
+	if err := r.confirm(channel); err != nil {
+		return fillErrors(errs, 0, err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, confirmTimeout)
+	defer cancel()
+	confirmations := make([]*amqp091.DeferredConfirmation, 0, len(events))
+	for i, event := range events {
+		confirmation, err := channel.PublishWithDeferredConfirmWithContext(ctx, event.Exchange, event.RoutingKey, false, false, publishing(event))
+		if err != nil {
+			// Later events are not published, so they are not delivered
+			// before the failed one.
+			fillErrors(errs, i, fmt.Errorf("could not publish: %w", err))
+			break
+		}
+		confirmations = append(confirmations, confirmation)
+	}
+	for i, confirmation := range confirmations {
+		acked, err := confirmation.WaitContext(ctx)
+		if err != nil {
+			errs[i] = fmt.Errorf("could not get publisher confirm: %w", err)
+			continue
+		}
+		if !acked {
+			errs[i] = errors.New("the message bus did not accept the event")
+		}
+	}
+	return errs
+}
+
+// fillErrors sets the errors from index from on to err.
+func fillErrors(errs []error, from int, err error) []error {
+	for i := from; i < len(errs); i++ {
+		errs[i] = err
+	}
+	return errs
+}
+
+func (r *relay) confirm(channel *amqp091.Channel) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.confirming == channel {
+		return nil
+	}
+	if err := channel.Confirm(false); err != nil {
+		return fmt.Errorf("could not put the channel in confirm mode: %w", err)
+	}
+	r.confirming = channel
+	return nil
+}
+
+// publishing returns the message of the event. The event id is the message
+// id, consumers de-duplicate redelivered events on it.
+func publishing(event Event) amqp091.Publishing {
+	headers := make(amqp091.Table, len(event.Headers))
+	for key, value := range event.Headers {
+		headers[key] = value
+	}
+	return amqp091.Publishing{
+		Headers:      headers,
+		ContentType:  "application/json",
+		DeliveryMode: amqp091.Persistent,
+		MessageId:    event.Id,
+		Timestamp:    event.CreatedAt,
+		Body:         event.Body,
+	}
+}
+
+// claimBatch takes up to relayBatchSize of the oldest events due for
+// publishing, or whose claim has expired, so a single relay publishes them.
+// The events claimed before an error are returned with it.
+func claimBatch(ctx context.Context, now time.Time) ([]Event, error) {
+	events := make([]Event, 0, relayBatchSize)
+	for len(events) < relayBatchSize {
+		event, err := claim(ctx, now)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return events, nil
+		}
+		if err != nil {
+			return events, err
+		}
+		events = append(events, event)
+	}
+	return events, nil
+}
+
+// claim takes the oldest event due for publishing, or one whose claim has
+// expired, so a single relay publishes it.
+func claim(ctx context.Context, now time.Time) (Event, error) {
+	var event Event
+	err := mongodb.GetMongoDb().Collection(OUTBOXCOLLECTION).FindOneAndUpdate(ctx,
+		bson.M{
+			"publishedat":   nil,
+			"nextattemptat": bson.M{"$lte": now},
+			"claimeduntil":  bson.M{"$lte": now},
+		},
+		bson.M{"$set": bson.M{"claimeduntil": now.Add(claimLease)}},
+		options.FindOneAndUpdate().SetSort(bson.D{{Key: "createdat", Value: 1}}).SetReturnDocument(options.After),
+	).Decode(&event)
+	return event, err
+}
+
+func markPublished(ctx context.Context, event Event, now time.Time) error {
+	_, err := mongodb.GetMongoDb().Collection(OUTBOXCOLLECTION).UpdateOne(ctx,
+		bson.M{"_id": event.Id},
+		bson.M{"$set": bson.M{"publishedat": now}, "$unset": bson.M{"lasterror": ""}},
+	)
+	return err
+}
+
+// release returns a failed event to the outbox, due again after the backoff
+// of its attempts.
+func release(ctx context.Context, event Event, cause error, now time.Time) error {
+	_, err := mongodb.GetMongoDb().Collection(OUTBOXCOLLECTION).UpdateOne(ctx,
+		bson.M{"_id": event.Id},
+		bson.M{
+			"$set": bson.M{
+				"nextattemptat": now.Add(backoff(event.Attempts + 1)),
+				"claimeduntil":  now,
+				"lasterror":     cause.Error(),
+			},
+			"$inc": bson.M{"attempts": 1},
+		},
+	)
+	return err
+}
+
+// backoff returns the delay before the next attempt after the attempts,
+// doubling from minBackoff up to maxBackoff.
+func backoff(attempts int) time.Duration {
+	delay := minBackoff
+	for i := 1; i < attempts && delay < maxBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, maxBackoff)
+}
+
+// updateLag sets the outbox metrics from the events not yet published.
+func updateLag(ctx context.Context) {
+	collection := mongodb.GetMongoDb().Collection(OUTBOXCOLLECTION)
+	pending, err := collection.CountDocuments(ctx, bson.M{"publishedat": nil})
+	if err != nil {
+		rlog.Error("could not count pending outbox events", err)
+		return
+	}
+	outboxPending.Set(float64(pending))
+
+	var oldest Event
+	err = collection.FindOne(ctx, bson.M{"publishedat": nil}, options.FindOne().SetSort(bson.D{{Key: "createdat", Value: 1}})).Decode(&oldest)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		outboxLag.Set(0)
+		return
+	}
+	if err != nil {
+		rlog.Error("could not get oldest pending outbox event", err)
+		return
+	}
+	outboxLag.Set(time.Since(oldest.CreatedAt).Seconds())
+}
@@ -0,0 +1,37 @@
+package outboxservice
+
+import (
+	"testing"
+	"time"
+
+	amqp091 "github.com/rabbitmq/amqp091-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBackoff(t *testing.T) {
+	assert.Equal(t, time.Second, backoff(1))
+	assert.Equal(t, 2*time.Second, backoff(2))
+	assert.Equal(t, 16*time.Second, backoff(5))
+	assert.Equal(t, maxBackoff, backoff(20))
+	assert.Equal(t, maxBackoff, backoff(1000))
+}
+
+func TestPublishing(t *testing.T) {
+	createdAt := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	event := Event{
+		Id:         "4a7e8f0e-5d0b-4c43-9e8a-2f1f1b0c9d11",
+		RoutingKey: "resource.created",
+		Headers:    map[string]string{"apiVersion": "v1", "kind": "Namespace"},
+		Body:       []byte(`{"uid":"1"}`),
+		CreatedAt:  createdAt,
+	}
+
+	message := publishing(event)
+
+	assert.Equal(t, event.Id, message.MessageId)
+	assert.Equal(t, amqp091.Table{"apiVersion": "v1", "kind": "Namespace"}, message.Headers)
+	assert.Equal(t, "application/json", message.ContentType)
+	assert.Equal(t, uint8(amqp091.Persistent), message.DeliveryMode)
+	assert.Equal(t, createdAt, message.Timestamp)
+	assert.Equal(t, event.Body, message.Body)
+}
@@ -114,7 +114,6 @@ func ResourceDeleteService(ctx context.Context, resourceUpdate apiresourcecontra
 		return err
 	}
 
-	//return switchboard.PublishResourceToSwitchboard(ctx, messages.RulesetRuleTypeDeleted, resourceUpdate)
 	return nil
 }
 
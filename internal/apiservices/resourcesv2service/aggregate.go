@@ -0,0 +1,256 @@
+package resourcesv2service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/NorskHelsenett/ror/pkg/helpers/rorerror/v2"
+	"github.com/NorskHelsenett/ror/pkg/rlog"
+	"github.com/NorskHelsenett/ror/pkg/rorresources"
+	"github.com/NorskHelsenett/ror/pkg/telemetry/rortracer"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+type AggregateOperator string
+
+const (
+	AggregateOperatorSum AggregateOperator = "sum"
+	AggregateOperatorMin AggregateOperator = "min"
+	AggregateOperatorMax AggregateOperator = "max"
+	AggregateOperatorAvg AggregateOperator = "avg"
+
+	maxAggregateGroupBy      = 5
+	maxAggregateAggregations = 10
+	defaultAggregateLimit    = 1000
+	maxAggregateLimit        = 10000
+)
+
+var ErrInvalidAggregation = errors.New("invalid aggregation")
+
+// aggregateGroupByFields is the allow-list of the field paths resources can
+// be grouped by.
+var aggregateGroupByFields = map[string]bool{
+	"typemeta.apiversion":      true,
+	"typemeta.kind":            true,
+	"metadata.namespace":       true,
+	"metadata.name":            true,
+	"rormeta.ownerref.scope":   true,
+	"rormeta.ownerref.subject": true,
+	"podresource.status.phase": true,
+}
+
+// aggregateNumericFields is the allow-list of the numeric field paths that
+// can be aggregated.
+var aggregateNumericFields = map[string]bool{
+	"deploymentresource.status.replicas":                       true,
+	"deploymentresource.status.availablereplicas":              true,
+	"deploymentresource.status.readyreplicas":                  true,
+	"deploymentresource.status.updatedreplicas":                true,
+	"vulnerabilityreportresource.report.summary.criticalcount": true,
+	"vulnerabilityreportresource.report.summary.highcount":     true,
+	"vulnerabilityreportresource.report.summary.mediumcount":   true,
+	"vulnerabilityreportresource.report.summary.lowcount":      true,
+	"vulnerabilityreportresource.report.summary.unknowncount":  true,
+}
+
+// ResourceAggregation is an accumulator over a numeric field of the
+// resources in a group.
+type ResourceAggregation struct {
+	Operator AggregateOperator `json:"operator"`
+	Field    string            `json:"field"`
+}
+
+// Name is the key of the aggregation in the group values, operator:field.
+func (a ResourceAggregation) Name() string {
+	return string(a.Operator) + ":" + a.Field
+}
+
+// ResourceAggregateQuery groups the resources matching Query by the GroupBy
+// fields and counts them and computes the aggregations of each group.
+type ResourceAggregateQuery struct {
+	Query        *rorresources.ResourceQuery
+	GroupBy      []string
+	Aggregations []ResourceAggregation
+	// Limit is the maximum number of groups, 0 uses the default.
+	Limit int
+}
+
+// ResourceAggregateResult is the result of an aggregate query, groups are
+// sorted by their key.
+type ResourceAggregateResult struct {
+	GroupBy      []string                 `json:"groupBy"`
+	Aggregations []ResourceAggregation    `json:"aggregations"`
+	Groups       []ResourceAggregateGroup `json:"groups"`
+}
+
+// ResourceAggregateGroup is a group of resources with the same values of the
+// group by fields. Values are keyed by aggregation name and are null when no
+// resource in the group has a numeric value for the field.
+type ResourceAggregateGroup struct {
+	Key    map[string]any      `json:"key"`
+	Count  int64               `json:"count"`
+	Values map[string]*float64 `json:"values,omitempty"`
+}
+
+// ParseResourceAggregation parses an aggregation written as operator:field,
+// e.g. sum:deploymentresource.status.replicas.
+func ParseResourceAggregation(spec string) (ResourceAggregation, error) {
+	operator, field, found := strings.Cut(strings.TrimSpace(spec), ":")
+	if !found {
+		return ResourceAggregation{}, fmt.Errorf("%w: %q is not written as operator:field", ErrInvalidAggregation, spec)
+	}
+	return ResourceAggregation{Operator: AggregateOperator(operator), Field: field}, nil
+}
+
+// Validate checks the group by fields and aggregations against the allow-list
+// of field paths and the limits of an aggregate query.
+func (q *ResourceAggregateQuery) Validate() error {
+	if q.Query == nil {
+		return fmt.Errorf("%w: empty resource query", ErrInvalidAggregation)
+	}
+	if len(q.GroupBy) > maxAggregateGroupBy {
+		return fmt.Errorf("%w: at most %d group by fields are allowed", ErrInvalidAggregation, maxAggregateGroupBy)
+	}
+	if len(q.Aggregations) > maxAggregateAggregations {
+		return fmt.Errorf("%w: at most %d aggregations are allowed", ErrInvalidAggregation, maxAggregateAggregations)
+	}
+	if q.Limit < 0 {
+		return fmt.Errorf("%w: limit must not be negative", ErrInvalidAggregation)
+	}
+	for _, field := range q.GroupBy {
+		if !aggregateGroupByFields[field] {
+			return fmt.Errorf("%w: field %q can not be grouped by", ErrInvalidAggregation, field)
+		}
+	}
+	for _, aggregation := range q.Aggregations {
+		switch aggregation.Operator {
+		case AggregateOperatorSum, AggregateOperatorMin, AggregateOperatorMax, AggregateOperatorAvg:
+		default:
+			return fmt.Errorf("%w: unknown operator %q", ErrInvalidAggregation, aggregation.Operator)
+		}
+		if !aggregateNumericFields[aggregation.Field] {
+			return fmt.Errorf("%w: field %q can not be aggregated", ErrInvalidAggregation, aggregation.Field)
+		}
+	}
+	return nil
+}
+
+// AggregateResources groups and aggregates the resources matching the query
+// that the caller is authorized to read.
+func AggregateResources(ctx context.Context, aggregateQuery *ResourceAggregateQuery) (*ResourceAggregateResult, error) {
+	ctx, span := rortracer.StartSpan(ctx, "v2.resourcesv2service.AggregateResources")
+	defer span.End()
+
+	if err := aggregateQuery.Validate(); err != nil {
+		rortracer.SpanError(span, err, "invalid aggregate query")
+		return nil, rorerror.NewRorErrorFromError(400, err)
+	}
+
+	databaseHelpers := newResourceDB(getMongoConnection())
+	mongoCtx, cancel := context.WithTimeout(ctx, getTimeout)
+	defer cancel()
+
+	queryStart := time.Now()
+	result, err := databaseHelpers.Aggregate(mongoCtx, aggregateQuery)
+	if err != nil {
+		rortracer.SpanError(span, err, "could not aggregate resources")
+		return nil, fmt.Errorf("could not aggregate resources: %w", err)
+	}
+	if elapsed := time.Since(queryStart); elapsed > slowQueryDuration {
+		rlog.Warn("Slow query detected in AggregateResources", rlog.Any("duration", elapsed))
+	}
+
+	rortracer.SpanOk(span)
+	span.SetAttributes(attribute.Int("groups.count", len(result.Groups)))
+	return result, nil
+}
+
+// generateGroupStages builds the stages grouping the matched resources. Group
+// by fields and aggregations are stored under positional names, as field
+// paths can not be used as names in a $group.
+func generateGroupStages(aggregateQuery *ResourceAggregateQuery) []bson.M {
+	// bson.D keeps the group by order, which decides the sort order of groups.
+	groupID := bson.D{}
+	for i, field := range aggregateQuery.GroupBy {
+		groupID = append(groupID, bson.E{Key: "g" + strconv.Itoa(i), Value: "$" + field})
+	}
+
+	group := bson.M{"_id": groupID, "count": bson.M{"$sum": 1}}
+	for i, aggregation := range aggregateQuery.Aggregations {
+		// Only numeric values are aggregated, $sum and $avg skip other
+		// values but $min and $max would compare across types.
+		value := bson.M{"$cond": bson.A{bson.M{"$isNumber": "$" + aggregation.Field}, "$" + aggregation.Field, nil}}
+		group["a"+strconv.Itoa(i)] = bson.M{"$" + string(aggregation.Operator): value}
+	}
+
+	limit := aggregateQuery.Limit
+	if limit == 0 {
+		limit = defaultAggregateLimit
+	} else if limit > maxAggregateLimit {
+		limit = maxAggregateLimit
+	}
+
+	return []bson.M{
+		{"$group": group},
+		{"$sort": bson.D{{Key: "_id", Value: 1}}},
+		{"$limit": limit},
+	}
+}
+
+// aggregateGroupFromDoc converts a document produced by the group stages.
+func aggregateGroupFromDoc(aggregateQuery *ResourceAggregateQuery, doc bson.M) ResourceAggregateGroup {
+	group := ResourceAggregateGroup{Key: make(map[string]any, len(aggregateQuery.GroupBy))}
+
+	var groupID bson.M
+	switch id := doc["_id"].(type) {
+	case bson.M:
+		groupID = id
+	case bson.D:
+		groupID = dToM(id)
+	}
+	for i, field := range aggregateQuery.GroupBy {
+		group.Key[field] = groupID["g"+strconv.Itoa(i)]
+	}
+	if count := toFloat(doc["count"]); count != nil {
+		group.Count = int64(*count)
+	}
+	if len(aggregateQuery.Aggregations) > 0 {
+		group.Values = make(map[string]*float64, len(aggregateQuery.Aggregations))
+		for i, aggregation := range aggregateQuery.Aggregations {
+			group.Values[aggregation.Name()] = toFloat(doc["a"+strconv.Itoa(i)])
+		}
+	}
+	return group
+}
+
+// toFloat converts a numeric BSON value, it returns nil for other values.
+func toFloat(value any) *float64 {
+	var f float64
+	switch v := value.(type) {
+	case int32:
+		f = float64(v)
+	case int64:
+		f = float64(v)
+	case float64:
+		f = v
+	case bson.Decimal128:
+		parsed, err := strconv.ParseFloat(v.String(), 64)
+		if err != nil {
+			return nil
+		}
+		f = parsed
+	default:
+		return nil
+	}
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return nil
+	}
+	return &f
+}
@@ -0,0 +1,68 @@
+package resourcesv2service
+
+import (
+	"testing"
+
+	"github.com/NorskHelsenett/ror/pkg/rorresources"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+func TestResourceAggregateQueryValidate(t *testing.T) {
+	tests := []struct {
+		name         string
+		groupBy      []string
+		aggregations []string
+		wantErr      bool
+	}{
+		{name: "count only", groupBy: []string{"metadata.namespace", "rormeta.ownerref.subject"}},
+		{name: "all operators", aggregations: []string{"sum:deploymentresource.status.replicas", "min:deploymentresource.status.replicas", "max:deploymentresource.status.replicas", "avg:deploymentresource.status.replicas"}},
+		{name: "unlisted group by field", groupBy: []string{"metadata.annotations"}, wantErr: true},
+		{name: "unlisted numeric field", aggregations: []string{"sum:metadata.name"}, wantErr: true},
+		{name: "internal field", groupBy: []string{"_resourceversion"}, wantErr: true},
+		{name: "expression", groupBy: []string{"$where"}, wantErr: true},
+		{name: "operator in path", aggregations: []string{"sum:deploymentresource.status.$gt"}, wantErr: true},
+		{name: "unknown operator", aggregations: []string{"median:deploymentresource.status.replicas"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query := &ResourceAggregateQuery{Query: rorresources.NewResourceQuery(), GroupBy: tt.groupBy}
+			for _, spec := range tt.aggregations {
+				aggregation, err := ParseResourceAggregation(spec)
+				require.NoError(t, err)
+				query.Aggregations = append(query.Aggregations, aggregation)
+			}
+			err := query.Validate()
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrInvalidAggregation)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestAggregateGroupFromDoc(t *testing.T) {
+	query := &ResourceAggregateQuery{
+		GroupBy: []string{"metadata.namespace"},
+		Aggregations: []ResourceAggregation{
+			{Operator: AggregateOperatorSum, Field: "status.restarts"},
+			{Operator: AggregateOperatorAvg, Field: "status.cpu"},
+		},
+	}
+
+	group := aggregateGroupFromDoc(query, bson.M{
+		"_id":   bson.D{{Key: "g0", Value: "kube-system"}},
+		"count": int32(4),
+		"a0":    int64(7),
+		"a1":    nil,
+	})
+
+	assert.Equal(t, map[string]any{"metadata.namespace": "kube-system"}, group.Key)
+	assert.Equal(t, int64(4), group.Count)
+	require.NotNil(t, group.Values["sum:status.restarts"])
+	assert.Equal(t, 7.0, *group.Values["sum:status.restarts"])
+	assert.Nil(t, group.Values["avg:status.cpu"])
+}
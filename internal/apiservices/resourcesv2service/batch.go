@@ -0,0 +1,238 @@
+package resourcesv2service
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/NorskHelsenett/ror-api/internal/acl/aclservice"
+
+	"github.com/NorskHelsenett/ror/pkg/models/aclmodels"
+	"github.com/NorskHelsenett/ror/pkg/rlog"
+	"github.com/NorskHelsenett/ror/pkg/rorresources"
+	"github.com/NorskHelsenett/ror/pkg/rorresources/rortypes"
+	"github.com/NorskHelsenett/ror/pkg/telemetry/rortracer"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// MaxBatchSize is the maximum number of resources accepted in one batch.
+const MaxBatchSize = 5000
+
+// batchChunkSize is the number of resources of a batch written in one
+// transaction.
+const batchChunkSize = 100
+
+// batchItem tracks a resource through a batch write.
+type batchItem struct {
+	resource *rorresources.Resource
+	delete   bool
+}
+
+// HandleResourceBatch writes a set of resources in bulk operations of
+// batchChunkSize resources. Access is checked once per distinct ownerref, and
+// every resource gets its own result so a single bad item does not fail the
+// whole batch. The versions of the written resources are returned with the
+// results.
+func HandleResourceBatch(ctx context.Context, resourceSet *rorresources.ResourceSet) ResourceWriteResults {
+	ctx, span := rortracer.StartSpan(ctx, "v2.resourcesv2service.HandleResourceBatch")
+	defer span.End()
+
+	results := ResourceWriteResults{
+		ResourceUpdateResults: rorresources.ResourceUpdateResults{
+			Results: make(map[string]rorresources.ResourceUpdateResult, len(resourceSet.Resources)),
+		},
+		Versions: make(map[string]int64),
+	}
+	span.SetAttributes(attribute.Int("resources.count", len(resourceSet.Resources)))
+
+	access := make(map[string]aclmodels.AclV2ListItemAccess)
+	items := make([]batchItem, 0, len(resourceSet.Resources))
+	for _, resource := range resourceSet.Resources {
+		uid := resource.GetUID()
+		// Results are keyed by uid, so only the first occurrence of a uid is
+		// written and reported.
+		if _, exists := results.Results[uid]; exists {
+			rlog.Warnc(ctx, "Duplicate uid in batch, skipping", rlog.String("uid", uid))
+			continue
+		}
+
+		ownerref := resource.GetRorMeta().Ownerref
+		ownerrefKey := string(ownerref.Scope) + "/" + string(ownerref.Subject)
+		accessObject, checked := access[ownerrefKey]
+		if !checked {
+			accessObject = aclservice.CheckAccessByRorOwnerref(ctx, ownerref)
+			access[ownerrefKey] = accessObject
+		}
+
+		item := batchItem{resource: resource}
+		switch resource.GetRorMeta().Action {
+		case rortypes.K8sActionAdd, rortypes.K8sActionUpdate:
+			if !accessObject.Create {
+				results.Results[uid] = rorresources.ResourceUpdateResult{Status: http.StatusForbidden, Message: "403: No access"}
+				continue
+			}
+			normalizeOwnerref(ctx, resource)
+			if err := resource.ApplyInputFilter(); err != nil {
+				results.Results[uid] = rorresources.ResourceUpdateResult{Status: http.StatusBadRequest, Message: "400: Could not apply filter to resource"}
+				continue
+			}
+		case rortypes.K8sActionDelete:
+			if !accessObject.Update {
+				results.Results[uid] = rorresources.ResourceUpdateResult{Status: http.StatusForbidden, Message: "403: No access"}
+				continue
+			}
+			item.delete = true
+		default:
+			results.Results[uid] = rorresources.ResourceUpdateResult{Status: http.StatusBadRequest, Message: "400: Unknown action"}
+			continue
+		}
+
+		// Reserve the uid so later duplicates are skipped.
+		results.Results[uid] = rorresources.ResourceUpdateResult{}
+		items = append(items, item)
+	}
+	span.SetAttributes(attribute.Int("acl.ownerrefs", len(access)))
+	span.AddEvent("access checked")
+
+	if len(items) == 0 {
+		rortracer.SpanOk(span)
+		return results
+	}
+
+	databaseHelpers := newResourceDB(getMongoConnection())
+	for start := 0; start < len(items); start += batchChunkSize {
+		chunk := items[start:min(start+batchChunkSize, len(items))]
+		writeResults, err := writeBatchChunk(ctx, databaseHelpers, chunk)
+		if err != nil {
+			// A failing write aborts the transaction of the whole chunk, so
+			// the items are written one by one and only the failing ones
+			// fail.
+			rlog.Warnc(ctx, "Failed to bulk write resources, writing them one by one", rlog.String("error", err.Error()), rlog.Int("resources", len(chunk)))
+			writeResults = make([]ResourceBulkResult, len(chunk))
+			for i := range chunk {
+				itemResults, err := writeBatchChunk(ctx, databaseHelpers, chunk[i:i+1])
+				if err != nil {
+					writeResults[i].Err = err
+					continue
+				}
+				writeResults[i] = itemResults[0]
+			}
+		}
+		reportBatchChunk(ctx, chunk, writeResults, &results)
+	}
+	span.AddEvent("bulk write complete")
+
+	rortracer.SpanOk(span)
+	return results
+}
+
+// writeBatchChunk writes the items, their watch events and their message bus
+// events in the outbox in one transaction.
+func writeBatchChunk(ctx context.Context, databaseHelpers ResourceDBProvider, items []batchItem) ([]ResourceBulkResult, error) {
+	operations := make([]ResourceBulkOperation, len(items))
+	for i, item := range items {
+		operations[i] = ResourceBulkOperation{Resource: item.resource, Delete: item.delete}
+	}
+
+	mongoCtx, cancel := context.WithTimeout(ctx, setTimeout)
+	defer cancel()
+
+	var writeResults []ResourceBulkResult
+	err := runVersioned(mongoCtx, func(ctx context.Context) error {
+		var err error
+		writeResults, err = databaseHelpers.BulkWrite(ctx, operations)
+		if err != nil {
+			return err
+		}
+		if err := recordBatchWatchEvents(ctx, items, writeResults); err != nil {
+			return err
+		}
+		return enqueueBatch(ctx, items, writeResults)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return writeResults, nil
+}
+
+// reportBatchChunk sets the results of the written items and publishes them.
+func reportBatchChunk(ctx context.Context, items []batchItem, writeResults []ResourceBulkResult, results *ResourceWriteResults) {
+	written := make([]batchItem, 0, len(items))
+	for i, item := range items {
+		uid := item.resource.GetUID()
+		if writeResults[i].Err != nil {
+			rlog.Errorc(ctx, "Failed to write resource in batch", writeResults[i].Err, rlog.String("uid", uid))
+			results.Results[uid] = rorresources.ResourceUpdateResult{
+				Status:  http.StatusInternalServerError,
+				Message: "500: Could not write resource",
+			}
+			continue
+		}
+
+		if item.delete {
+			results.Results[uid] = rorresources.ResourceUpdateResult{Status: http.StatusAccepted, Message: "202: Resource deleted"}
+		} else {
+			results.Results[uid] = rorresources.ResourceUpdateResult{Status: http.StatusAccepted, Message: writeMessage(writeResults[i].ResourceWriteResult)}
+			results.Versions[uid] = writeResults[i].Version
+		}
+		written = append(written, item)
+	}
+
+	publishBatch(ctx, written)
+}
+
+// recordBatchWatchEvents records the watch events of the written items of a
+// batch.
+func recordBatchWatchEvents(ctx context.Context, items []batchItem, writeResults []ResourceBulkResult) error {
+	events := make([]watchEventInput, 0, len(items))
+	for i, item := range items {
+		if writeResults[i].Err != nil {
+			continue
+		}
+		doc, err := resourceToDoc(ctx, item.resource)
+		if err != nil {
+			return err
+		}
+		eventType := WatchEventModified
+		switch {
+		case item.delete:
+			eventType = WatchEventDeleted
+		case writeResults[i].Created:
+			eventType = WatchEventAdded
+		}
+		if !item.delete {
+			doc[resourceVersionField] = writeResults[i].Version
+		}
+		events = append(events, watchEventInput{eventType: eventType, doc: doc})
+	}
+	return recordWatchEvents(ctx, events)
+}
+
+// enqueueBatch stores the message bus events of the written items of a batch
+// in the outbox.
+func enqueueBatch(ctx context.Context, items []batchItem, writeResults []ResourceBulkResult) error {
+	for i, item := range items {
+		if writeResults[i].Err != nil {
+			continue
+		}
+		if err := enqueueResourceEvent(ctx, item.resource, batchAction(item)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// publishBatch sends the events of a written batch to the v2 event servers
+// once the database write has completed.
+func publishBatch(ctx context.Context, items []batchItem) {
+	for _, item := range items {
+		publishResourceEvent(ctx, item.resource, batchAction(item))
+	}
+}
+
+func batchAction(item batchItem) rortypes.ResourceAction {
+	if item.delete {
+		return rortypes.K8sActionDelete
+	}
+	return item.resource.GetRorMeta().Action
+}
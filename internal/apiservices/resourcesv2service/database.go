@@ -4,11 +4,12 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"strconv"
+	"slices"
 	"strings"
 	"time"
 
 	"github.com/NorskHelsenett/ror-api/internal/acl/aclservice"
+	"github.com/NorskHelsenett/ror-api/pkg/helpers/rorqueryfilter"
 	"github.com/NorskHelsenett/ror/pkg/apicontracts/apiresourcecontracts"
 	"github.com/NorskHelsenett/ror/pkg/context/rorcontext"
 	"github.com/NorskHelsenett/ror/pkg/helpers/rorerror/v2"
@@ -18,6 +19,7 @@ import (
 	"github.com/NorskHelsenett/ror/pkg/rorresources/rordefs"
 	"github.com/NorskHelsenett/ror/pkg/rorresources/rortypes"
 	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
 	"go.mongodb.org/mongo-driver/v2/mongo/options"
 
 	"github.com/NorskHelsenett/ror/pkg/clients/mongodb"
@@ -25,16 +27,47 @@ import (
 
 const (
 	RESOURCECOLLECTION = "resourcesv2"
+	// PendingPurgeField marks the resources of a cluster pending purge, they
+	// are hidden from reads. The mark is kept when a resource is written again
+	// by its agent.
+	PendingPurgeField = "_pendingpurge"
 )
 
 type ResourceDBProvider interface {
 	Set(ctx context.Context, resource *rorresources.Resource) error
+	Upsert(ctx context.Context, resource *rorresources.Resource) (ResourceWriteResult, error)
+	BulkWrite(ctx context.Context, operations []ResourceBulkOperation) ([]ResourceBulkResult, error)
 	Patch(ctx context.Context, uid string, partial *rorresources.Resource) error
+	PatchWithVersion(ctx context.Context, uid string, partial *rorresources.Resource, expected *int64) (int64, error)
+	GetVersion(ctx context.Context, uid string) (int64, error)
+	BumpVersion(ctx context.Context, uid string, expected *int64) (int64, error)
 	Get(ctx context.Context, rorResourceQuery *rorresources.ResourceQuery) (*rorresources.ResourceSet, error)
+	GetPage(ctx context.Context, rorResourceQuery *rorresources.ResourceQuery, cursor *ResourceCursor, pageSize int) (*rorresources.ResourceSet, *ResourceCursor, error)
+	Count(ctx context.Context, rorResourceQuery *rorresources.ResourceQuery) (int64, bool, error)
+	Aggregate(ctx context.Context, aggregateQuery *ResourceAggregateQuery) (*ResourceAggregateResult, error)
 	Del(ctx context.Context, resource *rorresources.Resource) error
 	GetHashlistByQuery(ctx context.Context, rorResourceQuery *rorresources.ResourceQuery) (apiresourcecontracts.HashList, error)
 }
 
+// ResourceBulkOperation is a single write in a bulk write, either an upsert
+// of the resource or, when Delete is set, a delete by uid.
+type ResourceBulkOperation struct {
+	Resource *rorresources.Resource
+	Delete   bool
+}
+
+// ResourceWriteResult is the outcome of a successful resource write.
+type ResourceWriteResult struct {
+	Created bool
+	Version int64
+}
+
+// ResourceBulkResult is the outcome of a single bulk write operation.
+type ResourceBulkResult struct {
+	ResourceWriteResult
+	Err error
+}
+
 // Mongodb implementation of ResourceDBProvider
 
 type ResourceMongoDB struct {
@@ -46,61 +79,340 @@ func NewResourceMongoDB(db *mongodb.MongodbCon) ResourceDBProvider {
 }
 
 func (r *ResourceMongoDB) Set(ctx context.Context, resource *rorresources.Resource) error {
+	_, err := r.Upsert(ctx, resource)
+	return err
+}
+
+// Upsert replaces the stored document for the resource, keeping its pending
+// purge mark, inserting it if it does not exist. It reports whether a new document was created and the new
+// resource version. For kinds that keep history the replaced document is
+// stored in the history collection.
+func (r *ResourceMongoDB) Upsert(ctx context.Context, resource *rorresources.Resource) (ResourceWriteResult, error) {
 	uid := resource.GetUID()
 	filter := bson.M{"uid": uid}
 
+	doc, err := resourceToDoc(ctx, resource)
+	if err != nil {
+		return ResourceWriteResult{}, err
+	}
+	version, err := NextResourceVersion(ctx)
+	if err != nil {
+		return ResourceWriteResult{}, err
+	}
+	now := time.Now()
+	doc[resourceVersionField] = version
+	doc[resourceUpdatedField] = now
+
+	collection := r.db.GetMongoDb().Collection(RESOURCECOLLECTION)
+	if !historyEnabled(resource.GetKind()) {
+		opts := options.UpdateOne().SetUpsert(true)
+		result, err := collection.UpdateOne(ctx, filter, replaceKeepingPurgeMark(doc), opts)
+		if err != nil {
+			rlog.Errorc(ctx, "Failed to upsert resource", err)
+			return ResourceWriteResult{}, err
+		}
+		return ResourceWriteResult{Created: result.UpsertedCount > 0, Version: version}, nil
+	}
+
+	var previous bson.M
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.Before)
+	err = collection.FindOneAndUpdate(ctx, filter, replaceKeepingPurgeMark(doc), opts).Decode(&previous)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return ResourceWriteResult{Created: true, Version: version}, nil
+	}
+	if err != nil {
+		rlog.Errorc(ctx, "Failed to upsert resource", err)
+		return ResourceWriteResult{}, err
+	}
+	recordHistory(ctx, previous, WatchEventModified, now)
+	return ResourceWriteResult{Version: version}, nil
+}
+
+// BulkWrite applies the operations in a single unordered MongoDB bulk write.
+// The returned results are indexed like operations, so one failing write does
+// not hide the outcome of the others. An error is only returned when the bulk
+// write as a whole could not be executed.
+func (r *ResourceMongoDB) BulkWrite(ctx context.Context, operations []ResourceBulkOperation) ([]ResourceBulkResult, error) {
+	results := make([]ResourceBulkResult, len(operations))
+	if len(operations) == 0 {
+		return results, nil
+	}
+
+	// Documents are converted before versions are reserved, so a resource
+	// that can not be stored does not take a version no event is recorded for.
+	docs := make([]bson.M, len(operations))
+	upserts := 0
+	for i, operation := range operations {
+		if operation.Delete {
+			continue
+		}
+		doc, err := resourceToDoc(ctx, operation.Resource)
+		if err != nil {
+			results[i].Err = err
+			continue
+		}
+		docs[i] = doc
+		upserts++
+	}
+	var version int64
+	if upserts > 0 {
+		last, err := reserveResourceVersions(ctx, upserts)
+		if err != nil {
+			return nil, err
+		}
+		version = last - int64(upserts)
+	}
+	previous := r.findHistoryDocs(ctx, operations)
+	now := time.Now()
+
+	models := make([]mongo.WriteModel, 0, len(operations))
+	indexes := make([]int, 0, len(operations))
+	for i, operation := range operations {
+		filter := bson.M{"uid": operation.Resource.GetUID()}
+		if operation.Delete {
+			models = append(models, mongo.NewDeleteOneModel().SetFilter(filter))
+			indexes = append(indexes, i)
+			continue
+		}
+		doc := docs[i]
+		if doc == nil {
+			continue
+		}
+		version++
+		doc[resourceVersionField] = version
+		doc[resourceUpdatedField] = now
+		results[i].Version = version
+		models = append(models, mongo.NewUpdateOneModel().SetFilter(filter).SetUpdate(replaceKeepingPurgeMark(doc)).SetUpsert(true))
+		indexes = append(indexes, i)
+	}
+	if len(models) == 0 {
+		return results, nil
+	}
+
+	opts := options.BulkWrite().SetOrdered(false)
+	result, err := r.db.GetMongoDb().Collection(RESOURCECOLLECTION).BulkWrite(ctx, models, opts)
+	if err != nil {
+		bulkErr, ok := errors.AsType[mongo.BulkWriteException](err)
+		if !ok {
+			rlog.Errorc(ctx, "Failed to bulk write resources", err)
+			return nil, err
+		}
+		for _, writeErr := range bulkErr.WriteErrors {
+			results[indexes[writeErr.Index]].Err = writeErr
+		}
+	}
+	if result != nil {
+		for modelIndex := range result.UpsertedIDs {
+			results[indexes[modelIndex]].Created = true
+		}
+	}
+	failed := make([]int64, 0)
+	for _, result := range results {
+		if result.Err != nil && result.Version > 0 {
+			failed = append(failed, result.Version)
+		}
+	}
+	skipResourceVersions(ctx, failed...)
+
+	for i, operation := range operations {
+		doc, ok := previous[operation.Resource.GetUID()]
+		if !ok || results[i].Err != nil {
+			continue
+		}
+		if operation.Delete {
+			recordHistory(ctx, doc, WatchEventDeleted, now)
+		} else {
+			recordHistory(ctx, doc, WatchEventModified, now)
+		}
+	}
+	return results, nil
+}
+
+// findHistoryDocs returns the stored documents, keyed by uid, of the
+// operations whose kind keeps history, so they can be recorded once the bulk
+// write has replaced them.
+func (r *ResourceMongoDB) findHistoryDocs(ctx context.Context, operations []ResourceBulkOperation) map[string]bson.M {
+	uids := make([]string, 0)
+	for _, operation := range operations {
+		if historyEnabled(operation.Resource.GetKind()) {
+			uids = append(uids, operation.Resource.GetUID())
+		}
+	}
+	if len(uids) == 0 {
+		return nil
+	}
+
+	var docs []bson.M
+	cursor, err := r.db.GetMongoDb().Collection(RESOURCECOLLECTION).Find(ctx, bson.M{"uid": bson.M{"$in": uids}})
+	if err == nil {
+		err = cursor.All(ctx, &docs)
+	}
+	if err != nil {
+		rlog.Errorc(ctx, "could not read resources for history", err)
+		return nil
+	}
+
+	previous := make(map[string]bson.M, len(docs))
+	for _, doc := range docs {
+		if uid, ok := doc["uid"].(string); ok {
+			previous[uid] = doc
+		}
+	}
+	return previous
+}
+
+// resourceToDoc converts a resource to the document stored in the
+// resourcesv2 collection.
+func resourceToDoc(ctx context.Context, resource *rorresources.Resource) (bson.M, error) {
 	data, err := bson.Marshal(resource)
 	if err != nil {
 		rlog.Errorc(ctx, "Failed to marshal resource", err)
-		return err
+		return nil, err
 	}
 	var doc bson.M
 	if err := bson.Unmarshal(data, &doc); err != nil {
 		rlog.Errorc(ctx, "Failed to unmarshal resource", err)
-		return err
+		return nil, err
 	}
-	doc["uid"] = uid
+	doc["uid"] = resource.GetUID()
+	return doc, nil
+}
 
-	opts := options.Replace().SetUpsert(true)
-	_, err = r.db.GetMongoDb().Collection(RESOURCECOLLECTION).ReplaceOne(ctx, filter, doc, opts)
-	if err != nil {
-		rlog.Errorc(ctx, "Failed to upsert resource", err)
-		return err
-	}
-	return nil
+// replaceKeepingPurgeMark returns the update replacing a stored resource with
+// doc. Unlike a replace it keeps the pending purge mark of the stored
+// resource, so a cluster pending purge stays hidden while its agent reports.
+// doc is a literal, values starting with $ are not read as field paths.
+func replaceKeepingPurgeMark(doc bson.M) mongo.Pipeline {
+	return mongo.Pipeline{{{Key: "$replaceWith", Value: bson.M{"$mergeObjects": bson.A{
+		bson.M{"$literal": doc},
+		bson.M{"_id": "$_id", PendingPurgeField: "$" + PendingPurgeField},
+	}}}}}
 }
 
 // Patch applies a partial update to an existing resource using MongoDB $set
 // with flattened dot-notation keys. Only non-nil fields present in the partial
 // resource are updated; all other fields in the stored document are preserved.
 func (r *ResourceMongoDB) Patch(ctx context.Context, uid string, partial *rorresources.Resource) error {
+	_, err := r.PatchWithVersion(ctx, uid, partial, nil)
+	return err
+}
+
+// PatchWithVersion applies a partial update like Patch and advances the
+// resource version. When expected is set the update only applies if the
+// stored version still equals it, otherwise ErrResourceVersionConflict is
+// returned. It returns the resource version after the patch.
+func (r *ResourceMongoDB) PatchWithVersion(ctx context.Context, uid string, partial *rorresources.Resource, expected *int64) (int64, error) {
 	data, err := bson.Marshal(partial)
 	if err != nil {
 		rlog.Errorc(ctx, "Failed to marshal partial resource", err)
-		return err
+		return 0, err
 	}
 	var doc bson.M
 	if err := bson.Unmarshal(data, &doc); err != nil {
 		rlog.Errorc(ctx, "Failed to unmarshal partial resource", err)
-		return err
+		return 0, err
 	}
 
-	filter := bson.M{"uid": uid}
 	flatDoc := bson.M{}
 	flattenBsonM("", doc, flatDoc)
 	if len(flatDoc) == 0 {
-		return nil
+		if expected != nil {
+			return *expected, nil
+		}
+		return r.GetVersion(ctx, uid)
+	}
+
+	version, err := NextResourceVersion(ctx)
+	if err != nil {
+		return 0, err
 	}
+	now := time.Now()
+	flatDoc[resourceVersionField] = version
+	flatDoc[resourceUpdatedField] = now
+
+	var previous bson.M
 	update := bson.M{"$set": flatDoc}
-	result, err := r.db.GetMongoDb().Collection(RESOURCECOLLECTION).UpdateOne(ctx, filter, update)
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.Before)
+	err = r.db.GetMongoDb().Collection(RESOURCECOLLECTION).FindOneAndUpdate(ctx, resourceVersionFilter(uid, expected), update, opts).Decode(&previous)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return 0, r.missedVersionedWrite(ctx, uid, expected)
+	}
 	if err != nil {
 		rlog.Errorc(ctx, "Failed to patch resource", err)
-		return err
+		return 0, err
+	}
+	recordHistory(ctx, previous, WatchEventModified, now)
+	return version, nil
+}
+
+// GetVersion returns the stored resource version of the resource with the
+// given uid. Documents written before versioning was introduced have version
+// 0. It does not perform any access check.
+func (r *ResourceMongoDB) GetVersion(ctx context.Context, uid string) (int64, error) {
+	var doc struct {
+		Version int64 `bson:"_resourceversion"`
+	}
+	opts := options.FindOne().SetProjection(bson.M{resourceVersionField: 1})
+	err := r.db.GetMongoDb().Collection(RESOURCECOLLECTION).FindOne(ctx, bson.M{"uid": uid}, opts).Decode(&doc)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return 0, fmt.Errorf("resource with uid %s not found: %w", uid, ErrResourceNotFound)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return doc.Version, nil
+}
+
+// BumpVersion advances the resource version of the resource with the given
+// uid without changing its content. When expected is set the version is only
+// advanced if the stored version still equals it.
+func (r *ResourceMongoDB) BumpVersion(ctx context.Context, uid string, expected *int64) (int64, error) {
+	version, err := NextResourceVersion(ctx)
+	if err != nil {
+		return 0, err
+	}
+	update := bson.M{"$set": bson.M{resourceVersionField: version}}
+	result, err := r.db.GetMongoDb().Collection(RESOURCECOLLECTION).UpdateOne(ctx, resourceVersionFilter(uid, expected), update)
+	if err != nil {
+		rlog.Errorc(ctx, "Failed to update resource version", err)
+		return 0, err
 	}
 	if result.MatchedCount == 0 {
-		return fmt.Errorf("resource with uid %s not found", uid)
+		return 0, r.missedVersionedWrite(ctx, uid, expected)
 	}
-	return nil
+	return version, nil
+}
+
+// missedVersionedWrite explains why a versioned write matched no document,
+// either the resource does not exist or its version has changed.
+func (r *ResourceMongoDB) missedVersionedWrite(ctx context.Context, uid string, expected *int64) error {
+	if expected == nil {
+		return fmt.Errorf("resource with uid %s not found: %w", uid, ErrResourceNotFound)
+	}
+	count, err := r.db.GetMongoDb().Collection(RESOURCECOLLECTION).CountDocuments(ctx, bson.M{"uid": uid})
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return fmt.Errorf("resource with uid %s not found: %w", uid, ErrResourceNotFound)
+	}
+	return fmt.Errorf("resource with uid %s: %w", uid, ErrResourceVersionConflict)
+}
+
+// resourceVersionFilter matches the resource with the given uid, and when
+// expected is set, only while it still has that version. Version 0 also
+// matches documents written before versioning was introduced.
+func resourceVersionFilter(uid string, expected *int64) bson.M {
+	filter := bson.M{"uid": uid}
+	if expected == nil {
+		return filter
+	}
+	if *expected == 0 {
+		filter[resourceVersionField] = bson.M{"$in": bson.A{int64(0), nil}}
+		return filter
+	}
+	filter[resourceVersionField] = *expected
+	return filter
 }
 
 // flattenBsonM recursively flattens a bson.M into dot-notation keys for use
@@ -213,6 +525,129 @@ func (r *ResourceMongoDB) Get(ctx context.Context, rorResourceQuery *rorresource
 	if time.Since(queryStart) > slowQueryDuration*2 {
 		rlog.Warn("Slow query detected in ResourceMongoDB.Get", rlog.Any("query", query), rlog.Any("duration", time.Since(queryStart)))
 	}
+	resourceSet := resourceSetFromRawDocs(ctx, rawDocs)
+	if len(resourceSet.Resources) > 0 {
+		return resourceSet, nil
+	}
+
+	return nil, nil
+}
+
+// GetPage returns up to pageSize resources matching the query sorted after
+// the cursor, or from the start when the cursor is nil, and the cursor of the
+// next page if there are more resources. The query offset only applies to the
+// first page.
+func (r *ResourceMongoDB) GetPage(ctx context.Context, rorResourceQuery *rorresources.ResourceQuery, cursor *ResourceCursor, pageSize int) (*rorresources.ResourceSet, *ResourceCursor, error) {
+	keys := sortKeys(rorResourceQuery)
+
+	// The sort keys of the last resource must survive the projection to
+	// build the next cursor.
+	pageQuery := *rorResourceQuery
+	if len(pageQuery.Fields) != 0 {
+		pageQuery.Fields = slices.Clone(pageQuery.Fields)
+		for _, key := range keys {
+			pageQuery.Fields = append(pageQuery.Fields, key.field)
+		}
+	}
+
+	query, err := generateSortedQuery(ctx, &pageQuery, keys, cursor)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not generate aggregate query: %w", err)
+	}
+	if cursor == nil && pageQuery.Offset > 0 {
+		query = append(query, bson.M{"$skip": pageQuery.Offset})
+	}
+	// Read one resource more than the page size to know if there is a next page.
+	query = append(query, bson.M{"$limit": pageSize + 1})
+
+	var rawDocs []bson.Raw
+	err = r.db.Aggregate(ctx, RESOURCECOLLECTION, query, &rawDocs)
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			rlog.Errorc(ctx, "Query timed out in ResourceMongoDB.GetPage", err, rlog.Any("query", query))
+			return nil, nil, fmt.Errorf("query timed out: %w", err)
+		}
+		return nil, nil, rorerror.NewRorErrorFromError(500, fmt.Errorf("could not execute aggregate query: %w", err))
+	}
+
+	var next *ResourceCursor
+	if len(rawDocs) > pageSize {
+		rawDocs = rawDocs[:pageSize]
+		next, err = cursorFromRawDoc(rawDocs[len(rawDocs)-1], keys)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return resourceSetFromRawDocs(ctx, rawDocs), next, nil
+}
+
+// Count returns the number of resources matching the query that the caller
+// may read. When the query matches the whole collection the count is the
+// collection estimate, which is reported as estimated.
+func (r *ResourceMongoDB) Count(ctx context.Context, rorResourceQuery *rorresources.ResourceQuery) (int64, bool, error) {
+	query, err := generateMatchQuery(ctx, rorResourceQuery)
+	if err != nil {
+		return 0, false, err
+	}
+
+	// A single $match of only the pending purge exclusion means no ACL
+	// restriction and no conditions. The estimate includes the resources
+	// pending purge.
+	if match, ok := query[0]["$match"].(bson.M); len(query) == 1 && ok && len(match) == 1 && match[PendingPurgeField] != nil {
+		count, err := r.db.GetMongoDb().Collection(RESOURCECOLLECTION).EstimatedDocumentCount(ctx)
+		if err != nil {
+			return 0, false, fmt.Errorf("could not estimate resource count: %w", err)
+		}
+		return count, true, nil
+	}
+
+	query = append(query, bson.M{"$count": "count"})
+
+	var counts []struct {
+		Count int64 `bson:"count"`
+	}
+	if err := r.db.Aggregate(ctx, RESOURCECOLLECTION, query, &counts); err != nil {
+		return 0, false, fmt.Errorf("could not count resources: %w", err)
+	}
+	if len(counts) == 0 {
+		return 0, false, nil
+	}
+	return counts[0].Count, false, nil
+}
+
+// Aggregate groups the resources matching the aggregate query that the caller
+// may read and computes the count and aggregations of each group.
+func (r *ResourceMongoDB) Aggregate(ctx context.Context, aggregateQuery *ResourceAggregateQuery) (*ResourceAggregateResult, error) {
+	query, err := generateMatchQuery(ctx, aggregateQuery.Query)
+	if err != nil {
+		return nil, err
+	}
+	query = append(query, generateGroupStages(aggregateQuery)...)
+
+	var docs []bson.M
+	err = r.db.Aggregate(ctx, RESOURCECOLLECTION, query, &docs)
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			rlog.Errorc(ctx, "Query timed out in ResourceMongoDB.Aggregate", err, rlog.Any("query", query))
+			return nil, fmt.Errorf("query timed out: %w", err)
+		}
+		return nil, rorerror.NewRorErrorFromError(500, fmt.Errorf("could not execute aggregate query: %w", err))
+	}
+
+	result := &ResourceAggregateResult{
+		GroupBy:      aggregateQuery.GroupBy,
+		Aggregations: aggregateQuery.Aggregations,
+		Groups:       make([]ResourceAggregateGroup, 0, len(docs)),
+	}
+	for _, doc := range docs {
+		result.Groups = append(result.Groups, aggregateGroupFromDoc(aggregateQuery, doc))
+	}
+	return result, nil
+}
+
+// resourceSetFromRawDocs decodes raw resource documents, skipping and logging
+// the ones that can not be decoded.
+func resourceSetFromRawDocs(ctx context.Context, rawDocs []bson.Raw) *rorresources.ResourceSet {
 	resourceSet := rorresources.NewResourceSet()
 	for _, doc := range rawDocs {
 		resource, err := resourceFromRawDoc(doc)
@@ -224,11 +659,7 @@ func (r *ResourceMongoDB) Get(ctx context.Context, rorResourceQuery *rorresource
 			resourceSet.Add(resource)
 		}
 	}
-	if len(resourceSet.Resources) > 0 {
-		return resourceSet, nil
-	}
-
-	return nil, nil
+	return resourceSet
 }
 
 var (
@@ -279,10 +710,23 @@ func resourceFromRawDoc(raw bson.Raw) (*rorresources.Resource, error) {
 
 func (r *ResourceMongoDB) Del(ctx context.Context, resource *rorresources.Resource) error {
 	filter := bson.M{"uid": resource.GetUID()}
-	_, err := r.db.DeleteOne(ctx, RESOURCECOLLECTION, filter)
+	if !historyEnabled(resource.GetKind()) {
+		_, err := r.db.DeleteOne(ctx, RESOURCECOLLECTION, filter)
+		if err != nil {
+			return err
+		}
+		return nil
+	}
+
+	var previous bson.M
+	err := r.db.GetMongoDb().Collection(RESOURCECOLLECTION).FindOneAndDelete(ctx, filter).Decode(&previous)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil
+	}
 	if err != nil {
 		return err
 	}
+	recordHistory(ctx, previous, WatchEventDeleted, time.Now())
 	return nil
 }
 
@@ -318,86 +762,82 @@ func (r *ResourceMongoDB) GetHashlistByQuery(ctx context.Context, rorResourceQue
 }
 
 func GenerateAggregateQuery(ctx context.Context, rorResourceQuery *rorresources.ResourceQuery) ([]bson.M, error) {
-	query := make([]bson.M, 0)
-	authorizedOwnerRefsQuery := aclservice.GetOwnerrefByContextAccess(ctx, aclmodels.AccessTypeRead)
-	if len(authorizedOwnerRefsQuery) > 0 {
-		query = append(query, authorizedOwnerRefsQuery)
+	if rorResourceQuery == nil {
+		return nil, fmt.Errorf("could not generate mongodb query: empty resource query")
+	}
+	query, err := generateSortedQuery(ctx, rorResourceQuery, sortKeys(rorResourceQuery), nil)
+	if err != nil {
+		return nil, err
 	}
 
-	if rorResourceQuery == nil {
-		return query, fmt.Errorf("could not generate mongodb query: empty resource query")
+	// Add offset and limit
+	if rorResourceQuery.Offset != 0 {
+		query = append(query, bson.M{"$skip": rorResourceQuery.Offset})
 	}
 
-	match := bson.M{}
-	// Add filters
-	if !rorResourceQuery.VersionKind.Empty() {
-		apiversion, kind := rorResourceQuery.VersionKind.ToAPIVersionAndKind()
+	// Compute an effective limit without mutating the original query.
+	effectiveLimit := rorResourceQuery.Limit
+	if effectiveLimit == 0 {
+		// Default limit when none is specified.
+		effectiveLimit = 100
+	} else if effectiveLimit > 1000 {
+		// Cap the limit to a maximum of 1000.
+		effectiveLimit = 1000
+	}
 
-		if apiversion != "" {
-			match["typemeta.apiversion"] = apiversion
-		}
-		if kind != "" {
-			match["typemeta.kind"] = kind
-		}
+	// Treat -1 as "no limit" (omit $limit stage).
+	if effectiveLimit != -1 {
+		query = append(query, bson.M{"$limit": effectiveLimit})
 	}
+	return query, nil
+}
 
-	if len(rorResourceQuery.Uids) > 0 {
-		match["uid"] = bson.M{"$in": rorResourceQuery.Uids}
+// sortKey is a field a resource query is sorted by.
+type sortKey struct {
+	field      string
+	descending bool
+}
+
+// sortKeys returns the fields a resource query is sorted by, the query order
+// or metadata.name, always followed by _id so the order is total.
+func sortKeys(rorResourceQuery *rorresources.ResourceQuery) []sortKey {
+	keys := make([]sortKey, 0, len(rorResourceQuery.Order)+2)
+	if len(rorResourceQuery.Order) != 0 {
+		for _, orderline := range rorResourceQuery.GetOrderSorted() {
+			keys = append(keys, sortKey{field: orderline.Field, descending: orderline.Descending})
+		}
+	} else {
+		keys = append(keys, sortKey{field: "metadata.name"})
 	}
+	return append(keys, sortKey{field: "_id"})
+}
 
-	if len(rorResourceQuery.OwnerRefs) > 0 {
-		match["rormeta.ownerref"] = bson.M{"$in": rorResourceQuery.OwnerRefs}
+// generateSortedQuery builds the aggregate stages of a resource query up to
+// and including sorting and projection. A non-nil cursor limits the result to
+// the resources sorted after it.
+func generateSortedQuery(ctx context.Context, rorResourceQuery *rorresources.ResourceQuery, keys []sortKey, cursor *ResourceCursor) ([]bson.M, error) {
+	query, err := generateMatchQuery(ctx, rorResourceQuery)
+	if err != nil {
+		return nil, err
 	}
 
-	if len(rorResourceQuery.Filters) == 1 {
-		err := addMatchFilter(rorResourceQuery.Filters[0], match)
+	if cursor != nil {
+		after, err := cursorMatch(keys, cursor)
 		if err != nil {
-			return nil, fmt.Errorf("could not parse match filter: %w", err)
-		}
-	} else if len(rorResourceQuery.Filters) > 1 {
-		filterCount := map[string]int{}
-		for _, filter := range rorResourceQuery.Filters {
-			filterCount[filter.Field]++
-		}
-
-		for key, value := range filterCount {
-			if value == 1 {
-				for _, filter := range rorResourceQuery.Filters {
-					if filter.Field == key {
-						err := addMatchFilter(filter, match)
-						if err != nil {
-							return nil, fmt.Errorf("could not parse match filter: %w", err)
-						}
-					}
-				}
-			} else {
-				var filterList []string
-				for _, filter := range rorResourceQuery.Filters {
-					if filter.Field == key {
-						filterList = append(filterList, filter.Value)
-					}
-				}
-				match[key] = bson.M{"$in": filterList}
-			}
+			return nil, err
 		}
+		query = append(query, bson.M{"$match": after})
 	}
-	query = append(query, bson.M{"$match": match})
 
 	// Add sorting — use bson.D to guarantee field order (bson.M is a map with random iteration).
 	sortdoc := bson.D{}
-	if len(rorResourceQuery.Order) != 0 {
-		for _, orderline := range rorResourceQuery.GetOrderSorted() {
-			if orderline.Descending {
-				sortdoc = append(sortdoc, bson.E{Key: orderline.Field, Value: -1})
-			} else {
-				sortdoc = append(sortdoc, bson.E{Key: orderline.Field, Value: 1})
-			}
+	for _, key := range keys {
+		if key.descending {
+			sortdoc = append(sortdoc, bson.E{Key: key.field, Value: -1})
+		} else {
+			sortdoc = append(sortdoc, bson.E{Key: key.field, Value: 1})
 		}
-
-	} else {
-		sortdoc = append(sortdoc, bson.E{Key: "metadata.name", Value: 1})
 	}
-	sortdoc = append(sortdoc, bson.E{Key: "_id", Value: 1})
 	query = append(query, bson.M{"$sort": sortdoc})
 	// Add projection
 	if len(rorResourceQuery.Fields) != 0 {
@@ -410,99 +850,142 @@ func GenerateAggregateQuery(ctx context.Context, rorResourceQuery *rorresources.
 		}
 		query = append(query, bson.M{"$project": project})
 	}
+	return query, nil
+}
 
-	// Add offset and limit
-	if rorResourceQuery.Offset != 0 {
-		query = append(query, bson.M{"$skip": rorResourceQuery.Offset})
-	}
-
-	// Compute an effective limit without mutating the original query.
-	effectiveLimit := rorResourceQuery.Limit
-	if effectiveLimit == 0 {
-		// Default limit when none is specified.
-		effectiveLimit = 100
-	} else if effectiveLimit > 1000 {
-		// Cap the limit to a maximum of 1000.
-		effectiveLimit = 1000
+// generateMatchQuery builds the aggregate stages selecting the resources of
+// a query the caller is authorized to read, excluding the resources pending
+// purge.
+func generateMatchQuery(ctx context.Context, rorResourceQuery *rorresources.ResourceQuery) ([]bson.M, error) {
+	query := make([]bson.M, 0, 2)
+	authorizedOwnerRefsQuery := aclservice.GetOwnerrefByContextAccess(ctx, aclmodels.AccessTypeRead)
+	if len(authorizedOwnerRefsQuery) > 0 {
+		query = append(query, authorizedOwnerRefsQuery)
 	}
 
-	// Treat -1 as "no limit" (omit $limit stage).
-	if effectiveLimit != -1 {
-		query = append(query, bson.M{"$limit": effectiveLimit})
+	match, err := generateMatch(rorResourceQuery)
+	if err != nil {
+		return nil, err
 	}
-	return query, nil
+	match[PendingPurgeField] = bson.M{"$exists": false}
+	return append(query, bson.M{"$match": match}), nil
 }
 
-func addMatchFilter(filter rorresources.ResourceQueryFilter, match bson.M) error {
-	switch filter.Type {
-	case rorresources.FilterTypeString:
-		switch filter.Operator {
-		case rorresources.FilterOperatorEq:
-			match[filter.Field] = bson.M{"$eq": filter.Value}
-
-		case rorresources.FilterOperatorNe:
-			match[filter.Field] = bson.M{"$ne": filter.Value}
-
-		case rorresources.FilterOperatorRegexp:
-			match[filter.Field] = bson.M{"$regex": filter.Value, "$options": "i"}
+// generateMatch builds the $match document for the non-ACL parts of a
+// resource query: apiversion/kind, uids, ownerrefs and filters.
+func generateMatch(rorResourceQuery *rorresources.ResourceQuery) (bson.M, error) {
+	match := bson.M{}
+	// Add filters
+	if !rorResourceQuery.VersionKind.Empty() {
+		apiversion, kind := rorResourceQuery.VersionKind.ToAPIVersionAndKind()
 
-		default:
-			err := fmt.Errorf("invalid filter operator: %s", filter.Operator)
-			return rorerror.NewRorErrorFromError(400, err)
+		if apiversion != "" {
+			match["typemeta.apiversion"] = apiversion
 		}
-	case rorresources.FilterTypeInt:
-		switch filter.Operator {
-		case rorresources.FilterOperatorEq:
-			match[filter.Field] = bson.M{"$eq": filter.Value}
+		if kind != "" {
+			match["typemeta.kind"] = kind
+		}
+	}
 
-		case rorresources.FilterOperatorGt:
-			match[filter.Field] = bson.M{"$gt": filter.Value}
+	if len(rorResourceQuery.Uids) > 0 {
+		match["uid"] = bson.M{"$in": rorResourceQuery.Uids}
+	}
 
-		case rorresources.FilterOperatorLt:
-			match[filter.Field] = bson.M{"$lt": filter.Value}
+	if len(rorResourceQuery.OwnerRefs) > 0 {
+		match["rormeta.ownerref"] = bson.M{"$in": rorResourceQuery.OwnerRefs}
+	}
 
-		case rorresources.FilterOperatorGe:
-			match[filter.Field] = bson.M{"$gte": filter.Value}
+	conditions, err := filterConditions(rorResourceQuery.Filters)
+	if err != nil {
+		return nil, err
+	}
+	if len(conditions) > 0 {
+		match["$and"] = conditions
+	}
+	return match, nil
+}
 
-		case rorresources.FilterOperatorLe:
-			match[filter.Field] = bson.M{"$lte": filter.Value}
+// filterConditions converts filters to MongoDB conditions that must all
+// match. Several filters on the same field must all match too, so eq filters
+// with different values on a field only match arrays holding all the values,
+// an in filter matches any of its values.
+func filterConditions(filters []rorresources.ResourceQueryFilter) ([]bson.M, error) {
+	conditions := make([]bson.M, 0, len(filters))
+	for _, filter := range filters {
+		if filter.Type == "" {
+			filter.Type = rorresources.FilterTypeString
+		}
+		condition, err := filterCondition(filter)
+		if err != nil {
+			return nil, err
+		}
+		conditions = append(conditions, condition)
+	}
+	return conditions, nil
+}
 
-		default:
-			err := fmt.Errorf("invalid filter operator: %s", filter.Operator)
-			return rorerror.NewRorErrorFromError(400, err)
+// filterCondition converts a single filter to a MongoDB condition. Filters
+// whose operator does not fit their type return a 400 error.
+func filterCondition(filter rorresources.ResourceQueryFilter) (bson.M, error) {
+	if err := rorqueryfilter.Validate(filter); err != nil {
+		return nil, rorerror.NewRorErrorFromError(400, err)
+	}
+
+	switch filter.Operator {
+	case rorqueryfilter.FilterOperatorOr:
+		groups, err := rorqueryfilter.DecodeOrGroups(filter)
+		if err != nil {
+			return nil, rorerror.NewRorErrorFromError(400, err)
 		}
-	case rorresources.FilterTypeBool:
-		if filter.Operator == rorresources.FilterOperatorEq {
-			boolfilter, err := strconv.ParseBool(filter.Value)
+		alternatives := make([]bson.M, 0, len(groups))
+		for _, group := range groups {
+			conditions, err := filterConditions(group)
 			if err != nil {
-				return rorerror.NewRorErrorFromError(400, err)
+				return nil, err
 			}
-			match[filter.Field] = bson.M{"$eq": boolfilter}
-		} else {
-			err := fmt.Errorf("invalid filter operator: %s", filter.Operator)
-			return rorerror.NewRorErrorFromError(400, err)
-		}
-		// case rorresources.FilterTypeTime:
-		// 	format := "2006-01-02 15:04:05.999999999 -0700 MST"
-		// 	timevalue, err := time.Parse(format, filter.Value)
-		// 	if err == nil {
-		// 		//timevalue := time.ParseTimestamps(filter.Value)
-		// 		if filter.Operator == "eq" {
-		// 			match[filter.Field] = bson.M{"$eq": timevalue}
-		// 		}
-		// 		if filter.Operator == "gt" {
-		// 			match[filter.Field] = bson.M{"$gt": timevalue}
-		// 		}
-		// 		if filter.Operator == "lt" {
-		// 			match[filter.Field] = bson.M{"$lt": timevalue}
-		// 		}
-		// 		if filter.Operator == "ge" {
-		// 			match[filter.Field] = bson.M{"$gte": timevalue}
-		// 		}
-		// 		if filter.Operator == "le" {
-		// 			match[filter.Field] = bson.M{"$lte": timevalue}
-		// 		}
-		// 	}
+			alternatives = append(alternatives, bson.M{"$and": conditions})
+		}
+		return bson.M{"$or": alternatives}, nil
+
+	case rorqueryfilter.FilterOperatorExists:
+		exists, err := rorqueryfilter.ExistsValue(filter)
+		if err != nil {
+			return nil, rorerror.NewRorErrorFromError(400, err)
+		}
+		return bson.M{filter.Field: bson.M{"$exists": exists}}, nil
+
+	case rorqueryfilter.FilterOperatorIn, rorqueryfilter.FilterOperatorNin:
+		values, err := rorqueryfilter.TypedValues(filter)
+		if err != nil {
+			return nil, rorerror.NewRorErrorFromError(400, err)
+		}
+		return bson.M{filter.Field: bson.M{"$" + string(filter.Operator): values}}, nil
+
+	case rorresources.FilterOperatorRegexp:
+		return bson.M{filter.Field: bson.M{"$regex": filter.Value, "$options": "i"}}, nil
+	}
+
+	value, err := rorqueryfilter.TypedValue(filter)
+	if err != nil {
+		return nil, rorerror.NewRorErrorFromError(400, err)
+	}
+	switch filter.Operator {
+	case rorresources.FilterOperatorEq:
+		return bson.M{filter.Field: bson.M{"$eq": value}}, nil
+	case rorresources.FilterOperatorNe:
+		return bson.M{filter.Field: bson.M{"$ne": value}}, nil
+	case rorresources.FilterOperatorGt:
+		return bson.M{filter.Field: bson.M{"$gt": value}}, nil
+	case rorresources.FilterOperatorLt:
+		return bson.M{filter.Field: bson.M{"$lt": value}}, nil
+	case rorresources.FilterOperatorGe:
+		return bson.M{filter.Field: bson.M{"$gte": value}}, nil
+	case rorresources.FilterOperatorLe:
+		return bson.M{filter.Field: bson.M{"$lte": value}}, nil
+	case rorqueryfilter.FilterOperatorContains:
+		return bson.M{filter.Field: bson.M{"$elemMatch": bson.M{"$eq": value}}}, nil
+	default:
+		err := fmt.Errorf("invalid filter operator: %s", filter.Operator)
+		return nil, rorerror.NewRorErrorFromError(400, err)
 	}
-	return nil
 }
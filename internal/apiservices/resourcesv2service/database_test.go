@@ -474,7 +474,7 @@ func TestSet_RemovesLabelsOnReplace(t *testing.T) {
 	err := repo.Set(ctx, resource)
 	require.NoError(t, err)
 
-	// Second Set without labels — ReplaceOne should remove them
+	// Second Set without labels — the replace should remove them
 	resource.Metadata.Labels = nil
 	err = repo.Set(ctx, resource)
 	require.NoError(t, err)
@@ -486,6 +486,30 @@ func TestSet_RemovesLabelsOnReplace(t *testing.T) {
 	assert.Empty(t, result.Resources[0].Metadata.Labels, "labels should be nil after replace with no labels")
 }
 
+func TestSet_KeepsPendingPurgeMark(t *testing.T) {
+	repo := newTestRepo(t)
+	ctx := testCtx()
+
+	resource := makePodResource("uid-pending-purge", map[string]string{"app": "v1"}, nil, "Running")
+	require.NoError(t, repo.Set(ctx, resource))
+
+	collection := repo.db.GetMongoDb().Collection(RESOURCECOLLECTION)
+	_, err := collection.UpdateOne(ctx, bson.M{"uid": "uid-pending-purge"}, bson.M{"$set": bson.M{PendingPurgeField: time.Now()}})
+	require.NoError(t, err)
+
+	// The agent writes the resource again while the cluster is pending purge
+	resource.PodResource.Status.Phase = "Succeeded"
+	require.NoError(t, repo.Set(ctx, resource))
+
+	count, err := collection.CountDocuments(ctx, bson.M{"uid": "uid-pending-purge", PendingPurgeField: bson.M{"$exists": true}})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), count, "the pending purge mark should be kept")
+
+	result, err := repo.Get(ctx, rorresources.NewResourceQuery().WithUID("uid-pending-purge"))
+	require.NoError(t, err)
+	assert.Nil(t, result, "a resource pending purge should be hidden")
+}
+
 func TestSet_DeploymentResource(t *testing.T) {
 	repo := newTestRepo(t)
 	ctx := testCtx()
@@ -838,6 +862,46 @@ func TestGet_WithPagination(t *testing.T) {
 	}
 }
 
+func TestGetPage_WalksAllPages(t *testing.T) {
+	repo := newTestRepo(t)
+	ctx := testCtx()
+
+	for i := range 10 {
+		r := makePodResource(fmt.Sprintf("uid-cursor-%02d", i), nil, nil, "Running")
+		// Pairs of equal names make the _id tiebreaker decide the order.
+		r.Metadata.Name = fmt.Sprintf("pod-%02d", i/2)
+		require.NoError(t, repo.Set(ctx, r))
+	}
+
+	query := rorresources.NewResourceQuery()
+	query.Order = []rorresources.ResourceQueryOrder{
+		{Field: "metadata.name", Descending: true, Index: 0},
+	}
+
+	seen := make(map[string]bool)
+	var cursor *ResourceCursor
+	pages := 0
+	for {
+		result, next, err := repo.GetPage(ctx, query, cursor, 3)
+		require.NoError(t, err)
+		pages++
+		for _, r := range result.Resources {
+			assert.False(t, seen[r.GetUID()], "resource %s returned twice", r.GetUID())
+			seen[r.GetUID()] = true
+		}
+		if next == nil {
+			break
+		}
+		cursor = next
+	}
+	assert.Equal(t, 4, pages)
+	assert.Len(t, seen, 10)
+
+	count, _, err := repo.Count(ctx, query)
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), count)
+}
+
 // --- Del edge cases ---
 
 func TestDel_ThenSetSameUID(t *testing.T) {
@@ -1055,3 +1119,26 @@ func TestDToM(t *testing.T) {
 	assert.Equal(t, true, m["c"])
 	assert.Len(t, m, 3)
 }
+
+// --- filterConditions unit tests ---
+
+func TestFilterConditions_SameFieldMustAllMatch(t *testing.T) {
+	conditions, err := filterConditions([]rorresources.ResourceQueryFilter{
+		{Field: "metadata.labels.app", Type: rorresources.FilterTypeString, Operator: rorresources.FilterOperatorEq, Value: "a"},
+		{Field: "metadata.labels.app", Type: rorresources.FilterTypeString, Operator: rorresources.FilterOperatorEq, Value: "b"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []bson.M{
+		{"metadata.labels.app": bson.M{"$eq": "a"}},
+		{"metadata.labels.app": bson.M{"$eq": "b"}},
+	}, conditions)
+}
+
+func TestFilterConditions_RejectsOperatorFields(t *testing.T) {
+	for _, field := range []string{"$where", "metadata.$ne", "metadata..name", "metadata.name."} {
+		_, err := filterConditions([]rorresources.ResourceQueryFilter{
+			{Field: field, Type: rorresources.FilterTypeString, Operator: rorresources.FilterOperatorEq, Value: "a"},
+		})
+		assert.Error(t, err, field)
+	}
+}
@@ -0,0 +1,297 @@
+package resourcesv2service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/NorskHelsenett/ror-api/internal/acl/aclservice"
+	mongoclusters "github.com/NorskHelsenett/ror-api/internal/databases/mongodb/repositories/clusters"
+
+	"github.com/NorskHelsenett/ror/pkg/clients/mongodb"
+	"github.com/NorskHelsenett/ror/pkg/config/rorconfig"
+	"github.com/NorskHelsenett/ror/pkg/models/aclmodels"
+	"github.com/NorskHelsenett/ror/pkg/rlog"
+	"github.com/NorskHelsenett/ror/pkg/rorresources"
+	"github.com/NorskHelsenett/ror/pkg/telemetry/rortracer"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const (
+	HISTORYCOLLECTION = "resourcesv2history"
+
+	// resourceUpdatedField holds the time a resourcesv2 document was last
+	// written, it is the start of the revision's validity in the history.
+	resourceUpdatedField = "_updatedat"
+
+	defaultHistoryLimit = 100
+	maxHistoryLimit     = 1000
+)
+
+// historyPolicy returns the history policy loaded from config on first use.
+var historyPolicy = sync.OnceValue(loadHistoryPolicy)
+
+// resourceHistoryPolicy holds the retention of each kind that keeps history.
+type resourceHistoryPolicy struct {
+	retention map[string]time.Duration
+}
+
+// loadHistoryPolicy reads RESOURCEV2_HISTORY_KINDS, a comma separated list of
+// kinds with an optional retention, e.g. "KubernetesCluster=720h,Namespace".
+// Kinds without a retention use RESOURCEV2_HISTORY_RETENTION.
+func loadHistoryPolicy() resourceHistoryPolicy {
+	defaultRetention, err := time.ParseDuration(rorconfig.GetString("RESOURCEV2_HISTORY_RETENTION"))
+	if err != nil || defaultRetention <= 0 {
+		rlog.Warn("Could not parse resourcesv2 history retention, defaulting to 720h")
+		defaultRetention = 720 * time.Hour
+	}
+
+	policy := resourceHistoryPolicy{retention: make(map[string]time.Duration)}
+	for _, entry := range strings.Split(rorconfig.GetString("RESOURCEV2_HISTORY_KINDS"), ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		kind, value, found := strings.Cut(entry, "=")
+		kind = strings.TrimSpace(kind)
+		retention := defaultRetention
+		if found {
+			retention, err = time.ParseDuration(strings.TrimSpace(value))
+			if err != nil || retention <= 0 {
+				rlog.Warn("Could not parse resourcesv2 history retention for kind, using default", rlog.String("kind", kind))
+				retention = defaultRetention
+			}
+		}
+		policy.retention[kind] = retention
+	}
+	return policy
+}
+
+// historyEnabled reports whether revisions of the kind are kept.
+func historyEnabled(kind string) bool {
+	_, ok := historyPolicy().retention[kind]
+	return ok
+}
+
+// ResourceRevision is a stored revision of a resource and the time range it
+// was the current revision.
+type ResourceRevision struct {
+	ResourceVersion int64                  `json:"resourceVersion"`
+	SupersededBy    WatchEventType         `json:"supersededBy"`
+	ValidFrom       *time.Time             `json:"validFrom,omitempty"`
+	ValidUntil      *time.Time             `json:"validUntil,omitempty"`
+	Resource        *rorresources.Resource `json:"resource"`
+}
+
+// revisionMeta is the bookkeeping stored next to a resource document in the
+// resourcesv2 and history collections.
+type revisionMeta struct {
+	Version     int64          `bson:"_resourceversion"`
+	UpdatedAt   *time.Time     `bson:"_updatedat"`
+	HistoryTime *time.Time     `bson:"_historytime"`
+	Event       WatchEventType `bson:"_historyevent"`
+}
+
+// recordHistory stores a superseded resourcesv2 document when its kind keeps
+// history. Failing to record history is logged but does not fail the write.
+func recordHistory(ctx context.Context, previous bson.M, eventType WatchEventType, supersededAt time.Time) {
+	if previous == nil {
+		return
+	}
+	retention, ok := historyPolicy().retention[docKind(previous)]
+	if !ok {
+		return
+	}
+
+	entry := make(bson.M, len(previous)+3)
+	for key, value := range previous {
+		if key == "_id" {
+			continue
+		}
+		entry[key] = value
+	}
+	entry["_historytime"] = supersededAt
+	entry["_historyevent"] = eventType
+	entry["_expireat"] = supersededAt.Add(retention)
+
+	_, err := mongodb.GetMongoDb().Collection(HISTORYCOLLECTION).InsertOne(ctx, entry)
+	if err != nil {
+		rlog.Errorc(ctx, "could not record resource history", err, rlog.Any("uid", previous["uid"]))
+	}
+}
+
+// docKind returns typemeta.kind of a raw resource document.
+func docKind(doc bson.M) string {
+	switch typemeta := doc["typemeta"].(type) {
+	case bson.M:
+		kind, _ := typemeta["kind"].(string)
+		return kind
+	case bson.D:
+		for _, element := range typemeta {
+			if element.Key == "kind" {
+				kind, _ := element.Value.(string)
+				return kind
+			}
+		}
+	}
+	return ""
+}
+
+// GetResourceHistory returns the stored revisions of the resource with the
+// given uid, newest first. Revisions are filtered by read access like normal
+// reads and hidden while the resource is pending purge, limit 0 uses the
+// default limit.
+func GetResourceHistory(ctx context.Context, uid string, limit int) ([]ResourceRevision, error) {
+	ctx, span := rortracer.StartSpan(ctx, "v2.resourcesv2service.GetResourceHistory")
+	defer span.End()
+	span.SetAttributes(attribute.String("resource.uid", uid))
+
+	if limit <= 0 {
+		limit = defaultHistoryLimit
+	}
+	if limit > maxHistoryLimit {
+		limit = maxHistoryLimit
+	}
+
+	pending, err := pendingPurge(ctx, uid)
+	if err != nil {
+		rortracer.SpanError(span, err, "could not get resource history")
+		return nil, err
+	}
+	if pending {
+		rortracer.SpanOk(span)
+		return []ResourceRevision{}, nil
+	}
+
+	revisions, err := findRevisions(ctx, HISTORYCOLLECTION, bson.M{"uid": uid}, bson.D{{Key: "_historytime", Value: -1}}, limit)
+	if err != nil {
+		rortracer.SpanError(span, err, "could not get resource history")
+		return nil, err
+	}
+	rortracer.SpanOk(span)
+	span.SetAttributes(attribute.Int("revisions.count", len(revisions)))
+	return revisions, nil
+}
+
+// GetResourceAt returns the revision of the resource with the given uid that
+// was current at the given time, or nil if the resource did not exist then,
+// no revision covering that time is retained or the resource is pending purge.
+func GetResourceAt(ctx context.Context, uid string, at time.Time) (*rorresources.ResourceSet, error) {
+	ctx, span := rortracer.StartSpan(ctx, "v2.resourcesv2service.GetResourceAt")
+	defer span.End()
+	span.SetAttributes(attribute.String("resource.uid", uid), attribute.String("at", at.Format(time.RFC3339)))
+
+	pending, err := pendingPurge(ctx, uid)
+	if err != nil {
+		rortracer.SpanError(span, err, "could not get resource history")
+		return nil, err
+	}
+	if pending {
+		rortracer.SpanOk(span)
+		return nil, nil
+	}
+
+	// The revision current at the given time is the first one superseded
+	// after it, if there is none the current document is the candidate.
+	revisions, err := findRevisions(ctx, HISTORYCOLLECTION,
+		bson.M{"uid": uid, "_historytime": bson.M{"$gt": at}},
+		bson.D{{Key: "_historytime", Value: 1}}, 1)
+	if err != nil {
+		rortracer.SpanError(span, err, "could not get resource history")
+		return nil, err
+	}
+	if len(revisions) == 0 {
+		revisions, err = findRevisions(ctx, RESOURCECOLLECTION, bson.M{"uid": uid}, bson.D{{Key: "_id", Value: 1}}, 1)
+		if err != nil {
+			rortracer.SpanError(span, err, "could not get resource")
+			return nil, err
+		}
+	}
+	rortracer.SpanOk(span)
+
+	if len(revisions) == 0 || (revisions[0].ValidFrom != nil && revisions[0].ValidFrom.After(at)) {
+		return nil, nil
+	}
+	resourceSet := rorresources.NewResourceSet()
+	resourceSet.Add(revisions[0].Resource)
+	return resourceSet, nil
+}
+
+// findRevisions reads resource documents with their revision bookkeeping from
+// the collection, limited to the ones the caller is authorized to read and
+// not pending purge.
+func findRevisions(ctx context.Context, collection string, match bson.M, sort bson.D, limit int) ([]ResourceRevision, error) {
+	pipeline := make([]bson.M, 0, 4)
+	if acl := aclservice.GetOwnerrefByContextAccess(ctx, aclmodels.AccessTypeRead); len(acl) > 0 {
+		pipeline = append(pipeline, acl)
+	}
+	match[PendingPurgeField] = bson.M{"$exists": false}
+	pipeline = append(pipeline,
+		bson.M{"$match": match},
+		bson.M{"$sort": sort},
+		bson.M{"$limit": limit},
+	)
+
+	mongoCtx, cancel := context.WithTimeout(ctx, getTimeout)
+	defer cancel()
+
+	var rawDocs []bson.Raw
+	if err := mongodb.Aggregate(mongoCtx, collection, pipeline, &rawDocs); err != nil {
+		return nil, fmt.Errorf("could not query %s: %w", collection, err)
+	}
+
+	revisions := make([]ResourceRevision, 0, len(rawDocs))
+	for _, raw := range rawDocs {
+		var meta revisionMeta
+		if err := bson.Unmarshal(raw, &meta); err != nil {
+			rlog.Errorc(ctx, "could not decode resource revision", err)
+			continue
+		}
+		resource, err := resourceFromRawDoc(raw)
+		if err != nil {
+			rlog.Errorc(ctx, "could not decode resource revision", err, rlog.Int64("resourceVersion", meta.Version))
+			continue
+		}
+		revisions = append(revisions, ResourceRevision{
+			ResourceVersion: meta.Version,
+			SupersededBy:    meta.Event,
+			ValidFrom:       meta.UpdatedAt,
+			ValidUntil:      meta.HistoryTime,
+			Resource:        resource,
+		})
+	}
+	return revisions, nil
+}
+
+// pendingPurge reports whether the cluster of the resource with the given
+// uid is pending purge. The cluster is the resource itself or the owner of
+// the stored resource or of any of its revisions, so the history of a
+// resource deleted before its cluster was marked is hidden as well.
+func pendingPurge(ctx context.Context, uid string) (bool, error) {
+	mongoCtx, cancel := context.WithTimeout(ctx, getTimeout)
+	defer cancel()
+
+	db := mongodb.GetMongoDb()
+	clusterUids := bson.A{uid}
+	for _, collection := range []string{RESOURCECOLLECTION, HISTORYCOLLECTION} {
+		var owners bson.A
+		err := db.Collection(collection).Distinct(mongoCtx, "rormeta.ownerref.subject", bson.M{"uid": uid}).Decode(&owners)
+		if err != nil {
+			return false, fmt.Errorf("could not get the owners of the resource: %w", err)
+		}
+		clusterUids = append(clusterUids, owners...)
+	}
+
+	count, err := db.Collection(mongoclusters.CollectionName).CountDocuments(mongoCtx,
+		bson.M{"uid": bson.M{"$in": clusterUids}, mongoclusters.PendingPurgeField: bson.M{"$exists": true}},
+		options.Count().SetLimit(1))
+	if err != nil {
+		return false, fmt.Errorf("could not check whether the cluster of the resource is pending purge: %w", err)
+	}
+	return count > 0, nil
+}
@@ -0,0 +1,234 @@
+package resourcesv2service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/NorskHelsenett/ror/pkg/helpers/rorerror/v2"
+	"github.com/NorskHelsenett/ror/pkg/rlog"
+	"github.com/NorskHelsenett/ror/pkg/rorresources"
+	"github.com/NorskHelsenett/ror/pkg/telemetry/rortracer"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const (
+	// ContinueHeader holds the continue token of the next page, it is not
+	// set on the last page.
+	ContinueHeader = "X-Continue-Token"
+	// TotalCountHeader holds the number of resources matching a paged query,
+	// it is only set on the first page.
+	TotalCountHeader = "X-Total-Count"
+	// TotalCountEstimatedHeader is set to true when the total count is an
+	// estimate.
+	TotalCountEstimatedHeader = "X-Total-Count-Estimated"
+
+	defaultPageSize = 100
+	maxPageSize     = 1000
+)
+
+var ErrInvalidContinueToken = errors.New("invalid continue token")
+
+// ResourceCursor is the position after a resource in the sort order of a
+// query: the values of its sort keys followed by its _id.
+type ResourceCursor struct {
+	Keys []any `bson:"k"`
+	ID   any   `bson:"id"`
+}
+
+// ResourcePage is a page of a resource query walked with continue tokens.
+type ResourcePage struct {
+	Resources *rorresources.ResourceSet
+	// Continue is the token of the next page, empty on the last page.
+	Continue string
+	// Count is the number of resources matching the query, only set on the
+	// first page.
+	Count          *int64
+	CountEstimated bool
+}
+
+// continueToken is the content of an opaque continue token. The query hash
+// ties the token to the query it was issued for.
+type continueToken struct {
+	Query          string `bson:"q"`
+	ResourceCursor `bson:",inline"`
+}
+
+// GetResourcePage returns a page of the resources matching the query. An
+// empty token returns the first page, including the count of matching
+// resources, otherwise the page following the one the token was issued with.
+// Unlike GetResourceByQuery there is no limit on how far the result set can
+// be walked, the query limit is the page size, capped at 1000.
+func GetResourcePage(ctx context.Context, query *rorresources.ResourceQuery, token string) (*ResourcePage, error) {
+	ctx, span := rortracer.StartSpan(ctx, "v2.resourcesv2service.GetResourcePage")
+	defer span.End()
+
+	if query == nil {
+		err := rorerror.NewRorErrorFromError(400, fmt.Errorf("could not get resource page: empty resource query"))
+		rortracer.SpanError(span, err, "empty query")
+		return nil, err
+	}
+
+	queryHash, err := resourceQueryHash(query)
+	if err != nil {
+		rortracer.SpanError(span, err, "could not hash query")
+		return nil, err
+	}
+	var cursor *ResourceCursor
+	if token != "" {
+		cursor, err = decodeContinueToken(token, queryHash)
+		if err != nil {
+			rortracer.SpanError(span, err, "invalid continue token")
+			return nil, rorerror.NewRorErrorFromError(400, err)
+		}
+	}
+
+	pageSize := query.Limit
+	if pageSize <= 0 {
+		pageSize = defaultPageSize
+	} else if pageSize > maxPageSize {
+		pageSize = maxPageSize
+	}
+
+	databaseHelpers := newResourceDB(getMongoConnection())
+	mongoCtx, cancel := context.WithTimeout(ctx, getTimeout)
+	defer cancel()
+
+	queryStart := time.Now()
+	resourceSet, next, err := databaseHelpers.GetPage(mongoCtx, query, cursor, pageSize)
+	if err != nil {
+		rortracer.SpanError(span, err, "could not get resource page")
+		return nil, fmt.Errorf("could not get resource page: %w", err)
+	}
+	if elapsed := time.Since(queryStart); elapsed > slowQueryDuration {
+		rlog.Warn("Slow query detected in GetResourcePage", rlog.Any("duration", elapsed))
+	}
+
+	page := &ResourcePage{Resources: resourceSet}
+	if next != nil {
+		page.Continue, err = encodeContinueToken(queryHash, next)
+		if err != nil {
+			rortracer.SpanError(span, err, "could not encode continue token")
+			return nil, err
+		}
+	}
+
+	if cursor == nil {
+		count, estimated, err := databaseHelpers.Count(mongoCtx, query)
+		if err != nil {
+			rortracer.SpanError(span, err, "could not count resources")
+			return nil, fmt.Errorf("could not count resources: %w", err)
+		}
+		page.Count = &count
+		page.CountEstimated = estimated
+	}
+
+	rortracer.SpanOk(span)
+	span.SetAttributes(attribute.Int("resources.count", len(resourceSet.Resources)), attribute.Bool("page.last", next == nil))
+	return page, nil
+}
+
+// resourceQueryHash identifies the parts of a query that decide which
+// resources are returned and in which order.
+func resourceQueryHash(query *rorresources.ResourceQuery) (string, error) {
+	identity := *query
+	identity.Fields = nil
+	identity.Offset = 0
+	identity.Limit = 0
+	data, err := json.Marshal(identity)
+	if err != nil {
+		return "", fmt.Errorf("could not encode resource query: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8]), nil
+}
+
+// encodeContinueToken encodes the cursor as an opaque token. Extended JSON
+// keeps the BSON types of the sort key values.
+func encodeContinueToken(queryHash string, cursor *ResourceCursor) (string, error) {
+	data, err := bson.MarshalExtJSON(continueToken{Query: queryHash, ResourceCursor: *cursor}, true, false)
+	if err != nil {
+		return "", fmt.Errorf("could not encode continue token: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+func decodeContinueToken(token string, queryHash string) (*ResourceCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, ErrInvalidContinueToken
+	}
+	var decoded continueToken
+	if err := bson.UnmarshalExtJSON(data, true, &decoded); err != nil || decoded.ID == nil {
+		return nil, ErrInvalidContinueToken
+	}
+	if decoded.Query != queryHash {
+		return nil, fmt.Errorf("%w: token was issued for another query", ErrInvalidContinueToken)
+	}
+	return &decoded.ResourceCursor, nil
+}
+
+// cursorFromRawDoc returns the cursor positioned after the document.
+func cursorFromRawDoc(raw bson.Raw, keys []sortKey) (*ResourceCursor, error) {
+	cursor := &ResourceCursor{Keys: make([]any, 0, len(keys)-1)}
+	for _, key := range keys {
+		var value any
+		rawValue, err := raw.LookupErr(strings.Split(key.field, ".")...)
+		if err == nil && rawValue.Type != bson.TypeNull {
+			if err := rawValue.Unmarshal(&value); err != nil {
+				return nil, fmt.Errorf("could not read sort key %s: %w", key.field, err)
+			}
+		}
+		if key.field == "_id" && cursor.ID == nil {
+			cursor.ID = value
+			continue
+		}
+		cursor.Keys = append(cursor.Keys, value)
+	}
+	return cursor, nil
+}
+
+// cursorMatch returns a condition matching the resources sorted after the
+// cursor: for some sort key the resource sorts after the cursor value while it
+// has the cursor values for all keys before it. Missing and null values sort
+// before all other values. Sort fields are expected to hold values of one
+// type, as range conditions only match values of the same type.
+func cursorMatch(keys []sortKey, cursor *ResourceCursor) (bson.M, error) {
+	values := append(slices.Clone(cursor.Keys), cursor.ID)
+	if len(values) != len(keys) {
+		return nil, fmt.Errorf("%w: token does not match the query sort order", ErrInvalidContinueToken)
+	}
+
+	branches := bson.A{}
+	for i, key := range keys {
+		branch := bson.M{}
+		for j := range i {
+			branch[keys[j].field] = values[j]
+		}
+		switch {
+		case values[i] == nil && key.descending:
+			// Nothing sorts after missing values in descending order.
+			continue
+		case values[i] == nil:
+			branch[key.field] = bson.M{"$ne": nil}
+		case key.descending:
+			branch["$or"] = bson.A{
+				bson.M{key.field: bson.M{"$lt": values[i]}},
+				bson.M{key.field: nil},
+			}
+		default:
+			branch[key.field] = bson.M{"$gt": values[i]}
+		}
+		branches = append(branches, branch)
+	}
+	return bson.M{"$or": branches}, nil
+}
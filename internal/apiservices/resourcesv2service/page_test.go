@@ -0,0 +1,68 @@
+package resourcesv2service
+
+import (
+	"testing"
+
+	"github.com/NorskHelsenett/ror/pkg/rorresources"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+func TestContinueToken(t *testing.T) {
+	query := rorresources.NewResourceQuery()
+	query.Order = []rorresources.ResourceQueryOrder{{Field: "metadata.name", Index: 1}}
+	queryHash, err := resourceQueryHash(query)
+	require.NoError(t, err)
+
+	id := bson.NewObjectID()
+	token, err := encodeContinueToken(queryHash, &ResourceCursor{Keys: []any{"pod-42"}, ID: id})
+	require.NoError(t, err)
+
+	t.Run("round trip keeps values and types", func(t *testing.T) {
+		cursor, err := decodeContinueToken(token, queryHash)
+		require.NoError(t, err)
+		assert.Equal(t, []any{"pod-42"}, cursor.Keys)
+		assert.Equal(t, id, cursor.ID)
+	})
+
+	t.Run("page size does not change the query", func(t *testing.T) {
+		paged := *query
+		paged.Limit = 500
+		pagedHash, err := resourceQueryHash(&paged)
+		require.NoError(t, err)
+		_, err = decodeContinueToken(token, pagedHash)
+		assert.NoError(t, err)
+	})
+
+	t.Run("other query is rejected", func(t *testing.T) {
+		other := *query
+		other.Uids = []string{"uid-1"}
+		otherHash, err := resourceQueryHash(&other)
+		require.NoError(t, err)
+		_, err = decodeContinueToken(token, otherHash)
+		assert.ErrorIs(t, err, ErrInvalidContinueToken)
+	})
+
+	t.Run("garbage is rejected", func(t *testing.T) {
+		_, err := decodeContinueToken("not a token", queryHash)
+		assert.ErrorIs(t, err, ErrInvalidContinueToken)
+	})
+}
+
+func TestCursorMatch(t *testing.T) {
+	keys := []sortKey{{field: "metadata.name", descending: true}, {field: "_id"}}
+
+	match, err := cursorMatch(keys, &ResourceCursor{Keys: []any{"b"}, ID: 7})
+	require.NoError(t, err)
+	assert.Equal(t, bson.M{"$or": bson.A{
+		bson.M{"$or": bson.A{
+			bson.M{"metadata.name": bson.M{"$lt": "b"}},
+			bson.M{"metadata.name": nil},
+		}},
+		bson.M{"metadata.name": "b", "_id": bson.M{"$gt": 7}},
+	}}, match)
+
+	_, err = cursorMatch(keys, &ResourceCursor{ID: 7})
+	assert.ErrorIs(t, err, ErrInvalidContinueToken)
+}
@@ -10,6 +10,8 @@ import (
 
 	"github.com/NorskHelsenett/ror-api/internal/acl/aclservice"
 	"github.com/NorskHelsenett/ror-api/internal/apiconnections"
+	"github.com/NorskHelsenett/ror-api/internal/apiservices/outboxservice"
+	"github.com/NorskHelsenett/ror-api/pkg/services/sseservice"
 
 	"github.com/NorskHelsenett/ror/pkg/apicontracts/apiresourcecontracts"
 	"github.com/NorskHelsenett/ror/pkg/clients/mongodb"
@@ -36,7 +38,10 @@ var (
 
 type resourceDBFactory func(*mongodb.MongodbCon) ResourceDBProvider
 
-func HandleResourceUpdate(ctx context.Context, resource *rorresources.Resource) rorresources.ResourceUpdateResults {
+// HandleResourceUpdate writes or deletes the resource by its action. It
+// returns the result and the version a written resource was stored with, 0
+// when it was deleted or not written.
+func HandleResourceUpdate(ctx context.Context, resource *rorresources.Resource) (rorresources.ResourceUpdateResults, int64) {
 	ctx, span := rortracer.StartSpan(ctx, "v2.resourcesv2service.HandleResourceUpdate")
 	defer span.End()
 	span.SetAttributes(
@@ -61,7 +66,7 @@ func HandleResourceUpdate(ctx context.Context, resource *rorresources.Resource)
 						Message: "500: Could not delete resource",
 					},
 				},
-			}
+			}, 0
 		}
 		return rorresources.ResourceUpdateResults{
 			Results: map[string]rorresources.ResourceUpdateResult{
@@ -70,7 +75,7 @@ func HandleResourceUpdate(ctx context.Context, resource *rorresources.Resource)
 					Message: "202: Resource deleted",
 				},
 			},
-		}
+		}, 0
 	default:
 		_ = rortracer.SpanErrorf(span, "unknown action")
 		return rorresources.ResourceUpdateResults{
@@ -80,11 +85,11 @@ func HandleResourceUpdate(ctx context.Context, resource *rorresources.Resource)
 					Message: "400: Unknown action",
 				},
 			},
-		}
+		}, 0
 	}
 }
 
-func NewOrUpdateResource(ctx context.Context, resource *rorresources.Resource) rorresources.ResourceUpdateResults {
+func NewOrUpdateResource(ctx context.Context, resource *rorresources.Resource) (rorresources.ResourceUpdateResults, int64) {
 	ctx, span := rortracer.StartSpan(ctx, "v2.resourcesv2service.NewOrUpdateResource")
 	defer span.End()
 	span.SetAttributes(
@@ -109,7 +114,7 @@ func NewOrUpdateResource(ctx context.Context, resource *rorresources.Resource) r
 					Message: "403: No access",
 				},
 			},
-		}
+		}, 0
 	}
 
 	// Normalize ownerref before persistence: translate legacy scope/subject
@@ -126,7 +131,7 @@ func NewOrUpdateResource(ctx context.Context, resource *rorresources.Resource) r
 					Message: "400: Could not apply filter to resource",
 				},
 			},
-		}
+		}, 0
 	}
 	//cache := GetResourceCache()
 	//cache.Set(ctx, resource)
@@ -134,8 +139,26 @@ func NewOrUpdateResource(ctx context.Context, resource *rorresources.Resource) r
 	mongoCtx, cancel := context.WithTimeout(ctx, setTimeout)
 	defer cancel()
 
+	// The resource, its message bus event and its watch event are written
+	// together, so the events are neither lost nor sent for a write that
+	// failed.
 	databaseHelpers := NewResourceMongoDB(mongodb.GetMongodbConnection())
-	err = databaseHelpers.Set(mongoCtx, resource)
+	var written ResourceWriteResult
+	err = runVersioned(mongoCtx, func(ctx context.Context) error {
+		var err error
+		written, err = databaseHelpers.Upsert(ctx, resource)
+		if err != nil {
+			return err
+		}
+		eventType := WatchEventModified
+		if written.Created {
+			eventType = WatchEventAdded
+		}
+		if err := recordWatchEventForResource(ctx, eventType, resource, written.Version); err != nil {
+			return err
+		}
+		return enqueueResourceEvent(ctx, resource, resource.RorMeta.Action)
+	})
 	if err != nil {
 		rlog.Errorc(ctx, "Failed to set resource", err)
 		rortracer.SpanError(span, err, "failed to set resource")
@@ -146,13 +169,10 @@ func NewOrUpdateResource(ctx context.Context, resource *rorresources.Resource) r
 					Message: "500: Could not create resource",
 				},
 			},
-		}
+		}, 0
 	}
 
-	if err := sendToMessageBus(ctx, resource, resource.RorMeta.Action); err != nil {
-		rlog.Errorc(ctx, "Failed to send message to bus", err)
-		rortracer.SpanError(span, err, "failed to send message to bus")
-	}
+	publishResourceEvent(ctx, resource, resource.RorMeta.Action)
 
 	//rlog.Debug("Resource created", rlog.Any("resource", resource.GetAPIVersion()), rlog.Any("kind", resource.GetKind()), rlog.Any("name", resource.GetName()))
 	rortracer.SpanOk(span)
@@ -160,10 +180,19 @@ func NewOrUpdateResource(ctx context.Context, resource *rorresources.Resource) r
 		Results: map[string]rorresources.ResourceUpdateResult{
 			resource.GetUID(): {
 				Status:  http.StatusAccepted,
-				Message: "202: Resource created",
+				Message: writeMessage(written),
 			},
 		},
+	}, written.Version
+}
+
+// writeMessage returns the result message of a written resource, telling
+// whether it was created or an existing resource was updated.
+func writeMessage(written ResourceWriteResult) string {
+	if written.Created {
+		return "202: Resource created"
 	}
+	return "202: Resource updated"
 }
 
 func GetResourceByUID(ctx context.Context, uid string) (*rorresources.ResourceSet, error) {
@@ -332,24 +361,31 @@ func DeleteResource(ctx context.Context, resource *rorresources.Resource) error
 	//cache := GetResourceCache()
 	//cache.Remove(ctx, resource.GetUID())
 	databaseHelpers := NewResourceMongoDB(mongodb.GetMongodbConnection())
-	err := sendToMessageBus(ctx, resource, rortypes.K8sActionDelete)
+	err := runVersioned(ctx, func(ctx context.Context) error {
+		if err := databaseHelpers.Del(ctx, resource); err != nil {
+			return err
+		}
+		if err := recordWatchEventForResource(ctx, WatchEventDeleted, resource, 0); err != nil {
+			return err
+		}
+		return enqueueResourceEvent(ctx, resource, rortypes.K8sActionDelete)
+	})
 	if err != nil {
-		rortracer.SpanError(span, err, "unable to send delete action on rabbit queue")
-		rlog.Errorc(ctx, "unable to send delete action on rabbit queue", err)
-	}
-	delErr := databaseHelpers.Del(ctx, resource)
-	if delErr != nil {
-		rortracer.SpanError(span, delErr, "failed to delete resource")
-		return delErr
+		rortracer.SpanError(span, err, "failed to delete resource")
+		return err
 	}
+	publishResourceEvent(ctx, resource, rortypes.K8sActionDelete)
 	rortracer.SpanOk(span)
 	return nil
 }
 
 // PatchResource applies a partial update to an existing resource. Only the
 // fields present in the partial document are modified; all other fields are
-// preserved. The resource must already exist.
-func PatchResource(ctx context.Context, uid string, partial *rorresources.Resource) rorresources.ResourceUpdateResults {
+// preserved. The resource must already exist. When a precondition is given the
+// patch is only applied if the stored version matches it, a mismatch returns
+// 412 and a concurrent write between the check and the patch returns 409. The
+// version of the patched resource is returned with the result.
+func PatchResource(ctx context.Context, uid string, partial *rorresources.Resource, precondition *ResourcePrecondition) (rorresources.ResourceUpdateResults, int64) {
 	ctx, span := rortracer.StartSpan(ctx, "v2.resourcesv2service.PatchResource")
 	defer span.End()
 	span.SetAttributes(attribute.String("resource.uid", uid))
@@ -366,7 +402,7 @@ func PatchResource(ctx context.Context, uid string, partial *rorresources.Resour
 					Message: "500: Could not get resource",
 				},
 			},
-		}
+		}, 0
 	}
 	if existing == nil || len(existing.Resources) == 0 {
 		_ = rortracer.SpanErrorf(span, "resource not found")
@@ -377,7 +413,7 @@ func PatchResource(ctx context.Context, uid string, partial *rorresources.Resour
 					Message: "404: Resource not found",
 				},
 			},
-		}
+		}, 0
 	}
 	resource := existing.Resources[0]
 
@@ -391,14 +427,60 @@ func PatchResource(ctx context.Context, uid string, partial *rorresources.Resour
 					Message: "403: No access",
 				},
 			},
-		}
+		}, 0
 	}
 
-	databaseHelpers := NewResourceMongoDB(mongodb.GetMongodbConnection())
+	databaseHelpers := newResourceDB(getMongoConnection())
 	mongoCtx, cancel := context.WithTimeout(ctx, setTimeout)
 	defer cancel()
 
-	err = databaseHelpers.Patch(mongoCtx, uid, partial)
+	expected, err := checkPrecondition(mongoCtx, databaseHelpers, uid, precondition)
+	if err != nil {
+		rortracer.SpanError(span, err, "precondition failed")
+		if errors.Is(err, ErrPreconditionFailed) {
+			return rorresources.ResourceUpdateResults{
+				Results: map[string]rorresources.ResourceUpdateResult{
+					uid: {
+						Status:  http.StatusPreconditionFailed,
+						Message: "412: Resource version does not match",
+					},
+				},
+			}, 0
+		}
+		rlog.Errorc(ctx, "Failed to get resource version before patch", err)
+		return rorresources.ResourceUpdateResults{
+			Results: map[string]rorresources.ResourceUpdateResult{
+				uid: {
+					Status:  http.StatusInternalServerError,
+					Message: "500: Could not get resource version",
+				},
+			},
+		}, 0
+	}
+
+	var version int64
+	err = runVersioned(mongoCtx, func(ctx context.Context) error {
+		var err error
+		version, err = databaseHelpers.PatchWithVersion(ctx, uid, partial, expected)
+		if err != nil {
+			return err
+		}
+		if err := recordWatchEventForUID(ctx, WatchEventModified, uid); err != nil {
+			return err
+		}
+		return enqueueResourceEvent(ctx, resource, rortypes.K8sActionUpdate)
+	})
+	if errors.Is(err, ErrResourceVersionConflict) {
+		rortracer.SpanError(span, err, "resource version conflict")
+		return rorresources.ResourceUpdateResults{
+			Results: map[string]rorresources.ResourceUpdateResult{
+				uid: {
+					Status:  http.StatusConflict,
+					Message: "409: Resource was modified concurrently",
+				},
+			},
+		}, 0
+	}
 	if err != nil {
 		rlog.Errorc(ctx, "Failed to patch resource", err)
 		rortracer.SpanError(span, err, "failed to patch resource")
@@ -409,13 +491,10 @@ func PatchResource(ctx context.Context, uid string, partial *rorresources.Resour
 					Message: "500: Could not patch resource",
 				},
 			},
-		}
+		}, 0
 	}
 
-	if err := sendToMessageBus(ctx, resource, rortypes.K8sActionUpdate); err != nil {
-		rlog.Errorc(ctx, "Failed to send message to bus", err)
-		rortracer.SpanError(span, err, "failed to send message to bus")
-	}
+	publishResourceEvent(ctx, resource, rortypes.K8sActionUpdate)
 
 	rortracer.SpanOk(span)
 	return rorresources.ResourceUpdateResults{
@@ -425,7 +504,7 @@ func PatchResource(ctx context.Context, uid string, partial *rorresources.Resour
 				Message: "200: Resource patched",
 			},
 		},
-	}
+	}, version
 }
 
 func GetResourceByQuery(ctx context.Context, query *rorresources.ResourceQuery) (*rorresources.ResourceSet, error) {
@@ -459,7 +538,10 @@ func GetResourceByQuery(ctx context.Context, query *rorresources.ResourceQuery)
 	return rs, nil
 }
 
-func sendToMessageBus(ctx context.Context, resource *rorresources.Resource, action rortypes.ResourceAction) error {
+// enqueueResourceEvent stores the resource event in the outbox for the message
+// bus. It is called with the context of the transaction writing the resource,
+// so the event is only stored if the write is.
+func enqueueResourceEvent(ctx context.Context, resource *rorresources.Resource, action rortypes.ResourceAction) error {
 	b, err := json.Marshal(resource)
 	if err != nil {
 		return errors.New("could not cast resource to byte[]")
@@ -480,24 +562,50 @@ func sendToMessageBus(ctx context.Context, resource *rorresources.Resource, acti
 		return errors.New("could not cast resource to ResourceNamespace")
 	}
 
+	var route string
 	switch action {
 	case rortypes.K8sActionAdd:
-		_ = apiconnections.RabbitMQConnection.SendMessage(ctx,
-			payload,
-			messagebuscontracts.Route_ResourceCreated,
-			map[string]any{"apiVersion": payload.ApiVersion, "kind": payload.Kind})
+		route = messagebuscontracts.Route_ResourceCreated
 	case rortypes.K8sActionUpdate:
-		_ = apiconnections.RabbitMQConnection.SendMessage(ctx,
-			payload,
-			messagebuscontracts.Route_ResourceUpdated,
-			map[string]any{"apiVersion": payload.ApiVersion, "kind": payload.Kind})
+		route = messagebuscontracts.Route_ResourceUpdated
 	case rortypes.K8sActionDelete:
-		_ = apiconnections.RabbitMQConnection.SendMessage(ctx,
-			payload,
-			messagebuscontracts.Route_ResourceDeleted,
-			map[string]any{"apiVersion": payload.ApiVersion, "kind": payload.Kind})
+		route = messagebuscontracts.Route_ResourceDeleted
+	}
+	if route == "" {
+		return nil
+	}
+	// The event is stored in the outbox and published by the relay, so it is
+	// not lost when the message bus is unavailable.
+	return outboxservice.Enqueue(ctx, route, payload, map[string]string{"apiVersion": payload.ApiVersion, "kind": payload.Kind})
+}
+
+// publishResourceEvent sends a resource change to the v2 event servers, which
+// deliver it to clients subscribed to the kind or the owning cluster.
+func publishResourceEvent(ctx context.Context, resource *rorresources.Resource, action rortypes.ResourceAction) {
+	var eventType string
+	switch action {
+	case rortypes.K8sActionAdd:
+		eventType = sseservice.SseEventResourceCreated
+	case rortypes.K8sActionUpdate:
+		eventType = sseservice.SseEventResourceUpdated
+	case rortypes.K8sActionDelete:
+		eventType = sseservice.SseEventResourceDeleted
+	default:
+		return
+	}
+
+	event, err := sseservice.NewResourceEvent(eventType, sseservice.ResourceEventData{
+		Uid:        resource.GetUID(),
+		ApiVersion: resource.GetAPIVersion(),
+		Kind:       resource.GetKind(),
+	}, resource.GetRorMeta().Ownerref)
+	if err != nil {
+		rlog.Errorc(ctx, "could not create resource event", err, rlog.String("uid", resource.GetUID()))
+		return
+	}
+	if err := sseservice.PublishEvent(ctx, apiconnections.RabbitMQConnection, event); err != nil {
+		rlog.Errorc(ctx, "could not send resource event", err, rlog.String("uid", resource.GetUID()))
 	}
-	return nil
 }
 
 func ResourceGetHashlist(ctx context.Context, owner rorresourceowner.RorResourceOwnerReference) (apiresourcecontracts.HashList, error) {
@@ -21,14 +21,46 @@ func (s stubResourceDB) Set(ctx context.Context, resource *rorresources.Resource
 	return nil
 }
 
+func (s stubResourceDB) Upsert(ctx context.Context, resource *rorresources.Resource) (ResourceWriteResult, error) {
+	return ResourceWriteResult{}, nil
+}
+
+func (s stubResourceDB) BulkWrite(ctx context.Context, operations []ResourceBulkOperation) ([]ResourceBulkResult, error) {
+	return make([]ResourceBulkResult, len(operations)), nil
+}
+
 func (s stubResourceDB) Patch(ctx context.Context, uid string, partial *rorresources.Resource) error {
 	return nil
 }
 
+func (s stubResourceDB) PatchWithVersion(ctx context.Context, uid string, partial *rorresources.Resource, expected *int64) (int64, error) {
+	return 0, nil
+}
+
+func (s stubResourceDB) GetVersion(ctx context.Context, uid string) (int64, error) {
+	return 0, nil
+}
+
+func (s stubResourceDB) BumpVersion(ctx context.Context, uid string, expected *int64) (int64, error) {
+	return 0, nil
+}
+
 func (s stubResourceDB) Get(ctx context.Context, query *rorresources.ResourceQuery) (*rorresources.ResourceSet, error) {
 	return s.getFn(ctx, query)
 }
 
+func (s stubResourceDB) GetPage(ctx context.Context, query *rorresources.ResourceQuery, cursor *ResourceCursor, pageSize int) (*rorresources.ResourceSet, *ResourceCursor, error) {
+	return rorresources.NewResourceSet(), nil, nil
+}
+
+func (s stubResourceDB) Count(ctx context.Context, query *rorresources.ResourceQuery) (int64, bool, error) {
+	return 0, false, nil
+}
+
+func (s stubResourceDB) Aggregate(ctx context.Context, aggregateQuery *ResourceAggregateQuery) (*ResourceAggregateResult, error) {
+	return &ResourceAggregateResult{}, nil
+}
+
 func (s stubResourceDB) Del(ctx context.Context, resource *rorresources.Resource) error {
 	return nil
 }
@@ -66,7 +98,7 @@ func TestPatchResource_ReturnsInternalServerErrorWhenGetResourceByUIDFails(t *te
 	}
 	t.Cleanup(func() { newResourceDB = origNewResourceDB })
 
-	result := PatchResource(testCtx(), "uid-123", makeResource("uid-123", "Pod", nil, nil))
+	result, _ := PatchResource(testCtx(), "uid-123", makeResource("uid-123", "Pod", nil, nil), nil)
 
 	require.Contains(t, result.Results, "uid-123")
 	assert.Equal(t, http.StatusInternalServerError, result.Results["uid-123"].Status)
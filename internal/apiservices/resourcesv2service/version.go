@@ -0,0 +1,191 @@
+package resourcesv2service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/NorskHelsenett/ror/pkg/clients/mongodb"
+	"github.com/NorskHelsenett/ror/pkg/rorresources"
+	"github.com/NorskHelsenett/ror/pkg/telemetry/rortracer"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// resourceVersionField is the document field holding the resource version in
+// the resourcesv2 collection. Versions are taken from the same sequence as
+// watch events, so a resource version is also a valid watch resume point.
+const resourceVersionField = "_resourceversion"
+
+var (
+	ErrResourceNotFound        = errors.New("resource not found")
+	ErrPreconditionFailed      = errors.New("resource version does not match If-Match")
+	ErrResourceVersionConflict = errors.New("resource was modified concurrently")
+)
+
+// ResourcePrecondition is a parsed If-Match header.
+type ResourcePrecondition struct {
+	wildcard bool
+	versions []int64
+}
+
+// ParseIfMatch parses an If-Match header value. It returns nil when the header
+// is empty. Weak and malformed entity tags never match, as If-Match requires
+// strong comparison.
+func ParseIfMatch(header string) *ResourcePrecondition {
+	header = strings.TrimSpace(header)
+	if header == "" {
+		return nil
+	}
+	if header == "*" {
+		return &ResourcePrecondition{wildcard: true}
+	}
+
+	precondition := &ResourcePrecondition{}
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if strings.HasPrefix(tag, "W/") {
+			continue
+		}
+		tag, ok := strings.CutPrefix(tag, `"`)
+		if !ok {
+			continue
+		}
+		tag, ok = strings.CutSuffix(tag, `"`)
+		if !ok {
+			continue
+		}
+		version, err := strconv.ParseInt(tag, 10, 64)
+		if err != nil || version < 0 {
+			continue
+		}
+		precondition.versions = append(precondition.versions, version)
+	}
+	return precondition
+}
+
+// Matches reports whether the precondition holds for the given stored version.
+func (p *ResourcePrecondition) Matches(version int64) bool {
+	if p == nil || p.wildcard {
+		return true
+	}
+	for _, v := range p.versions {
+		if v == version {
+			return true
+		}
+	}
+	return false
+}
+
+// ResourceVersionETag formats a resource version as a strong entity tag.
+func ResourceVersionETag(version int64) string {
+	return `"` + strconv.FormatInt(version, 10) + `"`
+}
+
+// GetResourceVersion returns the current version of the resource with the
+// given uid. It does not check access, callers must already have checked
+// read access to the resource.
+func GetResourceVersion(ctx context.Context, uid string) (int64, error) {
+	ctx, span := rortracer.StartSpan(ctx, "v2.resourcesv2service.GetResourceVersion")
+	defer span.End()
+	span.SetAttributes(attribute.String("resource.uid", uid))
+
+	mongoCtx, cancel := context.WithTimeout(ctx, getTimeout)
+	defer cancel()
+
+	version, err := newResourceDB(getMongoConnection()).GetVersion(mongoCtx, uid)
+	if err != nil {
+		rortracer.SpanError(span, err, "could not get resource version")
+		return 0, err
+	}
+	rortracer.SpanOk(span)
+	return version, nil
+}
+
+// WriteWithResourceVersion runs write, a write of the resource with the given
+// uid that does not go through the resourcesv2 collection, in one transaction
+// with advancing the version of the resource, so other writers holding the old
+// version are rejected and a failed write leaves the version as it was. It
+// returns the version of the stored resource. A resource that does not exist
+// in resourcesv2 is only an error when a precondition is given, its version
+// is 0. It does not check access, callers must already have checked update
+// access.
+func WriteWithResourceVersion(ctx context.Context, uid string, precondition *ResourcePrecondition, write func(ctx context.Context) error) (int64, error) {
+	ctx, span := rortracer.StartSpan(ctx, "v2.resourcesv2service.WriteWithResourceVersion")
+	defer span.End()
+	span.SetAttributes(attribute.String("resource.uid", uid))
+
+	mongoCtx, cancel := context.WithTimeout(ctx, setTimeout)
+	defer cancel()
+
+	databaseHelpers := newResourceDB(getMongoConnection())
+	var stored bson.M
+	err := runVersioned(mongoCtx, func(ctx context.Context) error {
+		stored = nil
+		expected, err := checkPrecondition(ctx, databaseHelpers, uid, precondition)
+		if err != nil {
+			return err
+		}
+		_, err = databaseHelpers.BumpVersion(ctx, uid, expected)
+		switch {
+		case err == nil:
+			err = mongodb.GetMongoDb().Collection(RESOURCECOLLECTION).FindOne(ctx, bson.M{"uid": uid}).Decode(&stored)
+			if err != nil {
+				return fmt.Errorf("could not get resource with uid %s: %w", uid, err)
+			}
+			// The bump is recorded as a change so watchers do not wait on
+			// its version.
+			if err := recordWatchEvent(ctx, WatchEventModified, stored); err != nil {
+				return err
+			}
+		case precondition == nil && errors.Is(err, ErrResourceNotFound):
+		default:
+			return err
+		}
+		return write(ctx)
+	})
+	if err != nil {
+		rortracer.SpanError(span, err, "could not write resource")
+		return 0, err
+	}
+	if stored == nil {
+		rortracer.SpanOk(span)
+		return 0, nil
+	}
+
+	// The version is taken from the document as stored.
+	version, _ := stored[resourceVersionField].(int64)
+	rortracer.SpanOk(span)
+	return version, nil
+}
+
+// checkPrecondition evaluates the precondition against the stored version and
+// returns the version a conditional write must expect, or nil when the write
+// is unconditional.
+func checkPrecondition(ctx context.Context, db ResourceDBProvider, uid string, precondition *ResourcePrecondition) (*int64, error) {
+	if precondition == nil {
+		return nil, nil
+	}
+	current, err := db.GetVersion(ctx, uid)
+	if err != nil {
+		if errors.Is(err, ErrResourceNotFound) {
+			return nil, fmt.Errorf("%w: %w", ErrPreconditionFailed, err)
+		}
+		return nil, err
+	}
+	if !precondition.Matches(current) {
+		return nil, fmt.Errorf("resource with uid %s has version %d: %w", uid, current, ErrPreconditionFailed)
+	}
+	return &current, nil
+}
+
+// ResourceWriteResults are the results of writing resources with the version
+// each written resource was stored with, keyed by uid, as
+// rorresources.ResourceUpdateResult has no field for it.
+type ResourceWriteResults struct {
+	rorresources.ResourceUpdateResults
+	Versions map[string]int64 `json:"versions,omitempty"`
+}
@@ -0,0 +1,31 @@
+package resourcesv2service
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseIfMatch(t *testing.T) {
+	tests := []struct {
+		name    string
+		header  string
+		version int64
+		want    bool
+	}{
+		{name: "no header matches", header: "", version: 3, want: true},
+		{name: "wildcard matches", header: "*", version: 3, want: true},
+		{name: "same version", header: `"3"`, version: 3, want: true},
+		{name: "other version", header: `"2"`, version: 3, want: false},
+		{name: "list with match", header: `"1", "3"`, version: 3, want: true},
+		{name: "weak tag never matches", header: `W/"3"`, version: 3, want: false},
+		{name: "unquoted tag never matches", header: "3", version: 3, want: false},
+		{name: "legacy version", header: ResourceVersionETag(0), version: 0, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, ParseIfMatch(tt.header).Matches(tt.version))
+		})
+	}
+}
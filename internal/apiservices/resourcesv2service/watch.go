@@ -0,0 +1,686 @@
+package resourcesv2service
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/NorskHelsenett/ror-api/internal/acl/aclservice"
+	"github.com/NorskHelsenett/ror-api/internal/databases/mongodb/mongotransaction"
+
+	"github.com/NorskHelsenett/ror/pkg/clients/mongodb"
+	"github.com/NorskHelsenett/ror/pkg/helpers/rorerror/v2"
+	"github.com/NorskHelsenett/ror/pkg/models/aclmodels"
+	"github.com/NorskHelsenett/ror/pkg/rlog"
+	"github.com/NorskHelsenett/ror/pkg/rorresources"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+const (
+	// WATCHCOLLECTION holds one document per resource change. Each document is
+	// the stored resource document with the watch fields added, so the same
+	// ACL and query $match stages used against resourcesv2 apply unchanged.
+	WATCHCOLLECTION = "resourcesv2watch"
+	// COUNTERCOLLECTION holds named monotonically increasing sequences.
+	COUNTERCOLLECTION = "resourcesv2counters"
+
+	resourceVersionCounter = "resourceversion"
+	bookmarkPrefix         = "rv:"
+)
+
+// WatchEventType is the type of change reported on a resource watch.
+type WatchEventType string
+
+const (
+	WatchEventAdded    WatchEventType = "ADDED"
+	WatchEventModified WatchEventType = "MODIFIED"
+	WatchEventDeleted  WatchEventType = "DELETED"
+	WatchEventBookmark WatchEventType = "BOOKMARK"
+
+	// watchEventSkipped marks a reserved resource version that no change is
+	// recorded for, so watchers can pass it.
+	watchEventSkipped WatchEventType = "SKIPPED"
+)
+
+var (
+	// ErrWatchExpired is returned when a watch is resumed from a resource
+	// version that is older than the retained change history.
+	ErrWatchExpired = errors.New("resource version is too old")
+	// ErrInvalidResumePoint is returned when a resourceVersion or bookmark
+	// token could not be parsed.
+	ErrInvalidResumePoint = errors.New("invalid resourceVersion or bookmark")
+
+	watchPollInterval       = 2 * time.Second
+	watchBookmarkInterval   = 30 * time.Second
+	watchAclRefreshInterval = time.Minute
+	watchBatchSize          = 500
+	// watchGapTimeout is how long a watch waits for a missing resource
+	// version once a later one is recorded. Versions are reserved before the
+	// write transaction and recorded when it commits, so they are recorded
+	// out of order, and versions of failed writes are recorded as skipped
+	// unless the recording fails.
+	watchGapTimeout = 10 * time.Second
+
+	watchNotifier = newWatchBroadcaster()
+)
+
+// WatchEvent is a single event delivered to a watching client.
+type WatchEvent struct {
+	Type            WatchEventType         `json:"type"`
+	ResourceVersion string                 `json:"resourceVersion"`
+	Bookmark        string                 `json:"bookmark,omitempty"`
+	Object          *rorresources.Resource `json:"object,omitempty"`
+}
+
+// watchEventMeta holds the watch fields added to a stored resource document.
+type watchEventMeta struct {
+	Seq  int64          `bson:"_watchseq"`
+	Type WatchEventType `bson:"_watchtype"`
+	Time time.Time      `bson:"_watchtime"`
+}
+
+// watchBroadcaster wakes up local watchers when this replica records an
+// event. Events recorded by other replicas are picked up by polling.
+type watchBroadcaster struct {
+	lock sync.Mutex
+	ch   chan struct{}
+}
+
+func newWatchBroadcaster() *watchBroadcaster {
+	return &watchBroadcaster{ch: make(chan struct{})}
+}
+
+func (b *watchBroadcaster) wait() <-chan struct{} {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.ch
+}
+
+func (b *watchBroadcaster) notify() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	close(b.ch)
+	b.ch = make(chan struct{})
+}
+
+// NextResourceVersion increments and returns the global resource version
+// sequence.
+func NextResourceVersion(ctx context.Context) (int64, error) {
+	return reserveResourceVersions(ctx, 1)
+}
+
+// reserveResourceVersions increments the global resource version sequence by
+// count and returns the last reserved version. The reserved range is
+// (last-count, last]. The sequence is incremented outside any transaction of
+// ctx, so concurrent write transactions do not conflict on the counter. The
+// versions reserved in a transaction run by runVersioned are recorded as
+// skipped when it does not commit.
+func reserveResourceVersions(ctx context.Context, count int) (int64, error) {
+	collection := mongodb.GetMongoDb().Collection(COUNTERCOLLECTION)
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+
+	var counter struct {
+		Seq int64 `bson:"seq"`
+	}
+	err := collection.FindOneAndUpdate(mongo.NewSessionContext(ctx, nil),
+		bson.M{"_id": resourceVersionCounter},
+		bson.M{"$inc": bson.M{"seq": int64(count)}},
+		opts,
+	).Decode(&counter)
+	if err != nil {
+		return 0, fmt.Errorf("could not increment resource version: %w", err)
+	}
+	if reserved, ok := ctx.Value(reservedVersionsKey{}).(*reservedVersions); ok {
+		reserved.add(counter.Seq-int64(count)+1, counter.Seq)
+	}
+	return counter.Seq, nil
+}
+
+type reservedVersionsKey struct{}
+
+// reservedVersions are the resource versions reserved by the attempts of a
+// transaction.
+type reservedVersions struct {
+	lock     sync.Mutex
+	attempt  []int64
+	released []int64
+}
+
+func (r *reservedVersions) add(first int64, last int64) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	for version := first; version <= last; version++ {
+		r.attempt = append(r.attempt, version)
+	}
+}
+
+// release moves the versions of the current attempt to the released ones.
+func (r *reservedVersions) release() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.released = append(r.released, r.attempt...)
+	r.attempt = nil
+}
+
+// runVersioned runs fn in a transaction like mongotransaction.Run. The
+// resource versions reserved by an attempt that is not committed are
+// recorded as skipped, so watchers do not wait for them, and local watchers
+// are woken when it commits.
+func runVersioned(ctx context.Context, fn func(ctx context.Context) error) error {
+	reserved := &reservedVersions{}
+	versionedCtx := context.WithValue(ctx, reservedVersionsKey{}, reserved)
+	err := mongotransaction.Run(versionedCtx, func(ctx context.Context) error {
+		reserved.release()
+		return fn(ctx)
+	})
+	if err != nil {
+		reserved.release()
+	}
+	skipResourceVersions(ctx, reserved.released...)
+	if err == nil {
+		watchNotifier.notify()
+	}
+	return err
+}
+
+// skipResourceVersions records the versions as skipped, for reserved versions
+// no change is going to be recorded for. Skipped versions are never
+// delivered to watchers. It is recorded outside any transaction of ctx.
+func skipResourceVersions(ctx context.Context, versions ...int64) {
+	if len(versions) == 0 {
+		return
+	}
+	now := time.Now()
+	events := make([]any, 0, len(versions))
+	for _, version := range versions {
+		events = append(events, watchEventMeta{Seq: version, Type: watchEventSkipped, Time: now})
+	}
+	opts := options.InsertMany().SetOrdered(false)
+	_, err := mongodb.GetMongoDb().Collection(WATCHCOLLECTION).InsertMany(mongo.NewSessionContext(ctx, nil), events, opts)
+	// A version recorded already, e.g. by the write or a retry, is kept.
+	if err != nil && !mongo.IsDuplicateKeyError(err) {
+		rlog.Errorc(ctx, "could not record skipped resource versions", err, rlog.Int("versions", len(versions)))
+		return
+	}
+	watchNotifier.notify()
+}
+
+// CurrentResourceVersion returns the latest resource version handed out
+// without incrementing it.
+func CurrentResourceVersion(ctx context.Context) (int64, error) {
+	collection := mongodb.GetMongoDb().Collection(COUNTERCOLLECTION)
+
+	var counter struct {
+		Seq int64 `bson:"seq"`
+	}
+	err := collection.FindOne(ctx, bson.M{"_id": resourceVersionCounter}).Decode(&counter)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("could not get resource version: %w", err)
+	}
+	return counter.Seq, nil
+}
+
+// watchEventInput is a change to be recorded as a watch event.
+type watchEventInput struct {
+	eventType WatchEventType
+	doc       bson.M
+}
+
+// recordWatchEvent stores a change event for the given resource document.
+// It is recorded in the transaction of the write, see recordWatchEvents.
+func recordWatchEvent(ctx context.Context, eventType WatchEventType, doc bson.M) error {
+	return recordWatchEvents(ctx, []watchEventInput{{eventType: eventType, doc: doc}})
+}
+
+// recordWatchEvents stores change events in order. An event for a document
+// carrying a resource version uses that version, other events (deletes) get a
+// new version reserved in a single counter update. The events are recorded
+// in the transaction of the write run by runVersioned, so an event is
+// recorded if and only if its write is, and watchers are woken when it
+// commits. Events of resources pending purge carry the mark, so they are
+// hidden from watchers like the resources are from reads.
+func recordWatchEvents(ctx context.Context, inputs []watchEventInput) error {
+	if len(inputs) == 0 {
+		return nil
+	}
+	unversioned := 0
+	for _, input := range inputs {
+		if _, ok := input.doc[resourceVersionField].(int64); !ok {
+			unversioned++
+		}
+	}
+	var next int64
+	if unversioned > 0 {
+		last, err := reserveResourceVersions(ctx, unversioned)
+		if err != nil {
+			return fmt.Errorf("could not record watch event: %w", err)
+		}
+		next = last - int64(unversioned)
+	}
+	pendingPurge, err := pendingPurgeMarks(ctx, inputs)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	events := make([]any, 0, len(inputs))
+	for _, input := range inputs {
+		event := make(bson.M, len(input.doc)+4)
+		for key, value := range input.doc {
+			if key == "_id" {
+				continue
+			}
+			event[key] = value
+		}
+		if mark, ok := pendingPurge[event["uid"]]; ok {
+			event[PendingPurgeField] = mark
+		}
+		seq, ok := input.doc[resourceVersionField].(int64)
+		if !ok {
+			next++
+			seq = next
+		}
+		event["_watchseq"] = seq
+		event["_watchtype"] = input.eventType
+		event["_watchtime"] = now
+		events = append(events, event)
+	}
+
+	_, err = mongodb.GetMongoDb().Collection(WATCHCOLLECTION).InsertMany(ctx, events)
+	if err != nil {
+		return fmt.Errorf("could not record %d watch events: %w", len(events), err)
+	}
+	return nil
+}
+
+// pendingPurgeMarks returns the pending purge marks, keyed by uid, of the
+// stored resources of the events that do not carry one.
+func pendingPurgeMarks(ctx context.Context, inputs []watchEventInput) (map[any]any, error) {
+	uids := make(bson.A, 0, len(inputs))
+	for _, input := range inputs {
+		if _, marked := input.doc[PendingPurgeField]; !marked {
+			uids = append(uids, input.doc["uid"])
+		}
+	}
+	if len(uids) == 0 {
+		return nil, nil
+	}
+
+	opts := options.Find().SetProjection(bson.M{"uid": 1, PendingPurgeField: 1})
+	cursor, err := mongodb.GetMongoDb().Collection(RESOURCECOLLECTION).Find(ctx,
+		bson.M{"uid": bson.M{"$in": uids}, PendingPurgeField: bson.M{"$exists": true}},
+		opts,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("could not get pending purge marks: %w", err)
+	}
+	var docs []bson.M
+	if err := cursor.All(ctx, &docs); err != nil {
+		return nil, fmt.Errorf("could not decode pending purge marks: %w", err)
+	}
+	marks := make(map[any]any, len(docs))
+	for _, doc := range docs {
+		marks[doc["uid"]] = doc[PendingPurgeField]
+	}
+	return marks, nil
+}
+
+// recordWatchEventForResource stores a change event for a resource written
+// with the given resource version, 0 reserves a new version for the event.
+func recordWatchEventForResource(ctx context.Context, eventType WatchEventType, resource *rorresources.Resource, version int64) error {
+	doc, err := resourceToDoc(ctx, resource)
+	if err != nil {
+		return fmt.Errorf("could not record watch event: %w", err)
+	}
+	if version > 0 {
+		doc[resourceVersionField] = version
+	}
+	return recordWatchEvent(ctx, eventType, doc)
+}
+
+// recordWatchEventForUID stores a change event for the currently stored
+// version of the resource with the given uid.
+func recordWatchEventForUID(ctx context.Context, eventType WatchEventType, uid string) error {
+	var doc bson.M
+	err := mongodb.GetMongoDb().Collection(RESOURCECOLLECTION).FindOne(ctx, bson.M{"uid": uid}).Decode(&doc)
+	if err != nil {
+		return fmt.Errorf("could not record watch event of resource with uid %s: %w", uid, err)
+	}
+	return recordWatchEvent(ctx, eventType, doc)
+}
+
+// DeleteWatchEvents deletes the resources of the watch events matching the
+// filter. The events are kept as skipped versions, so watchers do not wait
+// for their versions and the retained versions are not shortened.
+func DeleteWatchEvents(ctx context.Context, filter bson.M) (int64, error) {
+	result, err := mongodb.GetMongoDb().Collection(WATCHCOLLECTION).UpdateMany(ctx, filter, bson.A{
+		bson.M{"$replaceWith": bson.M{
+			"_id":        "$_id",
+			"_watchseq":  "$_watchseq",
+			"_watchtype": watchEventSkipped,
+			"_watchtime": "$_watchtime",
+		}},
+	})
+	if err != nil {
+		return 0, fmt.Errorf("could not delete watch events: %w", err)
+	}
+	return result.ModifiedCount, nil
+}
+
+// NewBookmark returns an opaque bookmark token for the given resource version.
+func NewBookmark(resourceVersion int64) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(bookmarkPrefix + strconv.FormatInt(resourceVersion, 10)))
+}
+
+// ParseWatchResumePoint returns the resource version a watch should resume
+// from. A resourceVersion takes precedence over a bookmark token, which takes
+// precedence over the SSE Last-Event-ID. Zero means "start from now".
+func ParseWatchResumePoint(resourceVersion string, bookmark string, lastEventId string) (int64, error) {
+	if resourceVersion == "" && bookmark != "" {
+		decoded, err := base64.RawURLEncoding.DecodeString(bookmark)
+		if err != nil || !strings.HasPrefix(string(decoded), bookmarkPrefix) {
+			return 0, ErrInvalidResumePoint
+		}
+		resourceVersion = strings.TrimPrefix(string(decoded), bookmarkPrefix)
+	}
+	if resourceVersion == "" {
+		resourceVersion = lastEventId
+	}
+	if resourceVersion == "" {
+		return 0, nil
+	}
+	version, err := strconv.ParseInt(resourceVersion, 10, 64)
+	if err != nil || version < 0 {
+		return 0, ErrInvalidResumePoint
+	}
+	return version, nil
+}
+
+// ResourceWatch streams changes to resources matching a query.
+type ResourceWatch struct {
+	query    *rorresources.ResourceQuery
+	match    bson.M
+	acl      bson.M
+	aclTime  time.Time
+	lastSeen int64
+}
+
+// NewResourceWatch validates the query and resume point and prepares a watch.
+// When resumeFrom is zero the watch starts at the last committed event.
+func NewResourceWatch(ctx context.Context, query *rorresources.ResourceQuery, resumeFrom int64) (*ResourceWatch, error) {
+	if query == nil {
+		return nil, rorerror.NewRorError(400, "empty resource query")
+	}
+	match, err := generateMatch(query)
+	if err != nil {
+		return nil, err
+	}
+
+	watch := &ResourceWatch{
+		query: query,
+		match: match,
+	}
+
+	if resumeFrom == 0 {
+		watch.lastSeen, err = startWatchSeq(ctx)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		current, err := CurrentResourceVersion(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if resumeFrom > current {
+			return nil, ErrInvalidResumePoint
+		}
+		oldest, err := oldestWatchSeq(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if resumeFrom < current && (oldest == 0 || oldest > resumeFrom+1) {
+			return nil, ErrWatchExpired
+		}
+		watch.lastSeen = resumeFrom
+	}
+	return watch, nil
+}
+
+// ResourceVersion returns the resource version of the last event delivered.
+func (w *ResourceWatch) ResourceVersion() int64 {
+	return w.lastSeen
+}
+
+// Run delivers events to out until the context is cancelled. A bookmark is
+// sent immediately and whenever the watch has been idle for the bookmark
+// interval so clients always hold a recent resume point.
+func (w *ResourceWatch) Run(ctx context.Context, out chan<- WatchEvent) error {
+	if !w.send(ctx, out, w.bookmark()) {
+		return ctx.Err()
+	}
+	lastSent := time.Now()
+
+	ticker := time.NewTicker(watchPollInterval)
+	defer ticker.Stop()
+
+	for {
+		wake := watchNotifier.wait()
+
+		events, more, err := w.next(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+		for _, event := range events {
+			if !w.send(ctx, out, event) {
+				return ctx.Err()
+			}
+			lastSent = time.Now()
+		}
+		if more {
+			continue
+		}
+		if time.Since(lastSent) >= watchBookmarkInterval {
+			if !w.send(ctx, out, w.bookmark()) {
+				return ctx.Err()
+			}
+			lastSent = time.Now()
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+func (w *ResourceWatch) send(ctx context.Context, out chan<- WatchEvent, event WatchEvent) bool {
+	select {
+	case out <- event:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func (w *ResourceWatch) bookmark() WatchEvent {
+	return WatchEvent{
+		Type:            WatchEventBookmark,
+		ResourceVersion: strconv.FormatInt(w.lastSeen, 10),
+		Bookmark:        NewBookmark(w.lastSeen),
+	}
+}
+
+// next fetches the committed events recorded after the last delivered one
+// that the caller is authorized to read and that match the watch query. more
+// is true when further committed events are waiting.
+func (w *ResourceWatch) next(ctx context.Context) ([]WatchEvent, bool, error) {
+	if w.acl == nil || time.Since(w.aclTime) > watchAclRefreshInterval {
+		w.acl = aclservice.GetOwnerrefByContextAccess(ctx, aclmodels.AccessTypeRead)
+		w.aclTime = time.Now()
+	}
+
+	mongoCtx, cancel := context.WithTimeout(ctx, getTimeout)
+	defer cancel()
+
+	committed, more, err := committedWatchSeq(mongoCtx, w.lastSeen, time.Now())
+	if err != nil {
+		return nil, false, err
+	}
+	if committed == w.lastSeen {
+		return nil, false, nil
+	}
+
+	pipeline := make([]bson.M, 0, 4)
+	if len(w.acl) > 0 {
+		pipeline = append(pipeline, w.acl)
+	}
+	match := make(bson.M, len(w.match)+1)
+	for key, value := range w.match {
+		match[key] = value
+	}
+	match["_watchseq"] = bson.M{"$gt": w.lastSeen, "$lte": committed}
+	match["_watchtype"] = bson.M{"$ne": watchEventSkipped}
+	match[PendingPurgeField] = bson.M{"$exists": false}
+	pipeline = append(pipeline,
+		bson.M{"$match": match},
+		bson.M{"$sort": bson.D{{Key: "_watchseq", Value: 1}}},
+		bson.M{"$limit": watchBatchSize},
+	)
+
+	var rawDocs []bson.Raw
+	if err := mongodb.Aggregate(mongoCtx, WATCHCOLLECTION, pipeline, &rawDocs); err != nil {
+		return nil, false, fmt.Errorf("could not query watch events: %w", err)
+	}
+
+	lastSeen := committed
+	if len(rawDocs) == watchBatchSize {
+		more = true
+	}
+	events := make([]WatchEvent, 0, len(rawDocs))
+	for i, raw := range rawDocs {
+		var meta watchEventMeta
+		if err := bson.Unmarshal(raw, &meta); err != nil {
+			return nil, false, fmt.Errorf("could not decode watch event: %w", err)
+		}
+		if i == watchBatchSize-1 {
+			lastSeen = meta.Seq
+		}
+		resource, err := resourceFromRawDoc(raw)
+		if err != nil {
+			rlog.Errorc(ctx, "could not decode watch event resource, skipping it", err, rlog.Int64("seq", meta.Seq))
+			continue
+		}
+		events = append(events, WatchEvent{
+			Type:            meta.Type,
+			ResourceVersion: strconv.FormatInt(meta.Seq, 10),
+			Object:          resource,
+		})
+	}
+	w.lastSeen = lastSeen
+	return events, more, nil
+}
+
+// committedWatchSeq returns the watch sequence after from up to which all
+// events are recorded, reading at most a batch of events. more is true when
+// the batch ended before the recorded events did.
+func committedWatchSeq(ctx context.Context, from int64, now time.Time) (int64, bool, error) {
+	opts := options.Find().
+		SetSort(bson.D{{Key: "_watchseq", Value: 1}}).
+		SetProjection(bson.M{"_watchseq": 1, "_watchtime": 1}).
+		SetLimit(int64(watchBatchSize))
+	cursor, err := mongodb.GetMongoDb().Collection(WATCHCOLLECTION).Find(ctx, bson.M{"_watchseq": bson.M{"$gt": from}}, opts)
+	if err != nil {
+		return from, false, fmt.Errorf("could not query watch events: %w", err)
+	}
+	var recorded []watchEventMeta
+	if err := cursor.All(ctx, &recorded); err != nil {
+		return from, false, fmt.Errorf("could not decode watch events: %w", err)
+	}
+
+	committed := committedSeq(from, recorded, now)
+	more := len(recorded) == watchBatchSize && committed == recorded[len(recorded)-1].Seq
+	return committed, more, nil
+}
+
+// committedSeq returns the last sequence of the recorded events, sorted by
+// sequence, that follows from without a gap. A gap is skipped once the event
+// after it has been recorded for watchGapTimeout, as the missing version was
+// reserved before it and is not going to be recorded.
+func committedSeq(from int64, recorded []watchEventMeta, now time.Time) int64 {
+	committed := from
+	for _, meta := range recorded {
+		if meta.Seq > committed+1 && now.Sub(meta.Time) < watchGapTimeout {
+			break
+		}
+		committed = meta.Seq
+	}
+	return committed
+}
+
+// startWatchSeq returns the committed watch sequence a new watch starts
+// after. It starts from the last event recorded before watchGapTimeout, so
+// events still being recorded for versions reserved before the watch started
+// are delivered.
+func startWatchSeq(ctx context.Context) (int64, error) {
+	now := time.Now()
+	opts := options.FindOne().SetSort(bson.D{{Key: "_watchseq", Value: -1}}).SetProjection(bson.M{"_watchseq": 1})
+
+	var meta watchEventMeta
+	err := mongodb.GetMongoDb().Collection(WATCHCOLLECTION).FindOne(ctx, bson.M{"_watchtime": bson.M{"$lte": now.Add(-watchGapTimeout)}}, opts).Decode(&meta)
+	if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+		return 0, fmt.Errorf("could not get watch start: %w", err)
+	}
+	start := meta.Seq
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		oldest, err := oldestWatchSeq(ctx)
+		if err != nil {
+			return 0, err
+		}
+		if oldest > 0 {
+			start = oldest - 1
+		}
+	}
+
+	for {
+		committed, more, err := committedWatchSeq(ctx, start, now)
+		if err != nil {
+			return 0, err
+		}
+		start = committed
+		if !more {
+			return start, nil
+		}
+	}
+}
+
+// oldestWatchSeq returns the oldest retained watch sequence, or zero if no
+// events are retained.
+func oldestWatchSeq(ctx context.Context) (int64, error) {
+	opts := options.FindOne().SetSort(bson.D{{Key: "_watchseq", Value: 1}}).SetProjection(bson.M{"_watchseq": 1})
+
+	var meta watchEventMeta
+	err := mongodb.GetMongoDb().Collection(WATCHCOLLECTION).FindOne(ctx, bson.M{}, opts).Decode(&meta)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("could not get oldest watch event: %w", err)
+	}
+	return meta.Seq, nil
+}
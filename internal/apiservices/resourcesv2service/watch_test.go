@@ -0,0 +1,78 @@
+package resourcesv2service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseWatchResumePoint(t *testing.T) {
+	tests := []struct {
+		name            string
+		resourceVersion string
+		bookmark        string
+		lastEventId     string
+		want            int64
+		wantErr         bool
+	}{
+		{name: "empty starts from now", want: 0},
+		{name: "resource version", resourceVersion: "42", want: 42},
+		{name: "bookmark", bookmark: NewBookmark(17), want: 17},
+		{name: "last event id", lastEventId: "7", want: 7},
+		{name: "resource version wins over bookmark", resourceVersion: "42", bookmark: NewBookmark(17), want: 42},
+		{name: "bookmark wins over last event id", bookmark: NewBookmark(17), lastEventId: "7", want: 17},
+		{name: "invalid resource version", resourceVersion: "abc", wantErr: true},
+		{name: "negative resource version", resourceVersion: "-1", wantErr: true},
+		{name: "invalid bookmark", bookmark: "not-a-bookmark", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseWatchResumePoint(tt.resourceVersion, tt.bookmark, tt.lastEventId)
+			if tt.wantErr {
+				require.ErrorIs(t, err, ErrInvalidResumePoint)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestCommittedSeq(t *testing.T) {
+	now := time.Now()
+	recent := now.Add(-time.Second)
+	old := now.Add(-2 * watchGapTimeout)
+
+	tests := []struct {
+		name     string
+		recorded []watchEventMeta
+		want     int64
+	}{
+		{name: "nothing recorded", want: 10},
+		{name: "contiguous", recorded: []watchEventMeta{{Seq: 11, Time: recent}, {Seq: 12, Time: recent}}, want: 12},
+		{name: "stops at a recent gap", recorded: []watchEventMeta{{Seq: 11, Time: recent}, {Seq: 13, Time: recent}, {Seq: 14, Time: recent}}, want: 11},
+		{name: "skips an old gap", recorded: []watchEventMeta{{Seq: 12, Time: old}, {Seq: 14, Time: recent}}, want: 12},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, committedSeq(10, tt.recorded, now))
+		})
+	}
+}
+
+func TestReservedVersions_ReleasesUncommittedAttempts(t *testing.T) {
+	reserved := &reservedVersions{}
+
+	// An attempt reserving versions 1-2 is retried, the retry reserves 3.
+	reserved.release()
+	reserved.add(1, 2)
+	reserved.release()
+	reserved.add(3, 3)
+
+	assert.Equal(t, []int64{1, 2}, reserved.released)
+	assert.Equal(t, []int64{3}, reserved.attempt)
+}
@@ -4,9 +4,13 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net/mail"
 
 	resourcesservice "github.com/NorskHelsenett/ror-api/internal/apiservices/resourcesService"
 	mongorulesets "github.com/NorskHelsenett/ror-api/internal/databases/mongodb/repositories/rulesets"
+	"github.com/NorskHelsenett/ror-api/internal/databases/mongodb/repositories/switchboarddeliveries"
+	"github.com/NorskHelsenett/ror-api/internal/models/switchboardmodels"
+	"github.com/NorskHelsenett/ror-api/pkg/helpers/publichttp"
 
 	aclmodels "github.com/NorskHelsenett/ror/pkg/models/aclmodels"
 
@@ -154,8 +158,17 @@ func AddResource(ctx context.Context, setId string, input *messages.RulesetResou
 	return model, nil
 }
 
-func AddResourceRule(ctx context.Context, setId string, resourceId string, input *messages.RulesetRuleInput) (*messages.RulesetRuleModel, error) {
-	model := new(messages.RulesetRuleModel)
+// ErrInvalidRule is returned when a rule lacks the target of its service.
+var ErrInvalidRule = errors.New("invalid rule")
+
+// AddResourceRule adds a rule to a resource of the ruleset. Webhook rules
+// must have a webhook url and email rules at least one recipient.
+func AddResourceRule(ctx context.Context, setId string, resourceId string, input *switchboardmodels.RuleInput) (*switchboardmodels.Rule, error) {
+	if err := validateRuleTargets(ctx, input); err != nil {
+		return nil, err
+	}
+
+	model := new(switchboardmodels.Rule)
 
 	model.Id = uuid.NewString()
 	model.Lifetime = input.Lifetime
@@ -163,6 +176,12 @@ func AddResourceRule(ctx context.Context, setId string, resourceId string, input
 	model.Service = input.Service
 
 	model.Slack = input.Slack
+	switch input.Service {
+	case switchboardmodels.ServiceTypeWebhook:
+		model.Webhook = input.Webhook
+	case switchboardmodels.ServiceTypeEmail:
+		model.Email = input.Email
+	}
 
 	set, err := mongorulesets.FindById(ctx, setId)
 	if err != nil {
@@ -201,3 +220,38 @@ func DeleteResourceRule(ctx context.Context, setId string, resourceId string, ru
 
 	return nil
 }
+
+// defaultDeliveriesLimit is how many deliveries GetDeliveries returns when no
+// limit is given.
+const defaultDeliveriesLimit = 100
+
+// GetDeliveries returns the latest notifications of the rules of the ruleset,
+// of the status if it is set.
+func GetDeliveries(ctx context.Context, setId string, status switchboardmodels.DeliveryStatus, limit int) ([]switchboardmodels.Delivery, error) {
+	if limit <= 0 {
+		limit = defaultDeliveriesLimit
+	}
+	return switchboarddeliveries.GetByRuleset(ctx, setId, status, int64(limit))
+}
+
+func validateRuleTargets(ctx context.Context, input *switchboardmodels.RuleInput) error {
+	switch input.Service {
+	case switchboardmodels.ServiceTypeWebhook:
+		if input.Webhook == nil {
+			return fmt.Errorf("%w: a webhook rule must have a webhook url", ErrInvalidRule)
+		}
+		if _, err := publichttp.ValidateUrl(ctx, input.Webhook.Url); err != nil {
+			return fmt.Errorf("%w: the webhook url must be a public https url: %v", ErrInvalidRule, err)
+		}
+	case switchboardmodels.ServiceTypeEmail:
+		if input.Email == nil || len(input.Email.To) == 0 {
+			return fmt.Errorf("%w: an email rule must have a recipient", ErrInvalidRule)
+		}
+		for _, to := range input.Email.To {
+			if _, err := mail.ParseAddress(to); err != nil {
+				return fmt.Errorf("%w: invalid recipient %q", ErrInvalidRule, to)
+			}
+		}
+	}
+	return nil
+}
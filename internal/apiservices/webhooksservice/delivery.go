@@ -0,0 +1,331 @@
+package webhooksservice
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/NorskHelsenett/ror-api/internal/apiconnections"
+	"github.com/NorskHelsenett/ror-api/internal/databases/mongodb/repositories/webhooks"
+	"github.com/NorskHelsenett/ror-api/internal/models/webhookmodels"
+	"github.com/NorskHelsenett/ror-api/pkg/helpers/publichttp"
+	"github.com/NorskHelsenett/ror-api/pkg/services/sseservice"
+
+	"github.com/NorskHelsenett/ror/pkg/clients/rabbitmqclient"
+	"github.com/NorskHelsenett/ror/pkg/config/rorconfig"
+	"github.com/NorskHelsenett/ror/pkg/handlers/rabbitmqhandler"
+	identitymodels "github.com/NorskHelsenett/ror/pkg/models/identity"
+	"github.com/NorskHelsenett/ror/pkg/rlog"
+
+	"github.com/google/uuid"
+	amqp091 "github.com/rabbitmq/amqp091-go"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+const (
+	// QueueName is the queue of the v2 events shared by the replicas, so each
+	// event is matched against the webhooks once.
+	QueueName = "ror-api-webhooks"
+
+	defaultDispatchInterval = 5 * time.Second
+	defaultMaxAttempts      = 10
+	// claimLease is how long a dispatcher holds a delivery it is posting
+	// before another replica may take it over.
+	claimLease  = 2 * time.Minute
+	postTimeout = 10 * time.Second
+	minBackoff  = 5 * time.Second
+	maxBackoff  = time.Hour
+	// webhooksRefreshInterval is how long the webhooks are matched against
+	// before they are read again.
+	webhooksRefreshInterval = 10 * time.Second
+)
+
+var (
+	dispatchNotifier = make(chan struct{}, 1)
+
+	webhooksCache struct {
+		lock     sync.Mutex
+		webhooks []webhookmodels.Webhook
+		loadedAt time.Time
+	}
+)
+
+// Start consumes the v2 events of the message bus and posts the deliveries
+// until the context is done.
+func Start(ctx context.Context, connection rabbitmqclient.RabbitMQConnection) {
+	startConsumer(connection)
+	startDispatcher(ctx)
+}
+
+func startConsumer(rabbitMQConnection rabbitmqclient.RabbitMQConnection) {
+	go func() {
+		config := rabbitmqhandler.RabbitMQListnerConfig{
+			Client:             rabbitMQConnection,
+			QueueName:          QueueName,
+			Consumer:           "",
+			AutoAck:            false,
+			Exclusive:          false,
+			NoLocal:            false,
+			NoWait:             false,
+			Args:               amqp091.Table{"x-queue-type": "quorum"},
+			QueueAutoDelete:    false,
+			Exchange:           sseservice.SSEventsExchange,
+			ExcahngeKind:       "fanout",
+			ExcahngeDurable:    true,
+			ExchangeAutoDelete: true,
+		}
+		rabbithandler := rabbitmqhandler.New(config, webhookhandler{})
+		_ = rabbitMQConnection.RegisterHandler(rabbithandler)
+	}()
+}
+
+type webhookhandler struct {
+}
+
+func (wh webhookhandler) HandleMessage(ctx context.Context, message amqp091.Delivery) error {
+	if message.RoutingKey != sseservice.SSERouteBroadcast {
+		return nil
+	}
+
+	var event sseservice.SseEvent
+	if err := json.Unmarshal(message.Body, &event); err != nil {
+		rlog.Error("could not convert to json", err)
+		return err
+	}
+	return dispatch(ctx, event)
+}
+
+// dispatch stores a delivery of the event for each webhook it matches and
+// whose identity has read access to it. An event with an id is stored once
+// per webhook when the message bus redelivers it.
+func dispatch(ctx context.Context, event sseservice.SseEvent) error {
+	webhooksList, err := getWebhooks(ctx)
+	if err != nil {
+		return fmt.Errorf("could not get webhooks: %w", err)
+	}
+
+	owners := sseservice.EventOwners(event)
+	now := time.Now()
+	var errs []error
+	for _, webhook := range webhooksList {
+		if !matchWebhook(webhook, event.Event, event.Owner) || !CanRead(webhook.Identity, owners) {
+			continue
+		}
+
+		id := uuid.NewString()
+		if event.Id != 0 {
+			id = uuid.NewSHA1(uuid.NameSpaceOID, []byte(strconv.FormatInt(event.Id, 10)+"/"+webhook.Id)).String()
+		}
+		delivery := &webhookmodels.Delivery{
+			Id:        id,
+			WebhookId: webhook.Id,
+			Event: webhookmodels.Event{
+				Id:      id,
+				EventId: event.Id,
+				Type:    event.Event,
+				Owner:   event.Owner,
+				Data:    eventData(event.Data),
+				Time:    now,
+			},
+			Owners:        owners,
+			Status:        webhookmodels.DeliveryStatusPending,
+			CreatedAt:     now,
+			NextAttemptAt: now,
+			ClaimedUntil:  now,
+		}
+		if err := webhooks.CreateDelivery(ctx, delivery); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	notifyDispatcher()
+	return errors.Join(errs...)
+}
+
+// eventData returns the data of the event as JSON, data that is not JSON is
+// posted as a string.
+func eventData(data string) json.RawMessage {
+	if json.Valid([]byte(data)) {
+		return json.RawMessage(data)
+	}
+	quoted, _ := json.Marshal(data)
+	return quoted
+}
+
+func getWebhooks(ctx context.Context) ([]webhookmodels.Webhook, error) {
+	webhooksCache.lock.Lock()
+	defer webhooksCache.lock.Unlock()
+	if webhooksCache.webhooks != nil && time.Since(webhooksCache.loadedAt) < webhooksRefreshInterval {
+		return webhooksCache.webhooks, nil
+	}
+
+	webhooksList, err := webhooks.GetAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+	webhooksCache.webhooks = webhooksList
+	webhooksCache.loadedAt = time.Now()
+	return webhooksList, nil
+}
+
+func invalidateWebhooks() {
+	webhooksCache.lock.Lock()
+	defer webhooksCache.lock.Unlock()
+	webhooksCache.loadedAt = time.Time{}
+}
+
+// startDispatcher posts the deliveries when they are stored on this replica
+// and every WEBHOOK_DISPATCH_INTERVAL for the deliveries of other replicas
+// and retries.
+func startDispatcher(ctx context.Context) {
+	interval, err := time.ParseDuration(rorconfig.GetString("WEBHOOK_DISPATCH_INTERVAL"))
+	if err != nil || interval <= 0 {
+		rlog.Warn("invalid WEBHOOK_DISPATCH_INTERVAL, using the default", rlog.String("default", defaultDispatchInterval.String()))
+		interval = defaultDispatchInterval
+	}
+	maxAttempts, err := strconv.Atoi(rorconfig.GetString("WEBHOOK_MAX_ATTEMPTS"))
+	if err != nil || maxAttempts <= 0 {
+		rlog.Warn("invalid WEBHOOK_MAX_ATTEMPTS, using the default", rlog.Int("default", defaultMaxAttempts))
+		maxAttempts = defaultMaxAttempts
+	}
+
+	dispatcher := &dispatcher{client: publichttp.NewClient(postTimeout), maxAttempts: maxAttempts}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			case <-dispatchNotifier:
+			}
+			dispatcher.postPending(ctx)
+		}
+	}()
+}
+
+func notifyDispatcher() {
+	select {
+	case dispatchNotifier <- struct{}{}:
+	default:
+	}
+}
+
+type dispatcher struct {
+	client      *http.Client
+	maxAttempts int
+}
+
+// postPending posts the deliveries due until there are no more.
+func (d *dispatcher) postPending(ctx context.Context) {
+	for ctx.Err() == nil {
+		delivery, err := webhooks.ClaimDelivery(ctx, time.Now(), claimLease)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return
+		}
+		if err != nil {
+			rlog.Error("could not claim webhook delivery", err)
+			return
+		}
+
+		if err := d.deliver(ctx, delivery); err != nil {
+			rlog.Error("could not record webhook delivery", err, rlog.String("id", delivery.Id))
+		}
+	}
+}
+
+// deliver posts the delivery to its webhook and records the outcome. The
+// access of the webhook identity is checked again with its current groups, as
+// it may have been revoked since the event was matched.
+func (d *dispatcher) deliver(ctx context.Context, delivery webhookmodels.Delivery) error {
+	now := time.Now()
+	webhook, err := webhooks.GetById(ctx, delivery.WebhookId)
+	if errors.Is(err, webhooks.ErrNotFound) {
+		return webhooks.CompleteDelivery(ctx, delivery.Id, webhookmodels.DeliveryStatusDeadLetter, err, now)
+	}
+	if err != nil {
+		return err
+	}
+	identity, err := currentIdentity(ctx, webhook.Identity)
+	if err != nil {
+		return webhooks.CompleteDelivery(ctx, delivery.Id, webhookmodels.DeliveryStatusDenied, err, now)
+	}
+	if !CanRead(identity, delivery.Owners) {
+		return webhooks.CompleteDelivery(ctx, delivery.Id, webhookmodels.DeliveryStatusDenied, errors.New("the webhook has no access to the event"), now)
+	}
+
+	err = d.post(ctx, webhook, delivery)
+	now = time.Now()
+	if err == nil {
+		return webhooks.CompleteDelivery(ctx, delivery.Id, webhookmodels.DeliveryStatusDelivered, nil, now)
+	}
+
+	attempts := delivery.Attempts + 1
+	if attempts >= d.maxAttempts {
+		rlog.Warn("webhook delivery dead-lettered", rlog.String("id", delivery.Id), rlog.String("webhook", webhook.Id), rlog.Int("attempts", attempts), rlog.String("error", err.Error()))
+		return webhooks.CompleteDelivery(ctx, delivery.Id, webhookmodels.DeliveryStatusDeadLetter, err, now)
+	}
+	return webhooks.RetryDelivery(ctx, delivery.Id, err, now, now.Add(backoff(attempts)))
+}
+
+// currentIdentity returns the identity with the groups its user has now, the
+// groups stored with the webhook are those of when it was registered.
+func currentIdentity(ctx context.Context, identity identitymodels.Identity) (identitymodels.Identity, error) {
+	if identity.Type != identitymodels.IdentityTypeUser {
+		return identity, nil
+	}
+	if identity.User == nil {
+		return identity, errors.New("the webhook identity has no user")
+	}
+	user, err := apiconnections.DomainResolvers.GetUser(ctx, identity.User.Email)
+	if err != nil {
+		return identity, fmt.Errorf("could not get the user of the webhook: %w", err)
+	}
+	identity.User = user
+	return identity, nil
+}
+
+// post posts the event of the delivery to the webhook, signed with its
+// secret.
+func (d *dispatcher) post(ctx context.Context, webhook webhookmodels.Webhook, delivery webhookmodels.Delivery) error {
+	payload, err := json.Marshal(delivery.Event)
+	if err != nil {
+		return fmt.Errorf("could not marshal event: %w", err)
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.Url, bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("could not create request: %w", err)
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set(EventHeader, delivery.Event.Type)
+	request.Header.Set(DeliveryHeader, delivery.Id)
+	request.Header.Set(SignatureHeader, Sign(webhook.Secret, time.Now(), payload))
+
+	response, err := d.client.Do(request)
+	if err != nil {
+		return fmt.Errorf("could not post event: %w", err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return fmt.Errorf("event rejected with status %d", response.StatusCode)
+	}
+	return nil
+}
+
+// backoff returns the delay before the next attempt after the attempts,
+// doubling from minBackoff up to maxBackoff.
+func backoff(attempts int) time.Duration {
+	delay := minBackoff
+	for i := 1; i < attempts && delay < maxBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, maxBackoff)
+}
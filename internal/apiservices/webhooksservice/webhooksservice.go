@@ -0,0 +1,219 @@
+// Package webhooksservice posts ror events to the webhooks registered for
+// them. The v2 events are consumed from the message bus, matched against the
+// event types and owners of the webhooks and stored as deliveries, which are
+// posted signed with the secret of the webhook and retried with backoff until
+// they are delivered or dead-lettered. Only the events published by ror-api
+// itself are posted, not the events sent by clients of the api. The identity
+// registering a webhook must have read access to an event both when it is
+// matched and, with its current groups, when it is delivered.
+package webhooksservice
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/NorskHelsenett/ror-api/internal/acl/aclservice"
+	"github.com/NorskHelsenett/ror-api/internal/databases/mongodb/repositories/webhooks"
+	"github.com/NorskHelsenett/ror-api/internal/models/webhookmodels"
+	"github.com/NorskHelsenett/ror-api/pkg/helpers/publichttp"
+
+	"github.com/NorskHelsenett/ror/pkg/context/rorcontext"
+	"github.com/NorskHelsenett/ror/pkg/models/aclmodels/rorresourceowner"
+	identitymodels "github.com/NorskHelsenett/ror/pkg/models/identity"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// SignatureHeader holds the signature of the payload, written as
+	// t=<unix time>,v1=<hex hmac>. The hmac is HMAC-SHA256 with the secret of
+	// the webhook of <unix time>.<payload>.
+	SignatureHeader = "X-Ror-Signature"
+	EventHeader     = "X-Ror-Event"
+	DeliveryHeader  = "X-Ror-Delivery"
+
+	secretBytes            = 32
+	defaultDeliveriesLimit = 100
+)
+
+var (
+	ErrInvalidWebhook = errors.New("invalid webhook")
+	ErrNotFound       = webhooks.ErrNotFound
+)
+
+// Create registers the webhook for the identity of the context and returns it
+// with its signing secret.
+func Create(ctx context.Context, input webhookmodels.WebhookInput) (webhookmodels.WebhookCreated, error) {
+	if err := validate(ctx, input); err != nil {
+		return webhookmodels.WebhookCreated{}, err
+	}
+
+	secret, err := newSecret()
+	if err != nil {
+		return webhookmodels.WebhookCreated{}, err
+	}
+
+	identity := rorcontext.MustGetIdentityFromRorContext(ctx)
+	webhook := webhookmodels.Webhook{
+		Id:         uuid.NewString(),
+		Url:        input.Url,
+		EventTypes: input.EventTypes,
+		Owners:     input.Owners,
+		Secret:     secret,
+		Identity:   identity,
+		CreatedBy:  identity.GetId(),
+		CreatedAt:  time.Now(),
+	}
+	if webhook.EventTypes == nil {
+		webhook.EventTypes = []string{}
+	}
+	if webhook.Owners == nil {
+		webhook.Owners = []rorresourceowner.RorResourceOwnerReference{}
+	}
+	if err := webhooks.Create(ctx, &webhook); err != nil {
+		return webhookmodels.WebhookCreated{}, err
+	}
+	invalidateWebhooks()
+
+	return webhookmodels.WebhookCreated{Webhook: webhook, Secret: secret}, nil
+}
+
+// GetAll returns the webhooks registered by the identity of the context.
+func GetAll(ctx context.Context) ([]webhookmodels.Webhook, error) {
+	identity := rorcontext.MustGetIdentityFromRorContext(ctx)
+	return webhooks.GetByCreator(ctx, identity.GetId())
+}
+
+// Get returns the webhook if it is registered by the identity of the
+// context, or ErrNotFound.
+func Get(ctx context.Context, id string) (webhookmodels.Webhook, error) {
+	webhook, err := webhooks.GetById(ctx, id)
+	if err != nil {
+		return webhook, err
+	}
+	identity := rorcontext.MustGetIdentityFromRorContext(ctx)
+	if webhook.CreatedBy != identity.GetId() {
+		return webhookmodels.Webhook{}, ErrNotFound
+	}
+	return webhook, nil
+}
+
+// Delete removes the webhook if it is registered by the identity of the
+// context, with its pending deliveries.
+func Delete(ctx context.Context, id string) (webhookmodels.Webhook, error) {
+	webhook, err := Get(ctx, id)
+	if err != nil {
+		return webhook, err
+	}
+	if err := webhooks.Delete(ctx, id); err != nil {
+		return webhook, err
+	}
+	invalidateWebhooks()
+	return webhook, nil
+}
+
+// GetDeliveries returns the latest deliveries of the webhook, of the status
+// if it is set.
+func GetDeliveries(ctx context.Context, id string, status webhookmodels.DeliveryStatus, limit int) ([]webhookmodels.Delivery, error) {
+	if _, err := Get(ctx, id); err != nil {
+		return nil, err
+	}
+	if limit <= 0 {
+		limit = defaultDeliveriesLimit
+	}
+	return webhooks.GetDeliveries(ctx, id, status, int64(limit))
+}
+
+// CanRead reports whether the identity has read access to all the owners. An
+// event without owners is not readable, as its access can not be checked.
+func CanRead(identity identitymodels.Identity, owners []rorresourceowner.RorResourceOwnerReference) bool {
+	if len(owners) == 0 {
+		return false
+	}
+	ctx := context.WithValue(context.Background(), identitymodels.ContexIdentity, identity)
+	for _, owner := range owners {
+		if !aclservice.CheckAccessByRorOwnerref(ctx, owner).Read {
+			return false
+		}
+	}
+	return true
+}
+
+// Sign returns the signature header of the payload posted at the time.
+func Sign(secret string, at time.Time, payload []byte) string {
+	timestamp := strconv.FormatInt(at.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+	return "t=" + timestamp + ",v1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func validate(ctx context.Context, input webhookmodels.WebhookInput) error {
+	if _, err := publichttp.ValidateUrl(ctx, input.Url); err != nil {
+		return fmt.Errorf("%w: the url must be a public https url: %v", ErrInvalidWebhook, err)
+	}
+	for _, eventType := range input.EventTypes {
+		if strings.TrimSpace(eventType) == "" {
+			return fmt.Errorf("%w: event types can not be empty", ErrInvalidWebhook)
+		}
+	}
+	for _, owner := range input.Owners {
+		if owner.Scope == "" || owner.Subject == "" {
+			return fmt.Errorf("%w: owners must have a scope and a subject", ErrInvalidWebhook)
+		}
+	}
+	return nil
+}
+
+func newSecret() (string, error) {
+	secret := make([]byte, secretBytes)
+	if _, err := rand.Read(secret); err != nil {
+		return "", fmt.Errorf("could not generate webhook secret: %w", err)
+	}
+	return hex.EncodeToString(secret), nil
+}
+
+// matchWebhook reports whether the event type and owner are among the event
+// types and owners of the webhook.
+func matchWebhook(webhook webhookmodels.Webhook, eventType string, owner *rorresourceowner.RorResourceOwnerReference) bool {
+	return matchEventType(webhook.EventTypes, eventType) && matchOwner(webhook.Owners, owner)
+}
+
+func matchEventType(eventTypes []string, eventType string) bool {
+	if len(eventTypes) == 0 {
+		return true
+	}
+	for _, pattern := range eventTypes {
+		if pattern == eventType {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok && strings.HasPrefix(eventType, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchOwner(owners []rorresourceowner.RorResourceOwnerReference, owner *rorresourceowner.RorResourceOwnerReference) bool {
+	if len(owners) == 0 {
+		return true
+	}
+	if owner == nil {
+		return false
+	}
+	for _, filter := range owners {
+		if filter.Scope == owner.Scope && filter.Subject == owner.Subject {
+			return true
+		}
+	}
+	return false
+}
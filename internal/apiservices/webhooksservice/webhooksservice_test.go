@@ -0,0 +1,62 @@
+package webhooksservice
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+	"time"
+
+	"github.com/NorskHelsenett/ror-api/internal/mocks/identitymocks"
+	"github.com/NorskHelsenett/ror-api/internal/models/webhookmodels"
+
+	"github.com/NorskHelsenett/ror/pkg/models/aclmodels"
+	"github.com/NorskHelsenett/ror/pkg/models/aclmodels/rorresourceowner"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSign(t *testing.T) {
+	payload := []byte(`{"type":"cluster.created"}`)
+	at := time.Unix(1700000000, 0)
+
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write([]byte("1700000000." + string(payload)))
+	want := "t=1700000000,v1=" + hex.EncodeToString(mac.Sum(nil))
+
+	assert.Equal(t, want, Sign("secret", at, payload))
+	assert.NotEqual(t, want, Sign("other", at, payload))
+}
+
+func TestMatchWebhook(t *testing.T) {
+	cluster := rorresourceowner.RorResourceOwnerReference{Scope: aclmodels.Acl2ScopeCluster, Subject: "cluster-a"}
+	other := rorresourceowner.RorResourceOwnerReference{Scope: aclmodels.Acl2ScopeCluster, Subject: "cluster-b"}
+
+	all := webhookmodels.Webhook{}
+	filtered := webhookmodels.Webhook{
+		EventTypes: []string{"resource.*", "cluster.created"},
+		Owners:     []rorresourceowner.RorResourceOwnerReference{cluster},
+	}
+
+	assert.True(t, matchWebhook(all, "order.updated", nil))
+	assert.True(t, matchWebhook(filtered, "resource.updated", &cluster))
+	assert.True(t, matchWebhook(filtered, "cluster.created", &cluster))
+	assert.False(t, matchWebhook(filtered, "order.updated", &cluster))
+	assert.False(t, matchWebhook(filtered, "resource.updated", &other))
+	assert.False(t, matchWebhook(filtered, "resource.updated", nil))
+}
+
+func TestEventData(t *testing.T) {
+	assert.JSONEq(t, `{"uid":"1"}`, string(eventData(`{"uid":"1"}`)))
+	assert.JSONEq(t, `"not json"`, string(eventData("not json")))
+}
+
+func TestBackoff(t *testing.T) {
+	assert.Equal(t, minBackoff, backoff(1))
+	assert.Equal(t, 2*minBackoff, backoff(2))
+	assert.Equal(t, maxBackoff, backoff(30))
+}
+
+func TestCanReadWithoutOwners(t *testing.T) {
+	assert.False(t, CanRead(identitymocks.IdentityUserValid, nil))
+}
@@ -97,6 +97,12 @@ func CreateForAgent() gin.HandlerFunc {
 		ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
 		defer cancel()
 
+		if !apikeysservice.AgentApiKeysEnabled() {
+			rerr := rorginerror.NewRorGinError(http.StatusGone, "Agent api keys are disabled, register the agent with a service account issuer on /v2/apikeys/register/agent")
+			rerr.GinLogErrorAbort(c)
+			return
+		}
+
 		var input apicontracts.AgentApiKeyModel
 		if err := c.BindJSON(&input); err != nil {
 			rerr := rorginerror.NewRorGinError(http.StatusBadRequest, "Required fields are missing", err)
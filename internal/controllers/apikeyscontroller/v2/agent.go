@@ -2,27 +2,41 @@ package apikeyscontroller
 
 import (
 	"context"
+	"errors"
 	"net/http"
 
 	"github.com/NorskHelsenett/ror-api/internal/apiservices/apikeysservice"
+	"github.com/NorskHelsenett/ror-api/internal/apiservices/certificatesservice"
+	"github.com/NorskHelsenett/ror-api/internal/models/serviceaccountmodels"
+	"github.com/NorskHelsenett/ror-api/internal/serviceaccountauth"
+	"github.com/NorskHelsenett/ror-api/pkg/helpers/gincontext"
 	"github.com/NorskHelsenett/ror-api/pkg/helpers/rorginerror"
-	"github.com/NorskHelsenett/ror/pkg/apicontracts/apikeystypes/v2"
 	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
 )
 
+var (
+	validate *validator.Validate
+)
+
+func init() {
+	validate = validator.New()
+}
+
 // Register an agent.
 // Identity must be authorized to register an agent?
 //
 //	@Summary	Register an agent
 //	@Schemes
-//	@Description	Register a cluster agent.
+//	@Description	Register a cluster agent. The issuer of the service account tokens of the cluster is registered if it is set, for the agent to authenticate with them, and the certificate signing request is signed if it is set, for the agent to authenticate with the client certificate. No api key is returned when agent api keys are disabled, and the issuer or the certificate signing request is then required.
 //	@Tags			apikeys
 //	@Accept			application/json
 //	@Produce		application/json
-//	@Param			data	body		apikeystypes.RegisterClusterRequest	true	"data"
-//	@Success		200		{object}	apikeystypes.RegisterClusterResponse
+//	@Param			data	body		serviceaccountmodels.RegisterAgentRequest	true	"data"
+//	@Success		200		{object}	serviceaccountmodels.RegisterAgentResponse
 //	@Failure		403		{object}	rorerror.ErrorData
 //	@Failure		400		{object}	rorerror.ErrorData
+//	@Failure		409		{object}	rorerror.ErrorData
 //	@Failure		500		{string}	Failure	message
 //	@Router			/v2/apikeys/agent/register [post]
 //	@Security		ApiKey || AccessToken
@@ -43,17 +57,16 @@ func RegisterAgent() gin.HandlerFunc {
 		// 	return
 		// }
 
-		var req apikeystypes.RegisterClusterRequest
+		var req serviceaccountmodels.RegisterAgentRequest
 		if err := c.BindJSON(&req); err != nil {
 			rerr := rorginerror.NewRorGinError(http.StatusBadRequest, "Missing parameter", err)
 			rerr.GinLogErrorAbort(c)
 			return
 		}
 
-		resp, err := apikeysservice.CreateForAgentV2(ctx, &req)
+		resp, err := apikeysservice.RegisterAgentV2(ctx, &req)
 		if err != nil {
-			rerr := rorginerror.NewRorGinError(http.StatusInternalServerError, "Could not register agent", err)
-			rerr.GinLogErrorAbort(c)
+			agentError(c, "Could not register agent", err)
 			return
 		}
 
@@ -62,3 +75,67 @@ func RegisterAgent() gin.HandlerFunc {
 		//clusterId, apiKey, err := clustersservice.RegisterCluster(ctx, req.ClusterId)
 	}
 }
+
+// UpdateServiceAccountIssuer replaces the service account issuer of the
+// cluster of the identity.
+//
+//	@Summary	Update the service account issuer of the cluster
+//	@Schemes
+//	@Description	Replace the issuer of the service account tokens the agent of the cluster authenticates with, e.g. when its keys are rotated. The identity must be a cluster.
+//	@Tags			apikeys
+//	@Accept			application/json
+//	@Produce		application/json
+//	@Param			issuer										body		serviceaccountmodels.ServiceAccountIssuer	true	"Issuer"
+//	@Success		200											{object}	serviceaccountmodels.ClusterIssuer
+//	@Failure		400											{object}	rorerror.ErrorData
+//	@Failure		401											{object}	rorerror.ErrorData
+//	@Failure		403											{object}	rorerror.ErrorData
+//	@Failure		500											{object}	rorerror.ErrorData
+//	@Router			/v2/apikeys/agent/serviceaccountissuer	[put]
+//	@Security		ApiKey || AccessToken
+func UpdateServiceAccountIssuer() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := gincontext.GetRorContextFromGinContext(c)
+		defer cancel()
+
+		var input serviceaccountmodels.ServiceAccountIssuer
+		if err := c.BindJSON(&input); err != nil {
+			rerr := rorginerror.NewRorGinError(http.StatusBadRequest, "Object is not valid", err)
+			rerr.GinLogErrorAbort(c)
+			return
+		}
+		if err := validate.Struct(&input); err != nil {
+			rerr := rorginerror.NewRorGinError(http.StatusBadRequest, "could not validate service account issuer", err)
+			rerr.GinLogErrorAbort(c)
+			return
+		}
+
+		issuer, err := apikeysservice.UpdateServiceAccountIssuer(ctx, input)
+		if err != nil {
+			agentError(c, "could not update service account issuer", err)
+			return
+		}
+
+		c.Set("newObject", issuer)
+		c.JSON(http.StatusOK, issuer)
+	}
+}
+
+func agentError(c *gin.Context, msg string, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, serviceaccountauth.ErrInvalidIssuer):
+		status = http.StatusBadRequest
+		msg = err.Error()
+	case errors.Is(err, certificatesservice.ErrInvalidCsr), errors.Is(err, certificatesservice.ErrNotConfigured):
+		status = http.StatusBadRequest
+		msg = err.Error()
+	case errors.Is(err, apikeysservice.ErrIssuerExists), errors.Is(err, apikeysservice.ErrClusterRegistered), errors.Is(err, certificatesservice.ErrExists):
+		status = http.StatusConflict
+		msg = err.Error()
+	case errors.Is(err, apikeysservice.ErrNotCluster), errors.Is(err, certificatesservice.ErrNotCluster):
+		status = http.StatusForbidden
+	}
+	rerr := rorginerror.NewRorGinError(status, msg, err)
+	rerr.GinLogErrorAbort(c)
+}
@@ -3,6 +3,7 @@ package clusterscontroller
 
 import (
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"net/http"
 	"strings"
@@ -12,6 +13,7 @@ import (
 	"github.com/NorskHelsenett/ror-api/internal/apiservices/clustersservice"
 	"github.com/NorskHelsenett/ror-api/internal/customvalidators"
 	"github.com/NorskHelsenett/ror-api/internal/models/responses"
+	"github.com/NorskHelsenett/ror-api/internal/services/kubeconfigservice"
 
 	"github.com/NorskHelsenett/ror-api/pkg/helpers/rorginerror"
 
@@ -559,25 +561,29 @@ func GetKubeconfig() gin.HandlerFunc {
 
 		var clusterKubeConfigPayload apicontracts.KubeconfigCredentials
 
-		//validate the request body
+		//validate the request body, the credentials the provider needs are
+		//checked by the kubeconfig provider
 		if err := c.BindJSON(&clusterKubeConfigPayload); err != nil {
 			rerr := rorginerror.NewRorGinSpanError(span, http.StatusBadRequest, "Missing parameter", err)
 			rerr.GinLogErrorAbort(c)
 			return
 		}
 
-		//use the validator library to validate required fields
-		if err := validate.Struct(&clusterKubeConfigPayload); err != nil {
-			rerr := rorginerror.NewRorGinSpanError(span, http.StatusBadRequest, "could not validate required fields", err)
-			rerr.GinLogErrorAbort(c)
-			return
+		// Token based providers exchange the bearer token of the caller
+		if token, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer "); ok {
+			ctx = kubeconfigservice.WithToken(ctx, token)
 		}
 
 		var result apicontracts.ClusterKubeconfig
 		kubeconfigString, err := clustersservice.GetKubeconfig(ctx, clusterid, clusterKubeConfigPayload)
 		if err != nil {
 			rlog.Errorc(ctx, "error when fetching kubeconfig", err)
-			if strings.Contains(err.Error(), "is not supported") {
+			if errors.Is(err, kubeconfigservice.ErrMissingCredentials) || errors.Is(err, kubeconfigservice.ErrMissingToken) {
+				result.Status = "error"
+				result.Message = err.Error()
+				rortracer.SpanError(span, err, "missing credentials")
+				c.JSON(http.StatusBadRequest, result)
+			} else if strings.Contains(err.Error(), "is not supported") {
 				rlog.Debugc(ctx, "provider not supported")
 				result.Status = "error"
 				result.Message = "provider not supported"
@@ -18,18 +18,20 @@ import (
 )
 
 // Purge a cluster and all of its related data by cluster uid.
-// Deletes the cluster document, its v1 resources, its resourcesv2 tree and its acl entries.
+// Marks the cluster and its resourcesv2 tree as pending purge, hiding them from reads.
+// The cluster document, its v1 resources, its resourcesv2 tree and its acl entries are
+// deleted when the grace period has passed, unless the cluster is restored.
 // Requires ror global delete access.
 //
 //	@Summary	Purge a cluster by uid
 //	@Schemes
-//	@Description	Delete a cluster and all of its related data (resources, resourcesv2, acl) by uid
+//	@Description	Mark a cluster and all of its related data (resources, resourcesv2, acl) for purge by uid, they are deleted after the grace period
 //	@Tags			clusters
 //	@Accept			application/json
 //	@Produce		application/json
 //	@Param			uid		path	string	true	"cluster uid"
 //	@Param			force	query	bool	false	"skip the recent-activity safety check; for controlled decommissioning where the caller has verified the cluster's agents are stopped"
-//	@Success		200	{object}	clustersservice.PurgeResult
+//	@Success		202	{object}	clustersservice.PendingPurge
 //	@Failure		403	{string}	Forbidden
 //	@Failure		401	{object}	rorerror.ErrorData
 //	@Failure		404	{string}	NotFound
@@ -75,12 +77,121 @@ func DeleteClusterByUid() gin.HandlerFunc {
 				rerr.GinLogErrorAbort(c)
 				return
 			}
+			if errors.Is(err, clustersservice.ErrClusterPendingPurge) {
+				rerr := rorginerror.NewRorGinError(http.StatusConflict, "cluster is already pending purge", err)
+				rerr.GinLogErrorAbort(c)
+				return
+			}
 			rlog.Errorc(ctx, "could not purge cluster", err, rlog.String("uid", uid))
 			rerr := rorginerror.NewRorGinError(http.StatusInternalServerError, "could not purge cluster", err)
 			rerr.GinLogErrorAbort(c)
 			return
 		}
 
+		c.JSON(http.StatusAccepted, result)
+	}
+}
+
+// Restore a cluster pending purge by cluster uid.
+// Requires ror global delete access.
+//
+//	@Summary	Restore a cluster pending purge by uid
+//	@Schemes
+//	@Description	Restore a cluster and its resourcesv2 tree marked for purge, before the grace period has passed
+//	@Tags			clusters
+//	@Accept			application/json
+//	@Produce		application/json
+//	@Param			uid	path	string	true	"cluster uid"
+//	@Success		200	{object}	clustersservice.PendingPurge
+//	@Failure		403	{string}	Forbidden
+//	@Failure		401	{object}	rorerror.ErrorData
+//	@Failure		404	{string}	NotFound
+//	@Failure		409	{object}	rorerror.ErrorData
+//	@Failure		500	{string}	Failure	message
+//	@Router			/v1/clusters/uid/{uid}/restore [post]
+//	@Security		ApiKey || AccessToken
+func RestoreClusterByUid() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := gincontext.GetRorContextFromGinContext(c)
+		defer cancel()
+
+		uid := c.Param("uid")
+		if uid == "" {
+			rerr := rorginerror.NewRorGinError(http.StatusBadRequest, "Missing uid")
+			rerr.GinLogErrorAbort(c)
+			return
+		}
+
+		// Access check
+		// Scope: ror
+		// Subject: global
+		// Access: delete
+		accessQuery := aclmodels.NewAclV2QueryAccessScopeSubject(aclmodels.Acl2ScopeRor, aclmodels.Acl2RorSubjectGlobal)
+		accessObject := aclservice.CheckAccessByContextAclQuery(ctx, accessQuery)
+		if !accessObject.Delete {
+			c.JSON(http.StatusForbidden, "403: No access")
+			return
+		}
+
+		result, err := clustersservice.RestoreClusterByUid(ctx, uid)
+		if err != nil {
+			if errors.Is(err, clustersservice.ErrClusterNotFound) {
+				c.JSON(http.StatusNotFound, "404: Cluster not found")
+				return
+			}
+			if errors.Is(err, clustersservice.ErrClusterNotPendingPurge) {
+				rerr := rorginerror.NewRorGinError(http.StatusConflict, "cluster is not pending purge or is being purged", err)
+				rerr.GinLogErrorAbort(c)
+				return
+			}
+			rlog.Errorc(ctx, "could not restore cluster", err, rlog.String("uid", uid))
+			rerr := rorginerror.NewRorGinError(http.StatusInternalServerError, "could not restore cluster", err)
+			rerr.GinLogErrorAbort(c)
+			return
+		}
+
 		c.JSON(http.StatusOK, result)
 	}
 }
+
+// List the clusters pending purge.
+// Requires ror global delete access.
+//
+//	@Summary	List clusters pending purge
+//	@Schemes
+//	@Description	List the clusters marked for purge, ordered by when they are purged
+//	@Tags			clusters
+//	@Accept			application/json
+//	@Produce		application/json
+//	@Success		200	{array}		clustersservice.PendingPurge
+//	@Failure		403	{string}	Forbidden
+//	@Failure		401	{object}	rorerror.ErrorData
+//	@Failure		500	{string}	Failure	message
+//	@Router			/v1/clusters/pendingpurge [get]
+//	@Security		ApiKey || AccessToken
+func GetPendingPurges() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := gincontext.GetRorContextFromGinContext(c)
+		defer cancel()
+
+		// Access check
+		// Scope: ror
+		// Subject: global
+		// Access: delete
+		accessQuery := aclmodels.NewAclV2QueryAccessScopeSubject(aclmodels.Acl2ScopeRor, aclmodels.Acl2RorSubjectGlobal)
+		accessObject := aclservice.CheckAccessByContextAclQuery(ctx, accessQuery)
+		if !accessObject.Delete {
+			c.JSON(http.StatusForbidden, "403: No access")
+			return
+		}
+
+		pending, err := clustersservice.GetPendingPurges(ctx)
+		if err != nil {
+			rerr := rorginerror.NewRorGinError(http.StatusInternalServerError, "could not get clusters pending purge", err)
+			rerr.GinLogErrorAbort(c)
+			return
+		}
+
+		c.JSON(http.StatusOK, pending)
+	}
+}
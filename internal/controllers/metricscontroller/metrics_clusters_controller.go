@@ -94,7 +94,7 @@ func GetForClustersByWorkspaceId() gin.HandlerFunc {
 //
 //	@Summary	Get metrics for clusterid
 //	@Schemes
-//	@Description	Get metrics for clusterid
+//	@Description	Get metrics for clusterid. With from, to or step the cpu and memory allocation and usage over time is returned as a metricsmodels.History instead. Steps of an hour or longer use hourly samples and steps of a day or longer daily samples, which are kept longer.
 //	@Tags			metrics
 //	@Accept			application/json
 //	@Produce		application/json
@@ -104,6 +104,10 @@ func GetForClustersByWorkspaceId() gin.HandlerFunc {
 //	@Failure		500	{string}	Failure	message
 //	@Router			/v1/metrics/cluster/{clusterId} [get]
 //	@Param			clusterId	path	string	true	"clusterId"
+//	@Param			from	query	string	false	"start of the history, RFC3339, defaults to a day before to"
+//	@Param			to	query	string	false	"end of the history, RFC3339, defaults to now"
+//	@Param			step	query	string	false	"step of the history as a duration of whole minutes of at least 1m, e.g. 5m, 1h or 24h"
+//	@Failure		400	{object}	rorerror.ErrorData
 //	@Security		ApiKey || AccessToken
 func GetByClusterId() gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -111,6 +115,11 @@ func GetByClusterId() gin.HandlerFunc {
 		clusterId := c.Param("clusterId")
 		defer cancel()
 
+		if historyRequested(c) {
+			respondHistory(ctx, c, clusterId, metricsservice.GetClusterHistory)
+			return
+		}
+
 		result, err := metricsservice.GetForClusterid(ctx, clusterId)
 		if err != nil {
 			rerr := rorginerror.NewRorGinError(http.StatusInternalServerError, "Could not get metrics for clusterid", err)
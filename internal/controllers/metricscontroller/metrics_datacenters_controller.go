@@ -56,7 +56,7 @@ func GetForDatacenters() gin.HandlerFunc {
 //
 //	@Summary	Get metrics for datacenter name
 //	@Schemes
-//	@Description	Get metrics for datacenter name
+//	@Description	Get metrics for datacenter name. With from, to or step the cpu and memory allocation and usage over time is returned as a metricsmodels.History instead. Steps of an hour or longer use hourly samples and steps of a day or longer daily samples, which are kept longer.
 //	@Tags			metrics
 //	@Accept			application/json
 //	@Produce		application/json
@@ -66,6 +66,10 @@ func GetForDatacenters() gin.HandlerFunc {
 //	@Failure		500										{string}	Failure	message
 //	@Router			/v1/metrics/datacenter/{datacenterId}	[get]
 //	@Param			datacenterId										path	string	true	"datacenterId"
+//	@Param			from	query	string	false	"start of the history, RFC3339, defaults to a day before to"
+//	@Param			to	query	string	false	"end of the history, RFC3339, defaults to now"
+//	@Param			step	query	string	false	"step of the history as a duration of whole minutes of at least 1m, e.g. 5m, 1h or 24h"
+//	@Failure		400	{object}	rorerror.ErrorData
 //	@Security		ApiKey || AccessToken
 func GetByDatacenterId() gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -76,6 +80,11 @@ func GetByDatacenterId() gin.HandlerFunc {
 		// importing apicontracts for swagger
 		var _ apicontracts.MetricItem
 
+		if historyRequested(c) {
+			respondHistory(ctx, c, datacenterId, metricsservice.GetDatacenterHistory)
+			return
+		}
+
 		metrics, err := metricsservice.GetForDatacenterId(ctx, datacenterId)
 		if err != nil {
 			rerr := rorginerror.NewRorGinError(http.StatusInternalServerError, "Could not get metrics", err)
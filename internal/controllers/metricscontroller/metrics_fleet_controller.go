@@ -0,0 +1,63 @@
+package metricscontroller
+
+import (
+	"net/http"
+
+	"github.com/NorskHelsenett/ror-api/internal/acl/aclservice"
+	"github.com/NorskHelsenett/ror-api/internal/apiservices/fleetmetricsservice"
+
+	"github.com/NorskHelsenett/ror-api/pkg/helpers/gincontext"
+	"github.com/NorskHelsenett/ror-api/pkg/helpers/rorginerror"
+
+	"github.com/NorskHelsenett/ror/pkg/models/aclmodels"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// GetFleetMetrics serves the fleet inventory in the Prometheus exposition
+// format, apart from the process metrics on /metrics.
+//
+//	@Summary	Get fleet metrics
+//	@Schemes
+//	@Description	Get the clusters per provider, Kubernetes version and environment, and the nodes, cpu and memory per workspace and datacenter, in the Prometheus exposition format
+//	@Tags			metrics
+//	@Produce		text/plain
+//	@Success		200				{string}	string	"Prometheus exposition"
+//	@Failure		403				{string}	Forbidden
+//	@Failure		401				{object}	rorerror.ErrorData
+//	@Failure		500				{object}	rorerror.ErrorData
+//	@Router			/metrics/fleet	[get]
+//	@Security		ApiKey || AccessToken
+func GetFleetMetrics() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := gincontext.GetRorContextFromGinContext(c)
+		defer cancel()
+		// Access check
+		// Scope: ror
+		// Subject: global
+		// Access: read
+		accessQuery := aclmodels.NewAclV2QueryAccessScopeSubject(aclmodels.Acl2ScopeRor, aclmodels.Acl2RorSubjectGlobal)
+		accessObject := aclservice.CheckAccessByContextAclQuery(ctx, accessQuery)
+		if !accessObject.Read {
+			c.JSON(http.StatusForbidden, "403: No access")
+			return
+		}
+
+		snapshot, err := fleetmetricsservice.GetSnapshot(ctx)
+		if err != nil {
+			rerr := rorginerror.NewRorGinError(http.StatusInternalServerError, "could not get fleet metrics", err)
+			rerr.GinLogErrorAbort(c)
+			return
+		}
+
+		registry := prometheus.NewRegistry()
+		if err := registry.Register(snapshot); err != nil {
+			rerr := rorginerror.NewRorGinError(http.StatusInternalServerError, "could not register fleet metrics", err)
+			rerr.GinLogErrorAbort(c)
+			return
+		}
+		promhttp.HandlerFor(registry, promhttp.HandlerOpts{EnableOpenMetrics: true}).ServeHTTP(c.Writer, c.Request)
+	}
+}
@@ -0,0 +1,51 @@
+package metricscontroller
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/NorskHelsenett/ror-api/internal/apiservices/metricsservice"
+	"github.com/NorskHelsenett/ror-api/internal/models/metricsmodels"
+
+	"github.com/NorskHelsenett/ror-api/pkg/helpers/rorginerror"
+
+	"github.com/gin-gonic/gin"
+)
+
+type historyGetter func(ctx context.Context, id string, historyRange metricsservice.HistoryRange) (*metricsmodels.History, error)
+
+// historyRequested reports whether the request asks for the metrics history
+// by giving from, to or step.
+func historyRequested(c *gin.Context) bool {
+	return c.Query("from") != "" || c.Query("to") != "" || c.Query("step") != ""
+}
+
+// respondHistory responds with the metrics history of the id over the
+// range given by the from, to and step query parameters.
+func respondHistory(ctx context.Context, c *gin.Context, id string, get historyGetter) {
+	historyRange, err := metricsservice.NewHistoryRange(c.Query("from"), c.Query("to"), c.Query("step"), time.Now())
+	if err != nil {
+		rerr := rorginerror.NewRorGinError(http.StatusBadRequest, "invalid from, to or step", err)
+		rerr.GinLogErrorAbort(c)
+		return
+	}
+
+	// Access check
+	// Scope: cluster
+	// Subject: each cluster
+	// Access: read, checked by the repository
+	history, err := get(ctx, id, historyRange)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, metricsservice.ErrInvalidHistoryRange) {
+			status = http.StatusBadRequest
+		}
+		rerr := rorginerror.NewRorGinError(status, "Could not get metrics history", err)
+		rerr.GinLogErrorAbort(c)
+		return
+	}
+
+	c.JSON(http.StatusOK, history)
+}
@@ -163,7 +163,7 @@ func GetForWorkspacesByDatacenterId() gin.HandlerFunc {
 //
 //	@Summary	Get metrics for workspace name
 //	@Schemes
-//	@Description	Get metrics for workspace name
+//	@Description	Get metrics for workspace name. With from, to or step the cpu and memory allocation and usage over time is returned as a metricsmodels.History instead. Steps of an hour or longer use hourly samples and steps of a day or longer daily samples, which are kept longer.
 //	@Tags			metrics
 //	@Accept			application/json
 //	@Produce		application/json
@@ -174,6 +174,9 @@ func GetForWorkspacesByDatacenterId() gin.HandlerFunc {
 //	@Failure		500									{string}	Failure	message
 //	@Router			/v1/metrics/workspace/{workspaceId}	[get]
 //	@Param			workspaceId							path	string	true	"workspaceId"
+//	@Param			from	query	string	false	"start of the history, RFC3339, defaults to a day before to"
+//	@Param			to	query	string	false	"end of the history, RFC3339, defaults to now"
+//	@Param			step	query	string	false	"step of the history as a duration of whole minutes of at least 1m, e.g. 5m, 1h or 24h"
 //	@Security		ApiKey || AccessToken
 func GetByWorkspaceId() gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -181,6 +184,11 @@ func GetByWorkspaceId() gin.HandlerFunc {
 		workspaceId := c.Param("workspaceId")
 		defer cancel()
 
+		if historyRequested(c) {
+			respondHistory(ctx, c, workspaceId, metricsservice.GetWorkspaceHistory)
+			return
+		}
+
 		metrics, err := metricsservice.GetForWorkspaceId(ctx, workspaceId)
 		if err != nil {
 			rerr := rorginerror.NewRorGinError(http.StatusInternalServerError, "Could not get metris for workspace", err)
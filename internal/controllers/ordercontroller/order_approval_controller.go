@@ -0,0 +1,150 @@
+package ordercontroller
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/NorskHelsenett/ror-api/internal/apiservices/ordersservice"
+
+	"github.com/NorskHelsenett/ror-api/pkg/helpers/gincontext"
+	"github.com/NorskHelsenett/ror-api/pkg/helpers/rorginerror"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// OrderDecisionRequest is the body of an approval or rejection of an order.
+type OrderDecisionRequest struct {
+	Reason string `json:"reason" validate:"required"`
+}
+
+// Get orders awaiting approval
+//
+//	@Summary	Get orders awaiting approval
+//	@Schemes
+//	@Description	Get the orders waiting for approval that the identity may approve or reject
+//	@Tags			orders
+//	@Accept			application/json
+//	@Produce		application/json
+//	@Success		200						{array}		orderlifecycle.Lifecycle
+//	@Failure		403						{object}	rorerror.ErrorData
+//	@Failure		401						{object}	rorerror.ErrorData
+//	@Failure		500						{object}	rorerror.ErrorData
+//	@Router			/v1/orders/approvals	[get]
+//	@Security		ApiKey || AccessToken
+func GetOrdersAwaitingApproval() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := gincontext.GetRorContextFromGinContext(c)
+		defer cancel()
+		// Access check
+		// Scope: project
+		// Subject: project of each order
+		// Access: owner
+		lifecycles, err := ordersservice.GetOrdersAwaitingApproval(ctx)
+		if err != nil {
+			rerr := rorginerror.NewRorGinError(http.StatusInternalServerError, "error getting orders awaiting approval", err)
+			rerr.GinLogErrorAbort(c)
+			return
+		}
+
+		c.JSON(http.StatusOK, lifecycles)
+	}
+}
+
+// Approve order
+//
+//	@Summary	Approve an order by uid
+//	@Schemes
+//	@Description	Approve an order waiting for approval, the order is handed to provisioning
+//	@Tags			orders
+//	@Accept			application/json
+//	@Produce		application/json
+//	@Param			uid							path	string					true	"uid"
+//	@Param			request						body	OrderDecisionRequest	true	"Approval"
+//	@Success		200							{object}	orderlifecycle.Lifecycle
+//	@Failure		403							{object}	rorerror.ErrorData
+//	@Failure		400							{object}	rorerror.ErrorData
+//	@Failure		401							{object}	rorerror.ErrorData
+//	@Failure		404							{object}	rorerror.ErrorData
+//	@Failure		409							{object}	rorerror.ErrorData
+//	@Failure		500							{object}	rorerror.ErrorData
+//	@Router			/v1/orders/{uid}/approve	[post]
+//	@Security		ApiKey || AccessToken
+func ApproveOrder() gin.HandlerFunc {
+	return decideOrder(true)
+}
+
+// Reject order
+//
+//	@Summary	Reject an order by uid
+//	@Schemes
+//	@Description	Reject an order waiting for approval
+//	@Tags			orders
+//	@Accept			application/json
+//	@Produce		application/json
+//	@Param			uid						path	string					true	"uid"
+//	@Param			request					body	OrderDecisionRequest	true	"Rejection"
+//	@Success		200						{object}	orderlifecycle.Lifecycle
+//	@Failure		403						{object}	rorerror.ErrorData
+//	@Failure		400						{object}	rorerror.ErrorData
+//	@Failure		401						{object}	rorerror.ErrorData
+//	@Failure		404						{object}	rorerror.ErrorData
+//	@Failure		409						{object}	rorerror.ErrorData
+//	@Failure		500						{object}	rorerror.ErrorData
+//	@Router			/v1/orders/{uid}/reject	[post]
+//	@Security		ApiKey || AccessToken
+func RejectOrder() gin.HandlerFunc {
+	return decideOrder(false)
+}
+
+func decideOrder(approve bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := gincontext.GetRorContextFromGinContext(c)
+		defer cancel()
+
+		universalId, err := uuid.Parse(c.Param("uid"))
+		if err != nil {
+			rerr := rorginerror.NewRorGinError(http.StatusBadRequest, "invalid id", err)
+			rerr.GinLogErrorAbort(c)
+			return
+		}
+
+		var request OrderDecisionRequest
+		if err := c.BindJSON(&request); err != nil {
+			rerr := rorginerror.NewRorGinError(http.StatusBadRequest, "invalid decision", err)
+			rerr.GinLogErrorAbort(c)
+			return
+		}
+		if err := validate.Struct(&request); err != nil {
+			rerr := rorginerror.NewRorGinError(http.StatusBadRequest, "a reason is required", err)
+			rerr.GinLogErrorAbort(c)
+			return
+		}
+
+		// Access check
+		// Scope: project
+		// Subject: project of the order
+		// Access: owner
+		decide := ordersservice.RejectOrder
+		if approve {
+			decide = ordersservice.ApproveOrder
+		}
+		lifecycle, err := decide(ctx, universalId.String(), request.Reason)
+		if err != nil {
+			switch {
+			case errors.Is(err, ordersservice.ErrNotApprover), errors.Is(err, ordersservice.ErrSelfApproval):
+				rerr := rorginerror.NewRorGinError(http.StatusForbidden, "not allowed to decide the order", err)
+				rerr.GinLogErrorAbort(c)
+			case errors.Is(err, ordersservice.ErrReasonRequired):
+				rerr := rorginerror.NewRorGinError(http.StatusBadRequest, "a reason is required", err)
+				rerr.GinLogErrorAbort(c)
+			default:
+				lifecycleError(c, "error deciding order", err)
+			}
+			return
+		}
+
+		c.Set("newObject", lifecycle)
+		c.JSON(http.StatusOK, lifecycle)
+	}
+}
@@ -1,12 +1,14 @@
 package ordercontroller
 
 import (
+	"errors"
 	"net/http"
 
 	"github.com/NorskHelsenett/ror-api/internal/acl/aclservice"
 	"github.com/NorskHelsenett/ror-api/internal/apiservices/ordersservice"
 	resourcesservice "github.com/NorskHelsenett/ror-api/internal/apiservices/resourcesService"
 	"github.com/NorskHelsenett/ror-api/internal/customvalidators"
+	"github.com/NorskHelsenett/ror-api/internal/provider/clusterorder/orderlifecycle"
 
 	"github.com/NorskHelsenett/ror-api/pkg/helpers/gincontext"
 	"github.com/NorskHelsenett/ror-api/pkg/helpers/rorginerror"
@@ -320,3 +322,183 @@ func DeleteOrder() gin.HandlerFunc {
 		c.JSON(http.StatusOK, true)
 	}
 }
+
+// Get order lifecycle
+//
+//	@Summary	Get the lifecycle of an order
+//	@Schemes
+//	@Description	Get the state, conditions and transitions of a specific order by uid
+//	@Tags			orders
+//	@Accept			application/json
+//	@Produce		application/json
+//	@Param			uid							path	string	true	"uid"
+//	@Success		200							{object}	orderlifecycle.Lifecycle
+//	@Failure		403							{object}	rorerror.ErrorData
+//	@Failure		400							{object}	rorerror.ErrorData
+//	@Failure		401							{object}	rorerror.ErrorData
+//	@Failure		404							{object}	rorerror.ErrorData
+//	@Failure		500							{object}	rorerror.ErrorData
+//	@Router			/v1/orders/{uid}/lifecycle	[get]
+//	@Security		ApiKey || AccessToken
+func GetOrderLifecycle() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := gincontext.GetRorContextFromGinContext(c)
+		defer cancel()
+		// Access check
+		// Scope: ror
+		// Subject: global
+		// Access: read
+		accessQuery := aclmodels.NewAclV2QueryAccessScopeSubject(aclmodels.Acl2ScopeRor, aclmodels.Acl2RorSubjectGlobal)
+		accessObject := aclservice.CheckAccessByContextAclQuery(ctx, accessQuery)
+		if !accessObject.Read {
+			c.JSON(http.StatusForbidden, "403: No access")
+			return
+		}
+
+		universalId, err := uuid.Parse(c.Param("uid"))
+		if err != nil {
+			rerr := rorginerror.NewRorGinError(http.StatusBadRequest, "invalid id", err)
+			rerr.GinLogErrorAbort(c)
+			return
+		}
+
+		lifecycle, err := ordersservice.GetOrderLifecycle(ctx, universalId.String())
+		if err != nil {
+			lifecycleError(c, "error getting order lifecycle", err)
+			return
+		}
+
+		c.JSON(http.StatusOK, lifecycle)
+	}
+}
+
+// CancelOrderRequest is the optional body of an order cancellation.
+type CancelOrderRequest struct {
+	Message string `json:"message"`
+}
+
+// Cancel order
+//
+//	@Summary	Cancel an order by uid
+//	@Schemes
+//	@Description	Cancel an order that is not ready, failed or cancelled
+//	@Tags			orders
+//	@Accept			application/json
+//	@Produce		application/json
+//	@Param			uid						path	string				true	"uid"
+//	@Param			request					body	CancelOrderRequest	false	"Cancellation"
+//	@Success		200						{object}	orderlifecycle.Lifecycle
+//	@Failure		403						{object}	rorerror.ErrorData
+//	@Failure		400						{object}	rorerror.ErrorData
+//	@Failure		401						{object}	rorerror.ErrorData
+//	@Failure		404						{object}	rorerror.ErrorData
+//	@Failure		409						{object}	rorerror.ErrorData
+//	@Failure		500						{object}	rorerror.ErrorData
+//	@Router			/v1/orders/{uid}/cancel	[post]
+//	@Security		ApiKey || AccessToken
+func CancelOrder() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := gincontext.GetRorContextFromGinContext(c)
+		defer cancel()
+		// Access check
+		// Scope: ror
+		// Subject: global
+		// Access: update
+		accessQuery := aclmodels.NewAclV2QueryAccessScopeSubject(aclmodels.Acl2ScopeRor, aclmodels.Acl2RorSubjectGlobal)
+		accessObject := aclservice.CheckAccessByContextAclQuery(ctx, accessQuery)
+		if !accessObject.Update {
+			c.JSON(http.StatusForbidden, "403: No access")
+			return
+		}
+
+		universalId, err := uuid.Parse(c.Param("uid"))
+		if err != nil {
+			rerr := rorginerror.NewRorGinError(http.StatusBadRequest, "invalid id", err)
+			rerr.GinLogErrorAbort(c)
+			return
+		}
+
+		var request CancelOrderRequest
+		if c.Request.ContentLength > 0 {
+			if err := c.BindJSON(&request); err != nil {
+				rerr := rorginerror.NewRorGinError(http.StatusBadRequest, "invalid cancellation", err)
+				rerr.GinLogErrorAbort(c)
+				return
+			}
+		}
+
+		lifecycle, err := ordersservice.CancelOrder(ctx, universalId.String(), request.Message)
+		if err != nil {
+			lifecycleError(c, "error cancelling order", err)
+			return
+		}
+
+		c.Set("newObject", lifecycle)
+		c.JSON(http.StatusOK, lifecycle)
+	}
+}
+
+// Retry order
+//
+//	@Summary	Retry an order by uid
+//	@Schemes
+//	@Description	Retry a failed order, the order is validated again before it is provisioned
+//	@Tags			orders
+//	@Accept			application/json
+//	@Produce		application/json
+//	@Param			uid						path	string	true	"uid"
+//	@Success		200						{object}	orderlifecycle.Lifecycle
+//	@Failure		403						{object}	rorerror.ErrorData
+//	@Failure		400						{object}	rorerror.ErrorData
+//	@Failure		401						{object}	rorerror.ErrorData
+//	@Failure		404						{object}	rorerror.ErrorData
+//	@Failure		409						{object}	rorerror.ErrorData
+//	@Failure		500						{object}	rorerror.ErrorData
+//	@Router			/v1/orders/{uid}/retry	[post]
+//	@Security		ApiKey || AccessToken
+func RetryOrder() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := gincontext.GetRorContextFromGinContext(c)
+		defer cancel()
+		// Access check
+		// Scope: ror
+		// Subject: global
+		// Access: update
+		accessQuery := aclmodels.NewAclV2QueryAccessScopeSubject(aclmodels.Acl2ScopeRor, aclmodels.Acl2RorSubjectGlobal)
+		accessObject := aclservice.CheckAccessByContextAclQuery(ctx, accessQuery)
+		if !accessObject.Update {
+			c.JSON(http.StatusForbidden, "403: No access")
+			return
+		}
+
+		universalId, err := uuid.Parse(c.Param("uid"))
+		if err != nil {
+			rerr := rorginerror.NewRorGinError(http.StatusBadRequest, "invalid id", err)
+			rerr.GinLogErrorAbort(c)
+			return
+		}
+
+		lifecycle, err := ordersservice.RetryOrder(ctx, universalId.String())
+		if err != nil {
+			lifecycleError(c, "error retrying order", err)
+			return
+		}
+
+		c.Set("newObject", lifecycle)
+		c.JSON(http.StatusOK, lifecycle)
+	}
+}
+
+func lifecycleError(c *gin.Context, msg string, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, orderlifecycle.ErrNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, orderlifecycle.ErrInvalidTransition), errors.Is(err, orderlifecycle.ErrConflict):
+		status = http.StatusConflict
+	case errors.Is(err, ordersservice.ErrValidationFailed):
+		status = http.StatusBadRequest
+	}
+	rerr := rorginerror.NewRorGinError(status, msg, err)
+	rerr.GinLogErrorAbort(c)
+}
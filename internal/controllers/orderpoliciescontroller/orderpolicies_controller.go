@@ -0,0 +1,326 @@
+// Package orderpoliciescontroller manages the quotas and approval rules cluster
+// orders are checked against.
+package orderpoliciescontroller
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/NorskHelsenett/ror-api/internal/acl/aclservice"
+	"github.com/NorskHelsenett/ror-api/internal/apiservices/orderpolicyservice"
+	"github.com/NorskHelsenett/ror-api/internal/models/orderpolicymodels"
+
+	"github.com/NorskHelsenett/ror-api/pkg/helpers/gincontext"
+	"github.com/NorskHelsenett/ror-api/pkg/helpers/rorginerror"
+
+	"github.com/NorskHelsenett/ror/pkg/context/rorcontext"
+	aclmodels "github.com/NorskHelsenett/ror/pkg/models/aclmodels"
+
+	"github.com/NorskHelsenett/ror/pkg/rlog"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+)
+
+var (
+	validate *validator.Validate
+)
+
+func init() {
+	rlog.Debug("init order policies controller")
+	validate = validator.New()
+}
+
+// Get quotas
+//
+//	@Summary	Get order quotas
+//	@Schemes
+//	@Description	Get the quotas of projects and workspaces, a limit of 0 is unlimited
+//	@Tags			orderpolicies
+//	@Accept			application/json
+//	@Produce		application/json
+//	@Success		200							{array}		orderpolicymodels.Quota
+//	@Failure		403							{object}	rorerror.ErrorData
+//	@Failure		401							{object}	rorerror.ErrorData
+//	@Failure		500							{object}	rorerror.ErrorData
+//	@Router			/v1/orderpolicies/quotas	[get]
+//	@Security		ApiKey || AccessToken
+func GetQuotas() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := gincontext.GetRorContextFromGinContext(c)
+		defer cancel()
+		// Access check
+		// Scope: ror
+		// Subject: global
+		// Access: read
+		accessQuery := aclmodels.NewAclV2QueryAccessScopeSubject(aclmodels.Acl2ScopeRor, aclmodels.Acl2RorSubjectGlobal)
+		accessObject := aclservice.CheckAccessByContextAclQuery(ctx, accessQuery)
+		if !accessObject.Read {
+			c.JSON(http.StatusForbidden, "403: No access")
+			return
+		}
+
+		quotas, err := orderpolicyservice.GetQuotas(ctx)
+		if err != nil {
+			rerr := rorginerror.NewRorGinError(http.StatusInternalServerError, "could not get quotas", err)
+			rerr.GinLogErrorAbort(c)
+			return
+		}
+
+		c.JSON(http.StatusOK, quotas)
+	}
+}
+
+// Set quota
+//
+//	@Summary	Set an order quota
+//	@Schemes
+//	@Description	Create or replace the quota of a project or workspace
+//	@Tags			orderpolicies
+//	@Accept			application/json
+//	@Produce		application/json
+//	@Param			scope										path	string					true	"project or workspace"
+//	@Param			subjectId									path	string					true	"id of the project or workspace"
+//	@Param			quota										body	orderpolicymodels.Quota	true	"Quota"
+//	@Success		200											{object}	orderpolicymodels.Quota
+//	@Failure		403											{object}	rorerror.ErrorData
+//	@Failure		400											{object}	rorerror.ErrorData
+//	@Failure		401											{object}	rorerror.ErrorData
+//	@Failure		500											{object}	rorerror.ErrorData
+//	@Router			/v1/orderpolicies/quotas/{scope}/{subjectId}	[put]
+//	@Security		ApiKey || AccessToken
+func SetQuota() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := gincontext.GetRorContextFromGinContext(c)
+		defer cancel()
+		// Access check
+		// Scope: ror
+		// Subject: global
+		// Access: owner
+		accessQuery := aclmodels.NewAclV2QueryAccessScopeSubject(aclmodels.Acl2ScopeRor, aclmodels.Acl2RorSubjectGlobal)
+		accessObject := aclservice.CheckAccessByContextAclQuery(ctx, accessQuery)
+		if !accessObject.Owner {
+			c.JSON(http.StatusForbidden, "403: No access")
+			return
+		}
+
+		var quota orderpolicymodels.Quota
+		if err := c.BindJSON(&quota); err != nil {
+			rerr := rorginerror.NewRorGinError(http.StatusBadRequest, "Object is not valid", err)
+			rerr.GinLogErrorAbort(c)
+			return
+		}
+		quota.Scope = orderpolicymodels.QuotaScope(c.Param("scope"))
+		quota.SubjectId = c.Param("subjectId")
+		if err := validate.Struct(&quota); err != nil {
+			rerr := rorginerror.NewRorGinError(http.StatusBadRequest, "could not validate quota", err)
+			rerr.GinLogErrorAbort(c)
+			return
+		}
+
+		identity := rorcontext.MustGetIdentityFromRorContext(ctx)
+		updated, original, err := orderpolicyservice.SetQuota(ctx, quota, identity.GetId())
+		if err != nil {
+			rerr := rorginerror.NewRorGinError(http.StatusInternalServerError, "could not set quota", err)
+			rerr.GinLogErrorAbort(c)
+			return
+		}
+
+		c.Set("newObject", updated)
+		c.Set("oldObject", original)
+		c.JSON(http.StatusOK, updated)
+	}
+}
+
+// Delete quota
+//
+//	@Summary	Delete an order quota
+//	@Schemes
+//	@Description	Delete the quota of a project or workspace
+//	@Tags			orderpolicies
+//	@Accept			application/json
+//	@Produce		application/json
+//	@Param			scope										path	string	true	"project or workspace"
+//	@Param			subjectId									path	string	true	"id of the project or workspace"
+//	@Success		200											{object}	orderpolicymodels.Quota
+//	@Failure		403											{object}	rorerror.ErrorData
+//	@Failure		401											{object}	rorerror.ErrorData
+//	@Failure		404											{object}	rorerror.ErrorData
+//	@Failure		500											{object}	rorerror.ErrorData
+//	@Router			/v1/orderpolicies/quotas/{scope}/{subjectId}	[delete]
+//	@Security		ApiKey || AccessToken
+func DeleteQuota() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := gincontext.GetRorContextFromGinContext(c)
+		defer cancel()
+		// Access check
+		// Scope: ror
+		// Subject: global
+		// Access: owner
+		accessQuery := aclmodels.NewAclV2QueryAccessScopeSubject(aclmodels.Acl2ScopeRor, aclmodels.Acl2RorSubjectGlobal)
+		accessObject := aclservice.CheckAccessByContextAclQuery(ctx, accessQuery)
+		if !accessObject.Owner {
+			c.JSON(http.StatusForbidden, "403: No access")
+			return
+		}
+
+		original, err := orderpolicyservice.DeleteQuota(ctx, orderpolicymodels.QuotaScope(c.Param("scope")), c.Param("subjectId"))
+		if err != nil {
+			policyError(c, "could not delete quota", err)
+			return
+		}
+
+		c.Set("oldObject", original)
+		c.JSON(http.StatusOK, original)
+	}
+}
+
+// Get approval rules
+//
+//	@Summary	Get order approval rules
+//	@Schemes
+//	@Description	Get the rules that make matching cluster orders wait for approval
+//	@Tags			orderpolicies
+//	@Accept			application/json
+//	@Produce		application/json
+//	@Success		200						{array}		orderpolicymodels.ApprovalRule
+//	@Failure		403						{object}	rorerror.ErrorData
+//	@Failure		401						{object}	rorerror.ErrorData
+//	@Failure		500						{object}	rorerror.ErrorData
+//	@Router			/v1/orderpolicies/rules	[get]
+//	@Security		ApiKey || AccessToken
+func GetApprovalRules() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := gincontext.GetRorContextFromGinContext(c)
+		defer cancel()
+		// Access check
+		// Scope: ror
+		// Subject: global
+		// Access: read
+		accessQuery := aclmodels.NewAclV2QueryAccessScopeSubject(aclmodels.Acl2ScopeRor, aclmodels.Acl2RorSubjectGlobal)
+		accessObject := aclservice.CheckAccessByContextAclQuery(ctx, accessQuery)
+		if !accessObject.Read {
+			c.JSON(http.StatusForbidden, "403: No access")
+			return
+		}
+
+		rules, err := orderpolicyservice.GetApprovalRules(ctx)
+		if err != nil {
+			rerr := rorginerror.NewRorGinError(http.StatusInternalServerError, "could not get approval rules", err)
+			rerr.GinLogErrorAbort(c)
+			return
+		}
+
+		c.JSON(http.StatusOK, rules)
+	}
+}
+
+// Set approval rule
+//
+//	@Summary	Set an order approval rule
+//	@Schemes
+//	@Description	Create or replace an approval rule, orders matching all criteria of the rule wait for approval
+//	@Tags			orderpolicies
+//	@Accept			application/json
+//	@Produce		application/json
+//	@Param			name							path	string							true	"name"
+//	@Param			rule							body	orderpolicymodels.ApprovalRule	true	"Approval rule"
+//	@Success		200								{object}	orderpolicymodels.ApprovalRule
+//	@Failure		403								{object}	rorerror.ErrorData
+//	@Failure		400								{object}	rorerror.ErrorData
+//	@Failure		401								{object}	rorerror.ErrorData
+//	@Failure		500								{object}	rorerror.ErrorData
+//	@Router			/v1/orderpolicies/rules/{name}	[put]
+//	@Security		ApiKey || AccessToken
+func SetApprovalRule() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := gincontext.GetRorContextFromGinContext(c)
+		defer cancel()
+		// Access check
+		// Scope: ror
+		// Subject: global
+		// Access: owner
+		accessQuery := aclmodels.NewAclV2QueryAccessScopeSubject(aclmodels.Acl2ScopeRor, aclmodels.Acl2RorSubjectGlobal)
+		accessObject := aclservice.CheckAccessByContextAclQuery(ctx, accessQuery)
+		if !accessObject.Owner {
+			c.JSON(http.StatusForbidden, "403: No access")
+			return
+		}
+
+		var rule orderpolicymodels.ApprovalRule
+		if err := c.BindJSON(&rule); err != nil {
+			rerr := rorginerror.NewRorGinError(http.StatusBadRequest, "Object is not valid", err)
+			rerr.GinLogErrorAbort(c)
+			return
+		}
+		rule.Name = c.Param("name")
+		if err := validate.Struct(&rule); err != nil {
+			rerr := rorginerror.NewRorGinError(http.StatusBadRequest, "could not validate approval rule", err)
+			rerr.GinLogErrorAbort(c)
+			return
+		}
+
+		identity := rorcontext.MustGetIdentityFromRorContext(ctx)
+		updated, original, err := orderpolicyservice.SetApprovalRule(ctx, rule, identity.GetId())
+		if err != nil {
+			rerr := rorginerror.NewRorGinError(http.StatusInternalServerError, "could not set approval rule", err)
+			rerr.GinLogErrorAbort(c)
+			return
+		}
+
+		c.Set("newObject", updated)
+		c.Set("oldObject", original)
+		c.JSON(http.StatusOK, updated)
+	}
+}
+
+// Delete approval rule
+//
+//	@Summary	Delete an order approval rule
+//	@Schemes
+//	@Description	Delete an approval rule by name
+//	@Tags			orderpolicies
+//	@Accept			application/json
+//	@Produce		application/json
+//	@Param			name							path	string	true	"name"
+//	@Success		200								{object}	orderpolicymodels.ApprovalRule
+//	@Failure		403								{object}	rorerror.ErrorData
+//	@Failure		401								{object}	rorerror.ErrorData
+//	@Failure		404								{object}	rorerror.ErrorData
+//	@Failure		500								{object}	rorerror.ErrorData
+//	@Router			/v1/orderpolicies/rules/{name}	[delete]
+//	@Security		ApiKey || AccessToken
+func DeleteApprovalRule() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := gincontext.GetRorContextFromGinContext(c)
+		defer cancel()
+		// Access check
+		// Scope: ror
+		// Subject: global
+		// Access: owner
+		accessQuery := aclmodels.NewAclV2QueryAccessScopeSubject(aclmodels.Acl2ScopeRor, aclmodels.Acl2RorSubjectGlobal)
+		accessObject := aclservice.CheckAccessByContextAclQuery(ctx, accessQuery)
+		if !accessObject.Owner {
+			c.JSON(http.StatusForbidden, "403: No access")
+			return
+		}
+
+		original, err := orderpolicyservice.DeleteApprovalRule(ctx, c.Param("name"))
+		if err != nil {
+			policyError(c, "could not delete approval rule", err)
+			return
+		}
+
+		c.Set("oldObject", original)
+		c.JSON(http.StatusOK, original)
+	}
+}
+
+func policyError(c *gin.Context, msg string, err error) {
+	status := http.StatusInternalServerError
+	if errors.Is(err, orderpolicyservice.ErrNotFound) {
+		status = http.StatusNotFound
+	}
+	rerr := rorginerror.NewRorGinError(status, msg, err)
+	rerr.GinLogErrorAbort(c)
+}
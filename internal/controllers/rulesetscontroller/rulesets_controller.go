@@ -1,10 +1,13 @@
 package rulesetscontroller
 
 import (
+	"errors"
 	"net/http"
+	"strconv"
 
 	"github.com/NorskHelsenett/ror-api/internal/acl/aclservice"
 	"github.com/NorskHelsenett/ror-api/internal/apiservices/rulesetsservice"
+	"github.com/NorskHelsenett/ror-api/internal/models/switchboardmodels"
 
 	"github.com/NorskHelsenett/ror-api/pkg/helpers/gincontext"
 	"github.com/NorskHelsenett/ror-api/pkg/helpers/rorginerror"
@@ -250,9 +253,10 @@ func DeleteResource() gin.HandlerFunc {
 //	@Tags			rulesets
 //	@Accept			application/json
 //	@Produce		application/json
-//	@Param			rulesetId	path		string	true	"rulesetId"
-//	@Param			resourceId	path		string	true	"resourceId"
-//	@Success		200			{object}	messages.RulesetRuleModel
+//	@Param			rulesetId	path		string						true	"rulesetId"
+//	@Param			resourceId	path		string						true	"resourceId"
+//	@Param			rule		body		switchboardmodels.RuleInput	true	"rule"
+//	@Success		200			{object}	switchboardmodels.Rule
 //	@Failure		403			{string}	Forbidden
 //	@Failure		400			{object}	rorerror.ErrorData
 //	@Failure		401			{object}	rorerror.ErrorData
@@ -264,7 +268,7 @@ func AddResourceRule() gin.HandlerFunc {
 		ctx, cancel := gincontext.GetRorContextFromGinContext(c)
 		defer cancel()
 
-		input := new(messages.RulesetRuleInput)
+		input := new(switchboardmodels.RuleInput)
 		if err := c.BindJSON(input); err != nil {
 			rerr := rorginerror.NewRorGinError(http.StatusBadRequest, "invalid json", err)
 			rerr.GinLogErrorAbort(c)
@@ -302,6 +306,11 @@ func AddResourceRule() gin.HandlerFunc {
 		resourceId := c.Param("resourceId")
 
 		event, err := rulesetsservice.AddResourceRule(ctx, rulesetId, resourceId, input)
+		if errors.Is(err, rulesetsservice.ErrInvalidRule) {
+			rerr := rorginerror.NewRorGinError(http.StatusBadRequest, err.Error(), err)
+			rerr.GinLogErrorAbort(c)
+			return
+		}
 		if err != nil {
 			rerr := rorginerror.NewRorGinError(http.StatusInternalServerError, "could not add resource rule", err)
 			rerr.GinLogErrorAbort(c)
@@ -375,6 +384,87 @@ func DeleteResourceRule() gin.HandlerFunc {
 	}
 }
 
+// GetDeliveries returns the notifications sent by the rules of a ruleset,
+// latest first.
+//
+//	@Summary	Get ruleset deliveries
+//	@Schemes
+//	@Description	Get the notifications sent by the rules of a ruleset, latest first
+//	@Tags			rulesets
+//	@Accept			application/json
+//	@Produce		application/json
+//	@Param			rulesetId	path		string	true	"rulesetId"
+//	@Param			status		query		string	false	"pending, delivered or failed"
+//	@Param			limit		query		int		false	"maximum number of deliveries, default 100"
+//	@Success		200			{array}		switchboardmodels.Delivery
+//	@Failure		403			{string}	Forbidden
+//	@Failure		400			{object}	rorerror.ErrorData
+//	@Failure		401			{object}	rorerror.ErrorData
+//	@Failure		404			{object}	rorerror.ErrorData
+//	@Failure		500			{string}	Failure	message
+//	@Router			/v1/rulesets/{rulesetId}/deliveries [get]
+//	@Security		ApiKey || AccessToken
+func GetDeliveries() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := gincontext.GetRorContextFromGinContext(c)
+		defer cancel()
+
+		rulesetId := c.Param("rulesetId")
+		ruleset, err := rulesetsservice.Find(ctx, rulesetId)
+		if err != nil {
+			rerr := rorginerror.NewRorGinError(http.StatusNotFound, "could not find ruleset", err)
+			rerr.GinLogErrorAbort(c)
+			return
+		}
+
+		var accessQuery aclmodels.AclV2QueryAccessScopeSubject
+		if ruleset.Identity.Type == messages.RulesetIdentityTypeInternal {
+			// Access check
+			// Scope: ror
+			// Subject: global
+			// Access: read
+			accessQuery = aclmodels.NewAclV2QueryAccessScopeSubject(aclmodels.Acl2ScopeRor, aclmodels.Acl2RorSubjectGlobal)
+		} else {
+			// Access check
+			// Scope: cluster
+			// Subject: ruleset.Identity.Id
+			// Access: read
+			accessQuery = aclmodels.NewAclV2QueryAccessScopeSubject(aclmodels.Acl2ScopeCluster, ruleset.Identity.Id)
+		}
+		accessObject := aclservice.CheckAccessByContextAclQuery(ctx, accessQuery)
+		if !accessObject.Read {
+			c.JSON(http.StatusForbidden, "403: No access")
+			return
+		}
+
+		status := switchboardmodels.DeliveryStatus(c.Query("status"))
+		if status != "" && !status.Valid() {
+			rerr := rorginerror.NewRorGinError(http.StatusBadRequest, "invalid status")
+			rerr.GinLogErrorAbort(c)
+			return
+		}
+
+		limit := 0
+		if c.Query("limit") != "" {
+			limit, err = strconv.Atoi(c.Query("limit"))
+			if err != nil || limit < 0 {
+				rerr := rorginerror.NewRorGinError(http.StatusBadRequest, "invalid limit")
+				rerr.GinLogErrorAbort(c)
+				return
+			}
+		}
+
+		deliveries, err := rulesetsservice.GetDeliveries(ctx, rulesetId, status, limit)
+		if err != nil {
+			rerr := rorginerror.NewRorGinError(http.StatusInternalServerError, "could not get deliveries", err)
+			rerr.GinLogErrorAbort(c)
+			return
+		}
+
+		c.JSON(http.StatusOK, deliveries)
+	}
+}
+
 // only in development
 func GetAll() gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -0,0 +1,109 @@
+// The certificatescontroller package provides controller functions for the
+// /v2/certificates endpoints.
+package certificatescontroller
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/NorskHelsenett/ror-api/internal/apiservices/certificatesservice"
+	"github.com/NorskHelsenett/ror-api/internal/models/certificatemodels"
+
+	"github.com/NorskHelsenett/ror-api/pkg/helpers/gincontext"
+	"github.com/NorskHelsenett/ror-api/pkg/helpers/rorginerror"
+
+	"github.com/NorskHelsenett/ror/pkg/rlog"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+)
+
+var (
+	validate *validator.Validate
+)
+
+func init() {
+	rlog.Debug("init certificates controller")
+	validate = validator.New()
+}
+
+// GetCaCertificate returns the certificate of the certificate authority
+// signing the agent certificates.
+//
+//	@Summary	Get the ca certificate
+//	@Schemes
+//	@Description	Get the PEM encoded certificate of the certificate authority signing the client certificates of the agents
+//	@Tags			certificates
+//	@Produce		application/x-pem-file
+//	@Success		200						{string}	string
+//	@Failure		404						{object}	rorerror.ErrorData
+//	@Router			/v2/certificates/ca		[get]
+func GetCaCertificate() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		certificate, err := certificatesservice.GetCaCertificate()
+		if err != nil {
+			certificateError(c, "could not get ca certificate", err)
+			return
+		}
+		c.Data(http.StatusOK, "application/x-pem-file", []byte(certificate))
+	}
+}
+
+// RenewCertificate signs a new client certificate for the cluster of the
+// identity.
+//
+//	@Summary	Renew the client certificate of the cluster
+//	@Schemes
+//	@Description	Sign the certificate signing request as the client certificate of the agent of the cluster of the identity, replacing the certificate issued before. Renew the certificate after its renewAfter, or when the X-Ror-Certificate-Renew header is set on a response. The identity must be a cluster.
+//	@Tags			certificates
+//	@Accept			application/json
+//	@Produce		application/json
+//	@Param			csr							body		certificatemodels.CertificateRequest	true	"Certificate signing request"
+//	@Success		200							{object}	certificatemodels.Certificate
+//	@Failure		400							{object}	rorerror.ErrorData
+//	@Failure		401							{object}	rorerror.ErrorData
+//	@Failure		403							{object}	rorerror.ErrorData
+//	@Failure		500							{object}	rorerror.ErrorData
+//	@Router			/v2/certificates/renew		[post]
+//	@Security		ApiKey || AccessToken
+func RenewCertificate() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := gincontext.GetRorContextFromGinContext(c)
+		defer cancel()
+
+		var input certificatemodels.CertificateRequest
+		if err := c.BindJSON(&input); err != nil {
+			rerr := rorginerror.NewRorGinError(http.StatusBadRequest, "Object is not valid", err)
+			rerr.GinLogErrorAbort(c)
+			return
+		}
+		if err := validate.Struct(&input); err != nil {
+			rerr := rorginerror.NewRorGinError(http.StatusBadRequest, "could not validate certificate signing request", err)
+			rerr.GinLogErrorAbort(c)
+			return
+		}
+
+		certificate, err := certificatesservice.Renew(ctx, input.Csr)
+		if err != nil {
+			certificateError(c, "could not renew certificate", err)
+			return
+		}
+		c.JSON(http.StatusOK, certificate)
+	}
+}
+
+func certificateError(c *gin.Context, msg string, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, certificatesservice.ErrNotConfigured):
+		status = http.StatusNotFound
+		msg = err.Error()
+	case errors.Is(err, certificatesservice.ErrInvalidCsr):
+		status = http.StatusBadRequest
+		msg = err.Error()
+	case errors.Is(err, certificatesservice.ErrNotCluster):
+		status = http.StatusForbidden
+	}
+	rerr := rorginerror.NewRorGinError(status, msg, err)
+	rerr.GinLogErrorAbort(c)
+}
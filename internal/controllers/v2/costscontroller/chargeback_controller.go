@@ -0,0 +1,110 @@
+package costscontroller
+
+import (
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/NorskHelsenett/ror-api/internal/helpers/xlsx"
+
+	"github.com/NorskHelsenett/ror-api/pkg/helpers/gincontext"
+	"github.com/NorskHelsenett/ror-api/pkg/helpers/rorginerror"
+	"github.com/NorskHelsenett/ror-api/pkg/services/priceservice"
+
+	"github.com/NorskHelsenett/ror/pkg/rlog"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetChargebackReport returns the chargeback report for a month.
+//
+//	@Summary	Get the chargeback report
+//	@Schemes
+//	@Description	Get the cost of the clusters per project, cost centre and workspace for a month, from the vCPU and memory allocated to their nodes while they reported metrics. Projects the identity can not read are left out.
+//	@Tags			costs
+//	@Accept			application/json
+//	@Produce		application/json,text/csv,application/vnd.openxmlformats-officedocument.spreadsheetml.sheet
+//	@Param			month					query		string	false	"month formatted as 2006-01, defaults to the previous month"
+//	@Param			format					query		string	false	"json, csv or xlsx, defaults to json"
+//	@Success		200						{object}	pricemodels.ChargebackReport
+//	@Failure		400						{object}	rorerror.ErrorData
+//	@Failure		401						{object}	rorerror.ErrorData
+//	@Failure		500						{object}	rorerror.ErrorData
+//	@Router			/v2/costs/chargeback	[get]
+//	@Security		ApiKey || AccessToken
+func GetChargebackReport() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := gincontext.GetRorContextFromGinContext(c)
+		defer cancel()
+
+		period, err := priceservice.ChargebackPeriod(c.Query("month"))
+		if err != nil {
+			rerr := rorginerror.NewRorGinError(http.StatusBadRequest, "invalid month", err)
+			rerr.GinLogErrorAbort(c)
+			return
+		}
+		format := c.DefaultQuery("format", "json")
+		if format != "json" && format != "csv" && format != "xlsx" {
+			rerr := rorginerror.NewRorGinError(http.StatusBadRequest, "format must be json, csv or xlsx", fmt.Errorf("unknown format %s", format))
+			rerr.GinLogErrorAbort(c)
+			return
+		}
+
+		// Access check
+		// Scope: project
+		// Subject: project of each cluster
+		// Access: read, checked by the service
+		report, err := priceservice.GetChargebackReport(ctx, period)
+		if err != nil {
+			costError(c, "could not get chargeback report", err)
+			return
+		}
+		if format == "json" {
+			c.JSON(http.StatusOK, report)
+			return
+		}
+
+		rows := append([][]any{priceservice.ChargebackHeader}, priceservice.ChargebackRows(report)...)
+		filename := fmt.Sprintf("chargeback-%s.%s", period.From.Format("2006-01"), format)
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+		if format == "xlsx" {
+			c.Header("Content-Type", xlsx.ContentType)
+			c.Status(http.StatusOK)
+			if err := xlsx.Write(c.Writer, "Chargeback", rows); err != nil {
+				rlog.Errorc(ctx, "could not write chargeback report", err)
+			}
+			return
+		}
+
+		c.Header("Content-Type", "text/csv; charset=utf-8")
+		c.Status(http.StatusOK)
+		writer := csv.NewWriter(c.Writer)
+		for _, row := range rows {
+			record := make([]string, len(row))
+			for i, value := range row {
+				record[i] = csvValue(value)
+			}
+			if err := writer.Write(record); err != nil {
+				rlog.Errorc(ctx, "could not write chargeback report", err)
+				return
+			}
+		}
+		writer.Flush()
+		if err := writer.Error(); err != nil {
+			rlog.Errorc(ctx, "could not write chargeback report", err)
+		}
+	}
+}
+
+// csvValue formats floats without exponents, fmt prints large floats in
+// exponent notation, and escapes text that would be read as a formula.
+func csvValue(value any) string {
+	switch v := value.(type) {
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case int, int64:
+		return fmt.Sprint(v)
+	}
+	return xlsx.EscapeFormula(fmt.Sprint(value))
+}
@@ -0,0 +1,366 @@
+// The costscontroller package provides controller functions for the
+// /v2/costs and /v2/pricecatalogue endpoints.
+package costscontroller
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/NorskHelsenett/ror-api/internal/acl/aclservice"
+	"github.com/NorskHelsenett/ror-api/internal/models/pricemodels"
+
+	"github.com/NorskHelsenett/ror-api/pkg/helpers/gincontext"
+	"github.com/NorskHelsenett/ror-api/pkg/helpers/rorginerror"
+	"github.com/NorskHelsenett/ror-api/pkg/services/priceservice"
+
+	"github.com/NorskHelsenett/ror/pkg/context/rorcontext"
+	"github.com/NorskHelsenett/ror/pkg/models/aclmodels"
+	"github.com/NorskHelsenett/ror/pkg/rlog"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+)
+
+var (
+	validate *validator.Validate
+)
+
+func init() {
+	rlog.Debug("init costs controller")
+	validate = validator.New()
+}
+
+// GetClusterCost returns the cost of a cluster for a billing period.
+//
+//	@Summary	Get the cost of a cluster
+//	@Schemes
+//	@Description	Get the cost of a cluster per node pool and storage class for a billing period, defaults to the current month
+//	@Tags			costs
+//	@Accept			application/json
+//	@Produce		application/json
+//	@Param			uid							path		string	true	"uid of the KubernetesCluster resource"
+//	@Param			from						query		string	false	"start of the period, RFC3339"
+//	@Param			to							query		string	false	"end of the period, RFC3339"
+//	@Success		200							{object}	pricemodels.ClusterCost
+//	@Failure		400							{object}	rorerror.ErrorData
+//	@Failure		401							{object}	rorerror.ErrorData
+//	@Failure		404							{object}	rorerror.ErrorData
+//	@Failure		500							{object}	rorerror.ErrorData
+//	@Router			/v2/costs/clusters/{uid}	[get]
+//	@Security		ApiKey || AccessToken
+func GetClusterCost() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := gincontext.GetRorContextFromGinContext(c)
+		defer cancel()
+
+		period, err := billingPeriod(c)
+		if err != nil {
+			rerr := rorginerror.NewRorGinError(http.StatusBadRequest, "invalid billing period", err)
+			rerr.GinLogErrorAbort(c)
+			return
+		}
+
+		// Access check
+		// Scope: cluster
+		// Subject: the cluster
+		// Access: read, checked by the resource query
+		cost, err := priceservice.GetClusterCost(ctx, c.Param("uid"), period)
+		if err != nil {
+			costError(c, "could not get cluster cost", err)
+			return
+		}
+		c.JSON(http.StatusOK, cost)
+	}
+}
+
+// GetWorkspaceCost returns the cost of the clusters of a workspace.
+//
+//	@Summary	Get the cost of a workspace
+//	@Schemes
+//	@Description	Get the cost of the clusters of a workspace the identity can read for a billing period, defaults to the current month
+//	@Tags			costs
+//	@Accept			application/json
+//	@Produce		application/json
+//	@Param			workspace							path		string	true	"workspace"
+//	@Param			from								query		string	false	"start of the period, RFC3339"
+//	@Param			to									query		string	false	"end of the period, RFC3339"
+//	@Success		200									{object}	pricemodels.CostSummary
+//	@Failure		400									{object}	rorerror.ErrorData
+//	@Failure		401									{object}	rorerror.ErrorData
+//	@Failure		500									{object}	rorerror.ErrorData
+//	@Router			/v2/costs/workspaces/{workspace}	[get]
+//	@Security		ApiKey || AccessToken
+func GetWorkspaceCost() gin.HandlerFunc {
+	return getCostSummary(priceservice.CostScopeWorkspace, "workspace")
+}
+
+// GetProjectCost returns the cost of the clusters of a project.
+//
+//	@Summary	Get the cost of a project
+//	@Schemes
+//	@Description	Get the cost of the clusters of a project the identity can read for a billing period, defaults to the current month
+//	@Tags			costs
+//	@Accept			application/json
+//	@Produce		application/json
+//	@Param			project							path		string	true	"project id"
+//	@Param			from							query		string	false	"start of the period, RFC3339"
+//	@Param			to								query		string	false	"end of the period, RFC3339"
+//	@Success		200								{object}	pricemodels.CostSummary
+//	@Failure		400								{object}	rorerror.ErrorData
+//	@Failure		401								{object}	rorerror.ErrorData
+//	@Failure		500								{object}	rorerror.ErrorData
+//	@Router			/v2/costs/projects/{project}	[get]
+//	@Security		ApiKey || AccessToken
+func GetProjectCost() gin.HandlerFunc {
+	return getCostSummary(priceservice.CostScopeProject, "project")
+}
+
+func getCostSummary(scope string, param string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := gincontext.GetRorContextFromGinContext(c)
+		defer cancel()
+
+		period, err := billingPeriod(c)
+		if err != nil {
+			rerr := rorginerror.NewRorGinError(http.StatusBadRequest, "invalid billing period", err)
+			rerr.GinLogErrorAbort(c)
+			return
+		}
+
+		// Access check
+		// Scope: cluster
+		// Subject: each cluster
+		// Access: read, checked by the resource query
+		summary, err := priceservice.GetCostSummary(ctx, scope, c.Param(param), period)
+		if err != nil {
+			costError(c, "could not get cost summary", err)
+			return
+		}
+		c.JSON(http.StatusOK, summary)
+	}
+}
+
+// billingPeriod returns the period of the from and to query parameters. The
+// period defaults to the current month, and from defaults to the start of the
+// month of to.
+func billingPeriod(c *gin.Context) (pricemodels.BillingPeriod, error) {
+	now := time.Now().UTC()
+	period := pricemodels.BillingPeriod{
+		From: time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC),
+	}
+	period.To = period.From.AddDate(0, 1, 0)
+
+	if to := c.Query("to"); to != "" {
+		parsed, err := time.Parse(time.RFC3339, to)
+		if err != nil {
+			return period, err
+		}
+		period.To = parsed
+		period.From = time.Date(parsed.Year(), parsed.Month(), 1, 0, 0, 0, 0, parsed.Location())
+	}
+	if from := c.Query("from"); from != "" {
+		parsed, err := time.Parse(time.RFC3339, from)
+		if err != nil {
+			return period, err
+		}
+		period.From = parsed
+	}
+	if !period.To.After(period.From) {
+		return period, priceservice.ErrInvalidPeriod
+	}
+	return period, nil
+}
+
+func costError(c *gin.Context, msg string, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, priceservice.ErrNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, priceservice.ErrInvalidPeriod):
+		status = http.StatusBadRequest
+	}
+	rerr := rorginerror.NewRorGinError(status, msg, err)
+	rerr.GinLogErrorAbort(c)
+}
+
+// GetPriceItems returns the price catalogue.
+//
+//	@Summary	Get the price catalogue
+//	@Schemes
+//	@Description	Get the price items of the price catalogue
+//	@Tags			costs
+//	@Accept			application/json
+//	@Produce		application/json
+//	@Success		200					{array}		pricemodels.PriceItem
+//	@Failure		403					{object}	rorerror.ErrorData
+//	@Failure		401					{object}	rorerror.ErrorData
+//	@Failure		500					{object}	rorerror.ErrorData
+//	@Router			/v2/pricecatalogue	[get]
+//	@Security		ApiKey || AccessToken
+func GetPriceItems() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := gincontext.GetRorContextFromGinContext(c)
+		defer cancel()
+		if !hasPriceAccess(c, func(access aclmodels.AclV2ListItemAccess) bool { return access.Read }) {
+			return
+		}
+
+		items, err := priceservice.GetPriceItems(ctx)
+		if err != nil {
+			costError(c, "could not get price catalogue", err)
+			return
+		}
+		c.JSON(http.StatusOK, items)
+	}
+}
+
+// CreatePriceItem adds a price item to the catalogue.
+//
+//	@Summary	Create a price item
+//	@Schemes
+//	@Description	Add a price item to the price catalogue, items without a currency are in the default currency
+//	@Tags			costs
+//	@Accept			application/json
+//	@Produce		application/json
+//	@Param			item				body		pricemodels.PriceItem	true	"Price item"
+//	@Success		200					{object}	pricemodels.PriceItem
+//	@Failure		400					{object}	rorerror.ErrorData
+//	@Failure		403					{object}	rorerror.ErrorData
+//	@Failure		401					{object}	rorerror.ErrorData
+//	@Failure		500					{object}	rorerror.ErrorData
+//	@Router			/v2/pricecatalogue	[post]
+//	@Security		ApiKey || AccessToken
+func CreatePriceItem() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := gincontext.GetRorContextFromGinContext(c)
+		defer cancel()
+		if !hasPriceAccess(c, func(access aclmodels.AclV2ListItemAccess) bool { return access.Create }) {
+			return
+		}
+
+		item, ok := bindPriceItem(c)
+		if !ok {
+			return
+		}
+		identity := rorcontext.MustGetIdentityFromRorContext(ctx)
+		created, err := priceservice.CreatePriceItem(ctx, item, identity.GetId())
+		if err != nil {
+			costError(c, "could not create price item", err)
+			return
+		}
+
+		c.Set("newObject", created)
+		c.JSON(http.StatusOK, created)
+	}
+}
+
+// UpdatePriceItem replaces a price item of the catalogue.
+//
+//	@Summary	Update a price item
+//	@Schemes
+//	@Description	Replace a price item of the price catalogue
+//	@Tags			costs
+//	@Accept			application/json
+//	@Produce		application/json
+//	@Param			id						path		string					true	"id"
+//	@Param			item					body		pricemodels.PriceItem	true	"Price item"
+//	@Success		200						{object}	pricemodels.PriceItem
+//	@Failure		400						{object}	rorerror.ErrorData
+//	@Failure		403						{object}	rorerror.ErrorData
+//	@Failure		401						{object}	rorerror.ErrorData
+//	@Failure		404						{object}	rorerror.ErrorData
+//	@Failure		500						{object}	rorerror.ErrorData
+//	@Router			/v2/pricecatalogue/{id}	[put]
+//	@Security		ApiKey || AccessToken
+func UpdatePriceItem() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := gincontext.GetRorContextFromGinContext(c)
+		defer cancel()
+		if !hasPriceAccess(c, func(access aclmodels.AclV2ListItemAccess) bool { return access.Update }) {
+			return
+		}
+
+		item, ok := bindPriceItem(c)
+		if !ok {
+			return
+		}
+		identity := rorcontext.MustGetIdentityFromRorContext(ctx)
+		updated, original, err := priceservice.UpdatePriceItem(ctx, c.Param("id"), item, identity.GetId())
+		if err != nil {
+			costError(c, "could not update price item", err)
+			return
+		}
+
+		c.Set("newObject", updated)
+		c.Set("oldObject", original)
+		c.JSON(http.StatusOK, updated)
+	}
+}
+
+// DeletePriceItem removes a price item from the catalogue.
+//
+//	@Summary	Delete a price item
+//	@Schemes
+//	@Description	Delete a price item from the price catalogue
+//	@Tags			costs
+//	@Accept			application/json
+//	@Produce		application/json
+//	@Param			id						path		string	true	"id"
+//	@Success		200						{object}	pricemodels.PriceItem
+//	@Failure		403						{object}	rorerror.ErrorData
+//	@Failure		401						{object}	rorerror.ErrorData
+//	@Failure		404						{object}	rorerror.ErrorData
+//	@Failure		500						{object}	rorerror.ErrorData
+//	@Router			/v2/pricecatalogue/{id}	[delete]
+//	@Security		ApiKey || AccessToken
+func DeletePriceItem() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := gincontext.GetRorContextFromGinContext(c)
+		defer cancel()
+		if !hasPriceAccess(c, func(access aclmodels.AclV2ListItemAccess) bool { return access.Delete }) {
+			return
+		}
+
+		original, err := priceservice.DeletePriceItem(ctx, c.Param("id"))
+		if err != nil {
+			costError(c, "could not delete price item", err)
+			return
+		}
+
+		c.Set("oldObject", original)
+		c.JSON(http.StatusOK, original)
+	}
+}
+
+// hasPriceAccess checks the access of the identity to the prices and
+// responds with 403 if it has no access.
+func hasPriceAccess(c *gin.Context, allowed func(aclmodels.AclV2ListItemAccess) bool) bool {
+	ctx, cancel := gincontext.GetRorContextFromGinContext(c)
+	defer cancel()
+	// Access check
+	// Scope: ror
+	// Subject: price
+	accessQuery := aclmodels.NewAclV2QueryAccessScopeSubject(aclmodels.Acl2ScopeRor, aclmodels.Acl2RorSubjectPrice)
+	accessObject := aclservice.CheckAccessByContextAclQuery(ctx, accessQuery)
+	if !allowed(accessObject) {
+		c.JSON(http.StatusForbidden, "403: No access")
+		return false
+	}
+	return true
+}
+
+func bindPriceItem(c *gin.Context) (pricemodels.PriceItem, bool) {
+	var item pricemodels.PriceItem
+	if err := c.BindJSON(&item); err != nil {
+		rerr := rorginerror.NewRorGinError(http.StatusBadRequest, "Object is not valid", err)
+		rerr.GinLogErrorAbort(c)
+		return item, false
+	}
+	if err := validate.Struct(&item); err != nil {
+		rerr := rorginerror.NewRorGinError(http.StatusBadRequest, "could not validate price item", err)
+		rerr.GinLogErrorAbort(c)
+		return item, false
+	}
+	return item, true
+}
@@ -0,0 +1,116 @@
+// The migrationscontroller package provides controller functions for the
+// /v2/admin/migrations endpoints.
+package migrationscontroller
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/NorskHelsenett/ror-api/internal/acl/aclservice"
+	mongodbmigrations "github.com/NorskHelsenett/ror-api/internal/databases/mongodb/migrations"
+	"github.com/NorskHelsenett/ror-api/pkg/helpers/gincontext"
+	"github.com/NorskHelsenett/ror-api/pkg/helpers/rorginerror"
+
+	"github.com/NorskHelsenett/ror/pkg/models/aclmodels"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetMigrations returns the database migrations and whether they are applied.
+//
+//	@Summary	Get database migrations
+//	@Schemes
+//	@Description	Get the database migrations with their status and the report of their last run
+//	@Tags			admin
+//	@Accept			application/json
+//	@Produce		application/json
+//	@Success		200						{array}		mongodbmigrations.MigrationStatus
+//	@Failure		403						{object}	rorerror.ErrorData
+//	@Failure		401						{object}	rorerror.ErrorData
+//	@Failure		500						{object}	rorerror.ErrorData
+//	@Router			/v2/admin/migrations	[get]
+//	@Security		ApiKey || AccessToken
+func GetMigrations() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := gincontext.GetRorContextFromGinContext(c)
+		defer cancel()
+
+		// Access check
+		// Scope: ror
+		// Subject: global
+		// Access: read
+		accessQuery := aclmodels.NewAclV2QueryAccessScopeSubject(aclmodels.Acl2ScopeRor, aclmodels.Acl2RorSubjectGlobal)
+		accessObject := aclservice.CheckAccessByContextAclQuery(ctx, accessQuery)
+		if !accessObject.Read {
+			c.JSON(http.StatusForbidden, "403: No access")
+			return
+		}
+
+		status, err := mongodbmigrations.GetStatus(ctx)
+		if err != nil {
+			rerr := rorginerror.NewRorGinError(http.StatusInternalServerError, "could not get migrations", err)
+			rerr.GinLogErrorAbort(c)
+			return
+		}
+		c.JSON(http.StatusOK, status)
+	}
+}
+
+// RunMigrations starts a run of the pending database migrations. A dry run
+// reports what the migrations would change and runs the report migrations.
+//
+//	@Summary	Run database migrations
+//	@Schemes
+//	@Description	Run the pending database migrations in the background, the result is shown by GET /v2/admin/migrations
+//	@Tags			admin
+//	@Accept			application/json
+//	@Produce		application/json
+//	@Param			mode						query		string	false	"apply or dryrun, defaults to dryrun"
+//	@Success		202							{string}	string	"accepted"
+//	@Failure		400							{object}	rorerror.ErrorData
+//	@Failure		403							{object}	rorerror.ErrorData
+//	@Failure		401							{object}	rorerror.ErrorData
+//	@Failure		409							{object}	rorerror.ErrorData
+//	@Failure		500							{object}	rorerror.ErrorData
+//	@Router			/v2/admin/migrations/run	[post]
+//	@Security		ApiKey || AccessToken
+func RunMigrations() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := gincontext.GetRorContextFromGinContext(c)
+		defer cancel()
+
+		// Access check
+		// Scope: ror
+		// Subject: global
+		// Access: update
+		accessQuery := aclmodels.NewAclV2QueryAccessScopeSubject(aclmodels.Acl2ScopeRor, aclmodels.Acl2RorSubjectGlobal)
+		accessObject := aclservice.CheckAccessByContextAclQuery(ctx, accessQuery)
+		if !accessObject.Update {
+			c.JSON(http.StatusForbidden, "403: No access")
+			return
+		}
+
+		mode, err := mongodbmigrations.ParseMode(c.DefaultQuery("mode", string(mongodbmigrations.ModeDryRun)))
+		if err == nil && mode == mongodbmigrations.ModeOff {
+			err = mongodbmigrations.ErrInvalidMode
+		}
+		if err != nil {
+			rerr := rorginerror.NewRorGinError(http.StatusBadRequest, "invalid mode, must be apply or dryrun", err)
+			rerr.GinLogErrorAbort(c)
+			return
+		}
+
+		err = mongodbmigrations.Start(ctx, mode)
+		if errors.Is(err, mongodbmigrations.ErrLockHeld) {
+			rerr := rorginerror.NewRorGinError(http.StatusConflict, err.Error())
+			rerr.GinLogErrorAbort(c)
+			return
+		}
+		if err != nil {
+			rerr := rorginerror.NewRorGinError(http.StatusInternalServerError, "could not start migrations", err)
+			rerr.GinLogErrorAbort(c)
+			return
+		}
+		c.JSON(http.StatusAccepted, nil)
+	}
+}
@@ -22,8 +22,9 @@ import (
 )
 
 var (
-	validate         *validator.Validate
-	getResourceByUID = resourcesv2service.GetResourceByUID
+	validate           *validator.Validate
+	getResourceByUID   = resourcesv2service.GetResourceByUID
+	getResourceVersion = resourcesv2service.GetResourceVersion
 )
 
 // Init is called to initialize the resources controller
@@ -0,0 +1,95 @@
+package resourcescontroller
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/NorskHelsenett/ror-api/internal/apiservices/resourcesv2service"
+	"github.com/NorskHelsenett/ror-api/pkg/handlers/ginresourcequeryhandler"
+	"github.com/NorskHelsenett/ror-api/pkg/helpers/rorginerror"
+
+	"github.com/NorskHelsenett/ror-api/pkg/helpers/gincontext"
+	"github.com/NorskHelsenett/ror/pkg/helpers/rorerror/v2"
+	"github.com/NorskHelsenett/ror/pkg/rlog"
+	"github.com/NorskHelsenett/ror/pkg/telemetry/rortracer"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Get counts and aggregations of resources grouped by fields.
+// The resources are selected with the same parameters as GET /v2/resources.
+//
+//	@Summary	Aggregate resources
+//	@Schemes
+//	@Description	Group resources by fields and count them, with optional sum, min, max and avg over numeric fields
+//	@Tags			resources
+//	@Accept			application/json
+//	@Produce		application/json
+//
+// @Param apiversion query string false "The API version for the resource (e.g., 'v1' or 'apps/v1')"
+// @Param kind query string false "The kind of resource"
+// @Param ownerrefs query string false "JSON array of owner references [{'scope': '...', 'subject': '...'}]"
+// @Param uids query string false "Comma-separated list of UIDs"
+// @Param filters query string false "JSON array of filter objects, as for GET /v2/resources"
+// @Param groupby query string false "Comma-separated list of fields to group by: typemeta.apiversion, typemeta.kind, metadata.namespace, metadata.name, rormeta.ownerref.scope, rormeta.ownerref.subject or podresource.status.phase"
+// @Param aggregate query string false "Comma-separated list of operator:field aggregations, operators: sum, min, max, avg, fields: deploymentresource.status.replicas, availablereplicas, readyreplicas or updatedreplicas and vulnerabilityreportresource.report.summary.criticalcount, highcount, mediumcount, lowcount or unknowncount"
+// @Param limit query int false "Maximum number of groups to return"
+// @Success		200				{object}	resourcesv2service.ResourceAggregateResult
+// @Failure		400				{object}	rorerror.ErrorData
+// @Failure		401				{object}	rorerror.ErrorData
+// @Failure		500				{string}	Failure	message
+// @Router			/v2/resources/aggregate [get]
+// @Security		ApiKey || AccessToken
+func AggregateResources() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := gincontext.GetRorContextFromGinContext(c)
+		defer cancel()
+
+		ctx, span := rortracer.StartSpan(ctx, "v2.resourcescontroller.AggregateResources")
+		defer span.End()
+
+		rsQuery, err := ginresourcequeryhandler.ParseGinResourceQuery(c)
+		if err != nil {
+			rortracer.SpanError(span, err, "invalid query")
+			c.JSON(http.StatusBadRequest, "400: Invalid query: "+err.Error())
+			return
+		}
+
+		aggregateQuery := &resourcesv2service.ResourceAggregateQuery{
+			Query: rsQuery,
+			Limit: rsQuery.Limit,
+		}
+		if groupBy := c.Query("groupby"); groupBy != "" {
+			for _, field := range strings.Split(groupBy, ",") {
+				aggregateQuery.GroupBy = append(aggregateQuery.GroupBy, strings.TrimSpace(field))
+			}
+		}
+		if aggregate := c.Query("aggregate"); aggregate != "" {
+			for _, spec := range strings.Split(aggregate, ",") {
+				aggregation, err := resourcesv2service.ParseResourceAggregation(spec)
+				if err != nil {
+					rortracer.SpanError(span, err, "invalid aggregation")
+					c.JSON(http.StatusBadRequest, "400: Invalid query: "+err.Error())
+					return
+				}
+				aggregateQuery.Aggregations = append(aggregateQuery.Aggregations, aggregation)
+			}
+		}
+
+		result, err := resourcesv2service.AggregateResources(ctx, aggregateQuery)
+		if err != nil {
+			rortracer.SpanError(span, err, "failed to aggregate resources")
+			if rorErr, ok := errors.AsType[rorerror.RorError](err); ok {
+				rorginerror.GinHandleErrorAndAbort(c, rorErr.GetStatusCode(), rorErr, rlog.String("error:", rorErr.Error()))
+				return
+			}
+			rlog.Error("failed to aggregate resources", err)
+			c.JSON(http.StatusInternalServerError, "failed to aggregate resources")
+			return
+		}
+
+		rortracer.SpanOk(span)
+		c.JSON(http.StatusOK, result)
+	}
+}
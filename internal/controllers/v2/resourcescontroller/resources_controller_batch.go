@@ -0,0 +1,98 @@
+package resourcescontroller
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/NorskHelsenett/ror-api/internal/apiservices/resourcesv2service"
+	"github.com/NorskHelsenett/ror-api/internal/helpers/responsehelper"
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/NorskHelsenett/ror/pkg/rorresources"
+	"github.com/NorskHelsenett/ror/pkg/telemetry/rortracer"
+
+	"github.com/NorskHelsenett/ror-api/pkg/helpers/gincontext"
+	"github.com/NorskHelsenett/ror/pkg/rlog"
+	"github.com/gin-gonic/gin"
+)
+
+// Register a batch of resources in one bulk write, the resources are in the payload.
+// Each resource gets its own result, keyed by uid, and each written resource
+// its version.
+//
+//	@Summary	Register resources in batch
+//	@Schemes
+//	@Description	Registers a batch of resources with per resource results
+//	@Tags			resources
+//	@Accept			application/json
+//	@Produce		application/json
+//	@Param			rorresource	body		rorresources.ResourceSet	true	"ResourceUpdate"
+//	@Success		200			{object}	resourcesv2service.ResourceWriteResults
+//	@Failure		400			{object}	rorerror.ErrorData
+//	@Failure		401			{object}	rorerror.ErrorData
+//	@Failure		500			{string}	Failure	message
+//	@Router			/v2/resources/batch [post]
+//	@Security		ApiKey || AccessToken
+func NewResourceBatch() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := gincontext.GetRorContextFromGinContext(c)
+		defer cancel()
+		ctx, span := rortracer.StartSpan(ctx, "v2.resourcescontroller.NewResourceBatch")
+		defer span.End()
+		var input rorresources.ResourceSet
+
+		//validate the request body
+		if err := c.BindJSON(&input); err != nil {
+			_ = rortracer.SpanError(span, err, "failed to bind JSON")
+			rlog.Error("error binding json", err)
+			responsehelper.ErrorResponse(c, http.StatusBadRequest, err)
+			return
+		}
+		//use the validator library to validate required fields
+		if validationErr := validate.Struct(&input); validationErr != nil {
+			_ = rortracer.SpanError(span, validationErr, "validation failed")
+			rlog.Error("validation failed", validationErr)
+			responsehelper.ErrorResponse(c, http.StatusBadRequest, validationErr)
+			return
+		}
+		if len(input.Resources) > resourcesv2service.MaxBatchSize {
+			err := fmt.Errorf("batch contains %d resources, max is %d", len(input.Resources), resourcesv2service.MaxBatchSize)
+			_ = rortracer.SpanError(span, err, "batch too large")
+			responsehelper.ErrorResponse(c, http.StatusBadRequest, err)
+			return
+		}
+		span.AddEvent("request validated")
+
+		rs, err := rorresources.NewResourceSetFromStruct(input)
+		switch {
+		case err == nil:
+			// No error, continue processing
+		case errors.Is(err, rorresources.ErrResourceSetEmpty):
+			_ = rortracer.SpanError(span, err, "resource set is empty")
+			rlog.Error("resource set is empty", err)
+			responsehelper.ErrorResponse(c, http.StatusBadRequest, err)
+			return
+		case errors.Is(err, rorresources.ErrUnknownResourceKind):
+			_ = rortracer.SpanError(span, err, "unknown resource kind")
+			rlog.Error("unknown resource kind", err)
+			responsehelper.ErrorResponse(c, http.StatusBadRequest, err)
+			return
+		default:
+			_ = rortracer.SpanError(span, err, "failed to create resource set from struct")
+			rlog.Error("error creating resource set from struct", err)
+			responsehelper.ErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		span.SetAttributes(attribute.Int("resources.count", len(rs.Resources)))
+
+		results := resourcesv2service.HandleResourceBatch(ctx, rs)
+
+		resourcesProcessed.Add(float64(len(rs.Resources)))
+		resourcesRequests.Inc()
+
+		rortracer.SpanOk(span)
+		c.JSON(http.StatusOK, results)
+	}
+}
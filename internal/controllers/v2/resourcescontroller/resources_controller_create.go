@@ -33,6 +33,8 @@ var (
 
 // Register a new resource, the resource is in the payload.
 // Parameter clusterid must match authorized clusterid
+// The versions of the written resources are returned with the results, and as
+// the ETag when a single resource is written.
 //
 //	@Summary	Register resource
 //	@Schemes
@@ -41,7 +43,8 @@ var (
 //	@Accept			application/json
 //	@Produce		application/json
 //	@Param			rorresource	body		rorresources.ResourceSet	true	"ResourceUpdate"
-//	@Success		201			{object}	rorresources.ResourceUpdateResults
+//	@Success		201			{object}	resourcesv2service.ResourceWriteResults
+//	@Header			201			{string}	ETag	"The resource version when a single resource is written"
 //	@Failure		403			{string}	Forbidden
 //	@Failure		401			{object}	rorerror.ErrorData
 //	@Failure		500			{string}	Failure	message
@@ -95,21 +98,36 @@ func NewResource() gin.HandlerFunc {
 
 		span.SetAttributes(attribute.Int("resources.count", len(rs.Resources)))
 
-		returnChannel := make(chan rorresources.ResourceUpdateResults, len(rs.Resources))
+		type writeResult struct {
+			results rorresources.ResourceUpdateResults
+			uid     string
+			version int64
+		}
+		returnChannel := make(chan writeResult, len(rs.Resources))
 
-		returnArray := rorresources.ResourceUpdateResults{}
+		returnArray := resourcesv2service.ResourceWriteResults{}
 		returnArray.Results = make(map[string]rorresources.ResourceUpdateResult, len(rs.Resources))
+		returnArray.Versions = make(map[string]int64, len(rs.Resources))
 
 		span.AddEvent("processing started")
 		for _, resource := range rs.Resources {
-			go func(res *rorresources.Resource, returnChan chan rorresources.ResourceUpdateResults) {
-				returnChannel <- resourcesv2service.HandleResourceUpdate(ctx, res)
+			go func(res *rorresources.Resource, returnChan chan writeResult) {
+				results, version := resourcesv2service.HandleResourceUpdate(ctx, res)
+				returnChan <- writeResult{results: results, uid: res.GetUID(), version: version}
 			}(resource, returnChannel)
 		}
 
 		for i := 0; i < len(rs.Resources); i++ {
 			result := <-returnChannel
-			maps.Copy(returnArray.Results, result.Results)
+			maps.Copy(returnArray.Results, result.results.Results)
+			if result.version > 0 {
+				returnArray.Versions[result.uid] = result.version
+			}
+		}
+		if len(rs.Resources) == 1 && len(returnArray.Versions) == 1 {
+			for _, version := range returnArray.Versions {
+				c.Header("ETag", resourcesv2service.ResourceVersionETag(version))
+			}
 		}
 		span.AddEvent("processing complete")
 
@@ -0,0 +1,71 @@
+package resourcescontroller
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/NorskHelsenett/ror-api/internal/apiservices/resourcesv2service"
+
+	"github.com/NorskHelsenett/ror-api/pkg/helpers/gincontext"
+	"github.com/NorskHelsenett/ror/pkg/rlog"
+	"github.com/NorskHelsenett/ror/pkg/telemetry/rortracer"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Get the stored revisions of a resource by uid. Revisions are only kept for
+// kinds listed in RESOURCEV2_HISTORY_KINDS.
+//
+//	@Summary	Get resource history
+//	@Schemes
+//	@Description	Get the stored revisions of a resource, newest first
+//	@Tags			resources
+//	@Accept			application/json
+//	@Produce		application/json
+//	@Param			uid		path		string	true	"The uid of the resource"
+//	@Param			limit	query		int		false	"Maximum number of revisions to return"
+//	@Success		200		{array}		resourcesv2service.ResourceRevision
+//	@Failure		400		{string}	Bad	Request
+//	@Failure		401		{object}	rorerror.ErrorData
+//	@Failure		500		{string}	Failure	message
+//	@Router			/v2/resources/uid/{uid}/history [get]
+//	@Security		ApiKey || AccessToken
+func GetResourceHistory() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := gincontext.GetRorContextFromGinContext(c)
+		defer cancel()
+
+		ctx, span := rortracer.StartSpan(ctx, "v2.resourcescontroller.GetResourceHistory")
+		defer span.End()
+		span.SetAttributes(attribute.String("resource.uid", c.Param("uid")))
+
+		if c.Param("uid") == "" {
+			rortracer.SpanErrorf(span, "missing uid")
+			c.JSON(http.StatusBadRequest, "400: Missing uid")
+			return
+		}
+
+		limit := 0
+		if c.Query("limit") != "" {
+			var err error
+			limit, err = strconv.Atoi(c.Query("limit"))
+			if err != nil || limit < 0 {
+				rortracer.SpanErrorf(span, "invalid limit")
+				c.JSON(http.StatusBadRequest, "400: Invalid limit")
+				return
+			}
+		}
+
+		revisions, err := resourcesv2service.GetResourceHistory(ctx, c.Param("uid"), limit)
+		if err != nil {
+			rortracer.SpanError(span, err, "failed to get resource history")
+			rlog.Error("Error getting resource history by uid:", err)
+			c.JSON(http.StatusInternalServerError, "Failed to get resource history")
+			return
+		}
+
+		rortracer.SpanOk(span)
+		c.JSON(http.StatusOK, revisions)
+	}
+}
@@ -16,6 +16,7 @@ import (
 
 // Patch a resource by uid. Only the fields present in the request body are
 // updated; all other fields in the stored document are preserved.
+// If-Match makes the patch conditional on the resource version from the ETag.
 //
 //	@Summary	Patch resource by uid
 //	@Schemes
@@ -25,11 +26,15 @@ import (
 //	@Produce		application/json
 //	@Param			uid		path		string	true	"UID"
 //	@Param			patch	body		object	true	"Partial resource fields to update"
+//	@Param			If-Match	header	string	false	"Only patch if the resource version matches this ETag"
 //	@Success		200		{object}	rorresources.ResourceUpdateResults
+//	@Header			200		{string}	ETag	"The new resource version"
 //	@Failure		400		{object}	responses.Cluster
 //	@Failure		403		{string}	Forbidden
 //	@Failure		401		{object}	rorerror.ErrorData
 //	@Failure		404		{string}	Not	Found
+//	@Failure		409		{object}	rorresources.ResourceUpdateResults
+//	@Failure		412		{object}	rorresources.ResourceUpdateResults
 //	@Failure		500		{string}	Failure	message
 //	@Router			/v2/resources/uid/{uid} [patch]
 //	@Security		ApiKey || AccessToken
@@ -67,7 +72,11 @@ func PatchResource() gin.HandlerFunc {
 
 		span.AddEvent("request validated")
 
-		result := resourcesv2service.PatchResource(ctx, uid, &partial)
+		precondition := resourcesv2service.ParseIfMatch(c.GetHeader("If-Match"))
+		result, version := resourcesv2service.PatchResource(ctx, uid, &partial, precondition)
+		if version > 0 {
+			c.Header("ETag", resourcesv2service.ResourceVersionETag(version))
+		}
 
 		status := http.StatusOK
 		for _, r := range result.Results {
@@ -5,6 +5,8 @@ import (
 	"encoding/json"
 	"errors"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/NorskHelsenett/ror-api/internal/apiservices/resourcesv2service"
 	"github.com/NorskHelsenett/ror-api/pkg/handlers/ginresourcequeryhandler"
@@ -36,9 +38,10 @@ import (
 // @Param uids query string false "Comma-separated list of UIDs"
 // @Param fields query string false "Comma-separated list of fields to include"
 // @Param sort query string false "Comma-separated list of fields to sort by (+field for ascending, -field for descending)"
-// @Param filters query string false "JSON array of filter objects [{'field':'field1','value':'value1','type':'string','operator':'eq'}]"
+// @Param filters query string false "JSON array of filter objects [{'field':'field1','value':'value1','type':'string','operator':'eq'}]. Types: string, int, bool, time (RFC 3339). Operators: eq, ne, gt, lt, ge, le, regexp, in/nin (with 'values'), contains, exists. {'or': [[filters], [filters]]} matches any group"
 // @Param offset query int false "Starting offset for pagination"
-// @Param limit query int false "Maximum number of results to return"
+// @Param limit query int false "Maximum number of results to return, the page size when paging with continue"
+// @Param continue query string false "Page through the results with continue tokens. Empty for the first page, then the X-Continue-Token header of the previous page. The first page has the matching count in X-Total-Count"
 // @Success		200				{object}		rorresources.ResourceSet
 // @Failure		403				{string}	Forbidden
 // @Failure		400				{object}	rorerror.ErrorData
@@ -62,7 +65,7 @@ func GetResources() gin.HandlerFunc {
 			rsQuery, err = ginresourcequeryhandler.ParseGinResourceQuery(c)
 			if err != nil {
 				rortracer.SpanError(span, err, "invalid query")
-				c.JSON(http.StatusBadRequest, "400: Invalid query")
+				c.JSON(http.StatusBadRequest, "400: Invalid query: "+err.Error())
 				return
 			}
 		}
@@ -97,6 +100,36 @@ func GetResources() gin.HandlerFunc {
 			return
 		}
 
+		// With continue the result is paged, the continue token of the next
+		// page and the count of matching resources are returned in headers so
+		// the body stays a resource set.
+		if continueToken, paged := c.GetQuery("continue"); paged {
+			page, err := resourcesv2service.GetResourcePage(ctx, rsQuery, continueToken)
+			if err != nil {
+				rortracer.SpanError(span, err, "failed to get resource page")
+				if rorErr, ok := errors.AsType[rorerror.RorError](err); ok {
+					rorginerror.GinHandleErrorAndAbort(c, rorErr.GetStatusCode(), rorErr, rlog.String("error:", rorErr.Error()))
+					return
+				}
+				rlog.Error("failed to get resource page", err)
+				c.JSON(http.StatusInternalServerError, "failed to get resource page")
+				return
+			}
+
+			if page.Continue != "" {
+				c.Header(resourcesv2service.ContinueHeader, page.Continue)
+			}
+			if page.Count != nil {
+				c.Header(resourcesv2service.TotalCountHeader, strconv.FormatInt(*page.Count, 10))
+				if page.CountEstimated {
+					c.Header(resourcesv2service.TotalCountEstimatedHeader, "true")
+				}
+			}
+			rortracer.SpanOk(span)
+			c.JSON(http.StatusOK, page.Resources)
+			return
+		}
+
 		rsSet, err := resourcesv2service.GetResourceByQuery(ctx, rsQuery)
 		if err != nil {
 			rortracer.SpanError(span, err, "failed to get resources")
@@ -120,6 +153,9 @@ func GetResources() gin.HandlerFunc {
 }
 
 // Get a cluster resources og given group/version/kind/uid.
+// The resource version is returned in the ETag header and can be sent as
+// If-Match on PUT and PATCH. With at the revision current at that time is
+// returned from the resource history instead.
 //
 //	@Summary	Get resource
 //	@Schemes
@@ -128,7 +164,10 @@ func GetResources() gin.HandlerFunc {
 //	@Accept			application/json
 //	@Produce		application/json
 //	@Param			uid				path		string				true	"The uid of the resource"
+//	@Param			at				query		string				false	"RFC 3339 timestamp to get the resource as it was at"
 //	@Success		200				{array}		rorresources.Resource
+//	@Header			200				{string}	ETag	"The resource version"
+//	@Failure		400				{string}	Bad	Request
 //	@Failure		403				{string}	Forbidden
 //	@Failure		401				{object}	rorerror.ErrorData
 //	@Failure		500				{string}	Failure	message
@@ -149,6 +188,29 @@ func GetResource() gin.HandlerFunc {
 			return
 		}
 
+		if c.Query("at") != "" {
+			at, err := time.Parse(time.RFC3339, c.Query("at"))
+			if err != nil {
+				rortracer.SpanError(span, err, "invalid at")
+				c.JSON(http.StatusBadRequest, "400: Invalid at, expected RFC 3339 timestamp")
+				return
+			}
+			resources, err := resourcesv2service.GetResourceAt(ctx, c.Param("uid"), at)
+			if err != nil {
+				rortracer.SpanError(span, err, "failed to get resource at time")
+				rlog.Error("Error getting resource by uid at time:", err)
+				c.JSON(http.StatusInternalServerError, "Failed to get resource")
+				return
+			}
+			if resources == nil {
+				c.JSON(http.StatusNotFound, "404: Resource not found")
+				return
+			}
+			rortracer.SpanOk(span)
+			c.JSON(http.StatusOK, resources.GetAll())
+			return
+		}
+
 		resources, err := getResourceByUID(ctx, c.Param("uid"))
 		if err != nil {
 			rortracer.SpanError(span, err, "failed to get resource")
@@ -160,6 +222,16 @@ func GetResource() gin.HandlerFunc {
 			c.JSON(http.StatusNotFound, "404: Resource not found")
 			return
 		}
+
+		version, err := getResourceVersion(ctx, c.Param("uid"))
+		if err != nil {
+			rortracer.SpanError(span, err, "failed to get resource version")
+			rlog.Error("Error getting resource version by uid:", err)
+			c.JSON(http.StatusInternalServerError, "Failed to get resource")
+			return
+		}
+		c.Header("ETag", resourcesv2service.ResourceVersionETag(version))
+
 		rortracer.SpanOk(span)
 		c.JSON(http.StatusOK, resources.GetAll())
 	}
@@ -1,9 +1,12 @@
 package resourcescontroller
 
 import (
+	"context"
+	"errors"
 	"net/http"
 
 	resourcesservice "github.com/NorskHelsenett/ror-api/internal/apiservices/resourcesService"
+	"github.com/NorskHelsenett/ror-api/internal/apiservices/resourcesv2service"
 	"github.com/NorskHelsenett/ror-api/internal/models/responses"
 
 	"github.com/NorskHelsenett/ror-api/internal/acl/aclservice"
@@ -18,6 +21,7 @@ import (
 )
 
 // Update a cluster resource of given group/version/kind/uid.
+// If-Match makes the update conditional on the resource version from the ETag.
 //
 //	@Summary	Update resource by uid
 //	@Schemes
@@ -27,9 +31,13 @@ import (
 //	@Produce		application/json
 //	@Param			uid				path		string									true	"UID"
 //	@Param			resourcereport	body		apiresourcecontracts.ResourceUpdateModel	true	"ResourceUpdate"
+//	@Param			If-Match		header		string									false	"Only update if the resource version matches this ETag"
 //	@Success		201				{string}	Created
+//	@Header			201				{string}	ETag	"The new resource version"
 //	@Failure		403				{string}	Forbidden
 //	@Failure		401				{object}	rorerror.ErrorData
+//	@Failure		409				{string}	Conflict
+//	@Failure		412				{string}	Precondition	Failed
 //	@Failure		500				{string}	Failure	message
 //	@Router			/v2/resources/uid/{uid} [put]
 //	@Security		ApiKey || AccessToken
@@ -86,12 +94,31 @@ func UpdateResource() gin.HandlerFunc {
 		}
 		span.AddEvent("access checked")
 
-		err := resourcesservice.ResourceNewCreateService(ctx, input)
-		if err != nil {
+		// The resource version is advanced in the transaction of the write so
+		// concurrent writers holding the old version are rejected. The ETag is
+		// the version of the resource as stored.
+		precondition := resourcesv2service.ParseIfMatch(c.GetHeader("If-Match"))
+		version, err := resourcesv2service.WriteWithResourceVersion(ctx, input.Uid, precondition, func(ctx context.Context) error {
+			return resourcesservice.ResourceNewCreateService(ctx, input)
+		})
+		switch {
+		case err == nil:
+		case errors.Is(err, resourcesv2service.ErrPreconditionFailed):
+			rortracer.SpanError(span, err, "precondition failed")
+			c.JSON(http.StatusPreconditionFailed, "412: Resource version does not match")
+			return
+		case errors.Is(err, resourcesv2service.ErrResourceVersionConflict):
+			rortracer.SpanError(span, err, "resource version conflict")
+			c.JSON(http.StatusConflict, "409: Resource was modified concurrently")
+			return
+		default:
 			rortracer.SpanError(span, err, "service failed")
 			c.JSON(http.StatusInternalServerError, responses.Cluster{Status: http.StatusInternalServerError, Message: "error", Data: map[string]any{"data": err.Error()}})
 			return
 		}
+		if version > 0 {
+			c.Header("ETag", resourcesv2service.ResourceVersionETag(version))
+		}
 
 		span.AddEvent("resource updated")
 		rortracer.SpanOk(span)
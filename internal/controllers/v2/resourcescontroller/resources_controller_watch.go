@@ -0,0 +1,141 @@
+package resourcescontroller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/NorskHelsenett/ror-api/internal/apiservices/resourcesv2service"
+	"github.com/NorskHelsenett/ror-api/pkg/handlers/ginresourcequeryhandler"
+	"github.com/NorskHelsenett/ror-api/pkg/helpers/rorginerror"
+
+	"github.com/NorskHelsenett/ror-api/pkg/helpers/gincontext"
+	"github.com/NorskHelsenett/ror/pkg/context/rorcontext"
+	"github.com/NorskHelsenett/ror/pkg/helpers/rorerror/v2"
+	identitymodels "github.com/NorskHelsenett/ror/pkg/models/identity"
+	"github.com/NorskHelsenett/ror/pkg/rlog"
+	"github.com/NorskHelsenett/ror/pkg/telemetry/rortracer"
+
+	"github.com/gin-gonic/gin"
+)
+
+var watchKeepAliveInterval = 15 * time.Second
+
+// Watch resources matching a query. Changes are streamed as server sent
+// events with the resource version as event id, so a reconnecting client
+// resumes where it left off.
+//
+//	@Summary	Watch resources
+//	@Schemes
+//	@Description	Stream ADDED/MODIFIED/DELETED events for resources matching the query. BOOKMARK events carry a resume token.
+//	@Tags			resources
+//	@Accept			application/json
+//	@Produce		text/event-stream
+//
+// @Param apiversion query string false "The API version for the resource (e.g., 'v1' or 'apps/v1')"
+// @Param kind query string false "The kind of resource"
+// @Param ownerrefs query string false "JSON array of owner references [{'scope': '...', 'subject': '...'}]"
+// @Param uids query string false "Comma-separated list of UIDs"
+// @Param filters query string false "JSON array of filter objects [{'field':'field1','value':'value1','type':'string','operator':'eq'}]"
+// @Param resourceVersion query string false "Resume after this resource version"
+// @Param bookmark query string false "Resume from a bookmark token"
+// @Param Last-Event-ID header string false "Resume after this event id"
+// @Success		200				{object}	resourcesv2service.WatchEvent
+// @Failure		400				{object}	rorerror.ErrorData
+// @Failure		401				{object}	rorerror.ErrorData
+// @Failure		410				{object}	rorerror.ErrorData
+// @Failure		500				{object}	rorerror.ErrorData
+// @Router			/v2/resources/watch [get]
+// @Security		ApiKey || AccessToken
+func WatchResources() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		rorCtx, cancel := gincontext.GetRorContextFromGinContext(c)
+		defer cancel()
+		if rorCtx == nil {
+			return
+		}
+
+		// The ror context carries a request timeout, the watch must live as
+		// long as the client stays connected.
+		identity := rorcontext.MustGetIdentityFromRorContext(rorCtx)
+		ctx, stop := context.WithCancel(context.WithValue(c.Request.Context(), identitymodels.ContexIdentity, identity))
+		defer stop()
+
+		_, span := rortracer.StartSpan(ctx, "v2.resourcescontroller.WatchResources")
+
+		rsQuery, err := ginresourcequeryhandler.ParseGinResourceQuery(c)
+		if err != nil {
+			rortracer.SpanError(span, err, "invalid query")
+			span.End()
+			rerr := rorginerror.NewRorGinError(http.StatusBadRequest, "invalid query", err)
+			rerr.GinLogErrorAbort(c)
+			return
+		}
+
+		resumeFrom, err := resourcesv2service.ParseWatchResumePoint(c.Query("resourceVersion"), c.Query("bookmark"), c.GetHeader("Last-Event-ID"))
+		if err != nil {
+			rortracer.SpanError(span, err, "invalid resume point")
+			span.End()
+			rerr := rorginerror.NewRorGinError(http.StatusBadRequest, err.Error())
+			rerr.GinLogErrorAbort(c)
+			return
+		}
+
+		watch, err := resourcesv2service.NewResourceWatch(ctx, rsQuery, resumeFrom)
+		if err != nil {
+			rortracer.SpanError(span, err, "could not start watch")
+			span.End()
+			switch {
+			case errors.Is(err, resourcesv2service.ErrWatchExpired):
+				rerr := rorginerror.NewRorGinError(http.StatusGone, err.Error())
+				rerr.GinLogErrorAbort(c)
+			case errors.Is(err, resourcesv2service.ErrInvalidResumePoint):
+				rerr := rorginerror.NewRorGinError(http.StatusBadRequest, err.Error())
+				rerr.GinLogErrorAbort(c)
+			default:
+				if rorErr, ok := errors.AsType[rorerror.RorError](err); ok {
+					rorginerror.GinHandleErrorAndAbort(c, rorErr.GetStatusCode(), rorErr)
+					return
+				}
+				rorginerror.GinHandleErrorAndAbort(c, http.StatusInternalServerError, err)
+			}
+			return
+		}
+		rortracer.SpanOk(span)
+		span.End()
+
+		events := make(chan resourcesv2service.WatchEvent, 16)
+		go func() {
+			err := watch.Run(ctx, events)
+			if err != nil && ctx.Err() == nil {
+				rlog.Errorc(ctx, "resource watch stopped", err)
+			}
+			stop()
+		}()
+
+		keepAlive := time.NewTicker(watchKeepAliveInterval)
+		defer keepAlive.Stop()
+
+		c.Stream(func(w io.Writer) bool {
+			select {
+			case event := <-events:
+				data, err := json.Marshal(event)
+				if err != nil {
+					rlog.Errorc(ctx, "could not marshal watch event", err)
+					return true
+				}
+				_, err = fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", event.ResourceVersion, event.Type, data)
+				return err == nil
+			case <-keepAlive.C:
+				_, err := w.Write([]byte(":keepalive\n\n"))
+				return err == nil
+			case <-ctx.Done():
+				return false
+			}
+		})
+	}
+}
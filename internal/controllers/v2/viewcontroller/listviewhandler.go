@@ -3,13 +3,16 @@ package viewcontroller
 import (
 	"errors"
 	"net/http"
+	"strconv"
 
+	"github.com/NorskHelsenett/ror-api/internal/apiservices/resourcesv2service"
 	"github.com/NorskHelsenett/ror-api/pkg/helpers/gincontext"
 	"github.com/NorskHelsenett/ror-api/pkg/helpers/rorginerror"
 	"github.com/NorskHelsenett/ror-api/pkg/services/viewservice"
 	"github.com/gin-gonic/gin"
 
 	"github.com/NorskHelsenett/ror/pkg/apicontracts/v2/apiview"
+	"github.com/NorskHelsenett/ror/pkg/helpers/rorerror/v2"
 )
 
 // Getview handles the HTTP GET request to retrieve a view.
@@ -31,6 +34,7 @@ import (
 // @Param			sort		query	string							false	"Comma separated list of fields to sort by (e.g. name,-date)"
 // @Param			filter		query	string							false	"Filter expression (e.g. name==example*,date>2020-01-01)"
 // @Param			fields		query	string							false	"Comma separated list of extra fields to include in the response (e.g. workorder,branch,testfield1)"
+// @Param			continue	query	string							false	"Page through list views with continue tokens, limit is the page size. Empty for the first page, then the X-Continue-Token header of the previous page"
 // @Security		ApiKey || AccessToken
 func GetView() gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -40,13 +44,37 @@ func GetView() gin.HandlerFunc {
 		if errors.Is(err, viewservice.ErrViewNotRegistered) {
 			rerr := rorginerror.NewRorGinError(http.StatusBadRequest, "Invalid or unsupported view", err)
 			rerr.GinLogErrorAbort(c)
+			return
 		}
 		options := viewservice.ParseOptionsFromGinContext(c)
 
+		var page *viewservice.ViewPage
+		if continueToken, paged := c.GetQuery("continue"); paged {
+			page = &viewservice.ViewPage{}
+			options = append(options, viewservice.OptionContinue(continueToken, page))
+		}
+
 		apiview, err := generator.GenerateView(ctx, options...)
 		if err != nil {
-			rerr := rorginerror.NewRorGinErrorFromError(http.StatusInternalServerError, err)
+			status := http.StatusInternalServerError
+			if rorErr, ok := errors.AsType[rorerror.RorError](err); ok {
+				status = rorErr.GetStatusCode()
+			}
+			rerr := rorginerror.NewRorGinErrorFromError(status, err)
 			rerr.GinLogErrorAbort(c)
+			return
+		}
+
+		if page != nil {
+			if page.Continue != "" {
+				c.Header(resourcesv2service.ContinueHeader, page.Continue)
+			}
+			if page.Count != nil {
+				c.Header(resourcesv2service.TotalCountHeader, strconv.FormatInt(*page.Count, 10))
+				if page.CountEstimated {
+					c.Header(resourcesv2service.TotalCountEstimatedHeader, "true")
+				}
+			}
 		}
 
 		c.JSON(http.StatusOK, apiview)
@@ -0,0 +1,236 @@
+// The webhookscontroller package provides controller functions for the
+// /v2/webhooks endpoints.
+package webhookscontroller
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/NorskHelsenett/ror-api/internal/acl/aclservice"
+	"github.com/NorskHelsenett/ror-api/internal/apiservices/webhooksservice"
+	"github.com/NorskHelsenett/ror-api/internal/models/webhookmodels"
+
+	"github.com/NorskHelsenett/ror-api/pkg/helpers/gincontext"
+	"github.com/NorskHelsenett/ror-api/pkg/helpers/rorginerror"
+
+	"github.com/NorskHelsenett/ror/pkg/rlog"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+)
+
+var (
+	validate *validator.Validate
+)
+
+func init() {
+	rlog.Debug("init webhooks controller")
+	validate = validator.New()
+}
+
+// CreateWebhook registers a webhook for the identity.
+//
+//	@Summary	Register a webhook
+//	@Schemes
+//	@Description	Register an https endpoint to post ror events to, filtered by event type and owner. The identity must have read access to the owners, and to each event when it is delivered. The payload is signed with HMAC-SHA256 using the secret returned here, see the X-Ror-Signature header.
+//	@Tags			webhooks
+//	@Accept			application/json
+//	@Produce		application/json
+//	@Param			webhook			body		webhookmodels.WebhookInput	true	"Webhook"
+//	@Success		201				{object}	webhookmodels.WebhookCreated
+//	@Failure		400				{object}	rorerror.ErrorData
+//	@Failure		403				{object}	rorerror.ErrorData
+//	@Failure		401				{object}	rorerror.ErrorData
+//	@Failure		500				{object}	rorerror.ErrorData
+//	@Router			/v2/webhooks	[post]
+//	@Security		ApiKey || AccessToken
+func CreateWebhook() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := gincontext.GetRorContextFromGinContext(c)
+		defer cancel()
+
+		var input webhookmodels.WebhookInput
+		if err := c.BindJSON(&input); err != nil {
+			rerr := rorginerror.NewRorGinError(http.StatusBadRequest, "Object is not valid", err)
+			rerr.GinLogErrorAbort(c)
+			return
+		}
+		if err := validate.Struct(&input); err != nil {
+			rerr := rorginerror.NewRorGinError(http.StatusBadRequest, "could not validate webhook", err)
+			rerr.GinLogErrorAbort(c)
+			return
+		}
+
+		// Access check
+		// Scope: each owner of the webhook
+		// Subject: each owner of the webhook
+		// Access: read
+		for _, owner := range input.Owners {
+			if !aclservice.CheckAccessByRorOwnerref(ctx, owner).Read {
+				c.JSON(http.StatusForbidden, "403: No access")
+				return
+			}
+		}
+
+		created, err := webhooksservice.Create(ctx, input)
+		if err != nil {
+			webhookError(c, "could not register webhook", err)
+			return
+		}
+
+		c.Set("newObject", created.Webhook)
+		c.JSON(http.StatusCreated, created)
+	}
+}
+
+// GetWebhooks returns the webhooks registered by the identity.
+//
+//	@Summary	Get webhooks
+//	@Schemes
+//	@Description	Get the webhooks registered by the identity
+//	@Tags			webhooks
+//	@Accept			application/json
+//	@Produce		application/json
+//	@Success		200				{array}		webhookmodels.Webhook
+//	@Failure		401				{object}	rorerror.ErrorData
+//	@Failure		500				{object}	rorerror.ErrorData
+//	@Router			/v2/webhooks	[get]
+//	@Security		ApiKey || AccessToken
+func GetWebhooks() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := gincontext.GetRorContextFromGinContext(c)
+		defer cancel()
+
+		webhooks, err := webhooksservice.GetAll(ctx)
+		if err != nil {
+			webhookError(c, "could not get webhooks", err)
+			return
+		}
+		c.JSON(http.StatusOK, webhooks)
+	}
+}
+
+// GetWebhook returns a webhook registered by the identity.
+//
+//	@Summary	Get a webhook
+//	@Schemes
+//	@Description	Get a webhook registered by the identity
+//	@Tags			webhooks
+//	@Accept			application/json
+//	@Produce		application/json
+//	@Param			id					path		string	true	"id"
+//	@Success		200					{object}	webhookmodels.Webhook
+//	@Failure		401					{object}	rorerror.ErrorData
+//	@Failure		404					{object}	rorerror.ErrorData
+//	@Failure		500					{object}	rorerror.ErrorData
+//	@Router			/v2/webhooks/{id}	[get]
+//	@Security		ApiKey || AccessToken
+func GetWebhook() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := gincontext.GetRorContextFromGinContext(c)
+		defer cancel()
+
+		webhook, err := webhooksservice.Get(ctx, c.Param("id"))
+		if err != nil {
+			webhookError(c, "could not get webhook", err)
+			return
+		}
+		c.JSON(http.StatusOK, webhook)
+	}
+}
+
+// DeleteWebhook removes a webhook registered by the identity.
+//
+//	@Summary	Delete a webhook
+//	@Schemes
+//	@Description	Delete a webhook registered by the identity, its pending deliveries are dropped
+//	@Tags			webhooks
+//	@Accept			application/json
+//	@Produce		application/json
+//	@Param			id					path		string	true	"id"
+//	@Success		200					{object}	webhookmodels.Webhook
+//	@Failure		401					{object}	rorerror.ErrorData
+//	@Failure		404					{object}	rorerror.ErrorData
+//	@Failure		500					{object}	rorerror.ErrorData
+//	@Router			/v2/webhooks/{id}	[delete]
+//	@Security		ApiKey || AccessToken
+func DeleteWebhook() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := gincontext.GetRorContextFromGinContext(c)
+		defer cancel()
+
+		webhook, err := webhooksservice.Delete(ctx, c.Param("id"))
+		if err != nil {
+			webhookError(c, "could not delete webhook", err)
+			return
+		}
+
+		c.Set("oldObject", webhook)
+		c.JSON(http.StatusOK, webhook)
+	}
+}
+
+// GetWebhookDeliveries returns the deliveries of a webhook registered by the
+// identity, latest first.
+//
+//	@Summary	Get webhook deliveries
+//	@Schemes
+//	@Description	Get the deliveries of a webhook registered by the identity, latest first. Dead-lettered deliveries have the status deadletter.
+//	@Tags			webhooks
+//	@Accept			application/json
+//	@Produce		application/json
+//	@Param			id								path		string	true	"id"
+//	@Param			status							query		string	false	"pending, delivered, denied or deadletter"
+//	@Param			limit							query		int		false	"maximum number of deliveries, default 100"
+//	@Success		200								{array}		webhookmodels.Delivery
+//	@Failure		400								{object}	rorerror.ErrorData
+//	@Failure		401								{object}	rorerror.ErrorData
+//	@Failure		404								{object}	rorerror.ErrorData
+//	@Failure		500								{object}	rorerror.ErrorData
+//	@Router			/v2/webhooks/{id}/deliveries	[get]
+//	@Security		ApiKey || AccessToken
+func GetWebhookDeliveries() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := gincontext.GetRorContextFromGinContext(c)
+		defer cancel()
+
+		status := webhookmodels.DeliveryStatus(c.Query("status"))
+		if status != "" && !status.Valid() {
+			rerr := rorginerror.NewRorGinError(http.StatusBadRequest, "invalid status")
+			rerr.GinLogErrorAbort(c)
+			return
+		}
+
+		limit := 0
+		if c.Query("limit") != "" {
+			var err error
+			limit, err = strconv.Atoi(c.Query("limit"))
+			if err != nil || limit < 0 {
+				rerr := rorginerror.NewRorGinError(http.StatusBadRequest, "invalid limit")
+				rerr.GinLogErrorAbort(c)
+				return
+			}
+		}
+
+		deliveries, err := webhooksservice.GetDeliveries(ctx, c.Param("id"), status, limit)
+		if err != nil {
+			webhookError(c, "could not get webhook deliveries", err)
+			return
+		}
+		c.JSON(http.StatusOK, deliveries)
+	}
+}
+
+func webhookError(c *gin.Context, msg string, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, webhooksservice.ErrNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, webhooksservice.ErrInvalidWebhook):
+		status = http.StatusBadRequest
+		msg = err.Error()
+	}
+	rerr := rorginerror.NewRorGinError(status, msg, err)
+	rerr.GinLogErrorAbort(c)
+}
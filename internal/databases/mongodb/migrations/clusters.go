@@ -0,0 +1,108 @@
+package mongodbmigrations
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/NorskHelsenett/ror/pkg/clients/mongodb"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+const (
+	clusterKind = "KubernetesCluster"
+	uuidPattern = "^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$"
+)
+
+var uuidRegexp = regexp.MustCompile("(?i)" + uuidPattern)
+
+// notUuid matches string values that are not a uid, such as legacy cluster
+// ids.
+var notUuid = bson.M{"$not": bson.Regex{Pattern: uuidPattern, Options: "i"}}
+
+// clusterDocument is the part of a KubernetesCluster resource the cluster
+// migrations read.
+type clusterDocument struct {
+	Id      any    `bson:"_id"`
+	Uid     string `bson:"uid"`
+	RorMeta struct {
+		Ownerref struct {
+			Subject string `bson:"subject"`
+		} `bson:"ownerref"`
+	} `bson:"rormeta"`
+	Metadata struct {
+		Name              string `bson:"name"`
+		CreationTimestamp struct {
+			Time any `bson:"time"`
+		} `bson:"creationtimestamp"`
+	} `bson:"metadata"`
+	KubernetesCluster struct {
+		Status struct {
+			AgentStatus struct {
+				ClusterId string `bson:"clusterid"`
+			} `bson:"agentstatus"`
+		} `bson:"status"`
+	} `bson:"kubernetescluster"`
+}
+
+// clusterId is the cluster id reported by the agent, the authoritative
+// source as it is not changed by ownerref migrations.
+func (d clusterDocument) clusterId() string {
+	return d.KubernetesCluster.Status.AgentStatus.ClusterId
+}
+
+// created returns the creation time of the resource, or false when it has
+// none.
+func (d clusterDocument) created() (time.Time, bool) {
+	switch created := d.Metadata.CreationTimestamp.Time.(type) {
+	case bson.DateTime:
+		return created.Time(), true
+	case time.Time:
+		return created, true
+	case string:
+		parsed, err := time.Parse(time.RFC3339, created)
+		return parsed, err == nil
+	}
+	return time.Time{}, false
+}
+
+func getClusterDocuments(ctx context.Context) ([]clusterDocument, error) {
+	collection := mongodb.GetMongoDb().Collection("resourcesv2")
+	cursor, err := collection.Find(ctx,
+		bson.M{"typemeta.kind": clusterKind},
+		options.Find().SetProjection(bson.M{
+			"uid":                             1,
+			"rormeta.ownerref.subject":        1,
+			"metadata.name":                   1,
+			"metadata.creationtimestamp.time": 1,
+			"kubernetescluster.status.agentstatus.clusterid": 1,
+		}),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("could not find KubernetesCluster resources: %w", err)
+	}
+	var documents []clusterDocument
+	if err := cursor.All(ctx, &documents); err != nil {
+		return nil, fmt.Errorf("could not decode KubernetesCluster resources: %w", err)
+	}
+	return documents, nil
+}
+
+// distinctStrings returns the distinct string values of the field in the
+// documents matching the filter.
+func distinctStrings(ctx context.Context, collectionName string, field string, filter bson.M) ([]string, error) {
+	var values []any
+	err := mongodb.GetMongoDb().Collection(collectionName).Distinct(ctx, field, filter).Decode(&values)
+	if err != nil {
+		return nil, fmt.Errorf("could not get distinct %s.%s: %w", collectionName, field, err)
+	}
+	strings := make([]string, 0, len(values))
+	for _, value := range values {
+		if s, ok := value.(string); ok {
+			strings = append(strings, s)
+		}
+	}
+	return strings, nil
+}
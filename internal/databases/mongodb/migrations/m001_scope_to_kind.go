@@ -0,0 +1,70 @@
+package mongodbmigrations
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/NorskHelsenett/ror/pkg/clients/mongodb"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// legacyKinds maps legacy scope names, and subjects of type level grants in
+// the ror scope, to resource kind names.
+var legacyKinds = []struct {
+	legacy string
+	kind   string
+}{
+	{legacy: "cluster", kind: "KubernetesCluster"},
+	{legacy: "project", kind: "Project"},
+	{legacy: "workspace", kind: "Workspace"},
+	{legacy: "virtualmachine", kind: "VirtualMachine"},
+	{legacy: "backup", kind: "BackupJob"},
+	{legacy: "datacenter", kind: "Datacenter"},
+	{legacy: "machine", kind: "Machine"},
+}
+
+var scopeToKindMigration = Migration{
+	Version:     1,
+	Name:        "scope_to_kind",
+	Description: "Rename legacy scope values in acl and resourcesv2 ownerrefs to resource kind names",
+	Run:         migrateScopeToKind,
+}
+
+// migrateScopeToKind only renames values matching the legacy names, running
+// it again changes nothing.
+func migrateScopeToKind(ctx context.Context, execution *Execution) error {
+	db := mongodb.GetMongoDb()
+	acl := db.Collection("acl")
+	resources := db.Collection("resourcesv2")
+
+	for _, names := range legacyKinds {
+		_, err := execution.UpdateMany(ctx, acl,
+			bson.M{"scope": names.legacy},
+			bson.M{"$set": bson.M{"scope": names.kind}},
+			fmt.Sprintf("acl.scope %s -> %s", names.legacy, names.kind))
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, names := range legacyKinds {
+		_, err := execution.UpdateMany(ctx, acl,
+			bson.M{"scope": "ror", "subject": names.legacy},
+			bson.M{"$set": bson.M{"subject": names.kind}},
+			fmt.Sprintf("acl.subject (scope ror) %s -> %s", names.legacy, names.kind))
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, names := range legacyKinds {
+		_, err := execution.UpdateMany(ctx, resources,
+			bson.M{"rormeta.ownerref.scope": names.legacy},
+			bson.M{"$set": bson.M{"rormeta.ownerref.scope": names.kind}},
+			fmt.Sprintf("resourcesv2.rormeta.ownerref.scope %s -> %s", names.legacy, names.kind))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package mongodbmigrations
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/NorskHelsenett/ror/pkg/clients/mongodb"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+var subjectClusterIdToUidMigration = Migration{
+	Version:     2,
+	Name:        "subject_clusterid_to_uid",
+	Description: "Replace cluster ids with cluster uids in KubernetesCluster ownerref and acl subjects",
+	Run:         migrateSubjectClusterIdToUid,
+}
+
+// subjectTargets are the collections with cluster id subjects to replace.
+var subjectTargets = []struct {
+	collection   string
+	scopeField   string
+	subjectField string
+}{
+	{collection: "resourcesv2", scopeField: "rormeta.ownerref.scope", subjectField: "rormeta.ownerref.subject"},
+	{collection: "acl", scopeField: "scope", subjectField: "subject"},
+}
+
+// migrateSubjectClusterIdToUid looks up the uid of each cluster id from the
+// KubernetesCluster resources. Subjects that are uids already are skipped, so
+// running it again changes nothing.
+func migrateSubjectClusterIdToUid(ctx context.Context, execution *Execution) error {
+	clusters, err := getClusterDocuments(ctx)
+	if err != nil {
+		return err
+	}
+	clusterIdToUid := make(map[string]string, len(clusters))
+	for _, cluster := range clusters {
+		if cluster.Uid != "" && cluster.clusterId() != "" {
+			clusterIdToUid[cluster.clusterId()] = cluster.Uid
+		}
+	}
+	execution.Reportf("found %d KubernetesCluster resources with a cluster id", len(clusterIdToUid))
+
+	db := mongodb.GetMongoDb()
+	if len(clusterIdToUid) == 0 {
+		// Without clusters the cluster ids can not be replaced. The migration
+		// fails rather than being recorded as applied while cluster ids are
+		// left to replace.
+		for _, target := range subjectTargets {
+			count, err := db.Collection(target.collection).CountDocuments(ctx, bson.M{target.scopeField: clusterKind, target.subjectField: notUuid})
+			if err != nil {
+				return fmt.Errorf("could not count %s documents with a cluster id: %w", target.collection, err)
+			}
+			if count > 0 {
+				return fmt.Errorf("no KubernetesCluster resources found to look up the uids of %d %s documents with a cluster id", count, target.collection)
+			}
+		}
+		return nil
+	}
+
+	for _, target := range subjectTargets {
+		subjects, err := distinctStrings(ctx, target.collection, target.subjectField, bson.M{target.scopeField: clusterKind})
+		if err != nil {
+			return err
+		}
+
+		var orphaned int64
+		for _, subject := range subjects {
+			if uuidRegexp.MatchString(subject) {
+				continue
+			}
+			filter := bson.M{target.scopeField: clusterKind, target.subjectField: subject}
+			uid, ok := clusterIdToUid[subject]
+			if !ok {
+				count, err := db.Collection(target.collection).CountDocuments(ctx, filter)
+				if err != nil {
+					return fmt.Errorf("could not count %s documents of cluster id %s: %w", target.collection, subject, err)
+				}
+				execution.Reportf("%s: no uid found for cluster id %q (%d documents), skipped", target.collection, subject, count)
+				orphaned += count
+				continue
+			}
+			_, err := execution.UpdateMany(ctx, db.Collection(target.collection), filter,
+				bson.M{"$set": bson.M{target.subjectField: uid}},
+				fmt.Sprintf("%s.%s %s -> %s", target.collection, target.subjectField, subject, uid))
+			if err != nil {
+				return err
+			}
+		}
+		execution.Reportf("%s: %d orphaned documents", target.collection, orphaned)
+	}
+
+	// KubernetesCluster resources own themselves, their ownerref subject is
+	// their own uid.
+	_, err = execution.UpdateMany(ctx, db.Collection("resourcesv2"),
+		bson.M{
+			"typemeta.kind":            clusterKind,
+			"rormeta.ownerref.scope":   clusterKind,
+			"rormeta.ownerref.subject": notUuid,
+			"uid":                      bson.M{"$nin": bson.A{nil, ""}},
+		},
+		bson.A{bson.M{"$set": bson.M{"rormeta.ownerref.subject": "$uid"}}},
+		"self-referencing KubernetesCluster ownerrefs")
+	return err
+}
@@ -0,0 +1,150 @@
+package mongodbmigrations
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/NorskHelsenett/ror/pkg/clients/mongodb"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// unknownClusterId is reported by agents that never learned their cluster
+// id, it is not a real cluster.
+const unknownClusterId = "unknown-undefined"
+
+var orphanedClustersReport = Migration{
+	Version:     3,
+	Name:        "report_orphaned_clusters",
+	Description: "Report cluster ids without a KubernetesCluster resource, with their resource and acl counts",
+	ReportOnly:  true,
+	Run:         reportOrphanedClusters,
+}
+
+type orphanedCluster struct {
+	clusterId string
+	resources int64
+	acls      int64
+}
+
+func reportOrphanedClusters(ctx context.Context, execution *Execution) error {
+	clusters, err := getClusterDocuments(ctx)
+	if err != nil {
+		return err
+	}
+	known := make(map[string]bool)
+	for _, cluster := range clusters {
+		if cluster.Metadata.Name != "" && cluster.Metadata.Name != unknownClusterId {
+			known[cluster.Metadata.Name] = true
+		}
+		if cluster.RorMeta.Ownerref.Subject != "" {
+			known[cluster.RorMeta.Ownerref.Subject] = true
+		}
+	}
+
+	orphans := make(map[string]*orphanedCluster)
+	resourceCounts, err := countBySubject(ctx, "resourcesv2", "rormeta.ownerref.scope", "rormeta.ownerref.subject")
+	if err != nil {
+		return err
+	}
+	for clusterId, count := range resourceCounts {
+		if !known[clusterId] {
+			orphans[clusterId] = &orphanedCluster{clusterId: clusterId, resources: count}
+		}
+	}
+	aclCounts, err := countBySubject(ctx, "acl", "scope", "subject")
+	if err != nil {
+		return err
+	}
+	for clusterId, count := range aclCounts {
+		if orphan, ok := orphans[clusterId]; ok {
+			orphan.acls = count
+		} else if !known[clusterId] {
+			orphans[clusterId] = &orphanedCluster{clusterId: clusterId, acls: count}
+		}
+	}
+
+	inClustersCollection, err := legacyClusterIds(ctx)
+	if err != nil {
+		return err
+	}
+
+	sorted := make([]*orphanedCluster, 0, len(orphans))
+	for _, orphan := range orphans {
+		sorted = append(sorted, orphan)
+	}
+	slices.SortFunc(sorted, func(a, b *orphanedCluster) int {
+		return cmp.Or(cmp.Compare(b.resources, a.resources), strings.Compare(a.clusterId, b.clusterId))
+	})
+
+	var totalResources, totalAcls int64
+	var legacy int
+	for _, orphan := range sorted {
+		inLegacy := "no"
+		if inClustersCollection[orphan.clusterId] {
+			inLegacy = "yes"
+			legacy++
+		}
+		execution.Reportf("%s: %d resources, %d acls, in clusters collection: %s", orphan.clusterId, orphan.resources, orphan.acls, inLegacy)
+		totalResources += orphan.resources
+		totalAcls += orphan.acls
+	}
+	execution.Reportf("%d orphaned clusters with %d resources and %d acls, %d of them exist in the legacy clusters collection", len(sorted), totalResources, totalAcls, legacy)
+	return nil
+}
+
+// countBySubject counts the documents of each non-uid subject in the
+// KubernetesCluster scope.
+func countBySubject(ctx context.Context, collectionName string, scopeField string, subjectField string) (map[string]int64, error) {
+	cursor, err := mongodb.GetMongoDb().Collection(collectionName).Aggregate(ctx, bson.A{
+		bson.M{"$match": bson.M{scopeField: clusterKind, subjectField: notUuid}},
+		bson.M{"$group": bson.M{"_id": "$" + subjectField, "count": bson.M{"$sum": 1}}},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not count %s by subject: %w", collectionName, err)
+	}
+	var groups []struct {
+		Subject any   `bson:"_id"`
+		Count   int64 `bson:"count"`
+	}
+	if err := cursor.All(ctx, &groups); err != nil {
+		return nil, fmt.Errorf("could not decode %s counts: %w", collectionName, err)
+	}
+
+	counts := make(map[string]int64, len(groups))
+	for _, group := range groups {
+		if subject, ok := group.Subject.(string); ok {
+			counts[subject] = group.Count
+		}
+	}
+	return counts, nil
+}
+
+// legacyClusterIds returns the cluster ids in the legacy clusters collection.
+func legacyClusterIds(ctx context.Context) (map[string]bool, error) {
+	cursor, err := mongodb.GetMongoDb().Collection("clusters").Find(ctx, bson.M{},
+		options.Find().SetProjection(bson.M{"clusterid": 1, "identifier": 1}))
+	if err != nil {
+		return nil, fmt.Errorf("could not find clusters: %w", err)
+	}
+	var documents []struct {
+		ClusterId  string `bson:"clusterid"`
+		Identifier string `bson:"identifier"`
+	}
+	if err := cursor.All(ctx, &documents); err != nil {
+		return nil, fmt.Errorf("could not decode clusters: %w", err)
+	}
+
+	clusterIds := make(map[string]bool, len(documents))
+	for _, document := range documents {
+		if document.ClusterId != "" {
+			clusterIds[document.ClusterId] = true
+		} else if document.Identifier != "" {
+			clusterIds[document.Identifier] = true
+		}
+	}
+	return clusterIds, nil
+}
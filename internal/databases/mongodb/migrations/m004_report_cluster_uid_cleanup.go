@@ -0,0 +1,192 @@
+package mongodbmigrations
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/NorskHelsenett/ror/pkg/clients/mongodb"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+var clusterUidCleanupReport = Migration{
+	Version:     4,
+	Name:        "report_cluster_uid_cleanup",
+	Description: "Report what de-duplicating KubernetesCluster resources and backfilling the canonical cluster uid would change",
+	ReportOnly:  true,
+	Run:         reportClusterUidCleanup,
+}
+
+// canonicalCluster is the KubernetesCluster resource kept for a cluster id,
+// the other resources of the cluster id are orphans.
+type canonicalCluster struct {
+	kept            clusterDocument
+	orphans         []clusterDocument
+	selfOwningCount int
+}
+
+// reportClusterUidCleanup reports the cleanup of clusters created multiple
+// times: the uid backfill of apikeys and the legacy clusters collection, the
+// KubernetesCluster resources to delete, and the resources and acl entries
+// to re-point from orphan uids to the canonical uid.
+func reportClusterUidCleanup(ctx context.Context, execution *Execution) error {
+	documents, err := getClusterDocuments(ctx)
+	if err != nil {
+		return err
+	}
+	clusters, skipped := canonicalClusters(documents)
+	execution.Reportf("KubernetesCluster resources: %d scanned, %d without a cluster id, %d with cluster id %s skipped", len(documents), skipped.noClusterId, skipped.sentinel, unknownClusterId)
+
+	var orphanUids []string
+	var clustersWithDuplicates, orphanDocuments, keptNeedsNormalize int
+	var multipleSelfOwning []string
+	for clusterId, cluster := range clusters {
+		if len(cluster.orphans) > 0 {
+			clustersWithDuplicates++
+		}
+		orphanDocuments += len(cluster.orphans)
+		for _, orphan := range cluster.orphans {
+			if orphan.Uid != "" && orphan.Uid != cluster.kept.Uid {
+				orphanUids = append(orphanUids, orphan.Uid)
+			}
+		}
+		if cluster.kept.Uid != "" && cluster.kept.RorMeta.Ownerref.Subject != cluster.kept.Uid {
+			keptNeedsNormalize++
+		}
+		if cluster.selfOwningCount > 1 {
+			multipleSelfOwning = append(multipleSelfOwning, clusterId)
+		}
+	}
+	slices.Sort(multipleSelfOwning)
+	execution.Reportf("distinct cluster ids: %d, with duplicates: %d, orphan resources to delete: %d", len(clusters), clustersWithDuplicates, orphanDocuments)
+	execution.Reportf("kept resources needing ownerref fix: %d", keptNeedsNormalize)
+	execution.Reportf("cluster ids with more than one self-owning resource (review): %v", multipleSelfOwning)
+
+	if err := reportUidBackfill(ctx, execution, "apikeys", bson.M{"type": "Cluster"}, "identifier", clusters); err != nil {
+		return err
+	}
+
+	db := mongodb.GetMongoDb()
+	var childResources, aclEntries int64
+	if len(orphanUids) > 0 {
+		childResources, err = db.Collection("resourcesv2").CountDocuments(ctx, bson.M{
+			"typemeta.kind":            bson.M{"$ne": clusterKind},
+			"rormeta.ownerref.subject": bson.M{"$in": orphanUids},
+		})
+		if err != nil {
+			return fmt.Errorf("could not count child resources of orphan uids: %w", err)
+		}
+		aclEntries, err = db.Collection("acl").CountDocuments(ctx, bson.M{
+			"scope":   clusterKind,
+			"subject": bson.M{"$in": orphanUids},
+		})
+		if err != nil {
+			return fmt.Errorf("could not count acl entries of orphan uids: %w", err)
+		}
+	}
+	execution.Reportf("orphan uids: %d, child resources to re-point: %d, acl entries to re-point: %d", len(orphanUids), childResources, aclEntries)
+
+	return reportUidBackfill(ctx, execution, "clusters", bson.M{}, "clusterid", clusters)
+}
+
+type skippedClusters struct {
+	noClusterId int
+	sentinel    int
+}
+
+// canonicalClusters groups the KubernetesCluster resources by cluster id and
+// picks the resource to keep, like the api resolver does: a self-owning
+// resource, then the oldest, then the lowest _id.
+func canonicalClusters(documents []clusterDocument) (map[string]*canonicalCluster, skippedClusters) {
+	var skipped skippedClusters
+	byClusterId := make(map[string][]clusterDocument)
+	for _, document := range documents {
+		switch document.clusterId() {
+		case "":
+			skipped.noClusterId++
+		case unknownClusterId:
+			skipped.sentinel++
+		default:
+			byClusterId[document.clusterId()] = append(byClusterId[document.clusterId()], document)
+		}
+	}
+
+	clusters := make(map[string]*canonicalCluster, len(byClusterId))
+	for clusterId, documents := range byClusterId {
+		slices.SortFunc(documents, compareCanonical)
+		cluster := &canonicalCluster{kept: documents[0], orphans: documents[1:]}
+		for _, document := range documents {
+			if document.selfOwning() {
+				cluster.selfOwningCount++
+			}
+		}
+		clusters[clusterId] = cluster
+	}
+	return clusters, skipped
+}
+
+func (d clusterDocument) selfOwning() bool {
+	return d.Uid != "" && d.Uid == d.RorMeta.Ownerref.Subject
+}
+
+func compareCanonical(a, b clusterDocument) int {
+	if a.selfOwning() != b.selfOwning() {
+		if a.selfOwning() {
+			return -1
+		}
+		return 1
+	}
+	return cmp.Or(
+		createdOrMax(a).Compare(createdOrMax(b)),
+		cmp.Compare(fmt.Sprint(a.Id), fmt.Sprint(b.Id)),
+	)
+}
+
+// createdOrMax sorts resources without a creation time last.
+func createdOrMax(d clusterDocument) time.Time {
+	if created, ok := d.created(); ok {
+		return created
+	}
+	return time.Unix(1<<62, 0)
+}
+
+// reportUidBackfill reports how many documents of the collection would get
+// the canonical uid of the cluster id in clusterIdField.
+func reportUidBackfill(ctx context.Context, execution *Execution, collectionName string, filter bson.M, clusterIdField string, clusters map[string]*canonicalCluster) error {
+	cursor, err := mongodb.GetMongoDb().Collection(collectionName).Find(ctx, filter,
+		options.Find().SetProjection(bson.M{clusterIdField: 1, "uid": 1}))
+	if err != nil {
+		return fmt.Errorf("could not find %s: %w", collectionName, err)
+	}
+	var documents []bson.M
+	if err := cursor.All(ctx, &documents); err != nil {
+		return fmt.Errorf("could not decode %s: %w", collectionName, err)
+	}
+
+	var correct, backfill, differs, noResource, sentinel int
+	for _, document := range documents {
+		clusterId, _ := document[clusterIdField].(string)
+		uid, _ := document["uid"].(string)
+		if clusterId == unknownClusterId {
+			sentinel++
+			continue
+		}
+		cluster, ok := clusters[clusterId]
+		switch {
+		case !ok || cluster.kept.Uid == "":
+			noResource++
+		case uid == cluster.kept.Uid:
+			correct++
+		case uid != "":
+			differs++
+		default:
+			backfill++
+		}
+	}
+	execution.Reportf("%s.uid: %d total, %d correct, %d to backfill, %d with a different uid (review), %d without a KubernetesCluster resource, %d sentinel skipped",
+		collectionName, len(documents), correct, backfill, differs, noResource, sentinel)
+	return nil
+}
@@ -0,0 +1,65 @@
+package mongodbmigrations
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/NorskHelsenett/ror-api/internal/databases/mongodb/repositories/priceitems"
+	"github.com/NorskHelsenett/ror-api/internal/models/pricemodels"
+
+	"github.com/NorskHelsenett/ror/pkg/clients/mongodb"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+var seedPriceCatalogueMigration = Migration{
+	Version:     5,
+	Name:        "seed_price_catalogue",
+	Description: "Add the cpu and memory rates clusters were priced with before the price catalogue",
+	Run:         seedPriceCatalogue,
+}
+
+// defaultPriceItems are the monthly rates per vCPU and GiB of memory that
+// were hard-coded before the price catalogue.
+var defaultPriceItems = []pricemodels.PriceItem{
+	{Kind: pricemodels.PriceItemKindCpu, Price: 269.50, Currency: "NOK", EffectiveFrom: time.Date(2022, time.January, 1, 0, 0, 0, 0, time.UTC)},
+	{Kind: pricemodels.PriceItemKindMemory, Price: 59.50, Currency: "NOK", EffectiveFrom: time.Date(2022, time.January, 1, 0, 0, 0, 0, time.UTC)},
+}
+
+// seedPriceCatalogue inserts the default rates unless a rate for all
+// providers and datacenters with the same effective date exists, so running
+// it again changes nothing.
+func seedPriceCatalogue(ctx context.Context, execution *Execution) error {
+	collection := mongodb.GetMongoDb().Collection(priceitems.CollectionName)
+	for _, item := range defaultPriceItems {
+		filter := bson.M{
+			"kind":          item.Kind,
+			"provider":      bson.M{"$exists": false},
+			"datacenter":    bson.M{"$exists": false},
+			"effectivefrom": item.EffectiveFrom,
+		}
+		if execution.DryRun {
+			count, err := collection.CountDocuments(ctx, filter)
+			if err != nil {
+				return fmt.Errorf("could not count %s price items: %w", item.Kind, err)
+			}
+			if count == 0 {
+				execution.Reportf("would add %s rate %.2f %s", item.Kind, item.Price, item.Currency)
+			}
+			continue
+		}
+
+		item.Id = bson.NewObjectID()
+		item.UpdatedBy = "migration"
+		item.Updated = time.Now()
+		result, err := collection.UpdateOne(ctx, filter, bson.M{"$setOnInsert": item}, options.UpdateOne().SetUpsert(true))
+		if err != nil {
+			return fmt.Errorf("could not add %s price item: %w", item.Kind, err)
+		}
+		if result.UpsertedCount > 0 {
+			execution.Reportf("added %s rate %.2f %s", item.Kind, item.Price, item.Currency)
+		}
+	}
+	return nil
+}
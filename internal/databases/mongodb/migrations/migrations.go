@@ -0,0 +1,88 @@
+// Package mongodbmigrations applies versioned schema and data migrations to
+// the ror database. Migrations run in version order, each is applied once and
+// recorded in the schema_migrations collection.
+package mongodbmigrations
+
+import (
+	"context"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// Migration is a versioned change to the database. Run must be idempotent,
+// a migration interrupted before it is recorded is run again. When the
+// execution is a dry run, Run must not write and only report what it would
+// change.
+type Migration struct {
+	Version     int
+	Name        string
+	Description string
+
+	// ReportOnly migrations never write. They are run on dry runs to
+	// review data, and never recorded as applied.
+	ReportOnly bool
+
+	Run func(ctx context.Context, execution *Execution) error
+}
+
+// Execution is a single run of a migration.
+type Execution struct {
+	DryRun bool
+	report []string
+}
+
+// Reportf adds a line to the report of the execution.
+func (e *Execution) Reportf(format string, args ...any) {
+	e.report = append(e.report, fmt.Sprintf(format, args...))
+}
+
+// Report returns the lines reported by the migration.
+func (e *Execution) Report() []string {
+	return e.report
+}
+
+// UpdateMany updates the documents matching the filter, or counts them on a
+// dry run, and reports the result under the description. The update is an
+// update document or an aggregation pipeline.
+func (e *Execution) UpdateMany(ctx context.Context, collection *mongo.Collection, filter bson.M, update any, description string) (int64, error) {
+	if e.DryRun {
+		count, err := collection.CountDocuments(ctx, filter)
+		if err != nil {
+			return 0, fmt.Errorf("could not count %s: %w", description, err)
+		}
+		e.Reportf("%s: %d documents would be updated", description, count)
+		return count, nil
+	}
+
+	result, err := collection.UpdateMany(ctx, filter, update)
+	if err != nil {
+		return 0, fmt.Errorf("could not update %s: %w", description, err)
+	}
+	e.Reportf("%s: %d documents updated", description, result.ModifiedCount)
+	return result.ModifiedCount, nil
+}
+
+// migrations are the registered migrations, in version order.
+var migrations = []Migration{
+	scopeToKindMigration,
+	subjectClusterIdToUidMigration,
+	orphanedClustersReport,
+	clusterUidCleanupReport,
+	seedPriceCatalogueMigration,
+}
+
+// validateMigrations checks that versions are positive, unique and ascending,
+// so the order migrations are applied in never changes.
+func validateMigrations(migrations []Migration) error {
+	for i, migration := range migrations {
+		if migration.Version <= 0 || migration.Name == "" || migration.Run == nil {
+			return fmt.Errorf("migration %d %q is incomplete", migration.Version, migration.Name)
+		}
+		if i > 0 && migration.Version <= migrations[i-1].Version {
+			return fmt.Errorf("migration %d %q is not ordered after migration %d", migration.Version, migration.Name, migrations[i-1].Version)
+		}
+	}
+	return nil
+}
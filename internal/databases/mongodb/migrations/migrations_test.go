@@ -0,0 +1,61 @@
+package mongodbmigrations
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+func TestRegisteredMigrationsAreOrdered(t *testing.T) {
+	require.NoError(t, validateMigrations(migrations))
+
+	run := func(context.Context, *Execution) error { return nil }
+	assert.Error(t, validateMigrations([]Migration{{Version: 2, Name: "b", Run: run}, {Version: 1, Name: "a", Run: run}}))
+	assert.Error(t, validateMigrations([]Migration{{Version: 1, Name: "a", Run: run}, {Version: 1, Name: "b", Run: run}}))
+	assert.Error(t, validateMigrations([]Migration{{Version: 1, Name: "a"}}))
+}
+
+func TestParseMode(t *testing.T) {
+	mode, err := ParseMode("")
+	require.NoError(t, err)
+	assert.Equal(t, ModeDryRun, mode)
+
+	mode, err = ParseMode("apply")
+	require.NoError(t, err)
+	assert.Equal(t, ModeApply, mode)
+
+	_, err = ParseMode("force")
+	assert.ErrorIs(t, err, ErrInvalidMode)
+}
+
+func TestCanonicalClusters(t *testing.T) {
+	document := func(uid string, subject string, clusterId string, created time.Time) clusterDocument {
+		var d clusterDocument
+		d.Id = uid
+		d.Uid = uid
+		d.RorMeta.Ownerref.Subject = subject
+		d.KubernetesCluster.Status.AgentStatus.ClusterId = clusterId
+		d.Metadata.CreationTimestamp.Time = bson.NewDateTimeFromTime(created)
+		return d
+	}
+	now := time.Now()
+
+	clusters, skipped := canonicalClusters([]clusterDocument{
+		document("old", "a", "a", now.Add(-time.Hour)),
+		document("self", "self", "a", now),
+		document("oldest", "b", "b", now.Add(-2*time.Hour)),
+		document("newer", "b", "b", now),
+		document("unknown", "x", unknownClusterId, now),
+		document("none", "y", "", now),
+	})
+
+	assert.Equal(t, skippedClusters{noClusterId: 1, sentinel: 1}, skipped)
+	require.Len(t, clusters, 2)
+	assert.Equal(t, "self", clusters["a"].kept.Uid, "a self-owning resource is kept")
+	assert.Equal(t, "oldest", clusters["b"].kept.Uid, "else the oldest resource is kept")
+	assert.Len(t, clusters["b"].orphans, 1)
+}
@@ -0,0 +1,318 @@
+package mongodbmigrations
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/NorskHelsenett/ror/pkg/clients/mongodb"
+	"github.com/NorskHelsenett/ror/pkg/config/rorconfig"
+	"github.com/NorskHelsenett/ror/pkg/rlog"
+	"github.com/google/uuid"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+const (
+	MIGRATIONCOLLECTION     = "schema_migrations"
+	MIGRATIONLOCKCOLLECTION = "schema_migrations_lock"
+
+	migrationLockId = "migrations"
+	lockTTL         = 5 * time.Minute
+)
+
+// Mode selects what a run does with the pending migrations.
+type Mode string
+
+const (
+	// ModeApply applies pending migrations and records them.
+	ModeApply Mode = "apply"
+	// ModeDryRun reports what pending migrations would change, and runs the
+	// report only migrations, without writing.
+	ModeDryRun Mode = "dryrun"
+	// ModeOff does not run migrations.
+	ModeOff Mode = "off"
+)
+
+var (
+	ErrInvalidMode = errors.New("invalid migration mode")
+	ErrLockHeld    = errors.New("migrations are being run by another replica")
+	ErrLockLost    = errors.New("the migration lock was lost")
+)
+
+// ParseMode parses a migration mode, an empty mode is ModeDryRun.
+func ParseMode(mode string) (Mode, error) {
+	switch Mode(mode) {
+	case "", ModeDryRun:
+		return ModeDryRun, nil
+	case ModeApply, ModeOff:
+		return Mode(mode), nil
+	}
+	return "", fmt.Errorf("%w: %q", ErrInvalidMode, mode)
+}
+
+// MigrationRun is the result of the last execution of a migration.
+type MigrationRun struct {
+	Mode       Mode      `json:"mode" bson:"mode"`
+	StartedAt  time.Time `json:"startedAt" bson:"startedat"`
+	FinishedAt time.Time `json:"finishedAt" bson:"finishedat"`
+	Report     []string  `json:"report" bson:"report"`
+	Error      string    `json:"error,omitempty" bson:"error,omitempty"`
+}
+
+// MigrationRecord is the document recorded for a migration in the
+// schema_migrations collection.
+type MigrationRecord struct {
+	Version   int           `json:"version" bson:"_id"`
+	Name      string        `json:"name" bson:"name"`
+	Applied   bool          `json:"applied" bson:"applied"`
+	AppliedAt *time.Time    `json:"appliedAt,omitempty" bson:"appliedat,omitempty"`
+	LastRun   *MigrationRun `json:"lastRun,omitempty" bson:"lastrun,omitempty"`
+}
+
+// MigrationStatus is a registered migration and its record.
+type MigrationStatus struct {
+	MigrationRecord
+	Description string `json:"description"`
+	ReportOnly  bool   `json:"reportOnly"`
+}
+
+// RunAtStartup runs the migrations in the mode set in MONGODB_MIGRATIONS,
+// by default a dry run. Only the replica holding the migration lock runs
+// them, the others skip.
+func RunAtStartup(ctx context.Context) {
+	mode, err := ParseMode(rorconfig.GetString("MONGODB_MIGRATIONS"))
+	if err != nil {
+		rlog.Error("could not parse migration mode, migrations are not run", err)
+		return
+	}
+	if mode == ModeOff {
+		rlog.Info("database migrations are turned off")
+		return
+	}
+
+	err = Run(ctx, mode)
+	if errors.Is(err, ErrLockHeld) {
+		rlog.Info("skipped database migrations, they are run by another replica")
+		return
+	}
+	if err != nil {
+		rlog.Error("could not run database migrations", err)
+	}
+}
+
+// Run runs the pending migrations in version order while holding the
+// migration lock. The run stops when the lock is lost.
+func Run(ctx context.Context, mode Mode) error {
+	if err := validateMigrations(migrations); err != nil {
+		return err
+	}
+
+	ctx, release, err := acquireLock(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	return runPending(ctx, mode)
+}
+
+// Start takes the migration lock and runs the pending migrations in the
+// background, so a request does not wait for them. The result is recorded
+// in the migration status.
+func Start(ctx context.Context, mode Mode) error {
+	if err := validateMigrations(migrations); err != nil {
+		return err
+	}
+
+	ctx, release, err := acquireLock(context.WithoutCancel(ctx))
+	if err != nil {
+		return err
+	}
+	go func() {
+		defer release()
+		if err := runPending(ctx, mode); err != nil {
+			rlog.Error("could not run database migrations", err)
+		}
+	}()
+	return nil
+}
+
+// runPending runs the migrations not applied yet. A failing migration stops
+// the run, later migrations may depend on it.
+func runPending(ctx context.Context, mode Mode) error {
+	records, err := getRecords(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, migration := range migrations {
+		if ctx.Err() != nil {
+			return fmt.Errorf("stopped before migration %d %s: %w", migration.Version, migration.Name, context.Cause(ctx))
+		}
+		if records[migration.Version].Applied {
+			continue
+		}
+		if migration.ReportOnly && mode != ModeDryRun {
+			continue
+		}
+
+		err := runMigration(ctx, migration, mode)
+		if err != nil {
+			return fmt.Errorf("migration %d %s failed: %w", migration.Version, migration.Name, err)
+		}
+	}
+	return nil
+}
+
+func runMigration(ctx context.Context, migration Migration, mode Mode) error {
+	rlog.Infoc(ctx, "running database migration", rlog.Int("version", migration.Version), rlog.String("name", migration.Name), rlog.String("mode", string(mode)))
+
+	execution := &Execution{DryRun: mode == ModeDryRun || migration.ReportOnly}
+	run := MigrationRun{
+		Mode:      mode,
+		StartedAt: time.Now(),
+	}
+	err := migration.Run(ctx, execution)
+	run.FinishedAt = time.Now()
+	run.Report = execution.Report()
+	if err != nil {
+		run.Error = err.Error()
+	}
+
+	// A migration interrupted by losing the lock is recorded by the replica
+	// holding it.
+	if ctx.Err() != nil {
+		return errors.Join(err, context.Cause(ctx))
+	}
+	set := bson.M{"name": migration.Name, "lastrun": run}
+	if err == nil && !execution.DryRun {
+		set["applied"] = true
+		set["appliedat"] = run.FinishedAt
+	}
+	collection := mongodb.GetMongoDb().Collection(MIGRATIONCOLLECTION)
+	_, recordErr := collection.UpdateOne(ctx, bson.M{"_id": migration.Version}, bson.M{"$set": set}, options.UpdateOne().SetUpsert(true))
+	if recordErr != nil {
+		return errors.Join(err, fmt.Errorf("could not record migration: %w", recordErr))
+	}
+	for _, line := range run.Report {
+		rlog.Infoc(ctx, line, rlog.Int("version", migration.Version))
+	}
+	return err
+}
+
+// GetStatus returns the registered migrations with their records.
+func GetStatus(ctx context.Context) ([]MigrationStatus, error) {
+	records, err := getRecords(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	status := make([]MigrationStatus, 0, len(migrations))
+	for _, migration := range migrations {
+		record, ok := records[migration.Version]
+		if !ok {
+			record = MigrationRecord{Version: migration.Version, Name: migration.Name}
+		}
+		status = append(status, MigrationStatus{
+			MigrationRecord: record,
+			Description:     migration.Description,
+			ReportOnly:      migration.ReportOnly,
+		})
+	}
+	return status, nil
+}
+
+func getRecords(ctx context.Context) (map[int]MigrationRecord, error) {
+	collection := mongodb.GetMongoDb().Collection(MIGRATIONCOLLECTION)
+	cursor, err := collection.Find(ctx, bson.M{})
+	if err != nil {
+		return nil, fmt.Errorf("could not get migration records: %w", err)
+	}
+	var found []MigrationRecord
+	if err := cursor.All(ctx, &found); err != nil {
+		return nil, fmt.Errorf("could not decode migration records: %w", err)
+	}
+
+	records := make(map[int]MigrationRecord, len(found))
+	for _, record := range found {
+		records[record.Version] = record
+	}
+	return records, nil
+}
+
+// acquireLock takes the migration lock, or returns ErrLockHeld when another
+// replica holds it. The lock expires unless it is refreshed, so a replica
+// that dies while migrating does not block the others. The returned context
+// is cancelled with ErrLockLost when the lock could not be kept, so the run
+// stops before another replica takes it. The returned function releases the
+// lock.
+func acquireLock(ctx context.Context) (context.Context, func(), error) {
+	collection := mongodb.GetMongoDb().Collection(MIGRATIONLOCKCOLLECTION)
+	hostname, _ := os.Hostname()
+	owner := fmt.Sprintf("%s/%s", hostname, uuid.NewString())
+
+	take := func(ctx context.Context) error {
+		now := time.Now()
+		_, err := collection.UpdateOne(ctx,
+			bson.M{"_id": migrationLockId, "$or": bson.A{
+				bson.M{"owner": owner},
+				bson.M{"expiresat": bson.M{"$lt": now}},
+			}},
+			bson.M{"$set": bson.M{"owner": owner, "expiresat": now.Add(lockTTL)}},
+			options.UpdateOne().SetUpsert(true),
+		)
+		if mongo.IsDuplicateKeyError(err) {
+			return ErrLockHeld
+		}
+		return err
+	}
+	if err := take(ctx); err != nil {
+		if errors.Is(err, ErrLockHeld) {
+			return nil, nil, err
+		}
+		return nil, nil, fmt.Errorf("could not take migration lock: %w", err)
+	}
+
+	lockCtx, lose := context.WithCancelCause(ctx)
+	refreshCtx, stop := context.WithCancel(context.WithoutCancel(ctx))
+	go func() {
+		ticker := time.NewTicker(lockTTL / 3)
+		defer ticker.Stop()
+		// The lock is given up a refresh interval before it expires, so the
+		// run has stopped before another replica can take it.
+		expires := time.Now().Add(lockTTL)
+		for {
+			select {
+			case <-refreshCtx.Done():
+				return
+			case <-ticker.C:
+				err := take(refreshCtx)
+				if err == nil {
+					expires = time.Now().Add(lockTTL)
+					continue
+				}
+				rlog.Error("could not refresh migration lock", err)
+				if errors.Is(err, ErrLockHeld) || time.Until(expires) <= lockTTL/3 {
+					lose(ErrLockLost)
+					return
+				}
+			}
+		}
+	}()
+
+	return lockCtx, func() {
+		stop()
+		lose(nil)
+		releaseCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 10*time.Second)
+		defer cancel()
+		_, err := collection.DeleteOne(releaseCtx, bson.M{"_id": migrationLockId, "owner": owner})
+		if err != nil {
+			rlog.Error("could not release migration lock", err)
+		}
+	}, nil
+}
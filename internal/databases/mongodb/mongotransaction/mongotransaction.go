@@ -0,0 +1,64 @@
+// Package mongotransaction runs writes to several collections in a MongoDB
+// transaction.
+package mongotransaction
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/NorskHelsenett/ror/pkg/clients/mongodb"
+	"github.com/NorskHelsenett/ror/pkg/rlog"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+var (
+	supportedOnce sync.Once
+	supported     bool
+)
+
+// Run runs fn in a transaction. The writes fn makes with the context it is
+// given are committed together when it returns nil and aborted when it
+// returns an error, and fn may be run again when the transaction has a
+// transient error. A standalone MongoDB, e.g. in development, does not
+// support transactions, and fn is then run without one.
+func Run(ctx context.Context, fn func(ctx context.Context) error) error {
+	if !transactionsSupported(ctx) {
+		return fn(ctx)
+	}
+
+	session, err := mongodb.GetMongoDb().Client().StartSession()
+	if err != nil {
+		return fmt.Errorf("could not start mongodb session: %w", err)
+	}
+	defer session.EndSession(ctx)
+
+	_, err = session.WithTransaction(ctx, func(ctx context.Context) (any, error) {
+		return nil, fn(ctx)
+	})
+	return err
+}
+
+// transactionsSupported reports whether MongoDB is a replica set or a
+// sharded cluster. It is assumed to be if it can not be asked, so the
+// transaction fails instead of running without one.
+func transactionsSupported(ctx context.Context) bool {
+	supportedOnce.Do(func() {
+		var hello struct {
+			SetName string `bson:"setName"`
+			Msg     string `bson:"msg"`
+		}
+		err := mongodb.GetMongoDb().RunCommand(ctx, bson.D{{Key: "hello", Value: 1}}).Decode(&hello)
+		if err != nil {
+			rlog.Errorc(ctx, "could not check whether mongodb supports transactions", err)
+			supported = true
+			return
+		}
+		supported = hello.SetName != "" || hello.Msg == "isdbgrid"
+		if !supported {
+			rlog.Warnc(ctx, "mongodb is standalone and does not support transactions, writing without them")
+		}
+	})
+	return supported
+}
@@ -0,0 +1,73 @@
+package clustercertificates
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/NorskHelsenett/ror-api/internal/models/certificatemodels"
+
+	"github.com/NorskHelsenett/ror/pkg/clients/mongodb"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+const (
+	CollectionName = "clustercertificates"
+)
+
+var (
+	ErrNotFound = errors.New("cluster certificate not found")
+	ErrExists   = errors.New("a certificate is already issued to the cluster")
+)
+
+// Create stores the certificate of the cluster, or returns ErrExists if a
+// certificate is already issued to the cluster.
+func Create(ctx context.Context, certificate *certificatemodels.ClusterCertificate) error {
+	db := mongodb.GetMongoDb()
+	_, err := db.Collection(CollectionName).InsertOne(ctx, certificate)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrExists
+	}
+	if err != nil {
+		return fmt.Errorf("could not store cluster certificate: %w", err)
+	}
+	return nil
+}
+
+// Upsert stores the certificate of the cluster, replacing the certificate
+// issued before it.
+func Upsert(ctx context.Context, certificate *certificatemodels.ClusterCertificate) error {
+	db := mongodb.GetMongoDb()
+	update := bson.M{
+		"$set": bson.M{
+			"uid":          certificate.Uid,
+			"serialnumber": certificate.SerialNumber,
+			"notafter":     certificate.NotAfter,
+			"updatedat":    certificate.UpdatedAt,
+		},
+		"$setOnInsert": bson.M{"issuedat": certificate.IssuedAt},
+	}
+	_, err := db.Collection(CollectionName).UpdateByID(ctx, certificate.ClusterId, update, options.UpdateOne().SetUpsert(true))
+	if err != nil {
+		return fmt.Errorf("could not store cluster certificate: %w", err)
+	}
+	return nil
+}
+
+// GetByClusterId returns the certificate issued to the cluster, or
+// ErrNotFound.
+func GetByClusterId(ctx context.Context, clusterId string) (certificatemodels.ClusterCertificate, error) {
+	db := mongodb.GetMongoDb()
+	var certificate certificatemodels.ClusterCertificate
+	err := db.Collection(CollectionName).FindOne(ctx, bson.M{"_id": clusterId}).Decode(&certificate)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return certificate, ErrNotFound
+	}
+	if err != nil {
+		return certificate, fmt.Errorf("could not get cluster certificate: %w", err)
+	}
+	return certificate, nil
+}
@@ -0,0 +1,86 @@
+package clusterissuers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/NorskHelsenett/ror-api/internal/models/serviceaccountmodels"
+
+	"github.com/NorskHelsenett/ror/pkg/clients/mongodb"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+const (
+	CollectionName = "clusterissuers"
+)
+
+var (
+	ErrNotFound = errors.New("cluster issuer not found")
+	ErrExists   = errors.New("cluster issuer already registered")
+)
+
+// Create stores the issuer of the cluster, or returns ErrExists if the
+// cluster already has one.
+func Create(ctx context.Context, issuer *serviceaccountmodels.ClusterIssuer) error {
+	db := mongodb.GetMongoDb()
+	_, err := db.Collection(CollectionName).InsertOne(ctx, issuer)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrExists
+	}
+	if err != nil {
+		return fmt.Errorf("could not store cluster issuer: %w", err)
+	}
+	return nil
+}
+
+// Update replaces the issuer of the cluster, or returns ErrNotFound.
+func Update(ctx context.Context, issuer *serviceaccountmodels.ClusterIssuer) error {
+	db := mongodb.GetMongoDb()
+	update := bson.M{"$set": bson.M{
+		"issuer":    issuer.Issuer,
+		"jwksuri":   issuer.JwksUri,
+		"jwks":      issuer.Jwks,
+		"subjects":  issuer.Subjects,
+		"updatedat": issuer.UpdatedAt,
+	}}
+	result, err := db.Collection(CollectionName).UpdateByID(ctx, issuer.ClusterId, update)
+	if err != nil {
+		return fmt.Errorf("could not update cluster issuer: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// GetAll returns the issuers of all clusters.
+func GetAll(ctx context.Context) ([]serviceaccountmodels.ClusterIssuer, error) {
+	db := mongodb.GetMongoDb()
+	cursor, err := db.Collection(CollectionName).Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		return nil, fmt.Errorf("could not get cluster issuers: %w", err)
+	}
+	issuers := make([]serviceaccountmodels.ClusterIssuer, 0)
+	if err := cursor.All(ctx, &issuers); err != nil {
+		return nil, fmt.Errorf("could not decode cluster issuers: %w", err)
+	}
+	return issuers, nil
+}
+
+// GetByClusterId returns the issuer of the cluster, or ErrNotFound.
+func GetByClusterId(ctx context.Context, clusterId string) (serviceaccountmodels.ClusterIssuer, error) {
+	db := mongodb.GetMongoDb()
+	var issuer serviceaccountmodels.ClusterIssuer
+	err := db.Collection(CollectionName).FindOne(ctx, bson.M{"_id": clusterId}).Decode(&issuer)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return issuer, ErrNotFound
+	}
+	if err != nil {
+		return issuer, fmt.Errorf("could not get cluster issuer: %w", err)
+	}
+	return issuer, nil
+}
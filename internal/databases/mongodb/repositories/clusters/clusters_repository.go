@@ -30,8 +30,16 @@ import (
 
 const (
 	CollectionName = "clusters"
+	// PendingPurgeField marks a cluster that is purged when its grace period
+	// ends. Clusters pending purge are hidden from reads.
+	PendingPurgeField = "pendingpurge"
 )
 
+// notPendingPurge is the stage excluding the clusters pending purge.
+func notPendingPurge() bson.M {
+	return bson.M{"$match": bson.M{PendingPurgeField: bson.M{"$exists": false}}}
+}
+
 func GetByClusterId(ctx context.Context, clusterId string) (*apicontracts.Cluster, error) {
 	db := mongodb.GetMongoDb()
 	accessLists := aclrepo.GetACL2ByIdentityQuery(ctx, aclmodels.AclV2QueryAccessScope{Scope: aclmodels.Acl2ScopeCluster})
@@ -39,6 +47,7 @@ func GetByClusterId(ctx context.Context, clusterId string) (*apicontracts.Cluste
 
 	query := []bson.M{
 		accessQuery,
+		notPendingPurge(),
 		{
 			"$match": bson.M{
 				"clusterid": clusterId,
@@ -147,7 +156,7 @@ func GetByFilter(ctx context.Context, filter *apicontracts.Filter) (*apicontract
 	var query []bson.M
 	var totalCountQuery []bson.M
 
-	query = append(query, accessQuery)
+	query = append(query, accessQuery, notPendingPurge())
 	query = append(query, []bson.M{
 		{
 			"$lookup": bson.M{
@@ -206,6 +215,7 @@ func GetByFilter(ctx context.Context, filter *apicontracts.Filter) (*apicontract
 
 	totalCountQuery = []bson.M{
 		accessQuery,
+		notPendingPurge(),
 	}
 
 	totalCountQuery = append(totalCountQuery, bson.M{"$project": bson.M{"_id": 1}})
@@ -281,7 +291,7 @@ func GetMetadata(ctx context.Context) (map[string][]string, error) {
 	accessQuery := mongoHelper.CreateClusterACLFilter(accessLists)
 
 	var aggregationPipeline []bson.M
-	aggregationPipeline = append(aggregationPipeline, accessQuery)
+	aggregationPipeline = append(aggregationPipeline, accessQuery, notPendingPurge())
 	aggregationPipeline = append(aggregationPipeline, bson.M{
 		"$group": bson.M{
 			"_id": nil,
@@ -364,6 +374,7 @@ func GetByWorkspaceId(ctx context.Context,
 	accessQuery := mongoHelper.CreateClusterACLFilter(accessLists)
 	queryCount = []bson.M{
 		accessQuery,
+		notPendingPurge(),
 		{"$project": bson.M{"_id": 1}},
 		{
 			"$lookup": bson.M{
@@ -387,6 +398,7 @@ func GetByWorkspaceId(ctx context.Context,
 	}
 	query = []bson.M{
 		accessQuery,
+		notPendingPurge(),
 		{
 			"$lookup": bson.M{
 				"from":         "workspaces",
@@ -512,6 +524,7 @@ func GetClusterIdByProjectId(ctx context.Context, projectId string) ([]*apicontr
 	query = append(query, bson.M{
 		"$match": bson.M{
 			"metadata.projectid": projectObjectId,
+			PendingPurgeField:    bson.M{"$exists": false},
 		},
 	})
 
@@ -662,7 +675,7 @@ func GetControlPlaneMetadata(ctx context.Context) ([]apicontracts.ClusterControl
 	db := mongodb.GetMongoDb()
 
 	var query []bson.M
-	query = []bson.M{}
+	query = []bson.M{notPendingPurge()}
 
 	bsonSort := bson.M{"clusterid": 1}
 	query = append(query, bson.M{"$sort": bsonSort})
@@ -802,3 +815,116 @@ func GetControlPlaneMetadata(ctx context.Context) ([]apicontracts.ClusterControl
 
 	return metadata, nil
 }
+
+// ClusterUsage is the number of clusters and the sum of the vCPU and memory
+// bytes of their nodes.
+type ClusterUsage struct {
+	Count  int64 `bson:"count"`
+	Cpu    int64 `bson:"cpu"`
+	Memory int64 `bson:"memory"`
+}
+
+// GetUsage returns the usage of the clusters where the field, either
+// metadata.projectid or workspaceid, is the id.
+func GetUsage(ctx context.Context, field string, id string) (ClusterUsage, error) {
+	var usage ClusterUsage
+	objectId, err := bson.ObjectIDFromHex(id)
+	if err != nil {
+		return usage, fmt.Errorf("could not convert id: %w", err)
+	}
+
+	query := []bson.M{
+		{"$match": bson.M{field: objectId, PendingPurgeField: bson.M{"$exists": false}}},
+		{"$group": bson.M{
+			"_id":    nil,
+			"count":  bson.M{"$sum": 1},
+			"cpu":    bson.M{"$sum": "$metrics.cpu"},
+			"memory": bson.M{"$sum": "$metrics.memory"},
+		}},
+	}
+
+	db := mongodb.GetMongoDb()
+	results, err := db.Collection(CollectionName).Aggregate(ctx, query)
+	if err != nil {
+		return usage, fmt.Errorf("could not get cluster usage: %w", err)
+	}
+	defer func(cursor *mongo.Cursor, databaseCtx context.Context) {
+		_ = cursor.Close(databaseCtx)
+	}(results, ctx)
+
+	if results.Next(ctx) {
+		if err := results.Decode(&usage); err != nil {
+			return usage, fmt.Errorf("could not decode cluster usage: %w", err)
+		}
+	}
+	return usage, results.Err()
+}
+
+// BillingCluster is a cluster with the workspace, datacenter and project it is
+// billed by.
+type BillingCluster struct {
+	Uid         string `bson:"uid"`
+	ClusterId   string `bson:"clusterid"`
+	ClusterName string `bson:"clustername"`
+	Workspace   string `bson:"workspace"`
+	Datacenter  string `bson:"datacenter"`
+	Provider    string `bson:"provider"`
+	ProjectId   string `bson:"projectid"`
+	ProjectName string `bson:"projectname"`
+	CostCentre  string `bson:"costcentre"`
+}
+
+// GetBillingClusters returns the clusters the identity can read with their
+// billing details. The cost centre is the workorder of the project, or of
+// the cluster if the project has none.
+func GetBillingClusters(ctx context.Context) ([]BillingCluster, error) {
+	accessLists := aclrepo.GetACL2ByIdentityQuery(ctx, aclmodels.AclV2QueryAccessScope{Scope: aclmodels.Acl2ScopeCluster})
+	query := []bson.M{
+		mongoHelper.CreateClusterACLFilter(accessLists),
+		{"$lookup": bson.M{
+			"from":         "workspaces",
+			"localField":   "workspaceid",
+			"foreignField": "_id",
+			"as":           "workspaces",
+		}},
+		{"$set": bson.M{"workspace": bson.M{"$first": "$workspaces"}}},
+		{"$lookup": bson.M{
+			"from":         "datacenters",
+			"localField":   "workspace.datacenterid",
+			"foreignField": "_id",
+			"as":           "datacenters",
+		}},
+		{"$lookup": bson.M{
+			"from":         "projects",
+			"localField":   "metadata.projectid",
+			"foreignField": "_id",
+			"as":           "projects",
+		}},
+		{"$project": bson.M{
+			"_id":         0,
+			"uid":         1,
+			"clusterid":   1,
+			"clustername": 1,
+			"workspace":   "$workspace.name",
+			"datacenter":  bson.M{"$first": "$datacenters.name"},
+			"provider":    bson.M{"$first": "$datacenters.provider"},
+			"projectid":   bson.M{"$toString": "$metadata.projectid"},
+			"projectname": bson.M{"$first": "$projects.name"},
+			"costcentre": bson.M{"$ifNull": bson.A{
+				bson.M{"$first": "$projects.projectmetadata.billing.workorder"},
+				"$metadata.billing.workorder",
+			}},
+		}},
+	}
+
+	db := mongodb.GetMongoDb()
+	results, err := db.Collection(CollectionName).Aggregate(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("could not get billing clusters: %w", err)
+	}
+	clusters := make([]BillingCluster, 0)
+	if err := results.All(ctx, &clusters); err != nil {
+		return nil, fmt.Errorf("could not decode billing clusters: %w", err)
+	}
+	return clusters, nil
+}
@@ -14,6 +14,7 @@ import (
 
 	"go.mongodb.org/mongo-driver/v2/bson"
 	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
 )
 
 const (
@@ -166,3 +167,66 @@ func GetMetricsByFilter(filter apicontracts.MetricsFilter, ctx context.Context,
 
 	return metricsresult, nil
 }
+
+// DailyAllocation is the capacity allocated to the nodes of a cluster during
+// a day, integrated over the hours the cluster reported metrics.
+type DailyAllocation struct {
+	ClusterId       string    `bson:"clusterid"`
+	Day             time.Time `bson:"day"`
+	Hours           int64     `bson:"hours"`
+	CpuCoreHours    float64   `bson:"cpucorehours"`
+	MemoryByteHours float64   `bson:"memorybytehours"`
+}
+
+// GetDailyAllocation returns the allocation per cluster and day from the
+// node metrics between from and to. The samples of a node are averaged per
+// hour, and the nodes of a cluster summed per hour, so an hour without
+// samples is not counted.
+func GetDailyAllocation(ctx context.Context, from time.Time, to time.Time) ([]DailyAllocation, error) {
+	query := []bson.M{
+		{"$match": bson.M{"metadata.type": "node", "timestamp": bson.M{"$gte": from, "$lt": to}}},
+		{"$group": bson.M{
+			"_id": bson.M{
+				"cluster": "$metadata.clusterId",
+				"node":    "$metadata.name",
+				"hour":    bson.M{"$dateTrunc": bson.M{"date": "$timestamp", "unit": "hour"}},
+			},
+			"cpu":    bson.M{"$avg": "$cpuallocated"},
+			"memory": bson.M{"$avg": "$memoryallocated"},
+		}},
+		{"$group": bson.M{
+			"_id":    bson.M{"cluster": "$_id.cluster", "hour": "$_id.hour"},
+			"cpu":    bson.M{"$sum": "$cpu"},
+			"memory": bson.M{"$sum": "$memory"},
+		}},
+		{"$group": bson.M{
+			"_id": bson.M{
+				"cluster": "$_id.cluster",
+				"day":     bson.M{"$dateTrunc": bson.M{"date": "$_id.hour", "unit": "day"}},
+			},
+			"hours":           bson.M{"$sum": 1},
+			"cpucorehours":    bson.M{"$sum": "$cpu"},
+			"memorybytehours": bson.M{"$sum": "$memory"},
+		}},
+		{"$project": bson.M{
+			"_id":             0,
+			"clusterid":       "$_id.cluster",
+			"day":             "$_id.day",
+			"hours":           1,
+			"cpucorehours":    1,
+			"memorybytehours": 1,
+		}},
+		{"$sort": bson.M{"clusterid": 1, "day": 1}},
+	}
+
+	db := mongodb.GetMongoDb()
+	results, err := db.Collection(MetricsCollectionName).Aggregate(ctx, query, options.Aggregate().SetAllowDiskUse(true))
+	if err != nil {
+		return nil, fmt.Errorf("could not get allocation from metrics: %w", err)
+	}
+	allocations := make([]DailyAllocation, 0)
+	if err := results.All(ctx, &allocations); err != nil {
+		return nil, fmt.Errorf("could not decode allocation from metrics: %w", err)
+	}
+	return allocations, nil
+}
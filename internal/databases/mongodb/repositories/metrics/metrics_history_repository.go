@@ -0,0 +1,277 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/NorskHelsenett/ror-api/internal/models/metricsmodels"
+
+	aclrepo "github.com/NorskHelsenett/ror-api/internal/acl/repositories"
+
+	"github.com/NorskHelsenett/ror/pkg/clients/mongodb"
+	aclmodels "github.com/NorskHelsenett/ror/pkg/models/aclmodels"
+	"github.com/NorskHelsenett/ror/pkg/rlog"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// The cluster samples are kept in time-series collections, as reported, per
+// hour and per day, each with its own retention.
+const (
+	MinuteCollectionName       = "clustermetrics"
+	HourlyCollectionName       = "clustermetricshourly"
+	DailyCollectionName        = "clustermetricsdaily"
+	downsamplingCollectionName = "clustermetricsdownsampling"
+
+	// downsamplingLease is how long a replica holds its claim on the
+	// downsampling of a cluster before another replica may take it over.
+	downsamplingLease = 10 * time.Minute
+)
+
+// HistoryFilter selects the samples of the cluster, workspace or datacenter
+// where the field is the value.
+type HistoryFilter struct {
+	Field string
+	Value string
+}
+
+var (
+	HistoryFilterClusterId    = func(id string) HistoryFilter { return HistoryFilter{Field: "metadata.clusterid", Value: id} }
+	HistoryFilterWorkspaceId  = func(id string) HistoryFilter { return HistoryFilter{Field: "metadata.workspaceid", Value: id} }
+	HistoryFilterDatacenterId = func(id string) HistoryFilter { return HistoryFilter{Field: "metadata.datacenterid", Value: id} }
+)
+
+// downsampling is a level samples are averaged into from the level below.
+type downsampling struct {
+	source string
+	target string
+	unit   string
+}
+
+var downsamplings = []downsampling{
+	{source: MinuteCollectionName, target: HourlyCollectionName, unit: "hour"},
+	{source: HourlyCollectionName, target: DailyCollectionName, unit: "day"},
+}
+
+// HistoryCollection returns the collection with the resolution for the step,
+// daily samples for steps of a day or longer and hourly samples for steps of
+// an hour or longer.
+func HistoryCollection(step time.Duration) string {
+	switch {
+	case step >= 24*time.Hour:
+		return DailyCollectionName
+	case step >= time.Hour:
+		return HourlyCollectionName
+	}
+	return MinuteCollectionName
+}
+
+// GetSampleMetadata returns the uid, workspace and datacenter of the cluster
+// with the cluster id. Unknown clusters only have their cluster id.
+func GetSampleMetadata(ctx context.Context, clusterId string) (metricsmodels.SampleMetadata, error) {
+	metadata := metricsmodels.SampleMetadata{ClusterId: clusterId}
+	query := []bson.M{
+		{"$match": bson.M{"$or": bson.A{bson.M{"clusterid": clusterId}, bson.M{"uid": clusterId}}}},
+		{"$lookup": bson.M{
+			"from":         "workspaces",
+			"localField":   "workspaceid",
+			"foreignField": "_id",
+			"as":           "workspaces",
+		}},
+		{"$project": bson.M{
+			"_id":          0,
+			"clusterid":    1,
+			"clusteruid":   "$uid",
+			"workspaceid":  bson.M{"$toString": "$workspaceid"},
+			"datacenterid": bson.M{"$toString": bson.M{"$first": "$workspaces.datacenterid"}},
+		}},
+		{"$limit": 1},
+	}
+
+	db := mongodb.GetMongoDb()
+	results, err := db.Collection(CollectionName).Aggregate(ctx, query)
+	if err != nil {
+		return metadata, fmt.Errorf("could not get cluster of metrics: %w", err)
+	}
+	defer func(cursor *mongo.Cursor, databaseCtx context.Context) {
+		_ = cursor.Close(databaseCtx)
+	}(results, ctx)
+	if results.Next(ctx) {
+		if err := results.Decode(&metadata); err != nil {
+			return metadata, fmt.Errorf("could not decode cluster of metrics: %w", err)
+		}
+	}
+	return metadata, results.Err()
+}
+
+func WriteSample(ctx context.Context, sample metricsmodels.ClusterSample) error {
+	db := mongodb.GetMongoDb()
+	if _, err := db.Collection(MinuteCollectionName).InsertOne(ctx, sample); err != nil {
+		return fmt.Errorf("could not insert cluster metrics sample: %w", err)
+	}
+	return nil
+}
+
+// Downsample averages the samples of the cluster into hourly samples for the
+// hours completed before now, and the hourly samples into daily samples for
+// the days completed before now. The downsampling of a cluster is claimed
+// with a lease, so it is done by one replica at a time, and the watermark of
+// the cluster is only advanced once the samples are stored, so a failed
+// downsampling is retried.
+func Downsample(ctx context.Context, metadata metricsmodels.SampleMetadata, now time.Time) error {
+	db := mongodb.GetMongoDb()
+	for _, level := range downsamplings {
+		until := now.UTC().Truncate(time.Hour)
+		if level.unit == "day" {
+			until = time.Date(until.Year(), until.Month(), until.Day(), 0, 0, 0, 0, time.UTC)
+		}
+
+		id := level.target + "/" + metadata.ClusterId
+		var watermark struct {
+			Until time.Time `bson:"until"`
+		}
+		err := db.Collection(downsamplingCollectionName).FindOneAndUpdate(ctx,
+			bson.M{
+				"_id":   id,
+				"until": bson.M{"$not": bson.M{"$gte": until}},
+				"$or": bson.A{
+					bson.M{"claimeduntil": bson.M{"$exists": false}},
+					bson.M{"claimeduntil": bson.M{"$lt": now}},
+				},
+			},
+			bson.M{"$set": bson.M{"claimeduntil": now.Add(downsamplingLease)}},
+			options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.Before),
+		).Decode(&watermark)
+		switch {
+		case mongo.IsDuplicateKeyError(err):
+			// Downsampled up to until already, or claimed by another replica.
+			continue
+		case errors.Is(err, mongo.ErrNoDocuments):
+			// First downsampling of the cluster, everything before until.
+		case err != nil:
+			return fmt.Errorf("could not claim %s downsampling: %w", level.target, err)
+		}
+
+		if err := downsampleLevel(ctx, level, metadata, watermark.Until, until); err != nil {
+			// The claim is released so the next run retries from the
+			// watermark.
+			_, releaseErr := db.Collection(downsamplingCollectionName).UpdateOne(ctx,
+				bson.M{"_id": id},
+				bson.M{"$unset": bson.M{"claimeduntil": ""}},
+			)
+			return errors.Join(err, releaseErr)
+		}
+
+		_, err = db.Collection(downsamplingCollectionName).UpdateOne(ctx,
+			bson.M{"_id": id},
+			bson.M{"$set": bson.M{"until": until}, "$unset": bson.M{"claimeduntil": ""}},
+		)
+		if err != nil {
+			return fmt.Errorf("could not advance %s downsampling: %w", level.target, err)
+		}
+	}
+	return nil
+}
+
+// downsampleLevel averages the samples of the cluster from the source of the
+// level between from and until into the target of the level.
+func downsampleLevel(ctx context.Context, level downsampling, metadata metricsmodels.SampleMetadata, from time.Time, until time.Time) error {
+	db := mongodb.GetMongoDb()
+	query := []bson.M{
+		{"$match": bson.M{
+			"metadata.clusterid": metadata.ClusterId,
+			"timestamp":          bson.M{"$gte": from, "$lt": until},
+		}},
+		{"$group": bson.M{
+			"_id":                  bson.M{"$dateTrunc": bson.M{"date": "$timestamp", "unit": level.unit}},
+			"metadata":             bson.M{"$last": "$metadata"},
+			"nodes":                bson.M{"$avg": "$nodes"},
+			"cpuallocatedcores":    bson.M{"$avg": "$cpuallocatedcores"},
+			"cpuusagecores":        bson.M{"$avg": "$cpuusagecores"},
+			"memoryallocatedbytes": bson.M{"$avg": "$memoryallocatedbytes"},
+			"memoryusagebytes":     bson.M{"$avg": "$memoryusagebytes"},
+		}},
+		{"$set": bson.M{"timestamp": "$_id"}},
+		{"$unset": "_id"},
+	}
+	results, err := db.Collection(level.source).Aggregate(ctx, query)
+	if err != nil {
+		return fmt.Errorf("could not downsample into %s: %w", level.target, err)
+	}
+	samples := make([]metricsmodels.ClusterSample, 0)
+	if err := results.All(ctx, &samples); err != nil {
+		return fmt.Errorf("could not decode %s samples: %w", level.target, err)
+	}
+	if len(samples) == 0 {
+		return nil
+	}
+	if _, err := db.Collection(level.target).InsertMany(ctx, samples); err != nil {
+		return fmt.Errorf("could not insert %s samples: %w", level.target, err)
+	}
+	rlog.Debugc(ctx, "downsampled cluster metrics", rlog.String("collection", level.target), rlog.String("clusterId", metadata.ClusterId), rlog.Int("samples", len(samples)))
+	return nil
+}
+
+// GetHistory returns the samples of the clusters the identity can read
+// matching the filter between from and to, in steps. The samples of a
+// cluster are averaged per step and the clusters summed.
+func GetHistory(ctx context.Context, filter HistoryFilter, from time.Time, to time.Time, step time.Duration) ([]metricsmodels.HistoryPoint, error) {
+	match := bson.M{
+		filter.Field: filter.Value,
+		"timestamp":  bson.M{"$gte": from, "$lt": to},
+	}
+	accessLists := aclrepo.GetACL2ByIdentityQuery(ctx, aclmodels.AclV2QueryAccessScope{Scope: aclmodels.Acl2ScopeCluster})
+	if !accessLists.Global.Read {
+		// Acl subjects are cluster uids, or cluster ids on older acls.
+		clusters := bson.A{}
+		for _, item := range accessLists.Items {
+			if item.Scope.ToKind() == aclmodels.Acl2ScopeCluster && item.Access.Read {
+				clusters = append(clusters, item.Subject)
+			}
+		}
+		match["$or"] = bson.A{
+			bson.M{"metadata.clusteruid": bson.M{"$in": clusters}},
+			bson.M{"metadata.clusterid": bson.M{"$in": clusters}},
+		}
+	}
+
+	bin := bson.M{"$dateTrunc": bson.M{"date": "$timestamp", "unit": "minute", "binSize": int64(step / time.Minute)}}
+	query := []bson.M{
+		{"$match": match},
+		{"$group": bson.M{
+			"_id":                  bson.M{"cluster": "$metadata.clusterid", "timestamp": bin},
+			"nodes":                bson.M{"$avg": "$nodes"},
+			"cpuallocatedcores":    bson.M{"$avg": "$cpuallocatedcores"},
+			"cpuusagecores":        bson.M{"$avg": "$cpuusagecores"},
+			"memoryallocatedbytes": bson.M{"$avg": "$memoryallocatedbytes"},
+			"memoryusagebytes":     bson.M{"$avg": "$memoryusagebytes"},
+		}},
+		{"$group": bson.M{
+			"_id":                  "$_id.timestamp",
+			"clusters":             bson.M{"$sum": 1},
+			"nodes":                bson.M{"$sum": "$nodes"},
+			"cpuallocatedcores":    bson.M{"$sum": "$cpuallocatedcores"},
+			"cpuusagecores":        bson.M{"$sum": "$cpuusagecores"},
+			"memoryallocatedbytes": bson.M{"$sum": "$memoryallocatedbytes"},
+			"memoryusagebytes":     bson.M{"$sum": "$memoryusagebytes"},
+		}},
+		{"$set": bson.M{"timestamp": "$_id"}},
+		{"$unset": "_id"},
+		{"$sort": bson.M{"timestamp": 1}},
+	}
+
+	db := mongodb.GetMongoDb()
+	results, err := db.Collection(HistoryCollection(step)).Aggregate(ctx, query, options.Aggregate().SetAllowDiskUse(true))
+	if err != nil {
+		return nil, fmt.Errorf("could not get metrics history: %w", err)
+	}
+	points := make([]metricsmodels.HistoryPoint, 0)
+	if err := results.All(ctx, &points); err != nil {
+		return nil, fmt.Errorf("could not decode metrics history: %w", err)
+	}
+	return points, nil
+}
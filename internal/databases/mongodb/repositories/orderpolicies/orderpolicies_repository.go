@@ -0,0 +1,131 @@
+package orderpolicies
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/NorskHelsenett/ror-api/internal/models/orderpolicymodels"
+
+	"github.com/NorskHelsenett/ror/pkg/clients/mongodb"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+const (
+	QuotaCollectionName        = "orderquotas"
+	ApprovalRuleCollectionName = "orderapprovalrules"
+)
+
+// GetQuotas returns all quotas.
+func GetQuotas(ctx context.Context) ([]orderpolicymodels.Quota, error) {
+	db := mongodb.GetMongoDb()
+	cursor, err := db.Collection(QuotaCollectionName).Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "scope", Value: 1}, {Key: "subjectid", Value: 1}}))
+	if err != nil {
+		return nil, fmt.Errorf("could not get quotas: %w", err)
+	}
+	quotas := make([]orderpolicymodels.Quota, 0)
+	if err := cursor.All(ctx, &quotas); err != nil {
+		return nil, fmt.Errorf("could not decode quotas: %w", err)
+	}
+	return quotas, nil
+}
+
+// GetQuota returns the quota of the subject in the scope, or nil if the
+// subject has no quota.
+func GetQuota(ctx context.Context, scope orderpolicymodels.QuotaScope, subjectId string) (*orderpolicymodels.Quota, error) {
+	db := mongodb.GetMongoDb()
+	var quota orderpolicymodels.Quota
+	err := db.Collection(QuotaCollectionName).FindOne(ctx, bson.M{"scope": scope, "subjectid": subjectId}).Decode(&quota)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not get quota: %w", err)
+	}
+	return &quota, nil
+}
+
+// UpsertQuota creates or replaces the quota of the subject in the scope and
+// returns the quota it replaced, if any.
+func UpsertQuota(ctx context.Context, quota orderpolicymodels.Quota) (*orderpolicymodels.Quota, error) {
+	db := mongodb.GetMongoDb()
+	var original orderpolicymodels.Quota
+	err := db.Collection(QuotaCollectionName).FindOneAndReplace(ctx,
+		bson.M{"scope": quota.Scope, "subjectid": quota.SubjectId},
+		quota,
+		options.FindOneAndReplace().SetUpsert(true),
+	).Decode(&original)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not save quota: %w", err)
+	}
+	return &original, nil
+}
+
+// DeleteQuota deletes the quota of the subject in the scope and returns it,
+// or nil if the subject had no quota.
+func DeleteQuota(ctx context.Context, scope orderpolicymodels.QuotaScope, subjectId string) (*orderpolicymodels.Quota, error) {
+	db := mongodb.GetMongoDb()
+	var original orderpolicymodels.Quota
+	err := db.Collection(QuotaCollectionName).FindOneAndDelete(ctx, bson.M{"scope": scope, "subjectid": subjectId}).Decode(&original)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not delete quota: %w", err)
+	}
+	return &original, nil
+}
+
+// GetApprovalRules returns all approval rules ordered by name.
+func GetApprovalRules(ctx context.Context) ([]orderpolicymodels.ApprovalRule, error) {
+	db := mongodb.GetMongoDb()
+	cursor, err := db.Collection(ApprovalRuleCollectionName).Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		return nil, fmt.Errorf("could not get approval rules: %w", err)
+	}
+	rules := make([]orderpolicymodels.ApprovalRule, 0)
+	if err := cursor.All(ctx, &rules); err != nil {
+		return nil, fmt.Errorf("could not decode approval rules: %w", err)
+	}
+	return rules, nil
+}
+
+// UpsertApprovalRule creates or replaces the approval rule with the name and
+// returns the rule it replaced, if any.
+func UpsertApprovalRule(ctx context.Context, rule orderpolicymodels.ApprovalRule) (*orderpolicymodels.ApprovalRule, error) {
+	db := mongodb.GetMongoDb()
+	var original orderpolicymodels.ApprovalRule
+	err := db.Collection(ApprovalRuleCollectionName).FindOneAndReplace(ctx,
+		bson.M{"_id": rule.Name},
+		rule,
+		options.FindOneAndReplace().SetUpsert(true),
+	).Decode(&original)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not save approval rule: %w", err)
+	}
+	return &original, nil
+}
+
+// DeleteApprovalRule deletes the approval rule with the name and returns it,
+// or nil if there was no such rule.
+func DeleteApprovalRule(ctx context.Context, name string) (*orderpolicymodels.ApprovalRule, error) {
+	db := mongodb.GetMongoDb()
+	var original orderpolicymodels.ApprovalRule
+	err := db.Collection(ApprovalRuleCollectionName).FindOneAndDelete(ctx, bson.M{"_id": name}).Decode(&original)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not delete approval rule: %w", err)
+	}
+	return &original, nil
+}
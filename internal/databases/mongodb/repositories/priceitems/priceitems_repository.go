@@ -0,0 +1,101 @@
+package priceitems
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/NorskHelsenett/ror-api/internal/databases/mongodb/mongoTypes"
+	pricesRepo "github.com/NorskHelsenett/ror-api/internal/databases/mongodb/repositories/prices"
+	"github.com/NorskHelsenett/ror-api/internal/models/pricemodels"
+
+	"github.com/NorskHelsenett/ror/pkg/clients/mongodb"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+const (
+	CollectionName = "priceitems"
+)
+
+// GetAll returns the price items ordered by kind and effective date.
+func GetAll(ctx context.Context) ([]pricemodels.PriceItem, error) {
+	db := mongodb.GetMongoDb()
+	cursor, err := db.Collection(CollectionName).Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "kind", Value: 1}, {Key: "effectivefrom", Value: 1}}))
+	if err != nil {
+		return nil, fmt.Errorf("could not get price items: %w", err)
+	}
+	items := make([]pricemodels.PriceItem, 0)
+	if err := cursor.All(ctx, &items); err != nil {
+		return nil, fmt.Errorf("could not decode price items: %w", err)
+	}
+	return items, nil
+}
+
+// GetMachineClassPrices returns the machine class prices managed through the
+// prices endpoints.
+func GetMachineClassPrices(ctx context.Context) ([]mongoTypes.MongoPrice, error) {
+	db := mongodb.GetMongoDb()
+	cursor, err := db.Collection(pricesRepo.CollectionName).Find(ctx, bson.M{})
+	if err != nil {
+		return nil, fmt.Errorf("could not get prices: %w", err)
+	}
+	prices := make([]mongoTypes.MongoPrice, 0)
+	if err := cursor.All(ctx, &prices); err != nil {
+		return nil, fmt.Errorf("could not decode prices: %w", err)
+	}
+	return prices, nil
+}
+
+// Create inserts the price item with a new id.
+func Create(ctx context.Context, item pricemodels.PriceItem) (*pricemodels.PriceItem, error) {
+	db := mongodb.GetMongoDb()
+	item.Id = bson.NewObjectID()
+	if _, err := db.Collection(CollectionName).InsertOne(ctx, item); err != nil {
+		return nil, fmt.Errorf("could not create price item: %w", err)
+	}
+	return &item, nil
+}
+
+// Update replaces the price item and returns the item it replaced, or nil if
+// there is no item with the id.
+func Update(ctx context.Context, id string, item pricemodels.PriceItem) (*pricemodels.PriceItem, error) {
+	objectId, err := bson.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, fmt.Errorf("could not convert price item id: %w", err)
+	}
+	item.Id = objectId
+
+	db := mongodb.GetMongoDb()
+	var original pricemodels.PriceItem
+	err = db.Collection(CollectionName).FindOneAndReplace(ctx, bson.M{"_id": objectId}, item).Decode(&original)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not update price item: %w", err)
+	}
+	return &original, nil
+}
+
+// Delete deletes the price item and returns it, or nil if there is no item
+// with the id.
+func Delete(ctx context.Context, id string) (*pricemodels.PriceItem, error) {
+	objectId, err := bson.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, fmt.Errorf("could not convert price item id: %w", err)
+	}
+
+	db := mongodb.GetMongoDb()
+	var original pricemodels.PriceItem
+	err = db.Collection(CollectionName).FindOneAndDelete(ctx, bson.M{"_id": objectId}).Decode(&original)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not delete price item: %w", err)
+	}
+	return &original, nil
+}
@@ -5,6 +5,8 @@ import (
 	"context"
 	"fmt"
 
+	"github.com/NorskHelsenett/ror-api/internal/models/switchboardmodels"
+
 	"github.com/NorskHelsenett/ror/pkg/apicontracts/messages"
 
 	"go.mongodb.org/mongo-driver/v2/bson"
@@ -161,7 +163,7 @@ func PullResource(ctx context.Context, set *messages.RulesetModel, resourceId st
 	return nil
 }
 
-func AddResourceRule(ctx context.Context, set *messages.RulesetModel, resource *messages.RulesetResourceModel, rule *messages.RulesetRuleModel) error {
+func AddResourceRule(ctx context.Context, set *messages.RulesetModel, resource *messages.RulesetResourceModel, rule *switchboardmodels.Rule) error {
 	db := mongodb.GetMongoDb()
 	coll := db.Collection("messagerulesets")
 
@@ -223,3 +225,48 @@ func PullResourceRule(ctx context.Context, set *messages.RulesetModel, resource
 
 	return nil
 }
+
+// FindAllRules returns the rulesets with the webhook and email targets of
+// their rules.
+func FindAllRules(ctx context.Context) ([]switchboardmodels.Ruleset, error) {
+	db := mongodb.GetMongoDb()
+	coll := db.Collection("messagerulesets")
+
+	cursor, err := coll.Find(ctx, bson.D{})
+	if err != nil {
+		return nil, err
+	}
+
+	rulesets := make([]switchboardmodels.Ruleset, 0)
+	if err := cursor.All(ctx, &rulesets); err != nil {
+		return nil, err
+	}
+
+	return rulesets, nil
+}
+
+// ClaimResourceRule removes a rule from a resource of the ruleset, it returns
+// false if the rule was already removed.
+func ClaimResourceRule(ctx context.Context, setId bson.ObjectID, resourceId string, ruleId string) (bool, error) {
+	db := mongodb.GetMongoDb()
+	coll := db.Collection("messagerulesets")
+
+	update := bson.M{
+		"$pull": bson.M{
+			"resources.$[resource].rules": bson.M{
+				"id": ruleId,
+			},
+		},
+	}
+
+	opts := options.UpdateOne().SetArrayFilters([]any{
+		bson.M{"resource.id": resourceId},
+	})
+
+	result, err := coll.UpdateOne(ctx, bson.D{{Key: "_id", Value: setId}}, update, opts)
+	if err != nil {
+		return false, err
+	}
+
+	return result.ModifiedCount == 1, nil
+}
@@ -0,0 +1,98 @@
+package switchboarddeliveries
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/NorskHelsenett/ror-api/internal/models/switchboardmodels"
+
+	"github.com/NorskHelsenett/ror/pkg/clients/mongodb"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+const (
+	CollectionName = "switchboarddeliveries"
+)
+
+// Create stores a pending delivery.
+func Create(ctx context.Context, delivery *switchboardmodels.Delivery) error {
+	db := mongodb.GetMongoDb()
+	if _, err := db.Collection(CollectionName).InsertOne(ctx, delivery); err != nil {
+		return fmt.Errorf("could not store delivery: %w", err)
+	}
+	return nil
+}
+
+// Claim takes the oldest pending delivery due for an attempt, or one whose
+// claim has expired, until the lease has passed.
+func Claim(ctx context.Context, now time.Time, lease time.Duration) (switchboardmodels.Delivery, error) {
+	db := mongodb.GetMongoDb()
+	var delivery switchboardmodels.Delivery
+	err := db.Collection(CollectionName).FindOneAndUpdate(ctx,
+		bson.M{
+			"status":        switchboardmodels.DeliveryStatusPending,
+			"nextattemptat": bson.M{"$lte": now},
+			"claimeduntil":  bson.M{"$lte": now},
+		},
+		bson.M{"$set": bson.M{"claimeduntil": now.Add(lease)}},
+		options.FindOneAndUpdate().SetSort(bson.D{{Key: "createdat", Value: 1}}).SetReturnDocument(options.After),
+	).Decode(&delivery)
+	return delivery, err
+}
+
+// MarkDelivered records the delivery as accepted by its service.
+func MarkDelivered(ctx context.Context, id string, now time.Time) error {
+	db := mongodb.GetMongoDb()
+	_, err := db.Collection(CollectionName).UpdateOne(ctx,
+		bson.M{"_id": id},
+		bson.M{
+			"$set": bson.M{"status": switchboardmodels.DeliveryStatusDelivered, "deliveredat": now},
+			"$inc": bson.M{"attempts": 1},
+		},
+	)
+	return err
+}
+
+// Release records a failed attempt of the delivery. The delivery is due again
+// at the next attempt, or failed if the next attempt is nil.
+func Release(ctx context.Context, id string, cause error, now time.Time, nextAttempt *time.Time) error {
+	set := bson.M{
+		"claimeduntil": now,
+		"lasterror":    cause.Error(),
+	}
+	if nextAttempt == nil {
+		set["status"] = switchboardmodels.DeliveryStatusFailed
+	} else {
+		set["nextattemptat"] = *nextAttempt
+	}
+
+	db := mongodb.GetMongoDb()
+	_, err := db.Collection(CollectionName).UpdateOne(ctx,
+		bson.M{"_id": id},
+		bson.M{"$set": set, "$inc": bson.M{"attempts": 1}},
+	)
+	return err
+}
+
+// GetByRuleset returns the latest deliveries of the ruleset, of the status if
+// it is set.
+func GetByRuleset(ctx context.Context, rulesetId string, status switchboardmodels.DeliveryStatus, limit int64) ([]switchboardmodels.Delivery, error) {
+	filter := bson.M{"rulesetid": rulesetId}
+	if status != "" {
+		filter["status"] = status
+	}
+
+	db := mongodb.GetMongoDb()
+	cursor, err := db.Collection(CollectionName).Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "createdat", Value: -1}}).SetLimit(limit))
+	if err != nil {
+		return nil, fmt.Errorf("could not get deliveries: %w", err)
+	}
+	deliveries := make([]switchboardmodels.Delivery, 0)
+	if err := cursor.All(ctx, &deliveries); err != nil {
+		return nil, fmt.Errorf("could not decode deliveries: %w", err)
+	}
+	return deliveries, nil
+}
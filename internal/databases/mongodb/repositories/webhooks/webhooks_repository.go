@@ -0,0 +1,173 @@
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/NorskHelsenett/ror-api/internal/models/webhookmodels"
+
+	"github.com/NorskHelsenett/ror/pkg/clients/mongodb"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+const (
+	CollectionName         = "webhooks"
+	DeliveryCollectionName = "webhookdeliveries"
+)
+
+var ErrNotFound = errors.New("webhook not found")
+
+// Create stores the webhook.
+func Create(ctx context.Context, webhook *webhookmodels.Webhook) error {
+	db := mongodb.GetMongoDb()
+	if _, err := db.Collection(CollectionName).InsertOne(ctx, webhook); err != nil {
+		return fmt.Errorf("could not store webhook: %w", err)
+	}
+	return nil
+}
+
+// GetAll returns all webhooks.
+func GetAll(ctx context.Context) ([]webhookmodels.Webhook, error) {
+	return find(ctx, bson.M{})
+}
+
+// GetByCreator returns the webhooks registered by the identity.
+func GetByCreator(ctx context.Context, createdBy string) ([]webhookmodels.Webhook, error) {
+	return find(ctx, bson.M{"createdby": createdBy})
+}
+
+func find(ctx context.Context, filter bson.M) ([]webhookmodels.Webhook, error) {
+	db := mongodb.GetMongoDb()
+	cursor, err := db.Collection(CollectionName).Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "createdat", Value: 1}}))
+	if err != nil {
+		return nil, fmt.Errorf("could not get webhooks: %w", err)
+	}
+	webhooks := make([]webhookmodels.Webhook, 0)
+	if err := cursor.All(ctx, &webhooks); err != nil {
+		return nil, fmt.Errorf("could not decode webhooks: %w", err)
+	}
+	return webhooks, nil
+}
+
+// GetById returns the webhook, or ErrNotFound.
+func GetById(ctx context.Context, id string) (webhookmodels.Webhook, error) {
+	db := mongodb.GetMongoDb()
+	var webhook webhookmodels.Webhook
+	err := db.Collection(CollectionName).FindOne(ctx, bson.M{"_id": id}).Decode(&webhook)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return webhook, ErrNotFound
+	}
+	if err != nil {
+		return webhook, fmt.Errorf("could not get webhook: %w", err)
+	}
+	return webhook, nil
+}
+
+// Delete removes the webhook and its pending deliveries.
+func Delete(ctx context.Context, id string) error {
+	db := mongodb.GetMongoDb()
+	result, err := db.Collection(CollectionName).DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return fmt.Errorf("could not delete webhook: %w", err)
+	}
+	if result.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	_, err = db.Collection(DeliveryCollectionName).DeleteMany(ctx, bson.M{"webhookid": id, "status": webhookmodels.DeliveryStatusPending})
+	if err != nil {
+		return fmt.Errorf("could not delete webhook deliveries: %w", err)
+	}
+	return nil
+}
+
+// CreateDelivery stores a pending delivery, a delivery with the id of a
+// stored delivery is ignored.
+func CreateDelivery(ctx context.Context, delivery *webhookmodels.Delivery) error {
+	db := mongodb.GetMongoDb()
+	_, err := db.Collection(DeliveryCollectionName).InsertOne(ctx, delivery)
+	if mongo.IsDuplicateKeyError(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("could not store webhook delivery: %w", err)
+	}
+	return nil
+}
+
+// ClaimDelivery takes the oldest pending delivery due for an attempt, or one
+// whose claim has expired, until the lease has passed.
+func ClaimDelivery(ctx context.Context, now time.Time, lease time.Duration) (webhookmodels.Delivery, error) {
+	db := mongodb.GetMongoDb()
+	var delivery webhookmodels.Delivery
+	err := db.Collection(DeliveryCollectionName).FindOneAndUpdate(ctx,
+		bson.M{
+			"status":        webhookmodels.DeliveryStatusPending,
+			"nextattemptat": bson.M{"$lte": now},
+			"claimeduntil":  bson.M{"$lte": now},
+		},
+		bson.M{"$set": bson.M{"claimeduntil": now.Add(lease)}},
+		options.FindOneAndUpdate().SetSort(bson.D{{Key: "createdat", Value: 1}}).SetReturnDocument(options.After),
+	).Decode(&delivery)
+	return delivery, err
+}
+
+// CompleteDelivery sets the final status of the delivery.
+func CompleteDelivery(ctx context.Context, id string, status webhookmodels.DeliveryStatus, cause error, now time.Time) error {
+	set := bson.M{"status": status, "claimeduntil": now}
+	if status == webhookmodels.DeliveryStatusDelivered {
+		set["deliveredat"] = now
+	}
+	if cause != nil {
+		set["lasterror"] = cause.Error()
+	}
+
+	db := mongodb.GetMongoDb()
+	_, err := db.Collection(DeliveryCollectionName).UpdateOne(ctx,
+		bson.M{"_id": id},
+		bson.M{"$set": set, "$inc": bson.M{"attempts": 1}},
+	)
+	return err
+}
+
+// RetryDelivery records a failed attempt of the delivery, due again at the
+// next attempt.
+func RetryDelivery(ctx context.Context, id string, cause error, now time.Time, nextAttempt time.Time) error {
+	db := mongodb.GetMongoDb()
+	_, err := db.Collection(DeliveryCollectionName).UpdateOne(ctx,
+		bson.M{"_id": id},
+		bson.M{
+			"$set": bson.M{
+				"nextattemptat": nextAttempt,
+				"claimeduntil":  now,
+				"lasterror":     cause.Error(),
+			},
+			"$inc": bson.M{"attempts": 1},
+		},
+	)
+	return err
+}
+
+// GetDeliveries returns the latest deliveries of the webhook, of the status
+// if it is set.
+func GetDeliveries(ctx context.Context, webhookId string, status webhookmodels.DeliveryStatus, limit int64) ([]webhookmodels.Delivery, error) {
+	filter := bson.M{"webhookid": webhookId}
+	if status != "" {
+		filter["status"] = status
+	}
+
+	db := mongodb.GetMongoDb()
+	cursor, err := db.Collection(DeliveryCollectionName).Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "createdat", Value: -1}}).SetLimit(limit))
+	if err != nil {
+		return nil, fmt.Errorf("could not get webhook deliveries: %w", err)
+	}
+	deliveries := make([]webhookmodels.Delivery, 0)
+	if err := cursor.All(ctx, &deliveries); err != nil {
+		return nil, fmt.Errorf("could not decode webhook deliveries: %w", err)
+	}
+	return deliveries, nil
+}
@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/NorskHelsenett/ror-api/internal/databases/mongodb/mongoTypes"
+	"github.com/NorskHelsenett/ror-api/internal/databases/mongodb/repositories/metrics"
 	"github.com/NorskHelsenett/ror/pkg/config/rorconfig"
 	"github.com/NorskHelsenett/ror/pkg/kubernetes/providers/providermodels"
 
@@ -43,6 +44,12 @@ func CheckAndSeed(ctx context.Context) {
 	seedTasks(ctx)
 	seedOperatorConfigs(ctx)
 	ensureResourcesV2Indexes(ctx)
+	ensureResourcesV2WatchIndexes(ctx)
+	ensureResourcesV2HistoryIndexes(ctx)
+	ensureMetricsHistoryCollections(ctx)
+	ensureOutboxIndexes(ctx)
+	ensureSwitchboardDeliveriesIndexes(ctx)
+	ensureWebhookIndexes(ctx)
 }
 
 func ensureResourcesV2Indexes(ctx context.Context) {
@@ -105,6 +112,217 @@ func ensureResourcesV2Indexes(ctx context.Context) {
 	}
 }
 
+// ensureResourcesV2WatchIndexes ensures the resource watch event collection is
+// indexed on its sequence and expires events after the configured retention.
+func ensureResourcesV2WatchIndexes(ctx context.Context) {
+	db := mongodb.GetMongoDb()
+	collection := db.Collection("resourcesv2watch")
+
+	retention, err := time.ParseDuration(rorconfig.GetString("RESOURCEV2_WATCH_RETENTION"))
+	if err != nil || retention <= 0 {
+		rlog.Warn("Could not parse resourcesv2 watch retention, defaulting to 24h")
+		retention = 24 * time.Hour
+	}
+
+	indexes := []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "_watchseq", Value: 1}},
+			Options: options.Index().SetName("_watchseq_1").SetUnique(true),
+		},
+		{
+			Keys:    bson.D{{Key: "_watchtime", Value: 1}},
+			Options: options.Index().SetName("_watchtime_1").SetExpireAfterSeconds(int32(retention.Seconds())),
+		},
+	}
+
+	_, err = collection.Indexes().CreateMany(ctx, indexes)
+	if err != nil {
+		rlog.Info("skipped ensuring resourcesv2watch indexes (insufficient permissions)")
+	}
+}
+
+// ensureResourcesV2HistoryIndexes ensures the resource history collection is
+// indexed for history lookups by uid and expires revisions at their per kind
+// expiry time.
+func ensureResourcesV2HistoryIndexes(ctx context.Context) {
+	db := mongodb.GetMongoDb()
+	collection := db.Collection("resourcesv2history")
+
+	indexes := []mongo.IndexModel{
+		{
+			Keys: bson.D{
+				{Key: "uid", Value: 1},
+				{Key: "_historytime", Value: -1},
+			},
+			Options: options.Index().SetName("uid_1__historytime_-1"),
+		},
+		{
+			Keys:    bson.D{{Key: "_expireat", Value: 1}},
+			Options: options.Index().SetName("_expireat_1").SetExpireAfterSeconds(0),
+		},
+	}
+
+	_, err := collection.Indexes().CreateMany(ctx, indexes)
+	if err != nil {
+		rlog.Info("skipped ensuring resourcesv2history indexes (insufficient permissions)")
+	}
+}
+
+// ensureMetricsHistoryCollections ensures the cluster metrics samples and
+// their hourly and daily downsamples are time-series collections, and that
+// their retention is the configured retention.
+func ensureMetricsHistoryCollections(ctx context.Context) {
+	db := mongodb.GetMongoDb()
+	collections := []struct {
+		name        string
+		granularity string
+		retention   string
+		fallback    time.Duration
+	}{
+		{name: metrics.MinuteCollectionName, granularity: "minutes", retention: "METRICS_RETENTION_MINUTE", fallback: 7 * 24 * time.Hour},
+		{name: metrics.HourlyCollectionName, granularity: "hours", retention: "METRICS_RETENTION_HOURLY", fallback: 90 * 24 * time.Hour},
+		{name: metrics.DailyCollectionName, granularity: "hours", retention: "METRICS_RETENTION_DAILY", fallback: 2 * 365 * 24 * time.Hour},
+	}
+
+	for _, collection := range collections {
+		retention, err := time.ParseDuration(rorconfig.GetString(collection.retention))
+		if err != nil || retention <= 0 {
+			rlog.Warn("Could not parse metrics retention, using the default", rlog.String("config", collection.retention), rlog.String("default", collection.fallback.String()))
+			retention = collection.fallback
+		}
+		expireAfterSeconds := int64(retention.Seconds())
+
+		timeSeries := options.TimeSeries().SetTimeField("timestamp").SetMetaField("metadata").SetGranularity(collection.granularity)
+		err = db.CreateCollection(ctx, collection.name, options.CreateCollection().SetTimeSeriesOptions(timeSeries).SetExpireAfterSeconds(expireAfterSeconds))
+		var commandErr mongo.CommandError
+		if errors.As(err, &commandErr) && commandErr.Name == "NamespaceExists" {
+			err = db.RunCommand(ctx, bson.D{{Key: "collMod", Value: collection.name}, {Key: "expireAfterSeconds", Value: expireAfterSeconds}}).Err()
+		}
+		if err != nil {
+			rlog.Info("skipped ensuring metrics history collection (insufficient permissions)", rlog.String("collection", collection.name))
+		}
+	}
+}
+
+// ensureOutboxIndexes ensures the outbox is indexed for the relay and expires
+// published events after the configured retention.
+func ensureOutboxIndexes(ctx context.Context) {
+	db := mongodb.GetMongoDb()
+	collection := db.Collection("outbox")
+
+	retention, err := time.ParseDuration(rorconfig.GetString("OUTBOX_RETENTION"))
+	if err != nil || retention <= 0 {
+		rlog.Warn("Could not parse outbox retention, defaulting to 24h")
+		retention = 24 * time.Hour
+	}
+
+	indexes := []mongo.IndexModel{
+		{
+			Keys: bson.D{
+				{Key: "publishedat", Value: 1},
+				{Key: "createdat", Value: 1},
+			},
+			Options: options.Index().SetName("publishedat_1_createdat_1"),
+		},
+		{
+			Keys:    bson.D{{Key: "publishedat", Value: 1}},
+			Options: options.Index().SetName("publishedat_1").SetExpireAfterSeconds(int32(retention.Seconds())),
+		},
+	}
+
+	_, err = collection.Indexes().CreateMany(ctx, indexes)
+	if err != nil {
+		rlog.Info("skipped ensuring outbox indexes (insufficient permissions)")
+	}
+}
+
+// ensureSwitchboardDeliveriesIndexes ensures the switchboard deliveries are
+// indexed for the dispatcher and the deliveries endpoint, and expires them
+// after the configured retention.
+func ensureSwitchboardDeliveriesIndexes(ctx context.Context) {
+	db := mongodb.GetMongoDb()
+	collection := db.Collection("switchboarddeliveries")
+
+	retention, err := time.ParseDuration(rorconfig.GetString("SWITCHBOARD_DELIVERY_RETENTION"))
+	if err != nil || retention <= 0 {
+		rlog.Warn("Could not parse switchboard delivery retention, defaulting to 720h")
+		retention = 720 * time.Hour
+	}
+
+	indexes := []mongo.IndexModel{
+		{
+			Keys: bson.D{
+				{Key: "status", Value: 1},
+				{Key: "createdat", Value: 1},
+			},
+			Options: options.Index().SetName("status_1_createdat_1"),
+		},
+		{
+			Keys: bson.D{
+				{Key: "rulesetid", Value: 1},
+				{Key: "createdat", Value: -1},
+			},
+			Options: options.Index().SetName("rulesetid_1_createdat_-1"),
+		},
+		{
+			Keys:    bson.D{{Key: "createdat", Value: 1}},
+			Options: options.Index().SetName("createdat_1").SetExpireAfterSeconds(int32(retention.Seconds())),
+		},
+	}
+
+	_, err = collection.Indexes().CreateMany(ctx, indexes)
+	if err != nil {
+		rlog.Info("skipped ensuring switchboard deliveries indexes (insufficient permissions)")
+	}
+}
+
+// ensureWebhookIndexes ensures the webhooks and their deliveries are indexed
+// for the dispatcher and the webhooks endpoints, and expires the deliveries
+// after the configured retention.
+func ensureWebhookIndexes(ctx context.Context) {
+	db := mongodb.GetMongoDb()
+
+	_, err := db.Collection("webhooks").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "createdby", Value: 1}},
+		Options: options.Index().SetName("createdby_1"),
+	})
+	if err != nil {
+		rlog.Info("skipped ensuring webhooks indexes (insufficient permissions)")
+	}
+
+	retention, err := time.ParseDuration(rorconfig.GetString("WEBHOOK_DELIVERY_RETENTION"))
+	if err != nil || retention <= 0 {
+		rlog.Warn("Could not parse webhook delivery retention, defaulting to 720h")
+		retention = 720 * time.Hour
+	}
+
+	indexes := []mongo.IndexModel{
+		{
+			Keys: bson.D{
+				{Key: "status", Value: 1},
+				{Key: "createdat", Value: 1},
+			},
+			Options: options.Index().SetName("status_1_createdat_1"),
+		},
+		{
+			Keys: bson.D{
+				{Key: "webhookid", Value: 1},
+				{Key: "createdat", Value: -1},
+			},
+			Options: options.Index().SetName("webhookid_1_createdat_-1"),
+		},
+		{
+			Keys:    bson.D{{Key: "createdat", Value: 1}},
+			Options: options.Index().SetName("createdat_1").SetExpireAfterSeconds(int32(retention.Seconds())),
+		},
+	}
+
+	_, err = db.Collection("webhookdeliveries").Indexes().CreateMany(ctx, indexes)
+	if err != nil {
+		rlog.Info("skipped ensuring webhook deliveries indexes (insufficient permissions)")
+	}
+}
+
 // verifySeed will take a seed and a indentifier of the seed and attempt to find the object in the collection with the indentifer,
 // if it fails to get a match with the identifier it will attempt to add the seed.
 //
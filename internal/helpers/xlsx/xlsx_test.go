@@ -0,0 +1,16 @@
+package xlsx
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEscapeFormula(t *testing.T) {
+	for _, value := range []string{"=SUM(A1:A2)", "+1", "-1+1", "@cmd", "\tx", "\rx"} {
+		assert.Equal(t, "'"+value, EscapeFormula(value), value)
+	}
+	for _, value := range []string{"", "cluster-1", "Project = A"} {
+		assert.Equal(t, value, EscapeFormula(value), value)
+	}
+}
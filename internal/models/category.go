@@ -14,4 +14,7 @@ const (
 	AuditCategoryAcl             AuditCategory = "Acl"
 	AuditCategorySwitchboard     AuditCategory = "Ruleset"
 	AuditCategoryKubeconfig      AuditCategory = "Kubeconfig"
+	AuditCategoryClusterOrder    AuditCategory = "ClusterOrder"
+	AuditCategoryOrderPolicy     AuditCategory = "OrderPolicy"
+	AuditCategoryWebhook         AuditCategory = "Webhook"
 )
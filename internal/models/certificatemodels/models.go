@@ -0,0 +1,33 @@
+// Package certificatemodels holds the client certificates the agents
+// authenticate with, signed by the certificate authority of ror-api.
+package certificatemodels
+
+import "time"
+
+// CertificateRequest is a certificate signing request, PEM encoded.
+type CertificateRequest struct {
+	Csr string `json:"csr" validate:"required"`
+}
+
+// Certificate is a signed client certificate, PEM encoded with the
+// certificate of the certificate authority. It should be renewed after
+// RenewAfter, before it expires.
+type Certificate struct {
+	Certificate   string    `json:"certificate"`
+	CaCertificate string    `json:"caCertificate"`
+	SerialNumber  string    `json:"serialNumber"`
+	NotBefore     time.Time `json:"notBefore"`
+	NotAfter      time.Time `json:"notAfter"`
+	RenewAfter    time.Time `json:"renewAfter"`
+}
+
+// ClusterCertificate is the latest certificate issued to the agent of a
+// cluster.
+type ClusterCertificate struct {
+	ClusterId    string    `json:"clusterId" bson:"_id"`
+	Uid          string    `json:"uid" bson:"uid"`
+	SerialNumber string    `json:"serialNumber" bson:"serialnumber"`
+	NotAfter     time.Time `json:"notAfter" bson:"notafter"`
+	IssuedAt     time.Time `json:"issuedAt" bson:"issuedat"`
+	UpdatedAt    time.Time `json:"updatedAt" bson:"updatedat"`
+}
@@ -0,0 +1,46 @@
+// Package metricsmodels holds the history of the metrics reported by the
+// clusters.
+package metricsmodels
+
+import "time"
+
+// SampleMetadata identifies the cluster of a sample and where it is placed,
+// so samples can be summed per workspace and datacenter.
+type SampleMetadata struct {
+	ClusterId    string `json:"clusterId" bson:"clusterid"`
+	ClusterUid   string `json:"clusterUid" bson:"clusteruid"`
+	WorkspaceId  string `json:"workspaceId" bson:"workspaceid"`
+	DatacenterId string `json:"datacenterId" bson:"datacenterid"`
+}
+
+// ClusterSample is the capacity and usage of the nodes of a cluster at a
+// time, or averaged over an hour or a day when downsampled.
+type ClusterSample struct {
+	Timestamp            time.Time      `json:"timestamp" bson:"timestamp"`
+	Metadata             SampleMetadata `json:"metadata" bson:"metadata"`
+	Nodes                float64        `json:"nodes" bson:"nodes"`
+	CpuAllocatedCores    float64        `json:"cpuAllocatedCores" bson:"cpuallocatedcores"`
+	CpuUsageCores        float64        `json:"cpuUsageCores" bson:"cpuusagecores"`
+	MemoryAllocatedBytes float64        `json:"memoryAllocatedBytes" bson:"memoryallocatedbytes"`
+	MemoryUsageBytes     float64        `json:"memoryUsageBytes" bson:"memoryusagebytes"`
+}
+
+// HistoryPoint is the capacity and usage in a step of the history, the
+// averages of the clusters in the step summed.
+type HistoryPoint struct {
+	Timestamp            time.Time `json:"timestamp" bson:"timestamp"`
+	Clusters             int64     `json:"clusters" bson:"clusters"`
+	Nodes                float64   `json:"nodes" bson:"nodes"`
+	CpuAllocatedCores    float64   `json:"cpuAllocatedCores" bson:"cpuallocatedcores"`
+	CpuUsageCores        float64   `json:"cpuUsageCores" bson:"cpuusagecores"`
+	MemoryAllocatedBytes float64   `json:"memoryAllocatedBytes" bson:"memoryallocatedbytes"`
+	MemoryUsageBytes     float64   `json:"memoryUsageBytes" bson:"memoryusagebytes"`
+}
+
+// History is the metrics history of a cluster, workspace or datacenter.
+type History struct {
+	From   time.Time      `json:"from"`
+	To     time.Time      `json:"to"`
+	Step   string         `json:"step"`
+	Points []HistoryPoint `json:"points"`
+}
@@ -0,0 +1,3 @@
+// Package orderpolicymodels holds the quotas and approval rules cluster orders
+// are checked against, and the decisions made for the orders.
+package orderpolicymodels
@@ -0,0 +1,98 @@
+package orderpolicymodels
+
+import (
+	"slices"
+	"time"
+
+	"github.com/NorskHelsenett/ror/pkg/apicontracts/apiresourcecontracts"
+	"github.com/NorskHelsenett/ror/pkg/kubernetes/providers/providermodels"
+)
+
+// QuotaScope is what a quota limits, the clusters of a project or of a
+// workspace.
+type QuotaScope string
+
+const (
+	QuotaScopeProject   QuotaScope = "project"
+	QuotaScopeWorkspace QuotaScope = "workspace"
+)
+
+// Quota limits the clusters of a project or a workspace. A limit of zero is
+// unlimited.
+type Quota struct {
+	Scope        QuotaScope `json:"scope" bson:"scope" validate:"required,oneof=project workspace"`
+	SubjectId    string     `json:"subjectId" bson:"subjectid" validate:"required"`
+	MaxClusters  int64      `json:"maxClusters" bson:"maxclusters" validate:"min=0"`
+	MaxCpu       int64      `json:"maxCpu" bson:"maxcpu" validate:"min=0"`
+	MaxMemoryGiB int64      `json:"maxMemoryGiB" bson:"maxmemorygib" validate:"min=0"`
+	UpdatedBy    string     `json:"updatedBy" bson:"updatedby"`
+	Updated      time.Time  `json:"updated" bson:"updated"`
+}
+
+// Resources are clusters and the vCPU and memory of their nodes.
+type Resources struct {
+	Clusters  int64 `json:"clusters"`
+	Cpu       int64 `json:"cpu"`
+	MemoryGiB int64 `json:"memoryGiB"`
+}
+
+// Add returns the sum of the resources.
+func (r Resources) Add(other Resources) Resources {
+	return Resources{
+		Clusters:  r.Clusters + other.Clusters,
+		Cpu:       r.Cpu + other.Cpu,
+		MemoryGiB: r.MemoryGiB + other.MemoryGiB,
+	}
+}
+
+// QuotaCheck is a quota, the resources used in its scope and whether the
+// order would exceed it.
+type QuotaCheck struct {
+	Quota    Quota     `json:"quota"`
+	Usage    Resources `json:"usage"`
+	Exceeded []string  `json:"exceeded,omitempty"`
+}
+
+// ApprovalRule makes orders matching all its criteria wait for approval. An
+// empty criterion matches every order.
+type ApprovalRule struct {
+	Name           string                                 `json:"name" bson:"_id" validate:"required"`
+	Description    string                                 `json:"description" bson:"description"`
+	Environments   []apiresourcecontracts.EnvironmentType `json:"environments,omitempty" bson:"environments,omitempty"`
+	Providers      []providermodels.ProviderType          `json:"providers,omitempty" bson:"providers,omitempty"`
+	ProjectIds     []string                               `json:"projectIds,omitempty" bson:"projectids,omitempty"`
+	MinCriticality apiresourcecontracts.CriticalityLevel  `json:"minCriticality,omitempty" bson:"mincriticality,omitempty"`
+	MinSensitivity apiresourcecontracts.SensitivityLevel  `json:"minSensitivity,omitempty" bson:"minsensitivity,omitempty"`
+	UpdatedBy      string                                 `json:"updatedBy" bson:"updatedby"`
+	Updated        time.Time                              `json:"updated" bson:"updated"`
+}
+
+// Matches returns true if the order matches all criteria of the rule.
+func (r ApprovalRule) Matches(order apiresourcecontracts.ResourceClusterOrderSpec) bool {
+	if len(r.Environments) > 0 && !slices.Contains(r.Environments, apiresourcecontracts.EnvironmentType(order.Environment)) {
+		return false
+	}
+	if len(r.Providers) > 0 && !slices.Contains(r.Providers, providermodels.ProviderType(order.Provider)) {
+		return false
+	}
+	if len(r.ProjectIds) > 0 && !slices.Contains(r.ProjectIds, order.ProjectId) {
+		return false
+	}
+	if r.MinCriticality > 0 && apiresourcecontracts.CriticalityLevel(order.Criticality) < r.MinCriticality {
+		return false
+	}
+	if r.MinSensitivity > 0 && apiresourcecontracts.SensitivityLevel(order.Sensitivity) < r.MinSensitivity {
+		return false
+	}
+	return true
+}
+
+// OrderDecision is the result of checking an order against the quotas and
+// approval rules. Orders with reasons must be approved before they are
+// provisioned.
+type OrderDecision struct {
+	RequiresApproval bool         `json:"requiresApproval"`
+	Reasons          []string     `json:"reasons"`
+	Requested        Resources    `json:"requested"`
+	Quotas           []QuotaCheck `json:"quotas"`
+}
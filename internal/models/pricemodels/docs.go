@@ -0,0 +1,3 @@
+// Package pricemodels holds the price catalogue and the costs calculated from
+// it.
+package pricemodels
@@ -0,0 +1,130 @@
+package pricemodels
+
+import (
+	"time"
+
+	"github.com/NorskHelsenett/ror/pkg/kubernetes/providers/providermodels"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// PriceItemKind is what a price item prices. All prices are monthly.
+type PriceItemKind string
+
+const (
+	// PriceItemKindMachineClass prices a node of a machine class. Its cpu
+	// and memory size the machine class for the cpu and memory rates when
+	// it has no price.
+	PriceItemKindMachineClass PriceItemKind = "machineclass"
+	// PriceItemKindCpu prices a vCPU.
+	PriceItemKindCpu PriceItemKind = "cpu"
+	// PriceItemKindMemory prices a GiB of memory.
+	PriceItemKindMemory PriceItemKind = "memory"
+	// PriceItemKindStorage prices a GiB of storage, of a storage class or of
+	// any class.
+	PriceItemKindStorage PriceItemKind = "storage"
+)
+
+// PriceItem is a monthly price in the price catalogue. Items without a
+// provider or datacenter apply to all, the most specific item effective at a
+// time is used.
+type PriceItem struct {
+	Id            bson.ObjectID               `json:"id" bson:"_id,omitempty"`
+	Kind          PriceItemKind               `json:"kind" bson:"kind" validate:"required,oneof=machineclass cpu memory storage"`
+	Provider      providermodels.ProviderType `json:"provider,omitempty" bson:"provider,omitempty"`
+	Datacenter    string                      `json:"datacenter,omitempty" bson:"datacenter,omitempty"`
+	MachineClass  string                      `json:"machineClass,omitempty" bson:"machineclass,omitempty" validate:"required_if=Kind machineclass"`
+	StorageClass  string                      `json:"storageClass,omitempty" bson:"storageclass,omitempty"`
+	Cpu           int64                       `json:"cpu,omitempty" bson:"cpu,omitempty" validate:"min=0"`
+	MemoryGiB     int64                       `json:"memoryGiB,omitempty" bson:"memorygib,omitempty" validate:"min=0"`
+	Price         float64                     `json:"price" bson:"price" validate:"min=0"`
+	Currency      string                      `json:"currency" bson:"currency"`
+	EffectiveFrom time.Time                   `json:"effectiveFrom" bson:"effectivefrom" validate:"required"`
+	UpdatedBy     string                      `json:"updatedBy,omitempty" bson:"updatedby,omitempty"`
+	Updated       time.Time                   `json:"updated" bson:"updated"`
+}
+
+// BillingPeriod is the period costs are calculated for, from the start up to
+// but not including the end.
+type BillingPeriod struct {
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+}
+
+// CostLine is the cost of a node pool or of the storage of a node pool.
+type CostLine struct {
+	NodePool     string        `json:"nodePool"`
+	Kind         PriceItemKind `json:"kind"`
+	MachineClass string        `json:"machineClass,omitempty"`
+	StorageClass string        `json:"storageClass,omitempty"`
+	Quantity     float64       `json:"quantity"`
+	Cost         float64       `json:"cost"`
+	Unpriced     bool          `json:"unpriced,omitempty"`
+}
+
+// ClusterCost is the cost of a cluster for a billing period.
+type ClusterCost struct {
+	ClusterUid string        `json:"clusterUid"`
+	ClusterId  string        `json:"clusterId"`
+	Workspace  string        `json:"workspace"`
+	Project    string        `json:"project"`
+	Provider   string        `json:"provider"`
+	Datacenter string        `json:"datacenter"`
+	Period     BillingPeriod `json:"period"`
+	Currency   string        `json:"currency"`
+	Total      float64       `json:"total"`
+	Lines      []CostLine    `json:"lines"`
+}
+
+// CostSummary is the cost of the clusters of a workspace or project for a
+// billing period, totalled per currency.
+type CostSummary struct {
+	Scope    string             `json:"scope"`
+	Subject  string             `json:"subject"`
+	Period   BillingPeriod      `json:"period"`
+	Totals   map[string]float64 `json:"totals"`
+	Clusters []ClusterCost      `json:"clusters"`
+}
+
+// ChargebackReport is the cost of the clusters per project, cost centre and
+// workspace for a month, from the capacity allocated to their nodes.
+type ChargebackReport struct {
+	Period   BillingPeriod       `json:"period"`
+	Totals   map[string]float64  `json:"totals"`
+	Projects []ChargebackProject `json:"projects"`
+}
+
+// ChargebackProject is the cost of the clusters of a project. Clusters
+// without a project are in a project without an id.
+type ChargebackProject struct {
+	ProjectId   string                `json:"projectId"`
+	ProjectName string                `json:"projectName"`
+	CostCentre  string                `json:"costCentre"`
+	Totals      map[string]float64    `json:"totals"`
+	Workspaces  []ChargebackWorkspace `json:"workspaces"`
+}
+
+// ChargebackWorkspace is the cost of the clusters of a project in a
+// workspace.
+type ChargebackWorkspace struct {
+	Workspace string             `json:"workspace"`
+	Totals    map[string]float64 `json:"totals"`
+	Clusters  []ChargebackLine   `json:"clusters"`
+}
+
+// ChargebackLine is the cost of a cluster for the hours it reported metrics.
+type ChargebackLine struct {
+	ClusterUid     string  `json:"clusterUid"`
+	ClusterId      string  `json:"clusterId"`
+	ClusterName    string  `json:"clusterName"`
+	Provider       string  `json:"provider"`
+	Datacenter     string  `json:"datacenter"`
+	Hours          float64 `json:"hours"`
+	CpuCoreHours   float64 `json:"cpuCoreHours"`
+	MemoryGiBHours float64 `json:"memoryGiBHours"`
+	CpuCost        float64 `json:"cpuCost"`
+	MemoryCost     float64 `json:"memoryCost"`
+	Cost           float64 `json:"cost"`
+	Currency       string  `json:"currency"`
+	Unpriced       bool    `json:"unpriced,omitempty"`
+}
@@ -0,0 +1,57 @@
+// Package serviceaccountmodels holds the service account token issuers of the
+// clusters, used to authenticate agents with projected service account
+// tokens instead of api keys, and the registration of the agents.
+package serviceaccountmodels
+
+import (
+	"time"
+
+	"github.com/NorskHelsenett/ror-api/internal/models/certificatemodels"
+
+	apikeystypes "github.com/NorskHelsenett/ror/pkg/apicontracts/apikeystypes/v2"
+)
+
+// ServiceAccountIssuer is the issuer of the service account tokens of a
+// cluster. The keys are read from the jwks, from the jwks uri, or from the
+// jwks uri of the openid configuration of the issuer, in that order. Keys are
+// only fetched from the hosts allowed by SERVICEACCOUNT_ISSUER_HOSTS, other
+// clusters register their jwks, read from /openid/v1/jwks of the kubernetes
+// api.
+type ServiceAccountIssuer struct {
+	Issuer  string `json:"issuer" validate:"required"`
+	JwksUri string `json:"jwksUri,omitempty"`
+	Jwks    string `json:"jwks,omitempty"`
+	// Subjects are the service accounts allowed to authenticate, written as
+	// system:serviceaccount:<namespace>:<name>. At least one is required,
+	// other service accounts of the cluster are rejected.
+	Subjects []string `json:"subjects" validate:"required,min=1"`
+}
+
+// ClusterIssuer is the service account token issuer registered for a
+// cluster.
+type ClusterIssuer struct {
+	ClusterId    string    `json:"clusterId" bson:"_id"`
+	Uid          string    `json:"uid" bson:"uid"`
+	Issuer       string    `json:"issuer" bson:"issuer"`
+	JwksUri      string    `json:"jwksUri,omitempty" bson:"jwksuri,omitempty"`
+	Jwks         string    `json:"jwks,omitempty" bson:"jwks,omitempty"`
+	Subjects     []string  `json:"subjects,omitempty" bson:"subjects,omitempty"`
+	RegisteredAt time.Time `json:"registeredAt" bson:"registeredat"`
+	UpdatedAt    time.Time `json:"updatedAt" bson:"updatedat"`
+}
+
+// RegisterAgentRequest registers a cluster agent, with the issuer of its
+// service account tokens to authenticate with them, or a certificate signing
+// request for a client certificate to authenticate with over mutual tls.
+type RegisterAgentRequest struct {
+	apikeystypes.RegisterClusterRequest
+	ServiceAccountIssuer *ServiceAccountIssuer `json:"serviceAccountIssuer,omitempty"`
+	Csr                  string                `json:"csr,omitempty"`
+}
+
+// RegisterAgentResponse is the registered cluster agent, with its client
+// certificate if the request had a certificate signing request.
+type RegisterAgentResponse struct {
+	apikeystypes.RegisterClusterResponse
+	Certificate *certificatemodels.Certificate `json:"certificate,omitempty"`
+}
@@ -0,0 +1,125 @@
+// Package switchboardmodels holds the notification rules of the rulesets and
+// the deliveries of the notifications they trigger.
+package switchboardmodels
+
+import (
+	"time"
+
+	"github.com/NorskHelsenett/ror/pkg/apicontracts/messages"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+const (
+	// ServiceTypeWebhook posts the notification as JSON to the webhook url
+	// of the rule.
+	ServiceTypeWebhook messages.RulesetServiceType = "webhook"
+	// ServiceTypeEmail mails the notification to the recipients of the rule.
+	ServiceTypeEmail messages.RulesetServiceType = "email"
+)
+
+// WebhookTarget is where a webhook rule posts its notifications.
+type WebhookTarget struct {
+	Url string `json:"url" bson:"url"`
+}
+
+// EmailTarget is who an email rule mails its notifications to.
+type EmailTarget struct {
+	To []string `json:"to" bson:"to"`
+}
+
+// RuleInput is a rule to add to a resource of a ruleset, with the targets
+// of the webhook and email services.
+type RuleInput struct {
+	messages.RulesetRuleInput
+	Webhook *WebhookTarget `json:"webhook,omitempty"`
+	Email   *EmailTarget   `json:"email,omitempty"`
+}
+
+// Rule is a rule of a resource of a ruleset. It is stored in the ruleset as
+// a messages.RulesetRuleModel with the targets of the webhook and email
+// services added.
+type Rule struct {
+	messages.RulesetRuleModel `bson:",inline"`
+	Webhook                   *WebhookTarget `json:"webhook,omitempty" bson:"webhook,omitempty"`
+	Email                     *EmailTarget   `json:"email,omitempty" bson:"email,omitempty"`
+}
+
+// ResourceRef is the resource of a ruleset a rule applies to. A uid of *
+// applies to all resources of the api version and kind, in the namespace if
+// it is set.
+type ResourceRef struct {
+	ApiVersion string `bson:"apiversion"`
+	Kind       string `bson:"kind"`
+	Name       string `bson:"name"`
+	Namespace  string `bson:"namespace"`
+	Uid        string `bson:"uid"`
+}
+
+// Resource is a resource of a ruleset with its rules.
+type Resource struct {
+	Id    string      `bson:"id"`
+	Ref   ResourceRef `bson:"ref"`
+	Rules []Rule      `bson:"rules"`
+}
+
+// Ruleset is a ruleset as read by the switchboard.
+type Ruleset struct {
+	Id        bson.ObjectID                 `bson:"_id"`
+	Identity  messages.RulesetIdentityModel `bson:"identity"`
+	Resources []Resource                    `bson:"resources"`
+}
+
+// Event is a change the switchboard notifies about.
+type Event struct {
+	Type       messages.RulesetRuleType `json:"type" bson:"type"`
+	Owner      string                   `json:"owner,omitempty" bson:"owner,omitempty"`
+	Uid        string                   `json:"uid" bson:"uid"`
+	ApiVersion string                   `json:"apiVersion" bson:"apiversion"`
+	Kind       string                   `json:"kind" bson:"kind"`
+	Name       string                   `json:"name,omitempty" bson:"name,omitempty"`
+	Namespace  string                   `json:"namespace,omitempty" bson:"namespace,omitempty"`
+	Attributes map[string]string        `json:"attributes,omitempty" bson:"attributes,omitempty"`
+	Time       time.Time                `json:"time" bson:"time"`
+}
+
+// DeliveryStatus is how far a delivery has come.
+type DeliveryStatus string
+
+const (
+	// DeliveryStatusPending is a delivery waiting for its next attempt.
+	DeliveryStatusPending DeliveryStatus = "pending"
+	// DeliveryStatusDelivered is a delivery accepted by its service.
+	DeliveryStatusDelivered DeliveryStatus = "delivered"
+	// DeliveryStatusFailed is a delivery given up on.
+	DeliveryStatusFailed DeliveryStatus = "failed"
+)
+
+// Valid reports whether the status is a known delivery status.
+func (s DeliveryStatus) Valid() bool {
+	switch s {
+	case DeliveryStatusPending, DeliveryStatusDelivered, DeliveryStatusFailed:
+		return true
+	default:
+		return false
+	}
+}
+
+// Delivery is a notification of an event by a rule, retried until it is
+// delivered or has used its attempts.
+type Delivery struct {
+	Id            string                      `json:"id" bson:"_id"`
+	RulesetId     string                      `json:"rulesetId" bson:"rulesetid"`
+	ResourceId    string                      `json:"resourceId" bson:"resourceid"`
+	RuleId        string                      `json:"ruleId" bson:"ruleid"`
+	Service       messages.RulesetServiceType `json:"service" bson:"service"`
+	Rule          Rule                        `json:"rule" bson:"rule"`
+	Event         Event                       `json:"event" bson:"event"`
+	Status        DeliveryStatus              `json:"status" bson:"status"`
+	Attempts      int                         `json:"attempts" bson:"attempts"`
+	LastError     string                      `json:"lastError,omitempty" bson:"lasterror,omitempty"`
+	CreatedAt     time.Time                   `json:"createdAt" bson:"createdat"`
+	NextAttemptAt time.Time                   `json:"nextAttemptAt" bson:"nextattemptat"`
+	ClaimedUntil  time.Time                   `json:"-" bson:"claimeduntil"`
+	DeliveredAt   *time.Time                  `json:"deliveredAt,omitempty" bson:"deliveredat,omitempty"`
+}
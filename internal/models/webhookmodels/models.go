@@ -0,0 +1,94 @@
+// Package webhookmodels holds the webhook subscriptions to ror events and the
+// deliveries of the events to them.
+package webhookmodels
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/NorskHelsenett/ror/pkg/models/aclmodels/rorresourceowner"
+	identitymodels "github.com/NorskHelsenett/ror/pkg/models/identity"
+)
+
+// WebhookInput is a webhook to register. Events are posted to the url when
+// their type is one of the event types and their owner one of the owners, an
+// empty list matches all. An event type ending in .* matches the event types
+// with its prefix, e.g. resource.*.
+type WebhookInput struct {
+	Url        string                                       `json:"url" validate:"required"`
+	EventTypes []string                                     `json:"eventTypes,omitempty"`
+	Owners     []rorresourceowner.RorResourceOwnerReference `json:"owners,omitempty"`
+}
+
+// Webhook is a registered webhook. The identity registering it is stored to
+// check its access to the events when they are delivered.
+type Webhook struct {
+	Id         string                                       `json:"id" bson:"_id"`
+	Url        string                                       `json:"url" bson:"url"`
+	EventTypes []string                                     `json:"eventTypes" bson:"eventtypes"`
+	Owners     []rorresourceowner.RorResourceOwnerReference `json:"owners" bson:"owners"`
+	Secret     string                                       `json:"-" bson:"secret"`
+	Identity   identitymodels.Identity                      `json:"-" bson:"identity"`
+	CreatedBy  string                                       `json:"createdBy" bson:"createdby"`
+	CreatedAt  time.Time                                    `json:"createdAt" bson:"createdat"`
+}
+
+// WebhookCreated is a registered webhook with its signing secret, which is
+// only returned when it is registered.
+type WebhookCreated struct {
+	Webhook
+	Secret string `json:"secret"`
+}
+
+// Event is the payload posted to a webhook.
+type Event struct {
+	// Id is the id of the delivery, the same for every attempt.
+	Id      string                                      `json:"id" bson:"id"`
+	EventId int64                                       `json:"eventId,omitempty" bson:"eventid,omitempty"`
+	Type    string                                      `json:"type" bson:"type"`
+	Owner   *rorresourceowner.RorResourceOwnerReference `json:"owner,omitempty" bson:"owner,omitempty"`
+	Data    json.RawMessage                             `json:"data" bson:"data"`
+	Time    time.Time                                   `json:"time" bson:"time"`
+}
+
+// DeliveryStatus is how far a delivery has come.
+type DeliveryStatus string
+
+const (
+	// DeliveryStatusPending is a delivery waiting for its next attempt.
+	DeliveryStatusPending DeliveryStatus = "pending"
+	// DeliveryStatusDelivered is a delivery accepted by the webhook.
+	DeliveryStatusDelivered DeliveryStatus = "delivered"
+	// DeliveryStatusDenied is a delivery of an event the identity of the
+	// webhook no longer has access to.
+	DeliveryStatusDenied DeliveryStatus = "denied"
+	// DeliveryStatusDeadLetter is a delivery given up on after its attempts.
+	DeliveryStatusDeadLetter DeliveryStatus = "deadletter"
+)
+
+// Valid reports whether the status is a known delivery status.
+func (s DeliveryStatus) Valid() bool {
+	switch s {
+	case DeliveryStatusPending, DeliveryStatusDelivered, DeliveryStatusDenied, DeliveryStatusDeadLetter:
+		return true
+	default:
+		return false
+	}
+}
+
+// Delivery is an event to post to a webhook, retried until it is delivered
+// or dead-lettered. The identity of the webhook must have read access to the
+// owners of the event for it to be delivered.
+type Delivery struct {
+	Id            string                                       `json:"id" bson:"_id"`
+	WebhookId     string                                       `json:"webhookId" bson:"webhookid"`
+	Event         Event                                        `json:"event" bson:"event"`
+	Owners        []rorresourceowner.RorResourceOwnerReference `json:"-" bson:"owners"`
+	Status        DeliveryStatus                               `json:"status" bson:"status"`
+	Attempts      int                                          `json:"attempts" bson:"attempts"`
+	LastError     string                                       `json:"lastError,omitempty" bson:"lasterror,omitempty"`
+	CreatedAt     time.Time                                    `json:"createdAt" bson:"createdat"`
+	NextAttemptAt time.Time                                    `json:"nextAttemptAt" bson:"nextattemptat"`
+	ClaimedUntil  time.Time                                    `json:"-" bson:"claimeduntil"`
+	DeliveredAt   *time.Time                                   `json:"deliveredAt,omitempty" bson:"deliveredat,omitempty"`
+}
@@ -0,0 +1,229 @@
+// Package mtlsauth authenticates clusters and services with the client
+// certificate of the tls connection. The identity is read from a ror uri in
+// the subject alternative names of the certificate, ror://cluster/<id>/<uid>
+// or ror://service/<id>, or else from the subject, with the common name as id
+// and the organizational unit cluster or service as the type. Clusters
+// authenticate with the certificate ror-api issued to them last, services
+// with a certificate issued by ror-api or, if they are listed in
+// TLS_CLIENT_SERVICES, by the authorities of TLS_CLIENT_CA_FILE.
+package mtlsauth
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/NorskHelsenett/ror-api/internal/databases/mongodb/repositories/clustercertificates"
+	"github.com/NorskHelsenett/ror-api/internal/models/certificatemodels"
+
+	"github.com/NorskHelsenett/ror-api/pkg/helpers/rorginerror"
+
+	"github.com/NorskHelsenett/ror/pkg/config/rorconfig"
+	identitymodels "github.com/NorskHelsenett/ror/pkg/models/identity"
+	"github.com/NorskHelsenett/ror/pkg/telemetry/rortracer"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	IdentityProviderCertificate identitymodels.IdentityProvider = "CERTIFICATE"
+
+	// RenewHeader is set on the responses to requests authenticated with a
+	// certificate that should be renewed.
+	RenewHeader = "X-Ror-Certificate-Renew"
+
+	UriScheme   = "ror"
+	KindCluster = "cluster"
+	KindService = "service"
+)
+
+var (
+	ErrNoIdentity        = errors.New("the certificate has no ror identity")
+	ErrNotIssuedByRor    = errors.New("the certificate of the cluster is not issued by ror-api")
+	ErrRevoked           = errors.New("the certificate is not the active certificate of the cluster")
+	ErrServiceNotAllowed = errors.New("the service is not allowed to authenticate with the certificate")
+)
+
+type CertificateAuthProvider struct {
+	// authority is the certificate authority of ror-api, nil if it is not
+	// configured.
+	authority *x509.Certificate
+	services  []string
+	active    func(ctx context.Context, clusterId string) (certificatemodels.ClusterCertificate, error)
+}
+
+// NewCertificateAuthProvider returns the provider of the certificates issued
+// by the authority, the certificate authority of ror-api. It should be
+// registered after the providers of the authorization headers, which take
+// precedence over the client certificate.
+func NewCertificateAuthProvider(authority *x509.Certificate) *CertificateAuthProvider {
+	services := make([]string, 0)
+	for _, service := range strings.Split(rorconfig.GetString("TLS_CLIENT_SERVICES"), ",") {
+		if service = strings.TrimSpace(service); service != "" {
+			services = append(services, service)
+		}
+	}
+	return &CertificateAuthProvider{
+		authority: authority,
+		services:  services,
+		active:    clustercertificates.GetByClusterId,
+	}
+}
+
+// IsOfType reports whether the request has a verified client certificate.
+func (p *CertificateAuthProvider) IsOfType(c *gin.Context) bool {
+	return c.Request.TLS != nil && len(c.Request.TLS.VerifiedChains) > 0
+}
+
+func (p *CertificateAuthProvider) Authenticate(c *gin.Context, ctx context.Context) {
+	ctx, span := rortracer.StartSpan(ctx, "mtlsauth.CertificateAuthProvider.Authenticate")
+	defer span.End()
+
+	if !p.IsOfType(c) {
+		rerr := rorginerror.NewRorGinSpanError(span, http.StatusUnauthorized, "client certificate not provided")
+		rerr.GinLogErrorAbort(c)
+		return
+	}
+	certificate := c.Request.TLS.VerifiedChains[0][0]
+
+	identity, err := IdentityFromCertificate(certificate)
+	if err != nil {
+		rerr := rorginerror.NewRorGinSpanError(span, http.StatusUnauthorized, "invalid client certificate", err)
+		rerr.GinLogErrorAbort(c)
+		return
+	}
+
+	if err := p.authorize(ctx, c.Request.TLS.VerifiedChains, identity); err != nil {
+		status := http.StatusUnauthorized
+		if !errors.Is(err, ErrNotIssuedByRor) && !errors.Is(err, ErrRevoked) && !errors.Is(err, ErrServiceNotAllowed) {
+			status = http.StatusInternalServerError
+		}
+		rerr := rorginerror.NewRorGinSpanError(span, status, "client certificate not accepted", err)
+		rerr.GinLogErrorAbort(c)
+		return
+	}
+
+	if time.Now().After(RenewAfter(certificate.NotBefore, certificate.NotAfter)) {
+		c.Header(RenewHeader, "true")
+	}
+	c.Set("clusterId", identity.GetId())
+	c.Set("identity", identity)
+	rortracer.SpanOk(span)
+}
+
+// authorize checks that the certificate, the leaf of the verified chains, may
+// authenticate as the identity. A cluster must use the certificate issued to
+// it last, so the certificates it renewed are revoked.
+func (p *CertificateAuthProvider) authorize(ctx context.Context, chains [][]*x509.Certificate, identity identitymodels.Identity) error {
+	certificate := chains[0][0]
+	switch identity.Type {
+	case identitymodels.IdentityTypeCluster:
+		if !p.issuedByRor(chains) {
+			return ErrNotIssuedByRor
+		}
+		active, err := p.active(ctx, identity.ClusterIdentity.Id)
+		if errors.Is(err, clustercertificates.ErrNotFound) {
+			return ErrRevoked
+		}
+		if err != nil {
+			return err
+		}
+		if active.SerialNumber != certificate.SerialNumber.Text(16) || (active.Uid != "" && active.Uid != identity.ClusterIdentity.Uid) {
+			return ErrRevoked
+		}
+	case identitymodels.IdentityTypeService:
+		if !p.issuedByRor(chains) && !slices.Contains(p.services, identity.ServiceIdentity.Id) {
+			return ErrServiceNotAllowed
+		}
+	}
+	return nil
+}
+
+// issuedByRor reports whether the certificate is issued by the certificate
+// authority of ror-api, and not by an authority of TLS_CLIENT_CA_FILE.
+func (p *CertificateAuthProvider) issuedByRor(chains [][]*x509.Certificate) bool {
+	if p.authority == nil {
+		return false
+	}
+	for _, chain := range chains {
+		if len(chain) > 1 && chain[1].Equal(p.authority) {
+			return true
+		}
+	}
+	return false
+}
+
+// IdentityFromCertificate returns the cluster or service identity of the
+// certificate.
+func IdentityFromCertificate(certificate *x509.Certificate) (identitymodels.Identity, error) {
+	kind, id, uid, err := subjectOf(certificate)
+	if err != nil {
+		return identitymodels.Identity{}, err
+	}
+
+	identity := identitymodels.Identity{
+		Auth: identitymodels.AuthInfo{
+			AuthProvider:   IdentityProviderCertificate,
+			AuthProviderID: certificate.SerialNumber.Text(16),
+			ExpirationTime: certificate.NotAfter,
+		},
+	}
+	switch kind {
+	case KindCluster:
+		identity.Type = identitymodels.IdentityTypeCluster
+		identity.ClusterIdentity = &identitymodels.ServiceIdentity{Id: id, Uid: uid}
+	case KindService:
+		identity.Type = identitymodels.IdentityTypeService
+		identity.ServiceIdentity = &identitymodels.ServiceIdentity{Id: id}
+	}
+	return identity, nil
+}
+
+func subjectOf(certificate *x509.Certificate) (kind string, id string, uid string, err error) {
+	for _, uri := range certificate.URIs {
+		if uri.Scheme != UriScheme {
+			continue
+		}
+		segments := strings.Split(strings.Trim(uri.Path, "/"), "/")
+		switch {
+		case uri.Host == KindCluster && len(segments) <= 2 && segments[0] != "":
+			if len(segments) == 2 {
+				uid = segments[1]
+			}
+			return KindCluster, segments[0], uid, nil
+		case uri.Host == KindService && len(segments) == 1 && segments[0] != "":
+			return KindService, segments[0], "", nil
+		}
+		return "", "", "", ErrNoIdentity
+	}
+
+	if id = certificate.Subject.CommonName; id != "" {
+		for _, candidate := range []string{KindCluster, KindService} {
+			if slices.Contains(certificate.Subject.OrganizationalUnit, candidate) {
+				return candidate, id, "", nil
+			}
+		}
+	}
+	return "", "", "", ErrNoIdentity
+}
+
+// ClusterUri returns the ror uri of the cluster, written to the certificates
+// issued to its agent.
+func ClusterUri(clusterId string, uid string) *url.URL {
+	path := "/" + clusterId
+	if uid != "" {
+		path += "/" + uid
+	}
+	return &url.URL{Scheme: UriScheme, Host: KindCluster, Path: path}
+}
+
+// RenewAfter returns when a certificate valid from notBefore to notAfter
+// should be renewed, after two thirds of its lifetime.
+func RenewAfter(notBefore time.Time, notAfter time.Time) time.Time {
+	return notBefore.Add(notAfter.Sub(notBefore) * 2 / 3)
+}
@@ -0,0 +1,93 @@
+package mtlsauth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/NorskHelsenett/ror-api/internal/databases/mongodb/repositories/clustercertificates"
+	"github.com/NorskHelsenett/ror-api/internal/models/certificatemodels"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestCertificate(t *testing.T, serial int64, subject pkix.Name, issuer *x509.Certificate, issuerKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(serial),
+		Subject:               subject,
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  issuer == nil,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+	}
+	if issuer == nil {
+		issuer, issuerKey = template, key
+	}
+	signed, err := x509.CreateCertificate(rand.Reader, template, issuer, &key.PublicKey, issuerKey)
+	require.NoError(t, err)
+	certificate, err := x509.ParseCertificate(signed)
+	require.NoError(t, err)
+	return certificate, key
+}
+
+func TestAuthorize(t *testing.T) {
+	ror, rorKey := newTestCertificate(t, 1, pkix.Name{CommonName: "ror"}, nil, nil)
+	other, otherKey := newTestCertificate(t, 2, pkix.Name{CommonName: "other"}, nil, nil)
+
+	cluster, _ := newTestCertificate(t, 10, pkix.Name{CommonName: "cluster-a", OrganizationalUnit: []string{KindCluster}}, ror, rorKey)
+	otherCluster, _ := newTestCertificate(t, 10, pkix.Name{CommonName: "cluster-a", OrganizationalUnit: []string{KindCluster}}, other, otherKey)
+	listedService, _ := newTestCertificate(t, 11, pkix.Name{CommonName: "listed", OrganizationalUnit: []string{KindService}}, other, otherKey)
+	unlistedService, _ := newTestCertificate(t, 12, pkix.Name{CommonName: "unlisted", OrganizationalUnit: []string{KindService}}, other, otherKey)
+	rorService, _ := newTestCertificate(t, 13, pkix.Name{CommonName: "unlisted", OrganizationalUnit: []string{KindService}}, ror, rorKey)
+
+	activeSerial := "a"
+	provider := &CertificateAuthProvider{
+		authority: ror,
+		services:  []string{"listed"},
+		active: func(_ context.Context, clusterId string) (certificatemodels.ClusterCertificate, error) {
+			if clusterId != "cluster-a" {
+				return certificatemodels.ClusterCertificate{}, clustercertificates.ErrNotFound
+			}
+			return certificatemodels.ClusterCertificate{ClusterId: clusterId, SerialNumber: activeSerial}, nil
+		},
+	}
+
+	tests := []struct {
+		name    string
+		chain   []*x509.Certificate
+		serial  string
+		wantErr error
+	}{
+		{name: "active cluster certificate", chain: []*x509.Certificate{cluster, ror}, serial: "a"},
+		{name: "renewed cluster certificate", chain: []*x509.Certificate{cluster, ror}, serial: "b", wantErr: ErrRevoked},
+		{name: "cluster certificate of another authority", chain: []*x509.Certificate{otherCluster, other}, serial: "a", wantErr: ErrNotIssuedByRor},
+		{name: "listed service", chain: []*x509.Certificate{listedService, other}},
+		{name: "unlisted service", chain: []*x509.Certificate{unlistedService, other}, wantErr: ErrServiceNotAllowed},
+		{name: "service issued by ror", chain: []*x509.Certificate{rorService, ror}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			activeSerial = tt.serial
+			identity, err := IdentityFromCertificate(tt.chain[0])
+			require.NoError(t, err)
+
+			err = provider.authorize(context.Background(), [][]*x509.Certificate{tt.chain}, identity)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
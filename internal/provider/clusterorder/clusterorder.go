@@ -19,6 +19,7 @@ import (
 
 // ClusterOrder is an interface that defines the methods that a clusterprovider must implement
 type ClusterOrder interface {
+	GetUid() string
 	Validate(ctx context.Context) error
 	GetProviderConfig() any
 	Save(ctx context.Context) error
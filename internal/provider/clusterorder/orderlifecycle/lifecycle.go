@@ -0,0 +1,283 @@
+package orderlifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/NorskHelsenett/ror-api/internal/databases/mongodb/repositories/resourcesmongodb"
+
+	"github.com/NorskHelsenett/ror/pkg/apicontracts/apiresourcecontracts"
+	"github.com/NorskHelsenett/ror/pkg/clients/mongodb"
+	aclmodels "github.com/NorskHelsenett/ror/pkg/models/aclmodels"
+	"github.com/NorskHelsenett/ror/pkg/rlog"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+const (
+	// LIFECYCLECOLLECTION holds the lifecycle of each cluster order, keyed by
+	// the uid of the order.
+	LIFECYCLECOLLECTION = "clusterorderlifecycles"
+)
+
+// Start records the lifecycle of a new order that was validated. The order is
+// accepted for provisioning, or waits for approval when an approval is given.
+// If the lifecycle was already created from an event of the order, that
+// lifecycle is returned.
+func Start(ctx context.Context, uid string, by string, approval *Approval) (*Lifecycle, error) {
+	now := time.Now()
+	lifecycle := newLifecycle(uid, now)
+	lifecycle.Transitions[0].By = by
+	if err := lifecycle.apply(StateValidated, ReasonOrderAccepted, "", by, now); err != nil {
+		return nil, err
+	}
+	next, reason, message := StateProvisioning, ReasonOrderAccepted, ""
+	if approval != nil {
+		next, reason, message = StateAwaitingApproval, ReasonApprovalRequired, strings.Join(approval.Reasons, "; ")
+		lifecycle.Approval = approval
+	}
+	if err := lifecycle.apply(next, reason, message, by, now); err != nil {
+		return nil, err
+	}
+
+	_, err := mongodb.GetMongoDb().Collection(LIFECYCLECOLLECTION).InsertOne(ctx, lifecycle)
+	if mongo.IsDuplicateKeyError(err) {
+		return Get(ctx, uid)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not create cluster order lifecycle: %w", err)
+	}
+	return lifecycle, nil
+}
+
+// Get returns the lifecycle of the order. Orders created before lifecycles
+// were recorded get a lifecycle from the phase of the order.
+func Get(ctx context.Context, uid string) (*Lifecycle, error) {
+	collection := mongodb.GetMongoDb().Collection(LIFECYCLECOLLECTION)
+	var lifecycle Lifecycle
+	err := collection.FindOne(ctx, bson.M{"_id": uid}).Decode(&lifecycle)
+	if err == nil {
+		return &lifecycle, nil
+	}
+	if !errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, fmt.Errorf("could not get cluster order lifecycle: %w", err)
+	}
+
+	order, err := GetOrder(ctx, uid)
+	if err != nil {
+		return nil, err
+	}
+	created := lifecycleFromOrder(order, time.Now())
+	_, err = collection.InsertOne(ctx, created)
+	if mongo.IsDuplicateKeyError(err) {
+		return Get(ctx, uid)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not create cluster order lifecycle: %w", err)
+	}
+	return created, nil
+}
+
+// lifecycleFromOrder creates the lifecycle of an order without one, in the
+// state of the phase of the order.
+func lifecycleFromOrder(order apiresourcecontracts.ResourceClusterOrder, now time.Time) *Lifecycle {
+	lifecycle := newLifecycle(order.Metadata.Uid, now)
+	if created, err := time.Parse(time.RFC3339, order.Status.CreatedTime); err == nil {
+		lifecycle.CreatedAt = created
+		lifecycle.Transitions[0].Time = created
+	}
+
+	state := StateFromPhase(string(order.Status.Phase))
+	if state != StatePending {
+		lifecycle.Transitions = append(lifecycle.Transitions, Transition{
+			From:    StatePending,
+			To:      state,
+			Reason:  ReasonObserved,
+			Message: order.Status.Status,
+			Time:    now,
+		})
+		lifecycle.State = state
+		lifecycle.Deadline = deadline(state, now)
+	}
+	return lifecycle
+}
+
+// TransitionTo moves the order to the state and sets the phase of the order to
+// match. It returns ErrInvalidTransition if the order can not move to the
+// state, and ErrConflict if the order changed while it was moved.
+func TransitionTo(ctx context.Context, uid string, to State, reason, message, by string) (*Lifecycle, error) {
+	lifecycle, err := Get(ctx, uid)
+	if err != nil {
+		return nil, err
+	}
+	if err := save(ctx, lifecycle, to, reason, message, by); err != nil {
+		return nil, err
+	}
+	return lifecycle, nil
+}
+
+// AwaitApproval moves a validated order to wait for approval.
+func AwaitApproval(ctx context.Context, uid string, approval Approval, by string) (*Lifecycle, error) {
+	lifecycle, err := Get(ctx, uid)
+	if err != nil {
+		return nil, err
+	}
+	lifecycle.Approval = &approval
+	if err := save(ctx, lifecycle, StateAwaitingApproval, ReasonApprovalRequired, strings.Join(approval.Reasons, "; "), by); err != nil {
+		return nil, err
+	}
+	return lifecycle, nil
+}
+
+// Decide records the decision for an order waiting for approval. An approved
+// order is handed to provisioning, a rejected order is Rejected.
+func Decide(ctx context.Context, uid string, approved bool, reason string, by string) (*Lifecycle, error) {
+	lifecycle, err := Get(ctx, uid)
+	if err != nil {
+		return nil, err
+	}
+	if lifecycle.State != StateAwaitingApproval || lifecycle.Approval == nil {
+		return nil, fmt.Errorf("%w: order is %s, not awaiting approval", ErrInvalidTransition, lifecycle.State)
+	}
+
+	now := time.Now()
+	lifecycle.Approval.Approved = &approved
+	lifecycle.Approval.DecidedBy = by
+	lifecycle.Approval.DecidedAt = &now
+	lifecycle.Approval.Reason = reason
+
+	to, transitionReason := StateProvisioning, ReasonApproved
+	if !approved {
+		to, transitionReason = StateRejected, ReasonRejected
+	}
+	if err := save(ctx, lifecycle, to, transitionReason, reason, by); err != nil {
+		return nil, err
+	}
+	return lifecycle, nil
+}
+
+// ListAwaitingApproval returns the lifecycles of the orders waiting for
+// approval, oldest first.
+func ListAwaitingApproval(ctx context.Context) ([]Lifecycle, error) {
+	collection := mongodb.GetMongoDb().Collection(LIFECYCLECOLLECTION)
+	cursor, err := collection.Find(ctx, bson.M{"state": StateAwaitingApproval}, options.Find().SetSort(bson.D{{Key: "updatedat", Value: 1}}))
+	if err != nil {
+		return nil, fmt.Errorf("could not get cluster orders awaiting approval: %w", err)
+	}
+	lifecycles := make([]Lifecycle, 0)
+	if err := cursor.All(ctx, &lifecycles); err != nil {
+		return nil, fmt.Errorf("could not decode cluster orders awaiting approval: %w", err)
+	}
+	return lifecycles, nil
+}
+
+func save(ctx context.Context, lifecycle *Lifecycle, to State, reason, message, by string) error {
+	now := time.Now()
+	version := lifecycle.Version
+	if err := lifecycle.apply(to, reason, message, by, now); err != nil {
+		return err
+	}
+	lifecycle.Version++
+
+	collection := mongodb.GetMongoDb().Collection(LIFECYCLECOLLECTION)
+	result, err := collection.ReplaceOne(ctx, bson.M{"_id": lifecycle.Uid, "version": version}, lifecycle)
+	if err != nil {
+		return fmt.Errorf("could not save cluster order lifecycle: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return ErrConflict
+	}
+
+	status := message
+	if status == "" {
+		status = reason
+	}
+	_, err = resourcesmongodb.PatchResource(ctx, lifecycle.Uid, bson.M{"$set": bson.M{
+		"resource.status.phase":       Phase(to),
+		"resource.status.status":      status,
+		"resource.status.updatedtime": now.UTC().Format(time.RFC3339),
+	}})
+	if err != nil {
+		return fmt.Errorf("could not update cluster order phase: %w", err)
+	}
+	return nil
+}
+
+// Observe moves the order to the state of the phase reported for it, when
+// the order may move there. Phases that would move the order back are
+// ignored.
+func Observe(ctx context.Context, order apiresourcecontracts.ResourceClusterOrder) error {
+	lifecycle, err := Get(ctx, order.Metadata.Uid)
+	if err != nil {
+		return err
+	}
+	state := StateFromPhase(string(order.Status.Phase))
+	if state == lifecycle.State || !CanTransition(lifecycle.State, state) || state == StatePending {
+		return nil
+	}
+	err = save(ctx, lifecycle, state, ReasonObserved, order.Status.Status, "")
+	if errors.Is(err, ErrConflict) {
+		return nil
+	}
+	return err
+}
+
+// FailTimedOut fails the orders that have not left their state before their
+// deadline. It is run when order events are handled, every replica may run
+// it, an order is only failed once.
+func FailTimedOut(ctx context.Context) error {
+	collection := mongodb.GetMongoDb().Collection(LIFECYCLECOLLECTION)
+	cursor, err := collection.Find(ctx, bson.M{
+		"state":    bson.M{"$in": bson.A{StatePending, StateValidated, StateProvisioning}},
+		"deadline": bson.M{"$lt": time.Now()},
+	})
+	if err != nil {
+		return fmt.Errorf("could not get timed out cluster orders: %w", err)
+	}
+	var lifecycles []Lifecycle
+	if err := cursor.All(ctx, &lifecycles); err != nil {
+		return fmt.Errorf("could not decode timed out cluster orders: %w", err)
+	}
+
+	var errs []error
+	for i := range lifecycles {
+		lifecycle := &lifecycles[i]
+		message := fmt.Sprintf("order did not leave %s before %s", lifecycle.State, lifecycle.Deadline.UTC().Format(time.RFC3339))
+		err := save(ctx, lifecycle, StateFailed, ReasonTimeout, message, "")
+		if errors.Is(err, ErrConflict) {
+			continue
+		}
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		rlog.Infoc(ctx, "cluster order timed out", rlog.String("uid", lifecycle.Uid), rlog.String("message", message))
+	}
+	return errors.Join(errs...)
+}
+
+// GetOrder returns the cluster order resource with the uid.
+func GetOrder(ctx context.Context, uid string) (apiresourcecontracts.ResourceClusterOrder, error) {
+	orders, err := resourcesmongodb.GetResourcesByQuery[apiresourcecontracts.ResourceClusterOrder](ctx, apiresourcecontracts.ResourceQuery{
+		Owner: apiresourcecontracts.ResourceOwnerReference{
+			Scope:   aclmodels.Acl2ScopeRor,
+			Subject: string(aclmodels.Acl2RorSubjectGlobal),
+		},
+		Kind:       "ClusterOrder",
+		ApiVersion: "general.ror.internal/v1alpha1",
+		Internal:   true,
+		Uid:        uid,
+	})
+	if err != nil {
+		return apiresourcecontracts.ResourceClusterOrder{}, fmt.Errorf("could not get cluster order: %w", err)
+	}
+	if len(orders) != 1 {
+		return apiresourcecontracts.ResourceClusterOrder{}, ErrNotFound
+	}
+	return orders[0], nil
+}
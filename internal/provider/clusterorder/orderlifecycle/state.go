@@ -0,0 +1,285 @@
+// Package orderlifecycle models the lifecycle of a cluster order as a state
+// machine. An order moves from Pending through Validated and Provisioning to
+// Ready, or ends as Failed or Cancelled. Orders that exceed a quota or match
+// an approval rule wait in AwaitingApproval until they are approved or
+// Rejected. Failed orders can be retried. Each
+// transition is recorded with a timestamp, and the conditions of the order
+// tell why it is in its state.
+package orderlifecycle
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/NorskHelsenett/ror/pkg/apicontracts/apiresourcecontracts"
+	"github.com/NorskHelsenett/ror/pkg/config/rorconfig"
+)
+
+// State is the state of a cluster order.
+type State string
+
+const (
+	StatePending      State = "Pending"
+	StateValidated    State = "Validated"
+	StateProvisioning State = "Provisioning"
+	StateReady        State = "Ready"
+	StateFailed       State = "Failed"
+	StateCancelled    State = "Cancelled"
+
+	StateAwaitingApproval State = "AwaitingApproval"
+	StateRejected         State = "Rejected"
+)
+
+// Condition types set on the order.
+const (
+	ConditionValidated = "Validated"
+	ConditionReady     = "Ready"
+	ConditionTimedOut  = "TimedOut"
+	ConditionApproved  = "Approved"
+)
+
+// Reasons of the transitions made by the api.
+const (
+	ReasonOrderAccepted    = "OrderAccepted"
+	ReasonValidationFailed = "ValidationFailed"
+	ReasonCancelRequested  = "CancelRequested"
+	ReasonRetryRequested   = "RetryRequested"
+	ReasonTimeout          = "Timeout"
+	ReasonObserved         = "Observed"
+	ReasonApprovalRequired = "ApprovalRequired"
+	ReasonApproved         = "Approved"
+	ReasonRejected         = "Rejected"
+)
+
+const (
+	defaultValidationTimeout   = 15 * time.Minute
+	defaultProvisioningTimeout = 2 * time.Hour
+)
+
+var (
+	ErrInvalidTransition = errors.New("invalid cluster order transition")
+	ErrNotFound          = errors.New("cluster order not found")
+	ErrConflict          = errors.New("cluster order was changed concurrently")
+)
+
+// transitions are the states each state may move to. A failed order may be
+// retried, which moves it back to Pending.
+var transitions = map[State][]State{
+	StatePending:      {StateValidated, StateFailed, StateCancelled},
+	StateValidated:    {StateProvisioning, StateAwaitingApproval, StateFailed, StateCancelled},
+	StateProvisioning: {StateReady, StateFailed, StateCancelled},
+	StateFailed:       {StatePending},
+	StateReady:        {},
+	StateCancelled:    {},
+
+	StateAwaitingApproval: {StateProvisioning, StateRejected, StateCancelled},
+	StateRejected:         {},
+}
+
+// CanTransition returns true if an order in the state may move to the other
+// state.
+func CanTransition(from, to State) bool {
+	return slices.Contains(transitions[from], to)
+}
+
+// IsTerminal returns true if the order stays in the state unless it is
+// retried.
+func IsTerminal(state State) bool {
+	return state == StateReady || state == StateFailed || state == StateCancelled || state == StateRejected
+}
+
+// Condition is an observation of the order, in the form of kubernetes
+// conditions.
+type Condition struct {
+	Type               string    `json:"type" bson:"type"`
+	Status             bool      `json:"status" bson:"status"`
+	Reason             string    `json:"reason,omitempty" bson:"reason,omitempty"`
+	Message            string    `json:"message,omitempty" bson:"message,omitempty"`
+	LastTransitionTime time.Time `json:"lastTransitionTime" bson:"lasttransitiontime"`
+}
+
+// Transition is a recorded change of state.
+type Transition struct {
+	From    State     `json:"from,omitempty" bson:"from,omitempty"`
+	To      State     `json:"to" bson:"to"`
+	Reason  string    `json:"reason" bson:"reason"`
+	Message string    `json:"message,omitempty" bson:"message,omitempty"`
+	By      string    `json:"by,omitempty" bson:"by,omitempty"`
+	Time    time.Time `json:"time" bson:"time"`
+}
+
+// Approval is why an order waits for approval, who may approve it and the
+// decision made for it.
+type Approval struct {
+	ProjectId      string     `json:"projectId" bson:"projectid"`
+	OrderBy        string     `json:"orderBy" bson:"orderby"`
+	Reasons        []string   `json:"reasons" bson:"reasons"`
+	ApproverGroups []string   `json:"approverGroups" bson:"approvergroups"`
+	Approved       *bool      `json:"approved,omitempty" bson:"approved,omitempty"`
+	DecidedBy      string     `json:"decidedBy,omitempty" bson:"decidedby,omitempty"`
+	DecidedAt      *time.Time `json:"decidedAt,omitempty" bson:"decidedat,omitempty"`
+	Reason         string     `json:"reason,omitempty" bson:"reason,omitempty"`
+}
+
+// Lifecycle is the state of a cluster order with its history. Deadline is
+// when the order times out if it has not left its state. Orders that waited
+// for approval have the approval.
+type Lifecycle struct {
+	Uid         string       `json:"uid" bson:"_id"`
+	State       State        `json:"state" bson:"state"`
+	Attempt     int          `json:"attempt" bson:"attempt"`
+	Deadline    *time.Time   `json:"deadline,omitempty" bson:"deadline,omitempty"`
+	Conditions  []Condition  `json:"conditions" bson:"conditions"`
+	Transitions []Transition `json:"transitions" bson:"transitions"`
+	Approval    *Approval    `json:"approval,omitempty" bson:"approval,omitempty"`
+	CreatedAt   time.Time    `json:"createdAt" bson:"createdat"`
+	UpdatedAt   time.Time    `json:"updatedAt" bson:"updatedat"`
+
+	// Version is incremented on every transition, a transition is only
+	// saved if the lifecycle was not changed since it was read.
+	Version int64 `json:"-" bson:"version"`
+}
+
+func newLifecycle(uid string, now time.Time) *Lifecycle {
+	lifecycle := &Lifecycle{
+		Uid:         uid,
+		State:       StatePending,
+		Attempt:     1,
+		Conditions:  []Condition{},
+		Transitions: []Transition{{To: StatePending, Reason: ReasonOrderAccepted, Time: now}},
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	lifecycle.Deadline = deadline(StatePending, now)
+	return lifecycle
+}
+
+// apply moves the lifecycle to the state, records the transition and updates
+// the deadline and the conditions.
+func (l *Lifecycle) apply(to State, reason, message, by string, now time.Time) error {
+	if !CanTransition(l.State, to) {
+		return fmt.Errorf("%w from %s to %s", ErrInvalidTransition, l.State, to)
+	}
+
+	l.Transitions = append(l.Transitions, Transition{
+		From:    l.State,
+		To:      to,
+		Reason:  reason,
+		Message: message,
+		By:      by,
+		Time:    now,
+	})
+
+	switch to {
+	case StatePending:
+		l.Attempt++
+		l.Conditions = []Condition{}
+		l.Approval = nil
+	case StateValidated:
+		l.setCondition(ConditionValidated, true, reason, message, now)
+	case StateAwaitingApproval:
+		l.setCondition(ConditionApproved, false, reason, message, now)
+	case StateProvisioning:
+		if l.State == StateAwaitingApproval {
+			l.setCondition(ConditionApproved, true, reason, message, now)
+		}
+	case StateReady:
+		l.setCondition(ConditionReady, true, reason, message, now)
+	case StateFailed:
+		if l.State == StatePending {
+			l.setCondition(ConditionValidated, false, reason, message, now)
+		}
+		if reason == ReasonTimeout {
+			l.setCondition(ConditionTimedOut, true, reason, message, now)
+		}
+		l.setCondition(ConditionReady, false, reason, message, now)
+	case StateCancelled:
+		l.setCondition(ConditionReady, false, reason, message, now)
+	case StateRejected:
+		l.setCondition(ConditionApproved, false, reason, message, now)
+		l.setCondition(ConditionReady, false, reason, message, now)
+	}
+
+	l.State = to
+	l.Deadline = deadline(to, now)
+	l.UpdatedAt = now
+	return nil
+}
+
+func (l *Lifecycle) setCondition(conditionType string, status bool, reason, message string, now time.Time) {
+	condition := Condition{
+		Type:               conditionType,
+		Status:             status,
+		Reason:             reason,
+		Message:            message,
+		LastTransitionTime: now,
+	}
+	for i := range l.Conditions {
+		if l.Conditions[i].Type == conditionType {
+			if l.Conditions[i].Status == status {
+				condition.LastTransitionTime = l.Conditions[i].LastTransitionTime
+			}
+			l.Conditions[i] = condition
+			return
+		}
+	}
+	l.Conditions = append(l.Conditions, condition)
+}
+
+// TimedOut returns true if the order has not left its state before the
+// deadline.
+func (l *Lifecycle) TimedOut(now time.Time) bool {
+	return !IsTerminal(l.State) && l.Deadline != nil && now.After(*l.Deadline)
+}
+
+// deadline returns when an order entering the state times out. Orders must
+// be validated within CLUSTERORDER_VALIDATION_TIMEOUT and provisioned within
+// CLUSTERORDER_PROVISIONING_TIMEOUT.
+func deadline(state State, now time.Time) *time.Time {
+	var timeout time.Duration
+	switch state {
+	case StatePending, StateValidated:
+		timeout = configDuration("CLUSTERORDER_VALIDATION_TIMEOUT", defaultValidationTimeout)
+	case StateProvisioning:
+		timeout = configDuration("CLUSTERORDER_PROVISIONING_TIMEOUT", defaultProvisioningTimeout)
+	default:
+		return nil
+	}
+	deadline := now.Add(timeout)
+	return &deadline
+}
+
+func configDuration(key string, fallback time.Duration) time.Duration {
+	duration, err := time.ParseDuration(rorconfig.GetString(key))
+	if err != nil || duration <= 0 {
+		return fallback
+	}
+	return duration
+}
+
+// Phase returns the phase set on the cluster order resource for the state.
+func Phase(state State) string {
+	switch state {
+	case StateProvisioning:
+		return string(apiresourcecontracts.ResourceClusterOrderStatusPhaseCreating)
+	case StateReady:
+		return string(apiresourcecontracts.ResourceClusterOrderStatusPhaseCompleted)
+	case StateFailed:
+		return string(apiresourcecontracts.ResourceClusterOrderStatusPhaseFailed)
+	}
+	return string(state)
+}
+
+// StateFromPhase returns the state of an order from the phase of the cluster
+// order resource. Phases set before the lifecycle was introduced, such as
+// Received, are Pending.
+func StateFromPhase(phase string) State {
+	for _, state := range []State{StateValidated, StateProvisioning, StateReady, StateFailed, StateCancelled, StateAwaitingApproval, StateRejected} {
+		if Phase(state) == phase {
+			return state
+		}
+	}
+	return StatePending
+}
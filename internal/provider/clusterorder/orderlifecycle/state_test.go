@@ -0,0 +1,90 @@
+package orderlifecycle
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/NorskHelsenett/ror/pkg/apicontracts/apiresourcecontracts"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransitions(t *testing.T) {
+	assert.True(t, CanTransition(StatePending, StateValidated))
+	assert.True(t, CanTransition(StateProvisioning, StateCancelled))
+	assert.True(t, CanTransition(StateFailed, StatePending))
+	assert.False(t, CanTransition(StatePending, StateReady))
+	assert.False(t, CanTransition(StateReady, StatePending))
+	assert.False(t, CanTransition(StateCancelled, StatePending))
+}
+
+func TestApply(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	lifecycle := newLifecycle("uid", now)
+	require.NotNil(t, lifecycle.Deadline)
+
+	require.NoError(t, lifecycle.apply(StateValidated, ReasonOrderAccepted, "", "user", now))
+	require.NoError(t, lifecycle.apply(StateProvisioning, ReasonOrderAccepted, "", "user", now))
+	assert.Equal(t, now.Add(defaultProvisioningTimeout), *lifecycle.Deadline)
+
+	err := lifecycle.apply(StatePending, ReasonRetryRequested, "", "user", now)
+	assert.ErrorIs(t, err, ErrInvalidTransition)
+	assert.Equal(t, StateProvisioning, lifecycle.State)
+
+	later := now.Add(3 * time.Hour)
+	assert.True(t, lifecycle.TimedOut(later))
+	require.NoError(t, lifecycle.apply(StateFailed, ReasonTimeout, "too slow", "", later))
+	assert.Nil(t, lifecycle.Deadline)
+	assert.False(t, lifecycle.TimedOut(later))
+	assert.Contains(t, lifecycle.Conditions, Condition{Type: ConditionTimedOut, Status: true, Reason: ReasonTimeout, Message: "too slow", LastTransitionTime: later})
+	assert.Contains(t, lifecycle.Conditions, Condition{Type: ConditionReady, Status: false, Reason: ReasonTimeout, Message: "too slow", LastTransitionTime: later})
+
+	require.NoError(t, lifecycle.apply(StatePending, ReasonRetryRequested, "", "admin", later))
+	assert.Equal(t, 2, lifecycle.Attempt)
+	assert.Empty(t, lifecycle.Conditions)
+	assert.Len(t, lifecycle.Transitions, 5)
+	assert.Equal(t, Transition{From: StateFailed, To: StatePending, Reason: ReasonRetryRequested, By: "admin", Time: later}, lifecycle.Transitions[4])
+}
+
+func TestValidationFailure(t *testing.T) {
+	now := time.Now()
+	lifecycle := newLifecycle("uid", now)
+	require.NoError(t, lifecycle.apply(StateFailed, ReasonValidationFailed, "project not found", "", now))
+	assert.Contains(t, lifecycle.Conditions, Condition{Type: ConditionValidated, Status: false, Reason: ReasonValidationFailed, Message: "project not found", LastTransitionTime: now})
+}
+
+func TestStateFromPhase(t *testing.T) {
+	assert.Equal(t, StatePending, StateFromPhase("Received"))
+	assert.Equal(t, StateProvisioning, StateFromPhase(string(apiresourcecontracts.ResourceClusterOrderStatusPhaseCreating)))
+	assert.Equal(t, StateReady, StateFromPhase(string(apiresourcecontracts.ResourceClusterOrderStatusPhaseCompleted)))
+	assert.Equal(t, StateCancelled, StateFromPhase(Phase(StateCancelled)))
+
+	order := apiresourcecontracts.ResourceClusterOrder{}
+	order.Metadata.Uid = "uid"
+	order.Status.Phase = apiresourcecontracts.ResourceClusterOrderStatusPhaseFailed
+	order.Status.Status = "quota exceeded"
+	lifecycle := lifecycleFromOrder(order, time.Now())
+	assert.Equal(t, StateFailed, lifecycle.State)
+	assert.Equal(t, "quota exceeded", lifecycle.Transitions[1].Message)
+}
+
+func TestApproval(t *testing.T) {
+	now := time.Now()
+	lifecycle := newLifecycle("uid", now)
+	require.NoError(t, lifecycle.apply(StateValidated, ReasonOrderAccepted, "", "user", now))
+	require.NoError(t, lifecycle.apply(StateAwaitingApproval, ReasonApprovalRequired, "matches approval rule production", "user", now))
+	assert.Nil(t, lifecycle.Deadline)
+	assert.Equal(t, "AwaitingApproval", Phase(StateAwaitingApproval))
+	assert.Contains(t, lifecycle.Conditions, Condition{Type: ConditionApproved, Status: false, Reason: ReasonApprovalRequired, Message: "matches approval rule production", LastTransitionTime: now})
+
+	approved := *lifecycle
+	approved.Conditions = slices.Clone(lifecycle.Conditions)
+	require.NoError(t, approved.apply(StateProvisioning, ReasonApproved, "within budget", "approver", now))
+	assert.Contains(t, approved.Conditions, Condition{Type: ConditionApproved, Status: true, Reason: ReasonApproved, Message: "within budget", LastTransitionTime: now})
+
+	require.NoError(t, lifecycle.apply(StateRejected, ReasonRejected, "too large", "approver", now))
+	assert.True(t, IsTerminal(StateRejected))
+	assert.False(t, CanTransition(StateRejected, StatePending))
+	assert.Equal(t, StateRejected, StateFromPhase(Phase(StateRejected)))
+}
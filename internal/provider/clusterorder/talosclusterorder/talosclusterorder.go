@@ -39,7 +39,7 @@ func NewClusterOrderTalos(ctx context.Context, order apiresourcecontracts.Resour
 }
 
 func (c ClusterOrderTalos) Validate(ctx context.Context) error {
-	err := utils.ValidateOrder(ctx, c.order.Spec)
+	err := utils.ValidateOrder(ctx, c.order.Metadata.Uid, c.order.Spec)
 	if err != nil {
 		rlog.Error("error validating order", err)
 		return err
@@ -56,6 +56,10 @@ func (c ClusterOrderTalos) Validate(ctx context.Context) error {
 	return nil
 }
 
+func (c ClusterOrderTalos) GetUid() string {
+	return c.order.Metadata.Uid
+}
+
 func (c ClusterOrderTalos) GetProviderConfig() any {
 	var providerConfig apiresourcecontracts.ResourceProviderConfigKind
 	jsonString, _ := json.Marshal(c.order.Spec.ProviderConfig)
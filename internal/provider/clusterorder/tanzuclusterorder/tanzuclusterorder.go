@@ -37,7 +37,7 @@ func NewClusterOrderTanzu(ctx context.Context, order apiresourcecontracts.Resour
 
 func (c ClusterOrderTanzu) Validate(ctx context.Context) error {
 
-	err := utils.ValidateOrder(ctx, c.order.Spec)
+	err := utils.ValidateOrder(ctx, c.order.Metadata.Uid, c.order.Spec)
 	if err != nil {
 		rlog.Error("error validating order", err)
 		return err
@@ -71,6 +71,10 @@ func (c ClusterOrderTanzu) Validate(ctx context.Context) error {
 	return nil
 }
 
+func (c ClusterOrderTanzu) GetUid() string {
+	return c.order.Metadata.Uid
+}
+
 func (c ClusterOrderTanzu) GetProviderConfig() any {
 	var providerConfig apiresourcecontracts.ResourceProviderConfigTanzu
 	jsonString, _ := json.Marshal(c.order.Spec.ProviderConfig)
@@ -26,6 +26,12 @@ import (
 	"go.mongodb.org/mongo-driver/v2/bson"
 )
 
+// Phases of cancelled and rejected orders, set by the order lifecycle.
+const (
+	phaseCancelled = "Cancelled"
+	phaseRejected  = "Rejected"
+)
+
 func NewClusterOrderResource(ctx context.Context, order apiresourcecontracts.ResourceClusterOrderSpec) (apiresourcecontracts.ResourceClusterOrder, error) {
 	universalId := GenerateUUID().String()
 	apiVersion := fmt.Sprintf("%s/%s", "general.ror.internal", "v1alpha1")
@@ -100,7 +106,9 @@ func GenerateUUID() uuid.UUID {
 	return uniqueId
 }
 
-func ValidateOrder(ctx context.Context, order apiresourcecontracts.ResourceClusterOrderSpec) error {
+// ValidateOrder validates the order with the uid. Other orders for the same
+// cluster must be completed, failed, cancelled or rejected.
+func ValidateOrder(ctx context.Context, uid string, order apiresourcecontracts.ResourceClusterOrderSpec) error {
 
 	switch order.OrderType {
 	case apiresourcecontracts.ResourceActionTypeCreate:
@@ -127,8 +135,11 @@ func ValidateOrder(ctx context.Context, order apiresourcecontracts.ResourceClust
 		specClusterName := strings.ToLower(clusterOrder.Spec.Cluster)
 		clusterName := strings.ToLower(order.Cluster)
 		if specClusterName == clusterName &&
+			clusterOrder.Metadata.Uid != uid &&
 			clusterOrder.Status.Phase != apiresourcecontracts.ResourceClusterOrderStatusPhaseCompleted &&
-			clusterOrder.Status.Phase != apiresourcecontracts.ResourceClusterOrderStatusPhaseFailed {
+			clusterOrder.Status.Phase != apiresourcecontracts.ResourceClusterOrderStatusPhaseFailed &&
+			string(clusterOrder.Status.Phase) != phaseCancelled &&
+			string(clusterOrder.Status.Phase) != phaseRejected {
 			return errors.New("clusterOrder with clusterName is already running")
 		}
 	}
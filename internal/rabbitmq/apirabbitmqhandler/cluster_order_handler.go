@@ -5,10 +5,16 @@ import (
 	"encoding/json"
 	"errors"
 
+	"github.com/NorskHelsenett/ror-api/internal/databases/mongodb/repositories/resourcesmongodb"
 	"github.com/NorskHelsenett/ror-api/internal/models/ssemodels"
+	"github.com/NorskHelsenett/ror-api/internal/provider/clusterorder/orderlifecycle"
 	"github.com/NorskHelsenett/ror-api/internal/webserver/sse"
+	"github.com/NorskHelsenett/ror-api/pkg/services/sseservice"
 
 	"github.com/NorskHelsenett/ror/pkg/apicontracts/apiresourcecontracts"
+	"github.com/NorskHelsenett/ror/pkg/models/aclmodels"
+	"github.com/NorskHelsenett/ror/pkg/models/aclmodels/rorresourceowner"
+	"github.com/NorskHelsenett/ror/pkg/rlog"
 
 	"github.com/rabbitmq/amqp091-go"
 )
@@ -20,13 +26,44 @@ func HandleClusterOrderResource(ctx context.Context, message amqp091.Delivery) e
 		return err
 	}
 
+	observeClusterOrder(ctx, resourceUpdateModel)
+
 	payload := ssemodels.SseMessage{
 		Event: ssemodels.SseType_ClusterOrder_Updated,
 		Data:  resourceUpdateModel,
 	}
 
 	sse.Server.BroadcastMessage(payload)
-	return nil
+
+	// Deliver the order to v2 event clients subscribed to it.
+	orderEvent, err := sseservice.NewOrderEvent(sseservice.SseEventOrderUpdated, sseservice.ResourceEventData{
+		Uid:        resourceUpdateModel.Uid,
+		ApiVersion: resourceUpdateModel.ApiVersion,
+		Kind:       resourceUpdateModel.Kind,
+	}, rorresourceowner.RorResourceOwnerReference{
+		Scope:   aclmodels.Acl2Scope(resourceUpdateModel.Owner.Scope),
+		Subject: aclmodels.Acl2Subject(resourceUpdateModel.Owner.Subject),
+	})
+	if err != nil {
+		return err
+	}
+	return sseservice.PublishEvent(ctx, sse.Server.RabbitMQConnection, orderEvent)
+}
+
+// observeClusterOrder moves the lifecycle of the order to the phase reported
+// for it, and fails orders that timed out. Order events drive the timeout
+// detection, errors are logged so the event is still delivered.
+func observeClusterOrder(ctx context.Context, resourceUpdateModel apiresourcecontracts.ResourceUpdateModel) {
+	order := resourcesmongodb.MapToResourceModel[apiresourcecontracts.ResourceClusterOrder](resourceUpdateModel.Resource)
+	if order.Metadata.Uid == "" {
+		order.Metadata.Uid = resourceUpdateModel.Uid
+	}
+	if err := orderlifecycle.Observe(ctx, order); err != nil {
+		rlog.Errorc(ctx, "could not observe cluster order", err, rlog.String("uid", order.Metadata.Uid))
+	}
+	if err := orderlifecycle.FailTimedOut(ctx); err != nil {
+		rlog.Errorc(ctx, "could not fail timed out cluster orders", err)
+	}
 }
 
 func HandleEvents(ctx context.Context, message amqp091.Delivery) error {
@@ -0,0 +1,177 @@
+package serviceaccountauth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/NorskHelsenett/ror-api/internal/models/serviceaccountmodels"
+
+	"github.com/NorskHelsenett/ror-api/pkg/helpers/publichttp"
+
+	"github.com/NorskHelsenett/ror/pkg/config/rorconfig"
+
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/lestrrat-go/jwx/v2/jwk"
+)
+
+const (
+	discoveryPath    = "/.well-known/openid-configuration"
+	discoveryTimeout = 10 * time.Second
+)
+
+var ErrInvalidIssuer = errors.New("invalid service account issuer")
+
+// ResolveIssuer validates the issuer registered for a cluster and returns it
+// with the keys it is verified with. The jwks uri is read from the openid
+// configuration of the issuer when neither the jwks nor the jwks uri is set,
+// and the jwks is stored with the public keys only. Keys are only fetched from
+// the hosts of SERVICEACCOUNT_ISSUER_HOSTS, at public addresses, other
+// clusters must register their jwks.
+func ResolveIssuer(ctx context.Context, issuer serviceaccountmodels.ServiceAccountIssuer) (serviceaccountmodels.ServiceAccountIssuer, error) {
+	if strings.TrimSpace(issuer.Issuer) == "" {
+		return issuer, fmt.Errorf("%w: the issuer is required", ErrInvalidIssuer)
+	}
+	if len(issuer.Subjects) == 0 {
+		return issuer, fmt.Errorf("%w: the service accounts allowed to authenticate are required", ErrInvalidIssuer)
+	}
+	for _, subject := range issuer.Subjects {
+		if parts := strings.Split(strings.TrimPrefix(subject, SubjectPrefix), ":"); !strings.HasPrefix(subject, SubjectPrefix) || len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return issuer, fmt.Errorf("%w: subjects must be written as %s<namespace>:<name>", ErrInvalidIssuer, SubjectPrefix)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, discoveryTimeout)
+	defer cancel()
+	client := publichttp.NewClient(discoveryTimeout)
+
+	if issuer.Jwks != "" {
+		jwks, err := publicJwks(issuer.Jwks)
+		if err != nil {
+			return issuer, err
+		}
+		issuer.Jwks = jwks
+		issuer.JwksUri = ""
+		return issuer, nil
+	}
+
+	if issuer.JwksUri == "" {
+		jwksUri, err := discoverJwksUri(ctx, client, issuer.Issuer)
+		if err != nil {
+			return issuer, err
+		}
+		issuer.JwksUri = jwksUri
+	}
+	if err := validateUrl(ctx, issuer.JwksUri); err != nil {
+		return issuer, fmt.Errorf("%w: the jwks uri %s", ErrInvalidIssuer, err)
+	}
+	if _, err := jwk.Fetch(ctx, issuer.JwksUri, jwk.WithHTTPClient(client)); err != nil {
+		return issuer, fmt.Errorf("%w: could not fetch the jwks: %w", ErrInvalidIssuer, err)
+	}
+	return issuer, nil
+}
+
+// discoverJwksUri returns the jwks uri of the openid configuration of the
+// issuer.
+func discoverJwksUri(ctx context.Context, client *http.Client, issuer string) (string, error) {
+	if err := validateUrl(ctx, issuer); err != nil {
+		return "", fmt.Errorf("%w: the issuer %s, or the jwks must be registered", ErrInvalidIssuer, err)
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(issuer, "/")+discoveryPath, nil)
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", ErrInvalidIssuer, err)
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return "", fmt.Errorf("%w: could not get the openid configuration: %w", ErrInvalidIssuer, err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%w: could not get the openid configuration, status %d", ErrInvalidIssuer, response.StatusCode)
+	}
+
+	var configuration struct {
+		Issuer  string `json:"issuer"`
+		JwksUri string `json:"jwks_uri"`
+	}
+	if err := json.NewDecoder(response.Body).Decode(&configuration); err != nil {
+		return "", fmt.Errorf("%w: could not decode the openid configuration: %w", ErrInvalidIssuer, err)
+	}
+	if configuration.Issuer != issuer {
+		return "", fmt.Errorf("%w: the openid configuration is of the issuer %s", ErrInvalidIssuer, configuration.Issuer)
+	}
+	if configuration.JwksUri == "" {
+		return "", fmt.Errorf("%w: the openid configuration has no jwks uri", ErrInvalidIssuer)
+	}
+	return configuration.JwksUri, nil
+}
+
+// publicJwks returns the public keys of the jwks, which must all be
+// asymmetric.
+func publicJwks(jwks string) (string, error) {
+	set, err := jwk.Parse([]byte(jwks))
+	if err != nil {
+		return "", fmt.Errorf("%w: could not parse the jwks: %w", ErrInvalidIssuer, err)
+	}
+	if set.Len() == 0 {
+		return "", fmt.Errorf("%w: the jwks has no keys", ErrInvalidIssuer)
+	}
+	for i := 0; i < set.Len(); i++ {
+		key, _ := set.Key(i)
+		if key.KeyType() == jwa.OctetSeq {
+			return "", fmt.Errorf("%w: the jwks can only have public keys", ErrInvalidIssuer)
+		}
+	}
+
+	public, err := jwk.PublicSetOf(set)
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", ErrInvalidIssuer, err)
+	}
+	encoded, err := json.Marshal(public)
+	if err != nil {
+		return "", fmt.Errorf("could not encode the jwks: %w", err)
+	}
+	return string(encoded), nil
+}
+
+// validateUrl checks that keys may be fetched from the url, an https url of
+// an allowed host that resolves to public addresses.
+func validateUrl(ctx context.Context, value string) error {
+	target, err := url.Parse(value)
+	if err != nil || target.Hostname() == "" {
+		return errors.New("must be an absolute url")
+	}
+	if !allowedHost(target.Hostname()) {
+		return fmt.Errorf("host %s is not in SERVICEACCOUNT_ISSUER_HOSTS", target.Hostname())
+	}
+	if _, err := publichttp.ValidateUrl(ctx, value); err != nil {
+		return fmt.Errorf("must be a public https url: %w", err)
+	}
+	return nil
+}
+
+// allowedHost reports whether keys may be fetched from the host, listed in the
+// comma separated SERVICEACCOUNT_ISSUER_HOSTS. A host starting with "*."
+// allows its subdomains.
+func allowedHost(host string) bool {
+	host = strings.ToLower(host)
+	for _, allowed := range strings.Split(rorconfig.GetString("SERVICEACCOUNT_ISSUER_HOSTS"), ",") {
+		allowed = strings.ToLower(strings.TrimSpace(allowed))
+		switch {
+		case allowed == "":
+		case strings.HasPrefix(allowed, "*."):
+			if strings.HasSuffix(host, allowed[1:]) {
+				return true
+			}
+		case host == allowed:
+			return true
+		}
+	}
+	return false
+}
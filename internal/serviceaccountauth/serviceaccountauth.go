@@ -0,0 +1,259 @@
+// Package serviceaccountauth authenticates cluster agents with the projected
+// service account tokens of their cluster. The tokens are verified against the
+// keys of the service account issuer registered for the cluster, and the
+// agent gets the identity of the cluster, like with a cluster api key.
+package serviceaccountauth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/NorskHelsenett/ror-api/internal/databases/mongodb/repositories/clusterissuers"
+	"github.com/NorskHelsenett/ror-api/internal/models/serviceaccountmodels"
+
+	"github.com/NorskHelsenett/ror-api/pkg/helpers/publichttp"
+	"github.com/NorskHelsenett/ror-api/pkg/helpers/rorginerror"
+
+	"github.com/NorskHelsenett/ror/pkg/config/rorconfig"
+	identitymodels "github.com/NorskHelsenett/ror/pkg/models/identity"
+	"github.com/NorskHelsenett/ror/pkg/rlog"
+	"github.com/NorskHelsenett/ror/pkg/telemetry/rortracer"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lestrrat-go/jwx/v2/jwk"
+	"github.com/lestrrat-go/jwx/v2/jws"
+	"github.com/lestrrat-go/jwx/v2/jwt"
+)
+
+const (
+	// SubjectPrefix prefixes the subject of the service account tokens.
+	SubjectPrefix = "system:serviceaccount:"
+	// kubernetesClaim is only set in projected service account tokens.
+	kubernetesClaim = "kubernetes.io"
+
+	defaultAudience = "ror-api"
+	acceptableSkew  = 30 * time.Second
+	// issuersRefreshInterval is how long the registered issuers are used
+	// before they are read again, and issuersReloadInterval how often they
+	// are read again for a token no registered cluster accepts.
+	issuersRefreshInterval = time.Minute
+	issuersReloadInterval  = 10 * time.Second
+	jwksRefreshInterval    = 5 * time.Minute
+)
+
+var (
+	ErrNoCluster         = errors.New("no registered cluster accepts the token")
+	ErrSubjectNotAllowed = errors.New("the service account is not allowed for the cluster")
+	ErrTokenHasNoExpiry  = errors.New("the token has no expiry")
+	errNoKeys            = errors.New("the cluster issuer has no keys")
+)
+
+// ServiceAccountAuthProvider is the authmiddleware.GinAuthProvider of the
+// projected service account tokens. It must be registered before the oauth
+// provider, which takes all bearer tokens.
+type ServiceAccountAuthProvider struct {
+	audience string
+	load     func(ctx context.Context) ([]serviceaccountmodels.ClusterIssuer, error)
+	jwks     *jwk.Cache
+	client   *http.Client
+
+	lock     sync.Mutex
+	issuers  map[string][]clusterKeys
+	loadedAt time.Time
+}
+
+// clusterKeys is the issuer of a cluster with its keys, which are either
+// registered with it or fetched from its jwks uri.
+type clusterKeys struct {
+	cluster serviceaccountmodels.ClusterIssuer
+	keys    jwk.Set
+}
+
+// NewServiceAccountAuthProvider returns the provider. The jwks of the issuers
+// are fetched and refreshed until the context is done.
+func NewServiceAccountAuthProvider(ctx context.Context) *ServiceAccountAuthProvider {
+	audience := rorconfig.GetString("SERVICEACCOUNT_TOKEN_AUDIENCE")
+	if audience == "" {
+		audience = defaultAudience
+	}
+	return &ServiceAccountAuthProvider{
+		audience: audience,
+		load:     clusterissuers.GetAll,
+		jwks:     jwk.NewCache(ctx),
+		client:   publichttp.NewClient(discoveryTimeout),
+	}
+}
+
+// IsOfType reports whether the request has a bearer token with the claims of
+// a projected service account token.
+func (p *ServiceAccountAuthProvider) IsOfType(c *gin.Context) bool {
+	token, ok := strings.CutPrefix(c.Request.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return false
+	}
+	unverified, err := jwt.ParseInsecure([]byte(token))
+	if err != nil {
+		return false
+	}
+	_, ok = unverified.Get(kubernetesClaim)
+	return ok
+}
+
+func (p *ServiceAccountAuthProvider) Authenticate(c *gin.Context, ctx context.Context) {
+	ctx, span := rortracer.StartSpan(ctx, "serviceaccountauth.ServiceAccountAuthProvider.Authenticate")
+	defer span.End()
+
+	token := strings.TrimPrefix(c.Request.Header.Get("Authorization"), "Bearer ")
+	cluster, verified, err := p.verify(ctx, token)
+	if err != nil {
+		rerr := rorginerror.NewRorGinSpanError(span, http.StatusUnauthorized, "invalid service account token", err)
+		rerr.GinLogErrorAbort(c)
+		return
+	}
+
+	c.Set("clusterId", cluster.ClusterId)
+	c.Set("identity", identitymodels.Identity{
+		Auth: identitymodels.AuthInfo{
+			AuthProvider:   identitymodels.IdentityProviderOidc,
+			AuthProviderID: verified.Subject(),
+			ExpirationTime: verified.Expiration(),
+		},
+		Type: identitymodels.IdentityTypeCluster,
+		ClusterIdentity: &identitymodels.ServiceIdentity{
+			Id:  cluster.ClusterId,
+			Uid: cluster.Uid,
+		},
+	})
+	rortracer.SpanOk(span)
+}
+
+// verify returns the cluster whose issuer signed the token and the verified
+// token. The issuers of clusters using the default issuer of kubernetes are
+// the same, so the token is verified against the keys of each cluster of the
+// issuer until one accepts it.
+func (p *ServiceAccountAuthProvider) verify(ctx context.Context, token string) (serviceaccountmodels.ClusterIssuer, jwt.Token, error) {
+	unverified, err := jwt.ParseInsecure([]byte(token))
+	if err != nil {
+		return serviceaccountmodels.ClusterIssuer{}, nil, fmt.Errorf("could not parse token: %w", err)
+	}
+
+	clusters, err := p.clusters(ctx, unverified.Issuer(), false)
+	if err != nil {
+		return serviceaccountmodels.ClusterIssuer{}, nil, err
+	}
+	cluster, verified, err := p.verifyWith(ctx, token, clusters)
+	if !errors.Is(err, ErrNoCluster) {
+		return cluster, verified, err
+	}
+
+	// The cluster may have been registered or its issuer updated since the
+	// issuers were read.
+	clusters, err = p.clusters(ctx, unverified.Issuer(), true)
+	if err != nil {
+		return serviceaccountmodels.ClusterIssuer{}, nil, err
+	}
+	return p.verifyWith(ctx, token, clusters)
+}
+
+func (p *ServiceAccountAuthProvider) verifyWith(ctx context.Context, token string, clusters []clusterKeys) (serviceaccountmodels.ClusterIssuer, jwt.Token, error) {
+	for _, candidate := range clusters {
+		keys, err := p.keySet(ctx, candidate)
+		if err != nil {
+			rlog.Warnc(ctx, "could not get the keys of the cluster issuer", rlog.String("cluster", candidate.cluster.ClusterId), rlog.String("error", err.Error()))
+			continue
+		}
+		verified, err := jwt.Parse([]byte(token),
+			jwt.WithKeySet(keys, jws.WithInferAlgorithmFromKey(true)),
+			jwt.WithValidate(true),
+			jwt.WithIssuer(candidate.cluster.Issuer),
+			jwt.WithAudience(p.audience),
+			jwt.WithAcceptableSkew(acceptableSkew),
+		)
+		if err != nil {
+			continue
+		}
+		if verified.Expiration().IsZero() {
+			return serviceaccountmodels.ClusterIssuer{}, nil, ErrTokenHasNoExpiry
+		}
+		if !allowedSubject(candidate.cluster, verified.Subject()) {
+			return serviceaccountmodels.ClusterIssuer{}, nil, ErrSubjectNotAllowed
+		}
+		return candidate.cluster, verified, nil
+	}
+	return serviceaccountmodels.ClusterIssuer{}, nil, ErrNoCluster
+}
+
+// allowedSubject reports whether the subject is a service account allowed
+// for the cluster. A cluster without subjects allows no service account.
+func allowedSubject(cluster serviceaccountmodels.ClusterIssuer, subject string) bool {
+	if !strings.HasPrefix(subject, SubjectPrefix) {
+		return false
+	}
+	return slices.Contains(cluster.Subjects, subject)
+}
+
+func (p *ServiceAccountAuthProvider) keySet(ctx context.Context, candidate clusterKeys) (jwk.Set, error) {
+	if candidate.keys != nil {
+		return candidate.keys, nil
+	}
+	if candidate.cluster.JwksUri == "" {
+		return nil, errNoKeys
+	}
+	return p.jwks.Get(ctx, candidate.cluster.JwksUri)
+}
+
+// clusters returns the clusters registered with the issuer. The issuers are
+// read again when they are older than issuersRefreshInterval, or when they
+// are older than issuersReloadInterval and stale, or the issuer is not among
+// them, so newly registered clusters can authenticate right away.
+func (p *ServiceAccountAuthProvider) clusters(ctx context.Context, issuer string, stale bool) ([]clusterKeys, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	age := time.Since(p.loadedAt)
+	if p.issuers != nil && age < issuersRefreshInterval && (age < issuersReloadInterval || (!stale && len(p.issuers[issuer]) > 0)) {
+		return p.issuers[issuer], nil
+	}
+
+	registered, err := p.load(ctx)
+	if err != nil {
+		if p.issuers != nil {
+			rlog.Errorc(ctx, "could not reload cluster issuers, using the loaded issuers", err)
+			return p.issuers[issuer], nil
+		}
+		return nil, err
+	}
+
+	issuers := make(map[string][]clusterKeys, len(registered))
+	for _, cluster := range registered {
+		candidate := clusterKeys{cluster: cluster}
+		switch {
+		case cluster.Jwks != "":
+			candidate.keys, err = jwk.Parse([]byte(cluster.Jwks))
+			if err != nil {
+				rlog.Errorc(ctx, "could not parse the jwks of the cluster issuer", err, rlog.String("cluster", cluster.ClusterId))
+				continue
+			}
+		case cluster.JwksUri != "" && !p.jwks.IsRegistered(cluster.JwksUri):
+			if target, err := url.Parse(cluster.JwksUri); err != nil || !allowedHost(target.Hostname()) {
+				rlog.Errorc(ctx, "the jwks uri of the cluster issuer is not on an allowed host", err, rlog.String("cluster", cluster.ClusterId))
+				continue
+			}
+			if err := p.jwks.Register(cluster.JwksUri, jwk.WithMinRefreshInterval(jwksRefreshInterval), jwk.WithHTTPClient(p.client)); err != nil {
+				rlog.Errorc(ctx, "could not register the jwks uri of the cluster issuer", err, rlog.String("cluster", cluster.ClusterId))
+				continue
+			}
+		}
+		issuers[cluster.Issuer] = append(issuers[cluster.Issuer], candidate)
+	}
+	p.issuers = issuers
+	p.loadedAt = time.Now()
+	return p.issuers[issuer], nil
+}
@@ -0,0 +1,134 @@
+package serviceaccountauth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/NorskHelsenett/ror-api/internal/models/serviceaccountmodels"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/lestrrat-go/jwx/v2/jwk"
+	"github.com/lestrrat-go/jwx/v2/jwt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testIssuer  = "https://kubernetes.default.svc.cluster.local"
+	testSubject = "system:serviceaccount:ror:ror-agent"
+)
+
+func newTestKey(t *testing.T, kid string) (jwk.Key, string) {
+	raw, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	private, err := jwk.FromRaw(raw)
+	require.NoError(t, err)
+	require.NoError(t, private.Set(jwk.KeyIDKey, kid))
+	require.NoError(t, private.Set(jwk.AlgorithmKey, jwa.RS256))
+
+	public, err := jwk.PublicKeyOf(private)
+	require.NoError(t, err)
+	set := jwk.NewSet()
+	require.NoError(t, set.AddKey(public))
+	jwks, err := json.Marshal(set)
+	require.NoError(t, err)
+	return private, string(jwks)
+}
+
+func newTestToken(t *testing.T, key jwk.Key, audience string, subject string) string {
+	token := jwt.New()
+	require.NoError(t, token.Set(jwt.IssuerKey, testIssuer))
+	require.NoError(t, token.Set(jwt.SubjectKey, subject))
+	require.NoError(t, token.Set(jwt.AudienceKey, []string{audience}))
+	require.NoError(t, token.Set(jwt.ExpirationKey, time.Now().Add(time.Hour)))
+	require.NoError(t, token.Set(kubernetesClaim, map[string]any{"namespace": "ror"}))
+	signed, err := jwt.Sign(token, jwt.WithKey(jwa.RS256, key))
+	require.NoError(t, err)
+	return string(signed)
+}
+
+func TestVerify(t *testing.T) {
+	keyA, jwksA := newTestKey(t, "a")
+	keyB, jwksB := newTestKey(t, "b")
+	keyC, jwksC := newTestKey(t, "c")
+	keyD, _ := newTestKey(t, "d")
+
+	provider := &ServiceAccountAuthProvider{
+		audience: defaultAudience,
+		load: func(ctx context.Context) ([]serviceaccountmodels.ClusterIssuer, error) {
+			return []serviceaccountmodels.ClusterIssuer{
+				{ClusterId: "cluster-a", Uid: "uid-a", Issuer: testIssuer, Jwks: jwksA, Subjects: []string{"system:serviceaccount:ror:other"}},
+				{ClusterId: "cluster-b", Uid: "uid-b", Issuer: testIssuer, Jwks: jwksB, Subjects: []string{testSubject}},
+				{ClusterId: "cluster-c", Uid: "uid-c", Issuer: testIssuer, Jwks: jwksC},
+			}, nil
+		},
+	}
+	ctx := context.Background()
+
+	cluster, verified, err := provider.verify(ctx, newTestToken(t, keyB, defaultAudience, testSubject))
+	require.NoError(t, err)
+	assert.Equal(t, "cluster-b", cluster.ClusterId)
+	assert.Equal(t, testSubject, verified.Subject())
+
+	_, _, err = provider.verify(ctx, newTestToken(t, keyA, defaultAudience, testSubject))
+	assert.ErrorIs(t, err, ErrSubjectNotAllowed)
+
+	_, _, err = provider.verify(ctx, newTestToken(t, keyC, defaultAudience, testSubject))
+	assert.ErrorIs(t, err, ErrSubjectNotAllowed, "a cluster without subjects allows no service account")
+
+	_, _, err = provider.verify(ctx, newTestToken(t, keyB, "other", testSubject))
+	assert.ErrorIs(t, err, ErrNoCluster)
+
+	_, _, err = provider.verify(ctx, newTestToken(t, keyD, defaultAudience, testSubject))
+	assert.ErrorIs(t, err, ErrNoCluster)
+}
+
+func TestIsOfType(t *testing.T) {
+	key, _ := newTestKey(t, "a")
+	provider := &ServiceAccountAuthProvider{}
+
+	other := jwt.New()
+	require.NoError(t, other.Set(jwt.IssuerKey, "https://auth.example.com"))
+	signed, err := jwt.Sign(other, jwt.WithKey(jwa.RS256, key))
+	require.NoError(t, err)
+
+	for name, tc := range map[string]struct {
+		authorization string
+		want          bool
+	}{
+		"service account token": {"Bearer " + newTestToken(t, key, defaultAudience, testSubject), true},
+		"oidc token":            {"Bearer " + string(signed), false},
+		"not a token":           {"Bearer abc", false},
+		"no bearer":             {"", false},
+	} {
+		t.Run(name, func(t *testing.T) {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest("GET", "/", nil)
+			c.Request.Header.Set("Authorization", tc.authorization)
+			assert.Equal(t, tc.want, provider.IsOfType(c))
+		})
+	}
+}
+
+func TestPublicJwks(t *testing.T) {
+	private, _ := newTestKey(t, "a")
+	set := jwk.NewSet()
+	require.NoError(t, set.AddKey(private))
+	jwks, err := json.Marshal(set)
+	require.NoError(t, err)
+
+	public, err := publicJwks(string(jwks))
+	require.NoError(t, err)
+	assert.NotContains(t, public, `"d"`)
+
+	_, err = publicJwks(`{"keys":[{"kty":"oct","k":"c2VjcmV0"}]}`)
+	assert.ErrorIs(t, err, ErrInvalidIssuer)
+	_, err = publicJwks(`{"keys":[]}`)
+	assert.ErrorIs(t, err, ErrInvalidIssuer)
+}
@@ -0,0 +1,162 @@
+package kubeconfigservice
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/NorskHelsenett/ror-api/pkg/services/tokenservice"
+
+	"github.com/NorskHelsenett/ror/pkg/apicontracts"
+	"github.com/NorskHelsenett/ror/pkg/config/rorconfig"
+
+	"sigs.k8s.io/yaml"
+)
+
+// oidcProvider generates kubeconfigs for clusters that trust tokens signed by
+// ror. The kubeconfig uses the exec credential plugin KUBECONFIG_OIDC_EXEC_COMMAND,
+// so kubectl gets new tokens for the cluster itself and no token is stored in
+// the kubeconfig. The plugin arguments in KUBECONFIG_OIDC_EXEC_ARGS can use
+// {clusterId}, {issuer} and {clientId}. Only if KUBECONFIG_OIDC_STATIC_TOKEN
+// is set the bearer token of the caller is exchanged for a token for the
+// cluster, which is added to the kubeconfig.
+type oidcProvider struct{}
+
+func (oidcProvider) GetKubeconfig(ctx context.Context, cluster *apicontracts.Cluster, _ apicontracts.KubeconfigCredentials) (string, error) {
+	server := cluster.KubeApi.EndpointAddress
+	if server == "" {
+		server = cluster.Topology.ControlPlaneEndpoint
+	}
+	if server == "" {
+		return "", fmt.Errorf("cluster %s has no api endpoint", cluster.ClusterId)
+	}
+	if !strings.Contains(server, "://") {
+		server = "https://" + server
+	}
+
+	user, err := oidcUser(ctx, cluster.ClusterId)
+	if err != nil {
+		return "", err
+	}
+
+	config := kubeconfig{
+		APIVersion: "v1",
+		Kind:       "Config",
+		Clusters: []kubeconfigNamedCluster{{
+			Name: cluster.ClusterName,
+			Cluster: kubeconfigCluster{
+				Server:                   server,
+				CertificateAuthorityData: certificateAuthorityData(cluster.KubeApi.Certificate),
+			},
+		}},
+		Users: []kubeconfigNamedUser{{Name: cluster.ClusterName + "-oidc", User: user}},
+		Contexts: []kubeconfigNamedContext{{
+			Name:    cluster.ClusterName,
+			Context: kubeconfigContext{Cluster: cluster.ClusterName, User: cluster.ClusterName + "-oidc"},
+		}},
+		CurrentContext: cluster.ClusterName,
+	}
+
+	out, err := yaml.Marshal(config)
+	if err != nil {
+		return "", fmt.Errorf("could not marshal kubeconfig: %w", err)
+	}
+	return string(out), nil
+}
+
+func (oidcProvider) GetKubeconfigForWorkspace(_ context.Context, workspace *apicontracts.Workspace, _ apicontracts.KubeconfigCredentials) (string, error) {
+	return "", fmt.Errorf("provider %s is not supported for workspaces", workspace.Datacenter.Provider)
+}
+
+func oidcUser(ctx context.Context, clusterId string) (kubeconfigUser, error) {
+	if !rorconfig.GetBool("KUBECONFIG_OIDC_STATIC_TOKEN") {
+		command := rorconfig.GetString("KUBECONFIG_OIDC_EXEC_COMMAND")
+		if command == "" {
+			return kubeconfigUser{}, errors.New("KUBECONFIG_OIDC_EXEC_COMMAND is not set")
+		}
+		replacer := strings.NewReplacer(
+			"{clusterId}", clusterId,
+			"{issuer}", rorconfig.GetString(rorconfig.OIDC_PROVIDER),
+			"{clientId}", rorconfig.GetString(rorconfig.OIDC_DEVICE_CLIENT_ID),
+		)
+		var args []string
+		for arg := range strings.SplitSeq(rorconfig.GetString("KUBECONFIG_OIDC_EXEC_ARGS"), ",") {
+			if arg = strings.TrimSpace(arg); arg != "" {
+				args = append(args, replacer.Replace(arg))
+			}
+		}
+		return kubeconfigUser{Exec: &kubeconfigExec{
+			APIVersion:      "client.authentication.k8s.io/v1",
+			Command:         command,
+			Args:            args,
+			InteractiveMode: "IfAvailable",
+		}}, nil
+	}
+
+	token := tokenFromContext(ctx)
+	if token == "" {
+		return kubeconfigUser{}, ErrMissingToken
+	}
+	clusterToken, err := tokenservice.ExchangeToken(ctx, clusterId, token, false)
+	if err != nil {
+		return kubeconfigUser{}, fmt.Errorf("could not exchange token: %w", err)
+	}
+	return kubeconfigUser{Token: clusterToken}, nil
+}
+
+// certificateAuthorityData returns the base64 encoded certificate, which is
+// stored either as pem or base64 encoded already.
+func certificateAuthorityData(certificate string) string {
+	if strings.HasPrefix(strings.TrimSpace(certificate), "-----BEGIN") {
+		return base64.StdEncoding.EncodeToString([]byte(certificate))
+	}
+	return certificate
+}
+
+type kubeconfig struct {
+	APIVersion     string                   `json:"apiVersion"`
+	Kind           string                   `json:"kind"`
+	Clusters       []kubeconfigNamedCluster `json:"clusters"`
+	Users          []kubeconfigNamedUser    `json:"users"`
+	Contexts       []kubeconfigNamedContext `json:"contexts"`
+	CurrentContext string                   `json:"current-context"`
+}
+
+type kubeconfigNamedCluster struct {
+	Name    string            `json:"name"`
+	Cluster kubeconfigCluster `json:"cluster"`
+}
+
+type kubeconfigCluster struct {
+	Server                   string `json:"server"`
+	CertificateAuthorityData string `json:"certificate-authority-data,omitempty"`
+}
+
+type kubeconfigNamedUser struct {
+	Name string         `json:"name"`
+	User kubeconfigUser `json:"user"`
+}
+
+type kubeconfigUser struct {
+	Token string          `json:"token,omitempty"`
+	Exec  *kubeconfigExec `json:"exec,omitempty"`
+}
+
+type kubeconfigExec struct {
+	APIVersion      string   `json:"apiVersion"`
+	Command         string   `json:"command"`
+	Args            []string `json:"args,omitempty"`
+	InteractiveMode string   `json:"interactiveMode"`
+}
+
+type kubeconfigNamedContext struct {
+	Name    string            `json:"name"`
+	Context kubeconfigContext `json:"context"`
+}
+
+type kubeconfigContext struct {
+	Cluster string `json:"cluster"`
+	User    string `json:"user"`
+}
@@ -0,0 +1,66 @@
+package kubeconfigservice
+
+import (
+	"context"
+	"testing"
+
+	"github.com/NorskHelsenett/ror/pkg/apicontracts"
+	"github.com/NorskHelsenett/ror/pkg/config/rorconfig"
+	"github.com/NorskHelsenett/ror/pkg/kubernetes/providers/providermodels"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sigs.k8s.io/yaml"
+)
+
+func TestGetKubeconfigUnsupportedProvider(t *testing.T) {
+	cluster := &apicontracts.Cluster{}
+	cluster.Workspace.Datacenter.Provider = providermodels.ProviderTypeUnknown
+
+	_, err := GetKubeconfig(context.Background(), cluster, apicontracts.KubeconfigCredentials{})
+	assert.ErrorContains(t, err, "is not supported")
+}
+
+func TestOidcProviderExecKubeconfig(t *testing.T) {
+	rorconfig.Set("KUBECONFIG_OIDC_EXEC_COMMAND", "ror")
+	rorconfig.Set("KUBECONFIG_OIDC_EXEC_ARGS", "token,--cluster-id,{clusterId}")
+	t.Cleanup(func() {
+		rorconfig.Set("KUBECONFIG_OIDC_EXEC_COMMAND", "")
+		rorconfig.Set("KUBECONFIG_OIDC_EXEC_ARGS", "")
+	})
+
+	cluster := &apicontracts.Cluster{ClusterId: "talos-1", ClusterName: "talos"}
+	cluster.KubeApi.EndpointAddress = "talos.example.com:6443"
+	cluster.KubeApi.Certificate = "-----BEGIN CERTIFICATE-----"
+
+	out, err := oidcProvider{}.GetKubeconfig(context.Background(), cluster, apicontracts.KubeconfigCredentials{})
+	require.NoError(t, err)
+
+	var config kubeconfig
+	require.NoError(t, yaml.Unmarshal([]byte(out), &config))
+	assert.Equal(t, "https://talos.example.com:6443", config.Clusters[0].Cluster.Server)
+	assert.Equal(t, "LS0tLS1CRUdJTiBDRVJUSUZJQ0FURS0tLS0t", config.Clusters[0].Cluster.CertificateAuthorityData)
+	require.NotNil(t, config.Users[0].User.Exec)
+	assert.Equal(t, []string{"token", "--cluster-id", "talos-1"}, config.Users[0].User.Exec.Args)
+	assert.Equal(t, "talos", config.CurrentContext)
+}
+
+func TestOidcProviderExecRequiresCommand(t *testing.T) {
+	cluster := &apicontracts.Cluster{ClusterId: "kind-1", ClusterName: "kind"}
+	cluster.KubeApi.EndpointAddress = "https://127.0.0.1:6443"
+
+	_, err := oidcProvider{}.GetKubeconfig(context.Background(), cluster, apicontracts.KubeconfigCredentials{})
+	assert.ErrorContains(t, err, "KUBECONFIG_OIDC_EXEC_COMMAND")
+}
+
+func TestOidcProviderStaticTokenRequiresToken(t *testing.T) {
+	rorconfig.Set("KUBECONFIG_OIDC_STATIC_TOKEN", "true")
+	t.Cleanup(func() {
+		rorconfig.Set("KUBECONFIG_OIDC_STATIC_TOKEN", "false")
+	})
+
+	cluster := &apicontracts.Cluster{ClusterId: "kind-1", ClusterName: "kind"}
+	cluster.KubeApi.EndpointAddress = "https://127.0.0.1:6443"
+
+	_, err := oidcProvider{}.GetKubeconfig(context.Background(), cluster, apicontracts.KubeconfigCredentials{})
+	assert.ErrorIs(t, err, ErrMissingToken)
+}
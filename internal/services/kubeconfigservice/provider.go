@@ -0,0 +1,64 @@
+package kubeconfigservice
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/NorskHelsenett/ror/pkg/apicontracts"
+	"github.com/NorskHelsenett/ror/pkg/kubernetes/providers/providermodels"
+)
+
+var (
+	ErrMissingCredentials = errors.New("username and password must be provided")
+	ErrMissingToken       = errors.New("a bearer token must be provided")
+)
+
+// KubeconfigProvider generates kubeconfigs for the clusters and workspaces
+// of a provider type.
+type KubeconfigProvider interface {
+	GetKubeconfig(ctx context.Context, cluster *apicontracts.Cluster, credentials apicontracts.KubeconfigCredentials) (string, error)
+	GetKubeconfigForWorkspace(ctx context.Context, workspace *apicontracts.Workspace, credentials apicontracts.KubeconfigCredentials) (string, error)
+}
+
+var (
+	providersLock sync.RWMutex
+	providers     = map[providermodels.ProviderType]KubeconfigProvider{
+		providermodels.ProviderTypeTanzu: tanzuProvider{},
+		providermodels.ProviderTypeTalos: oidcProvider{},
+		providermodels.ProviderTypeKind:  oidcProvider{},
+		providermodels.ProviderTypeK3d:   oidcProvider{},
+	}
+)
+
+// RegisterProvider sets the kubeconfig provider of a provider type,
+// replacing the current one.
+func RegisterProvider(providerType providermodels.ProviderType, provider KubeconfigProvider) {
+	providersLock.Lock()
+	defer providersLock.Unlock()
+	providers[providerType] = provider
+}
+
+func getProvider(providerType providermodels.ProviderType) (KubeconfigProvider, error) {
+	providersLock.RLock()
+	defer providersLock.RUnlock()
+	provider, ok := providers[providerType]
+	if !ok {
+		return nil, fmt.Errorf("provider %s is not supported", providerType)
+	}
+	return provider, nil
+}
+
+type tokenContextKey struct{}
+
+// WithToken returns a context carrying the bearer token of the caller, which
+// token based providers exchange for a cluster token.
+func WithToken(ctx context.Context, token string) context.Context {
+	return context.WithValue(ctx, tokenContextKey{}, token)
+}
+
+func tokenFromContext(ctx context.Context) string {
+	token, _ := ctx.Value(tokenContextKey{}).(string)
+	return token
+}
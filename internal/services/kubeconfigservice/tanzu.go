@@ -0,0 +1,104 @@
+package kubeconfigservice
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/NorskHelsenett/ror/pkg/apicontracts"
+	"github.com/NorskHelsenett/ror/pkg/config/rorconfig"
+	"github.com/NorskHelsenett/ror/pkg/rlog"
+)
+
+// tanzuProvider gets kubeconfigs from the tanzu auth service, which logs in
+// to the supervisor cluster with the credentials of the user.
+type tanzuProvider struct{}
+
+func (tanzuProvider) GetKubeconfig(ctx context.Context, cluster *apicontracts.Cluster, credentials apicontracts.KubeconfigCredentials) (string, error) {
+	return getKubeconfigForTanzuCluster(ctx, cluster, credentials)
+}
+
+func (tanzuProvider) GetKubeconfigForWorkspace(ctx context.Context, workspace *apicontracts.Workspace, credentials apicontracts.KubeconfigCredentials) (string, error) {
+	return getKubeconfigForTanzuWorkspace(ctx, workspace, credentials)
+}
+
+func getKubeconfigForTanzuCluster(ctx context.Context, cluster *apicontracts.Cluster, credentials apicontracts.KubeconfigCredentials) (string, error) {
+	if credentials.Username == "" || credentials.Password == "" {
+		return "", ErrMissingCredentials
+	}
+	creds := apicontracts.TanzuKubeConfigPayload{
+		User:          credentials.Username,
+		Password:      credentials.Password,
+		DatacenterUrl: cluster.Workspace.Datacenter.APIEndpoint,
+		WorkspaceName: cluster.Workspace.Name,
+		ClusterName:   cluster.ClusterName,
+		ClusterId:     cluster.ClusterId,
+		WorkspaceOnly: false,
+	}
+
+	return getKubeconfig(ctx, creds)
+}
+
+func getKubeconfigForTanzuWorkspace(ctx context.Context, workspace *apicontracts.Workspace, credentials apicontracts.KubeconfigCredentials) (string, error) {
+	if credentials.Username == "" || credentials.Password == "" {
+		return "", ErrMissingCredentials
+	}
+	creds := apicontracts.TanzuKubeConfigPayload{
+		User:          credentials.Username,
+		Password:      credentials.Password,
+		DatacenterUrl: workspace.Datacenter.APIEndpoint,
+		WorkspaceName: workspace.Name,
+		ClusterName:   "",
+		ClusterId:     "",
+		WorkspaceOnly: true,
+	}
+
+	return getKubeconfig(ctx, creds)
+}
+
+func getKubeconfig(ctx context.Context, configPayload apicontracts.TanzuKubeConfigPayload) (string, error) {
+	var payload bytes.Buffer
+	err := json.NewEncoder(&payload).Encode(configPayload)
+	if err != nil {
+		rlog.Error("failed to encode payload", err)
+		return "", err
+	}
+
+	serviceUrl := rorconfig.GetString("TANZU_AUTH_BASE_URL")
+	httpposturl := fmt.Sprintf("%s/v1/kubeconfig", serviceUrl)
+	request, err := http.NewRequestWithContext(ctx, "POST", httpposturl, &payload)
+	if err != nil {
+		rlog.Error("failed to create request", err)
+		return "", err
+	}
+
+	request.Header.Set("Content-Type", "application/json; charset=UTF-8")
+
+	response, err := httpClient.Do(request)
+	if err != nil {
+		rlog.Error("failed to get kubeconfig", err)
+		return "", err
+	}
+	defer func() {
+		if closeErr := response.Body.Close(); closeErr != nil {
+			rlog.Error("Failed to close response body", closeErr)
+		}
+	}()
+
+	if response.StatusCode != http.StatusOK {
+		err = fmt.Errorf("failed to get kubeconfig, status code: %d", response.StatusCode)
+		rlog.Error("error", err)
+		return "", err
+	}
+
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		rlog.Error("failed to read response body", err)
+		return "", err
+	}
+
+	return string(body), nil
+}
@@ -0,0 +1,69 @@
+package switchboard
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/NorskHelsenett/ror/pkg/apicontracts/apiresourcecontracts"
+	"github.com/NorskHelsenett/ror/pkg/apicontracts/messages"
+	"github.com/NorskHelsenett/ror/pkg/clients/rabbitmqclient"
+	"github.com/NorskHelsenett/ror/pkg/handlers/rabbitmqhandler"
+	"github.com/NorskHelsenett/ror/pkg/messagebuscontracts"
+	"github.com/NorskHelsenett/ror/pkg/rlog"
+
+	amqp091 "github.com/rabbitmq/amqp091-go"
+)
+
+// QueueName is the queue of the resource events shared by the replicas, so
+// each event is matched against the rulesets once.
+const QueueName = "ror-api-switchboard"
+
+func startConsumer(rabbitMQConnection rabbitmqclient.RabbitMQConnection) {
+	go func() {
+		config := rabbitmqhandler.RabbitMQListnerConfig{
+			Client:             rabbitMQConnection,
+			QueueName:          QueueName,
+			Consumer:           "",
+			AutoAck:            false,
+			Exclusive:          false,
+			NoLocal:            false,
+			NoWait:             false,
+			Args:               amqp091.Table{"x-queue-type": "quorum"},
+			QueueAutoDelete:    false,
+			Exchange:           messagebuscontracts.ExchangeRorResources,
+			ExcahngeKind:       "headers",
+			ExcahngeDurable:    true,
+			ExchangeAutoDelete: false,
+			ExcahngeRoutingKey: "",
+		}
+		rabbithandler := rabbitmqhandler.New(config, switchboardhandler{})
+		_ = rabbitMQConnection.RegisterHandler(rabbithandler)
+	}()
+}
+
+type switchboardhandler struct {
+}
+
+func (sh switchboardhandler) HandleMessage(ctx context.Context, message amqp091.Delivery) error {
+	var rule messages.RulesetRuleType
+	switch message.RoutingKey {
+	case messagebuscontracts.Route_ResourceCreated:
+		rule = messages.RulesetRuleTypeCreated
+	case messagebuscontracts.Route_ResourceUpdated:
+		rule = messages.RulesetRuleTypeUpdated
+	case messagebuscontracts.Route_ResourceDeleted:
+		rule = messages.RulesetRuleTypeDeleted
+	default:
+		return nil
+	}
+
+	var input apiresourcecontracts.ResourceUpdateModel
+	if err := json.Unmarshal(message.Body, &input); err != nil {
+		rlog.Error("could not convert to json", err)
+		return err
+	}
+
+	// The outbox publishes an event with its id as message id, an event
+	// published twice triggers the rules once.
+	return dispatch(ctx, resourceEvent(rule, input), message.MessageId)
+}
@@ -0,0 +1,121 @@
+package switchboard
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/NorskHelsenett/ror-api/internal/databases/mongodb/repositories/switchboarddeliveries"
+
+	"github.com/NorskHelsenett/ror/pkg/config/rorconfig"
+	"github.com/NorskHelsenett/ror/pkg/rlog"
+
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+const (
+	defaultDispatchInterval = 10 * time.Second
+	defaultMaxAttempts      = 8
+	// claimLease is how long a dispatcher holds a delivery it is sending
+	// before another replica may take it over.
+	claimLease = 2 * time.Minute
+	minBackoff = 10 * time.Second
+	maxBackoff = time.Hour
+)
+
+var dispatchNotifier = make(chan struct{}, 1)
+
+// startDispatcher sends the deliveries when they are stored on this replica
+// and every SWITCHBOARD_DISPATCH_INTERVAL for the deliveries of other
+// replicas and retries.
+func startDispatcher(ctx context.Context) {
+	interval, err := time.ParseDuration(rorconfig.GetString("SWITCHBOARD_DISPATCH_INTERVAL"))
+	if err != nil || interval <= 0 {
+		rlog.Warn("invalid SWITCHBOARD_DISPATCH_INTERVAL, using the default", rlog.String("default", defaultDispatchInterval.String()))
+		interval = defaultDispatchInterval
+	}
+	maxAttempts, err := strconv.Atoi(rorconfig.GetString("SWITCHBOARD_MAX_ATTEMPTS"))
+	if err != nil || maxAttempts <= 0 {
+		rlog.Warn("invalid SWITCHBOARD_MAX_ATTEMPTS, using the default", rlog.Int("default", defaultMaxAttempts))
+		maxAttempts = defaultMaxAttempts
+	}
+
+	dispatcher := &dispatcher{sender: newSender(), maxAttempts: maxAttempts}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			case <-dispatchNotifier:
+			}
+			dispatcher.sendPending(ctx)
+		}
+	}()
+}
+
+func notifyDispatcher() {
+	select {
+	case dispatchNotifier <- struct{}{}:
+	default:
+	}
+}
+
+type dispatcher struct {
+	sender      *sender
+	maxAttempts int
+}
+
+// sendPending sends the deliveries due until there are no more.
+func (d *dispatcher) sendPending(ctx context.Context) {
+	for ctx.Err() == nil {
+		delivery, err := switchboarddeliveries.Claim(ctx, time.Now(), claimLease)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return
+		}
+		if err != nil {
+			rlog.Error("could not claim switchboard delivery", err)
+			return
+		}
+
+		err = d.sender.send(ctx, delivery)
+		if err == nil {
+			if err := switchboarddeliveries.MarkDelivered(ctx, delivery.Id, time.Now()); err != nil {
+				rlog.Error("could not mark switchboard delivery delivered", err, rlog.String("id", delivery.Id))
+			}
+			continue
+		}
+
+		now := time.Now()
+		nextAttempt := d.nextAttempt(delivery.Attempts+1, err, now)
+		if nextAttempt == nil {
+			rlog.Warn("switchboard delivery failed", rlog.String("id", delivery.Id), rlog.String("service", string(delivery.Service)), rlog.Int("attempts", delivery.Attempts+1), rlog.String("error", err.Error()))
+		}
+		if err := switchboarddeliveries.Release(ctx, delivery.Id, err, now, nextAttempt); err != nil {
+			rlog.Error("could not release switchboard delivery", err, rlog.String("id", delivery.Id))
+		}
+	}
+}
+
+// nextAttempt returns when a delivery failed by the error is due again after
+// the attempts, or nil if it has used its attempts or cannot succeed.
+func (d *dispatcher) nextAttempt(attempts int, cause error, now time.Time) *time.Time {
+	if attempts >= d.maxAttempts || errors.Is(cause, errPermanent) {
+		return nil
+	}
+	next := now.Add(backoff(attempts))
+	return &next
+}
+
+// backoff returns the delay before the next attempt after the attempts,
+// doubling from minBackoff up to maxBackoff.
+func backoff(attempts int) time.Duration {
+	delay := minBackoff
+	for i := 1; i < attempts && delay < maxBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, maxBackoff)
+}
@@ -0,0 +1,81 @@
+package switchboard
+
+import (
+	"github.com/NorskHelsenett/ror-api/internal/models/switchboardmodels"
+
+	"github.com/NorskHelsenett/ror/pkg/apicontracts/messages"
+	aclmodels "github.com/NorskHelsenett/ror/pkg/models/aclmodels"
+)
+
+// wildcardUid is the uid of a ruleset resource matching all resources of its
+// api version and kind.
+const wildcardUid = "*"
+
+// match is a rule of a ruleset triggered by an event.
+type match struct {
+	ruleset  *switchboardmodels.Ruleset
+	resource *switchboardmodels.Resource
+	rule     *switchboardmodels.Rule
+}
+
+// matchRules returns the rules of the rulesets triggered by the event. The
+// resolver resolves the cluster id of a ruleset to the cluster uid used as
+// owner of v2 resources.
+func matchRules(rulesets []switchboardmodels.Ruleset, event switchboardmodels.Event, resolve func(string) string) []match {
+	var matches []match
+	for i := range rulesets {
+		ruleset := &rulesets[i]
+		if !matchRuleset(ruleset.Identity, event, resolve) {
+			continue
+		}
+		for j := range ruleset.Resources {
+			resource := &ruleset.Resources[j]
+			if !matchResource(resource.Ref, event) {
+				continue
+			}
+			for k := range resource.Rules {
+				if resource.Rules[k].Type != event.Type {
+					continue
+				}
+				matches = append(matches, match{ruleset: ruleset, resource: resource, rule: &resource.Rules[k]})
+			}
+		}
+	}
+	return matches
+}
+
+// matchRuleset reports whether the ruleset applies to the owner of the event.
+// The internal ruleset applies to events of ror itself, a cluster ruleset to
+// events of resources owned by its cluster.
+func matchRuleset(identity messages.RulesetIdentityModel, event switchboardmodels.Event, resolve func(string) string) bool {
+	switch identity.Type {
+	case messages.RulesetIdentityTypeInternal:
+		return event.Owner == "" || event.Owner == string(aclmodels.Acl2RorSubjectGlobal)
+	case messages.RulesetIdentityTypeCluster:
+		if identity.Id == "" || event.Owner == "" {
+			return false
+		}
+		if identity.Id == event.Owner {
+			return true
+		}
+		return resolve != nil && resolve(identity.Id) == event.Owner
+	default:
+		return false
+	}
+}
+
+// matchResource reports whether the resource of the ruleset is the resource
+// of the event. A wildcard resource matches the resources of its api version
+// and kind, in its namespace if it is set.
+func matchResource(ref switchboardmodels.ResourceRef, event switchboardmodels.Event) bool {
+	if ref.Uid != wildcardUid {
+		return ref.Uid == event.Uid
+	}
+	if ref.ApiVersion != "" && ref.ApiVersion != event.ApiVersion {
+		return false
+	}
+	if ref.Kind != "" && ref.Kind != event.Kind {
+		return false
+	}
+	return ref.Namespace == "" || ref.Namespace == event.Namespace
+}
@@ -0,0 +1,107 @@
+package switchboard
+
+import (
+	"testing"
+
+	"github.com/NorskHelsenett/ror-api/internal/models/switchboardmodels"
+
+	"github.com/NorskHelsenett/ror/pkg/apicontracts/messages"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func rule(id string, ruleType messages.RulesetRuleType) switchboardmodels.Rule {
+	var r switchboardmodels.Rule
+	r.Id = id
+	r.Type = ruleType
+	return r
+}
+
+func TestMatchRules(t *testing.T) {
+	rulesets := []switchboardmodels.Ruleset{
+		{
+			Identity: messages.RulesetIdentityModel{Id: "cluster-a", Type: messages.RulesetIdentityTypeCluster},
+			Resources: []switchboardmodels.Resource{
+				{
+					Id:    "exact",
+					Ref:   switchboardmodels.ResourceRef{ApiVersion: "v1", Kind: "Pod", Uid: "uid-1"},
+					Rules: []switchboardmodels.Rule{rule("exact-deleted", messages.RulesetRuleTypeDeleted), rule("exact-created", messages.RulesetRuleTypeCreated)},
+				},
+				{
+					Id:    "wildcard",
+					Ref:   switchboardmodels.ResourceRef{ApiVersion: "v1", Kind: "Pod", Namespace: "default", Uid: wildcardUid},
+					Rules: []switchboardmodels.Rule{rule("wildcard-deleted", messages.RulesetRuleTypeDeleted)},
+				},
+			},
+		},
+		{
+			Identity: messages.RulesetIdentityModel{Id: "cluster-b", Type: messages.RulesetIdentityTypeCluster},
+			Resources: []switchboardmodels.Resource{
+				{
+					Id:    "other",
+					Ref:   switchboardmodels.ResourceRef{Uid: wildcardUid},
+					Rules: []switchboardmodels.Rule{rule("other-deleted", messages.RulesetRuleTypeDeleted)},
+				},
+			},
+		},
+	}
+	resolve := func(clusterId string) string {
+		return "uid-of-" + clusterId
+	}
+	ruleIds := func(matches []match) []string {
+		var ids []string
+		for _, m := range matches {
+			ids = append(ids, m.rule.Id)
+		}
+		return ids
+	}
+
+	tests := []struct {
+		name  string
+		event switchboardmodels.Event
+		want  []string
+	}{
+		{
+			name:  "exact and wildcard resource",
+			event: switchboardmodels.Event{Type: messages.RulesetRuleTypeDeleted, Owner: "cluster-a", Uid: "uid-1", ApiVersion: "v1", Kind: "Pod", Namespace: "default"},
+			want:  []string{"exact-deleted", "wildcard-deleted"},
+		},
+		{
+			name:  "owner resolved to cluster uid",
+			event: switchboardmodels.Event{Type: messages.RulesetRuleTypeCreated, Owner: "uid-of-cluster-a", Uid: "uid-1", ApiVersion: "v1", Kind: "Pod"},
+			want:  []string{"exact-created"},
+		},
+		{
+			name:  "wildcard in another namespace",
+			event: switchboardmodels.Event{Type: messages.RulesetRuleTypeDeleted, Owner: "cluster-a", Uid: "uid-2", ApiVersion: "v1", Kind: "Pod", Namespace: "kube-system"},
+			want:  nil,
+		},
+		{
+			name:  "rule type not matching",
+			event: switchboardmodels.Event{Type: messages.RulesetRuleTypeUpdated, Owner: "cluster-a", Uid: "uid-1", ApiVersion: "v1", Kind: "Pod"},
+			want:  nil,
+		},
+		{
+			name:  "wildcard without api version and kind",
+			event: switchboardmodels.Event{Type: messages.RulesetRuleTypeDeleted, Owner: "cluster-b", Uid: "uid-3", ApiVersion: "apps/v1", Kind: "Deployment"},
+			want:  []string{"other-deleted"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, ruleIds(matchRules(rulesets, tt.event, resolve)))
+		})
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	assert.Equal(t, minBackoff, backoff(1))
+	assert.Equal(t, 4*minBackoff, backoff(3))
+	assert.Equal(t, maxBackoff, backoff(20))
+}
+
+func TestSummary_RemovesLineBreaks(t *testing.T) {
+	event := switchboardmodels.Event{Type: messages.RulesetRuleTypeCreated, Kind: "Pod", Namespace: "default", Name: "web\r\nBcc: someone@example.com"}
+
+	assert.Equal(t, "Pod default/webBcc: someone@example.com "+string(messages.RulesetRuleTypeCreated), summary(event))
+}
@@ -0,0 +1,156 @@
+package switchboard
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/smtp"
+	"strings"
+	"time"
+
+	"github.com/NorskHelsenett/ror-api/internal/models/switchboardmodels"
+	"github.com/NorskHelsenett/ror-api/pkg/helpers/publichttp"
+
+	"github.com/NorskHelsenett/ror/pkg/apicontracts/messages"
+	"github.com/NorskHelsenett/ror/pkg/config/rorconfig"
+)
+
+const sendTimeout = 10 * time.Second
+
+// errPermanent is wrapped by the errors of deliveries retrying cannot make
+// succeed.
+var errPermanent = errors.New("permanent delivery failure")
+
+type sender struct {
+	client *http.Client
+}
+
+func newSender() *sender {
+	return &sender{client: publichttp.NewClient(sendTimeout)}
+}
+
+// send sends the delivery by the service of its rule.
+func (s *sender) send(ctx context.Context, delivery switchboardmodels.Delivery) error {
+	switch delivery.Service {
+	case messages.RulesetServiceTypeSlack:
+		return s.sendSlack(ctx, delivery)
+	case switchboardmodels.ServiceTypeWebhook:
+		return s.sendWebhook(ctx, delivery)
+	case switchboardmodels.ServiceTypeEmail:
+		return sendEmail(delivery)
+	default:
+		return fmt.Errorf("%w: the %q service is not supported", errPermanent, delivery.Service)
+	}
+}
+
+// sendSlack posts the summary of the event to the channel of the rule through
+// the SWITCHBOARD_SLACK_WEBHOOK_URL incoming webhook.
+func (s *sender) sendSlack(ctx context.Context, delivery switchboardmodels.Delivery) error {
+	webhookUrl := rorconfig.GetString("SWITCHBOARD_SLACK_WEBHOOK_URL")
+	if webhookUrl == "" {
+		return fmt.Errorf("%w: SWITCHBOARD_SLACK_WEBHOOK_URL is not set", errPermanent)
+	}
+
+	message := map[string]string{
+		"channel": delivery.Rule.Slack.ChannelId,
+		"text":    summary(delivery.Event),
+	}
+	return s.post(ctx, webhookUrl, message, nil)
+}
+
+// sendWebhook posts the event to the webhook url of the rule.
+func (s *sender) sendWebhook(ctx context.Context, delivery switchboardmodels.Delivery) error {
+	if delivery.Rule.Webhook == nil || delivery.Rule.Webhook.Url == "" {
+		return fmt.Errorf("%w: the rule has no webhook url", errPermanent)
+	}
+	headers := map[string]string{"X-Ror-Delivery": delivery.Id}
+	return s.post(ctx, delivery.Rule.Webhook.Url, delivery.Event, headers)
+}
+
+func (s *sender) post(ctx context.Context, url string, payload any, headers map[string]string) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("%w: could not marshal payload: %w", errPermanent, err)
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("%w: could not create request: %w", errPermanent, err)
+	}
+	request.Header.Set("Content-Type", "application/json")
+	for key, value := range headers {
+		request.Header.Set(key, value)
+	}
+
+	response, err := s.client.Do(request)
+	if err != nil {
+		return fmt.Errorf("could not post notification: %w", err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return fmt.Errorf("notification rejected with status %d", response.StatusCode)
+	}
+	return nil
+}
+
+// sendEmail mails the summary of the event to the recipients of the rule
+// through the SMTP server.
+func sendEmail(delivery switchboardmodels.Delivery) error {
+	if delivery.Rule.Email == nil || len(delivery.Rule.Email.To) == 0 {
+		return fmt.Errorf("%w: the rule has no recipients", errPermanent)
+	}
+	host := rorconfig.GetString("SMTP_HOST")
+	from := rorconfig.GetString("SMTP_FROM")
+	if host == "" || from == "" {
+		return fmt.Errorf("%w: SMTP_HOST and SMTP_FROM must be set", errPermanent)
+	}
+
+	var auth smtp.Auth
+	if username := rorconfig.GetString("SMTP_USERNAME"); username != "" {
+		auth = smtp.PlainAuth("", username, rorconfig.GetString("SMTP_PASSWORD"), host)
+	}
+
+	text := summary(delivery.Event)
+	message := "From: " + from + "\r\n" +
+		"To: " + strings.Join(delivery.Rule.Email.To, ", ") + "\r\n" +
+		"Subject: [ROR] " + text + "\r\n" +
+		"Content-Type: text/plain; charset=utf-8\r\n" +
+		"\r\n" +
+		text + "\r\n"
+
+	addr := net.JoinHostPort(host, rorconfig.GetString("SMTP_PORT"))
+	if err := smtp.SendMail(addr, auth, from, delivery.Rule.Email.To, []byte(message)); err != nil {
+		return fmt.Errorf("could not send email: %w", err)
+	}
+	return nil
+}
+
+// summary returns a line describing the event. Line breaks are removed, as
+// the line is used as the subject header of emails and the fields come from
+// the reported resource.
+func summary(event switchboardmodels.Event) string {
+	var b strings.Builder
+	b.WriteString(event.Kind)
+	if event.Name != "" {
+		b.WriteString(" ")
+		if event.Namespace != "" {
+			b.WriteString(event.Namespace + "/")
+		}
+		b.WriteString(event.Name)
+	} else if event.Uid != "" {
+		b.WriteString(" " + event.Uid)
+	}
+	b.WriteString(" " + string(event.Type))
+	if event.Owner != "" {
+		b.WriteString(" on " + event.Owner)
+	}
+	if hostname := event.Attributes["hostname"]; hostname != "" {
+		b.WriteString(" on " + hostname)
+	}
+	return strings.NewReplacer("\r", "", "\n", "").Replace(b.String())
+}
@@ -1,49 +1,198 @@
+// Package switchboard notifies about resource events by the rules of the
+// rulesets. Resource events are consumed from the message bus, matched
+// against the rulesets and stored as deliveries, which are sent to Slack,
+// webhooks or email and retried with backoff until they are delivered or
+// have used their attempts.
 package switchboard
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	mongorulesets "github.com/NorskHelsenett/ror-api/internal/databases/mongodb/repositories/rulesets"
+	"github.com/NorskHelsenett/ror-api/internal/databases/mongodb/repositories/switchboarddeliveries"
+	"github.com/NorskHelsenett/ror-api/internal/models/switchboardmodels"
 
 	"github.com/NorskHelsenett/ror/pkg/apicontracts/apiresourcecontracts"
 	"github.com/NorskHelsenett/ror/pkg/apicontracts/messages"
+	"github.com/NorskHelsenett/ror/pkg/clients/rabbitmqclient"
+	aclmodels "github.com/NorskHelsenett/ror/pkg/models/aclmodels"
+	"github.com/NorskHelsenett/ror/pkg/rlog"
+
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+const (
+	// rulesetsRefreshInterval is how long the rulesets are matched against
+	// before they are read again, claimed oneshot rules are read at once.
+	rulesetsRefreshInterval = 10 * time.Second
 )
 
+var rulesetsCache struct {
+	lock     sync.Mutex
+	rulesets []switchboardmodels.Ruleset
+	loadedAt time.Time
+}
+
+// Start consumes the resource events of the message bus and sends the
+// deliveries until the context is done.
+func Start(ctx context.Context, connection rabbitmqclient.RabbitMQConnection) {
+	startConsumer(connection)
+	startDispatcher(ctx)
+}
+
+// PublishStarted notifies about ror-api having started by the started rules
+// of the internal ruleset.
 func PublishStarted(ctx context.Context) {
-	// hostname, _ := os.Hostname()
-
-	// message := messagebuscontracts.SwitchboardPost{
-	// 	Source: messagebuscontracts.SwitchboardSource{
-	// 		Type:      messagebuscontracts.SwitchboardSourceTypeRor,
-	// 		ClusterId: "ror",
-	// 		Uid:       "ror-api",
-	// 	},
-	// 	Event:    messages.RulesetRuleTypeStarted,
-	// 	Severity: "info",
-	// 	Attributes: map[string]string{
-	// 		"hostname": hostname,
-	// 	},
-	// }
-
-	//err := apiconfig.RabbitMQConnection.SendMessage(ctx, message, messagebuscontracts.Workqueue_Switchboard_Post)
-	// if err != nil {
-	// 	rlog.Errorc(ctx, "could not publish started message", err)
-	// }
+	hostname, _ := os.Hostname()
+
+	event := switchboardmodels.Event{
+		Type: messages.RulesetRuleTypeStarted,
+		Uid:  "ror-api",
+		Kind: "ror-api",
+		Attributes: map[string]string{
+			"hostname": hostname,
+		},
+		Time: time.Now(),
+	}
+
+	if err := dispatch(ctx, event, ""); err != nil {
+		rlog.Errorc(ctx, "could not publish started message", err)
+	}
 }
 
+// PublishResourceToSwitchboard notifies about the resource event by the rules
+// triggered by it.
 func PublishResourceToSwitchboard(ctx context.Context, rule messages.RulesetRuleType, input apiresourcecontracts.ResourceUpdateModel) error {
-	// post := messagebuscontracts.SwitchboardPost{
-	// 	Source: messagebuscontracts.SwitchboardSource{
-	// 		Type:      messagebuscontracts.SwitchboardSourceTypeCluster,
-	// 		ClusterId: input.Owner.Subject,
-
-	// 		Uid:        input.Uid,
-	// 		ApiVersion: input.ApiVersion,
-	// 		Kind:       input.Kind,
-	// 		Namespace:  "default",
-	// 	},
-	// 	Severity: messagebuscontracts.SwitchboardPostSeverityInfo,
-	// 	Event:    rule,
-	// }
-
-	//err := apiconfig.RabbitMQConnection.SendMessage(ctx, post, messagebuscontracts.Workqueue_Switchboard_Post)
-	return nil //err
+	return dispatch(ctx, resourceEvent(rule, input), "")
+}
+
+// resourceEvent returns the event of the resource update.
+func resourceEvent(rule messages.RulesetRuleType, input apiresourcecontracts.ResourceUpdateModel) switchboardmodels.Event {
+	name, namespace := objectMeta(input.Resource)
+	return switchboardmodels.Event{
+		Type:       rule,
+		Owner:      input.Owner.Subject,
+		Uid:        input.Uid,
+		ApiVersion: input.ApiVersion,
+		Kind:       input.Kind,
+		Name:       name,
+		Namespace:  namespace,
+		Time:       time.Now(),
+	}
+}
+
+// objectMeta returns the name and namespace from the metadata of the resource.
+func objectMeta(resource any) (string, string) {
+	if resource == nil {
+		return "", ""
+	}
+	b, err := json.Marshal(resource)
+	if err != nil {
+		return "", ""
+	}
+	var object struct {
+		Metadata struct {
+			Name      string `json:"name"`
+			Namespace string `json:"namespace"`
+		} `json:"metadata"`
+	}
+	if err := json.Unmarshal(b, &object); err != nil {
+		return "", ""
+	}
+	return object.Metadata.Name, object.Metadata.Namespace
+}
+
+// dispatch stores a delivery for each rule triggered by the event. Oneshot
+// rules are removed from their ruleset when they trigger, so they trigger
+// once across replicas. The message id makes the deliveries of a message
+// redelivered by the message bus stored once.
+func dispatch(ctx context.Context, event switchboardmodels.Event, messageId string) error {
+	rulesets, err := getRulesets(ctx)
+	if err != nil {
+		return fmt.Errorf("could not get rulesets: %w", err)
+	}
+
+	var errs []error
+	for _, match := range matchRules(rulesets, event, aclmodels.ClusterIdToUidResolver) {
+		if match.rule.Service == messages.RulesetServiceTypeIgnore {
+			continue
+		}
+
+		if match.rule.Lifetime == messages.RulesetLifetimeTypeOneshot {
+			claimed, err := mongorulesets.ClaimResourceRule(ctx, match.ruleset.Id, match.resource.Id, match.rule.Id)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			invalidateRulesets()
+			if !claimed {
+				continue
+			}
+		}
+
+		if err := enqueue(ctx, match, event, messageId); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	notifyDispatcher()
+	return errors.Join(errs...)
+}
+
+func enqueue(ctx context.Context, match match, event switchboardmodels.Event, messageId string) error {
+	id := uuid.NewString()
+	if messageId != "" {
+		id = uuid.NewSHA1(uuid.NameSpaceOID, []byte(messageId+"/"+match.rule.Id)).String()
+	}
+
+	now := time.Now()
+	delivery := &switchboardmodels.Delivery{
+		Id:            id,
+		RulesetId:     match.ruleset.Id.Hex(),
+		ResourceId:    match.resource.Id,
+		RuleId:        match.rule.Id,
+		Service:       match.rule.Service,
+		Rule:          *match.rule,
+		Event:         event,
+		Status:        switchboardmodels.DeliveryStatusPending,
+		CreatedAt:     now,
+		NextAttemptAt: now,
+		ClaimedUntil:  now,
+	}
+
+	err := switchboarddeliveries.Create(ctx, delivery)
+	if mongo.IsDuplicateKeyError(err) {
+		return nil
+	}
+	return err
+}
+
+// getRulesets returns the rulesets, read again when they are older than the
+// refresh interval.
+func getRulesets(ctx context.Context) ([]switchboardmodels.Ruleset, error) {
+	rulesetsCache.lock.Lock()
+	defer rulesetsCache.lock.Unlock()
+	if rulesetsCache.rulesets != nil && time.Since(rulesetsCache.loadedAt) < rulesetsRefreshInterval {
+		return rulesetsCache.rulesets, nil
+	}
+
+	rulesets, err := mongorulesets.FindAllRules(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rulesetsCache.rulesets = rulesets
+	rulesetsCache.loadedAt = time.Now()
+	return rulesets, nil
+}
+
+func invalidateRulesets() {
+	rulesetsCache.lock.Lock()
+	defer rulesetsCache.lock.Unlock()
+	rulesetsCache.loadedAt = time.Time{}
 }
@@ -100,10 +100,23 @@ func startHttpServer(ctx context.Context) error {
 		ReadHeaderTimeout: 10 * time.Second,
 	}
 
+	tlsEnabled := rorconfig.GetBool("TLS_ENABLED")
+	if tlsEnabled {
+		httpServ.TLSConfig, err = tlsConfig()
+		if err != nil {
+			rlog.Error("could not configure tls", err)
+			return err
+		}
+	}
+
 	chanHttpErr := make(chan error)
 
 	go func() {
-		err = httpServ.ListenAndServe()
+		if tlsEnabled {
+			err = httpServ.ListenAndServeTLS(rorconfig.GetString("TLS_CERT_FILE"), rorconfig.GetString("TLS_KEY_FILE"))
+		} else {
+			err = httpServ.ListenAndServe()
+		}
 		if err != nil {
 			if !errors.Is(err, http.ErrServerClosed) {
 				chanHttpErr <- err
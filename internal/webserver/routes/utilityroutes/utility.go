@@ -1,7 +1,10 @@
 package utilityroutes
 
 import (
+	"github.com/NorskHelsenett/ror-api/internal/controllers/metricscontroller"
+
 	"github.com/NorskHelsenett/ror-api/pkg/handlers/healthginhandler"
+	"github.com/NorskHelsenett/ror-api/pkg/middelware/authmiddleware"
 
 	"github.com/NorskHelsenett/ror/pkg/config/rorversion"
 
@@ -19,6 +22,8 @@ func SetupRoutes(router *gin.Engine) error {
 
 	router.GET("/health", healthginhandler.GetGinHandler())
 	router.GET("/metrics", gin.WrapH(promhttp.HandlerFor(prometheus.DefaultGatherer, promhttp.HandlerOpts{EnableOpenMetrics: true})))
+	// Fleet inventory for dashboards, authenticated and gathered on scrape
+	router.GET("/metrics/fleet", authmiddleware.AuthenticationMiddleware, metricscontroller.GetFleetMetrics())
 
 	docs.SwaggerInfo.BasePath = "/"
 	docs.SwaggerInfo.Version = rorversion.GetRorVersion().GetVersion()
@@ -17,6 +17,8 @@ func v1ClustersRoutes(v1 *gin.RouterGroup) {
 		clustersRoute.GET("/:clusterid/exists", clusterscontroller.ClusterExistsById())
 		clustersRoute.PATCH("/:clusterid/metadata", clusterscontroller.UpdateMetadata())
 		clustersRoute.DELETE("/uid/:uid", clusterscontroller.DeleteClusterByUid())
+		clustersRoute.POST("/uid/:uid/restore", clusterscontroller.RestoreClusterByUid())
+		clustersRoute.GET("/pendingpurge", clusterscontroller.GetPendingPurges())
 
 		clustersRoute.GET("/:clusterid/views/policyreports", clusterscontroller.PolicyreportsView())
 		clustersRoute.GET("/:clusterid/views/vulnerabilityreports", clusterscontroller.VulnerabilityReportsView())
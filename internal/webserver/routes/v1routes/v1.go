@@ -14,6 +14,7 @@ import (
 	"github.com/NorskHelsenett/ror-api/internal/controllers/metricscontroller"
 	"github.com/NorskHelsenett/ror-api/internal/controllers/operatorconfigscontroller"
 	"github.com/NorskHelsenett/ror-api/internal/controllers/ordercontroller"
+	"github.com/NorskHelsenett/ror-api/internal/controllers/orderpoliciescontroller"
 	"github.com/NorskHelsenett/ror-api/internal/controllers/pricescontroller"
 	"github.com/NorskHelsenett/ror-api/internal/controllers/projectscontroller"
 	"github.com/NorskHelsenett/ror-api/internal/controllers/providerscontroller"
@@ -54,6 +55,13 @@ func SetupRoutes(router *gin.Engine) error {
 		timeoutduration = defaultV1Timeout
 	}
 
+	budgets, err := rorratelimiter.ParseBudgets(rorconfig.GetString("RATELIMIT_V1_RESOURCE_BUDGETS"))
+	if err != nil {
+		rlog.Warn("Could not parse rate limit budgets, using the default budget for all identities", rlog.String("error", err.Error()))
+	} else {
+		resourceV1rorratelimiter.SetBudgets(budgets)
+	}
+
 	// events route
 	// No timeout for SSE connections
 	eventsRoute := router.Group("/v1/events",
@@ -136,8 +144,24 @@ func SetupRoutes(router *gin.Engine) error {
 		ordersRoute.POST("/cluster", ordercontroller.OrderCluster())
 		ordersRoute.DELETE("/cluster", ordercontroller.DeleteCluster())
 		ordersRoute.GET("", ordercontroller.GetOrders())
+		ordersRoute.GET("/approvals", ordercontroller.GetOrdersAwaitingApproval())
 		ordersRoute.GET("/:uid", ordercontroller.GetOrder())
 		ordersRoute.DELETE("/:uid", ordercontroller.DeleteOrder())
+		ordersRoute.GET("/:uid/lifecycle", ordercontroller.GetOrderLifecycle())
+		ordersRoute.POST("/:uid/cancel", ordercontroller.CancelOrder(), auditmiddleware.AuditLogMiddleware("Cluster order cancelled", models.AuditCategoryClusterOrder, models.AuditActionUpdate))
+		ordersRoute.POST("/:uid/retry", ordercontroller.RetryOrder(), auditmiddleware.AuditLogMiddleware("Cluster order retried", models.AuditCategoryClusterOrder, models.AuditActionUpdate))
+		ordersRoute.POST("/:uid/approve", ordercontroller.ApproveOrder(), auditmiddleware.AuditLogMiddleware("Cluster order approved", models.AuditCategoryClusterOrder, models.AuditActionUpdate))
+		ordersRoute.POST("/:uid/reject", ordercontroller.RejectOrder(), auditmiddleware.AuditLogMiddleware("Cluster order rejected", models.AuditCategoryClusterOrder, models.AuditActionUpdate))
+	}
+
+	orderPoliciesRoute := v1.Group("orderpolicies")
+	{
+		orderPoliciesRoute.GET("/quotas", orderpoliciescontroller.GetQuotas())
+		orderPoliciesRoute.PUT("/quotas/:scope/:subjectId", orderpoliciescontroller.SetQuota(), auditmiddleware.AuditLogMiddleware("Order quota set", models.AuditCategoryOrderPolicy, models.AuditActionUpdate))
+		orderPoliciesRoute.DELETE("/quotas/:scope/:subjectId", orderpoliciescontroller.DeleteQuota(), auditmiddleware.AuditLogMiddleware("Order quota deleted", models.AuditCategoryOrderPolicy, models.AuditActionDelete))
+		orderPoliciesRoute.GET("/rules", orderpoliciescontroller.GetApprovalRules())
+		orderPoliciesRoute.PUT("/rules/:name", orderpoliciescontroller.SetApprovalRule(), auditmiddleware.AuditLogMiddleware("Order approval rule set", models.AuditCategoryOrderPolicy, models.AuditActionUpdate))
+		orderPoliciesRoute.DELETE("/rules/:name", orderpoliciescontroller.DeleteApprovalRule(), auditmiddleware.AuditLogMiddleware("Order approval rule deleted", models.AuditCategoryOrderPolicy, models.AuditActionDelete))
 	}
 
 	metricsRoute := v1.Group("metrics")
@@ -174,6 +198,7 @@ func SetupRoutes(router *gin.Engine) error {
 	{
 		providerRouter.GET("", providerscontroller.GetAll())
 		providerRouter.GET("/:providerType/kubernetes/versions", providerscontroller.GetKubernetesVersionByProvider())
+		providerRouter.GET("/:providerType/configs/params", providerscontroller.GetConfigParametersByProvider())
 	}
 
 	pricesRoute := v1.Group("prices")
@@ -248,6 +273,7 @@ func SetupRoutes(router *gin.Engine) error {
 
 		rulesetsRoute.GET("/cluster/:clusterId", rulesetscontroller.GetByCluster())
 		rulesetsRoute.GET("/internal", rulesetscontroller.GetInternal())
+		rulesetsRoute.GET("/:rulesetId/deliveries", rulesetscontroller.GetDeliveries())
 
 		rulesetsRoute.PUT("/:rulesetId/resources", rulesetscontroller.AddResource())
 
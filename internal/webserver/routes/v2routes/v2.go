@@ -5,12 +5,19 @@ import (
 
 	"github.com/NorskHelsenett/ror-api/internal/controllers/apikeyscontroller/v2"
 	"github.com/NorskHelsenett/ror-api/internal/controllers/v2/aclcontroller"
+	"github.com/NorskHelsenett/ror-api/internal/controllers/v2/certificatescontroller"
+	"github.com/NorskHelsenett/ror-api/internal/controllers/v2/costscontroller"
+	"github.com/NorskHelsenett/ror-api/internal/controllers/v2/migrationscontroller"
 	"github.com/NorskHelsenett/ror-api/internal/controllers/v2/resourcescontroller"
 	"github.com/NorskHelsenett/ror-api/internal/controllers/v2/tokencontroller"
 	"github.com/NorskHelsenett/ror-api/internal/controllers/v2/viewcontroller"
+	"github.com/NorskHelsenett/ror-api/internal/controllers/v2/webhookscontroller"
+
+	"github.com/NorskHelsenett/ror-api/internal/models"
 
 	"github.com/NorskHelsenett/ror-api/pkg/handlers/ssehandler"
 
+	"github.com/NorskHelsenett/ror-api/pkg/middelware/auditmiddleware"
 	"github.com/NorskHelsenett/ror-api/pkg/middelware/authmiddleware"
 	"github.com/NorskHelsenett/ror-api/pkg/middelware/rorratelimiter"
 	"github.com/NorskHelsenett/ror-api/pkg/middelware/ssemiddleware"
@@ -38,13 +45,29 @@ func SetupRoutes(router *gin.Engine) error {
 		timeoutduration = defaultV2Timeout
 	}
 
+	budgets, err := rorratelimiter.ParseBudgets(rorconfig.GetString("RATELIMIT_V2_RESOURCE_BUDGETS"))
+	if err != nil {
+		rlog.Warn("Could not parse rate limit budgets, using the default budget for all identities", rlog.String("error", err.Error()))
+	} else {
+		resourceV2rorratelimiter.SetBudgets(budgets)
+	}
+
 	// V2 Events no default timeout in SSE
 	v2eventsRoute := router.Group("/v2/events", authmiddleware.AuthenticationMiddleware)
 	setupV2EventsRoute(v2eventsRoute)
 
+	// V2 resource watch, long lived stream without the default timeout
+	router.GET("/v2/resources/watch",
+		authmiddleware.AuthenticationMiddleware,
+		resourceV2rorratelimiter.RateLimiter,
+		ssemiddleware.SSEHeadersMiddlewareV2(),
+		resourcescontroller.WatchResources(),
+	)
+
 	// apikeys register agent . unauthenticated
 	router.POST("/v2/apikeys/register/agent", apikeyscontroller.RegisterAgent())
 	router.GET("/v2/token/jwks", tokencontroller.GetJwks())
+	router.GET("/v2/certificates/ca", certificatescontroller.GetCaCertificate())
 
 	// V2 routes
 	v2 := router.Group("/v2",
@@ -58,6 +81,9 @@ func SetupRoutes(router *gin.Engine) error {
 	selfv2Route.POST("/apikeys", handlerv2selfcontroller.CreateOrRenewApikey())
 	selfv2Route.DELETE("/apikeys/:id", handlerv2selfcontroller.DeleteApiKey())
 
+	apikeysv2Route := v2.Group("apikeys")
+	apikeysv2Route.PUT("/agent/serviceaccountissuer", apikeyscontroller.UpdateServiceAccountIssuer(), auditmiddleware.AuditLogMiddleware("Service account issuer updated", models.AuditCategoryApikey, models.AuditActionUpdate))
+
 	setupV2ResourcesRoute(v2)
 
 	viewsRoute := v2.Group("views")
@@ -70,10 +96,46 @@ func SetupRoutes(router *gin.Engine) error {
 		tokenroute.POST("/exchange", tokencontroller.ExchangeToken())
 	}
 
+	certificatesroute := v2.Group("/certificates")
+	{
+		certificatesroute.POST("/renew", certificatescontroller.RenewCertificate())
+	}
+
 	aclroute := v2.Group("/acl")
 	{
 		aclroute.GET("/lookup", aclcontroller.LookupAcl())
 	}
+
+	costsroute := v2.Group("/costs")
+	{
+		costsroute.GET("/chargeback", costscontroller.GetChargebackReport())
+		costsroute.GET("/clusters/:uid", costscontroller.GetClusterCost())
+		costsroute.GET("/workspaces/:workspace", costscontroller.GetWorkspaceCost())
+		costsroute.GET("/projects/:project", costscontroller.GetProjectCost())
+	}
+
+	pricecatalogueroute := v2.Group("/pricecatalogue")
+	{
+		pricecatalogueroute.GET("", costscontroller.GetPriceItems())
+		pricecatalogueroute.POST("", costscontroller.CreatePriceItem(), auditmiddleware.AuditLogMiddleware("Price item created", models.AuditCategoryPrice, models.AuditActionCreate))
+		pricecatalogueroute.PUT("/:id", costscontroller.UpdatePriceItem(), auditmiddleware.AuditLogMiddleware("Price item updated", models.AuditCategoryPrice, models.AuditActionUpdate))
+		pricecatalogueroute.DELETE("/:id", costscontroller.DeletePriceItem(), auditmiddleware.AuditLogMiddleware("Price item deleted", models.AuditCategoryPrice, models.AuditActionDelete))
+	}
+
+	webhooksroute := v2.Group("/webhooks")
+	{
+		webhooksroute.GET("", webhookscontroller.GetWebhooks())
+		webhooksroute.POST("", webhookscontroller.CreateWebhook(), auditmiddleware.AuditLogMiddleware("Webhook registered", models.AuditCategoryWebhook, models.AuditActionCreate))
+		webhooksroute.GET("/:id", webhookscontroller.GetWebhook())
+		webhooksroute.DELETE("/:id", webhookscontroller.DeleteWebhook(), auditmiddleware.AuditLogMiddleware("Webhook deleted", models.AuditCategoryWebhook, models.AuditActionDelete))
+		webhooksroute.GET("/:id/deliveries", webhookscontroller.GetWebhookDeliveries())
+	}
+
+	adminroute := v2.Group("/admin")
+	{
+		adminroute.GET("/migrations", migrationscontroller.GetMigrations())
+		adminroute.POST("/migrations/run", migrationscontroller.RunMigrations())
+	}
 	return nil
 }
 
@@ -82,8 +144,11 @@ func setupV2ResourcesRoute(v2 *gin.RouterGroup) {
 	resourceRoute.Use(resourceV2rorratelimiter.RateLimiter)
 	resourceRoute.GET("", resourcescontroller.GetResources())
 	resourceRoute.POST("", resourcescontroller.NewResource())
+	resourceRoute.POST("/batch", resourcescontroller.NewResourceBatch())
+	resourceRoute.GET("/aggregate", resourcescontroller.AggregateResources())
 	resourceRoute.GET("/hashes", resourcescontroller.GetResourceHashList())
 	resourceRoute.GET("/uid/:uid", resourcescontroller.GetResource())
+	resourceRoute.GET("/uid/:uid/history", resourcescontroller.GetResourceHistory())
 	resourceRoute.PUT("/uid/:uid", resourcescontroller.UpdateResource())
 	resourceRoute.PATCH("/uid/:uid", resourcescontroller.PatchResource())
 	resourceRoute.DELETE("/uid/:uid", resourcescontroller.DeleteResource())
@@ -93,4 +158,6 @@ func setupV2ResourcesRoute(v2 *gin.RouterGroup) {
 func setupV2EventsRoute(v2eventsRoute *gin.RouterGroup) {
 	v2eventsRoute.GET("listen", ssemiddleware.SSEHeadersMiddlewareV2(), ssehandler.HandleSSE())
 	v2eventsRoute.POST("send", timeoutmiddleware.TimeoutMiddleware(timeoutduration), ssehandler.Send())
+	v2eventsRoute.POST("subscribe", timeoutmiddleware.TimeoutMiddleware(timeoutduration), ssehandler.Subscribe())
+	v2eventsRoute.POST("unsubscribe", timeoutmiddleware.TimeoutMiddleware(timeoutduration), ssehandler.Unsubscribe())
 }
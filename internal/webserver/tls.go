@@ -0,0 +1,46 @@
+package webserver
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/NorskHelsenett/ror-api/internal/apiservices/certificatesservice"
+
+	"github.com/NorskHelsenett/ror/pkg/config/rorconfig"
+)
+
+// tlsConfig returns the tls configuration of the web server. Client
+// certificates signed by the certificate authority of ror-api or by the
+// authorities of TLS_CLIENT_CA_FILE are verified when they are sent, they are
+// not required as most clients authenticate with tokens or api keys.
+func tlsConfig() (*tls.Config, error) {
+	if rorconfig.GetString("TLS_CERT_FILE") == "" || rorconfig.GetString("TLS_KEY_FILE") == "" {
+		return nil, errors.New("TLS_CERT_FILE and TLS_KEY_FILE are required when TLS_ENABLED is set")
+	}
+
+	clientCas := x509.NewCertPool()
+	verifyClients := false
+	if caCertificate, err := certificatesservice.GetCaCertificate(); err == nil {
+		verifyClients = clientCas.AppendCertsFromPEM([]byte(caCertificate))
+	}
+	if file := rorconfig.GetString("TLS_CLIENT_CA_FILE"); file != "" {
+		bundle, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("could not read TLS_CLIENT_CA_FILE: %w", err)
+		}
+		if !clientCas.AppendCertsFromPEM(bundle) {
+			return nil, errors.New("TLS_CLIENT_CA_FILE has no certificates")
+		}
+		verifyClients = true
+	}
+
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+	if verifyClients {
+		config.ClientAuth = tls.VerifyClientCertIfGiven
+		config.ClientCAs = clientCas
+	}
+	return config, nil
+}
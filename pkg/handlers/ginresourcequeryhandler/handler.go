@@ -8,6 +8,7 @@ import (
 	"strconv"
 	"strings"
 
+	"github.com/NorskHelsenett/ror-api/pkg/helpers/rorqueryfilter"
 	"github.com/NorskHelsenett/ror/pkg/models/aclmodels/rorresourceowner"
 	"github.com/NorskHelsenett/ror/pkg/rorresources"
 	"github.com/gin-gonic/gin"
@@ -26,6 +27,10 @@ import (
 // - filters: JSON array of filter objects [{"field":"field1","value":"value1","type":"string","operator":"eq"}]
 // - offset: Starting offset for pagination
 // - limit: Maximum number of results to return
+//
+// Filters with operator in or nin take "values": ["a","b"], time values are
+// RFC 3339 timestamps and {"or": [[filters...], [filters...]]} matches if all
+// filters of any group match.
 func ParseGinResourceQuery(c *gin.Context) (*rorresources.ResourceQuery, error) {
 	// Initialize a new resource query
 	rq := rorresources.NewResourceQuery()
@@ -103,10 +108,9 @@ func ParseGinResourceQuery(c *gin.Context) (*rorresources.ResourceQuery, error)
 
 	// Parse Filters
 	if filters := c.Query("filters"); filters != "" {
-		var filterList []rorresources.ResourceQueryFilter
-		err := json.Unmarshal([]byte(filters), &filterList)
+		filterList, err := ParseFilters([]byte(filters))
 		if err != nil {
-			return nil, fmt.Errorf("could not unmarshal filters: %w", err)
+			return nil, err
 		}
 
 		rq.Filters = filterList
@@ -159,3 +163,76 @@ func ParseResourceQueryFromURL(urlStr string) (*rorresources.ResourceQuery, erro
 
 	return query, err
 }
+
+// queryFilter is a filter as written in the filters query parameter, Values
+// holds the values of in and nin filters and Or the groups of an OR filter.
+type queryFilter struct {
+	Field    string                      `json:"field"`
+	Value    string                      `json:"value"`
+	Values   []string                    `json:"values"`
+	Type     rorresources.FilterType     `json:"type"`
+	Operator rorresources.FilterOperator `json:"operator"`
+	Or       []json.RawMessage           `json:"or"`
+}
+
+// ParseFilters parses and validates a JSON array of filters. It returns an
+// error wrapping rorqueryfilter.ErrInvalidFilter when a filter is malformed or
+// its operator does not fit its type.
+func ParseFilters(data []byte) ([]rorresources.ResourceQueryFilter, error) {
+	return parseFilters(data, 0)
+}
+
+func parseFilters(data []byte, depth int) ([]rorresources.ResourceQueryFilter, error) {
+	var input []queryFilter
+	if err := json.Unmarshal(data, &input); err != nil {
+		return nil, fmt.Errorf("could not unmarshal filters: %w", err)
+	}
+
+	filters := make([]rorresources.ResourceQueryFilter, 0, len(input))
+	for _, item := range input {
+		filter, err := item.toFilter(depth)
+		if err != nil {
+			return nil, err
+		}
+		if err := rorqueryfilter.Validate(filter); err != nil {
+			return nil, err
+		}
+		filters = append(filters, filter)
+	}
+	return filters, nil
+}
+
+func (f queryFilter) toFilter(depth int) (rorresources.ResourceQueryFilter, error) {
+	if f.Or != nil {
+		if depth >= rorqueryfilter.MaxGroupDepth {
+			return rorresources.ResourceQueryFilter{}, fmt.Errorf("%w: or groups nested deeper than %d", rorqueryfilter.ErrInvalidFilter, rorqueryfilter.MaxGroupDepth)
+		}
+		groups := make([][]rorresources.ResourceQueryFilter, 0, len(f.Or))
+		for _, raw := range f.Or {
+			group, err := parseFilters(raw, depth+1)
+			if err != nil {
+				return rorresources.ResourceQueryFilter{}, err
+			}
+			groups = append(groups, group)
+		}
+		return rorqueryfilter.NewOrGroup(groups)
+	}
+
+	filter := rorresources.ResourceQueryFilter{
+		Field:    f.Field,
+		Value:    f.Value,
+		Type:     f.Type,
+		Operator: f.Operator,
+	}
+	if filter.Type == "" {
+		filter.Type = rorresources.FilterTypeString
+	}
+	if rorqueryfilter.IsSetOperator(f.Operator) && f.Values != nil {
+		values, err := json.Marshal(f.Values)
+		if err != nil {
+			return rorresources.ResourceQueryFilter{}, fmt.Errorf("could not encode filter values: %w", err)
+		}
+		filter.Value = string(values)
+	}
+	return filter, nil
+}
@@ -4,6 +4,7 @@ import (
 	"net/http/httptest"
 	"testing"
 
+	"github.com/NorskHelsenett/ror-api/pkg/helpers/rorqueryfilter"
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
 )
@@ -81,6 +82,36 @@ func TestParseResourceQueryFromURL(t *testing.T) {
 	assert.Equal(t, 50, query.Limit)
 }
 
+func TestParseFilters(t *testing.T) {
+	tests := []struct {
+		name    string
+		filters string
+		wantErr bool
+	}{
+		{name: "string eq", filters: `[{"field":"status","value":"Running","type":"string","operator":"eq"}]`},
+		{name: "time range", filters: `[{"field":"metadata.creationtimestamp.time","value":"2024-01-01T00:00:00Z","type":"time","operator":"ge"},{"field":"metadata.creationtimestamp.time","value":"2024-02-01T00:00:00Z","type":"time","operator":"lt"}]`},
+		{name: "in with values", filters: `[{"field":"status","values":["Running","Pending"],"type":"string","operator":"in"}]`},
+		{name: "exists without value", filters: `[{"field":"metadata.labels","type":"string","operator":"exists"}]`},
+		{name: "or groups", filters: `[{"or":[[{"field":"status","value":"Running","type":"string","operator":"eq"}],[{"field":"replicas","value":"0","type":"int","operator":"gt"}]]}]`},
+		{name: "invalid time", filters: `[{"field":"metadata.creationtimestamp.time","value":"yesterday","type":"time","operator":"gt"}]`, wantErr: true},
+		{name: "regexp on time", filters: `[{"field":"metadata.creationtimestamp.time","value":"2024","type":"time","operator":"regexp"}]`, wantErr: true},
+		{name: "gt on bool", filters: `[{"field":"enabled","value":"true","type":"bool","operator":"gt"}]`, wantErr: true},
+		{name: "in without values", filters: `[{"field":"status","type":"string","operator":"in"}]`, wantErr: true},
+		{name: "empty or group", filters: `[{"or":[[]]}]`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseFilters([]byte(tt.filters))
+			if tt.wantErr {
+				assert.ErrorIs(t, err, rorqueryfilter.ErrInvalidFilter)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
 // // Example handler that demonstrates how to use the parser in a Gin handler function
 // func ExampleHandler(c *gin.Context) {
 // 	query := ParseResourceQuery(c)
@@ -1,17 +1,22 @@
 package ssehandler
 
 import (
+	"fmt"
 	"io"
 	"net/http"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/NorskHelsenett/ror-api/internal/acl/aclservice"
 	"github.com/NorskHelsenett/ror-api/internal/apiconnections"
 	"github.com/NorskHelsenett/ror-api/pkg/services/sseservice"
 
 	"github.com/NorskHelsenett/ror-api/pkg/helpers/gincontext"
 	"github.com/NorskHelsenett/ror-api/pkg/helpers/rorginerror"
 	"github.com/NorskHelsenett/ror/pkg/context/rorcontext"
+	"github.com/NorskHelsenett/ror/pkg/models/aclmodels"
+	"github.com/NorskHelsenett/ror/pkg/models/aclmodels/rorresourceowner"
 
 	"github.com/gin-gonic/gin"
 )
@@ -27,6 +32,8 @@ import (
 // @Failure		400					{object}	rorerror.ErrorData
 // @Failure		401					{object}	rorerror.ErrorData
 // @Failure		500					{object}	rorerror.ErrorData
+// @Param			topics				query		string	false	"Comma separated topics to subscribe to, e.g. resource/KubernetesCluster,cluster/<uid>,order/<uid>"
+// @Param			Last-Event-ID		header		string	false	"Replay the buffered events after this event id"
 // @Router			/v2/events/listen	[get]
 // @Security		ApiKey || AccessToken
 func HandleSSE() gin.HandlerFunc {
@@ -37,13 +44,46 @@ func HandleSSE() gin.HandlerFunc {
 		ctx, cancel := gincontext.GetRorContextFromGinContext(c)
 		defer cancel()
 		identity := rorcontext.MustGetIdentityFromRorContext(ctx)
+		lastEventId, err := sseservice.ParseLastEventId(c.GetHeader("Last-Event-ID"))
+		if err != nil {
+			rerr := rorginerror.NewRorGinError(http.StatusBadRequest, err.Error())
+			rerr.GinLogErrorAbort(c)
+			return
+		}
 		client := &sseservice.EventClient{
-			Id:         sseservice.NewEventClientId(),
-			Identity:   identity,
-			Connection: make(sseservice.EventClientChan),
+			Id:          sseservice.NewEventClientId(),
+			Identity:    identity,
+			Connection:  make(sseservice.EventClientChan, sseservice.EventClientBufferSize),
+			LastEventId: lastEventId,
+		}
+		if topics := c.Query("topics"); topics != "" {
+			for _, topic := range strings.Split(topics, ",") {
+				subscription, err := sseservice.ParseSubscription(topic)
+				if err != nil {
+					rerr := rorginerror.NewRorGinError(http.StatusBadRequest, "Invalid topic", err)
+					rerr.GinLogErrorAbort(c)
+					return
+				}
+				client.Subscribe(subscription)
+			}
+		}
+		// Send new connection to event server, the events the client missed
+		// are replayed before the events routed to it, and only once.
+		replay := sseservice.Server.Connect(client)
+		replayed := make(map[int64]struct{}, len(replay))
+		for _, event := range replay {
+			if event.Id != 0 {
+				replayed[event.Id] = struct{}{}
+			}
+		}
+		writeEvent := func(w io.Writer, msg sseservice.SseEvent) {
+			writeLock.Lock()
+			defer writeLock.Unlock()
+			if msg.Id != 0 {
+				_, _ = fmt.Fprintf(w, "id: %d\n", msg.Id)
+			}
+			c.SSEvent(msg.Event, msg.Data)
 		}
-		sseservice.Server.NewClients <- client
-		// Send new connection to event server
 
 		defer func() {
 			stopChan <- true
@@ -71,12 +111,17 @@ func HandleSSE() gin.HandlerFunc {
 		}()
 
 		c.Stream(func(w io.Writer) bool {
+			if len(replay) > 0 {
+				writeEvent(w, replay[0])
+				replay = replay[1:]
+				return true
+			}
 			select {
 			case msg, ok := <-client.Connection:
 				if ok {
-					writeLock.Lock()
-					c.SSEvent(msg.Event, msg.Data)
-					writeLock.Unlock()
+					if _, done := replayed[msg.Id]; msg.Id == 0 || !done {
+						writeEvent(w, msg)
+					}
 					return true
 				}
 				return false
@@ -92,17 +137,16 @@ func Send() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		ctx, cancel := gincontext.GetRorContextFromGinContext(c)
 		defer cancel()
-		// // // Access check
-		// // // Scope: ror
-		// // // Subject: global
-		// // // Access: create
-		// // // TODO: check if this is the right way to do it
-		// accessQuery := aclmodels.NewAclV2QueryAccessScopeSubject(aclmodels.Acl2ScopeRor, aclmodels.Acl2RorSubjectGlobal)
-		// accessObject := aclservice.CheckAccessByContextAclQuery(ctx, accessQuery)
-		// if !accessObject.Create {
-		// 	c.JSON(http.StatusForbidden, "403: No access")
-		// 	return
-		// }
+		// Access check
+		// Scope: ror
+		// Subject: global
+		// Access: create
+		accessQuery := aclmodels.NewAclV2QueryAccessScopeSubject(aclmodels.Acl2ScopeRor, aclmodels.Acl2RorSubjectGlobal)
+		accessObject := aclservice.CheckAccessByContextAclQuery(ctx, accessQuery)
+		if !accessObject.Create {
+			c.JSON(http.StatusForbidden, "403: No access")
+			return
+		}
 
 		var input sseservice.SseEvent
 		err := c.BindJSON(&input)
@@ -112,7 +156,9 @@ func Send() gin.HandlerFunc {
 			return
 		}
 
-		err = apiconnections.RabbitMQConnection.SendMessage(ctx, input, sseservice.SSERouteBroadcast, nil)
+		// Event ids are only assigned by the event servers.
+		input.Id = 0
+		err = sseservice.PublishClientEvent(ctx, apiconnections.RabbitMQConnection, input)
 		if err != nil {
 			rerr := rorginerror.NewRorGinError(http.StatusInternalServerError, "could not send sse broadcast event", err)
 			rerr.GinLogErrorAbort(c)
@@ -121,21 +167,53 @@ func Send() gin.HandlerFunc {
 	}
 }
 
+// Subscribe a connected client to a topic. Events on the topic are only
+// delivered when the client can read the resource or cluster they are about.
+//
+// @Summary	Subscribe to topic
+// @Schemes
+// @Description	Subscribe a connected event client to a topic
+// @Tags			events
+// @Accept			application/json
+// @Produce		application/json
+// @Param			subscription		body		sseservice.SSESubscribe	true	"Client id and topic"
+// @Success		200					{string}	string	"ok"
+// @Failure		403					{object}	rorerror.ErrorData
+// @Failure		400					{object}	rorerror.ErrorData
+// @Failure		401					{object}	rorerror.ErrorData
+// @Failure		500					{object}	rorerror.ErrorData
+// @Router			/v2/events/subscribe	[post]
+// @Security		ApiKey || AccessToken
 func Subscribe() gin.HandlerFunc {
+	return handleSubscription(sseservice.SSERouteSubscribe)
+}
+
+// Unsubscribe a connected client from a topic.
+//
+// @Summary	Unsubscribe from topic
+// @Schemes
+// @Description	Unsubscribe a connected event client from a topic
+// @Tags			events
+// @Accept			application/json
+// @Produce		application/json
+// @Param			subscription		body		sseservice.SSESubscribe	true	"Client id and topic"
+// @Success		200					{string}	string	"ok"
+// @Failure		400					{object}	rorerror.ErrorData
+// @Failure		401					{object}	rorerror.ErrorData
+// @Failure		500					{object}	rorerror.ErrorData
+// @Router			/v2/events/unsubscribe	[post]
+// @Security		ApiKey || AccessToken
+func Unsubscribe() gin.HandlerFunc {
+	return handleSubscription(sseservice.SSERouteUnsubscribe)
+}
+
+// handleSubscription sends a subscription change to the event servers, the
+// one holding the client connection applies it.
+func handleSubscription(route string) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		ctx, cancel := gincontext.GetRorContextFromGinContext(c)
 		defer cancel()
-		// // // Access check
-		// // // Scope: ror
-		// // // Subject: global
-		// // // Access: create
-		// // // TODO: check if this is the right way to do it
-		// accessQuery := aclmodels.NewAclV2QueryAccessScopeSubject(aclmodels.Acl2ScopeRor, aclmodels.Acl2RorSubjectGlobal)
-		// accessObject := aclservice.CheckAccessByContextAclQuery(ctx, accessQuery)
-		// if !accessObject.Create {
-		// 	c.JSON(http.StatusForbidden, "403: No access")
-		// 	return
-		// }
+		identity := rorcontext.MustGetIdentityFromRorContext(ctx)
 
 		var input sseservice.SSESubscribe
 		err := c.BindJSON(&input)
@@ -144,11 +222,40 @@ func Subscribe() gin.HandlerFunc {
 			rerr.GinLogErrorAbort(c)
 			return
 		}
+		input.Topic, err = sseservice.ParseSubscription(string(input.Topic))
+		if err != nil || input.ClientId == "" {
+			rerr := rorginerror.NewRorGinError(http.StatusBadRequest, "Invalid client id or topic", err)
+			rerr.GinLogErrorAbort(c)
+			return
+		}
+
+		// Access check
+		// Scope: KubernetesCluster
+		// Subject: the cluster uid of a cluster topic
+		// Access: read
+		if route == sseservice.SSERouteSubscribe {
+			if clusterUid, ok := strings.CutPrefix(string(input.Topic), sseservice.TopicCluster+"/"); ok && clusterUid != sseservice.TopicWildcard {
+				owner := rorresourceowner.RorResourceOwnerReference{
+					Scope:   aclmodels.Acl2ScopeCluster.ToKind(),
+					Subject: aclmodels.Acl2Subject(clusterUid),
+				}
+				accessObject := aclservice.CheckAccessByRorOwnerref(ctx, owner)
+				if !accessObject.Read {
+					c.JSON(http.StatusForbidden, "403: No access")
+					return
+				}
+			}
+		}
 
-		err = apiconnections.RabbitMQConnection.SendMessage(ctx, input, sseservice.SSERouteBroadcast, nil)
+		message := sseservice.SSESubscriptionMessage{
+			SSESubscribe: input,
+			IdentityId:   identity.GetId(),
+		}
+		err = apiconnections.RabbitMQConnection.SendMessage(ctx, message, route, nil)
 		if err != nil {
-			rerr := rorginerror.NewRorGinError(http.StatusInternalServerError, "could not send sse broadcast event", err)
+			rerr := rorginerror.NewRorGinError(http.StatusInternalServerError, "could not send sse subscription", err)
 			rerr.GinLogErrorAbort(c)
+			return
 		}
 		c.JSON(http.StatusOK, nil)
 	}
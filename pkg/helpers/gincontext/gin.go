@@ -29,7 +29,7 @@ func GetRorContextFromGinContext(c *gin.Context) (context.Context, context.Cance
 	}
 
 	ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
-	identity, err := getIdentityFromGinContext(c)
+	identity, err := GetIdentityFromGinContext(c)
 	if err != nil {
 		rlog.Error("could not get user from gin context: %v", err)
 		c.JSON(http.StatusUnauthorized, rorerror.RorError{
@@ -68,8 +68,8 @@ func GetUserFromGinContext(c *gin.Context) (*identitymodels.User, error) {
 	return identity.User, nil
 }
 
-// Function extracts the identity from gin context
-func getIdentityFromGinContext(c *gin.Context) (*identitymodels.Identity, error) {
+// GetIdentityFromGinContext Function extracts the identity from gin context
+func GetIdentityFromGinContext(c *gin.Context) (*identitymodels.Identity, error) {
 	identityObj, ok := c.Get("identity")
 	if !ok {
 		return nil, errors.New("identity not set in gin context")
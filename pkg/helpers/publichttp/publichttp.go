@@ -0,0 +1,105 @@
+// Package publichttp makes http requests to urls registered by the users of
+// ror-api, like the service account issuers of the clusters and the webhooks
+// of the rulesets. It only connects to public addresses, so a registered url
+// can not reach ror-api itself or the internal network it runs in. Private
+// addresses and http urls are allowed in development.
+package publichttp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"syscall"
+	"time"
+
+	"github.com/NorskHelsenett/ror/pkg/config/rorconfig"
+)
+
+var (
+	ErrNotPublic = errors.New("the address is not public")
+
+	// nonPublic are the special purpose ranges not covered by the checks of
+	// netip.Addr.
+	nonPublic = []netip.Prefix{
+		netip.MustParsePrefix("0.0.0.0/8"),
+		netip.MustParsePrefix("100.64.0.0/10"),
+		netip.MustParsePrefix("192.0.0.0/24"),
+		netip.MustParsePrefix("198.18.0.0/15"),
+		netip.MustParsePrefix("64:ff9b::/96"),
+		netip.MustParsePrefix("2002::/16"),
+	}
+)
+
+// NewClient returns an http client that only connects to public addresses.
+// The address is checked when the connection is dialed, after the host is
+// resolved, so a host that resolved to a public address when the url was
+// validated can not be dialed at a private one, and redirects are checked
+// like the first request.
+func NewClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{Timeout: timeout, Control: checkDial}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{Timeout: timeout, Transport: transport}
+}
+
+// ValidateUrl returns the url if it is an absolute https url whose host only
+// resolves to public addresses.
+func ValidateUrl(ctx context.Context, value string) (*url.URL, error) {
+	target, err := url.Parse(value)
+	if err != nil || target.Hostname() == "" {
+		return nil, errors.New("must be an absolute url")
+	}
+	if target.Scheme != "https" && !(target.Scheme == "http" && development()) {
+		return nil, errors.New("must be an https url")
+	}
+
+	addresses, err := net.DefaultResolver.LookupNetIP(ctx, "ip", target.Hostname())
+	if err != nil {
+		return nil, fmt.Errorf("could not resolve %s: %w", target.Hostname(), err)
+	}
+	for _, address := range addresses {
+		if !allowed(address) {
+			return nil, fmt.Errorf("%w: %s resolves to %s", ErrNotPublic, target.Hostname(), address)
+		}
+	}
+	return target, nil
+}
+
+// IsPublic reports whether the address is a public unicast address, not a
+// loopback, private, link local or other special purpose address.
+func IsPublic(address netip.Addr) bool {
+	address = address.Unmap()
+	if !address.IsGlobalUnicast() || address.IsPrivate() {
+		return false
+	}
+	for _, prefix := range nonPublic {
+		if prefix.Contains(address) {
+			return false
+		}
+	}
+	return true
+}
+
+func checkDial(_ string, address string, _ syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return err
+	}
+	if !allowed(addrPort.Addr()) {
+		return fmt.Errorf("%w: %s", ErrNotPublic, addrPort.Addr())
+	}
+	return nil
+}
+
+func allowed(address netip.Addr) bool {
+	return IsPublic(address) || development()
+}
+
+func development() bool {
+	return rorconfig.GetBool(rorconfig.DEVELOPMENT)
+}
@@ -0,0 +1,37 @@
+package publichttp
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsPublic(t *testing.T) {
+	tests := []struct {
+		address string
+		want    bool
+	}{
+		{address: "8.8.8.8", want: true},
+		{address: "2001:4860:4860::8888", want: true},
+		{address: "127.0.0.1", want: false},
+		{address: "::1", want: false},
+		{address: "10.1.2.3", want: false},
+		{address: "172.16.0.1", want: false},
+		{address: "192.168.1.1", want: false},
+		{address: "169.254.169.254", want: false},
+		{address: "fe80::1", want: false},
+		{address: "fd00::1", want: false},
+		{address: "100.64.0.1", want: false},
+		{address: "0.0.0.0", want: false},
+		{address: "::ffff:127.0.0.1", want: false},
+		{address: "::ffff:10.0.0.1", want: false},
+		{address: "224.0.0.1", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.address, func(t *testing.T) {
+			assert.Equal(t, tt.want, IsPublic(netip.MustParseAddr(tt.address)))
+		})
+	}
+}
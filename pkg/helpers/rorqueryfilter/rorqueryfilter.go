@@ -0,0 +1,225 @@
+// rorqueryfilter validates and interprets resource query filters beyond the
+// operators defined in rorresources, and encodes OR groups of filters so they
+// can travel in a rorresources.ResourceQuery.
+package rorqueryfilter
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/NorskHelsenett/ror/pkg/rorresources"
+)
+
+const (
+	// FilterTypeGroup marks a filter holding OR groups of filters in its value.
+	FilterTypeGroup rorresources.FilterType = "group"
+
+	FilterOperatorOr       rorresources.FilterOperator = "or"
+	FilterOperatorIn       rorresources.FilterOperator = "in"
+	FilterOperatorNin      rorresources.FilterOperator = "nin"
+	FilterOperatorExists   rorresources.FilterOperator = "exists"
+	FilterOperatorContains rorresources.FilterOperator = "contains"
+
+	// MaxGroupDepth limits how deep OR groups can be nested.
+	MaxGroupDepth = 4
+)
+
+var ErrInvalidFilter = errors.New("invalid filter")
+
+// operatorsByType lists the operators that are valid for each filter type.
+var operatorsByType = map[rorresources.FilterType][]rorresources.FilterOperator{
+	rorresources.FilterTypeString: {
+		rorresources.FilterOperatorEq, rorresources.FilterOperatorNe, rorresources.FilterOperatorRegexp,
+		FilterOperatorIn, FilterOperatorNin, FilterOperatorContains, FilterOperatorExists,
+	},
+	rorresources.FilterTypeInt: {
+		rorresources.FilterOperatorEq, rorresources.FilterOperatorNe,
+		rorresources.FilterOperatorGt, rorresources.FilterOperatorLt, rorresources.FilterOperatorGe, rorresources.FilterOperatorLe,
+		FilterOperatorIn, FilterOperatorNin, FilterOperatorContains, FilterOperatorExists,
+	},
+	rorresources.FilterTypeBool: {
+		rorresources.FilterOperatorEq, rorresources.FilterOperatorNe, FilterOperatorExists,
+	},
+	rorresources.FilterTypeTime: {
+		rorresources.FilterOperatorEq, rorresources.FilterOperatorNe,
+		rorresources.FilterOperatorGt, rorresources.FilterOperatorLt, rorresources.FilterOperatorGe, rorresources.FilterOperatorLe,
+		FilterOperatorExists,
+	},
+	FilterTypeGroup: {FilterOperatorOr},
+}
+
+// IsSetOperator reports whether the operator takes a list of values.
+func IsSetOperator(operator rorresources.FilterOperator) bool {
+	return operator == FilterOperatorIn || operator == FilterOperatorNin
+}
+
+// Validate checks that the operator fits the filter type and that the value
+// can be parsed as that type. OR groups are validated recursively.
+func Validate(filter rorresources.ResourceQueryFilter) error {
+	return validate(filter, 0)
+}
+
+func validate(filter rorresources.ResourceQueryFilter, depth int) error {
+	operators, ok := operatorsByType[filter.Type]
+	if !ok {
+		return fmt.Errorf("%w: unknown filter type %q", ErrInvalidFilter, filter.Type)
+	}
+	if !slices.Contains(operators, filter.Operator) {
+		return fmt.Errorf("%w: operator %q is not valid for type %q", ErrInvalidFilter, filter.Operator, filter.Type)
+	}
+
+	if filter.Type == FilterTypeGroup {
+		if depth >= MaxGroupDepth {
+			return fmt.Errorf("%w: or groups nested deeper than %d", ErrInvalidFilter, MaxGroupDepth)
+		}
+		groups, err := DecodeOrGroups(filter)
+		if err != nil {
+			return err
+		}
+		for _, group := range groups {
+			for _, member := range group {
+				if err := validate(member, depth+1); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+
+	if err := validateField(filter.Field); err != nil {
+		return err
+	}
+	if filter.Operator == FilterOperatorExists {
+		_, err := ExistsValue(filter)
+		return err
+	}
+	if IsSetOperator(filter.Operator) {
+		_, err := TypedValues(filter)
+		return err
+	}
+	_, err := TypedValue(filter)
+	return err
+}
+
+// validateField checks that the field is a dotted path of field names. Empty
+// names and names starting with $ are rejected, as MongoDB would read them as
+// operators or variables instead of fields.
+func validateField(field string) error {
+	if field == "" {
+		return fmt.Errorf("%w: missing field", ErrInvalidFilter)
+	}
+	for _, segment := range strings.Split(field, ".") {
+		if segment == "" {
+			return fmt.Errorf("%w: field %q has an empty path segment", ErrInvalidFilter, field)
+		}
+		if strings.HasPrefix(segment, "$") {
+			return fmt.Errorf("%w: field %q has a path segment starting with $", ErrInvalidFilter, field)
+		}
+	}
+	return nil
+}
+
+// TypedValue parses the filter value as the filter type. Time values are
+// RFC 3339 timestamps.
+func TypedValue(filter rorresources.ResourceQueryFilter) (any, error) {
+	return parseValue(filter.Type, filter.Field, filter.Value)
+}
+
+// TypedValues parses the value of an in or nin filter, a JSON array of
+// strings, as the filter type.
+func TypedValues(filter rorresources.ResourceQueryFilter) ([]any, error) {
+	var raw []string
+	if err := json.Unmarshal([]byte(filter.Value), &raw); err != nil {
+		return nil, fmt.Errorf("%w: value of %s filter on %s must be a JSON array of strings", ErrInvalidFilter, filter.Operator, filter.Field)
+	}
+	if len(raw) == 0 {
+		return nil, fmt.Errorf("%w: %s filter on %s needs at least one value", ErrInvalidFilter, filter.Operator, filter.Field)
+	}
+	values := make([]any, 0, len(raw))
+	for _, value := range raw {
+		typed, err := parseValue(filter.Type, filter.Field, value)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, typed)
+	}
+	return values, nil
+}
+
+// ExistsValue parses the value of an exists filter, an empty value means true.
+func ExistsValue(filter rorresources.ResourceQueryFilter) (bool, error) {
+	if filter.Value == "" {
+		return true, nil
+	}
+	exists, err := strconv.ParseBool(filter.Value)
+	if err != nil {
+		return false, fmt.Errorf("%w: value of exists filter on %s must be true or false", ErrInvalidFilter, filter.Field)
+	}
+	return exists, nil
+}
+
+func parseValue(filterType rorresources.FilterType, field string, value string) (any, error) {
+	switch filterType {
+	case rorresources.FilterTypeString:
+		return value, nil
+	case rorresources.FilterTypeInt:
+		intValue, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%w: value %q of int filter on %s is not an integer", ErrInvalidFilter, value, field)
+		}
+		return intValue, nil
+	case rorresources.FilterTypeBool:
+		boolValue, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("%w: value %q of bool filter on %s is not a boolean", ErrInvalidFilter, value, field)
+		}
+		return boolValue, nil
+	case rorresources.FilterTypeTime:
+		timeValue, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return nil, fmt.Errorf("%w: value %q of time filter on %s is not an RFC 3339 timestamp", ErrInvalidFilter, value, field)
+		}
+		return timeValue, nil
+	default:
+		return nil, fmt.Errorf("%w: unknown filter type %q", ErrInvalidFilter, filterType)
+	}
+}
+
+// NewOrGroup returns a filter matching resources that match all filters of at
+// least one of the groups.
+func NewOrGroup(groups [][]rorresources.ResourceQueryFilter) (rorresources.ResourceQueryFilter, error) {
+	if len(groups) == 0 {
+		return rorresources.ResourceQueryFilter{}, fmt.Errorf("%w: or needs at least one group", ErrInvalidFilter)
+	}
+	value, err := json.Marshal(groups)
+	if err != nil {
+		return rorresources.ResourceQueryFilter{}, fmt.Errorf("could not encode or group: %w", err)
+	}
+	return rorresources.ResourceQueryFilter{
+		Type:     FilterTypeGroup,
+		Operator: FilterOperatorOr,
+		Value:    string(value),
+	}, nil
+}
+
+// DecodeOrGroups returns the groups of an OR group filter.
+func DecodeOrGroups(filter rorresources.ResourceQueryFilter) ([][]rorresources.ResourceQueryFilter, error) {
+	var groups [][]rorresources.ResourceQueryFilter
+	if err := json.Unmarshal([]byte(filter.Value), &groups); err != nil {
+		return nil, fmt.Errorf("%w: could not decode or group: %w", ErrInvalidFilter, err)
+	}
+	if len(groups) == 0 {
+		return nil, fmt.Errorf("%w: or needs at least one group", ErrInvalidFilter)
+	}
+	for _, group := range groups {
+		if len(group) == 0 {
+			return nil, fmt.Errorf("%w: or group must not be empty", ErrInvalidFilter)
+		}
+	}
+	return groups, nil
+}
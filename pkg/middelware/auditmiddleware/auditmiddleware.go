@@ -11,6 +11,11 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
+// createAuditLog stores an audit log entry, replaced in tests.
+var createAuditLog = auditlog.Create
+
+// AuditLogMiddleware creates an audit log entry for requests that succeed
+// with a 2xx status.
 func AuditLogMiddleware(msg string, category models.AuditCategory, action models.AuditAction) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		user, err := gincontext.GetUserFromGinContext(c)
@@ -19,12 +24,12 @@ func AuditLogMiddleware(msg string, category models.AuditCategory, action models
 			rlog.Errorc(ctx, "unable to get user from auditlog middleware", err)
 		}
 		c.Next()
-		if c.Writer.Status() != 200 {
+		if status := c.Writer.Status(); status < 200 || status > 299 {
 			return
 		}
 		newObject, _ := c.Get("newObject")
 		oldObject, _ := c.Get("oldObject")
-		_, err = auditlog.Create(ctx, msg, category, action, user, newObject, oldObject)
+		_, err = createAuditLog(ctx, msg, category, action, user, newObject, oldObject)
 		if err != nil {
 			rlog.Errorc(ctx, "could not create auditlog", err)
 		}
@@ -0,0 +1,57 @@
+package auditmiddleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/NorskHelsenett/ror-api/internal/models"
+
+	identitymodels "github.com/NorskHelsenett/ror/pkg/models/identity"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuditLogMiddleware_LogsSuccessfulRequests(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	type entry struct {
+		msg       string
+		action    models.AuditAction
+		user      *identitymodels.User
+		newObject any
+	}
+	var entries []entry
+	original := createAuditLog
+	t.Cleanup(func() { createAuditLog = original })
+	createAuditLog = func(ctx context.Context, msg string, category models.AuditCategory, action models.AuditAction, user *identitymodels.User, newObject any, oldObject any) (string, error) {
+		entries = append(entries, entry{msg: msg, action: action, user: user, newObject: newObject})
+		return "id", nil
+	}
+
+	user := &identitymodels.User{Email: "user@example.com"}
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("identity", identitymodels.Identity{Type: identitymodels.IdentityTypeUser, User: user})
+	})
+	respond := func(status int) gin.HandlerFunc {
+		return func(c *gin.Context) {
+			c.Set("newObject", status)
+			c.JSON(status, nil)
+		}
+	}
+	router.POST("/created", respond(http.StatusCreated), AuditLogMiddleware("created", models.AuditCategoryWebhook, models.AuditActionCreate))
+	router.POST("/ok", respond(http.StatusOK), AuditLogMiddleware("ok", models.AuditCategoryWebhook, models.AuditActionUpdate))
+	router.POST("/invalid", respond(http.StatusBadRequest), AuditLogMiddleware("invalid", models.AuditCategoryWebhook, models.AuditActionCreate))
+
+	for _, path := range []string{"/created", "/ok", "/invalid"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, path, nil))
+	}
+
+	require.Len(t, entries, 2)
+	assert.Equal(t, entry{msg: "created", action: models.AuditActionCreate, user: user, newObject: http.StatusCreated}, entries[0])
+	assert.Equal(t, entry{msg: "ok", action: models.AuditActionUpdate, user: user, newObject: http.StatusOK}, entries[1])
+}
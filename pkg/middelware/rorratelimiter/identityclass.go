@@ -0,0 +1,86 @@
+package rorratelimiter
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	identitymodels "github.com/NorskHelsenett/ror/pkg/models/identity"
+	"golang.org/x/time/rate"
+)
+
+// IdentityClass groups identities that share a rate limit budget.
+type IdentityClass string
+
+const (
+	IdentityClassCluster   IdentityClass = "cluster"
+	IdentityClassService   IdentityClass = "service"
+	IdentityClassUser      IdentityClass = "user"
+	IdentityClassApiKey    IdentityClass = "apikey"
+	IdentityClassAnonymous IdentityClass = "anonymous"
+)
+
+var identityClasses = []IdentityClass{
+	IdentityClassCluster,
+	IdentityClassService,
+	IdentityClassUser,
+	IdentityClassApiKey,
+	IdentityClassAnonymous,
+}
+
+// Budget is the rate and burst of the token bucket of each identity.
+type Budget struct {
+	Rate  rate.Limit
+	Burst int
+}
+
+// ClassOf returns the identity class of an identity. Clusters and services
+// are classed by type, users authenticated with an api key as apikey.
+func ClassOf(identity identitymodels.Identity) IdentityClass {
+	switch {
+	case identity.IsCluster():
+		return IdentityClassCluster
+	case identity.IsService():
+		return IdentityClassService
+	case identity.Auth.AuthProvider == identitymodels.IdentityProviderApiKey:
+		return IdentityClassApiKey
+	case identity.IsUser():
+		return IdentityClassUser
+	}
+	return IdentityClassAnonymous
+}
+
+// ParseBudgets parses budgets written as <class>=<rate>:<burst>, separated by
+// commas, e.g. "cluster=50:100,user=10:20".
+func ParseBudgets(budgets string) (map[IdentityClass]Budget, error) {
+	parsed := make(map[IdentityClass]Budget)
+	for entry := range strings.SplitSeq(budgets, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		class, value, found := strings.Cut(entry, "=")
+		if !found {
+			return nil, fmt.Errorf("invalid rate limit budget %q, expected <class>=<rate>:<burst>", entry)
+		}
+		identityClass := IdentityClass(strings.TrimSpace(class))
+		if !slices.Contains(identityClasses, identityClass) {
+			return nil, fmt.Errorf("unknown identity class %q in rate limit budget", class)
+		}
+		rateValue, burstValue, found := strings.Cut(value, ":")
+		if !found {
+			return nil, fmt.Errorf("invalid rate limit budget %q, expected <class>=<rate>:<burst>", entry)
+		}
+		requestRate, err := strconv.ParseFloat(strings.TrimSpace(rateValue), 64)
+		if err != nil || requestRate < 0 {
+			return nil, fmt.Errorf("invalid rate in rate limit budget %q", entry)
+		}
+		burst, err := strconv.Atoi(strings.TrimSpace(burstValue))
+		if err != nil || burst < 0 {
+			return nil, fmt.Errorf("invalid burst in rate limit budget %q", entry)
+		}
+		parsed[identityClass] = Budget{Rate: rate.Limit(requestRate), Burst: burst}
+	}
+	return parsed, nil
+}
@@ -1,7 +1,13 @@
 package rorratelimiter
 
 import (
+	"math"
 	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/NorskHelsenett/ror-api/pkg/helpers/gincontext"
 
 	"github.com/gin-gonic/gin"
 	"github.com/prometheus/client_golang/prometheus"
@@ -9,6 +15,16 @@ import (
 	"golang.org/x/time/rate"
 )
 
+const (
+	HeaderRateLimitLimit     = "X-RateLimit-Limit"
+	HeaderRateLimitRemaining = "X-RateLimit-Remaining"
+	HeaderRateLimitClass     = "X-RateLimit-Class"
+
+	// defaultIdleTimeout is how long a bucket is kept after the last request
+	// of its identity.
+	defaultIdleTimeout = 10 * time.Minute
+)
+
 var (
 	// Prometheus metrics for rate limiting
 	rateLimiterRequests = promauto.NewCounterVec(
@@ -16,7 +32,7 @@ var (
 			Name: "rate_limiter_requests_total",
 			Help: "Total number of requests processed by rate limiter",
 		},
-		[]string{"limiter_name", "status"}, // status: allowed, blocked
+		[]string{"limiter_name", "identity_class", "status"}, // status: allowed, blocked
 	)
 
 	rateLimiterBlocked = promauto.NewCounterVec(
@@ -24,7 +40,7 @@ var (
 			Name: "rate_limiter_blocked_total",
 			Help: "Total number of requests blocked by rate limiter",
 		},
-		[]string{"limiter_name"},
+		[]string{"limiter_name", "identity_class"},
 	)
 
 	rateLimiterConfig = promauto.NewGaugeVec(
@@ -32,57 +48,219 @@ var (
 			Name: "rate_limiter_config",
 			Help: "Current rate limiter configuration",
 		},
-		[]string{"limiter_name", "config_type"}, // config_type: rate, burst
+		[]string{"limiter_name", "identity_class", "config_type"}, // config_type: rate, burst
 	)
 
 	rateLimiterTokens = promauto.NewGaugeVec(
 		prometheus.GaugeOpts{
 			Name: "rate_limiter_tokens_available",
-			Help: "Current number of tokens available in the bucket",
+			Help: "Number of tokens available in the bucket of the identity of the last request",
 		},
-		[]string{"limiter_name"},
+		[]string{"limiter_name", "identity_class"},
+	)
+
+	rateLimiterBuckets = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "rate_limiter_buckets",
+			Help: "Current number of identities with a token bucket",
+		},
+		[]string{"limiter_name", "identity_class"},
 	)
 )
 
+// RorRateLimiter limits requests per identity. Every identity has its own
+// token bucket, sized by the budget of its identity class or by the default
+// rate and burst. Buckets of identities without requests for a while are
+// evicted.
 type RorRateLimiter struct {
-	Limiter *rate.Limiter
-	Rate    rate.Limit
-	Burst   int
-	Name    string // Add name for metrics labeling
-}
-
-// TODO Add method to set retry after header
-// This method can be used to set a Retry-After header in the response
-//
-//	func (r *RorRateLimiter) SetRetryAfterHeader(c *gin.Context, seconds int) {
-//		c.Header("Retry-After", strconv.Itoa(seconds))
-//	}
+	Rate  rate.Limit
+	Burst int
+	Name  string // Add name for metrics labeling
+
+	// IdleTimeout is how long a bucket is kept without requests.
+	IdleTimeout time.Duration
+
+	lock      sync.Mutex
+	budgets   map[IdentityClass]Budget
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+type bucket struct {
+	class    IdentityClass
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
 func (r *RorRateLimiter) RateLimiter(c *gin.Context) {
-	// Update current token count metric
-	if r.Name != "" {
-		rateLimiterTokens.WithLabelValues(r.Name).Set(float64(r.Limiter.Tokens()))
-	}
+	class, key := identityKey(c)
+	now := time.Now()
+	limiter, burst := r.getLimiter(class, key, now)
 
-	if !r.Limiter.Allow() {
+	reservation := limiter.ReserveN(now, 1)
+	delay := reservation.DelayFrom(now)
+	if !reservation.OK() || delay > 0 {
+		reservation.CancelAt(now)
 		// Record blocked request
 		if r.Name != "" {
-			rateLimiterRequests.WithLabelValues(r.Name, "blocked").Inc()
-			rateLimiterBlocked.WithLabelValues(r.Name).Inc()
+			rateLimiterRequests.WithLabelValues(r.Name, string(class), "blocked").Inc()
+			rateLimiterBlocked.WithLabelValues(r.Name, string(class)).Inc()
+			rateLimiterTokens.WithLabelValues(r.Name, string(class)).Set(limiter.TokensAt(now))
 		}
+		setHeaders(c, class, burst, 0)
+		c.Header("Retry-After", strconv.Itoa(retryAfterSeconds(reservation.OK(), delay)))
 		c.JSON(http.StatusTooManyRequests, gin.H{"error": "too many requests"})
-		c.Header("Retry-After", "30") // Suggest retry after 30 seconds
 		c.Abort()
 		return
 	}
 
+	tokens := limiter.TokensAt(now)
 	// Record allowed request
 	if r.Name != "" {
-		rateLimiterRequests.WithLabelValues(r.Name, "allowed").Inc()
+		rateLimiterRequests.WithLabelValues(r.Name, string(class), "allowed").Inc()
+		rateLimiterTokens.WithLabelValues(r.Name, string(class)).Set(tokens)
 	}
+	setHeaders(c, class, burst, int(math.Max(0, math.Floor(tokens))))
 
 	c.Next()
 }
 
+func setHeaders(c *gin.Context, class IdentityClass, limit, remaining int) {
+	c.Header(HeaderRateLimitLimit, strconv.Itoa(limit))
+	c.Header(HeaderRateLimitRemaining, strconv.Itoa(remaining))
+	c.Header(HeaderRateLimitClass, string(class))
+}
+
+// retryAfterSeconds rounds the delay until the request would be allowed up
+// to whole seconds. A request that can never be allowed, because the burst
+// is zero, is told to retry after a minute.
+func retryAfterSeconds(ok bool, delay time.Duration) int {
+	if !ok || delay == rate.InfDuration {
+		return 60
+	}
+	return max(1, int(math.Ceil(delay.Seconds())))
+}
+
+// identityKey returns the identity class and the bucket key of the request.
+// Requests without an identity are limited per client ip.
+func identityKey(c *gin.Context) (IdentityClass, string) {
+	identity, err := gincontext.GetIdentityFromGinContext(c)
+	if err != nil {
+		return IdentityClassAnonymous, string(IdentityClassAnonymous) + "/" + c.ClientIP()
+	}
+	class := ClassOf(*identity)
+	switch class {
+	case IdentityClassApiKey:
+		return class, string(class) + "/" + identity.Auth.AuthProviderID
+	case IdentityClassCluster:
+		if identity.ClusterIdentity != nil {
+			return class, string(class) + "/" + identity.ClusterIdentity.Id
+		}
+	}
+	return class, string(class) + "/" + identity.GetId()
+}
+
+// getLimiter returns the token bucket of the identity, creating it from the
+// budget of its class.
+func (r *RorRateLimiter) getLimiter(class IdentityClass, key string, now time.Time) (*rate.Limiter, int) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.sweep(now)
+
+	budget := r.budget(class)
+	b, ok := r.buckets[key]
+	if !ok {
+		b = &bucket{class: class, limiter: rate.NewLimiter(budget.Rate, budget.Burst)}
+		r.buckets[key] = b
+		r.updateBucketMetric(class)
+	}
+	b.lastSeen = now
+	return b.limiter, budget.Burst
+}
+
+// sweep evicts buckets without requests for the idle timeout. It runs at
+// most once per idle timeout.
+func (r *RorRateLimiter) sweep(now time.Time) {
+	idleTimeout := r.IdleTimeout
+	if idleTimeout <= 0 {
+		idleTimeout = defaultIdleTimeout
+	}
+	if now.Sub(r.lastSweep) < idleTimeout {
+		return
+	}
+	r.lastSweep = now
+
+	evicted := make(map[IdentityClass]bool)
+	for key, b := range r.buckets {
+		if now.Sub(b.lastSeen) >= idleTimeout {
+			delete(r.buckets, key)
+			evicted[b.class] = true
+		}
+	}
+	for class := range evicted {
+		r.updateBucketMetric(class)
+	}
+}
+
+func (r *RorRateLimiter) updateBucketMetric(class IdentityClass) {
+	if r.Name == "" {
+		return
+	}
+	count := 0
+	for _, b := range r.buckets {
+		if b.class == class {
+			count++
+		}
+	}
+	rateLimiterBuckets.WithLabelValues(r.Name, string(class)).Set(float64(count))
+}
+
+// budget returns the budget of the identity class, or the default rate and
+// burst when the class has none.
+func (r *RorRateLimiter) budget(class IdentityClass) Budget {
+	if budget, ok := r.budgets[class]; ok {
+		return budget
+	}
+	return Budget{Rate: r.Rate, Burst: r.Burst}
+}
+
+// SetBudget sets the budget of an identity class, existing buckets of the
+// class are resized.
+func (r *RorRateLimiter) SetBudget(class IdentityClass, budget Budget) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.budgets[class] = budget
+	r.resize(func(c IdentityClass) bool { return c == class })
+	if r.Name != "" {
+		rateLimiterConfig.WithLabelValues(r.Name, string(class), "rate").Set(float64(budget.Rate))
+		rateLimiterConfig.WithLabelValues(r.Name, string(class), "burst").Set(float64(budget.Burst))
+	}
+}
+
+// SetBudgets sets the budgets of the identity classes in the map.
+func (r *RorRateLimiter) SetBudgets(budgets map[IdentityClass]Budget) {
+	for class, budget := range budgets {
+		r.SetBudget(class, budget)
+	}
+}
+
+// resize applies the current budgets to the buckets of the matching classes.
+func (r *RorRateLimiter) resize(match func(IdentityClass) bool) {
+	for _, b := range r.buckets {
+		if match(b.class) {
+			budget := r.budget(b.class)
+			b.limiter.SetLimit(budget.Rate)
+			b.limiter.SetBurst(budget.Burst)
+		}
+	}
+}
+
+func (r *RorRateLimiter) usesDefault(class IdentityClass) bool {
+	_, ok := r.budgets[class]
+	return !ok
+}
+
 func (r *RorRateLimiter) GetRate() int {
 	return int(r.Rate)
 }
@@ -91,48 +269,48 @@ func (r *RorRateLimiter) GetBurst() int {
 	return r.Burst
 }
 
+// SetRate sets the default rate, used by identity classes without a budget.
 func (r *RorRateLimiter) SetRate(setRate int) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
 	r.Rate = rate.Limit(setRate)
-	r.Limiter.SetLimit(r.Rate)
+	r.resize(r.usesDefault)
 	// Update metrics
 	if r.Name != "" {
-		rateLimiterConfig.WithLabelValues(r.Name, "rate").Set(float64(setRate))
+		rateLimiterConfig.WithLabelValues(r.Name, "default", "rate").Set(float64(setRate))
 	}
 }
 
+// SetBurst sets the default burst, used by identity classes without a budget.
 func (r *RorRateLimiter) SetBurst(setBurst int) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
 	r.Burst = setBurst
-	r.Limiter.SetBurst(r.Burst)
+	r.resize(r.usesDefault)
 	// Update metrics
 	if r.Name != "" {
-		rateLimiterConfig.WithLabelValues(r.Name, "burst").Set(float64(setBurst))
+		rateLimiterConfig.WithLabelValues(r.Name, "default", "burst").Set(float64(setBurst))
 	}
 }
 
 func NewRorRateLimiter(requestRate, burst int) *RorRateLimiter {
-	limiter := rate.NewLimiter(rate.Limit(requestRate), burst)
-	return &RorRateLimiter{
-		Limiter: limiter,
-		Rate:    rate.Limit(requestRate),
-		Burst:   burst,
-	}
+	return NewNamedRorRateLimiter("", requestRate, burst)
 }
 
 // New function with name parameter for better metrics
 func NewNamedRorRateLimiter(name string, requestRate, burst int) *RorRateLimiter {
-	limiter := rate.NewLimiter(rate.Limit(requestRate), burst)
-
 	rateLimiter := &RorRateLimiter{
-		Limiter: limiter,
 		Rate:    rate.Limit(requestRate),
 		Burst:   burst,
 		Name:    name,
+		budgets: make(map[IdentityClass]Budget),
+		buckets: make(map[string]*bucket),
 	}
 
 	// Initialize configuration metrics
 	if name != "" {
-		rateLimiterConfig.WithLabelValues(name, "rate").Set(float64(requestRate))
-		rateLimiterConfig.WithLabelValues(name, "burst").Set(float64(burst))
+		rateLimiterConfig.WithLabelValues(name, "default", "rate").Set(float64(requestRate))
+		rateLimiterConfig.WithLabelValues(name, "default", "burst").Set(float64(burst))
 	}
 
 	return rateLimiter
@@ -0,0 +1,55 @@
+package rorratelimiter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	identitymodels "github.com/NorskHelsenett/ror/pkg/models/identity"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/time/rate"
+)
+
+func TestParseBudgets(t *testing.T) {
+	budgets, err := ParseBudgets(" cluster=50:100, user=0.5:2 ")
+	require.NoError(t, err)
+	assert.Equal(t, map[IdentityClass]Budget{
+		IdentityClassCluster: {Rate: 50, Burst: 100},
+		IdentityClassUser:    {Rate: rate.Limit(0.5), Burst: 2},
+	}, budgets)
+
+	for _, invalid := range []string{"cluster", "cluster=50", "robot=1:1", "user=x:1", "user=1:-1"} {
+		_, err := ParseBudgets(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestRateLimiterPerIdentity(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	limiter := NewRorRateLimiter(1, 1)
+	limiter.SetBudget(IdentityClassCluster, Budget{Rate: 1, Burst: 2})
+
+	request := func(identity identitymodels.Identity) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(recorder)
+		c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+		c.Set("identity", identity)
+		limiter.RateLimiter(c)
+		return recorder
+	}
+
+	clusterA := identitymodels.Identity{Type: identitymodels.IdentityTypeCluster, ClusterIdentity: &identitymodels.ServiceIdentity{Id: "a"}}
+	clusterB := identitymodels.Identity{Type: identitymodels.IdentityTypeCluster, ClusterIdentity: &identitymodels.ServiceIdentity{Id: "b"}}
+
+	assert.Equal(t, "1", request(clusterA).Header().Get(HeaderRateLimitRemaining))
+	assert.Equal(t, http.StatusOK, request(clusterA).Code)
+
+	blocked := request(clusterA)
+	assert.Equal(t, http.StatusTooManyRequests, blocked.Code)
+	assert.Equal(t, "1", blocked.Header().Get("Retry-After"))
+	assert.Equal(t, "cluster", blocked.Header().Get(HeaderRateLimitClass))
+
+	assert.Equal(t, http.StatusOK, request(clusterB).Code, "other identities have their own bucket")
+}
@@ -0,0 +1,185 @@
+// Package priceservice calculates the cost of clusters from the price
+// catalogue. The catalogue holds monthly prices per machine class, vCPU, GiB
+// of memory and GiB of storage, each for a provider, a datacenter or all, and
+// effective from a date.
+package priceservice
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/NorskHelsenett/ror-api/internal/databases/mongodb/mongoTypes"
+	"github.com/NorskHelsenett/ror-api/internal/databases/mongodb/repositories/priceitems"
+	"github.com/NorskHelsenett/ror-api/internal/models/pricemodels"
+
+	"github.com/NorskHelsenett/ror/pkg/config/rorconfig"
+	"github.com/NorskHelsenett/ror/pkg/rlog"
+)
+
+const (
+	catalogueRefreshInterval = time.Minute
+	// catalogueRetryInterval is how long a failure to load the catalogue is
+	// cached before loading it is tried again.
+	catalogueRetryInterval = 5 * time.Second
+)
+
+// Catalogue is the price items used to calculate costs.
+type Catalogue struct {
+	items []pricemodels.PriceItem
+}
+
+// NewCatalogue returns a catalogue of the items. Items without a currency are
+// in the currency.
+func NewCatalogue(items []pricemodels.PriceItem, currency string) *Catalogue {
+	catalogue := &Catalogue{items: make([]pricemodels.PriceItem, len(items))}
+	copy(catalogue.items, items)
+	for i := range catalogue.items {
+		if catalogue.items[i].Currency == "" {
+			catalogue.items[i].Currency = currency
+		}
+	}
+	return catalogue
+}
+
+var catalogueCache struct {
+	lock      sync.Mutex
+	catalogue *Catalogue
+	expiresAt time.Time
+}
+
+// GetCatalogue returns the catalogue of the price items and the machine
+// class prices, reloaded when it is older than the refresh interval. If
+// loading fails the previous catalogue is kept, and loading is not tried
+// again for the retry interval.
+func GetCatalogue(ctx context.Context) *Catalogue {
+	catalogueCache.lock.Lock()
+	defer catalogueCache.lock.Unlock()
+	if catalogueCache.catalogue != nil && time.Now().Before(catalogueCache.expiresAt) {
+		return catalogueCache.catalogue
+	}
+
+	catalogue, err := LoadCatalogue(ctx)
+	if err != nil {
+		rlog.Errorc(ctx, "could not load price catalogue", err)
+		if catalogueCache.catalogue == nil {
+			catalogueCache.catalogue = NewCatalogue(nil, "")
+		}
+		catalogueCache.expiresAt = time.Now().Add(catalogueRetryInterval)
+		return catalogueCache.catalogue
+	}
+	catalogueCache.catalogue = catalogue
+	catalogueCache.expiresAt = time.Now().Add(catalogueRefreshInterval)
+	return catalogue
+}
+
+// LoadCatalogue reads the catalogue from the database. The machine class
+// prices of the prices collection are included as machine class items in
+// PRICE_CURRENCY, items in the catalogue take precedence over them.
+func LoadCatalogue(ctx context.Context) (*Catalogue, error) {
+	prices, err := priceitems.GetMachineClassPrices(ctx)
+	if err != nil {
+		return nil, err
+	}
+	items, err := priceitems.GetAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return NewCatalogue(append(machineClassItems(prices), items...), defaultCurrency()), nil
+}
+
+// invalidateCatalogue makes the next GetCatalogue reload the catalogue.
+func invalidateCatalogue() {
+	catalogueCache.lock.Lock()
+	defer catalogueCache.lock.Unlock()
+	catalogueCache.expiresAt = time.Time{}
+}
+
+func defaultCurrency() string {
+	return rorconfig.GetString("PRICE_CURRENCY")
+}
+
+func machineClassItems(prices []mongoTypes.MongoPrice) []pricemodels.PriceItem {
+	items := make([]pricemodels.PriceItem, 0, len(prices))
+	for _, price := range prices {
+		items = append(items, pricemodels.PriceItem{
+			Kind:          pricemodels.PriceItemKindMachineClass,
+			Provider:      price.Provider,
+			MachineClass:  price.MachineClass,
+			Cpu:           int64(price.Cpu),
+			MemoryGiB:     price.Memory,
+			Price:         float64(price.Price),
+			EffectiveFrom: price.From,
+		})
+	}
+	return items
+}
+
+// resolve returns the item of the kind for the provider, datacenter and
+// machine or storage class effective at the time. An item for the datacenter
+// is used before an item for the provider, which is used before an item for
+// all, and among those the latest effective item is used.
+func (c *Catalogue) resolve(kind pricemodels.PriceItemKind, provider, datacenter, class string, at time.Time) (pricemodels.PriceItem, bool) {
+	var best pricemodels.PriceItem
+	bestScore := -1
+	for _, item := range c.items {
+		if item.Kind != kind || item.EffectiveFrom.After(at) {
+			continue
+		}
+		score, ok := matchItem(item, provider, datacenter, class)
+		if !ok {
+			continue
+		}
+		if score > bestScore || score == bestScore && !item.EffectiveFrom.Before(best.EffectiveFrom) {
+			best, bestScore = item, score
+		}
+	}
+	return best, bestScore >= 0
+}
+
+// matchItem returns how specific the item is for the provider, datacenter
+// and class, or false if the item does not apply to them.
+func matchItem(item pricemodels.PriceItem, provider, datacenter, class string) (int, bool) {
+	score := 0
+	switch {
+	case item.Provider == "":
+	case string(item.Provider) == provider:
+		score++
+	default:
+		return 0, false
+	}
+	switch item.Datacenter {
+	case "":
+	case datacenter:
+		score += 2
+	default:
+		return 0, false
+	}
+	switch item.Kind {
+	case pricemodels.PriceItemKindMachineClass:
+		if item.MachineClass != class {
+			return 0, false
+		}
+	case pricemodels.PriceItemKindStorage:
+		switch item.StorageClass {
+		case "":
+		case class:
+			score += 4
+		default:
+			return 0, false
+		}
+	}
+	return score, true
+}
+
+// changes returns the times within the period a price item becomes
+// effective.
+func (c *Catalogue) changes(period pricemodels.BillingPeriod) []time.Time {
+	var changes []time.Time
+	for _, item := range c.items {
+		if item.EffectiveFrom.After(period.From) && item.EffectiveFrom.Before(period.To) {
+			changes = append(changes, item.EffectiveFrom)
+		}
+	}
+	return changes
+}
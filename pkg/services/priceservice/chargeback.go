@@ -0,0 +1,214 @@
+package priceservice
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/NorskHelsenett/ror-api/internal/acl/aclservice"
+	clustersrepo "github.com/NorskHelsenett/ror-api/internal/databases/mongodb/repositories/clusters"
+	"github.com/NorskHelsenett/ror-api/internal/databases/mongodb/repositories/metrics"
+	"github.com/NorskHelsenett/ror-api/internal/models/pricemodels"
+
+	"github.com/NorskHelsenett/ror/pkg/models/aclmodels"
+)
+
+const chargebackMonthLayout = "2006-01"
+
+// ChargebackHeader is the header of the rows of ChargebackRows.
+var ChargebackHeader = []any{
+	"Month", "Project id", "Project", "Cost centre", "Workspace",
+	"Cluster uid", "Cluster id", "Cluster name", "Provider", "Datacenter",
+	"Hours", "vCPU hours", "Memory GiB hours", "vCPU cost", "Memory cost", "Cost", "Currency",
+}
+
+// ChargebackPeriod returns the period of the month, formatted as 2006-01. The
+// period defaults to the previous month.
+func ChargebackPeriod(month string) (pricemodels.BillingPeriod, error) {
+	var from time.Time
+	if month == "" {
+		now := time.Now().UTC()
+		from = time.Date(now.Year(), now.Month()-1, 1, 0, 0, 0, 0, time.UTC)
+	} else {
+		parsed, err := time.Parse(chargebackMonthLayout, month)
+		if err != nil {
+			return pricemodels.BillingPeriod{}, fmt.Errorf("%w: month must be formatted as %s", ErrInvalidPeriod, chargebackMonthLayout)
+		}
+		from = parsed
+	}
+	return pricemodels.BillingPeriod{From: from, To: from.AddDate(0, 1, 0)}, nil
+}
+
+// GetChargebackReport returns the chargeback report for the period of the
+// clusters the identity can read. Identities without read access to ror
+// globally only get the projects they can read.
+func GetChargebackReport(ctx context.Context, period pricemodels.BillingPeriod) (*pricemodels.ChargebackReport, error) {
+	clusters, err := clustersrepo.GetBillingClusters(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Access check
+	// Scope: project
+	// Subject: project of each cluster
+	// Access: read
+	globalQuery := aclmodels.NewAclV2QueryAccessScopeSubject(aclmodels.Acl2ScopeRor, aclmodels.Acl2RorSubjectGlobal)
+	if !aclservice.CheckAccessByContextAclQuery(ctx, globalQuery).Read {
+		projectAccess := make(map[string]bool)
+		clusters = slices.DeleteFunc(clusters, func(cluster clustersrepo.BillingCluster) bool {
+			if cluster.ProjectId == "" {
+				return true
+			}
+			access, ok := projectAccess[cluster.ProjectId]
+			if !ok {
+				projectQuery := aclmodels.NewAclV2QueryAccessScopeSubject(aclmodels.Acl2ScopeProject, aclmodels.Acl2Subject(cluster.ProjectId))
+				access = aclservice.CheckAccessByContextAclQuery(ctx, projectQuery).Read
+				projectAccess[cluster.ProjectId] = access
+			}
+			return !access
+		})
+	}
+
+	allocations, err := metrics.GetDailyAllocation(ctx, period.From, period.To)
+	if err != nil {
+		return nil, err
+	}
+	return GetCatalogue(ctx).Chargeback(period, clusters, allocations)
+}
+
+// Chargeback returns the chargeback report of the clusters from their
+// allocation. The vCPU hours and memory GiB hours of each day are priced with
+// the cpu and memory rates effective that day, prorated by the hours of a
+// month. Allocations of clusters not in clusters are left out.
+func (c *Catalogue) Chargeback(period pricemodels.BillingPeriod, clusters []clustersrepo.BillingCluster, allocations []metrics.DailyAllocation) (*pricemodels.ChargebackReport, error) {
+	byId := make(map[string]int, len(clusters)*2)
+	for i, cluster := range clusters {
+		if cluster.ClusterId != "" {
+			byId[cluster.ClusterId] = i
+		}
+		if cluster.Uid != "" {
+			byId[cluster.Uid] = i
+		}
+	}
+
+	lines := make(map[int]*pricemodels.ChargebackLine)
+	for _, allocation := range allocations {
+		i, ok := byId[allocation.ClusterId]
+		if !ok {
+			continue
+		}
+		cluster := clusters[i]
+		line, ok := lines[i]
+		if !ok {
+			line = &pricemodels.ChargebackLine{
+				ClusterUid:  cluster.Uid,
+				ClusterId:   cluster.ClusterId,
+				ClusterName: cluster.ClusterName,
+				Provider:    cluster.Provider,
+				Datacenter:  cluster.Datacenter,
+			}
+			lines[i] = line
+		}
+
+		memoryGiBHours := allocation.MemoryByteHours / bytesPerGiB
+		line.Hours += float64(allocation.Hours)
+		line.CpuCoreHours += allocation.CpuCoreHours
+		line.MemoryGiBHours += memoryGiBHours
+
+		cpuItem, cpuOk := c.resolve(pricemodels.PriceItemKindCpu, cluster.Provider, cluster.Datacenter, "", allocation.Day)
+		memoryItem, memoryOk := c.resolve(pricemodels.PriceItemKindMemory, cluster.Provider, cluster.Datacenter, "", allocation.Day)
+		if !cpuOk || !memoryOk || cpuItem.Currency != memoryItem.Currency {
+			line.Unpriced = true
+			continue
+		}
+		if line.Currency == "" {
+			line.Currency = cpuItem.Currency
+		} else if line.Currency != cpuItem.Currency {
+			return nil, fmt.Errorf("%w: %s and %s for cluster %s", ErrMixedCurrency, line.Currency, cpuItem.Currency, cluster.ClusterId)
+		}
+		line.CpuCost += allocation.CpuCoreHours * cpuItem.Price / hoursPerMonth
+		line.MemoryCost += memoryGiBHours * memoryItem.Price / hoursPerMonth
+	}
+
+	report := &pricemodels.ChargebackReport{
+		Period:   period,
+		Totals:   make(map[string]float64),
+		Projects: make([]pricemodels.ChargebackProject, 0),
+	}
+	projects := make(map[string]*pricemodels.ChargebackProject)
+	workspaces := make(map[[2]string]*pricemodels.ChargebackWorkspace)
+	for i, line := range lines {
+		cluster := clusters[i]
+		line.CpuCoreHours = round(line.CpuCoreHours)
+		line.MemoryGiBHours = round(line.MemoryGiBHours)
+		line.CpuCost = round(line.CpuCost)
+		line.MemoryCost = round(line.MemoryCost)
+		line.Cost = round(line.CpuCost + line.MemoryCost)
+
+		project, ok := projects[cluster.ProjectId]
+		if !ok {
+			project = &pricemodels.ChargebackProject{
+				ProjectId:   cluster.ProjectId,
+				ProjectName: cluster.ProjectName,
+				CostCentre:  cluster.CostCentre,
+				Totals:      make(map[string]float64),
+			}
+			projects[cluster.ProjectId] = project
+		}
+		key := [2]string{cluster.ProjectId, cluster.Workspace}
+		workspace, ok := workspaces[key]
+		if !ok {
+			workspace = &pricemodels.ChargebackWorkspace{
+				Workspace: cluster.Workspace,
+				Totals:    make(map[string]float64),
+			}
+			workspaces[key] = workspace
+		}
+
+		workspace.Clusters = append(workspace.Clusters, *line)
+		if line.Currency != "" {
+			workspace.Totals[line.Currency] = round(workspace.Totals[line.Currency] + line.Cost)
+			project.Totals[line.Currency] = round(project.Totals[line.Currency] + line.Cost)
+			report.Totals[line.Currency] = round(report.Totals[line.Currency] + line.Cost)
+		}
+	}
+
+	for key, workspace := range workspaces {
+		slices.SortFunc(workspace.Clusters, func(a, b pricemodels.ChargebackLine) int {
+			return cmp.Compare(a.ClusterId, b.ClusterId)
+		})
+		project := projects[key[0]]
+		project.Workspaces = append(project.Workspaces, *workspace)
+	}
+	for _, project := range projects {
+		slices.SortFunc(project.Workspaces, func(a, b pricemodels.ChargebackWorkspace) int {
+			return cmp.Compare(a.Workspace, b.Workspace)
+		})
+		report.Projects = append(report.Projects, *project)
+	}
+	slices.SortFunc(report.Projects, func(a, b pricemodels.ChargebackProject) int {
+		return cmp.Or(cmp.Compare(a.ProjectName, b.ProjectName), cmp.Compare(a.ProjectId, b.ProjectId))
+	})
+	return report, nil
+}
+
+// ChargebackRows returns a row per cluster of the report, for CSV and XLSX
+// exports with ChargebackHeader.
+func ChargebackRows(report *pricemodels.ChargebackReport) [][]any {
+	month := report.Period.From.Format(chargebackMonthLayout)
+	rows := make([][]any, 0)
+	for _, project := range report.Projects {
+		for _, workspace := range project.Workspaces {
+			for _, line := range workspace.Clusters {
+				rows = append(rows, []any{
+					month, project.ProjectId, project.ProjectName, project.CostCentre, workspace.Workspace,
+					line.ClusterUid, line.ClusterId, line.ClusterName, line.Provider, line.Datacenter,
+					line.Hours, line.CpuCoreHours, line.MemoryGiBHours, line.CpuCost, line.MemoryCost, line.Cost, line.Currency,
+				})
+			}
+		}
+	}
+	return rows
+}
@@ -0,0 +1,82 @@
+package priceservice
+
+import (
+	"testing"
+	"time"
+
+	clustersrepo "github.com/NorskHelsenett/ror-api/internal/databases/mongodb/repositories/clusters"
+	"github.com/NorskHelsenett/ror-api/internal/databases/mongodb/repositories/metrics"
+	"github.com/NorskHelsenett/ror-api/internal/models/pricemodels"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChargeback(t *testing.T) {
+	catalogue := NewCatalogue([]pricemodels.PriceItem{
+		{Kind: pricemodels.PriceItemKindCpu, Price: hoursPerMonth, EffectiveFrom: jan},
+		{Kind: pricemodels.PriceItemKindMemory, Price: hoursPerMonth / 10, EffectiveFrom: jan},
+	}, "NOK")
+	clusters := []clustersrepo.BillingCluster{
+		{Uid: "uid-a", ClusterId: "a", ProjectId: "p1", ProjectName: "Alpha", CostCentre: "W1", Workspace: "ws2"},
+		{Uid: "uid-b", ClusterId: "b", ProjectId: "p1", ProjectName: "Alpha", CostCentre: "W1", Workspace: "ws1"},
+		{Uid: "uid-c", ClusterId: "c", Workspace: "ws1"},
+	}
+	day := jan.AddDate(0, 0, 1)
+	allocations := []metrics.DailyAllocation{
+		{ClusterId: "a", Day: day, Hours: 24, CpuCoreHours: 48, MemoryByteHours: 96 * bytesPerGiB},
+		{ClusterId: "uid-a", Day: day.AddDate(0, 0, 1), Hours: 1, CpuCoreHours: 2},
+		{ClusterId: "b", Day: day, Hours: 10, CpuCoreHours: 10, MemoryByteHours: 10 * bytesPerGiB},
+		{ClusterId: "unknown", Day: day, Hours: 24, CpuCoreHours: 24},
+	}
+
+	report, err := catalogue.Chargeback(pricemodels.BillingPeriod{From: jan, To: feb}, clusters, allocations)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]float64{"NOK": 70.6}, report.Totals)
+	assert.Len(t, report.Projects, 1)
+
+	project := report.Projects[0]
+	assert.Equal(t, "W1", project.CostCentre)
+	assert.Len(t, project.Workspaces, 2)
+	assert.Equal(t, "ws1", project.Workspaces[0].Workspace)
+	assert.Equal(t, 11.0, project.Workspaces[0].Clusters[0].Cost)
+
+	line := project.Workspaces[1].Clusters[0]
+	assert.Equal(t, "a", line.ClusterId)
+	assert.Equal(t, 25.0, line.Hours)
+	assert.Equal(t, 50.0, line.CpuCost)
+	assert.Equal(t, 9.6, line.MemoryCost)
+	assert.Equal(t, 59.6, line.Cost)
+	assert.Equal(t, "NOK", line.Currency)
+
+	rows := ChargebackRows(report)
+	assert.Len(t, rows, 2)
+	assert.Len(t, rows[0], len(ChargebackHeader))
+	assert.Equal(t, "2025-01", rows[0][0])
+}
+
+func TestChargebackUnpriced(t *testing.T) {
+	catalogue := NewCatalogue([]pricemodels.PriceItem{
+		{Kind: pricemodels.PriceItemKindCpu, Price: 100, EffectiveFrom: feb},
+		{Kind: pricemodels.PriceItemKindMemory, Price: 10, EffectiveFrom: feb},
+	}, "NOK")
+	clusters := []clustersrepo.BillingCluster{{ClusterId: "a"}}
+	allocations := []metrics.DailyAllocation{{ClusterId: "a", Day: jan, Hours: 24, CpuCoreHours: 24}}
+
+	report, err := catalogue.Chargeback(pricemodels.BillingPeriod{From: jan, To: feb}, clusters, allocations)
+	assert.NoError(t, err)
+	assert.Empty(t, report.Totals)
+	assert.True(t, report.Projects[0].Workspaces[0].Clusters[0].Unpriced)
+}
+
+func TestChargebackPeriod(t *testing.T) {
+	period, err := ChargebackPeriod("2025-01")
+	assert.NoError(t, err)
+	assert.Equal(t, pricemodels.BillingPeriod{From: jan, To: feb}, period)
+
+	period, err = ChargebackPeriod("")
+	assert.NoError(t, err)
+	assert.True(t, period.To.Before(time.Now()))
+
+	_, err = ChargebackPeriod("january")
+	assert.ErrorIs(t, err, ErrInvalidPeriod)
+}
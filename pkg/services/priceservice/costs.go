@@ -0,0 +1,94 @@
+package priceservice
+
+import (
+	"context"
+	"errors"
+
+	"github.com/NorskHelsenett/ror-api/internal/apiservices/resourcesv2service"
+	"github.com/NorskHelsenett/ror-api/internal/models/pricemodels"
+
+	"github.com/NorskHelsenett/ror/pkg/rorresources"
+	"github.com/NorskHelsenett/ror/pkg/rorresources/rortypes"
+)
+
+const (
+	CostScopeWorkspace = "workspace"
+	CostScopeProject   = "project"
+
+	costSummaryLimit = 1000
+)
+
+// ErrNotFound is returned when the cluster or price item does not exist, or
+// the identity can not read the cluster.
+var ErrNotFound = errors.New("not found")
+
+// GetClusterCost returns the cost of the cluster with the uid for the
+// period. Only clusters the identity can read are found.
+func GetClusterCost(ctx context.Context, uid string, period pricemodels.BillingPeriod) (*pricemodels.ClusterCost, error) {
+	resources, err := resourcesv2service.GetResourceByQuery(ctx, &rorresources.ResourceQuery{
+		VersionKind: rortypes.ResourceKubernetesClusterGVK,
+		Uids:        []string{uid},
+		Limit:       1,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if resources == nil || len(resources.Resources) == 0 {
+		return nil, ErrNotFound
+	}
+
+	resource := resources.Resources[0]
+	cost, err := GetCatalogue(ctx).ClusterCost(ClusterFromResource(resource.Metadata.UID, resource.KubernetesClusterResource), period)
+	if err != nil {
+		return nil, err
+	}
+	return &cost, nil
+}
+
+// GetCostSummary returns the cost of the clusters of the workspace or project
+// for the period, of the clusters the identity can read.
+func GetCostSummary(ctx context.Context, scope string, subject string, period pricemodels.BillingPeriod) (*pricemodels.CostSummary, error) {
+	resources, err := resourcesv2service.GetResourceByQuery(ctx, &rorresources.ResourceQuery{
+		VersionKind: rortypes.ResourceKubernetesClusterGVK,
+		Limit:       costSummaryLimit,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	summary := &pricemodels.CostSummary{
+		Scope:    scope,
+		Subject:  subject,
+		Period:   period,
+		Totals:   make(map[string]float64),
+		Clusters: make([]pricemodels.ClusterCost, 0),
+	}
+	if resources == nil {
+		return summary, nil
+	}
+
+	catalogue := GetCatalogue(ctx)
+	for _, resource := range resources.Resources {
+		cluster := ClusterFromResource(resource.Metadata.UID, resource.KubernetesClusterResource)
+		switch scope {
+		case CostScopeWorkspace:
+			if cluster.Workspace != subject {
+				continue
+			}
+		case CostScopeProject:
+			if cluster.Project != subject {
+				continue
+			}
+		default:
+			return nil, errors.New("unknown cost scope " + scope)
+		}
+
+		cost, err := catalogue.ClusterCost(cluster, period)
+		if err != nil {
+			return nil, err
+		}
+		summary.Clusters = append(summary.Clusters, cost)
+		summary.Totals[cost.Currency] = round(summary.Totals[cost.Currency] + cost.Total)
+	}
+	return summary, nil
+}
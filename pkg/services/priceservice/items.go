@@ -0,0 +1,61 @@
+package priceservice
+
+import (
+	"context"
+	"time"
+
+	"github.com/NorskHelsenett/ror-api/internal/databases/mongodb/repositories/priceitems"
+	"github.com/NorskHelsenett/ror-api/internal/models/pricemodels"
+)
+
+func GetPriceItems(ctx context.Context) ([]pricemodels.PriceItem, error) {
+	return priceitems.GetAll(ctx)
+}
+
+// CreatePriceItem adds the item to the catalogue. Items without a currency
+// are in PRICE_CURRENCY.
+func CreatePriceItem(ctx context.Context, item pricemodels.PriceItem, by string) (*pricemodels.PriceItem, error) {
+	created, err := priceitems.Create(ctx, stamp(item, by))
+	if err != nil {
+		return nil, err
+	}
+	invalidateCatalogue()
+	return created, nil
+}
+
+// UpdatePriceItem replaces the item and returns it with the item it
+// replaced.
+func UpdatePriceItem(ctx context.Context, id string, item pricemodels.PriceItem, by string) (*pricemodels.PriceItem, *pricemodels.PriceItem, error) {
+	item = stamp(item, by)
+	original, err := priceitems.Update(ctx, id, item)
+	if err != nil {
+		return nil, nil, err
+	}
+	if original == nil {
+		return nil, nil, ErrNotFound
+	}
+	invalidateCatalogue()
+	item.Id = original.Id
+	return &item, original, nil
+}
+
+func DeletePriceItem(ctx context.Context, id string) (*pricemodels.PriceItem, error) {
+	original, err := priceitems.Delete(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if original == nil {
+		return nil, ErrNotFound
+	}
+	invalidateCatalogue()
+	return original, nil
+}
+
+func stamp(item pricemodels.PriceItem, by string) pricemodels.PriceItem {
+	if item.Currency == "" {
+		item.Currency = defaultCurrency()
+	}
+	item.UpdatedBy = by
+	item.Updated = time.Now()
+	return item
+}
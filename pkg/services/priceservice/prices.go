@@ -1,20 +1,288 @@
 package priceservice
 
 import (
+	"errors"
+	"fmt"
 	"math"
+	"slices"
+	"time"
 
+	"github.com/NorskHelsenett/ror-api/internal/helpers/mapping"
+	"github.com/NorskHelsenett/ror-api/internal/models/pricemodels"
+
+	"github.com/NorskHelsenett/ror/pkg/rlog"
 	"github.com/NorskHelsenett/ror/pkg/rorresources/rortypes"
+
+	apimachinery "k8s.io/apimachinery/pkg/api/resource"
 )
 
 const (
-	PriceMemoryPrGiB = 59.50
-	PriceCpuPrCore   = 269.50
+	// hoursPerMonth is the average length of a month, monthly prices are
+	// prorated by it.
+	hoursPerMonth = 730
+	bytesPerGiB   = 1 << 30
+)
+
+var (
+	ErrInvalidPeriod = errors.New("the billing period must end after it starts")
+	ErrMixedCurrency = errors.New("the cluster is priced in more than one currency")
 )
 
-func CalculatePrice(cluster *rortypes.ResourceKubernetesCluster) float64 {
-	clusterStatus := cluster.Status.AgentStatus
-	cpuPrice := float64(clusterStatus.GetTotalCpu().Value()) * PriceCpuPrCore
-	memoryPrice := float64(clusterStatus.GetTotalMemory().Value()/(1024*1024*1024)) * PriceMemoryPrGiB
+// Cluster is the part of a cluster that is priced.
+type Cluster struct {
+	Uid        string
+	ClusterId  string
+	Workspace  string
+	Project    string
+	Provider   string
+	Datacenter string
+	NodePools  []NodePool
+}
+
+// NodePool is a priced node pool. Cpu and MemoryGiB are the size of a node,
+// used with the cpu and memory rates when the machine class is not in the
+// catalogue.
+type NodePool struct {
+	Name         string
+	MachineClass string
+	Nodes        int64
+	Cpu          float64
+	MemoryGiB    float64
+	Storage      []Volume
+}
+
+// Volume is storage of a node of a node pool.
+type Volume struct {
+	Class   string
+	SizeGiB float64
+}
+
+// CalculatePrice returns the monthly price of the cluster with the current
+// prices.
+func (c *Catalogue) CalculatePrice(cluster *rortypes.ResourceKubernetesCluster) float64 {
+	priced := ClusterFromResource("", cluster)
+	var total float64
+	for _, line := range costLines(priced) {
+		price, _, ok := c.monthlyPrice(priced, line, time.Now())
+		if ok {
+			total += price
+		}
+	}
+	return math.Round(total)
+}
+
+// ClusterCost returns the cost of the cluster for the period. Monthly prices
+// are prorated by the hours of the period, split where a price changes.
+// Lines without a price for part of the period are marked as unpriced.
+func (c *Catalogue) ClusterCost(cluster Cluster, period pricemodels.BillingPeriod) (pricemodels.ClusterCost, error) {
+	cost := pricemodels.ClusterCost{
+		ClusterUid: cluster.Uid,
+		ClusterId:  cluster.ClusterId,
+		Workspace:  cluster.Workspace,
+		Project:    cluster.Project,
+		Provider:   cluster.Provider,
+		Datacenter: cluster.Datacenter,
+		Period:     period,
+		Lines:      costLines(cluster),
+	}
+	if !period.To.After(period.From) {
+		return cost, ErrInvalidPeriod
+	}
+
+	boundaries := append([]time.Time{period.From, period.To}, c.changes(period)...)
+	slices.SortFunc(boundaries, func(a, b time.Time) int { return a.Compare(b) })
+	boundaries = slices.CompactFunc(boundaries, func(a, b time.Time) bool { return a.Equal(b) })
+
+	for i := 0; i+1 < len(boundaries); i++ {
+		months := boundaries[i+1].Sub(boundaries[i]).Hours() / hoursPerMonth
+		for j := range cost.Lines {
+			line := &cost.Lines[j]
+			price, currency, ok := c.monthlyPrice(cluster, *line, boundaries[i])
+			if !ok {
+				line.Unpriced = true
+				continue
+			}
+			if cost.Currency == "" {
+				cost.Currency = currency
+			} else if currency != cost.Currency {
+				return cost, fmt.Errorf("%w: %s and %s", ErrMixedCurrency, cost.Currency, currency)
+			}
+			line.Cost += price * months
+		}
+	}
+
+	for i := range cost.Lines {
+		cost.Lines[i].Cost = round(cost.Lines[i].Cost)
+		cost.Total += cost.Lines[i].Cost
+	}
+	cost.Total = round(cost.Total)
+	return cost, nil
+}
+
+// costLines returns a line for the nodes of each node pool and for each
+// storage class of each node pool.
+func costLines(cluster Cluster) []pricemodels.CostLine {
+	lines := make([]pricemodels.CostLine, 0, len(cluster.NodePools))
+	for _, nodePool := range cluster.NodePools {
+		lines = append(lines, pricemodels.CostLine{
+			NodePool:     nodePool.Name,
+			Kind:         pricemodels.PriceItemKindMachineClass,
+			MachineClass: nodePool.MachineClass,
+			Quantity:     float64(nodePool.Nodes),
+		})
+		storage := make(map[string]float64)
+		var classes []string
+		for _, volume := range nodePool.Storage {
+			if _, ok := storage[volume.Class]; !ok {
+				classes = append(classes, volume.Class)
+			}
+			storage[volume.Class] += volume.SizeGiB * float64(nodePool.Nodes)
+		}
+		for _, class := range classes {
+			lines = append(lines, pricemodels.CostLine{
+				NodePool:     nodePool.Name,
+				Kind:         pricemodels.PriceItemKindStorage,
+				StorageClass: class,
+				Quantity:     storage[class],
+			})
+		}
+	}
+	return lines
+}
+
+// monthlyPrice returns the monthly price of the line at the time and its
+// currency, or false if the line can not be priced. Nodes are priced by
+// their machine class, or by their cpu and memory when the machine class has
+// no price.
+func (c *Catalogue) monthlyPrice(cluster Cluster, line pricemodels.CostLine, at time.Time) (float64, string, bool) {
+	if line.Kind == pricemodels.PriceItemKindStorage {
+		item, ok := c.resolve(pricemodels.PriceItemKindStorage, cluster.Provider, cluster.Datacenter, line.StorageClass, at)
+		if !ok {
+			return 0, "", false
+		}
+		return item.Price * line.Quantity, item.Currency, true
+	}
+
+	var nodePool NodePool
+	for _, pool := range cluster.NodePools {
+		if pool.Name == line.NodePool {
+			nodePool = pool
+			break
+		}
+	}
+	cpu, memory := nodePool.Cpu, nodePool.MemoryGiB
+	if nodePool.MachineClass != "" {
+		item, ok := c.resolve(pricemodels.PriceItemKindMachineClass, cluster.Provider, cluster.Datacenter, nodePool.MachineClass, at)
+		if ok && item.Price > 0 {
+			return item.Price * line.Quantity, item.Currency, true
+		}
+		if ok {
+			cpu, memory = float64(item.Cpu), float64(item.MemoryGiB)
+		}
+	}
+	if cpu <= 0 && memory <= 0 {
+		return 0, "", false
+	}
+
+	cpuItem, cpuOk := c.resolve(pricemodels.PriceItemKindCpu, cluster.Provider, cluster.Datacenter, "", at)
+	memoryItem, memoryOk := c.resolve(pricemodels.PriceItemKindMemory, cluster.Provider, cluster.Datacenter, "", at)
+	if !cpuOk || !memoryOk || cpuItem.Currency != memoryItem.Currency {
+		return 0, "", false
+	}
+	return (cpu*cpuItem.Price + memory*memoryItem.Price) * line.Quantity, cpuItem.Currency, true
+}
+
+func round(value float64) float64 {
+	return math.Round(value*100) / 100
+}
+
+// kubernetesClusterSpec is the part of the spec of a KubernetesCluster
+// resource that is priced.
+type kubernetesClusterSpec struct {
+	Data struct {
+		ClusterId  string `json:"clusterId"`
+		Datacenter string `json:"datacenter"`
+		Project    string `json:"project"`
+		Provider   string `json:"provider"`
+		Workspace  string `json:"workspace"`
+	} `json:"data"`
+	Topology struct {
+		ControlPlane kubernetesNodePool `json:"controlplane"`
+		Workers      struct {
+			NodePools []kubernetesNodePool `json:"nodePools"`
+		} `json:"workers"`
+	} `json:"topology"`
+}
+
+type kubernetesNodePool struct {
+	Name         string `json:"name"`
+	MachineClass string `json:"machineClass"`
+	Replicas     int64  `json:"replicas"`
+	Storage      []struct {
+		Class string `json:"class"`
+		Size  string `json:"size"`
+	} `json:"storage"`
+}
+
+// ClusterFromResource returns the priced part of a KubernetesCluster
+// resource, the control plane and worker node pools of its topology. Clusters
+// without a topology, such as clusters registered by an agent, are priced as
+// one node with the cpu and memory reported by the agent.
+func ClusterFromResource(uid string, cluster *rortypes.ResourceKubernetesCluster) Cluster {
+	var spec kubernetesClusterSpec
+	if err := mapping.Map(cluster.Spec, &spec); err != nil {
+		rlog.Error("could not map kubernetes cluster spec", err, rlog.String("uid", uid))
+	}
+	agent := cluster.Status.AgentStatus
+	priced := Cluster{
+		Uid:        uid,
+		ClusterId:  firstOf(spec.Data.ClusterId, agent.ClusterId),
+		Workspace:  firstOf(spec.Data.Workspace, agent.Workspace),
+		Project:    spec.Data.Project,
+		Provider:   firstOf(spec.Data.Provider, agent.KubernetesProvider.String()),
+		Datacenter: firstOf(spec.Data.Datacenter, agent.Datacenter),
+	}
+
+	controlPlane := spec.Topology.ControlPlane
+	if controlPlane.Name == "" {
+		controlPlane.Name = "controlplane"
+	}
+	for _, nodePool := range append([]kubernetesNodePool{controlPlane}, spec.Topology.Workers.NodePools...) {
+		if nodePool.Replicas <= 0 {
+			continue
+		}
+		pool := NodePool{
+			Name:         nodePool.Name,
+			MachineClass: nodePool.MachineClass,
+			Nodes:        nodePool.Replicas,
+		}
+		for _, storage := range nodePool.Storage {
+			size, err := apimachinery.ParseQuantity(storage.Size)
+			if err != nil {
+				rlog.Warn("could not parse storage size", rlog.String("uid", uid), rlog.String("size", storage.Size))
+				continue
+			}
+			pool.Storage = append(pool.Storage, Volume{Class: storage.Class, SizeGiB: float64(size.Value()) / bytesPerGiB})
+		}
+		priced.NodePools = append(priced.NodePools, pool)
+	}
+
+	if len(priced.NodePools) == 0 {
+		priced.NodePools = []NodePool{{
+			Name:      "cluster",
+			Nodes:     1,
+			Cpu:       float64(agent.GetTotalCpu().Value()),
+			MemoryGiB: float64(agent.GetTotalMemory().Value()) / bytesPerGiB,
+		}}
+	}
+	return priced
+}
 
-	return math.Round(cpuPrice) + math.Round(memoryPrice)
+func firstOf(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
 }
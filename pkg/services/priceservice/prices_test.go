@@ -0,0 +1,77 @@
+package priceservice
+
+import (
+	"testing"
+	"time"
+
+	"github.com/NorskHelsenett/ror-api/internal/models/pricemodels"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	jan = time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC)
+	feb = time.Date(2025, time.February, 1, 0, 0, 0, 0, time.UTC)
+)
+
+func testCluster() Cluster {
+	return Cluster{
+		Uid:        "uid",
+		Provider:   "tanzu",
+		Datacenter: "trd1",
+		NodePools: []NodePool{
+			{Name: "controlplane", MachineClass: "small", Nodes: 3, Storage: []Volume{{Class: "fast", SizeGiB: 10}}},
+			{Name: "workers", MachineClass: "custom", Nodes: 2, Cpu: 4, MemoryGiB: 16},
+		},
+	}
+}
+
+func TestClusterCost(t *testing.T) {
+	catalogue := NewCatalogue([]pricemodels.PriceItem{
+		{Kind: pricemodels.PriceItemKindMachineClass, MachineClass: "small", Price: 1000, EffectiveFrom: jan},
+		{Kind: pricemodels.PriceItemKindCpu, Price: 100, EffectiveFrom: jan},
+		{Kind: pricemodels.PriceItemKindMemory, Price: 10, EffectiveFrom: jan},
+		{Kind: pricemodels.PriceItemKindMemory, Provider: "tanzu", Price: 20, EffectiveFrom: jan},
+		{Kind: pricemodels.PriceItemKindStorage, Datacenter: "trd1", Price: 2, EffectiveFrom: jan},
+		{Kind: pricemodels.PriceItemKindStorage, Datacenter: "osl1", Price: 5, EffectiveFrom: jan},
+	}, "NOK")
+
+	period := pricemodels.BillingPeriod{From: jan, To: jan.Add(hoursPerMonth * time.Hour)}
+	cost, err := catalogue.ClusterCost(testCluster(), period)
+	assert.NoError(t, err)
+	assert.Equal(t, "NOK", cost.Currency)
+	assert.Len(t, cost.Lines, 3)
+	assert.Equal(t, 3000.0, cost.Lines[0].Cost)
+	assert.Equal(t, 60.0, cost.Lines[1].Cost)
+	assert.Equal(t, 2*(4*100.0+16*20.0), cost.Lines[2].Cost)
+	assert.Equal(t, 4500.0, cost.Total)
+}
+
+func TestClusterCostPriceChange(t *testing.T) {
+	middle := jan.Add(hoursPerMonth / 2 * time.Hour)
+	catalogue := NewCatalogue([]pricemodels.PriceItem{
+		{Kind: pricemodels.PriceItemKindMachineClass, MachineClass: "small", Price: 100, EffectiveFrom: jan},
+		{Kind: pricemodels.PriceItemKindMachineClass, MachineClass: "small", Price: 200, EffectiveFrom: middle},
+	}, "NOK")
+
+	cost, err := catalogue.ClusterCost(testCluster(), pricemodels.BillingPeriod{From: jan, To: jan.Add(hoursPerMonth * time.Hour)})
+	assert.NoError(t, err)
+	assert.Equal(t, 3*150.0, cost.Lines[0].Cost)
+	assert.True(t, cost.Lines[1].Unpriced)
+	assert.True(t, cost.Lines[2].Unpriced)
+	assert.Equal(t, 450.0, cost.Total)
+}
+
+func TestClusterCostErrors(t *testing.T) {
+	catalogue := NewCatalogue([]pricemodels.PriceItem{
+		{Kind: pricemodels.PriceItemKindMachineClass, MachineClass: "small", Price: 100, Currency: "EUR", EffectiveFrom: jan},
+		{Kind: pricemodels.PriceItemKindCpu, Price: 100, EffectiveFrom: jan},
+		{Kind: pricemodels.PriceItemKindMemory, Price: 10, EffectiveFrom: jan},
+	}, "NOK")
+
+	_, err := catalogue.ClusterCost(testCluster(), pricemodels.BillingPeriod{From: jan, To: feb})
+	assert.ErrorIs(t, err, ErrMixedCurrency)
+
+	_, err = catalogue.ClusterCost(testCluster(), pricemodels.BillingPeriod{From: feb, To: jan})
+	assert.ErrorIs(t, err, ErrInvalidPeriod)
+}
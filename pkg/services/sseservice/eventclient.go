@@ -1,14 +1,24 @@
 package sseservice
 
 import (
+	"slices"
 	"sync"
 
+	"github.com/NorskHelsenett/ror/pkg/models/aclmodels/rorresourceowner"
 	identitymodels "github.com/NorskHelsenett/ror/pkg/models/identity"
 )
 
+// SseEvent is an event sent to clients. Events with topics are only sent to
+// clients subscribed to one of them, events without topics to all clients.
+// Clients must have read access to the owner and to the clusters of cluster
+// topics to receive the event. Events published through PublishEvent have an
+// id, which clients resume from with the Last-Event-ID header.
 type SseEvent struct {
-	Event string `json:"event"`
-	Data  string `json:"data" validate:"required"`
+	Id     int64                                       `json:"id,omitempty"`
+	Event  string                                      `json:"event"`
+	Data   string                                      `json:"data" validate:"required"`
+	Topics []Subscription                              `json:"topics,omitempty"`
+	Owner  *rorresourceowner.RorResourceOwnerReference `json:"owner,omitempty"`
 }
 
 type SSESubscribe struct {
@@ -16,17 +26,40 @@ type SSESubscribe struct {
 	Topic    Subscription  `json:"topic" validate:"required"`
 }
 
+// SSESubscriptionMessage changes the subscriptions of a client on the event
+// server holding its connection. It is only applied when the identity matches
+// the identity of the client.
+type SSESubscriptionMessage struct {
+	SSESubscribe
+	IdentityId string `json:"identityId"`
+}
+
 type Subscription string
 
 type EventClientId string
 
 type EventClientChan chan SseEvent
 
+// EventClientBufferSize is the number of events buffered for a client, so
+// the event server does not wait for a client while it is sent the events
+// replayed to it.
+const EventClientBufferSize = 100
+
 type EventClient struct {
 	Id            EventClientId
 	Connection    EventClientChan
 	Identity      identitymodels.Identity
 	Subscriptions []Subscription
+
+	// LastEventId is the id of the last event the client received before it
+	// reconnected, buffered events after it are replayed on connect.
+	LastEventId int64
+
+	subscriptionLock sync.RWMutex
+	access           clientAccess
+
+	// added is closed by the event server when the client has been added.
+	added chan struct{}
 }
 
 type EventClients struct {
@@ -92,11 +125,34 @@ func (e *EventClients) GetBroadcast() []EventClientId {
 	return clients
 }
 
+// GetSubscribed returns the clients the event is delivered to.
+func (e *EventClients) GetSubscribed(event SseEvent) []EventClientId {
+	e.lock.RLock()
+	clients := slices.Clone(e.clients)
+	e.lock.RUnlock()
+
+	owners := EventOwners(event)
+	var ids []EventClientId
+	for _, client := range clients {
+		if client.Receives(event.Topics, owners) {
+			ids = append(ids, client.Id)
+		}
+	}
+	return ids
+}
+
 func (e *EventClient) Subscribe(topic Subscription) {
+	e.subscriptionLock.Lock()
+	defer e.subscriptionLock.Unlock()
+	if slices.Contains(e.Subscriptions, topic) {
+		return
+	}
 	e.Subscriptions = append(e.Subscriptions, topic)
 }
 
 func (e *EventClient) Unsubscribe(topic Subscription) {
+	e.subscriptionLock.Lock()
+	defer e.subscriptionLock.Unlock()
 	for i, t := range e.Subscriptions {
 		if t == topic {
 			e.Subscriptions = append(e.Subscriptions[:i], e.Subscriptions[i+1:]...)
@@ -104,3 +160,31 @@ func (e *EventClient) Unsubscribe(topic Subscription) {
 		}
 	}
 }
+
+// Receives reports whether an event on the topics is delivered to the client:
+// it must be subscribed to one of the topics, if any, and have read access to
+// all the owners.
+func (e *EventClient) Receives(topics []Subscription, owners []rorresourceowner.RorResourceOwnerReference) bool {
+	if len(topics) > 0 && !e.subscribedTo(topics) {
+		return false
+	}
+	for _, owner := range owners {
+		if !e.access.canRead(e.Identity, owner) {
+			return false
+		}
+	}
+	return true
+}
+
+func (e *EventClient) subscribedTo(topics []Subscription) bool {
+	e.subscriptionLock.RLock()
+	defer e.subscriptionLock.RUnlock()
+	for _, subscription := range e.Subscriptions {
+		for _, topic := range topics {
+			if subscription.Matches(topic) {
+				return true
+			}
+		}
+	}
+	return false
+}
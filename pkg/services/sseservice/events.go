@@ -0,0 +1,75 @@
+package sseservice
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/NorskHelsenett/ror/pkg/models/aclmodels"
+	"github.com/NorskHelsenett/ror/pkg/models/aclmodels/rorresourceowner"
+)
+
+const (
+	SseEventResourceCreated = "resource.created"
+	SseEventResourceUpdated = "resource.updated"
+	SseEventResourceDeleted = "resource.deleted"
+	SseEventOrderUpdated    = "order.updated"
+	SseEventClusterCreated  = "cluster.created"
+)
+
+// ResourceEventData is the data of resource and order events.
+type ResourceEventData struct {
+	Uid        string `json:"uid"`
+	ApiVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+}
+
+// ClusterEventData is the data of cluster events.
+type ClusterEventData struct {
+	ClusterUid    string `json:"clusterUid"`
+	ClusterId     string `json:"clusterId"`
+	ClusterName   string `json:"clusterName"`
+	WorkspaceName string `json:"workspaceName"`
+}
+
+// NewResourceEvent returns an event about a resource on the resource/<kind>
+// topic and, for resources owned by a cluster, the cluster/<uid> topic.
+func NewResourceEvent(event string, data ResourceEventData, owner rorresourceowner.RorResourceOwnerReference) (SseEvent, error) {
+	topics := []Subscription{ResourceTopic(data.Kind)}
+	if owner.Scope == aclmodels.Acl2ScopeCluster.ToKind() && owner.Subject != "" {
+		topics = append(topics, ClusterTopic(string(owner.Subject)))
+	}
+	return newOwnedEvent(event, data, topics, owner)
+}
+
+// NewOrderEvent returns an event about an order on the order/<uid> topic.
+func NewOrderEvent(event string, data ResourceEventData, owner rorresourceowner.RorResourceOwnerReference) (SseEvent, error) {
+	return newOwnedEvent(event, data, []Subscription{OrderTopic(data.Uid)}, owner)
+}
+
+// NewClusterEvent returns an event about a cluster on the cluster/<uid>
+// topic. Like the resources of the cluster, the event is owned by the cluster
+// uid, not its cluster id.
+func NewClusterEvent(event string, data ClusterEventData) (SseEvent, error) {
+	if data.ClusterUid == "" {
+		return SseEvent{}, errors.New("cluster events must have the cluster uid")
+	}
+	owner := rorresourceowner.RorResourceOwnerReference{
+		Scope:   aclmodels.Acl2ScopeCluster.ToKind(),
+		Subject: aclmodels.Acl2Subject(data.ClusterUid),
+	}
+	return newOwnedEvent(event, data, []Subscription{ClusterTopic(data.ClusterUid)}, owner)
+}
+
+func newOwnedEvent(event string, data any, topics []Subscription, owner rorresourceowner.RorResourceOwnerReference) (SseEvent, error) {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return SseEvent{}, fmt.Errorf("could not marshal event data: %w", err)
+	}
+	return SseEvent{
+		Event:  event,
+		Data:   string(payload),
+		Topics: topics,
+		Owner:  &owner,
+	}, nil
+}
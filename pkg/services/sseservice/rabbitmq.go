@@ -14,7 +14,13 @@ import (
 )
 
 const (
-	SSERouteBroadcast       = "eventv2.broadcast"
+	SSERouteBroadcast = "eventv2.broadcast"
+	// SSERouteClientBroadcast is the route of the events sent by clients of
+	// the api. They are delivered to the event clients like the broadcast
+	// events, but not to the webhooks, which only get the events of ror-api.
+	SSERouteClientBroadcast = "eventv2.clientbroadcast"
+	SSERouteSubscribe       = "eventv2.subscribe"
+	SSERouteUnsubscribe     = "eventv2.unsubscribe"
 	SSEventsExchange        = "ror.eventsv2"
 	SSEventsQueueNamePrefix = "sse-events-v2"
 )
@@ -51,12 +57,18 @@ type ssemessagehandler struct {
 
 func (amh ssemessagehandler) HandleMessage(ctx context.Context, message amqp091.Delivery) error {
 	switch message.RoutingKey {
-	case SSERouteBroadcast:
+	case SSERouteBroadcast, SSERouteClientBroadcast:
 		err := HandleSSEEvent(ctx, message)
 		if err != nil {
 			rlog.Error("could not handle event", err)
 			return err
 		}
+	case SSERouteSubscribe, SSERouteUnsubscribe:
+		err := HandleSSESubscription(ctx, message)
+		if err != nil {
+			rlog.Error("could not handle subscription", err)
+			return err
+		}
 	default:
 		rlog.Debugc(ctx, "could not handle message")
 	}
@@ -74,9 +86,47 @@ func HandleSSEEvent(ctx context.Context, message amqp091.Delivery) error {
 	if err != nil {
 		return err
 	}
+	// The event is buffered before it is routed, see EventServer.replay.
+	if sseEvent.Id != 0 {
+		Server.history.add(sseEvent)
+	}
+	clients := Server.Clients.GetSubscribed(sseEvent)
+	if len(clients) == 0 {
+		return nil
+	}
 	Server.Message <- EventMessage{
-		Clients:  Server.Clients.GetBroadcast(),
+		Clients:  clients,
 		SseEvent: sseEvent,
 	}
 	return nil
 }
+
+// HandleSSESubscription subscribes or unsubscribes a client connected to this
+// event server, messages for clients connected elsewhere are ignored.
+func HandleSSESubscription(ctx context.Context, message amqp091.Delivery) error {
+	if message.Body == nil {
+		return errors.New("message.body is nil")
+	}
+
+	var subscription SSESubscriptionMessage
+	err := json.Unmarshal(message.Body, &subscription)
+	if err != nil {
+		return err
+	}
+
+	client := Server.Clients.Get(subscription.ClientId)
+	if client == nil {
+		return nil
+	}
+	if client.Identity.GetId() != subscription.IdentityId {
+		rlog.Warnc(ctx, "ignoring subscription for sse client of another identity", rlog.String("clientId", string(subscription.ClientId)))
+		return nil
+	}
+
+	if message.RoutingKey == SSERouteUnsubscribe {
+		client.Unsubscribe(subscription.Topic)
+	} else {
+		client.Subscribe(subscription.Topic)
+	}
+	return nil
+}
@@ -0,0 +1,149 @@
+package sseservice
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+
+	"github.com/NorskHelsenett/ror/pkg/clients/mongodb"
+	"github.com/NorskHelsenett/ror/pkg/clients/rabbitmqclient"
+	"github.com/NorskHelsenett/ror/pkg/config/rorconfig"
+	"github.com/NorskHelsenett/ror/pkg/rlog"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+const (
+	// SseEventResync tells a reconnecting client that events it missed are
+	// no longer buffered, it must reload the state it displays.
+	SseEventResync = "connection.resync"
+
+	// EVENTCOUNTERCOLLECTION holds the sequence event ids are taken from.
+	EVENTCOUNTERCOLLECTION = "sseeventcounters"
+
+	eventIdCounter          = "eventid"
+	defaultReplayBufferSize = 1000
+)
+
+// PublishEvent gives the event the next event id and sends it to the event
+// servers of all api replicas. Every replica receives the event through the
+// fanout exchange and buffers it, so a client can resume on any of them. If
+// no id can be reserved the event is still sent, but it is not replayed.
+func PublishEvent(ctx context.Context, rabbitMQConnection rabbitmqclient.RabbitMQConnection, event SseEvent) error {
+	return publish(ctx, rabbitMQConnection, event, SSERouteBroadcast)
+}
+
+// PublishClientEvent publishes an event sent by a client of the api like
+// PublishEvent, on the route of client events so it is not posted to the
+// webhooks.
+func PublishClientEvent(ctx context.Context, rabbitMQConnection rabbitmqclient.RabbitMQConnection, event SseEvent) error {
+	return publish(ctx, rabbitMQConnection, event, SSERouteClientBroadcast)
+}
+
+func publish(ctx context.Context, rabbitMQConnection rabbitmqclient.RabbitMQConnection, event SseEvent, route string) error {
+	if event.Id == 0 {
+		id, err := nextEventId(ctx)
+		if err != nil {
+			rlog.Errorc(ctx, "could not reserve sse event id", err, rlog.String("event", event.Event))
+		}
+		event.Id = id
+	}
+	return rabbitMQConnection.SendMessage(ctx, event, route, nil)
+}
+
+func nextEventId(ctx context.Context) (int64, error) {
+	collection := mongodb.GetMongoDb().Collection(EVENTCOUNTERCOLLECTION)
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+
+	var counter struct {
+		Seq int64 `bson:"seq"`
+	}
+	err := collection.FindOneAndUpdate(ctx,
+		bson.M{"_id": eventIdCounter},
+		bson.M{"$inc": bson.M{"seq": int64(1)}},
+		opts,
+	).Decode(&counter)
+	if err != nil {
+		return 0, fmt.Errorf("could not increment event id: %w", err)
+	}
+	return counter.Seq, nil
+}
+
+// ParseLastEventId parses the Last-Event-ID a client reconnects with. An
+// empty id means the client has not received any events.
+func ParseLastEventId(lastEventId string) (int64, error) {
+	if lastEventId == "" {
+		return 0, nil
+	}
+	id, err := strconv.ParseInt(lastEventId, 10, 64)
+	if err != nil || id < 0 {
+		return 0, fmt.Errorf("invalid Last-Event-ID %q", lastEventId)
+	}
+	return id, nil
+}
+
+func replayBufferSize() int {
+	size, err := strconv.Atoi(rorconfig.GetString("SSE_REPLAY_BUFFER_SIZE"))
+	if err != nil || size <= 0 {
+		return defaultReplayBufferSize
+	}
+	return size
+}
+
+// eventHistory is a ring buffer of the last events received by the event
+// server, in the order they were received.
+type eventHistory struct {
+	lock   sync.RWMutex
+	events []SseEvent
+	next   int
+	full   bool
+}
+
+func newEventHistory(size int) *eventHistory {
+	return &eventHistory{events: make([]SseEvent, size)}
+}
+
+// add buffers the event, replacing the oldest event when the buffer is full.
+func (h *eventHistory) add(event SseEvent) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.events[h.next] = event
+	h.next = (h.next + 1) % len(h.events)
+	if h.next == 0 {
+		h.full = true
+	}
+}
+
+// ordered returns the buffered events, oldest first.
+func (h *eventHistory) ordered() []SseEvent {
+	if !h.full {
+		return append([]SseEvent(nil), h.events[:h.next]...)
+	}
+	return append(append([]SseEvent(nil), h.events[h.next:]...), h.events[:h.next]...)
+}
+
+// since returns the events received after the event with the id. Events
+// from different publishers can arrive slightly out of id order, so the
+// buffer position of the last event is used when it is still buffered.
+// complete is false when events after the id may have been dropped from the
+// buffer already.
+func (h *eventHistory) since(lastEventId int64) (events []SseEvent, complete bool) {
+	h.lock.RLock()
+	buffered := h.ordered()
+	h.lock.RUnlock()
+
+	for i, event := range buffered {
+		if event.Id == lastEventId {
+			return buffered[i+1:], true
+		}
+	}
+
+	complete = len(buffered) > 0 && buffered[0].Id <= lastEventId
+	for _, event := range buffered {
+		if event.Id > lastEventId {
+			events = append(events, event)
+		}
+	}
+	return events, complete
+}
@@ -0,0 +1,49 @@
+package sseservice
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func eventIds(events []SseEvent) []int64 {
+	var ids []int64
+	for _, event := range events {
+		ids = append(ids, event.Id)
+	}
+	return ids
+}
+
+func TestEventHistorySince(t *testing.T) {
+	history := newEventHistory(3)
+	for _, id := range []int64{1, 2, 4, 3} {
+		history.add(SseEvent{Id: id, Event: "test"})
+	}
+
+	events, complete := history.since(2)
+	assert.True(t, complete)
+	assert.Equal(t, []int64{4, 3}, eventIds(events), "events after a buffered id are replayed in received order")
+
+	events, complete = history.since(1)
+	assert.False(t, complete, "event 1 has been dropped from the buffer")
+	assert.Equal(t, []int64{2, 4, 3}, eventIds(events))
+
+	events, complete = history.since(5)
+	assert.True(t, complete)
+	assert.Empty(t, events)
+}
+
+func TestParseLastEventId(t *testing.T) {
+	id, err := ParseLastEventId("")
+	assert.NoError(t, err)
+	assert.Zero(t, id)
+
+	id, err = ParseLastEventId("42")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(42), id)
+
+	for _, lastEventId := range []string{"abc", "-1"} {
+		_, err := ParseLastEventId(lastEventId)
+		assert.Error(t, err, lastEventId)
+	}
+}
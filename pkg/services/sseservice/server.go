@@ -1,6 +1,8 @@
 package sseservice
 
 import (
+	"strconv"
+
 	"github.com/NorskHelsenett/ror/pkg/clients/rabbitmqclient"
 	"github.com/NorskHelsenett/ror/pkg/rlog"
 	"github.com/google/uuid"
@@ -20,6 +22,9 @@ type EventServer struct {
 
 	// Total client connections
 	Clients EventClients
+
+	// The last events received, replayed to reconnecting clients
+	history *eventHistory
 }
 
 type EventMessage struct {
@@ -34,6 +39,7 @@ func StartEventServer(rabbitMQConnection rabbitmqclient.RabbitMQConnection) {
 		NewClients:    make(chan *EventClient),
 		ClosedClients: make(chan EventClientId),
 		Clients:       NewEventClients(),
+		history:       newEventHistory(replayBufferSize()),
 	}
 
 	go Server.listen()
@@ -49,6 +55,9 @@ func (es *EventServer) listen() {
 		case client := <-es.NewClients:
 			es.Clients.Add(client)
 			rlog.Infof("Added sse client. %d registered clients", es.Clients.Len())
+			if client.added != nil {
+				close(client.added)
+			}
 		// Remove closed client
 		case client := <-es.ClosedClients:
 
@@ -60,13 +69,44 @@ func (es *EventServer) listen() {
 		case eventMsg := <-es.Message:
 			if len(eventMsg.Clients) > 0 {
 				for _, clientid := range eventMsg.Clients {
-					es.Clients.Get(clientid).Connection <- SseEvent{Event: eventMsg.Event, Data: eventMsg.Data}
+					// The client may have disconnected since the event was routed.
+					if client := es.Clients.Get(clientid); client != nil {
+						client.Connection <- SseEvent{Id: eventMsg.Id, Event: eventMsg.Event, Data: eventMsg.Data}
+					}
 				}
 			}
 		}
 	}
 }
 
+// Connect adds the client to the event server and returns the buffered
+// events after the last event id of the client, to be sent to it before the
+// events routed to it. It is called from the routine of the client, so the
+// event server is not held up by the replay. The client is added before the
+// buffer is read, so events received in the meantime are either replayed or
+// routed to it, never lost, and may be both.
+func (es *EventServer) Connect(client *EventClient) []SseEvent {
+	client.added = make(chan struct{})
+	es.NewClients <- client
+	<-client.added
+	if client.LastEventId == 0 {
+		return nil
+	}
+
+	events, complete := es.history.since(client.LastEventId)
+	replay := make([]SseEvent, 0, len(events)+1)
+	if !complete {
+		replay = append(replay, SseEvent{Event: SseEventResync, Data: strconv.FormatInt(client.LastEventId, 10)})
+	}
+	for _, event := range events {
+		if client.Receives(event.Topics, EventOwners(event)) {
+			replay = append(replay, SseEvent{Id: event.Id, Event: event.Event, Data: event.Data})
+		}
+	}
+	rlog.Debug("replaying sse events", rlog.String("clientId", string(client.Id)), rlog.Int("count", len(replay)))
+	return replay
+}
+
 func NewEventClientId() EventClientId {
 	id, _ := uuid.NewUUID()
 	return EventClientId(id.String())
@@ -0,0 +1,136 @@
+package sseservice
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/NorskHelsenett/ror-api/internal/acl/aclservice"
+
+	"github.com/NorskHelsenett/ror/pkg/models/aclmodels"
+	"github.com/NorskHelsenett/ror/pkg/models/aclmodels/rorresourceowner"
+	identitymodels "github.com/NorskHelsenett/ror/pkg/models/identity"
+)
+
+const (
+	TopicResource = "resource"
+	TopicCluster  = "cluster"
+	TopicOrder    = "order"
+
+	// TopicWildcard subscribes to every topic of a type, e.g. resource/*.
+	TopicWildcard = "*"
+
+	// accessCacheTTL is how long a client's read access to an owner is
+	// cached, so delivering an event does not look up the acl every time.
+	accessCacheTTL = time.Minute
+)
+
+var ErrInvalidTopic = errors.New("invalid topic")
+
+var topicTypes = []string{TopicResource, TopicCluster, TopicOrder}
+
+// ResourceTopic is the topic of events about resources of a kind.
+func ResourceTopic(kind string) Subscription {
+	return Subscription(TopicResource + "/" + kind)
+}
+
+// ClusterTopic is the topic of events about a cluster and its resources, by
+// the uid of the cluster.
+func ClusterTopic(clusterUid string) Subscription {
+	return Subscription(TopicCluster + "/" + clusterUid)
+}
+
+// OrderTopic is the topic of events about an order.
+func OrderTopic(uid string) Subscription {
+	return Subscription(TopicOrder + "/" + uid)
+}
+
+// ParseSubscription parses a topic written as <type>/<id>, where the id can be
+// * to subscribe to every topic of the type.
+func ParseSubscription(topic string) (Subscription, error) {
+	topicType, id, found := strings.Cut(strings.TrimSpace(topic), "/")
+	if !found || id == "" {
+		return "", fmt.Errorf("%w: %q is not written as <type>/<id>", ErrInvalidTopic, topic)
+	}
+	if !slices.Contains(topicTypes, topicType) {
+		return "", fmt.Errorf("%w: unknown topic type %q", ErrInvalidTopic, topicType)
+	}
+	return Subscription(topicType + "/" + id), nil
+}
+
+// Matches reports whether an event published on the topic is delivered to
+// the subscription.
+func (s Subscription) Matches(topic Subscription) bool {
+	if s == topic {
+		return true
+	}
+	topicType, id, _ := strings.Cut(string(s), "/")
+	return id == TopicWildcard && strings.HasPrefix(string(topic), topicType+"/")
+}
+
+// owner returns the owner a client must have read access to for events on a
+// cluster topic, or nil for other topics.
+func (s Subscription) owner() *rorresourceowner.RorResourceOwnerReference {
+	topicType, id, _ := strings.Cut(string(s), "/")
+	if topicType != TopicCluster || id == TopicWildcard {
+		return nil
+	}
+	return &rorresourceowner.RorResourceOwnerReference{
+		Scope:   aclmodels.Acl2ScopeCluster.ToKind(),
+		Subject: aclmodels.Acl2Subject(id),
+	}
+}
+
+// EventOwners returns the owners a client or webhook must have read access to
+// for the event: the event owner and the clusters of its cluster topics.
+func EventOwners(event SseEvent) []rorresourceowner.RorResourceOwnerReference {
+	owners := make([]rorresourceowner.RorResourceOwnerReference, 0, len(event.Topics)+1)
+	if event.Owner != nil {
+		owners = append(owners, *event.Owner)
+	}
+	for _, topic := range event.Topics {
+		if owner := topic.owner(); owner != nil {
+			owners = append(owners, *owner)
+		}
+	}
+	return owners
+}
+
+// clientAccess caches the read access of a client identity to owners, keyed
+// by scope/subject.
+type clientAccess struct {
+	lock    sync.Mutex
+	entries map[string]clientAccessEntry
+}
+
+type clientAccessEntry struct {
+	read    bool
+	expires time.Time
+}
+
+// canRead reports whether the identity has read access to the owner.
+func (a *clientAccess) canRead(identity identitymodels.Identity, owner rorresourceowner.RorResourceOwnerReference) bool {
+	key := fmt.Sprintf("%s/%s", owner.Scope, owner.Subject)
+	now := time.Now()
+	a.lock.Lock()
+	entry, ok := a.entries[key]
+	a.lock.Unlock()
+	if ok && now.Before(entry.expires) {
+		return entry.read
+	}
+
+	ctx := context.WithValue(context.Background(), identitymodels.ContexIdentity, identity)
+	read := aclservice.CheckAccessByRorOwnerref(ctx, owner).Read
+
+	a.lock.Lock()
+	if a.entries == nil {
+		a.entries = make(map[string]clientAccessEntry)
+	}
+	a.entries[key] = clientAccessEntry{read: read, expires: now.Add(accessCacheTTL)}
+	a.lock.Unlock()
+	return read
+}
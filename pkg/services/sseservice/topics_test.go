@@ -0,0 +1,40 @@
+package sseservice
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSubscription(t *testing.T) {
+	subscription, err := ParseSubscription(" cluster/abc ")
+	require.NoError(t, err)
+	assert.Equal(t, ClusterTopic("abc"), subscription)
+
+	for _, topic := range []string{"", "cluster", "cluster/", "unknown/abc"} {
+		_, err := ParseSubscription(topic)
+		assert.ErrorIs(t, err, ErrInvalidTopic, topic)
+	}
+}
+
+func TestSubscriptionMatches(t *testing.T) {
+	assert.True(t, ResourceTopic("Namespace").Matches(ResourceTopic("Namespace")))
+	assert.False(t, ResourceTopic("Namespace").Matches(ResourceTopic("Pod")))
+	assert.True(t, ResourceTopic(TopicWildcard).Matches(ResourceTopic("Pod")))
+	assert.False(t, ResourceTopic(TopicWildcard).Matches(ClusterTopic("abc")))
+}
+
+func TestEventClientReceives(t *testing.T) {
+	client := &EventClient{}
+	client.Subscribe(OrderTopic("uid-1"))
+	client.Subscribe(OrderTopic("uid-1"))
+	assert.Len(t, client.Subscriptions, 1)
+
+	assert.True(t, client.Receives(nil, nil), "events without topics are broadcast")
+	assert.True(t, client.Receives([]Subscription{OrderTopic("uid-1")}, nil))
+	assert.False(t, client.Receives([]Subscription{OrderTopic("uid-2")}, nil))
+
+	client.Unsubscribe(OrderTopic("uid-1"))
+	assert.False(t, client.Receives([]Subscription{OrderTopic("uid-1")}, nil))
+}
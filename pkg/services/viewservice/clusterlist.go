@@ -4,7 +4,6 @@ import (
 	"context"
 	"fmt"
 
-	"github.com/NorskHelsenett/ror-api/internal/apiservices/resourcesv2service"
 	"github.com/NorskHelsenett/ror-api/pkg/services/priceservice"
 	"github.com/NorskHelsenett/ror/pkg/apicontracts/v2/apiview"
 	"github.com/NorskHelsenett/ror/pkg/rorresources"
@@ -23,11 +22,14 @@ func init() {
 
 // Implement the ListViewGenerator interface for clusterlistgenerator
 func (g *clusterlistgenerator) GenerateView(ctx context.Context, opts ...ViewGeneratorsOption) (apiview.View, error) {
-	// Placeholder implementation
+	rows, err := createClusterListData(ctx, opts...)
+	if err != nil {
+		return apiview.View{}, err
+	}
 	return apiview.View{
 		Type:    ClusterListView,
 		Columns: createClusterListHeaders(ctx, opts...),
-		Rows:    createClusterListData(ctx, opts...),
+		Rows:    rows,
 	}, nil
 }
 
@@ -271,20 +273,23 @@ func createClusterListHeaders(_ context.Context, _ ...ViewGeneratorsOption) []ap
 	}
 }
 
-func createClusterListData(ctx context.Context, _ ...ViewGeneratorsOption) []apiview.ViewRow {
+func createClusterListData(ctx context.Context, opts ...ViewGeneratorsOption) ([]apiview.ViewRow, error) {
 
-	resourcesService, _ := resourcesv2service.GetResourceByQuery(ctx, &rorresources.ResourceQuery{
+	resourcesService, err := getViewResources(ctx, &rorresources.ResourceQuery{
 		VersionKind: rortypes.ResourceKubernetesClusterGVK,
 		Limit:       1000,
-	},
-	)
+	}, opts...)
+	if err != nil {
+		return nil, err
+	}
 	if resourcesService == nil {
-		return []apiview.ViewRow{}
+		return []apiview.ViewRow{}, nil
 	}
 	ret := make([]apiview.ViewRow, 0, len(resourcesService.Resources))
+	prices := priceservice.GetCatalogue(ctx)
 	for _, resource := range resourcesService.Resources {
 		cluster := resource.KubernetesClusterResource
-		priceMonth := priceservice.CalculatePrice(cluster)
+		priceMonth := prices.CalculatePrice(cluster)
 
 		row := apiview.ViewRow{
 			"clusterUid": {
@@ -385,5 +390,5 @@ func createClusterListData(ctx context.Context, _ ...ViewGeneratorsOption) []api
 		}
 		ret = append(ret, row)
 	}
-	return ret
+	return ret, nil
 }
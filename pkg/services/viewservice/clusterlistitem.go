@@ -321,9 +321,10 @@ func createClusterListItemData(ctx context.Context, options ...ViewGeneratorsOpt
 		return []apiview.ViewRow{}
 	}
 	ret := make([]apiview.ViewRow, 0, len(resourcesService.Resources))
+	prices := priceservice.GetCatalogue(ctx)
 	for _, resource := range resourcesService.Resources {
 		cluster := resource.KubernetesClusterResource
-		priceMonth := priceservice.CalculatePrice(cluster)
+		priceMonth := prices.CalculatePrice(cluster)
 
 		row := apiview.ViewRow{
 			"clusterUid": {
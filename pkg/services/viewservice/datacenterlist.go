@@ -3,7 +3,6 @@ package viewservice
 import (
 	"context"
 
-	"github.com/NorskHelsenett/ror-api/internal/apiservices/resourcesv2service"
 	"github.com/NorskHelsenett/ror/pkg/apicontracts/v2/apiview"
 	"github.com/NorskHelsenett/ror/pkg/rorresources"
 	"github.com/NorskHelsenett/ror/pkg/rorresources/rortypes"
@@ -21,11 +20,14 @@ func init() {
 
 // Implement the ListViewGenerator interface for datacenterlistgenerator
 func (g *datacenterlistgenerator) GenerateView(ctx context.Context, opts ...ViewGeneratorsOption) (apiview.View, error) {
-	// Placeholder implementation
+	rows, err := createDatacenterListData(ctx, opts...)
+	if err != nil {
+		return apiview.View{}, err
+	}
 	return apiview.View{
 		Type:    DatacenterListView,
 		Columns: createDatacenterListHeaders(ctx, opts...),
-		Rows:    createDatacenterListData(ctx, opts...),
+		Rows:    rows,
 	}, nil
 }
 
@@ -87,15 +89,17 @@ func createDatacenterListHeaders(_ context.Context, _ ...ViewGeneratorsOption) [
 	}
 }
 
-func createDatacenterListData(ctx context.Context, _ ...ViewGeneratorsOption) []apiview.ViewRow {
+func createDatacenterListData(ctx context.Context, opts ...ViewGeneratorsOption) ([]apiview.ViewRow, error) {
 
-	resourcesService, _ := resourcesv2service.GetResourceByQuery(ctx, &rorresources.ResourceQuery{
+	resourcesService, err := getViewResources(ctx, &rorresources.ResourceQuery{
 		VersionKind: rortypes.ResourceDatacenterGVK,
 		Limit:       1000,
-	},
-	)
+	}, opts...)
+	if err != nil {
+		return nil, err
+	}
 	if resourcesService == nil {
-		return []apiview.ViewRow{}
+		return []apiview.ViewRow{}, nil
 	}
 	ret := make([]apiview.ViewRow, 0, len(resourcesService.Resources))
 	for _, resource := range resourcesService.Resources {
@@ -123,5 +127,5 @@ func createDatacenterListData(ctx context.Context, _ ...ViewGeneratorsOption) []
 		}
 		ret = append(ret, row)
 	}
-	return ret
+	return ret, nil
 }
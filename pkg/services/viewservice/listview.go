@@ -6,7 +6,9 @@ import (
 	"strconv"
 	"strings"
 
+	"github.com/NorskHelsenett/ror-api/internal/apiservices/resourcesv2service"
 	"github.com/NorskHelsenett/ror/pkg/apicontracts/v2/apiview"
+	"github.com/NorskHelsenett/ror/pkg/rorresources"
 	"github.com/gin-gonic/gin"
 )
 
@@ -22,11 +24,22 @@ type ViewGenerators map[string]ViewGenerator
 var Generators = ViewGenerators{}
 
 type viewGeneratorOptions struct {
-	limit  int
-	offset int
-	sort   map[int]viewGeneratorOptionSort
-	filter map[int]string
-	fields []string
+	limit         int
+	offset        int
+	sort          map[int]viewGeneratorOptionSort
+	filter        map[int]string
+	fields        []string
+	continueToken string
+	page          *ViewPage
+}
+
+// ViewPage receives the paging state of a view generated with OptionContinue.
+type ViewPage struct {
+	// Continue is the token of the next page, empty on the last page.
+	Continue string
+	// Count is the number of rows in the view, only set on the first page.
+	Count          *int64
+	CountEstimated bool
 }
 
 type viewGeneratorOptionSort struct {
@@ -85,6 +98,40 @@ func OptionFields(fields string) ViewGeneratorsOption {
 	})
 }
 
+// OptionContinue pages through the view with continue tokens, using the
+// limit option as page size. An empty token returns the first page. Views
+// that support paging store the token of the next page in page.
+func OptionContinue(token string, page *ViewPage) ViewGeneratorsOption {
+	return optionFunc(func(cfg *viewGeneratorOptions) {
+		cfg.continueToken = token
+		cfg.page = page
+	})
+}
+
+// getViewResources returns the resources of a list view, a page of them when
+// the view is generated with OptionContinue.
+func getViewResources(ctx context.Context, query *rorresources.ResourceQuery, opts ...ViewGeneratorsOption) (*rorresources.ResourceSet, error) {
+	cfg := &viewGeneratorOptions{}
+	for _, opt := range opts {
+		opt.apply(cfg)
+	}
+	if cfg.page == nil {
+		return resourcesv2service.GetResourceByQuery(ctx, query)
+	}
+
+	if cfg.limit > 0 {
+		query.Limit = cfg.limit
+	}
+	page, err := resourcesv2service.GetResourcePage(ctx, query, cfg.continueToken)
+	if err != nil {
+		return nil, err
+	}
+	cfg.page.Continue = page.Continue
+	cfg.page.Count = page.Count
+	cfg.page.CountEstimated = page.CountEstimated
+	return page.Resources, nil
+}
+
 func (lv *ViewGenerators) RegisterViewGenerator(listType string, generator ViewGenerator) {
 	(*lv)[listType] = generator
 }
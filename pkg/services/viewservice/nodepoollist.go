@@ -3,7 +3,6 @@ package viewservice
 import (
 	"context"
 
-	"github.com/NorskHelsenett/ror-api/internal/apiservices/resourcesv2service"
 	"github.com/NorskHelsenett/ror/pkg/apicontracts/v2/apiview"
 	"github.com/NorskHelsenett/ror/pkg/rorresources"
 	"github.com/NorskHelsenett/ror/pkg/rorresources/rortypes"
@@ -21,11 +20,14 @@ func init() {
 
 // Implement the ListViewGenerator interface for nodepoollistgenerator
 func (g *nodepoollistgenerator) GenerateView(ctx context.Context, opts ...ViewGeneratorsOption) (apiview.View, error) {
-	// Placeholder implementation
+	rows, err := createNodepoolListData(ctx, opts...)
+	if err != nil {
+		return apiview.View{}, err
+	}
 	return apiview.View{
 		Type:    NodepoolListView,
 		Columns: createNodepoolListHeaders(ctx, opts...),
-		Rows:    createNodepoolListData(ctx, opts...),
+		Rows:    rows,
 	}, nil
 }
 
@@ -66,15 +68,17 @@ func createNodepoolListHeaders(_ context.Context, _ ...ViewGeneratorsOption) []a
 	}
 }
 
-func createNodepoolListData(ctx context.Context, _ ...ViewGeneratorsOption) []apiview.ViewRow {
+func createNodepoolListData(ctx context.Context, opts ...ViewGeneratorsOption) ([]apiview.ViewRow, error) {
 
-	resourcesService, _ := resourcesv2service.GetResourceByQuery(ctx, &rorresources.ResourceQuery{
+	resourcesService, err := getViewResources(ctx, &rorresources.ResourceQuery{
 		VersionKind: rortypes.ResourceKubernetesClusterGVK,
 		Limit:       1000,
-	},
-	)
+	}, opts...)
+	if err != nil {
+		return nil, err
+	}
 	if resourcesService == nil {
-		return []apiview.ViewRow{}
+		return []apiview.ViewRow{}, nil
 	}
 	ret := make([]apiview.ViewRow, 0, len(resourcesService.Resources))
 	for _, resource := range resourcesService.Resources {
@@ -93,5 +97,5 @@ func createNodepoolListData(ctx context.Context, _ ...ViewGeneratorsOption) []ap
 		}
 		ret = append(ret, row)
 	}
-	return ret
+	return ret, nil
 }
@@ -21,11 +21,14 @@ func init() {
 
 // Implement the ListViewGenerator interface for workspacelistgenerator
 func (g *workspacelistgenerator) GenerateView(ctx context.Context, opts ...ViewGeneratorsOption) (apiview.View, error) {
-	// Placeholder implementation
+	rows, err := createWorkspaceListData(ctx, opts...)
+	if err != nil {
+		return apiview.View{}, err
+	}
 	return apiview.View{
 		Type:    WorkspaceListView,
 		Columns: createWorkspaceListHeaders(ctx, opts...),
-		Rows:    createWorkspaceListData(ctx, opts...),
+		Rows:    rows,
 	}, nil
 }
 
@@ -94,16 +97,18 @@ func createWorkspaceListHeaders(_ context.Context, _ ...ViewGeneratorsOption) []
 	}
 }
 
-func createWorkspaceListData(ctx context.Context, _ ...ViewGeneratorsOption) []apiview.ViewRow {
+func createWorkspaceListData(ctx context.Context, opts ...ViewGeneratorsOption) ([]apiview.ViewRow, error) {
 	datacenterNamesByID := getDatacenterNamesByID(ctx)
 
-	resourcesService, _ := resourcesv2service.GetResourceByQuery(ctx, &rorresources.ResourceQuery{
+	resourcesService, err := getViewResources(ctx, &rorresources.ResourceQuery{
 		VersionKind: rortypes.ResourceWorkspaceGVK,
 		Limit:       1000,
-	},
-	)
+	}, opts...)
+	if err != nil {
+		return nil, err
+	}
 	if resourcesService == nil {
-		return []apiview.ViewRow{}
+		return []apiview.ViewRow{}, nil
 	}
 	ret := make([]apiview.ViewRow, 0, len(resourcesService.Resources))
 	for _, resource := range resourcesService.Resources {
@@ -141,7 +146,7 @@ func createWorkspaceListData(ctx context.Context, _ ...ViewGeneratorsOption) []a
 		}
 		ret = append(ret, row)
 	}
-	return ret
+	return ret, nil
 }
 
 func getDatacenterNamesByID(ctx context.Context) map[string]string {